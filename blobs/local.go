@@ -0,0 +1,91 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps blobs as files below a directory, their media type is told by the
+// extension of their key.
+type LocalStore struct {
+	directory string
+}
+
+func NewLocal(directory string) *LocalStore {
+	return &LocalStore{directory: directory}
+}
+
+func (l *LocalStore) Put(ctx context.Context, key string, blob Blob) error {
+	file, err := l.file(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	// The blob is written next to its file and renamed over it, so readers never see
+	// half of it.
+	temporary := file + ".tmp"
+	if err = ioutil.WriteFile(temporary, blob.Data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, file)
+}
+
+func (l *LocalStore) Get(ctx context.Context, key string) (Blob, error) {
+	file, err := l.file(key)
+	if err != nil {
+		return Blob{}, err
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return Blob{}, ErrNotFound
+	}
+	if err != nil {
+		return Blob{}, err
+	}
+	return Blob{Data: data, ContentType: mime.TypeByExtension(path.Ext(key))}, nil
+}
+
+func (l *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	file, err := l.file(key)
+	if err != nil {
+		return nil, err
+	}
+	opened, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return opened, nil
+}
+
+func (l *LocalStore) Delete(ctx context.Context, key string) error {
+	file, err := l.file(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// file returns where key is kept, refusing keys which would lead out of the directory.
+func (l *LocalStore) file(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned != "/"+key || strings.Contains(key, "\\") {
+		return "", errors.New("invalid blob key: " + key)
+	}
+	return filepath.Join(l.directory, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,268 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go-rest-webservices-book-library/config"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	s3Service        = "s3"
+)
+
+// S3Store keeps blobs in a bucket of an S3-compatible object store such as AWS S3, MinIO
+// or Ceph. Buckets are addressed by path, which every such store understands, and requests
+// are signed with AWS Signature Version 4.
+type S3Store struct {
+	store  config.ObjectStore
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3(store config.ObjectStore) *S3Store {
+	return &S3Store{store: store, client: &http.Client{Timeout: 30 * time.Second}, now: time.Now}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, blob Blob) error {
+	r, err := s.request(ctx, "PUT", key, blob.Data)
+	if err != nil {
+		return err
+	}
+	if blob.ContentType != "" {
+		r.Header.Set("Content-Type", blob.ContentType)
+	}
+	response, err := s.do(r, blob.Data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return responseError(response)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (Blob, error) {
+	r, err := s.request(ctx, "GET", key, nil)
+	if err != nil {
+		return Blob{}, err
+	}
+	response, err := s.do(r, nil)
+	if err != nil {
+		return Blob{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return Blob{}, ErrNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return Blob{}, responseError(response)
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return Blob{}, err
+	}
+	return Blob{Data: data, ContentType: response.Header.Get("Content-Type")}, nil
+}
+
+// Open asks the store for the size of the object, and reads it with ranged GETs from then on.
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	r, err := s.request(ctx, "HEAD", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.do(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, responseError(response)
+	}
+	return &s3Reader{store: s, ctx: ctx, key: key, size: response.ContentLength}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	r, err := s.request(ctx, "DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.do(r, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK &&
+		response.StatusCode != http.StatusNotFound {
+		return responseError(response)
+	}
+	return nil
+}
+
+// s3Reader reads an object from the offset of its first read after each seek to its end,
+// with a single ranged GET, so a range is read with one request whatever its length.
+type s3Reader struct {
+	store  *S3Store
+	ctx    context.Context
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *s3Reader) Read(data []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		r, err := o.store.request(o.ctx, "GET", o.key, nil)
+		if err != nil {
+			return 0, err
+		}
+		r.Header.Set("Range", "bytes="+strconv.FormatInt(o.offset, 10)+"-")
+		response, err := o.store.do(r, nil)
+		if err != nil {
+			return 0, err
+		}
+		if response.StatusCode != http.StatusPartialContent {
+			defer response.Body.Close()
+			return 0, responseError(response)
+		}
+		o.body = response.Body
+	}
+
+	read, err := o.body.Read(data)
+	o.offset += int64(read)
+	return read, err
+}
+
+func (o *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	position := offset
+	switch whence {
+	case io.SeekCurrent:
+		position += o.offset
+	case io.SeekEnd:
+		position += o.size
+	}
+	if position < 0 {
+		return o.offset, errors.New("seek before the start of the object")
+	}
+	if position != o.offset {
+		_ = o.Close()
+	}
+	o.offset = position
+	return position, nil
+}
+
+func (o *s3Reader) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+func (s *S3Store) request(ctx context.Context, method string, key string, data []byte) (*http.Request, error) {
+	endpoint := strings.TrimSuffix(s.store.Endpoint, "/")
+	target, err := url.Parse(endpoint + "/" + s.store.Bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(method, target.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return r.WithContext(ctx), nil
+}
+
+func (s *S3Store) do(r *http.Request, data []byte) (*http.Response, error) {
+	sum := sha256.Sum256(data)
+	r.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	r.Header.Set("X-Amz-Date", s.now().UTC().Format(amzDateFormat))
+	sign(r, s.store)
+	return s.client.Do(r)
+}
+
+// sign adds the Authorization header of AWS Signature Version 4 to r, signing the host and
+// every header set on r. X-Amz-Date and X-Amz-Content-Sha256 must have been set.
+func sign(r *http.Request, store config.ObjectStore) {
+	amzDate := r.Header.Get("X-Amz-Date")
+	scope := amzDate[:8] + "/" + store.Region + "/" + s3Service + "/aws4_request"
+
+	headers := map[string]string{"host": r.URL.Host}
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := signingAlgorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestSum[:])
+
+	key := []byte("AWS4" + store.SecretKey)
+	for _, part := range []string{amzDate[:8], store.Region, s3Service, "aws4_request", stringToSign} {
+		key = hmacSum(key, part)
+	}
+	r.Header.Set("Authorization", signingAlgorithm+" Credential="+store.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(key))
+}
+
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.ReplaceAll(strings.Join(pairs, "&"), "+", "%20")
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func responseError(response *http.Response) error {
+	body, _ := ioutil.ReadAll(response.Body)
+	message := strings.TrimSpace(string(body))
+	if len(message) > 200 {
+		message = message[:200]
+	}
+	return errors.New("object store answered " + strconv.Itoa(response.StatusCode) + ": " + message)
+}
@@ -0,0 +1,46 @@
+// Package blobs keeps binary objects, such as cover images, by key. The local filesystem
+// is used unless an S3-compatible object store is configured.
+package blobs
+
+import (
+	"context"
+	"errors"
+	"go-rest-webservices-book-library/config"
+	"io"
+)
+
+const (
+	StoreLocal = "local"
+	StoreS3    = "s3"
+)
+
+// ErrNotFound is returned by Get and Open for keys which are not stored.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs by key, a slash separated path such as "covers/7/original.jpg".
+// Putting a key which is stored replaces it, and deleting one which is not is no error.
+type Store interface {
+	Put(ctx context.Context, key string, blob Blob) error
+	Get(ctx context.Context, key string) (Blob, error)
+	// Open reads a blob from any offset without loading it whole, for serving ranges of
+	// large blobs. The reader must be closed, and only lives as long as ctx.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Blob is the content of a stored object along with its media type.
+type Blob struct {
+	Data        []byte
+	ContentType string
+}
+
+// New returns the store chosen by blobs.store in config.yml.
+func New() (Store, error) {
+	switch config.BlobStore {
+	case StoreLocal:
+		return NewLocal(config.BlobDirectory), nil
+	case StoreS3:
+		return NewS3(config.BlobS3), nil
+	}
+	return nil, errors.New("unknown blob store: " + config.BlobStore + ", expected " + StoreLocal + " or " + StoreS3)
+}
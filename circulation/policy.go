@@ -0,0 +1,74 @@
+// Package circulation applies the loan policies of config.yml: when loans are due, whether
+// they can be renewed and what is owed for returning them late.
+package circulation
+
+import (
+	"errors"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+var (
+	ErrReturned     = errors.New("loan has been returned")
+	ErrOverdue      = errors.New("loan is overdue, return it to settle the fine")
+	ErrHeld         = errors.New("other members hold the book")
+	ErrRenewalLimit = errors.New("loan has been renewed as often as its policy allows")
+)
+
+// Policy returns the loan policy of an item type, that of config.DefaultItemType when the
+// item type has none.
+func Policy(itemType string) config.LoanPolicy {
+	if policy, found := config.LoanPolicies[itemType]; found {
+		return policy
+	}
+	return config.LoanPolicies[config.DefaultItemType]
+}
+
+// DueAt returns when a loan made at loanedAt under policy is due.
+func DueAt(loanedAt time.Time, policy config.LoanPolicy) time.Time {
+	return loanedAt.AddDate(0, 0, policy.LoanDays)
+}
+
+// Renew returns when loan is due once renewed at now, a full loan period from now, or an
+// error telling why it cannot be: a loan which has been returned, is overdue, has been
+// renewed policy.MaxRenewals times or is of a book other members hold is not renewed.
+func Renew(loan domain.Loan, policy config.LoanPolicy, holds int, now time.Time) (time.Time, error) {
+	switch {
+	case loan.ReturnedAt != nil:
+		return time.Time{}, ErrReturned
+	case now.After(loan.DueAt):
+		return time.Time{}, ErrOverdue
+	case loan.Renewals >= policy.MaxRenewals:
+		return time.Time{}, ErrRenewalLimit
+	case holds > 0:
+		return time.Time{}, ErrHeld
+	}
+
+	dueAt := DueAt(now, policy)
+	if dueAt.Before(loan.DueAt) {
+		dueAt = loan.DueAt
+	}
+	return dueAt, nil
+}
+
+// Fine returns the days late and the fine of a loan returned at returnedAt. Every started
+// day counts, and nothing is owed for a loan returned within the grace days.
+func Fine(loan domain.Loan, policy config.LoanPolicy, returnedAt time.Time) (int, int64) {
+	late := returnedAt.Sub(loan.DueAt)
+	if late <= 0 {
+		return 0, 0
+	}
+	days := int((late + day - 1) / day)
+	if days <= policy.GraceDays {
+		return days, 0
+	}
+
+	amount := int64(days) * policy.FinePerDay
+	if policy.FineCap > 0 && amount > policy.FineCap {
+		amount = policy.FineCap
+	}
+	return days, amount
+}
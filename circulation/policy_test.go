@@ -0,0 +1,75 @@
+package circulation
+
+import (
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"testing"
+	"time"
+)
+
+var policy = config.LoanPolicy{LoanDays: 21, MaxRenewals: 2, GraceDays: 2, FinePerDay: 25, FineCap: 1000}
+
+func TestPolicy(t *testing.T) {
+	if got := Policy(config.DefaultItemType); got != config.LoanPolicies[config.DefaultItemType] {
+		t.Errorf("Expected the policy of the default item type, got %+v", got)
+	}
+	if got := Policy("zine"); got != config.LoanPolicies[config.DefaultItemType] {
+		t.Errorf("Expected an item type without a policy to follow the default one, got %+v", got)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	returnedAt := now.Add(-time.Hour)
+	scenarios := []struct {
+		name  string
+		loan  domain.Loan
+		holds int
+		dueAt time.Time
+		err   error
+	}{
+		{name: "should renew from now", loan: domain.Loan{DueAt: now.AddDate(0, 0, 3)}, dueAt: now.AddDate(0, 0, 21)},
+		{name: "should not shorten a loan", loan: domain.Loan{DueAt: now.AddDate(0, 0, 30), Renewals: 1}, dueAt: now.AddDate(0, 0, 30)},
+		{name: "should refuse returned loans", loan: domain.Loan{DueAt: now.AddDate(0, 0, 3), ReturnedAt: &returnedAt}, err: ErrReturned},
+		{name: "should refuse overdue loans", loan: domain.Loan{DueAt: now.Add(-time.Minute)}, err: ErrOverdue},
+		{name: "should refuse loans renewed too often", loan: domain.Loan{DueAt: now.AddDate(0, 0, 3), Renewals: 2}, err: ErrRenewalLimit},
+		{name: "should refuse loans of held books", loan: domain.Loan{DueAt: now.AddDate(0, 0, 3)}, holds: 1, err: ErrHeld},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			dueAt, err := Renew(scenario.loan, policy, scenario.holds, now)
+			if err != scenario.err || !dueAt.Equal(scenario.dueAt) {
+				t.Errorf("Expected %v, %v, got %v, %v", scenario.dueAt, scenario.err, dueAt, err)
+			}
+		})
+	}
+}
+
+func TestFine(t *testing.T) {
+	t.Parallel()
+	dueAt := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	scenarios := []struct {
+		name       string
+		returnedAt time.Time
+		policy     config.LoanPolicy
+		days       int
+		amount     int64
+	}{
+		{name: "should not fine loans returned on time", returnedAt: dueAt, policy: policy},
+		{name: "should not fine loans returned within the grace days", returnedAt: dueAt.Add(47 * time.Hour), policy: policy, days: 2},
+		{name: "should fine every started day past the grace days", returnedAt: dueAt.Add(49 * time.Hour), policy: policy, days: 3, amount: 75},
+		{name: "should cap fines", returnedAt: dueAt.AddDate(0, 2, 0), policy: policy, days: 61, amount: 1000},
+		{name: "should not cap fines without a cap", returnedAt: dueAt.AddDate(0, 0, 61), policy: config.LoanPolicy{FinePerDay: 25}, days: 61, amount: 1525},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			days, amount := Fine(domain.Loan{DueAt: dueAt}, scenario.policy, scenario.returnedAt)
+			if days != scenario.days || amount != scenario.amount {
+				t.Errorf("Expected %v days and %v, got %v days and %v", scenario.days, scenario.amount, days, amount)
+			}
+		})
+	}
+}
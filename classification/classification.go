@@ -0,0 +1,216 @@
+// Package classification reads classification files, a Dewey-like or a BISAC-like list of
+// classes, into the subjects and parents they describe, so the subject tree can be seeded
+// from them.
+package classification
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	FormatDewey = "dewey"
+	FormatBisac = "bisac"
+)
+
+var (
+	// deweyCode is a Dewey-like class, three digits and an optional decimal part, such as
+	// "823.914".
+	deweyCode = regexp.MustCompile(`^\d{3}(\.\d+)?$`)
+	// bisacCode is a BISAC-like code, three letters and six digits, such as "FIC009020".
+	bisacCode = regexp.MustCompile(`^[A-Z]{3}\d{6}$`)
+)
+
+// Entry is a class of a classification file. Parent is the code of the class it is filed
+// under, empty for the top classes.
+type Entry struct {
+	Code   string
+	Name   string
+	Parent string
+}
+
+// class is an entry along with the key it is known by within its file and the keys of the
+// classes it could be filed under, nearest first.
+type class struct {
+	Entry
+	key       string
+	ancestors []string
+}
+
+// Read reads a classification file of format, one class per line: its code, then its
+// name, separated by a space or a tab. Blank lines and lines starting with # are skipped.
+// Classes are filed under the nearest of their ancestors the file lists, and returned
+// with every class after the one it is filed under.
+//
+// Dewey-like files name a class by number, "823 English fiction", and a class is filed
+// under the numbers it extends: 823.9 under 823, 823 under 820 and 820 under 800.
+//
+// BISAC-like files name a class by its heading, "FIC009020 FICTION / Fantasy / Epic", and
+// a class is filed under the heading it extends. A heading ending with "General" names
+// the class of the heading before it, so "FIC009000 FICTION / Fantasy / General" is
+// Fantasy, filed under FICTION.
+func Read(r io.Reader, format string) ([]Entry, error) {
+	var parse func(code string, name string) (class, error)
+	switch format {
+	case FormatDewey:
+		parse = parseDewey
+	case FormatBisac:
+		parse = parseBisac
+	default:
+		return nil, errors.New("unknown classification format: " + format + ", expected " + FormatDewey + " or " + FormatBisac)
+	}
+
+	var classes []class
+	lines := map[string]int{}
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		space := strings.IndexAny(text, " \t")
+		if space < 0 {
+			return nil, errors.New("line " + strconv.Itoa(number) + ": expected a code followed by a name")
+		}
+
+		c, err := parse(text[:space], strings.TrimSpace(text[space:]))
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(number) + ": " + err.Error())
+		}
+		if other, found := lines[c.key]; found {
+			return nil, errors.New("line " + strconv.Itoa(number) + ": " + c.Code + " repeats the class of line " + strconv.Itoa(other))
+		}
+		lines[c.key] = number
+		classes = append(classes, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	codes := map[string]string{}
+	for _, c := range classes {
+		codes[c.key] = c.Code
+	}
+	parents := map[string]string{}
+	for i, c := range classes {
+		for _, ancestor := range c.ancestors {
+			if code, found := codes[ancestor]; found {
+				classes[i].Parent = code
+				parents[c.Code] = code
+				break
+			}
+		}
+	}
+
+	// Parents are shorter codes or headings than their children, so counting the classes
+	// above each one ends.
+	depths := map[string]int{}
+	for _, c := range classes {
+		for code := c.Parent; code != ""; code = parents[code] {
+			depths[c.Code]++
+		}
+	}
+	sort.SliceStable(classes, func(i, j int) bool {
+		return depths[classes[i].Code] < depths[classes[j].Code]
+	})
+
+	entries := make([]Entry, len(classes))
+	for i, c := range classes {
+		entries[i] = c.Entry
+	}
+	return entries, nil
+}
+
+func parseDewey(code string, name string) (class, error) {
+	if !deweyCode.MatchString(code) {
+		return class{}, errors.New(code + " is not a Dewey number such as 823 or 823.914")
+	}
+
+	var ancestors []string
+	whole := code
+	if dot := strings.Index(code, "."); dot >= 0 {
+		for fraction := code[dot+1:]; fraction != ""; {
+			fraction = fraction[:len(fraction)-1]
+			if fraction == "" {
+				ancestors = append(ancestors, code[:dot])
+			} else {
+				ancestors = append(ancestors, code[:dot]+"."+fraction)
+			}
+		}
+		whole = code[:dot]
+	}
+	if whole[2] != '0' {
+		ancestors = append(ancestors, whole[:2]+"0")
+	}
+	if whole[1] != '0' {
+		ancestors = append(ancestors, whole[:1]+"00")
+	}
+	return class{Entry: Entry{Code: code, Name: name}, key: code, ancestors: ancestors}, nil
+}
+
+func parseBisac(code string, heading string) (class, error) {
+	if !bisacCode.MatchString(code) {
+		return class{}, errors.New(code + " is not a BISAC code such as FIC009020")
+	}
+
+	var path []string
+	for _, part := range strings.Split(heading, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			path = append(path, part)
+		}
+	}
+	if len(path) > 1 && strings.EqualFold(path[len(path)-1], "General") {
+		path = path[:len(path)-1]
+	}
+	if len(path) == 0 {
+		return class{}, errors.New("expected a heading after " + code)
+	}
+
+	var ancestors []string
+	for i := len(path) - 1; i > 0; i-- {
+		ancestors = append(ancestors, headingKey(path[:i]))
+	}
+	return class{Entry: Entry{Code: code, Name: path[len(path)-1]}, key: headingKey(path), ancestors: ancestors}, nil
+}
+
+func headingKey(path []string) string {
+	return strings.ToLower(strings.Join(path, "/"))
+}
+
+// CallNumber returns the call number shelving a book with the subject codes and author:
+// its most specific Dewey number followed by the first three letters of the surname of its
+// first author, "823.914 TOL". Either part is left out when the book lacks it.
+func CallNumber(codes []string, author string) string {
+	number := ""
+	for _, code := range codes {
+		if deweyCode.MatchString(code) && len(code) > len(number) {
+			number = code
+		}
+	}
+
+	// Authors are written "First Last" or "Last, First", several joined by & or a semicolon.
+	first := strings.FieldsFunc(author, func(r rune) bool { return r == '&' || r == ';' })
+	surname := ""
+	if len(first) > 0 {
+		name := strings.TrimSpace(first[0])
+		if comma := strings.Index(name, ","); comma >= 0 {
+			surname = name[:comma]
+		} else if words := strings.Fields(name); len(words) > 0 {
+			surname = words[len(words)-1]
+		}
+	}
+	var cutter []rune
+	for _, r := range strings.ToUpper(surname) {
+		if len(cutter) < 3 && unicode.IsLetter(r) {
+			cutter = append(cutter, r)
+		}
+	}
+
+	return strings.TrimSpace(number + " " + string(cutter))
+}
@@ -0,0 +1,107 @@
+package classification
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name    string
+		format  string
+		file    string
+		entries []Entry
+	}{
+		{
+			name:   "should file Dewey numbers under the numbers they extend",
+			format: FormatDewey,
+			file:   "# Literature\n823.914 Late 20th century\n800 Literature\n\n820\tEnglish literature\n823 English fiction\n",
+			entries: []Entry{
+				{Code: "800", Name: "Literature"},
+				{Code: "820", Name: "English literature", Parent: "800"},
+				{Code: "823", Name: "English fiction", Parent: "820"},
+				{Code: "823.914", Name: "Late 20th century", Parent: "823"},
+			},
+		},
+		{
+			name:   "should file Dewey numbers under the nearest number listed",
+			format: FormatDewey,
+			file:   "500 Science\n516.35 Algebraic geometry\n",
+			entries: []Entry{
+				{Code: "500", Name: "Science"},
+				{Code: "516.35", Name: "Algebraic geometry", Parent: "500"},
+			},
+		},
+		{
+			name:   "should file BISAC headings under the headings they extend",
+			format: FormatBisac,
+			file:   "FIC009020 FICTION / Fantasy / Epic\nFIC000000 FICTION / General\nFIC009000 FICTION / Fantasy / General\nJUV037000 JUVENILE FICTION / Fantasy & Magic\n",
+			entries: []Entry{
+				{Code: "FIC000000", Name: "FICTION"},
+				{Code: "JUV037000", Name: "Fantasy & Magic"},
+				{Code: "FIC009000", Name: "Fantasy", Parent: "FIC000000"},
+				{Code: "FIC009020", Name: "Epic", Parent: "FIC009000"},
+			},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			entries, err := Read(strings.NewReader(scenario.file), scenario.format)
+			if err != nil || len(entries) != len(scenario.entries) {
+				t.Fatalf("Expected %v, got %v, %v", scenario.entries, entries, err)
+			}
+			for i, entry := range scenario.entries {
+				if entries[i] != entry {
+					t.Errorf("Expected %v, got %v", entry, entries[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadRejectsMalformedFiles(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name   string
+		format string
+		file   string
+		err    string
+	}{
+		{name: "should reject unknown formats", format: "udc", file: "", err: "unknown classification format: udc, expected dewey or bisac"},
+		{name: "should require a name", format: FormatDewey, file: "800 Literature\n820\n", err: "line 2: expected a code followed by a name"},
+		{name: "should reject codes of the other format", format: FormatDewey, file: "FIC000000 FICTION / General", err: "line 1: FIC000000 is not a Dewey number such as 823 or 823.914"},
+		{name: "should reject repeated headings", format: FormatBisac, file: "FIC000000 FICTION / General\nFIC999999 Fiction", err: "line 2: FIC999999 repeats the class of line 1"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(scenario.file), scenario.format); err == nil || err.Error() != scenario.err {
+				t.Errorf("Expected %v, got %v", scenario.err, err)
+			}
+		})
+	}
+}
+
+func TestCallNumber(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		codes    []string
+		author   string
+		expected string
+	}{
+		{[]string{"800", "823.914", "823", "FIC009020"}, "J. R. R. Tolkien", "823.914 TOL"},
+		{[]string{"005.133"}, "Donovan, Alan & Brian Kernighan", "005.133 DON"},
+		{[]string{"FIC009020"}, "Ursula K. Le Guin", "GUI"},
+		{nil, "O'Brian; Patrick", "OBR"},
+		{[]string{"516.35"}, "", "516.35"},
+		{nil, "", ""},
+	}
+
+	for _, scenario := range scenarios {
+		if got := CallNumber(scenario.codes, scenario.author); got != scenario.expected {
+			t.Errorf("Expected %q for %v by %q, got %q", scenario.expected, scenario.codes, scenario.author, got)
+		}
+	}
+}
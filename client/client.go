@@ -0,0 +1,283 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-rest-webservices-book-library/domain"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetries     = 2
+	defaultBackoff     = 100 * time.Millisecond
+	defaultMaxBackoff  = 2 * time.Second
+	defaultPageSize    = 50
+	contentTypeHeader  = "Content-Type"
+	authorizationValue = "Bearer "
+	jsonContentType    = "application/json"
+)
+
+// AuthFunc decorates every outgoing request with credentials.
+type AuthFunc func(r *http.Request) error
+
+type Option func(c *Client)
+
+// Client is a typed client for the book library API. It is safe for concurrent use.
+type Client struct {
+	baseUrl    string
+	httpClient *http.Client
+	auth       AuthFunc
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// Error is returned for every non successful response, decoded from the API error body
+// when the server sent one.
+type Error struct {
+	StatusCode int
+	Message    string
+	Violations []domain.Violation
+}
+
+func (e *Error) Error() string {
+	message := strconv.Itoa(e.StatusCode) + " " + e.Message
+	for _, violation := range e.Violations {
+		message += "; " + violation.Field + ": " + violation.Message
+	}
+	return message
+}
+
+// IsNotFound reports whether err is an API error with status 404.
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+func New(baseUrl string, options ...Option) *Client {
+	c := &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		httpClient: http.DefaultClient,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times idempotent calls are retried, waiting backoff before
+// the first retry and doubling it for every following one up to maxBackoff.
+func WithRetries(retries int, backoff time.Duration, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+func WithAuth(auth AuthFunc) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// BearerToken authenticates requests with a static bearer token.
+func BearerToken(token string) AuthFunc {
+	return func(r *http.Request) error {
+		r.Header.Set("Authorization", authorizationValue+token)
+		return nil
+	}
+}
+
+func (c *Client) ListBooks(ctx context.Context) ([]domain.Book, error) {
+	var books []domain.Book
+	err := c.do(ctx, "GET", "/books", nil, &books)
+	return books, err
+}
+
+func (c *Client) ListBooksPage(ctx context.Context, limit int64, offset int64) ([]domain.Book, error) {
+	var books []domain.Book
+	path := "/books?limit=" + strconv.FormatInt(limit, 10) + "&offset=" + strconv.FormatInt(offset, 10)
+	err := c.do(ctx, "GET", path, nil, &books)
+	return books, err
+}
+
+func (c *Client) GetBook(ctx context.Context, id int64) (domain.Book, error) {
+	var book domain.Book
+	err := c.do(ctx, "GET", bookPath(id), nil, &book)
+	return book, err
+}
+
+func (c *Client) AddBook(ctx context.Context, book domain.Book) (domain.Book, error) {
+	var created domain.Book
+	err := c.do(ctx, "POST", "/book", bookBody(book), &created)
+	return created, err
+}
+
+func (c *Client) UpdateBook(ctx context.Context, id int64, book domain.Book) (domain.Book, error) {
+	var updated domain.Book
+	err := c.do(ctx, "PUT", bookPath(id), bookBody(book), &updated)
+	return updated, err
+}
+
+func (c *Client) DeleteBook(ctx context.Context, id int64) error {
+	return c.do(ctx, "DELETE", bookPath(id), nil, nil)
+}
+
+// ListMembersPage lists the members whose name contains name, all of them when empty.
+func (c *Client) ListMembersPage(ctx context.Context, name string, limit int64, offset int64) ([]domain.Member, error) {
+	var members []domain.Member
+	path := "/members?name=" + url.QueryEscape(name) +
+		"&limit=" + strconv.FormatInt(limit, 10) + "&offset=" + strconv.FormatInt(offset, 10)
+	err := c.do(ctx, "GET", path, nil, &members)
+	return members, err
+}
+
+func (c *Client) GetMember(ctx context.Context, id int64) (domain.Member, error) {
+	var member domain.Member
+	err := c.do(ctx, "GET", "/members/"+strconv.FormatInt(id, 10), nil, &member)
+	return member, err
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+
+	attempts := 1
+	if isIdempotent(method) {
+		attempts += c.retries
+	}
+
+	wait := c.backoff
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if sleepErr := sleep(ctx, wait); sleepErr != nil {
+				return sleepErr
+			}
+			wait *= 2
+			if wait > c.maxBackoff {
+				wait = c.maxBackoff
+			}
+		}
+
+		var retry bool
+		retry, err = c.attempt(ctx, method, path, payload, result)
+		if !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (c *Client) attempt(ctx context.Context, method string, path string, payload []byte, result interface{}) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	r, err := http.NewRequest(method, c.baseUrl+path, body)
+	if err != nil {
+		return false, err
+	}
+	r = r.WithContext(ctx)
+	if payload != nil {
+		r.Header.Set(contentTypeHeader, jsonContentType)
+	}
+	if c.auth != nil {
+		if authErr := c.auth(r); authErr != nil {
+			return false, authErr
+		}
+	}
+
+	response, err := c.httpClient.Do(r)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return true, err
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return isRetryable(response.StatusCode), decodeError(response.StatusCode, data)
+	}
+	if result != nil && len(data) > 0 {
+		return false, json.Unmarshal(data, result)
+	}
+	return false, nil
+}
+
+func decodeError(statusCode int, data []byte) *Error {
+	apiErr := &Error{StatusCode: statusCode, Message: http.StatusText(statusCode)}
+
+	var body domain.ApiError
+	if json.Unmarshal(data, &body) == nil {
+		if body.Message != "" {
+			apiErr.Message = body.Message
+		}
+		apiErr.Violations = body.Violations
+	}
+	return apiErr
+}
+
+func sleep(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isIdempotent(method string) bool {
+	return method == "GET" || method == "PUT" || method == "DELETE"
+}
+
+func isRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
+
+func bookPath(id int64) string {
+	return "/book/" + strconv.FormatInt(id, 10)
+}
+
+// bookBody strips the server owned id, which the API refuses in request bodies, and keeps
+// every other field, as updates replace the whole book.
+func bookBody(book domain.Book) interface{} {
+	return struct {
+		Name      string
+		Author    string
+		Isbn      string `json:",omitempty"`
+		Publisher string `json:",omitempty"`
+		Year      int    `json:",omitempty"`
+		Pages     int    `json:",omitempty"`
+	}{book.Name, book.Author, book.Isbn, book.Publisher, book.Year, book.Pages}
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/router"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type scenario struct {
+	name     string
+	failures int32
+	method   string
+	calls    int32
+	err      bool
+}
+
+// newStaffClient returns a client of the server at url sending the staff token, which it
+// configures until the test is over.
+func newStaffClient(t *testing.T, url string) *Client {
+	previous := config.StaffToken
+	config.StaffToken = "client-staff"
+	t.Cleanup(func() { config.StaffToken = previous })
+	return New(url, WithAuth(BearerToken("client-staff")))
+}
+
+func TestClientAgainstRouter(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+
+	ctx := context.Background()
+	c := newStaffClient(t, server.URL)
+
+	created, err := c.AddBook(ctx, domain.Book{Name: "Book", Author: "Author"})
+	if err != nil || created.Id == 0 {
+		t.Fatalf("Expected book to be created, got %v, %v", created, err)
+	}
+
+	got, err := c.GetBook(ctx, created.Id)
+	if err != nil || got != created {
+		t.Errorf("Expected %v, got %v, %v", created, got, err)
+	}
+
+	updated, err := c.UpdateBook(ctx, created.Id, domain.Book{Name: "Book2", Author: "Author2"})
+	if err != nil || updated.Name != "Book2" || updated.Id != created.Id {
+		t.Errorf("Expected updated book, got %v, %v", updated, err)
+	}
+
+	books, err := c.ListBooks(ctx)
+	if err != nil || len(books) == 0 {
+		t.Errorf("Expected books, got %v, %v", books, err)
+	}
+
+	if err = c.DeleteBook(ctx, created.Id); err != nil {
+		t.Errorf("Expected delete to succeed, got %v", err)
+	}
+
+	_, err = c.GetBook(ctx, created.Id)
+	if !IsNotFound(err) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestClientKeepsEveryBookField(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+
+	ctx := context.Background()
+	c := newStaffClient(t, server.URL)
+
+	book := domain.Book{Name: "A Wizard of Earthsea", Author: "Ursula K. Le Guin", Isbn: "9780547773742",
+		Publisher: "Parnassus", Year: 1968, Pages: 205}
+	created, err := c.AddBook(ctx, book)
+	book.Id = created.Id
+	if err != nil || created != book {
+		t.Fatalf("Expected %+v to be created, got %+v, %v", book, created, err)
+	}
+
+	book = domain.Book{Id: created.Id, Name: "The Tombs of Atuan", Author: "Ursula K. Le Guin", Isbn: "9780689845369",
+		Publisher: "Atheneum", Year: 1971, Pages: 163}
+	if _, err = c.UpdateBook(ctx, book.Id, book); err != nil {
+		t.Fatalf("Expected the book to be updated, got %v", err)
+	}
+	if got, err := c.GetBook(ctx, book.Id); err != nil || got != book {
+		t.Errorf("Expected %+v, got %+v, %v", book, got, err)
+	}
+}
+
+func TestClientMembers(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+
+	ctx := context.Background()
+	c := newStaffClient(t, server.URL)
+	if _, err := New(server.URL).ListMembersPage(ctx, "", 10, 0); err == nil || err.(*Error).StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+
+	members, err := c.ListMembersPage(ctx, "Le Guin & co", 10, 0)
+	if err != nil || members == nil {
+		t.Errorf("Expected a list of members, got %v, %v", members, err)
+	}
+
+	_, err = c.GetMember(ctx, 0)
+	if !IsNotFound(err) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestClientDecodesValidationErrors(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+
+	_, err := newStaffClient(t, server.URL).AddBook(context.Background(), domain.Book{Name: "Book"})
+
+	apiErr, ok := err.(*Error)
+	if !ok || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422 error, got %v", err)
+	}
+	if len(apiErr.Violations) != 1 || apiErr.Violations[0].Field != "Author" {
+		t.Errorf("Expected violation for Author, got %v", apiErr.Violations)
+	}
+}
+
+func TestBookIterator(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+
+	ctx := context.Background()
+	c := newStaffClient(t, server.URL)
+
+	added := map[int64]bool{}
+	for i := 0; i < 5; i++ {
+		book, err := c.AddBook(ctx, domain.Book{Name: "Paged", Author: "Author"})
+		if err != nil {
+			t.Fatalf("Expected book to be created, got %v", err)
+		}
+		added[book.Id] = true
+	}
+
+	books := c.Books(ctx, 2)
+	for books.Next() {
+		delete(added, books.Book().Id)
+	}
+
+	if books.Err() != nil || len(added) != 0 {
+		t.Errorf("Expected to iterate over every book, missed %v, err %v", added, books.Err())
+	}
+	for id := range added {
+		_ = c.DeleteBook(ctx, id)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	scenarios := []scenario{
+		{
+			name:     "should retry idempotent calls until success",
+			failures: 2,
+			method:   "GET",
+			calls:    3,
+		},
+		{
+			name:     "should give up after configured retries",
+			failures: 5,
+			method:   "DELETE",
+			calls:    3,
+			err:      true,
+		},
+		{
+			name:     "should not retry non idempotent calls",
+			failures: 1,
+			method:   "POST",
+			calls:    1,
+			err:      true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= scenario.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = w.Write([]byte(`{"Id":1,"Name":"Book","Author":"Author"}`))
+			}))
+			defer server.Close()
+
+			c := New(server.URL, WithRetries(2, time.Millisecond, 5*time.Millisecond))
+			var err error
+			switch scenario.method {
+			case "GET":
+				_, err = c.GetBook(context.Background(), 1)
+			case "DELETE":
+				err = c.DeleteBook(context.Background(), 1)
+			case "POST":
+				_, err = c.AddBook(context.Background(), domain.Book{Name: "Book", Author: "Author"})
+			}
+
+			if calls != scenario.calls || (err != nil) != scenario.err {
+				t.Errorf("Expected %v calls and error %v, got %v calls and %v", scenario.calls, scenario.err, calls, err)
+			}
+		})
+	}
+}
+
+func TestAuthAndContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	if _, err := New(server.URL).ListBooks(context.Background()); err == nil {
+		t.Errorf("Expected unauthorized error without credentials")
+	}
+	if _, err := New(server.URL, WithAuth(BearerToken("secret"))).ListBooks(context.Background()); err != nil {
+		t.Errorf("Expected success with credentials, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New(server.URL).ListBooks(ctx); err == nil {
+		t.Errorf("Expected error for cancelled context")
+	}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"go-rest-webservices-book-library/domain"
+)
+
+// BookIterator walks through every book page by page. Use it as
+//
+//	books := c.Books(ctx, 100)
+//	for books.Next() {
+//		book := books.Book()
+//	}
+//	if err := books.Err(); err != nil {
+//	}
+type BookIterator struct {
+	ctx      context.Context
+	client   *Client
+	pageSize int64
+	offset   int64
+	page     []domain.Book
+	index    int
+	done     bool
+	err      error
+}
+
+// Books returns an iterator over all books, fetching pageSize books per request.
+func (c *Client) Books(ctx context.Context, pageSize int64) *BookIterator {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	return &BookIterator{ctx: ctx, client: c, pageSize: pageSize, index: -1}
+}
+
+func (b *BookIterator) Next() bool {
+	if b.err != nil {
+		return false
+	}
+
+	b.index++
+	if b.index < len(b.page) {
+		return true
+	}
+	if b.done {
+		return false
+	}
+
+	b.page, b.err = b.client.ListBooksPage(b.ctx, b.pageSize, b.offset)
+	b.offset += int64(len(b.page))
+	b.index = 0
+	b.done = int64(len(b.page)) < b.pageSize
+
+	return b.err == nil && len(b.page) > 0
+}
+
+func (b *BookIterator) Book() domain.Book {
+	return b.page[b.index]
+}
+
+func (b *BookIterator) Err() error {
+	return b.err
+}
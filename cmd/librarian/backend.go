@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go-rest-webservices-book-library/client"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/repository"
+	"go-rest-webservices-book-library/validation"
+	"strconv"
+)
+
+var (
+	errNotFound       = errors.New("book not found")
+	errMemberNotFound = errors.New("member not found")
+)
+
+// membersPageSize is how many members listMembers fetches at a time.
+const membersPageSize = 100
+
+// backend lets every command run either against the local books.sql or a remote server.
+type backend interface {
+	listBooks() ([]domain.Book, error)
+	getBook(id int64) (domain.Book, error)
+	addBook(book domain.Book) (domain.Book, error)
+	updateBook(id int64, book domain.Book) (domain.Book, error)
+	deleteBook(id int64) error
+	listMembers(name string) ([]domain.Member, error)
+	getMember(id int64) (domain.Member, error)
+}
+
+type localBackend struct{}
+
+type remoteBackend struct {
+	client *client.Client
+}
+
+func newBackend(remote string, token string) backend {
+	if remote == "" {
+		return localBackend{}
+	}
+
+	var options []client.Option
+	if token != "" {
+		options = append(options, client.WithAuth(client.BearerToken(token)))
+	}
+	return remoteBackend{client: client.New(remote, options...)}
+}
+
+func (l localBackend) listBooks() ([]domain.Book, error) {
+	return repository.GetAllBooks()
+}
+
+func (l localBackend) getBook(id int64) (domain.Book, error) {
+	books, err := repository.GetBook(strconv.FormatInt(id, 10))
+	if err == nil && len(books) == 0 {
+		err = errNotFound
+	}
+	if err != nil {
+		return domain.Book{}, err
+	}
+	return books[0], nil
+}
+
+func (l localBackend) addBook(book domain.Book) (domain.Book, error) {
+	if fieldErrors := validation.Validate(book); fieldErrors != nil {
+		return book, fieldErrors
+	}
+
+	id, err := repository.AddBook(book)
+	book.Id = id
+	return book, err
+}
+
+func (l localBackend) updateBook(id int64, book domain.Book) (domain.Book, error) {
+	if fieldErrors := validation.Validate(book); fieldErrors != nil {
+		return book, fieldErrors
+	}
+	if _, err := l.getBook(id); err != nil {
+		return book, err
+	}
+
+	book.Id = id
+	return book, repository.UpdateBook(book, strconv.FormatInt(id, 10))
+}
+
+func (l localBackend) deleteBook(id int64) error {
+	return repository.DeleteBook(strconv.FormatInt(id, 10))
+}
+
+func (l localBackend) listMembers(name string) ([]domain.Member, error) {
+	return pageMembers(func(offset int64) ([]domain.Member, error) {
+		return repository.GetMembers(name, membersPageSize, offset)
+	})
+}
+
+func (l localBackend) getMember(id int64) (domain.Member, error) {
+	members, err := repository.GetMembersByIds([]int64{id})
+	if err == nil && len(members) == 0 {
+		err = errMemberNotFound
+	}
+	if err != nil {
+		return domain.Member{}, err
+	}
+	return members[0], nil
+}
+
+func (r remoteBackend) listBooks() ([]domain.Book, error) {
+	var books []domain.Book
+	iterator := r.client.Books(context.Background(), 0)
+	for iterator.Next() {
+		books = append(books, iterator.Book())
+	}
+	return books, iterator.Err()
+}
+
+func (r remoteBackend) getBook(id int64) (domain.Book, error) {
+	book, err := r.client.GetBook(context.Background(), id)
+	if client.IsNotFound(err) {
+		err = errNotFound
+	}
+	return book, err
+}
+
+func (r remoteBackend) addBook(book domain.Book) (domain.Book, error) {
+	return r.client.AddBook(context.Background(), book)
+}
+
+func (r remoteBackend) updateBook(id int64, book domain.Book) (domain.Book, error) {
+	return r.client.UpdateBook(context.Background(), id, book)
+}
+
+func (r remoteBackend) deleteBook(id int64) error {
+	return r.client.DeleteBook(context.Background(), id)
+}
+
+func (r remoteBackend) listMembers(name string) ([]domain.Member, error) {
+	return pageMembers(func(offset int64) ([]domain.Member, error) {
+		return r.client.ListMembersPage(context.Background(), name, membersPageSize, offset)
+	})
+}
+
+func (r remoteBackend) getMember(id int64) (domain.Member, error) {
+	member, err := r.client.GetMember(context.Background(), id)
+	if client.IsNotFound(err) {
+		err = errMemberNotFound
+	}
+	return member, err
+}
+
+// pageMembers gathers the members of every page, until one comes back short.
+func pageMembers(page func(offset int64) ([]domain.Member, error)) ([]domain.Member, error) {
+	var members []domain.Member
+	for offset := int64(0); ; offset += membersPageSize {
+		next, err := page(offset)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, next...)
+		if int64(len(next)) < membersPageSize {
+			return members, nil
+		}
+	}
+}
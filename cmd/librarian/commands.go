@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go-rest-webservices-book-library/classification"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/repository"
+	"io"
+	"os"
+	"strconv"
+)
+
+var errLocalOnly = errors.New("this command only works on the local database, drop -remote")
+
+func (c command) books(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: librarian books list|get|add|update|delete")
+	}
+
+	switch args[0] {
+	case "list":
+		books, err := c.backend.listBooks()
+		if err != nil {
+			return err
+		}
+		return writeBooks(c.stdout, c.output, books)
+	case "get":
+		id, err := idArgument(args[1:])
+		if err != nil {
+			return err
+		}
+		book, err := c.backend.getBook(id)
+		if err != nil {
+			return err
+		}
+		return writeBooks(c.stdout, c.output, []domain.Book{book})
+	case "add":
+		book, err := bookArguments("add", args[1:], domain.Book{})
+		if err != nil {
+			return err
+		}
+		book, err = c.backend.addBook(book)
+		if err != nil {
+			return err
+		}
+		return writeBooks(c.stdout, c.output, []domain.Book{book})
+	case "update":
+		if len(args) < 2 {
+			return errors.New("expected a book id")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		// Updates replace the whole book, so the flags left out keep their stored values.
+		book, err := c.backend.getBook(id)
+		if err != nil {
+			return err
+		}
+		book, err = bookArguments("update", args[2:], book)
+		if err != nil {
+			return err
+		}
+		book, err = c.backend.updateBook(id, book)
+		if err != nil {
+			return err
+		}
+		return writeBooks(c.stdout, c.output, []domain.Book{book})
+	case "delete":
+		id, err := idArgument(args[1:])
+		if err != nil {
+			return err
+		}
+		return c.backend.deleteBook(id)
+	}
+	return errors.New("unknown books command: " + args[0])
+}
+
+func (c command) importBooks(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", jsonOutput, "file format: json or csv")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: librarian import [-format json|csv] <file>")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	books, err := readBooks(file, *format)
+	if err != nil {
+		return err
+	}
+
+	var imported []domain.Book
+	for i, book := range books {
+		added, addErr := c.backend.addBook(book)
+		if addErr != nil {
+			return errors.New("book " + strconv.Itoa(i+1) + " (" + book.Name + "): " + addErr.Error())
+		}
+		imported = append(imported, added)
+	}
+	return writeBooks(c.stdout, c.output, imported)
+}
+
+// subjects seeds the subject tree of the local database from a classification file.
+func (c command) subjects(args []string) error {
+	if len(args) == 0 || args[0] != "import" {
+		return errors.New("usage: librarian subjects import [-format dewey|bisac] <file>")
+	}
+	if c.remote {
+		return errLocalOnly
+	}
+	flags := flag.NewFlagSet("subjects import", flag.ContinueOnError)
+	format := flags.String("format", classification.FormatDewey, "classification format: dewey or bisac")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: librarian subjects import [-format dewey|bisac] <file>")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := classification.Read(file, *format)
+	if err != nil {
+		return err
+	}
+	imported, err := repository.ImportSubjects(entries)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(c.stdout, "added "+strconv.Itoa(imported.Added)+" subjects, updated "+strconv.Itoa(imported.Updated))
+	return nil
+}
+
+func (c command) exportBooks(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", jsonOutput, "file format: json or csv")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	books, err := c.backend.listBooks()
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = c.stdout
+	if flags.NArg() == 1 {
+		file, createErr := os.Create(flags.Arg(0))
+		if createErr != nil {
+			return createErr
+		}
+		defer file.Close()
+		out = file
+	}
+	return writeBooks(out, *format, books)
+}
+
+func (c command) migrate() error {
+	if c.remote {
+		return errLocalOnly
+	}
+
+	versions, err := repository.Migrate()
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		_, _ = fmt.Fprintln(c.stdout, "database is up to date")
+	}
+	for _, version := range versions {
+		_, _ = fmt.Fprintln(c.stdout, "applied migration "+strconv.Itoa(version))
+	}
+	return nil
+}
+
+func (c command) backup(args []string) error {
+	if c.remote {
+		return errLocalOnly
+	}
+	if len(args) != 1 {
+		return errors.New("usage: librarian backup <file>")
+	}
+	return repository.Backup(args[0])
+}
+
+func (c command) members(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: librarian members list|get")
+	}
+
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("members list", flag.ContinueOnError)
+		name := flags.String("name", "", "part of the member name")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		members, err := c.backend.listMembers(*name)
+		if err != nil {
+			return err
+		}
+		return writeMembers(c.stdout, c.output, members)
+	case "get":
+		if len(args) != 2 {
+			return errors.New("expected a single member id")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		member, err := c.backend.getMember(id)
+		if err != nil {
+			return err
+		}
+		return writeMembers(c.stdout, c.output, []domain.Member{member})
+	}
+	return errors.New("unknown members command: " + args[0])
+}
+
+func idArgument(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected a single book id")
+	}
+	return strconv.ParseInt(args[0], 10, 64)
+}
+
+// bookArguments parses a flag for every field of a book but its id, defaulting to the
+// fields of book.
+func bookArguments(name string, args []string, book domain.Book) (domain.Book, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&book.Name, "name", book.Name, "name of the book")
+	flags.StringVar(&book.Author, "author", book.Author, "author of the book")
+	flags.StringVar(&book.Isbn, "isbn", book.Isbn, "ISBN-10 or ISBN-13 of the book")
+	flags.StringVar(&book.Publisher, "publisher", book.Publisher, "publisher of the book")
+	flags.IntVar(&book.Year, "year", book.Year, "year the book was published")
+	flags.IntVar(&book.Pages, "pages", book.Pages, "number of pages of the book")
+	err := flags.Parse(args)
+
+	return book, err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"go-rest-webservices-book-library/domain"
+	"testing"
+)
+
+// memoryBackend keeps books in a map, members are not needed by these tests.
+type memoryBackend struct {
+	books map[int64]domain.Book
+}
+
+func (m memoryBackend) listBooks() ([]domain.Book, error) {
+	var books []domain.Book
+	for _, book := range m.books {
+		books = append(books, book)
+	}
+	return books, nil
+}
+
+func (m memoryBackend) getBook(id int64) (domain.Book, error) {
+	book, found := m.books[id]
+	if !found {
+		return book, errNotFound
+	}
+	return book, nil
+}
+
+func (m memoryBackend) addBook(book domain.Book) (domain.Book, error) {
+	book.Id = int64(len(m.books) + 1)
+	m.books[book.Id] = book
+	return book, nil
+}
+
+func (m memoryBackend) updateBook(id int64, book domain.Book) (domain.Book, error) {
+	book.Id = id
+	m.books[id] = book
+	return book, nil
+}
+
+func (m memoryBackend) deleteBook(id int64) error {
+	delete(m.books, id)
+	return nil
+}
+
+func (m memoryBackend) listMembers(name string) ([]domain.Member, error) {
+	return nil, nil
+}
+
+func (m memoryBackend) getMember(id int64) (domain.Member, error) {
+	return domain.Member{}, errMemberNotFound
+}
+
+func TestBooksUpdateKeepsFieldsLeftOut(t *testing.T) {
+	stored := domain.Book{Id: 1, Name: "Tehanu", Author: "Ursula K. Le Guin", Isbn: "9780689315954"}
+	backend := memoryBackend{books: map[int64]domain.Book{1: stored}}
+	c := command{backend: backend, output: jsonOutput, stdout: &bytes.Buffer{}}
+
+	if err := c.run([]string{"books", "update", "1", "-name", "Tehanu: The Last Book of Earthsea"}); err != nil {
+		t.Fatalf("Expected the book to be updated, got %v", err)
+	}
+
+	expected := stored
+	expected.Name = "Tehanu: The Last Book of Earthsea"
+	if updated := backend.books[1]; updated != expected {
+		t.Errorf("Expected %+v, got %+v", expected, updated)
+	}
+}
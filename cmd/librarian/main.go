@@ -0,0 +1,86 @@
+// Command librarian administers the book library, either directly on the local
+// books.sql database or remotely through the HTTP API.
+//
+//	librarian [-remote URL] [-token TOKEN] [-output table|json|csv] <command> [arguments]
+//
+// Commands:
+//
+//	books list
+//	books get <id>
+//	books add -name NAME -author AUTHOR [-isbn ISBN] [-publisher PUBLISHER] [-year YEAR] [-pages PAGES]
+//	books update <id> [-name NAME] [-author AUTHOR] [-isbn ISBN] [-publisher PUBLISHER] [-year YEAR] [-pages PAGES]
+//	books delete <id>
+//	import [-format json|csv] <file>
+//	subjects import [-format dewey|bisac] <file>
+//	export [-format json|csv] [file]
+//	migrate
+//	backup <file>
+//	members list [-name NAME]
+//	members get <id>
+//
+// Defaults for the global flags are read from the librarian section of config.yml.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go-rest-webservices-book-library/config"
+	"io"
+	"os"
+)
+
+type command struct {
+	backend backend
+	remote  bool
+	output  string
+	stdout  io.Writer
+}
+
+func main() {
+	flags := flag.NewFlagSet("librarian", flag.ExitOnError)
+	remote := flags.String("remote", config.LibrarianRemote, "base url of a library server, the local database is used when empty")
+	token := flags.String("token", config.LibrarianToken, "bearer token for the remote server")
+	output := flags.String("output", config.LibrarianOutput, "output format: table, json or csv")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "usage: librarian [flags] books|import|subjects|export|migrate|backup|members [arguments]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	c := command{
+		backend: newBackend(*remote, *token),
+		remote:  *remote != "",
+		output:  *output,
+		stdout:  os.Stdout,
+	}
+	if err := c.run(flags.Args()); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "librarian: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+func (c command) run(args []string) error {
+	switch args[0] {
+	case "books":
+		return c.books(args[1:])
+	case "import":
+		return c.importBooks(args[1:])
+	case "subjects":
+		return c.subjects(args[1:])
+	case "export":
+		return c.exportBooks(args[1:])
+	case "migrate":
+		return c.migrate()
+	case "backup":
+		return c.backup(args[1:])
+	case "members":
+		return c.members(args[1:])
+	}
+	return errors.New("unknown command: " + args[0])
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-rest-webservices-book-library/domain"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	tableOutput = "table"
+	jsonOutput  = "json"
+	csvOutput   = "csv"
+)
+
+var (
+	bookHeader   = []string{"Id", "Name", "Author", "Isbn", "Publisher", "Year", "Pages"}
+	memberHeader = []string{"Id", "Name", "Email"}
+)
+
+func writeBooks(w io.Writer, format string, books []domain.Book) error {
+	if books == nil {
+		books = []domain.Book{}
+	}
+	records := make([][]string, len(books))
+	for i, book := range books {
+		records[i] = bookRecord(book)
+	}
+	return writeRecords(w, format, bookHeader, records, books)
+}
+
+func writeMembers(w io.Writer, format string, members []domain.Member) error {
+	if members == nil {
+		members = []domain.Member{}
+	}
+	records := make([][]string, len(members))
+	for i, member := range members {
+		records[i] = []string{strconv.FormatInt(member.Id, 10), member.Name, member.Email}
+	}
+	return writeRecords(w, format, memberHeader, records, members)
+}
+
+// writeRecords writes the records under header as a table or csv, or value as json.
+func writeRecords(w io.Writer, format string, header []string, records [][]string, value interface{}) error {
+	switch format {
+	case tableOutput:
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(table, strings.Join(header, "\t"))
+		for _, record := range records {
+			_, _ = fmt.Fprintln(table, strings.Join(record, "\t"))
+		}
+		return table.Flush()
+	case jsonOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case csvOutput:
+		writer := csv.NewWriter(w)
+		_ = writer.Write(header)
+		for _, record := range records {
+			_ = writer.Write(record)
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return errors.New("unknown output format: " + format)
+}
+
+// readBooks parses books exported with writeBooks in json or csv format. Ids are ignored,
+// imported books always get new ids.
+func readBooks(r io.Reader, format string) ([]domain.Book, error) {
+	var books []domain.Book
+
+	switch format {
+	case jsonOutput:
+		err := json.NewDecoder(r).Decode(&books)
+		return books, err
+	case csvOutput:
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil || len(records) == 0 {
+			return nil, err
+		}
+
+		columns := map[string]int{}
+		for i, name := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		if _, hasName := columns["name"]; !hasName {
+			return nil, errors.New("csv header must contain Name and Author columns")
+		}
+		if _, hasAuthor := columns["author"]; !hasAuthor {
+			return nil, errors.New("csv header must contain Name and Author columns")
+		}
+
+		for i, record := range records[1:] {
+			// Columns other than Name and Author are optional, for files of older exports.
+			field := func(name string) string {
+				if column, found := columns[name]; found {
+					return record[column]
+				}
+				return ""
+			}
+			book := domain.Book{Name: field("name"), Author: field("author"), Isbn: field("isbn"), Publisher: field("publisher")}
+			if book.Year, err = optionalInt(field("year")); err == nil {
+				book.Pages, err = optionalInt(field("pages"))
+			}
+			if err != nil {
+				return nil, errors.New("csv line " + strconv.Itoa(i+2) + ": " + err.Error())
+			}
+			books = append(books, book)
+		}
+		return books, nil
+	}
+	return nil, errors.New("unknown import format: " + format)
+}
+
+func bookRecord(book domain.Book) []string {
+	return []string{strconv.FormatInt(book.Id, 10), book.Name, book.Author, book.Isbn, book.Publisher,
+		formatOptionalInt(book.Year), formatOptionalInt(book.Pages)}
+}
+
+// formatOptionalInt leaves the numbers a book does not have, which are zero, empty.
+func formatOptionalInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+func optionalInt(value string) (int, error) {
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(strings.TrimSpace(value))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"go-rest-webservices-book-library/domain"
+	"strings"
+	"testing"
+)
+
+type scenario struct {
+	name     string
+	format   string
+	data     string
+	expected string
+	books    []domain.Book
+	err      bool
+}
+
+func TestWriteBooks(t *testing.T) {
+	books := []domain.Book{{Id: 1, Name: "Book, The", Author: "Author", Isbn: "9780547773742", Publisher: "Parnassus", Year: 1968, Pages: 205}}
+	scenarios := []scenario{
+		{
+			name:     "should write table",
+			format:   "table",
+			expected: "Id  Name       Author  Isbn           Publisher  Year  Pages\n1   Book, The  Author  9780547773742  Parnassus  1968  205\n",
+		},
+		{
+			name:     "should write quoted csv",
+			format:   "csv",
+			expected: "Id,Name,Author,Isbn,Publisher,Year,Pages\n1,\"Book, The\",Author,9780547773742,Parnassus,1968,205\n",
+		},
+		{
+			name:   "should write json",
+			format: "json",
+			expected: "[\n  {\n    \"Id\": 1,\n    \"Name\": \"Book, The\",\n    \"Author\": \"Author\",\n    \"Isbn\": \"9780547773742\",\n" +
+				"    \"Publisher\": \"Parnassus\",\n    \"Year\": 1968,\n    \"Pages\": 205\n  }\n]\n",
+		},
+		{
+			name:   "should reject unknown format",
+			format: "xml",
+			err:    true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := writeBooks(&out, scenario.format, books)
+
+			if (err != nil) != scenario.err || out.String() != scenario.expected {
+				t.Errorf("Expected %q, got %q, %v", scenario.expected, out.String(), err)
+			}
+		})
+	}
+}
+
+func TestWriteMembers(t *testing.T) {
+	members := []domain.Member{{Id: 2, Name: "Tenar", Email: "tenar@atuan.example"}}
+	scenarios := []scenario{
+		{
+			name:     "should write table",
+			format:   "table",
+			expected: "Id  Name   Email\n2   Tenar  tenar@atuan.example\n",
+		},
+		{
+			name:     "should write csv",
+			format:   "csv",
+			expected: "Id,Name,Email\n2,Tenar,tenar@atuan.example\n",
+		},
+		{
+			name:     "should write json",
+			format:   "json",
+			expected: "[\n  {\n    \"Id\": 2,\n    \"Name\": \"Tenar\",\n    \"Email\": \"tenar@atuan.example\"\n  }\n]\n",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := writeMembers(&out, scenario.format, members)
+
+			if (err != nil) != scenario.err || out.String() != scenario.expected {
+				t.Errorf("Expected %q, got %q, %v", scenario.expected, out.String(), err)
+			}
+		})
+	}
+}
+
+func TestReadBooks(t *testing.T) {
+	scenarios := []scenario{
+		{
+			name:   "should read csv with columns in any order",
+			format: "csv",
+			data:   "author,Id,name\nAuthor,7,Book\n",
+			books:  []domain.Book{{Name: "Book", Author: "Author"}},
+		},
+		{
+			name:   "should read every column of an export",
+			format: "csv",
+			data:   "Id,Name,Author,Isbn,Publisher,Year,Pages\n1,\"Book, The\",Author,9780547773742,Parnassus,1968,205\n2,Other,Author,,,,\n",
+			books: []domain.Book{
+				{Name: "Book, The", Author: "Author", Isbn: "9780547773742", Publisher: "Parnassus", Year: 1968, Pages: 205},
+				{Name: "Other", Author: "Author"},
+			},
+		},
+		{
+			name:   "should reject csv with a year which is not a number",
+			format: "csv",
+			data:   "Name,Author,Year\nBook,Author,late\n",
+			err:    true,
+		},
+		{
+			name:   "should read json",
+			format: "json",
+			data:   `[{"Name":"Book","Author":"Author"}]`,
+			books:  []domain.Book{{Name: "Book", Author: "Author"}},
+		},
+		{
+			name:   "should reject csv without author column",
+			format: "csv",
+			data:   "Name\nBook\n",
+			err:    true,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			books, err := readBooks(strings.NewReader(scenario.data), scenario.format)
+
+			if (err != nil) != scenario.err || len(books) != len(scenario.books) {
+				t.Fatalf("Expected %v, got %v, %v", scenario.books, books, err)
+			}
+			for i, book := range scenario.books {
+				if books[i] != book {
+					t.Errorf("Expected %v, got %v", book, books[i])
+				}
+			}
+		})
+	}
+}
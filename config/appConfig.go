@@ -6,25 +6,268 @@ import (
 	"go.uber.org/zap/zapcore"
 	"log"
 	"os"
+	"time"
 )
 
 var (
 	ServerPort string
+	GrpcPort   string
 	LogFile    *os.File
 	AppLogger  *zap.Logger
+
+	// ShutdownTimeout is how long the server waits for requests and background jobs to
+	// finish once it is asked to stop.
+	ShutdownTimeout = defaultShutdownTimeout
+
+	CorsAllowedOrigins []string
+	CorsAllowedMethods []string
+	CorsAllowedHeaders []string
+	CorsExposedHeaders []string
+	CorsMaxAge         int
+	// CorsAllowCredentials lets browsers send cookies, such as the session, along with
+	// cross-origin requests. It takes origins listed one by one, not "*".
+	CorsAllowCredentials bool
+
+	StrictTransportSecurity string
+	ContentTypeOptions      string
+	ContentSecurityPolicy   string
+
+	MaxBodyBytes  int64 = defaultMaxBodyBytes
+	MaxTextLength       = defaultMaxTextLength
+
+	ValidateRequests bool
+	RedocIntegrity   string
+
+	ApiVersions map[string]ApiVersion
+
+	LibrarianRemote string
+	LibrarianToken  string
+	LibrarianOutput = defaultLibrarianOutput
+
+	WebhookMaxAttempts    = defaultWebhookMaxAttempts
+	WebhookInitialBackoff = defaultWebhookInitialBackoff
+	WebhookMaxBackoff     = defaultWebhookMaxBackoff
+	WebhookPollInterval   = defaultWebhookPollInterval
+	WebhookTimeout        = defaultWebhookTimeout
+
+	IdempotencyTtl = defaultIdempotencyTtl
+
+	BlobStore     = defaultBlobStore
+	BlobDirectory = defaultBlobDirectory
+	BlobS3        ObjectStore
+
+	CoverMaxBytes int64 = defaultCoverMaxBytes
+
+	AttachmentMaxBytes int64 = defaultAttachmentMaxBytes
+	DigitalLoanPeriod        = defaultDigitalLoanPeriod
+	DownloadLinkTtl          = defaultDownloadLinkTtl
+	DownloadSigningKey string
+
+	LookupProvider = defaultLookupProvider
+	LookupUrl      = defaultLookupUrl
+	LookupFile     = defaultLookupFile
+	LookupTimeout  = defaultLookupTimeout
+	LookupCacheTtl = defaultLookupCacheTtl
+
+	// LabelStock is the label stock labels are laid out for unless a request names another.
+	LabelStock = defaultLabelStock
+
+	// LoanPolicies holds the circulation rules of each item type. Copies of an item type
+	// without a policy follow that of DefaultItemType.
+	LoanPolicies = map[string]LoanPolicy{
+		defaultItemType: {LoanDays: 21, MaxRenewals: 2, GraceDays: 2, FinePerDay: 25, FineCap: 1000},
+	}
+	DefaultItemType = defaultItemType
+	HoldExpiry      = defaultHoldExpiry
+
+	// JobSchedules holds the cron schedule of each background job, jobs left without one
+	// only run when asked to through the API.
+	JobSchedules = map[string]string{
+		"overdue": "*/5 * * * *",
+		"holds":   "15 * * * *",
+		"purge":   "30 3 * * *",
+		"backup":  "0 2 * * *",
+		"notify":  "*/15 * * * *",
+	}
+	JobsEnabled     = true
+	JobLockTtl      = defaultJobLockTtl
+	JobHistory      = defaultJobHistory
+	BackupDirectory = defaultBackupDirectory
+	BackupKeep      = defaultBackupKeep
+
+	// NotificationSender sends the notifications of members by email through SmtpServer,
+	// or appends them to NotificationFile while developing when it is file. Templates in
+	// the NotificationTemplates directory replace the built-in ones of the same name.
+	NotificationSender    = defaultNotificationSender
+	NotificationFile      = defaultNotificationFile
+	NotificationTemplates string
+	NotificationFrom      = defaultNotificationFrom
+	NotificationDueSoon   = defaultNotificationDueSoon
+	SmtpServer            = MailServer{Port: defaultSmtpPort, Timeout: defaultSmtpTimeout}
+
+	// AccountUrl is the address of the site members follow the links in verification and
+	// password reset emails to, with the token in the query. Sessions last SessionTtl and
+	// are kept in the SessionCookie, which is only sent over HTTPS when SecureCookies is set.
+	AccountUrl      = defaultAccountUrl
+	SessionTtl      = defaultSessionTtl
+	VerificationTtl = defaultVerificationTtl
+	ResetTtl        = defaultResetTtl
+	SessionCookie   = defaultSessionCookie
+	SecureCookies   = true
+
+	// StaffToken is the bearer token librarians reach the accounts of every member with,
+	// and record payments with. No one has staff access while it is empty.
+	StaffToken string
 )
 
-const portColon = ":"
+// ApiVersion holds the lifecycle of an API version, dates are written as 2006-01-02 and
+// left empty while the version is supported.
+type ApiVersion struct {
+	Deprecation string
+	Sunset      string
+}
+
+// LoanPolicy holds the circulation rules of an item type: how many days a loan runs and
+// how often it can be renewed, and the fine per day a copy is returned late, unless it is
+// no more than GraceDays late. Fines are in the smallest unit of the currency, such as
+// cents, and a FineCap of 0 leaves them uncapped.
+type LoanPolicy struct {
+	LoanDays    int
+	MaxRenewals int
+	GraceDays   int
+	FinePerDay  int64
+	FineCap     int64
+}
+
+// MailServer is an SMTP server to send email through, STARTTLS is used when the server
+// offers it and the credentials are only sent over it, or to a server on localhost.
+type MailServer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// ObjectStore locates a bucket of an S3-compatible object store, the endpoint is the base
+// URL buckets are addressed below, as in https://s3.eu-west-1.amazonaws.com.
+type ObjectStore struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+const (
+	portColon            = ":"
+	defaultMaxBodyBytes  = 1 << 20
+	defaultMaxTextLength = 255
+
+	defaultShutdownTimeout = 30 * time.Second
+
+	defaultLibrarianOutput = "table"
+
+	defaultWebhookMaxAttempts    = 8
+	defaultWebhookInitialBackoff = 30 * time.Second
+	defaultWebhookMaxBackoff     = 6 * time.Hour
+	defaultWebhookPollInterval   = 5 * time.Second
+	defaultWebhookTimeout        = 10 * time.Second
+
+	defaultIdempotencyTtl = 24 * time.Hour
+
+	defaultBlobStore     = "local"
+	defaultBlobDirectory = "blobstore"
+	defaultCoverMaxBytes = 5 << 20
+
+	defaultAttachmentMaxBytes = 100 << 20
+	defaultDigitalLoanPeriod  = 14 * 24 * time.Hour
+	defaultDownloadLinkTtl    = 5 * time.Minute
+
+	defaultLookupProvider = "openlibrary"
+	defaultLookupUrl      = "https://openlibrary.org"
+	defaultLookupFile     = "isbn.json"
+	defaultLookupTimeout  = 10 * time.Second
+	defaultLookupCacheTtl = 30 * 24 * time.Hour
+	defaultLabelStock     = "avery-l7160"
+
+	defaultItemType   = "book"
+	defaultHoldExpiry = 90 * 24 * time.Hour
+
+	defaultJobLockTtl      = time.Hour
+	defaultJobHistory      = 90 * 24 * time.Hour
+	defaultBackupDirectory = "backups"
+	defaultBackupKeep      = 7
+
+	defaultNotificationSender  = "file"
+	defaultNotificationFile    = "notifications.log"
+	defaultNotificationFrom    = "Library <library@example.com>"
+	defaultNotificationDueSoon = 48 * time.Hour
+	defaultSmtpPort            = 587
+	defaultSmtpTimeout         = 10 * time.Second
+
+	defaultAccountUrl      = "http://localhost:3000"
+	defaultSessionTtl      = 30 * 24 * time.Hour
+	defaultVerificationTtl = 48 * time.Hour
+	defaultResetTtl        = time.Hour
+	defaultSessionCookie   = "library_session"
+)
 
 func init() {
 	viper.SetConfigFile("config.yml")
 	viper.AutomaticEnv()
+	viper.SetDefault("server.shutdownTimeout", defaultShutdownTimeout)
+	viper.SetDefault("request.maxBodyBytes", defaultMaxBodyBytes)
+	viper.SetDefault("request.maxTextLength", defaultMaxTextLength)
+	viper.SetDefault("librarian.output", defaultLibrarianOutput)
+	viper.SetDefault("webhooks.maxAttempts", defaultWebhookMaxAttempts)
+	viper.SetDefault("webhooks.initialBackoff", defaultWebhookInitialBackoff)
+	viper.SetDefault("webhooks.maxBackoff", defaultWebhookMaxBackoff)
+	viper.SetDefault("webhooks.pollInterval", defaultWebhookPollInterval)
+	viper.SetDefault("webhooks.timeout", defaultWebhookTimeout)
+	viper.SetDefault("idempotency.ttl", defaultIdempotencyTtl)
+	viper.SetDefault("blobs.store", defaultBlobStore)
+	viper.SetDefault("blobs.directory", defaultBlobDirectory)
+	viper.SetDefault("covers.maxBytes", defaultCoverMaxBytes)
+	viper.SetDefault("attachments.maxBytes", defaultAttachmentMaxBytes)
+	viper.SetDefault("attachments.loanPeriod", defaultDigitalLoanPeriod)
+	viper.SetDefault("attachments.linkTtl", defaultDownloadLinkTtl)
+	viper.SetDefault("lookups.provider", defaultLookupProvider)
+	viper.SetDefault("lookups.url", defaultLookupUrl)
+	viper.SetDefault("lookups.file", defaultLookupFile)
+	viper.SetDefault("lookups.timeout", defaultLookupTimeout)
+	viper.SetDefault("lookups.cacheTtl", defaultLookupCacheTtl)
+	viper.SetDefault("labels.stock", defaultLabelStock)
+	viper.SetDefault("circulation.defaultItemType", defaultItemType)
+	viper.SetDefault("circulation.holdExpiry", defaultHoldExpiry)
+	viper.SetDefault("jobs.enabled", true)
+	viper.SetDefault("jobs.lockTtl", defaultJobLockTtl)
+	viper.SetDefault("jobs.history", defaultJobHistory)
+	viper.SetDefault("jobs.backup.directory", defaultBackupDirectory)
+	viper.SetDefault("jobs.backup.keep", defaultBackupKeep)
+	viper.SetDefault("notifications.sender", defaultNotificationSender)
+	viper.SetDefault("notifications.file", defaultNotificationFile)
+	viper.SetDefault("notifications.from", defaultNotificationFrom)
+	viper.SetDefault("notifications.dueSoon", defaultNotificationDueSoon)
+	viper.SetDefault("notifications.smtp.port", defaultSmtpPort)
+	viper.SetDefault("notifications.smtp.timeout", defaultSmtpTimeout)
+	viper.SetDefault("accounts.url", defaultAccountUrl)
+	viper.SetDefault("accounts.sessionTtl", defaultSessionTtl)
+	viper.SetDefault("accounts.verificationTtl", defaultVerificationTtl)
+	viper.SetDefault("accounts.resetTtl", defaultResetTtl)
+	viper.SetDefault("accounts.sessionCookie", defaultSessionCookie)
+	viper.SetDefault("accounts.secureCookies", true)
 
 	err := viper.ReadInConfig()
 	if err != nil {
 		log.Print("Error while reading config file " + err.Error())
+		AppLogger = zap.NewNop()
 	} else {
 		ServerPort = portColon + viper.GetString("server.port")
+		if grpcPort := viper.GetString("server.grpcPort"); grpcPort != "" {
+			GrpcPort = portColon + grpcPort
+		}
+		ShutdownTimeout = viper.GetDuration("server.shutdownTimeout")
 
 		LogFile, _ = os.OpenFile(viper.GetString("server.logfile"),
 			os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
@@ -33,5 +276,84 @@ func init() {
 			zapcore.AddSync(LogFile),
 			zap.InfoLevel)
 		AppLogger = zap.New(core)
+
+		CorsAllowedOrigins = viper.GetStringSlice("cors.allowedOrigins")
+		CorsAllowedMethods = viper.GetStringSlice("cors.allowedMethods")
+		CorsAllowedHeaders = viper.GetStringSlice("cors.allowedHeaders")
+		CorsExposedHeaders = viper.GetStringSlice("cors.exposedHeaders")
+		CorsMaxAge = viper.GetInt("cors.maxAge")
+		CorsAllowCredentials = viper.GetBool("cors.allowCredentials")
+
+		StrictTransportSecurity = viper.GetString("security.strictTransportSecurity")
+		ContentTypeOptions = viper.GetString("security.contentTypeOptions")
+		ContentSecurityPolicy = viper.GetString("security.contentSecurityPolicy")
+
+		MaxBodyBytes = viper.GetInt64("request.maxBodyBytes")
+		MaxTextLength = viper.GetInt("request.maxTextLength")
+
+		ValidateRequests = viper.GetBool("openapi.validateRequests")
+		RedocIntegrity = viper.GetString("openapi.redocIntegrity")
+		_ = viper.UnmarshalKey("api.versions", &ApiVersions)
+
+		LibrarianRemote = viper.GetString("librarian.remote")
+		LibrarianToken = viper.GetString("librarian.token")
+		LibrarianOutput = viper.GetString("librarian.output")
+
+		WebhookMaxAttempts = viper.GetInt("webhooks.maxAttempts")
+		WebhookInitialBackoff = viper.GetDuration("webhooks.initialBackoff")
+		WebhookMaxBackoff = viper.GetDuration("webhooks.maxBackoff")
+		WebhookPollInterval = viper.GetDuration("webhooks.pollInterval")
+		WebhookTimeout = viper.GetDuration("webhooks.timeout")
+
+		IdempotencyTtl = viper.GetDuration("idempotency.ttl")
+
+		BlobStore = viper.GetString("blobs.store")
+		BlobDirectory = viper.GetString("blobs.directory")
+		_ = viper.UnmarshalKey("blobs.s3", &BlobS3)
+
+		CoverMaxBytes = viper.GetInt64("covers.maxBytes")
+
+		AttachmentMaxBytes = viper.GetInt64("attachments.maxBytes")
+		DigitalLoanPeriod = viper.GetDuration("attachments.loanPeriod")
+		DownloadLinkTtl = viper.GetDuration("attachments.linkTtl")
+		DownloadSigningKey = viper.GetString("attachments.signingKey")
+
+		LookupProvider = viper.GetString("lookups.provider")
+		LookupUrl = viper.GetString("lookups.url")
+		LookupFile = viper.GetString("lookups.file")
+		LookupTimeout = viper.GetDuration("lookups.timeout")
+		LookupCacheTtl = viper.GetDuration("lookups.cacheTtl")
+		LabelStock = viper.GetString("labels.stock")
+
+		DefaultItemType = viper.GetString("circulation.defaultItemType")
+		if viper.IsSet("circulation.policies") {
+			LoanPolicies = map[string]LoanPolicy{}
+			_ = viper.UnmarshalKey("circulation.policies", &LoanPolicies)
+		}
+		HoldExpiry = viper.GetDuration("circulation.holdExpiry")
+
+		JobsEnabled = viper.GetBool("jobs.enabled")
+		for name, schedule := range viper.GetStringMapString("jobs.schedules") {
+			JobSchedules[name] = schedule
+		}
+		JobLockTtl = viper.GetDuration("jobs.lockTtl")
+		JobHistory = viper.GetDuration("jobs.history")
+		BackupDirectory = viper.GetString("jobs.backup.directory")
+		BackupKeep = viper.GetInt("jobs.backup.keep")
+
+		NotificationSender = viper.GetString("notifications.sender")
+		NotificationFile = viper.GetString("notifications.file")
+		NotificationTemplates = viper.GetString("notifications.templates")
+		NotificationFrom = viper.GetString("notifications.from")
+		NotificationDueSoon = viper.GetDuration("notifications.dueSoon")
+		_ = viper.UnmarshalKey("notifications.smtp", &SmtpServer)
+
+		AccountUrl = viper.GetString("accounts.url")
+		SessionTtl = viper.GetDuration("accounts.sessionTtl")
+		VerificationTtl = viper.GetDuration("accounts.verificationTtl")
+		ResetTtl = viper.GetDuration("accounts.resetTtl")
+		SessionCookie = viper.GetString("accounts.sessionCookie")
+		SecureCookies = viper.GetBool("accounts.secureCookies")
+		StaffToken = viper.GetString("accounts.staffToken")
 	}
 }
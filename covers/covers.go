@@ -0,0 +1,124 @@
+// Package covers checks uploaded cover images and scales them into thumbnails.
+package covers
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	Jpeg = "image/jpeg"
+	Png  = "image/png"
+	Webp = "image/webp"
+
+	// Original names the uploaded image among the sizes.
+	Original = "original"
+
+	// maxPixels bounds the images decoded, so that a small file can't claim a huge canvas.
+	maxPixels = 40_000_000
+	quality   = 85
+)
+
+// Sizes holds the longest side in pixels of each thumbnail, smaller images aren't enlarged.
+var Sizes = map[string]int{
+	"small":  120,
+	"medium": 300,
+	"large":  600,
+}
+
+var (
+	ErrUnsupported = errors.New("cover must be a JPEG, PNG or WebP image")
+	ErrMismatch    = errors.New("cover content does not match its content type")
+	ErrTooLarge    = errors.New("cover has too many pixels")
+)
+
+// Image is a decoded cover, with the content type its data was found to have.
+type Image struct {
+	image.Image
+	ContentType string
+}
+
+// Supported tells whether covers may be uploaded with the content type.
+func Supported(contentType string) bool {
+	return contentType == Jpeg || contentType == Png || contentType == Webp
+}
+
+// Decode reads a cover declared as contentType, which its data must turn out to be.
+func Decode(data []byte, contentType string) (Image, error) {
+	if !Supported(contentType) {
+		return Image{}, ErrUnsupported
+	}
+	if http.DetectContentType(data) != contentType {
+		return Image{}, ErrMismatch
+	}
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, err
+	}
+	if imageConfig.Width*imageConfig.Height > maxPixels {
+		return Image{}, ErrTooLarge
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{Image: decoded, ContentType: contentType}, nil
+}
+
+// ThumbnailType returns the content type of the thumbnails of a cover. Thumbnails of PNG
+// covers are PNG to keep their transparency, all others are JPEG.
+func ThumbnailType(contentType string) string {
+	if contentType == Png {
+		return Png
+	}
+	return Jpeg
+}
+
+// Thumbnail scales the cover so its longest side is at most size pixels and encodes it as
+// ThumbnailType tells.
+func Thumbnail(cover Image, size int) ([]byte, error) {
+	bounds := cover.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), cover, bounds, draw.Src, nil)
+
+	var buffer bytes.Buffer
+	var err error
+	if ThumbnailType(cover.ContentType) == Png {
+		err = png.Encode(&buffer, scaled)
+	} else {
+		err = jpeg.Encode(&buffer, scaled, &jpeg.Options{Quality: quality})
+	}
+	return buffer.Bytes(), err
+}
+
+// Extension returns the file extension of a cover content type.
+func Extension(contentType string) string {
+	switch contentType {
+	case Png:
+		return ".png"
+	case Webp:
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,89 @@
+package covers
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encode(t *testing.T, contentType string, width int, height int) []byte {
+	var buffer bytes.Buffer
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	var err error
+	if contentType == Png {
+		err = png.Encode(&buffer, canvas)
+	} else {
+		err = jpeg.Encode(&buffer, canvas, nil)
+	}
+	if err != nil {
+		t.Fatalf("Could not encode image: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name        string
+		data        []byte
+		contentType string
+		err         error
+	}{
+		{name: "should decode JPEG", data: encode(t, Jpeg, 40, 60), contentType: Jpeg},
+		{name: "should decode PNG", data: encode(t, Png, 40, 60), contentType: Png},
+		{name: "should refuse GIF", data: []byte("GIF89a"), contentType: "image/gif", err: ErrUnsupported},
+		{name: "should refuse PNG declared as WebP", data: encode(t, Png, 40, 60), contentType: Webp, err: ErrMismatch},
+		{name: "should refuse text declared as JPEG", data: []byte("not an image"), contentType: Jpeg, err: ErrMismatch},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			cover, err := Decode(scenario.data, scenario.contentType)
+			if err != scenario.err {
+				t.Fatalf("Expected %v, got %v", scenario.err, err)
+			}
+			if err == nil && (cover.Bounds().Dx() != 40 || cover.ContentType != scenario.contentType) {
+				t.Errorf("Expected a 40 pixels wide %v, got %v", scenario.contentType, cover.Bounds())
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name        string
+		contentType string
+		width       int
+		height      int
+		size        int
+		expected    image.Point
+		encoded     string
+	}{
+		{name: "should fit portrait covers by height", contentType: Jpeg, width: 400, height: 600, size: 300, expected: image.Pt(200, 300), encoded: Jpeg},
+		{name: "should fit landscape covers by width", contentType: Png, width: 600, height: 300, size: 120, expected: image.Pt(120, 60), encoded: Png},
+		{name: "should not enlarge small covers", contentType: Jpeg, width: 80, height: 100, size: 300, expected: image.Pt(80, 100), encoded: Jpeg},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			cover, err := Decode(encode(t, scenario.contentType, scenario.width, scenario.height), scenario.contentType)
+			if err != nil {
+				t.Fatalf("Could not decode cover: %v", err)
+			}
+			data, err := Thumbnail(cover, scenario.size)
+			if err != nil {
+				t.Fatalf("Could not scale cover: %v", err)
+			}
+			thumbnail, format, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil || "image/"+format != scenario.encoded {
+				t.Fatalf("Expected a %v thumbnail, got %v, %v", scenario.encoded, format, err)
+			}
+			if image.Pt(thumbnail.Width, thumbnail.Height) != scenario.expected {
+				t.Errorf("Expected %v, got %vx%v", scenario.expected, thumbnail.Width, thumbnail.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package credits
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/duplicates"
+	"regexp"
+	"strings"
+)
+
+// separator is how Format joins the credits of a book, and the least ambiguous of the
+// separators Parse splits on.
+const separator = " & "
+
+var (
+	// separators split an author string into the people credited, such as "Neil Gaiman
+	// and Terry Pratchett" or "Gaiman; Pratchett".
+	separators = regexp.MustCompile(`(?i)\s*(;|&|\band\b|\bwith\b)\s*`)
+	// roleSuffix and rolePrefix mark the people who were not the author, as in "Jane
+	// Doe (ed.)" or "translated by Jane Doe".
+	roleSuffix = regexp.MustCompile(`(?i)\s*\((eds?|editors?|tr|trans|translators?|ill|illus|illustrators?)\.?\)$`)
+	rolePrefix = regexp.MustCompile(`(?i)^(edited|translated|illustrated)\s+by\s+`)
+
+	roles = map[string]string{
+		"ed": domain.RoleEditor, "eds": domain.RoleEditor, "editor": domain.RoleEditor, "editors": domain.RoleEditor, "edited": domain.RoleEditor,
+		"tr": domain.RoleTranslator, "trans": domain.RoleTranslator, "translator": domain.RoleTranslator, "translators": domain.RoleTranslator, "translated": domain.RoleTranslator,
+		"ill": domain.RoleIllustrator, "illus": domain.RoleIllustrator, "illustrator": domain.RoleIllustrator, "illustrators": domain.RoleIllustrator, "illustrated": domain.RoleIllustrator,
+	}
+)
+
+// Parse splits a free text author, as books had before authors were records of their
+// own, into the credits it names, in order. Names filed as "Last, First" are turned
+// around, other comma separated names are taken as several people, and a person named
+// twice in the same role is credited once. The credits have no AuthorId yet.
+func Parse(author string) []domain.Credit {
+	var parsed []domain.Credit
+	seen := map[string]bool{}
+	for _, part := range separators.Split(author, -1) {
+		role := domain.RoleAuthor
+		if match := roleSuffix.FindStringSubmatch(part); match != nil {
+			role = roles[strings.ToLower(match[1])]
+			part = part[:len(part)-len(match[0])]
+		} else if match := rolePrefix.FindStringSubmatch(part); match != nil {
+			role = roles[strings.ToLower(match[1])]
+			part = part[len(match[0]):]
+		}
+
+		for _, name := range names(part) {
+			if key := Key(name) + "/" + role; name != "" && !seen[key] {
+				seen[key] = true
+				parsed = append(parsed, domain.Credit{Name: name, Role: role, Position: len(parsed) + 1})
+			}
+		}
+	}
+	return parsed
+}
+
+// Format returns the free text author of a book with credits, which Parse turns back into
+// the same credits: the names joined with " & ", followed by their role unless they are
+// an author.
+func Format(credits []domain.Credit) string {
+	formatted := make([]string, 0, len(credits))
+	for _, credit := range credits {
+		if credit.Role == domain.RoleAuthor {
+			formatted = append(formatted, credit.Name)
+		} else {
+			formatted = append(formatted, credit.Name+" ("+credit.Role+")")
+		}
+	}
+	return strings.Join(formatted, separator)
+}
+
+// Key is what author records are matched by, so that "Tolkien, J. R. R." and "J.R.R.
+// Tolkien" are the same author.
+func Key(name string) string {
+	return duplicates.AuthorKey(name)
+}
+
+// names splits part on commas. A single word before the only comma is a last name.
+func names(part string) []string {
+	parts := strings.Split(part, ",")
+	if len(parts) == 2 && len(strings.Fields(parts[0])) == 1 && len(strings.Fields(parts[1])) > 0 {
+		parts = []string{parts[1] + " " + parts[0]}
+	}
+
+	for i := range parts {
+		parts[i] = strings.Join(strings.Fields(parts[i]), " ")
+	}
+	return parts
+}
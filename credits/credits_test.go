@@ -0,0 +1,88 @@
+package credits
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name     string
+		author   string
+		expected []domain.Credit
+	}{
+		{
+			name:     "should parse a single author",
+			author:   "  J. R. R.   Tolkien ",
+			expected: []domain.Credit{{Name: "J. R. R. Tolkien", Role: domain.RoleAuthor, Position: 1}},
+		},
+		{
+			name:     "should turn around last name first",
+			author:   "Tolkien, J. R. R.",
+			expected: []domain.Credit{{Name: "J. R. R. Tolkien", Role: domain.RoleAuthor, Position: 1}},
+		},
+		{
+			name:   "should split co-authors",
+			author: "Neil Gaiman and Terry Pratchett",
+			expected: []domain.Credit{
+				{Name: "Neil Gaiman", Role: domain.RoleAuthor, Position: 1},
+				{Name: "Terry Pratchett", Role: domain.RoleAuthor, Position: 2},
+			},
+		},
+		{
+			name:   "should split comma separated names",
+			author: "Brian Kernighan, Dennis Ritchie & Rob Pike",
+			expected: []domain.Credit{
+				{Name: "Brian Kernighan", Role: domain.RoleAuthor, Position: 1},
+				{Name: "Dennis Ritchie", Role: domain.RoleAuthor, Position: 2},
+				{Name: "Rob Pike", Role: domain.RoleAuthor, Position: 3},
+			},
+		},
+		{
+			name:   "should parse roles",
+			author: "Homer; Fagles, Robert (trans.); edited by Bernard Knox",
+			expected: []domain.Credit{
+				{Name: "Homer", Role: domain.RoleAuthor, Position: 1},
+				{Name: "Robert Fagles", Role: domain.RoleTranslator, Position: 2},
+				{Name: "Bernard Knox", Role: domain.RoleEditor, Position: 3},
+			},
+		},
+		{
+			name:     "should credit a person once per role",
+			author:   "Tolkien, J.R.R. & J. R. R. Tolkien",
+			expected: []domain.Credit{{Name: "J.R.R. Tolkien", Role: domain.RoleAuthor, Position: 1}},
+		},
+		{
+			name:     "should parse nothing from blanks",
+			author:   " ; ",
+			expected: nil,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if parsed := Parse(scenario.author); !reflect.DeepEqual(parsed, scenario.expected) {
+				t.Errorf("Expected %v, got %v", scenario.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestFormatIsParsedBack(t *testing.T) {
+	t.Parallel()
+	credits := []domain.Credit{
+		{Name: "Antoine de Saint-Exupéry", Role: domain.RoleAuthor, Position: 1},
+		{Name: "Richard Howard", Role: domain.RoleTranslator, Position: 2},
+		{Name: "Jane Doe", Role: domain.RoleIllustrator, Position: 3},
+	}
+
+	formatted := Format(credits)
+	if formatted != "Antoine de Saint-Exupéry & Richard Howard (translator) & Jane Doe (illustrator)" {
+		t.Errorf("Unexpected format %v", formatted)
+	}
+	if parsed := Parse(formatted); !reflect.DeepEqual(parsed, credits) {
+		t.Errorf("Expected %v, got %v", credits, parsed)
+	}
+}
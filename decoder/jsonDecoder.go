@@ -0,0 +1,187 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"golang.org/x/text/unicode/norm"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Fields which are owned by the server and can never be set through a request body.
+var serverOwnedFields = []string{"Id", "CreatedAt", "UpdatedAt"}
+
+// longText tags string fields, such as descriptions, whose length validation bounds
+// rather than config.MaxTextLength.
+const longText = "longtext"
+
+type Error struct {
+	Status     int
+	Malformed  bool
+	Violations []domain.Violation
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		if violation.Field == "" {
+			messages = append(messages, violation.Message)
+		} else {
+			messages = append(messages, violation.Field+": "+violation.Message)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add records a violation against field, creating a bad request error when e is nil.
+func (e *Error) Add(field string, message string) *Error {
+	if e == nil {
+		e = &Error{Status: http.StatusBadRequest}
+	}
+	e.Violations = append(e.Violations, domain.Violation{Field: field, Message: message})
+	return e
+}
+
+func (e *Error) ApiError() domain.ApiError {
+	return domain.ApiError{
+		Status:     e.Status,
+		Message:    http.StatusText(e.Status),
+		Violations: e.Violations,
+	}
+}
+
+// Decode reads a single JSON object from the request body into target, which must be a
+// pointer to a struct. The body is limited to config.MaxBodyBytes, unknown and server
+// owned fields are rejected, and every string field is NFC normalised and checked against
+// config.MaxTextLength, unless tagged decode:"longtext" for validation to bound them
+// instead. Control characters are rejected, but for the line breaks and tabs of long
+// text. All violations found are returned together; when the body could not be parsed
+// at all the returned error is marked as Malformed and target is untouched.
+func Decode(r *http.Request, target interface{}) *Error {
+	body, readErr := ioutil.ReadAll(io.LimitReader(r.Body, config.MaxBodyBytes+1))
+	if readErr != nil {
+		return malformed(http.StatusBadRequest, "request body could not be read")
+	}
+	if int64(len(body)) > config.MaxBodyBytes {
+		return malformed(http.StatusRequestEntityTooLarge,
+			"request body exceeds "+strconv.FormatInt(config.MaxBodyBytes, 10)+" bytes")
+	}
+	if !utf8.Valid(body) {
+		return malformed(http.StatusBadRequest, "request body is not valid UTF-8")
+	}
+
+	var rawFields map[string]json.RawMessage
+	jsonDecoder := json.NewDecoder(bytes.NewReader(body))
+	if decodeErr := jsonDecoder.Decode(&rawFields); decodeErr != nil || rawFields == nil {
+		return malformed(http.StatusBadRequest, "request body must be a JSON object")
+	}
+
+	var decodeErr *Error
+	if _, tokenErr := jsonDecoder.Token(); tokenErr != io.EOF {
+		decodeErr = decodeErr.Add("", "unexpected data after JSON object")
+	}
+
+	value := reflect.ValueOf(target).Elem()
+	for _, key := range sortedKeys(rawFields) {
+		if isServerOwned(key) {
+			decodeErr = decodeErr.Add(key, "is set by the server")
+			continue
+		}
+
+		field, structField, found := fieldByJsonName(value, key)
+		if !found {
+			decodeErr = decodeErr.Add(key, "is not a known field")
+			continue
+		}
+
+		fieldDecoder := json.NewDecoder(bytes.NewReader(rawFields[key]))
+		fieldDecoder.DisallowUnknownFields()
+		if fieldErr := fieldDecoder.Decode(field.Addr().Interface()); fieldErr != nil {
+			decodeErr = decodeErr.Add(key, "must be of type "+field.Type().String())
+			continue
+		}
+
+		if field.Kind() == reflect.String {
+			decodeErr = checkText(decodeErr, key, field, structField.Tag.Get("decode") == longText)
+		}
+	}
+
+	return decodeErr
+}
+
+func checkText(decodeErr *Error, key string, field reflect.Value, long bool) *Error {
+	text := norm.NFC.String(field.String())
+	field.SetString(text)
+
+	if !long && utf8.RuneCountInString(text) > config.MaxTextLength {
+		decodeErr = decodeErr.Add(key, "must not be longer than "+strconv.Itoa(config.MaxTextLength)+" characters")
+	}
+	if strings.IndexFunc(text, func(r rune) bool { return unicode.IsControl(r) && !(long && isLineSpace(r)) }) >= 0 {
+		decodeErr = decodeErr.Add(key, "must not contain control characters")
+	}
+
+	return decodeErr
+}
+
+// isLineSpace tells the control characters which lay out long text over lines.
+func isLineSpace(r rune) bool {
+	return r == '\n' || r == '\r' || r == '\t'
+}
+
+func fieldByJsonName(value reflect.Value, key string) (reflect.Value, reflect.StructField, bool) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		structField := valueType.Field(i)
+		if structField.PkgPath != "" {
+			continue
+		}
+
+		name := structField.Name
+		if tag := strings.Split(structField.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		if strings.EqualFold(name, key) {
+			return value.Field(i), structField, true
+		}
+	}
+
+	return reflect.Value{}, reflect.StructField{}, false
+}
+
+func isServerOwned(key string) bool {
+	for _, field := range serverOwnedFields {
+		if strings.EqualFold(field, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(rawFields map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(rawFields))
+	for key := range rawFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func malformed(status int, message string) *Error {
+	return &Error{
+		Status:     status,
+		Malformed:  true,
+		Violations: []domain.Violation{{Message: message}},
+	}
+}
@@ -0,0 +1,107 @@
+package decoder
+
+import (
+	"bytes"
+	"go-rest-webservices-book-library/config"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type target struct {
+	Name  string
+	Count int    `json:"count"`
+	Notes string `decode:"longtext"`
+}
+
+type scenario struct {
+	name       string
+	data       []byte
+	status     int
+	violations int
+	expected   target
+}
+
+func TestDecode(t *testing.T) {
+	config.MaxBodyBytes = 64
+	config.MaxTextLength = 10
+
+	scenarios := []scenario{
+		{
+			name:     "should decode valid object",
+			data:     []byte(`{"Name":"Book","count":2}`),
+			expected: target{Name: "Book", Count: 2},
+		},
+		{
+			name:     "should normalise text to NFC",
+			data:     []byte("{\"Name\":\"Cafe\u0301\"}"),
+			expected: target{Name: "Caf\u00e9"},
+		},
+		{
+			name:       "should reject text longer than limit",
+			data:       []byte(`{"Name":"` + strings.Repeat("a", 11) + `"}`),
+			status:     http.StatusBadRequest,
+			violations: 1,
+		},
+		{
+			name:     "should leave the length of long text to validation",
+			data:     []byte(`{"Notes":"` + strings.Repeat("a", 11) + `"}`),
+			expected: target{Notes: strings.Repeat("a", 11)},
+		},
+		{
+			name:     "should keep line breaks and tabs in long text",
+			data:     []byte(`{"Notes":"One\r\n\tTwo"}`),
+			expected: target{Notes: "One\r\n\tTwo"},
+		},
+		{
+			name:       "should reject line breaks in short text and other controls in long text",
+			data:       []byte(`{"Name":"One\nTwo","Notes":"One\u0007"}`),
+			status:     http.StatusBadRequest,
+			violations: 2,
+		},
+		{
+			name:       "should reject body larger than limit",
+			data:       []byte(`{"Name":"` + strings.Repeat("a", 64) + `"}`),
+			status:     http.StatusRequestEntityTooLarge,
+			violations: 1,
+		},
+		{
+			name:       "should reject wrong types, unknown fields and trailing data together",
+			data:       []byte(`{"count":"two","Other":1}[]`),
+			status:     http.StatusBadRequest,
+			violations: 3,
+		},
+		{
+			name:       "should reject non object body",
+			data:       []byte(`[1, 2]`),
+			status:     http.StatusBadRequest,
+			violations: 1,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var got target
+			r, _ := http.NewRequest("POST", "/", bytes.NewBuffer(scenario.data))
+			decodeErr := Decode(r, &got)
+
+			if scenario.status == 0 {
+				if decodeErr != nil {
+					t.Fatalf("Expected no error, got %v", decodeErr)
+				}
+				if got != scenario.expected {
+					t.Errorf("Expected %v, got %v", scenario.expected, got)
+				}
+				return
+			}
+
+			if decodeErr == nil {
+				t.Fatalf("Expected status %v, got no error", scenario.status)
+			}
+			if decodeErr.Status != scenario.status || len(decodeErr.Violations) != scenario.violations {
+				t.Errorf("Expected %v with %v violations, got %v with %v",
+					scenario.status, scenario.violations, decodeErr.Status, decodeErr.Violations)
+			}
+		})
+	}
+}
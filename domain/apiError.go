@@ -0,0 +1,12 @@
+package domain
+
+type ApiError struct {
+	Status     int
+	Message    string
+	Violations []Violation
+}
+
+type Violation struct {
+	Field   string
+	Message string
+}
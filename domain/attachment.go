@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+// Attachment is a digital edition of a book, an EPUB or a PDF file members can download
+// while they have a digital loan of the book. The metadata read from the file is kept
+// along with it, empty for PDFs.
+type Attachment struct {
+	Id          int64
+	BookId      int64
+	Format      string
+	ContentType string
+	Digest      string
+	Bytes       int64
+	Metadata    EditionMetadata
+	UploadedAt  time.Time
+}
+
+// EditionMetadata is what the OPF package document of an EPUB tells about the book.
+type EditionMetadata struct {
+	Title    string `json:",omitempty"`
+	Author   string `json:",omitempty"`
+	Isbn     string `json:",omitempty"`
+	Language string `json:",omitempty"`
+}
+
+// AttachmentUpload is an uploaded attachment along with where its metadata disagrees
+// with the record of its book.
+type AttachmentUpload struct {
+	Attachment Attachment
+	Mismatches []Mismatch
+}
+
+// Mismatch is a field of a book whose record and digital edition disagree.
+type Mismatch struct {
+	Field   string
+	Book    string
+	Edition string
+}
+
+// DownloadLink is a signed URL an attachment can be downloaded from until it expires.
+type DownloadLink struct {
+	Url       string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,23 @@
+package domain
+
+// Roles a person can be credited with on a book.
+const (
+	RoleAuthor      = "author"
+	RoleEditor      = "editor"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+)
+
+type Author struct {
+	Id   int64
+	Name string `validate:"required,max=255"`
+}
+
+// Credit names an author of a book and the role they had in it. Credits of a book are
+// ordered by Position, starting at 1, the order the names are printed on the cover.
+type Credit struct {
+	AuthorId int64  `validate:"required"`
+	Name     string `json:",omitempty"`
+	Role     string `validate:"required,oneof=author|editor|translator|illustrator"`
+	Position int    `json:",omitempty"`
+}
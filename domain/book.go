@@ -1,7 +1,25 @@
 package domain
 
 type Book struct {
-	Id 		int64
-	Name 	string
-	Author 	string
+	Id        int64
+	Name      string `validate:"required,max=255"`
+	Author    string `validate:"required,max=255"`
+	Isbn      string `json:",omitempty" validate:"isbn"`
+	Publisher string `json:",omitempty" validate:"max=255"`
+	Year      int    `json:",omitempty" validate:"year"`
+	Pages     int    `json:",omitempty" validate:"min=1,max=100000"`
+}
+
+// DuplicateCluster groups books which are probably the same title, with the reasons they
+// were grouped and the best similarity between two of them, 1 for exact matches.
+type DuplicateCluster struct {
+	Books   []Book
+	Reasons []string
+	Score   float64
+}
+
+// BookMerge folds the Sources into the Target book.
+type BookMerge struct {
+	Target  int64   `validate:"required"`
+	Sources []int64 `validate:"required,max=100"`
 }
@@ -0,0 +1,9 @@
+package domain
+
+// BookFilter narrows book searches, empty fields match every book.
+type BookFilter struct {
+	Name   string
+	Author string
+	// Subject matches the books tagged with the subject or with any subject below it.
+	Subject int64
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"time"
+)
+
+const (
+	CopyAvailable = "available"
+	CopyOnLoan    = "on_loan"
+	CopyLost      = "lost"
+
+	PaymentPaid   = "payment"
+	PaymentWaived = "waiver"
+)
+
+// Copy is a physical item of a book which can be lent out, under the loan policy of its
+// item type.
+type Copy struct {
+	Id       int64
+	BookId   int64
+	Barcode  string
+	Status   string
+	ItemType string
+}
+
+type Member struct {
+	Id    int64
+	Name  string
+	Email string
+}
+
+// Loan of a copy to a member, ReturnedAt stays nil while the copy is out.
+type Loan struct {
+	Id         int64
+	CopyId     int64
+	MemberId   int64
+	LoanedAt   time.Time
+	DueAt      time.Time
+	ReturnedAt *time.Time
+	Renewals   int
+}
+
+// LoanReturn is a loan which has just been returned, with the fine it accrued, if any.
+type LoanReturn struct {
+	Loan Loan
+	Fine *Fine `json:",omitempty"`
+}
+
+// Fine is charged to a member for a loan returned late. Amounts are in the smallest unit
+// of the currency, such as cents.
+type Fine struct {
+	Id          int64
+	LoanId      int64
+	MemberId    int64
+	Amount      int64
+	OverdueDays int
+	AssessedAt  time.Time
+}
+
+// Payment settles fines of a member, paid by them or waived by the library.
+type Payment struct {
+	Id       int64
+	MemberId int64
+	Kind     string
+	Amount   int64
+	Note     string `json:",omitempty"`
+	PaidAt   time.Time
+}
+
+// Account is what a member owes: their fines less their payments.
+type Account struct {
+	MemberId int64
+	Balance  int64
+	Fines    []Fine
+	Payments []Payment
+}
+
+// DigitalLoan lends the digital editions of a book to a member until it is due, or
+// returned earlier. Digital loans take no copy, so any number of members can hold one.
+type DigitalLoan struct {
+	Id         int64
+	BookId     int64
+	MemberId   int64
+	LoanedAt   time.Time
+	DueAt      time.Time
+	ReturnedAt *time.Time `json:",omitempty"`
+}
+
+// Hold is a member waiting for any copy of a book.
+type Hold struct {
+	Id       int64
+	BookId   int64
+	MemberId int64
+	PlacedAt time.Time
+}
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// Cover describes the cover image of a book. The image and its thumbnails are kept in the
+// blob store under the Digest, the SHA-256 of the uploaded image, so a new upload never
+// overwrites what caches may still hold.
+type Cover struct {
+	BookId      int64
+	ContentType string
+	Digest      string
+	Width       int
+	Height      int
+	Bytes       int64
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"time"
+)
+
+const (
+	TokenSession       = "session"
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// EmailAlreadyRegistered is the account email sent to a member when someone signs up
+// with their email, it links to a password reset.
+const EmailAlreadyRegistered = "already_registered"
+
+// Registration is a member signing up with the password they will sign in with.
+type Registration struct {
+	Name     string
+	Email    string
+	Password string
+}
+
+// Login is the email and password a member signs in with.
+type Login struct {
+	Email    string
+	Password string
+}
+
+// PasswordReset sets a new password with a token a member was sent by email.
+type PasswordReset struct {
+	Token    string
+	Password string
+}
+
+// Credentials are what a member signs in with: the bcrypt hash of their password, empty
+// until they set one, and when they verified their email, nil until they do.
+type Credentials struct {
+	Member       Member
+	PasswordHash string
+	VerifiedAt   *time.Time
+}
+
+// Profile is a member as they see themselves.
+type Profile struct {
+	Id       int64
+	Name     string
+	Email    string
+	Verified bool
+}
+
+// MemberToken is a session of a member, or a token they were sent by email to verify it
+// or reset their password. Only the SHA-256 hash of a token is kept, so that a copy of the
+// database cannot be used to sign in.
+type MemberToken struct {
+	Hash      string
+	MemberId  int64
+	Purpose   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Session is a member signed in. Token is sent back as a bearer token or in the session
+// cookie until it expires or the member signs out.
+type Session struct {
+	Token     string
+	MemberId  int64
+	ExpiresAt time.Time
+}
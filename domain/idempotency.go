@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"time"
+)
+
+// IdempotentResponse is the response to the first request made with an Idempotency-Key,
+// replayed to the retries of that request until ExpiresAt. Fingerprint identifies the
+// request, Status stays zero while it is being served. Links keeps the Link headers, such
+// as the warnings about probable duplicates of a new book.
+type IdempotentResponse struct {
+	Key         string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Links       []string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"time"
+)
+
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// JobRun is one run of a background job, by the server instance named Owner. Scheduled
+// runs carry the time they were scheduled for, which only one instance gets to run.
+type JobRun struct {
+	Id          int64
+	Job         string
+	Trigger     string
+	Owner       string
+	ScheduledAt *time.Time `json:",omitempty"`
+	StartedAt   time.Time
+	FinishedAt  *time.Time `json:",omitempty"`
+	Status      string
+	Message     string
+}
+
+// Job describes a background job with its most recent runs, newest first. NextRunAt is nil
+// when the job has no schedule and only runs when asked to.
+type Job struct {
+	Name        string
+	Description string
+	Schedule    string
+	NextRunAt   *time.Time
+	Runs        []JobRun
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// BookDetails are what a metadata provider knows of the book with an ISBN.
+type BookDetails struct {
+	Isbn      string
+	Title     string `json:",omitempty"`
+	Author    string `json:",omitempty"`
+	Publisher string `json:",omitempty"`
+	Year      int    `json:",omitempty"`
+	Pages     int    `json:",omitempty"`
+	Source    string
+	FetchedAt time.Time
+}
+
+// IsbnLookup is a cached answer of a metadata provider, Details is nil when it knew no
+// book with the ISBN.
+type IsbnLookup struct {
+	Isbn      string
+	Details   *BookDetails
+	FetchedAt time.Time
+}
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"time"
+)
+
+const (
+	NotificationDueSoon   = "due_soon"
+	NotificationOverdue   = "overdue"
+	NotificationHoldReady = "hold_ready"
+)
+
+// NotificationPreferences holds the notifications a member gets by email, all of them
+// until they opt out.
+type NotificationPreferences struct {
+	MemberId  int64
+	DueSoon   bool
+	Overdue   bool
+	HoldReady bool
+}
+
+// Notice is a notification due to a member about a book: a loan due soon or overdue, or
+// a hold they can collect. Reference names the loan and its renewal, or the hold, so that
+// a member is told about each of them once.
+type Notice struct {
+	Event     string
+	Reference string
+	Member    Member
+	Book      Book
+	DueAt     time.Time
+}
+
+// Notification is a message which was sent to a member.
+type Notification struct {
+	Id        int64
+	MemberId  int64
+	Event     string
+	Reference string
+	Email     string
+	Subject   string
+	SentAt    time.Time
+}
@@ -0,0 +1,44 @@
+package domain
+
+// Groups of books which keep their books in order, as the repository knows them.
+const (
+	GroupSeries      = "series"
+	GroupCollections = "collections"
+)
+
+// Kinds of collections.
+const (
+	KindCollection = "collection"
+	KindShelf      = "shelf"
+)
+
+// Series is a run of books meant to be read in order. A book is part of one series at
+// most.
+type Series struct {
+	Id   int64
+	Name string `validate:"required,max=255"`
+}
+
+// Collection groups books curated by staff, such as a themed display or a shelf. A book
+// can be part of any number of collections.
+type Collection struct {
+	Id          int64
+	Name        string `validate:"required,max=255"`
+	Kind        string `validate:"required,oneof=collection|shelf"`
+	Description string `json:",omitempty" validate:"max=2000"`
+}
+
+// Entry is a book at its Position, counted from 1, in a series or a collection.
+type Entry struct {
+	Position int
+	Book     Book
+}
+
+// SeriesPosition is where a book is in its series, along with the volumes read before and
+// after it, when there are any.
+type SeriesPosition struct {
+	Series   Series
+	Position int
+	Previous *Book `json:",omitempty"`
+	Next     *Book `json:",omitempty"`
+}
@@ -0,0 +1,20 @@
+package domain
+
+// Subject is a heading of the subject tree, such as "Fiction > Fantasy > High Fantasy".
+// A subject without a ParentId is a root, and books can be tagged with any number of
+// subjects.
+type Subject struct {
+	Id   int64
+	Name string `validate:"required,max=255"`
+	// Code is the class of the subject in the classification it was imported from, a
+	// Dewey number or a BISAC code, and identifies it on later imports.
+	Code     string    `json:",omitempty" validate:"max=50"`
+	ParentId int64     `json:",omitempty"`
+	Children []Subject `json:",omitempty"`
+}
+
+// SubjectImport counts the subjects a classification import added and updated.
+type SubjectImport struct {
+	Added   int
+	Updated int
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"time"
+)
+
+const (
+	EventBookCreated = "book.created"
+	EventBookUpdated = "book.updated"
+	EventBookDeleted = "book.deleted"
+	EventLoanOverdue = "loan.overdue"
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook subscribes Url to the listed events. Payloads are signed with Secret, which is
+// only shown when the webhook is created.
+type Webhook struct {
+	Id        int64
+	Url       string   `validate:"required,max=255,publicurl" pattern:"^https?://\\S+$"`
+	Secret    string   `validate:"max=255"`
+	Events    []string `validate:"required,oneof=book.created|book.updated|book.deleted|loan.overdue"`
+	Active    bool
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is one event to deliver to one webhook, kept in the outbox until it is
+// delivered or dead after too many failed attempts.
+type WebhookDelivery struct {
+	Id             int64
+	WebhookId      int64
+	EventKey       string
+	EventType      string
+	Payload        string
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+type WebhookAttempt struct {
+	Id          int64
+	DeliveryId  int64
+	AttemptedAt time.Time
+	StatusCode  int
+	Error       string
+	DurationMs  int64
+}
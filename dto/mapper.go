@@ -0,0 +1,204 @@
+package dto
+
+import (
+	"context"
+	"go-rest-webservices-book-library/domain"
+	"net/http"
+)
+
+type contextKey struct{}
+
+// Mapper converts domain entities to and from the JSON representation of one API
+// version, so handlers can serve every version with the same code.
+type Mapper interface {
+	Version() string
+	Book(book domain.Book) interface{}
+	Books(books []domain.Book) interface{}
+	ApiError(apiError domain.ApiError) interface{}
+	DuplicateClusters(clusters []domain.DuplicateCluster) interface{}
+	Author(author domain.Author) interface{}
+	Authors(authors []domain.Author) interface{}
+	Credits(credits []domain.Credit) interface{}
+	Series(series domain.Series) interface{}
+	SeriesList(series []domain.Series) interface{}
+	Collection(collection domain.Collection) interface{}
+	Collections(collections []domain.Collection) interface{}
+	Entries(entries []domain.Entry) interface{}
+	// ExpandedBook is Book along with its position in its series, which is left out when
+	// it is nil.
+	ExpandedBook(book domain.Book, series *domain.SeriesPosition) interface{}
+	Subject(subject domain.Subject) interface{}
+	// Subjects maps a list of subjects along with their Children, so it serves both the
+	// subject tree and the subjects of a book.
+	Subjects(subjects []domain.Subject) interface{}
+	SubjectImport(imported domain.SubjectImport) interface{}
+	Cover(cover domain.Cover) interface{}
+	Attachment(attachment domain.Attachment) interface{}
+	Attachments(attachments []domain.Attachment) interface{}
+	AttachmentUpload(upload domain.AttachmentUpload) interface{}
+	EditionMetadata(metadata domain.EditionMetadata) interface{}
+	DigitalLoan(loan domain.DigitalLoan) interface{}
+	DownloadLink(link domain.DownloadLink) interface{}
+	BookDetails(details domain.BookDetails) interface{}
+	Copy(copy domain.Copy) interface{}
+	Copies(copies []domain.Copy) interface{}
+	Member(member domain.Member) interface{}
+	Members(members []domain.Member) interface{}
+	Loan(loan domain.Loan) interface{}
+	LoanReturn(loanReturn domain.LoanReturn) interface{}
+	Account(account domain.Account) interface{}
+	Payment(payment domain.Payment) interface{}
+	NotificationPreferences(preferences domain.NotificationPreferences) interface{}
+	Notifications(notifications []domain.Notification) interface{}
+	Loans(loans []domain.Loan) interface{}
+	Hold(hold domain.Hold) interface{}
+	Profile(profile domain.Profile) interface{}
+	Session(session domain.Session) interface{}
+	// NewBookInput returns a pointer to an empty request body for a book, validated and
+	// decoded as is and then converted with BookInput.Book.
+	NewBookInput() BookInput
+	NewMergeInput() MergeInput
+	NewAuthorInput() AuthorInput
+	NewCreditsInput() CreditsInput
+	NewSeriesInput() SeriesInput
+	NewCollectionInput() CollectionInput
+	NewEntriesInput() EntriesInput
+	NewEntryInput() EntryInput
+	NewSubjectInput() SubjectInput
+	NewSubjectsInput() SubjectsInput
+	NewBorrowerInput() BorrowerInput
+	NewLabelsInput() LabelsInput
+	NewCopyInput() CopyInput
+	NewLoanInput() LoanInput
+	NewPaymentInput() PaymentInput
+	NewPreferencesInput() PreferencesInput
+	NewHoldInput() HoldInput
+	NewRegistrationInput() RegistrationInput
+	NewLoginInput() LoginInput
+	NewTokenInput() TokenInput
+	NewEmailInput() EmailInput
+	NewPasswordResetInput() PasswordResetInput
+}
+
+type BookInput interface {
+	Book() domain.Book
+}
+
+type MergeInput interface {
+	BookMerge() domain.BookMerge
+}
+
+type AuthorInput interface {
+	Author() domain.Author
+}
+
+// CreditsInput is the list of credits of a book, in order, each naming the author by id.
+type CreditsInput interface {
+	BookCredits() []domain.Credit
+}
+
+type SeriesInput interface {
+	Series() domain.Series
+}
+
+// CollectionInput is a collection, which is of kind collection unless the request says
+// otherwise.
+type CollectionInput interface {
+	Collection() domain.Collection
+}
+
+// EntriesInput is the books of a series or a collection, in order.
+type EntriesInput interface {
+	BookIds() []int64
+}
+
+// EntryInput is a book to put in a series or a collection, at the end unless a position
+// is given.
+type EntryInput interface {
+	Entry() domain.Entry
+}
+
+// SubjectInput is a subject, a root unless it names a parent.
+type SubjectInput interface {
+	Subject() domain.Subject
+}
+
+// SubjectsInput is the subjects a book is tagged with, by id.
+type SubjectsInput interface {
+	SubjectIds() []int64
+}
+
+// BorrowerInput names the member a digital loan or a download is for, Borrower returns
+// the id of the member.
+type BorrowerInput interface {
+	Borrower() int64
+}
+
+// LabelsInput is the copies to print labels for, by id, in the order of the labels.
+type LabelsInput interface {
+	CopyIds() []int64
+}
+
+// CopyInput is the barcode and the item type of a copy, the item type decides its loan
+// policy.
+type CopyInput interface {
+	Copy() domain.Copy
+}
+
+// LoanInput is a copy to lend and the member to lend it to, by id.
+type LoanInput interface {
+	Loan() domain.Loan
+}
+
+// PaymentInput is a payment, or a waiver when its kind says so.
+type PaymentInput interface {
+	Payment() domain.Payment
+}
+
+// PreferencesInput is every notification preference of a member, those left out are
+// turned off.
+type PreferencesInput interface {
+	NotificationPreferences() domain.NotificationPreferences
+}
+
+// HoldInput is a book for the signed in member to hold, by id.
+type HoldInput interface {
+	Hold() domain.Hold
+}
+
+type RegistrationInput interface {
+	Registration() domain.Registration
+}
+
+type LoginInput interface {
+	Login() domain.Login
+}
+
+// TokenInput is a token sent to a member by email, such as the one verifying it.
+type TokenInput interface {
+	EmailToken() string
+}
+
+// EmailInput is the email of a member who forgot their password.
+type EmailInput interface {
+	Address() string
+}
+
+type PasswordResetInput interface {
+	PasswordReset() domain.PasswordReset
+}
+
+// Use makes mapper available to next through FromRequest.
+func Use(mapper Mapper, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, mapper)))
+	})
+}
+
+// FromRequest returns the mapper of the API version serving r, V1 when none was set.
+func FromRequest(r *http.Request) Mapper {
+	if mapper, ok := r.Context().Value(contextKey{}).(Mapper); ok {
+		return mapper
+	}
+	return V1
+}
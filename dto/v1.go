@@ -0,0 +1,483 @@
+package dto
+
+import (
+	"go-rest-webservices-book-library/domain"
+)
+
+// V1 is the original representation: the domain structs marshalled as they are, with
+// capitalised field names.
+var V1 Mapper = v1Mapper{}
+
+type v1Mapper struct{}
+
+type bookInputV1 struct {
+	Name      string `validate:"required,max=255"`
+	Author    string `validate:"required,max=255"`
+	Isbn      string `validate:"isbn"`
+	Publisher string `validate:"max=255"`
+	Year      int    `validate:"year"`
+	Pages     int    `validate:"min=1,max=100000"`
+}
+
+type mergeInputV1 domain.BookMerge
+
+type authorInputV1 struct {
+	Name string `validate:"required,max=255"`
+}
+
+type creditsInputV1 struct {
+	Credits []creditInputV1 `validate:"required,max=50,dive"`
+}
+
+type seriesInputV1 struct {
+	Name string `validate:"required,max=255"`
+}
+
+type collectionInputV1 struct {
+	Name        string `validate:"required,max=255"`
+	Kind        string `validate:"oneof=collection|shelf"`
+	Description string `decode:"longtext" validate:"max=2000"`
+}
+
+type entriesInputV1 struct {
+	Books []int64 `validate:"required,max=1000"`
+}
+
+type entryInputV1 struct {
+	BookId   int64 `validate:"required"`
+	Position int   `validate:"min=1"`
+}
+
+type subjectInputV1 struct {
+	Name     string `validate:"required,max=255"`
+	Code     string `validate:"max=50"`
+	ParentId int64
+}
+
+type subjectsInputV1 struct {
+	Subjects []int64 `validate:"max=100"`
+}
+
+type borrowerInputV1 struct {
+	MemberId int64 `validate:"required"`
+}
+
+type labelsInputV1 struct {
+	Copies []int64 `validate:"required,max=1000"`
+}
+
+type copyInputV1 struct {
+	Barcode  string `validate:"required,max=255"`
+	ItemType string `validate:"max=50"`
+}
+
+type loanInputV1 struct {
+	CopyId   int64 `validate:"required"`
+	MemberId int64 `validate:"required"`
+}
+
+type paymentInputV1 struct {
+	Kind   string `validate:"oneof=payment|waiver"`
+	Amount int64  `validate:"required,min=1,max=100000000"`
+	Note   string `validate:"max=255"`
+}
+
+type preferencesInputV1 struct {
+	DueSoon   bool
+	Overdue   bool
+	HoldReady bool
+}
+
+type holdInputV1 struct {
+	BookId int64 `validate:"required"`
+}
+
+// Passwords are limited to 72 characters, as bcrypt ignores the rest.
+type registrationInputV1 struct {
+	Name     string `validate:"required,max=255"`
+	Email    string `validate:"required,email,max=255"`
+	Password string `validate:"required,min=8,max=72"`
+}
+
+type loginInputV1 struct {
+	Email    string `validate:"required,max=255"`
+	Password string `validate:"required,max=72"`
+}
+
+type tokenInputV1 struct {
+	Token string `validate:"required,max=255"`
+}
+
+type emailInputV1 struct {
+	Email string `validate:"required,email,max=255"`
+}
+
+type passwordResetInputV1 struct {
+	Token    string `validate:"required,max=255"`
+	Password string `validate:"required,min=8,max=72"`
+}
+
+// expandedBookV1 is a book with the fields of its expansions added.
+type expandedBookV1 struct {
+	domain.Book
+	Series *domain.SeriesPosition `json:",omitempty"`
+}
+
+type creditInputV1 struct {
+	AuthorId int64  `validate:"required"`
+	Role     string `validate:"required,oneof=author|editor|translator|illustrator"`
+}
+
+func (v v1Mapper) Version() string {
+	return "v1"
+}
+
+func (v v1Mapper) Book(book domain.Book) interface{} {
+	return book
+}
+
+func (v v1Mapper) Books(books []domain.Book) interface{} {
+	return books
+}
+
+func (v v1Mapper) ApiError(apiError domain.ApiError) interface{} {
+	return apiError
+}
+
+func (v v1Mapper) DuplicateClusters(clusters []domain.DuplicateCluster) interface{} {
+	return clusters
+}
+
+func (v v1Mapper) Author(author domain.Author) interface{} {
+	return author
+}
+
+func (v v1Mapper) Authors(authors []domain.Author) interface{} {
+	return authors
+}
+
+func (v v1Mapper) Credits(credits []domain.Credit) interface{} {
+	return credits
+}
+
+func (v v1Mapper) Series(series domain.Series) interface{} {
+	return series
+}
+
+func (v v1Mapper) SeriesList(series []domain.Series) interface{} {
+	return series
+}
+
+func (v v1Mapper) Collection(collection domain.Collection) interface{} {
+	return collection
+}
+
+func (v v1Mapper) Collections(collections []domain.Collection) interface{} {
+	return collections
+}
+
+func (v v1Mapper) Entries(entries []domain.Entry) interface{} {
+	return entries
+}
+
+func (v v1Mapper) ExpandedBook(book domain.Book, series *domain.SeriesPosition) interface{} {
+	return expandedBookV1{Book: book, Series: series}
+}
+
+func (v v1Mapper) Subject(subject domain.Subject) interface{} {
+	return subject
+}
+
+func (v v1Mapper) Subjects(subjects []domain.Subject) interface{} {
+	return subjects
+}
+
+func (v v1Mapper) SubjectImport(imported domain.SubjectImport) interface{} {
+	return imported
+}
+
+func (v v1Mapper) Cover(cover domain.Cover) interface{} {
+	return cover
+}
+
+func (v v1Mapper) Attachment(attachment domain.Attachment) interface{} {
+	return attachment
+}
+
+func (v v1Mapper) Attachments(attachments []domain.Attachment) interface{} {
+	return attachments
+}
+
+func (v v1Mapper) AttachmentUpload(upload domain.AttachmentUpload) interface{} {
+	if upload.Mismatches == nil {
+		upload.Mismatches = []domain.Mismatch{}
+	}
+	return upload
+}
+
+func (v v1Mapper) EditionMetadata(metadata domain.EditionMetadata) interface{} {
+	return metadata
+}
+
+func (v v1Mapper) DigitalLoan(loan domain.DigitalLoan) interface{} {
+	return loan
+}
+
+func (v v1Mapper) DownloadLink(link domain.DownloadLink) interface{} {
+	return link
+}
+
+func (v v1Mapper) Copy(copy domain.Copy) interface{} {
+	return copy
+}
+
+func (v v1Mapper) Copies(copies []domain.Copy) interface{} {
+	return copies
+}
+
+func (v v1Mapper) Member(member domain.Member) interface{} {
+	return member
+}
+
+func (v v1Mapper) Members(members []domain.Member) interface{} {
+	return members
+}
+
+func (v v1Mapper) Loan(loan domain.Loan) interface{} {
+	return loan
+}
+
+func (v v1Mapper) LoanReturn(loanReturn domain.LoanReturn) interface{} {
+	return loanReturn
+}
+
+func (v v1Mapper) Account(account domain.Account) interface{} {
+	return account
+}
+
+func (v v1Mapper) Payment(payment domain.Payment) interface{} {
+	return payment
+}
+
+func (v v1Mapper) NotificationPreferences(preferences domain.NotificationPreferences) interface{} {
+	return preferences
+}
+
+func (v v1Mapper) Notifications(notifications []domain.Notification) interface{} {
+	return notifications
+}
+
+func (v v1Mapper) Loans(loans []domain.Loan) interface{} {
+	return loans
+}
+
+func (v v1Mapper) Hold(hold domain.Hold) interface{} {
+	return hold
+}
+
+func (v v1Mapper) Profile(profile domain.Profile) interface{} {
+	return profile
+}
+
+func (v v1Mapper) Session(session domain.Session) interface{} {
+	return session
+}
+
+func (v v1Mapper) BookDetails(details domain.BookDetails) interface{} {
+	return details
+}
+
+func (v v1Mapper) NewBookInput() BookInput {
+	return &bookInputV1{}
+}
+
+func (b *bookInputV1) Book() domain.Book {
+	return domain.Book{Name: b.Name, Author: b.Author, Isbn: b.Isbn, Publisher: b.Publisher, Year: b.Year, Pages: b.Pages}
+}
+
+func (v v1Mapper) NewMergeInput() MergeInput {
+	return &mergeInputV1{}
+}
+
+func (m *mergeInputV1) BookMerge() domain.BookMerge {
+	return domain.BookMerge(*m)
+}
+
+func (v v1Mapper) NewAuthorInput() AuthorInput {
+	return &authorInputV1{}
+}
+
+func (a *authorInputV1) Author() domain.Author {
+	return domain.Author{Name: a.Name}
+}
+
+func (v v1Mapper) NewCreditsInput() CreditsInput {
+	return &creditsInputV1{}
+}
+
+func (c *creditsInputV1) BookCredits() []domain.Credit {
+	credits := make([]domain.Credit, len(c.Credits))
+	for i, credit := range c.Credits {
+		credits[i] = domain.Credit{AuthorId: credit.AuthorId, Role: credit.Role}
+	}
+	return credits
+}
+
+func (v v1Mapper) NewSeriesInput() SeriesInput {
+	return &seriesInputV1{}
+}
+
+func (s *seriesInputV1) Series() domain.Series {
+	return domain.Series{Name: s.Name}
+}
+
+func (v v1Mapper) NewCollectionInput() CollectionInput {
+	return &collectionInputV1{}
+}
+
+func (c *collectionInputV1) Collection() domain.Collection {
+	return newCollection(c.Name, c.Kind, c.Description)
+}
+
+func (v v1Mapper) NewEntriesInput() EntriesInput {
+	return &entriesInputV1{}
+}
+
+func (e *entriesInputV1) BookIds() []int64 {
+	return e.Books
+}
+
+func (v v1Mapper) NewEntryInput() EntryInput {
+	return &entryInputV1{}
+}
+
+func (e *entryInputV1) Entry() domain.Entry {
+	return domain.Entry{Position: e.Position, Book: domain.Book{Id: e.BookId}}
+}
+
+func (v v1Mapper) NewSubjectInput() SubjectInput {
+	return &subjectInputV1{}
+}
+
+func (s *subjectInputV1) Subject() domain.Subject {
+	return domain.Subject{Name: s.Name, Code: s.Code, ParentId: s.ParentId}
+}
+
+func (v v1Mapper) NewSubjectsInput() SubjectsInput {
+	return &subjectsInputV1{}
+}
+
+func (s *subjectsInputV1) SubjectIds() []int64 {
+	return s.Subjects
+}
+
+func (v v1Mapper) NewBorrowerInput() BorrowerInput {
+	return &borrowerInputV1{}
+}
+
+func (b *borrowerInputV1) Borrower() int64 {
+	return b.MemberId
+}
+
+func (v v1Mapper) NewLabelsInput() LabelsInput {
+	return &labelsInputV1{}
+}
+
+func (l *labelsInputV1) CopyIds() []int64 {
+	return l.Copies
+}
+
+func (v v1Mapper) NewCopyInput() CopyInput {
+	return &copyInputV1{}
+}
+
+func (c *copyInputV1) Copy() domain.Copy {
+	return domain.Copy{Barcode: c.Barcode, ItemType: c.ItemType}
+}
+
+func (v v1Mapper) NewLoanInput() LoanInput {
+	return &loanInputV1{}
+}
+
+func (l *loanInputV1) Loan() domain.Loan {
+	return domain.Loan{CopyId: l.CopyId, MemberId: l.MemberId}
+}
+
+func (v v1Mapper) NewPaymentInput() PaymentInput {
+	return &paymentInputV1{}
+}
+
+func (p *paymentInputV1) Payment() domain.Payment {
+	return newPayment(p.Kind, p.Amount, p.Note)
+}
+
+func (v v1Mapper) NewPreferencesInput() PreferencesInput {
+	return &preferencesInputV1{}
+}
+
+func (p *preferencesInputV1) NotificationPreferences() domain.NotificationPreferences {
+	return domain.NotificationPreferences{DueSoon: p.DueSoon, Overdue: p.Overdue, HoldReady: p.HoldReady}
+}
+
+func (v v1Mapper) NewHoldInput() HoldInput {
+	return &holdInputV1{}
+}
+
+func (h *holdInputV1) Hold() domain.Hold {
+	return domain.Hold{BookId: h.BookId}
+}
+
+func (v v1Mapper) NewRegistrationInput() RegistrationInput {
+	return &registrationInputV1{}
+}
+
+func (r *registrationInputV1) Registration() domain.Registration {
+	return domain.Registration{Name: r.Name, Email: r.Email, Password: r.Password}
+}
+
+func (v v1Mapper) NewLoginInput() LoginInput {
+	return &loginInputV1{}
+}
+
+func (l *loginInputV1) Login() domain.Login {
+	return domain.Login{Email: l.Email, Password: l.Password}
+}
+
+func (v v1Mapper) NewTokenInput() TokenInput {
+	return &tokenInputV1{}
+}
+
+func (t *tokenInputV1) EmailToken() string {
+	return t.Token
+}
+
+func (v v1Mapper) NewEmailInput() EmailInput {
+	return &emailInputV1{}
+}
+
+func (e *emailInputV1) Address() string {
+	return e.Email
+}
+
+func (v v1Mapper) NewPasswordResetInput() PasswordResetInput {
+	return &passwordResetInputV1{}
+}
+
+func (p *passwordResetInputV1) PasswordReset() domain.PasswordReset {
+	return domain.PasswordReset{Token: p.Token, Password: p.Password}
+}
+
+// newPayment is a payment of kind, a payment unless it is given.
+func newPayment(kind string, amount int64, note string) domain.Payment {
+	if kind == "" {
+		kind = domain.PaymentPaid
+	}
+	return domain.Payment{Kind: kind, Amount: amount, Note: note}
+}
+
+func newCollection(name string, kind string, description string) domain.Collection {
+	if kind == "" {
+		kind = domain.KindCollection
+	}
+	return domain.Collection{Name: name, Kind: kind, Description: description}
+}
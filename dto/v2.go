@@ -0,0 +1,891 @@
+package dto
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"time"
+)
+
+// V2 uses lower camel case field names, calls the name of a book its title and wraps
+// lists in an object so metadata can be added without breaking clients.
+var V2 Mapper = v2Mapper{}
+
+type v2Mapper struct{}
+
+type bookV2 struct {
+	Id        int64  `json:"id"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	Isbn      string `json:"isbn,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	Year      int    `json:"year,omitempty"`
+	Pages     int    `json:"pages,omitempty"`
+}
+
+type booksV2 struct {
+	Items []bookV2 `json:"items"`
+}
+
+type bookInputV2 struct {
+	Title     string `json:"title" validate:"required,max=255"`
+	Author    string `json:"author" validate:"required,max=255"`
+	Isbn      string `json:"isbn" validate:"isbn"`
+	Publisher string `json:"publisher" validate:"max=255"`
+	Year      int    `json:"year" validate:"year"`
+	Pages     int    `json:"pages" validate:"min=1,max=100000"`
+}
+
+type duplicateClusterV2 struct {
+	Books   []bookV2 `json:"books"`
+	Reasons []string `json:"reasons"`
+	Score   float64  `json:"score"`
+}
+
+type duplicateClustersV2 struct {
+	Items []duplicateClusterV2 `json:"items"`
+}
+
+type mergeInputV2 struct {
+	Target  int64   `json:"target" validate:"required"`
+	Sources []int64 `json:"sources" validate:"required,max=100"`
+}
+
+type authorV2 struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type authorsV2 struct {
+	Items []authorV2 `json:"items"`
+}
+
+type creditV2 struct {
+	AuthorId int64  `json:"authorId"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Position int    `json:"position"`
+}
+
+type creditsV2 struct {
+	Items []creditV2 `json:"items"`
+}
+
+type authorInputV2 struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type creditsInputV2 struct {
+	Credits []creditInputV2 `json:"credits" validate:"required,max=50,dive"`
+}
+
+type creditInputV2 struct {
+	AuthorId int64  `json:"authorId" validate:"required"`
+	Role     string `json:"role" validate:"required,oneof=author|editor|translator|illustrator"`
+}
+
+type seriesV2 struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type seriesListV2 struct {
+	Items []seriesV2 `json:"items"`
+}
+
+type collectionV2 struct {
+	Id          int64  `json:"id"`
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Description string `json:"description,omitempty"`
+}
+
+type collectionsV2 struct {
+	Items []collectionV2 `json:"items"`
+}
+
+type entryV2 struct {
+	Position int    `json:"position"`
+	Book     bookV2 `json:"book"`
+}
+
+type entriesV2 struct {
+	Items []entryV2 `json:"items"`
+}
+
+// expandedBookV2 is a book with the fields of its expansions added.
+type expandedBookV2 struct {
+	bookV2
+	Series *seriesPositionV2 `json:"series,omitempty"`
+}
+
+type seriesPositionV2 struct {
+	Id       int64   `json:"id"`
+	Name     string  `json:"name"`
+	Position int     `json:"position"`
+	Previous *bookV2 `json:"previous,omitempty"`
+	Next     *bookV2 `json:"next,omitempty"`
+}
+
+type seriesInputV2 struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type collectionInputV2 struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Kind        string `json:"kind" validate:"oneof=collection|shelf"`
+	Description string `json:"description" decode:"longtext" validate:"max=2000"`
+}
+
+type entriesInputV2 struct {
+	Books []int64 `json:"books" validate:"required,max=1000"`
+}
+
+type entryInputV2 struct {
+	BookId   int64 `json:"bookId" validate:"required"`
+	Position int   `json:"position" validate:"min=1"`
+}
+
+type subjectV2 struct {
+	Id       int64       `json:"id"`
+	Name     string      `json:"name"`
+	Code     string      `json:"code,omitempty"`
+	ParentId int64       `json:"parentId,omitempty"`
+	Children []subjectV2 `json:"children,omitempty"`
+}
+
+type subjectsV2 struct {
+	Items []subjectV2 `json:"items"`
+}
+
+type subjectImportV2 struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+}
+
+type subjectInputV2 struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	Code     string `json:"code" validate:"max=50"`
+	ParentId int64  `json:"parentId"`
+}
+
+type subjectsInputV2 struct {
+	Subjects []int64 `json:"subjects" validate:"max=100"`
+}
+
+type coverV2 struct {
+	BookId      int64     `json:"bookId"`
+	ContentType string    `json:"contentType"`
+	Digest      string    `json:"digest"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Bytes       int64     `json:"bytes"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type attachmentV2 struct {
+	Id          int64             `json:"id"`
+	BookId      int64             `json:"bookId"`
+	Format      string            `json:"format"`
+	ContentType string            `json:"contentType"`
+	Digest      string            `json:"digest"`
+	Bytes       int64             `json:"bytes"`
+	Metadata    editionMetadataV2 `json:"metadata"`
+	UploadedAt  time.Time         `json:"uploadedAt"`
+}
+
+type attachmentsV2 struct {
+	Items []attachmentV2 `json:"items"`
+}
+
+type editionMetadataV2 struct {
+	Title    string `json:"title,omitempty"`
+	Author   string `json:"author,omitempty"`
+	Isbn     string `json:"isbn,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+type attachmentUploadV2 struct {
+	Attachment attachmentV2 `json:"attachment"`
+	Mismatches []mismatchV2 `json:"mismatches"`
+}
+
+type mismatchV2 struct {
+	Field   string `json:"field"`
+	Book    string `json:"book"`
+	Edition string `json:"edition"`
+}
+
+type digitalLoanV2 struct {
+	Id         int64      `json:"id"`
+	BookId     int64      `json:"bookId"`
+	MemberId   int64      `json:"memberId"`
+	LoanedAt   time.Time  `json:"loanedAt"`
+	DueAt      time.Time  `json:"dueAt"`
+	ReturnedAt *time.Time `json:"returnedAt,omitempty"`
+}
+
+type downloadLinkV2 struct {
+	Url       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type bookDetailsV2 struct {
+	Isbn      string    `json:"isbn"`
+	Title     string    `json:"title,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Publisher string    `json:"publisher,omitempty"`
+	Year      int       `json:"year,omitempty"`
+	Pages     int       `json:"pages,omitempty"`
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+type borrowerInputV2 struct {
+	MemberId int64 `json:"memberId" validate:"required"`
+}
+
+type labelsInputV2 struct {
+	Copies []int64 `json:"copies" validate:"required,max=1000"`
+}
+
+type copyV2 struct {
+	Id       int64  `json:"id"`
+	BookId   int64  `json:"bookId"`
+	Barcode  string `json:"barcode"`
+	Status   string `json:"status"`
+	ItemType string `json:"itemType"`
+}
+
+type copiesV2 struct {
+	Items []copyV2 `json:"items"`
+}
+
+type memberV2 struct {
+	Id    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type membersV2 struct {
+	Items []memberV2 `json:"items"`
+}
+
+type loanV2 struct {
+	Id         int64      `json:"id"`
+	CopyId     int64      `json:"copyId"`
+	MemberId   int64      `json:"memberId"`
+	LoanedAt   time.Time  `json:"loanedAt"`
+	DueAt      time.Time  `json:"dueAt"`
+	ReturnedAt *time.Time `json:"returnedAt,omitempty"`
+	Renewals   int        `json:"renewals"`
+}
+
+type loanReturnV2 struct {
+	Loan loanV2  `json:"loan"`
+	Fine *fineV2 `json:"fine,omitempty"`
+}
+
+type fineV2 struct {
+	Id          int64     `json:"id"`
+	LoanId      int64     `json:"loanId"`
+	MemberId    int64     `json:"memberId"`
+	Amount      int64     `json:"amount"`
+	OverdueDays int       `json:"overdueDays"`
+	AssessedAt  time.Time `json:"assessedAt"`
+}
+
+type paymentV2 struct {
+	Id       int64     `json:"id"`
+	MemberId int64     `json:"memberId"`
+	Kind     string    `json:"kind"`
+	Amount   int64     `json:"amount"`
+	Note     string    `json:"note,omitempty"`
+	PaidAt   time.Time `json:"paidAt"`
+}
+
+type accountV2 struct {
+	MemberId int64       `json:"memberId"`
+	Balance  int64       `json:"balance"`
+	Fines    []fineV2    `json:"fines"`
+	Payments []paymentV2 `json:"payments"`
+}
+
+type copyInputV2 struct {
+	Barcode  string `json:"barcode" validate:"required,max=255"`
+	ItemType string `json:"itemType" validate:"max=50"`
+}
+
+type loanInputV2 struct {
+	CopyId   int64 `json:"copyId" validate:"required"`
+	MemberId int64 `json:"memberId" validate:"required"`
+}
+
+type paymentInputV2 struct {
+	Kind   string `json:"kind" validate:"oneof=payment|waiver"`
+	Amount int64  `json:"amount" validate:"required,min=1,max=100000000"`
+	Note   string `json:"note" validate:"max=255"`
+}
+
+type notificationPreferencesV2 struct {
+	MemberId  int64 `json:"memberId"`
+	DueSoon   bool  `json:"dueSoon"`
+	Overdue   bool  `json:"overdue"`
+	HoldReady bool  `json:"holdReady"`
+}
+
+type notificationV2 struct {
+	Id        int64     `json:"id"`
+	MemberId  int64     `json:"memberId"`
+	Event     string    `json:"event"`
+	Reference string    `json:"reference"`
+	Email     string    `json:"email"`
+	Subject   string    `json:"subject"`
+	SentAt    time.Time `json:"sentAt"`
+}
+
+type notificationsV2 struct {
+	Items []notificationV2 `json:"items"`
+}
+
+type preferencesInputV2 struct {
+	DueSoon   bool `json:"dueSoon"`
+	Overdue   bool `json:"overdue"`
+	HoldReady bool `json:"holdReady"`
+}
+
+type loansV2 struct {
+	Items []loanV2 `json:"items"`
+}
+
+type holdV2 struct {
+	Id       int64     `json:"id"`
+	BookId   int64     `json:"bookId"`
+	MemberId int64     `json:"memberId"`
+	PlacedAt time.Time `json:"placedAt"`
+}
+
+type profileV2 struct {
+	Id       int64  `json:"id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+}
+
+type sessionV2 struct {
+	Token     string    `json:"token"`
+	MemberId  int64     `json:"memberId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type holdInputV2 struct {
+	BookId int64 `json:"bookId" validate:"required"`
+}
+
+type registrationInputV2 struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+type loginInputV2 struct {
+	Email    string `json:"email" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type tokenInputV2 struct {
+	Token string `json:"token" validate:"required,max=255"`
+}
+
+type emailInputV2 struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type passwordResetInputV2 struct {
+	Token    string `json:"token" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+type apiErrorV2 struct {
+	Status     int           `json:"status"`
+	Message    string        `json:"message"`
+	Violations []violationV2 `json:"violations"`
+}
+
+type violationV2 struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (v v2Mapper) Version() string {
+	return "v2"
+}
+
+func (v v2Mapper) Book(book domain.Book) interface{} {
+	return bookV2{Id: book.Id, Title: book.Name, Author: book.Author, Isbn: book.Isbn, Publisher: book.Publisher,
+		Year: book.Year, Pages: book.Pages}
+}
+
+func (v v2Mapper) Books(books []domain.Book) interface{} {
+	items := make([]bookV2, 0, len(books))
+	for _, book := range books {
+		items = append(items, v.Book(book).(bookV2))
+	}
+	return booksV2{Items: items}
+}
+
+func (v v2Mapper) ApiError(apiError domain.ApiError) interface{} {
+	violations := make([]violationV2, 0, len(apiError.Violations))
+	for _, violation := range apiError.Violations {
+		violations = append(violations, violationV2{Field: violation.Field, Message: violation.Message})
+	}
+	return apiErrorV2{Status: apiError.Status, Message: apiError.Message, Violations: violations}
+}
+
+func (v v2Mapper) DuplicateClusters(clusters []domain.DuplicateCluster) interface{} {
+	items := make([]duplicateClusterV2, 0, len(clusters))
+	for _, cluster := range clusters {
+		books := v.Books(cluster.Books).(booksV2).Items
+		items = append(items, duplicateClusterV2{Books: books, Reasons: cluster.Reasons, Score: cluster.Score})
+	}
+	return duplicateClustersV2{Items: items}
+}
+
+func (v v2Mapper) Author(author domain.Author) interface{} {
+	return authorV2{Id: author.Id, Name: author.Name}
+}
+
+func (v v2Mapper) Authors(authors []domain.Author) interface{} {
+	items := make([]authorV2, 0, len(authors))
+	for _, author := range authors {
+		items = append(items, v.Author(author).(authorV2))
+	}
+	return authorsV2{Items: items}
+}
+
+func (v v2Mapper) Credits(credits []domain.Credit) interface{} {
+	items := make([]creditV2, 0, len(credits))
+	for _, credit := range credits {
+		items = append(items, creditV2{AuthorId: credit.AuthorId, Name: credit.Name, Role: credit.Role, Position: credit.Position})
+	}
+	return creditsV2{Items: items}
+}
+
+func (v v2Mapper) Series(series domain.Series) interface{} {
+	return seriesV2{Id: series.Id, Name: series.Name}
+}
+
+func (v v2Mapper) SeriesList(series []domain.Series) interface{} {
+	items := make([]seriesV2, 0, len(series))
+	for _, s := range series {
+		items = append(items, v.Series(s).(seriesV2))
+	}
+	return seriesListV2{Items: items}
+}
+
+func (v v2Mapper) Collection(collection domain.Collection) interface{} {
+	return collectionV2{Id: collection.Id, Name: collection.Name, Kind: collection.Kind, Description: collection.Description}
+}
+
+func (v v2Mapper) Collections(collections []domain.Collection) interface{} {
+	items := make([]collectionV2, 0, len(collections))
+	for _, collection := range collections {
+		items = append(items, v.Collection(collection).(collectionV2))
+	}
+	return collectionsV2{Items: items}
+}
+
+func (v v2Mapper) Entries(entries []domain.Entry) interface{} {
+	items := make([]entryV2, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, entryV2{Position: entry.Position, Book: v.Book(entry.Book).(bookV2)})
+	}
+	return entriesV2{Items: items}
+}
+
+func (v v2Mapper) ExpandedBook(book domain.Book, series *domain.SeriesPosition) interface{} {
+	expanded := expandedBookV2{bookV2: v.Book(book).(bookV2)}
+	if series != nil {
+		expanded.Series = &seriesPositionV2{
+			Id:       series.Series.Id,
+			Name:     series.Series.Name,
+			Position: series.Position,
+			Previous: v.optionalBook(series.Previous),
+			Next:     v.optionalBook(series.Next),
+		}
+	}
+	return expanded
+}
+
+func (v v2Mapper) Subject(subject domain.Subject) interface{} {
+	mapped := subjectV2{Id: subject.Id, Name: subject.Name, Code: subject.Code, ParentId: subject.ParentId}
+	for _, child := range subject.Children {
+		mapped.Children = append(mapped.Children, v.Subject(child).(subjectV2))
+	}
+	return mapped
+}
+
+func (v v2Mapper) Subjects(subjects []domain.Subject) interface{} {
+	items := make([]subjectV2, 0, len(subjects))
+	for _, subject := range subjects {
+		items = append(items, v.Subject(subject).(subjectV2))
+	}
+	return subjectsV2{Items: items}
+}
+
+func (v v2Mapper) SubjectImport(imported domain.SubjectImport) interface{} {
+	return subjectImportV2{Added: imported.Added, Updated: imported.Updated}
+}
+
+func (v v2Mapper) Cover(cover domain.Cover) interface{} {
+	return coverV2{
+		BookId:      cover.BookId,
+		ContentType: cover.ContentType,
+		Digest:      cover.Digest,
+		Width:       cover.Width,
+		Height:      cover.Height,
+		Bytes:       cover.Bytes,
+		UpdatedAt:   cover.UpdatedAt,
+	}
+}
+
+func (v v2Mapper) Attachment(attachment domain.Attachment) interface{} {
+	metadata := attachment.Metadata
+	return attachmentV2{
+		Id:          attachment.Id,
+		BookId:      attachment.BookId,
+		Format:      attachment.Format,
+		ContentType: attachment.ContentType,
+		Digest:      attachment.Digest,
+		Bytes:       attachment.Bytes,
+		Metadata:    v.EditionMetadata(metadata).(editionMetadataV2),
+		UploadedAt:  attachment.UploadedAt,
+	}
+}
+
+func (v v2Mapper) Attachments(attachments []domain.Attachment) interface{} {
+	items := make([]attachmentV2, 0, len(attachments))
+	for _, attachment := range attachments {
+		items = append(items, v.Attachment(attachment).(attachmentV2))
+	}
+	return attachmentsV2{Items: items}
+}
+
+func (v v2Mapper) AttachmentUpload(upload domain.AttachmentUpload) interface{} {
+	mismatches := make([]mismatchV2, 0, len(upload.Mismatches))
+	for _, mismatch := range upload.Mismatches {
+		mismatches = append(mismatches, mismatchV2{Field: mismatch.Field, Book: mismatch.Book, Edition: mismatch.Edition})
+	}
+	return attachmentUploadV2{Attachment: v.Attachment(upload.Attachment).(attachmentV2), Mismatches: mismatches}
+}
+
+func (v v2Mapper) EditionMetadata(metadata domain.EditionMetadata) interface{} {
+	return editionMetadataV2{Title: metadata.Title, Author: metadata.Author, Isbn: metadata.Isbn, Language: metadata.Language}
+}
+
+func (v v2Mapper) DigitalLoan(loan domain.DigitalLoan) interface{} {
+	return digitalLoanV2{
+		Id:         loan.Id,
+		BookId:     loan.BookId,
+		MemberId:   loan.MemberId,
+		LoanedAt:   loan.LoanedAt,
+		DueAt:      loan.DueAt,
+		ReturnedAt: loan.ReturnedAt,
+	}
+}
+
+func (v v2Mapper) DownloadLink(link domain.DownloadLink) interface{} {
+	return downloadLinkV2{Url: link.Url, ExpiresAt: link.ExpiresAt}
+}
+
+func (v v2Mapper) Copy(copy domain.Copy) interface{} {
+	return copyV2{Id: copy.Id, BookId: copy.BookId, Barcode: copy.Barcode, Status: copy.Status, ItemType: copy.ItemType}
+}
+
+func (v v2Mapper) Copies(copies []domain.Copy) interface{} {
+	items := make([]copyV2, 0, len(copies))
+	for _, copy := range copies {
+		items = append(items, v.Copy(copy).(copyV2))
+	}
+	return copiesV2{Items: items}
+}
+
+func (v v2Mapper) Member(member domain.Member) interface{} {
+	return memberV2{Id: member.Id, Name: member.Name, Email: member.Email}
+}
+
+func (v v2Mapper) Members(members []domain.Member) interface{} {
+	items := make([]memberV2, 0, len(members))
+	for _, member := range members {
+		items = append(items, v.Member(member).(memberV2))
+	}
+	return membersV2{Items: items}
+}
+
+func (v v2Mapper) Loan(loan domain.Loan) interface{} {
+	return loanV2{
+		Id:         loan.Id,
+		CopyId:     loan.CopyId,
+		MemberId:   loan.MemberId,
+		LoanedAt:   loan.LoanedAt,
+		DueAt:      loan.DueAt,
+		ReturnedAt: loan.ReturnedAt,
+		Renewals:   loan.Renewals,
+	}
+}
+
+func (v v2Mapper) LoanReturn(loanReturn domain.LoanReturn) interface{} {
+	mapped := loanReturnV2{Loan: v.Loan(loanReturn.Loan).(loanV2)}
+	if loanReturn.Fine != nil {
+		fine := v.fine(*loanReturn.Fine)
+		mapped.Fine = &fine
+	}
+	return mapped
+}
+
+func (v v2Mapper) Account(account domain.Account) interface{} {
+	mapped := accountV2{MemberId: account.MemberId, Balance: account.Balance,
+		Fines: make([]fineV2, 0, len(account.Fines)), Payments: make([]paymentV2, 0, len(account.Payments))}
+	for _, fine := range account.Fines {
+		mapped.Fines = append(mapped.Fines, v.fine(fine))
+	}
+	for _, payment := range account.Payments {
+		mapped.Payments = append(mapped.Payments, v.Payment(payment).(paymentV2))
+	}
+	return mapped
+}
+
+func (v v2Mapper) Payment(payment domain.Payment) interface{} {
+	return paymentV2{Id: payment.Id, MemberId: payment.MemberId, Kind: payment.Kind, Amount: payment.Amount,
+		Note: payment.Note, PaidAt: payment.PaidAt}
+}
+
+func (v v2Mapper) NotificationPreferences(preferences domain.NotificationPreferences) interface{} {
+	return notificationPreferencesV2{MemberId: preferences.MemberId, DueSoon: preferences.DueSoon, Overdue: preferences.Overdue,
+		HoldReady: preferences.HoldReady}
+}
+
+func (v v2Mapper) Notifications(notifications []domain.Notification) interface{} {
+	items := make([]notificationV2, 0, len(notifications))
+	for _, notification := range notifications {
+		items = append(items, notificationV2{Id: notification.Id, MemberId: notification.MemberId, Event: notification.Event,
+			Reference: notification.Reference, Email: notification.Email, Subject: notification.Subject, SentAt: notification.SentAt})
+	}
+	return notificationsV2{Items: items}
+}
+
+func (v v2Mapper) Loans(loans []domain.Loan) interface{} {
+	items := make([]loanV2, 0, len(loans))
+	for _, loan := range loans {
+		items = append(items, v.Loan(loan).(loanV2))
+	}
+	return loansV2{Items: items}
+}
+
+func (v v2Mapper) Hold(hold domain.Hold) interface{} {
+	return holdV2{Id: hold.Id, BookId: hold.BookId, MemberId: hold.MemberId, PlacedAt: hold.PlacedAt}
+}
+
+func (v v2Mapper) Profile(profile domain.Profile) interface{} {
+	return profileV2{Id: profile.Id, Name: profile.Name, Email: profile.Email, Verified: profile.Verified}
+}
+
+func (v v2Mapper) Session(session domain.Session) interface{} {
+	return sessionV2{Token: session.Token, MemberId: session.MemberId, ExpiresAt: session.ExpiresAt}
+}
+
+func (v v2Mapper) fine(fine domain.Fine) fineV2 {
+	return fineV2{Id: fine.Id, LoanId: fine.LoanId, MemberId: fine.MemberId, Amount: fine.Amount,
+		OverdueDays: fine.OverdueDays, AssessedAt: fine.AssessedAt}
+}
+
+func (v v2Mapper) BookDetails(details domain.BookDetails) interface{} {
+	return bookDetailsV2{Isbn: details.Isbn, Title: details.Title, Author: details.Author, Publisher: details.Publisher,
+		Year: details.Year, Pages: details.Pages, Source: details.Source, FetchedAt: details.FetchedAt}
+}
+
+func (v v2Mapper) NewBookInput() BookInput {
+	return &bookInputV2{}
+}
+
+func (b *bookInputV2) Book() domain.Book {
+	return domain.Book{Name: b.Title, Author: b.Author, Isbn: b.Isbn, Publisher: b.Publisher, Year: b.Year, Pages: b.Pages}
+}
+
+func (v v2Mapper) NewMergeInput() MergeInput {
+	return &mergeInputV2{}
+}
+
+func (m *mergeInputV2) BookMerge() domain.BookMerge {
+	return domain.BookMerge{Target: m.Target, Sources: m.Sources}
+}
+
+func (v v2Mapper) NewAuthorInput() AuthorInput {
+	return &authorInputV2{}
+}
+
+func (a *authorInputV2) Author() domain.Author {
+	return domain.Author{Name: a.Name}
+}
+
+func (v v2Mapper) NewCreditsInput() CreditsInput {
+	return &creditsInputV2{}
+}
+
+func (c *creditsInputV2) BookCredits() []domain.Credit {
+	credits := make([]domain.Credit, len(c.Credits))
+	for i, credit := range c.Credits {
+		credits[i] = domain.Credit{AuthorId: credit.AuthorId, Role: credit.Role}
+	}
+	return credits
+}
+
+func (v v2Mapper) NewSeriesInput() SeriesInput {
+	return &seriesInputV2{}
+}
+
+func (s *seriesInputV2) Series() domain.Series {
+	return domain.Series{Name: s.Name}
+}
+
+func (v v2Mapper) NewCollectionInput() CollectionInput {
+	return &collectionInputV2{}
+}
+
+func (c *collectionInputV2) Collection() domain.Collection {
+	return newCollection(c.Name, c.Kind, c.Description)
+}
+
+func (v v2Mapper) NewEntriesInput() EntriesInput {
+	return &entriesInputV2{}
+}
+
+func (e *entriesInputV2) BookIds() []int64 {
+	return e.Books
+}
+
+func (v v2Mapper) NewEntryInput() EntryInput {
+	return &entryInputV2{}
+}
+
+func (e *entryInputV2) Entry() domain.Entry {
+	return domain.Entry{Position: e.Position, Book: domain.Book{Id: e.BookId}}
+}
+
+func (v v2Mapper) NewSubjectInput() SubjectInput {
+	return &subjectInputV2{}
+}
+
+func (s *subjectInputV2) Subject() domain.Subject {
+	return domain.Subject{Name: s.Name, Code: s.Code, ParentId: s.ParentId}
+}
+
+func (v v2Mapper) NewSubjectsInput() SubjectsInput {
+	return &subjectsInputV2{}
+}
+
+func (s *subjectsInputV2) SubjectIds() []int64 {
+	return s.Subjects
+}
+
+func (v v2Mapper) NewBorrowerInput() BorrowerInput {
+	return &borrowerInputV2{}
+}
+
+func (b *borrowerInputV2) Borrower() int64 {
+	return b.MemberId
+}
+
+func (v v2Mapper) NewLabelsInput() LabelsInput {
+	return &labelsInputV2{}
+}
+
+func (l *labelsInputV2) CopyIds() []int64 {
+	return l.Copies
+}
+
+func (v v2Mapper) NewCopyInput() CopyInput {
+	return &copyInputV2{}
+}
+
+func (c *copyInputV2) Copy() domain.Copy {
+	return domain.Copy{Barcode: c.Barcode, ItemType: c.ItemType}
+}
+
+func (v v2Mapper) NewLoanInput() LoanInput {
+	return &loanInputV2{}
+}
+
+func (l *loanInputV2) Loan() domain.Loan {
+	return domain.Loan{CopyId: l.CopyId, MemberId: l.MemberId}
+}
+
+func (v v2Mapper) NewPaymentInput() PaymentInput {
+	return &paymentInputV2{}
+}
+
+func (p *paymentInputV2) Payment() domain.Payment {
+	return newPayment(p.Kind, p.Amount, p.Note)
+}
+
+func (v v2Mapper) NewPreferencesInput() PreferencesInput {
+	return &preferencesInputV2{}
+}
+
+func (p *preferencesInputV2) NotificationPreferences() domain.NotificationPreferences {
+	return domain.NotificationPreferences{DueSoon: p.DueSoon, Overdue: p.Overdue, HoldReady: p.HoldReady}
+}
+
+func (v v2Mapper) NewHoldInput() HoldInput {
+	return &holdInputV2{}
+}
+
+func (h *holdInputV2) Hold() domain.Hold {
+	return domain.Hold{BookId: h.BookId}
+}
+
+func (v v2Mapper) NewRegistrationInput() RegistrationInput {
+	return &registrationInputV2{}
+}
+
+func (r *registrationInputV2) Registration() domain.Registration {
+	return domain.Registration{Name: r.Name, Email: r.Email, Password: r.Password}
+}
+
+func (v v2Mapper) NewLoginInput() LoginInput {
+	return &loginInputV2{}
+}
+
+func (l *loginInputV2) Login() domain.Login {
+	return domain.Login{Email: l.Email, Password: l.Password}
+}
+
+func (v v2Mapper) NewTokenInput() TokenInput {
+	return &tokenInputV2{}
+}
+
+func (t *tokenInputV2) EmailToken() string {
+	return t.Token
+}
+
+func (v v2Mapper) NewEmailInput() EmailInput {
+	return &emailInputV2{}
+}
+
+func (e *emailInputV2) Address() string {
+	return e.Email
+}
+
+func (v v2Mapper) NewPasswordResetInput() PasswordResetInput {
+	return &passwordResetInputV2{}
+}
+
+func (p *passwordResetInputV2) PasswordReset() domain.PasswordReset {
+	return domain.PasswordReset{Token: p.Token, Password: p.Password}
+}
+
+func (v v2Mapper) optionalBook(book *domain.Book) *bookV2 {
+	if book == nil {
+		return nil
+	}
+	mapped := v.Book(*book).(bookV2)
+	return &mapped
+}
@@ -0,0 +1,325 @@
+package duplicates
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/validation"
+	"golang.org/x/text/unicode/norm"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	ReasonIsbn    = "isbn"
+	ReasonKey     = "title and author"
+	ReasonSimilar = "similar"
+
+	// Books are similar when both their titles and their authors are at least this
+	// similar, as measured by Jaro-Winkler.
+	titleThreshold  = 0.92
+	authorThreshold = 0.85
+	minTokenLength  = 3
+)
+
+var (
+	// invertedArticle matches titles filed under their first significant word, such as
+	// "Hobbit, The".
+	invertedArticle = regexp.MustCompile(`(?i)^(.*),\s*(the|a|an)$`)
+	leadingArticles = []string{"the ", "a ", "an "}
+)
+
+// Match is a book which is probably the same title as the one it was found for.
+type Match struct {
+	Book   domain.Book
+	Score  float64
+	Reason string
+}
+
+// entry is a book along with the keys it is compared by.
+type entry struct {
+	book   domain.Book
+	title  string
+	author string
+	isbn   string
+}
+
+// Find returns the books of catalogue which are probably the same title as book, best
+// matches first. The book itself, if it is part of catalogue, is not returned.
+func Find(book domain.Book, catalogue []domain.Book) []Match {
+	candidate := newEntry(book)
+	var matches []Match
+	for _, other := range catalogue {
+		if other.Id == book.Id {
+			continue
+		}
+		if score, reason, ok := compare(candidate, newEntry(other)); ok {
+			matches = append(matches, Match{Book: other, Score: score, Reason: reason})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
+
+// Clusters groups the books of catalogue which are probably the same title, linking two
+// books whenever they match. Only books sharing an ISBN, a title word or the last word
+// of their author are compared, which keeps large catalogues fast. Clusters are ordered
+// by their lowest book id.
+func Clusters(catalogue []domain.Book) []domain.DuplicateCluster {
+	entries := make([]entry, len(catalogue))
+	blocks := map[string][]int{}
+	for i, book := range catalogue {
+		entries[i] = newEntry(book)
+		for _, block := range blocksOf(entries[i]) {
+			blocks[block] = append(blocks[block], i)
+		}
+	}
+
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	type link struct {
+		score  float64
+		reason string
+	}
+	compared := map[[2]int]bool{}
+	links := map[[2]int]link{}
+	for _, members := range blocks {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				pair := [2]int{members[x], members[y]}
+				if compared[pair] {
+					continue
+				}
+				compared[pair] = true
+				if score, reason, ok := compare(entries[pair[0]], entries[pair[1]]); ok {
+					links[pair] = link{score, reason}
+					parent[find(pair[0])] = find(pair[1])
+				}
+			}
+		}
+	}
+
+	clusters := map[int]*domain.DuplicateCluster{}
+	for pair, link := range links {
+		cluster, found := clusters[find(pair[0])]
+		if !found {
+			cluster = &domain.DuplicateCluster{}
+			clusters[find(pair[0])] = cluster
+		}
+		if link.score > cluster.Score {
+			cluster.Score = link.score
+		}
+		if !contains(cluster.Reasons, link.reason) {
+			cluster.Reasons = append(cluster.Reasons, link.reason)
+		}
+	}
+	for i, e := range entries {
+		if cluster, found := clusters[find(i)]; found {
+			cluster.Books = append(cluster.Books, e.book)
+		}
+	}
+
+	result := make([]domain.DuplicateCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		sort.Slice(cluster.Books, func(i, j int) bool { return cluster.Books[i].Id < cluster.Books[j].Id })
+		sort.Strings(cluster.Reasons)
+		result = append(result, *cluster)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Books[0].Id < result[j].Books[0].Id })
+	return result
+}
+
+// SearchTerms returns the words of the title and the last word of the author of book, the
+// words which a book has to share with it, unless they share an ISBN, to be compared by
+// Clusters. Repositories use them to narrow down the catalogue for Find.
+func SearchTerms(book domain.Book) []string {
+	var terms []string
+	for _, block := range blocksOf(newEntry(book)) {
+		if parts := strings.SplitN(block, ":", 2); parts[0] != "isbn" {
+			terms = append(terms, parts[1])
+		}
+	}
+	return terms
+}
+
+// TitleKey normalises a title for comparison: accents, case, punctuation and leading
+// articles, also when filed after the title, are dropped.
+func TitleKey(title string) string {
+	title = strings.TrimSpace(title)
+	if parts := invertedArticle.FindStringSubmatch(title); parts != nil {
+		title = parts[1]
+	}
+
+	key := normalize(title)
+	for _, article := range leadingArticles {
+		if strings.HasPrefix(key, article) {
+			return strings.TrimPrefix(key, article)
+		}
+	}
+	return key
+}
+
+// AuthorKey normalises an author name for comparison, turning "Tolkien, J. R. R." and
+// "J.R.R. Tolkien" alike into "j r r tolkien".
+func AuthorKey(author string) string {
+	if parts := strings.SplitN(author, ",", 2); len(parts) == 2 {
+		author = parts[1] + " " + parts[0]
+	}
+	return normalize(author)
+}
+
+// JaroWinkler returns the similarity of a and b between 0, nothing in common, and 1, the
+// same, favouring strings which start alike.
+func JaroWinkler(a string, b string) float64 {
+	first, second := []rune(a), []rune(b)
+	if len(first) == 0 && len(second) == 0 {
+		return 1
+	}
+	if len(first) == 0 || len(second) == 0 {
+		return 0
+	}
+
+	window := max(len(first), len(second))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	firstMatched := make([]bool, len(first))
+	secondMatched := make([]bool, len(second))
+	matches := 0
+	for i := range first {
+		from, to := max(0, i-window), min(len(second), i+window+1)
+		for j := from; j < to; j++ {
+			if !secondMatched[j] && first[i] == second[j] {
+				firstMatched[i], secondMatched[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range first {
+		if !firstMatched[i] {
+			continue
+		}
+		for !secondMatched[j] {
+			j++
+		}
+		if first[i] != second[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(first)) + m/float64(len(second)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < 4 && prefix < len(first) && prefix < len(second) && first[prefix] == second[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+func newEntry(book domain.Book) entry {
+	return entry{
+		book:   book,
+		title:  TitleKey(book.Name),
+		author: AuthorKey(book.Author),
+		isbn:   validation.NormalizeIsbn(book.Isbn),
+	}
+}
+
+// compare reports whether two books are probably the same title, how sure that is and
+// why. Books with different ISBNs are different editions and never match.
+func compare(a entry, b entry) (float64, string, bool) {
+	if a.isbn != "" && b.isbn != "" {
+		return 1, ReasonIsbn, a.isbn == b.isbn
+	}
+	if a.title == "" || a.author == "" {
+		return 0, "", false
+	}
+	if a.title == b.title && a.author == b.author {
+		return 1, ReasonKey, true
+	}
+
+	title, author := JaroWinkler(a.title, b.title), JaroWinkler(a.author, b.author)
+	if title >= titleThreshold && author >= authorThreshold {
+		return (title + author) / 2, ReasonSimilar, true
+	}
+	return 0, "", false
+}
+
+func blocksOf(e entry) []string {
+	var blocks []string
+	if e.isbn != "" {
+		blocks = append(blocks, "isbn:"+e.isbn)
+	}
+	for _, token := range strings.Fields(e.title) {
+		if len(token) >= minTokenLength {
+			blocks = append(blocks, "title:"+token)
+		}
+	}
+	if tokens := strings.Fields(e.author); len(tokens) > 0 {
+		blocks = append(blocks, "author:"+tokens[len(tokens)-1])
+	}
+	return blocks
+}
+
+// normalize lowercases text and strips it of accents and punctuation, leaving words
+// separated by single spaces.
+func normalize(text string) string {
+	var builder strings.Builder
+	space := true
+	for _, r := range norm.NFKD.String(text) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			builder.WriteRune(unicode.ToLower(r))
+			space = false
+		case !space:
+			builder.WriteRune(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(builder.String())
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
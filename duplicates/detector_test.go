@@ -0,0 +1,129 @@
+package duplicates
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type scenario struct {
+	name      string
+	book      domain.Book
+	other     domain.Book
+	duplicate bool
+	reason    string
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+	hobbit := domain.Book{Id: 1, Name: "The Hobbit", Author: "J.R.R. Tolkien"}
+	scenarios := []scenario{
+		{
+			name:      "should match inverted article and author",
+			book:      hobbit,
+			other:     domain.Book{Id: 2, Name: "Hobbit, The", Author: "Tolkien, J. R. R."},
+			duplicate: true,
+			reason:    ReasonKey,
+		},
+		{
+			name:      "should match accents and case",
+			book:      domain.Book{Id: 1, Name: "Les Misérables", Author: "Victor Hugo"},
+			other:     domain.Book{Id: 2, Name: "LES MISERABLES", Author: "Hugo, Victor"},
+			duplicate: true,
+			reason:    ReasonKey,
+		},
+		{
+			name:      "should match typos",
+			book:      hobbit,
+			other:     domain.Book{Id: 2, Name: "The Hobit", Author: "JRR Tolkien"},
+			duplicate: true,
+			reason:    ReasonSimilar,
+		},
+		{
+			name:      "should match isbn 10 and 13 of the same book",
+			book:      domain.Book{Id: 1, Name: "The Hobbit", Author: "Tolkien", Isbn: "0-261-10221-4"},
+			other:     domain.Book{Id: 2, Name: "Der kleine Hobbit", Author: "Tolkien", Isbn: "9780261102217"},
+			duplicate: true,
+			reason:    ReasonIsbn,
+		},
+		{
+			name:  "should not match different isbns",
+			book:  domain.Book{Id: 1, Name: "The Hobbit", Author: "Tolkien", Isbn: "0-261-10221-4"},
+			other: domain.Book{Id: 2, Name: "The Hobbit", Author: "Tolkien", Isbn: "0-8044-2957-X"},
+		},
+		{
+			name:  "should not match other books of the author",
+			book:  hobbit,
+			other: domain.Book{Id: 2, Name: "The Silmarillion", Author: "J.R.R. Tolkien"},
+		},
+		{
+			name:  "should not match same title by another author",
+			book:  domain.Book{Id: 1, Name: "Emma", Author: "Jane Austen"},
+			other: domain.Book{Id: 2, Name: "Emma", Author: "Jean Sasson"},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			matches := Find(scenario.book, []domain.Book{scenario.book, scenario.other})
+			if (len(matches) == 1) != scenario.duplicate {
+				t.Fatalf("Expected duplicate %v, got %v", scenario.duplicate, matches)
+			}
+			if scenario.duplicate && matches[0].Reason != scenario.reason {
+				t.Errorf("Expected reason %v, got %v", scenario.reason, matches[0].Reason)
+			}
+		})
+	}
+}
+
+func TestClusters(t *testing.T) {
+	t.Parallel()
+	catalogue := []domain.Book{
+		{Id: 1, Name: "The Hobbit", Author: "J.R.R. Tolkien"},
+		{Id: 2, Name: "Dune", Author: "Frank Herbert"},
+		{Id: 3, Name: "Hobbit, The", Author: "Tolkien, J. R. R."},
+		{Id: 4, Name: "The Hobit", Author: "JRR Tolkien"},
+		{Id: 5, Name: "Dune", Author: "Herbert, Frank"},
+		{Id: 6, Name: "The Silmarillion", Author: "J.R.R. Tolkien"},
+	}
+
+	clusters := Clusters(catalogue)
+	if len(clusters) != 2 {
+		t.Fatalf("Expected 2 clusters, got %v", clusters)
+	}
+	if ids := bookIds(clusters[0].Books); ids != "1,3,4" {
+		t.Errorf("Expected the hobbits 1,3,4, got %v", ids)
+	}
+	if ids := bookIds(clusters[1].Books); ids != "2,5" {
+		t.Errorf("Expected the dunes 2,5, got %v", ids)
+	}
+	if clusters[1].Score != 1 || len(clusters[1].Reasons) != 1 || clusters[1].Reasons[0] != ReasonKey {
+		t.Errorf("Expected an exact match, got %v", clusters[1])
+	}
+}
+
+func TestJaroWinkler(t *testing.T) {
+	t.Parallel()
+	scenarios := map[[2]string]float64{
+		{"martha", "marhta"}:  0.961,
+		{"dixon", "dicksonx"}: 0.813,
+		{"hobbit", "hobbit"}:  1,
+		{"hobbit", ""}:        0,
+		{"abc", "xyz"}:        0,
+	}
+
+	for pair, expected := range scenarios {
+		if similarity := JaroWinkler(pair[0], pair[1]); similarity < expected-0.001 || similarity > expected+0.001 {
+			t.Errorf("Expected %v for %v, got %v", expected, pair, similarity)
+		}
+	}
+}
+
+func bookIds(books []domain.Book) string {
+	ids := make([]string, len(books))
+	for i, book := range books {
+		ids[i] = strconv.FormatInt(book.Id, 10)
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,193 @@
+// Package editions checks uploaded digital editions of books, EPUB and PDF files, and
+// reads the metadata of EPUBs from their OPF package document.
+package editions
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/validation"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+const (
+	FormatEpub = "epub"
+	FormatPdf  = "pdf"
+
+	Epub = "application/epub+zip"
+	Pdf  = "application/pdf"
+
+	containerFile = "META-INF/container.xml"
+	// maxDocumentBytes bounds the XML documents read from an EPUB, so a small archive
+	// can't unpack into a huge one.
+	maxDocumentBytes = 1 << 20
+)
+
+var (
+	ErrUnsupported = errors.New("edition must be an EPUB or a PDF file")
+	ErrMismatch    = errors.New("edition content does not match its content type")
+)
+
+type container struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfPackage holds the part of an OPF package document the library uses, Dublin Core
+// elements match by their local names whatever prefix the file gives them.
+type opfPackage struct {
+	Titles      []string `xml:"metadata>title"`
+	Creators    []string `xml:"metadata>creator"`
+	Languages   []string `xml:"metadata>language"`
+	Identifiers []struct {
+		Scheme string `xml:"scheme,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"metadata>identifier"`
+}
+
+// Format returns the format of a content type, "" for unsupported ones.
+func Format(contentType string) string {
+	switch contentType {
+	case Epub:
+		return FormatEpub
+	case Pdf:
+		return FormatPdf
+	}
+	return ""
+}
+
+// Read checks that data is the edition its contentType declares and returns its
+// metadata, which is empty for PDFs.
+func Read(data []byte, contentType string) (domain.EditionMetadata, error) {
+	switch contentType {
+	case Pdf:
+		if !bytes.HasPrefix(data, []byte("%PDF-")) {
+			return domain.EditionMetadata{}, ErrMismatch
+		}
+		return domain.EditionMetadata{}, nil
+	case Epub:
+		return readEpub(data)
+	}
+	return domain.EditionMetadata{}, ErrUnsupported
+}
+
+// readEpub reads the OPF package document an EPUB's container points to. The mimetype
+// file opens every EPUB, which tells it from other zip archives.
+func readEpub(data []byte) (domain.EditionMetadata, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil || len(archive.File) == 0 || archive.File[0].Name != "mimetype" {
+		return domain.EditionMetadata{}, ErrMismatch
+	}
+	if mimetype, err := readFile(archive.File[0]); err != nil || strings.TrimSpace(string(mimetype)) != Epub {
+		return domain.EditionMetadata{}, ErrMismatch
+	}
+
+	var epubContainer container
+	if err = readXml(archive, containerFile, &epubContainer); err != nil {
+		return domain.EditionMetadata{}, err
+	}
+	if len(epubContainer.Rootfiles) == 0 {
+		return domain.EditionMetadata{}, errors.New(containerFile + " names no package document")
+	}
+	var opf opfPackage
+	if err = readXml(archive, epubContainer.Rootfiles[0].FullPath, &opf); err != nil {
+		return domain.EditionMetadata{}, err
+	}
+
+	metadata := domain.EditionMetadata{
+		Title:    first(opf.Titles),
+		Author:   strings.Join(trimmed(opf.Creators), ", "),
+		Language: first(opf.Languages),
+	}
+	for _, identifier := range opf.Identifiers {
+		value := strings.TrimSpace(identifier.Value)
+		if lower := strings.ToLower(value); strings.HasPrefix(lower, "urn:isbn:") {
+			value = value[len("urn:isbn:"):]
+		} else if !strings.EqualFold(identifier.Scheme, "isbn") {
+			continue
+		}
+		if validation.IsValidIsbn(value) {
+			metadata.Isbn = value
+			break
+		}
+	}
+	return metadata, nil
+}
+
+// Compare returns the fields on which the record of a book and the metadata of its
+// edition disagree. Fields the edition leaves out are not compared, and neither are case,
+// spacing nor the form of ISBNs.
+func Compare(book domain.Book, metadata domain.EditionMetadata) []domain.Mismatch {
+	var mismatches []domain.Mismatch
+	if metadata.Title != "" && !sameText(book.Name, metadata.Title) {
+		mismatches = append(mismatches, domain.Mismatch{Field: "Name", Book: book.Name, Edition: metadata.Title})
+	}
+	if metadata.Author != "" && !sameText(book.Author, metadata.Author) {
+		mismatches = append(mismatches, domain.Mismatch{Field: "Author", Book: book.Author, Edition: metadata.Author})
+	}
+	if metadata.Isbn != "" && validation.NormalizeIsbn(book.Isbn) != validation.NormalizeIsbn(metadata.Isbn) {
+		mismatches = append(mismatches, domain.Mismatch{Field: "Isbn", Book: book.Isbn, Edition: metadata.Isbn})
+	}
+	return mismatches
+}
+
+func sameText(a string, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+func readXml(archive *zip.Reader, name string, document interface{}) error {
+	name = path.Clean(name)
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+		data, err := readFile(file)
+		if err != nil {
+			return err
+		}
+		if err = xml.Unmarshal(data, document); err != nil {
+			return errors.New(name + ": " + err.Error())
+		}
+		return nil
+	}
+	return errors.New(name + " is missing")
+}
+
+func readFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxDocumentBytes+1))
+	if err != nil {
+		return nil, errors.New(file.Name + ": " + err.Error())
+	}
+	if len(data) > maxDocumentBytes {
+		return nil, errors.New(file.Name + " is too large")
+	}
+	return data, nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0])
+}
+
+func trimmed(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package editions
+
+import (
+	"archive/zip"
+	"bytes"
+	"go-rest-webservices-book-library/domain"
+	"reflect"
+	"testing"
+)
+
+const opf = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" xmlns:opf="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>A Wizard of Earthsea</dc:title>
+    <dc:creator opf:role="aut">Ursula K. Le Guin</dc:creator>
+    <dc:identifier opf:scheme="UUID">urn:uuid:2b0c8c5e-34b5-4b0b-9d0b-3c1f0d3f7a10</dc:identifier>
+    <dc:identifier opf:scheme="ISBN">978-0-547-72202-3</dc:identifier>
+    <dc:language>en</dc:language>
+  </metadata>
+</package>`
+
+// zipEpub zips the files, given as pairs of name and content, in order.
+func zipEpub(t *testing.T, files ...string) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for i := 0; i+1 < len(files); i += 2 {
+		writer, _ := archive.Create(files[i])
+		_, _ = writer.Write([]byte(files[i+1]))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Could not zip EPUB: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+	containerXml := `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`
+	scenarios := []struct {
+		name        string
+		data        []byte
+		contentType string
+		metadata    domain.EditionMetadata
+		valid       bool
+	}{
+		{
+			name:        "should read the metadata of an EPUB",
+			data:        zipEpub(t, "mimetype", "application/epub+zip", "META-INF/container.xml", containerXml, "OEBPS/content.opf", opf),
+			contentType: "application/epub+zip",
+			metadata:    domain.EditionMetadata{Title: "A Wizard of Earthsea", Author: "Ursula K. Le Guin", Isbn: "978-0-547-72202-3", Language: "en"},
+			valid:       true,
+		},
+		{
+			name:        "should refuse a zip which is not an EPUB",
+			data:        zipEpub(t, "META-INF/container.xml", containerXml, "OEBPS/content.opf", opf),
+			contentType: "application/epub+zip",
+		},
+		{
+			name:        "should refuse an EPUB without its package document",
+			data:        zipEpub(t, "mimetype", "application/epub+zip", "META-INF/container.xml", containerXml),
+			contentType: "application/epub+zip",
+		},
+		{name: "should accept a PDF", data: []byte("%PDF-1.7\n%%EOF"), contentType: "application/pdf", valid: true},
+		{name: "should refuse a PDF which is not one", data: []byte("PK\x03\x04"), contentType: "application/pdf"},
+		{name: "should refuse other formats", data: []byte("text"), contentType: "text/plain"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			metadata, err := Read(scenario.data, scenario.contentType)
+			if (err == nil) != scenario.valid || metadata != scenario.metadata {
+				t.Errorf("Expected %v, valid %v, got %v, %v", scenario.metadata, scenario.valid, metadata, err)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	book := domain.Book{Name: "A wizard of  Earthsea", Author: "Ursula K. Le Guin", Isbn: "0547722028"}
+	scenarios := []struct {
+		name       string
+		metadata   domain.EditionMetadata
+		mismatches []domain.Mismatch
+	}{
+		{name: "should ignore case, spacing and the form of ISBNs", metadata: domain.EditionMetadata{Title: "A Wizard of Earthsea", Author: "Ursula K. Le Guin", Isbn: "978-0-547-72202-3"}},
+		{name: "should not compare fields the edition leaves out", metadata: domain.EditionMetadata{Language: "en"}},
+		{
+			name:       "should report differing fields",
+			metadata:   domain.EditionMetadata{Title: "The Tombs of Atuan", Isbn: "9780689845369"},
+			mismatches: []domain.Mismatch{{Field: "Name", Book: book.Name, Edition: "The Tombs of Atuan"}, {Field: "Isbn", Book: book.Isbn, Edition: "9780689845369"}},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if mismatches := Compare(book, scenario.metadata); !reflect.DeepEqual(mismatches, scenario.mismatches) {
+				t.Errorf("Expected %v, got %v", scenario.mismatches, mismatches)
+			}
+		})
+	}
+}
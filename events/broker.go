@@ -0,0 +1,74 @@
+package events
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	BookCreated Type = "created"
+	BookUpdated Type = "updated"
+	BookDeleted Type = "deleted"
+
+	subscriberBuffer = 64
+)
+
+// Event is a change to the catalogue. Sequence numbers grow with every event recorded in
+// the event log, so clients can resume after the last one they saw. Deleted books only
+// carry their id.
+type Event struct {
+	Sequence   int64
+	Type       Type
+	Book       domain.Book
+	OccurredAt time.Time
+}
+
+// Broker fans events out to every subscriber in process. A subscriber which falls more
+// than subscriberBuffer events behind is disconnected, its channel closed, so it can not
+// stall the writers.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Books carries the changes made through any of the APIs.
+var Books = NewBroker()
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[chan Event]struct{}{}}
+}
+
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Subscribe returns the channel of events published from now on, and the function to
+// call once the subscriber is done with it.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	subscriber := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.mu.Unlock()
+
+	return subscriber, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[subscriber]; ok {
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
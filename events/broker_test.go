@@ -0,0 +1,47 @@
+package events
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"testing"
+)
+
+func TestBrokerDeliversToEverySubscriber(t *testing.T) {
+	broker := NewBroker()
+	first, unsubscribeFirst := broker.Subscribe()
+	second, unsubscribeSecond := broker.Subscribe()
+	defer unsubscribeSecond()
+
+	event := Event{Type: BookCreated, Book: domain.Book{Id: 1, Name: "Book", Author: "Author"}}
+	broker.Publish(event)
+
+	for _, subscriber := range []<-chan Event{first, second} {
+		if received := <-subscriber; received != event {
+			t.Errorf("Expected %v, got %v", event, received)
+		}
+	}
+
+	unsubscribeFirst()
+	broker.Publish(event)
+	if _, open := <-first; open {
+		t.Errorf("Expected no events after unsubscribing")
+	}
+	unsubscribeFirst()
+}
+
+func TestBrokerDisconnectsSlowSubscribers(t *testing.T) {
+	broker := NewBroker()
+	subscriber, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		broker.Publish(Event{Type: BookUpdated, Book: domain.Book{Id: int64(i)}})
+	}
+
+	received := 0
+	for range subscriber {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("Expected %v buffered events before disconnecting, got %v", subscriberBuffer, received)
+	}
+}
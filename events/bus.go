@@ -0,0 +1,62 @@
+package events
+
+import (
+	"fmt"
+	"go-rest-webservices-book-library/config"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// Handler reacts to an event once the transaction which recorded it has committed.
+type Handler func(event Event)
+
+// Bus dispatches committed events to the handlers subscribed to it, in process and in
+// the order of their sequence numbers. Handlers run on the writer's goroutine while it
+// still holds the repository write lock, so they must be quick and hand anything slow,
+// or which writes to the repository, to a goroutine of their own.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// Committed carries every change to the catalogue once it is in the database. Books
+// is subscribed to it to feed the change streams.
+var Committed = NewBus()
+
+var logger *zap.Logger
+
+func init() {
+	logger = config.AppLogger
+	Committed.Subscribe(Books.Publish)
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Dispatch calls every handler with event. A handler which panics is logged and does not
+// keep the event from the others.
+func (b *Bus) Dispatch(event Event) {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		dispatch(handler, event)
+	}
+}
+
+func dispatch(handler Handler, event Event) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Error(fmt.Sprintf("Event handler panicked on event %d with: %v", event.Sequence, recovered))
+		}
+	}()
+	handler(event)
+}
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"testing"
+)
+
+func TestBusDispatchesInOrderOfSubscription(t *testing.T) {
+	bus := NewBus()
+	var received []string
+	bus.Subscribe(func(event Event) { received = append(received, "first") })
+	bus.Subscribe(func(event Event) { panic("handler failed") })
+	bus.Subscribe(func(event Event) { received = append(received, "third:"+event.Book.Name) })
+
+	bus.Dispatch(Event{Sequence: 1, Type: BookCreated, Book: domain.Book{Id: 1, Name: "Book"}})
+
+	if len(received) != 2 || received[0] != "first" || received[1] != "third:Book" {
+		t.Errorf("Expected every handler but the failing one to run, got %v", received)
+	}
+}
+
+func TestCommittedFeedsBooks(t *testing.T) {
+	subscriber, unsubscribe := Books.Subscribe()
+	defer unsubscribe()
+
+	event := Event{Sequence: 1, Type: BookDeleted, Book: domain.Book{Id: 1}}
+	Committed.Dispatch(event)
+
+	if received := <-subscriber; received != event {
+		t.Errorf("Expected %v, got %v", event, received)
+	}
+}
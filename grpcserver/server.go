@@ -0,0 +1,229 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/events"
+	"go-rest-webservices-book-library/librarypb"
+	"go-rest-webservices-book-library/repository"
+	"go-rest-webservices-book-library/validation"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+)
+
+const (
+	listBatchSize = 100
+	bearerPrefix  = "Bearer "
+)
+
+// libraryServer implements librarypb.LibraryServiceServer over the repository package,
+// the same layer the HTTP handlers use.
+type libraryServer struct {
+	librarypb.UnimplementedLibraryServiceServer
+}
+
+var logger *zap.Logger
+
+func init() {
+	logger = config.AppLogger
+}
+
+// New returns a gRPC server with the library service, health checking and reflection
+// registered.
+func New() *grpc.Server {
+	server := grpc.NewServer()
+	librarypb.RegisterLibraryServiceServer(server, libraryServer{})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(librarypb.LibraryService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+	return server
+}
+
+func (s libraryServer) GetBook(ctx context.Context, request *librarypb.GetBookRequest) (*librarypb.Book, error) {
+	book, err := getBook(request.Id)
+	if err != nil {
+		return nil, err
+	}
+	return toMessage(book), nil
+}
+
+func (s libraryServer) ListBooks(request *librarypb.ListBooksRequest, stream librarypb.LibraryService_ListBooksServer) error {
+	filter := domain.BookFilter{Name: request.Name, Author: request.Author}
+	for offset := int64(0); ; offset += listBatchSize {
+		books, err := repository.FindBooks(filter, listBatchSize, offset)
+		if err != nil {
+			logger.Error("Error while listing books with error: " + err.Error())
+			return status.Error(codes.Internal, "could not list books")
+		}
+
+		for _, book := range books {
+			if err := stream.Send(toMessage(book)); err != nil {
+				return err
+			}
+		}
+		if len(books) < listBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s libraryServer) CreateBook(ctx context.Context, request *librarypb.CreateBookRequest) (*librarypb.Book, error) {
+	if err := authorizeStaff(ctx); err != nil {
+		return nil, err
+	}
+	book := domain.Book{Name: request.Name, Author: request.Author, Isbn: request.Isbn}
+	if err := validate(book); err != nil {
+		return nil, err
+	}
+
+	rowId, insertRecordErr := repository.AddBook(book)
+	if insertRecordErr != nil {
+		logger.Error("Error while creating book with error: " + insertRecordErr.Error())
+		return nil, status.Error(codes.Internal, "could not create book")
+	}
+	book.Id = rowId
+	return toMessage(book), nil
+}
+
+func (s libraryServer) UpdateBook(ctx context.Context, request *librarypb.UpdateBookRequest) (*librarypb.Book, error) {
+	if err := authorizeStaff(ctx); err != nil {
+		return nil, err
+	}
+	if request.Book == nil {
+		return nil, status.Error(codes.InvalidArgument, "book is required")
+	}
+	book := fromMessage(request.Book)
+	if err := validate(book); err != nil {
+		return nil, err
+	}
+	current, err := getBook(book.Id)
+	if err != nil {
+		return nil, err
+	}
+	// Messages carry no publisher, year nor pages, so an update keeps those of the book.
+	book.Publisher, book.Year, book.Pages = current.Publisher, current.Year, current.Pages
+
+	id := strconv.FormatInt(book.Id, 10)
+	if updateErr := repository.UpdateBook(book, id); updateErr != nil {
+		logger.Error("Error while updating book: " + id + " with error: " + updateErr.Error())
+		return nil, status.Error(codes.Internal, "could not update book")
+	}
+	return toMessage(book), nil
+}
+
+func (s libraryServer) DeleteBook(ctx context.Context, request *librarypb.DeleteBookRequest) (*librarypb.DeleteBookResponse, error) {
+	if err := authorizeStaff(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := getBook(request.Id); err != nil {
+		return nil, err
+	}
+
+	id := strconv.FormatInt(request.Id, 10)
+	if deleteErr := repository.DeleteBook(id); errors.Is(deleteErr, repository.ErrBookLent) {
+		return nil, status.Error(codes.FailedPrecondition, deleteErr.Error())
+	} else if deleteErr != nil {
+		logger.Error("Error while deleting book: " + id + " with error: " + deleteErr.Error())
+		return nil, status.Error(codes.Internal, "could not delete book")
+	}
+	return &librarypb.DeleteBookResponse{}, nil
+}
+
+func (s libraryServer) WatchBooks(request *librarypb.WatchBooksRequest, stream librarypb.LibraryService_WatchBooksServer) error {
+	subscription, unsubscribe := events.Books.Subscribe()
+	defer unsubscribe()
+	// Sending the headers tells the client from when on it is watching.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, open := <-subscription:
+			if !open {
+				return status.Error(codes.Unavailable, "watcher fell behind, watch again")
+			}
+			message := &librarypb.BookEvent{Type: eventTypes[event.Type], Book: toMessage(event.Book)}
+			if err := stream.Send(message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var eventTypes = map[events.Type]librarypb.BookEvent_Type{
+	events.BookCreated: librarypb.BookEvent_CREATED,
+	events.BookUpdated: librarypb.BookEvent_UPDATED,
+	events.BookDeleted: librarypb.BookEvent_DELETED,
+}
+
+// authorizeStaff fails with Unauthenticated unless the authorization metadata of the call
+// is the staff token of accounts.staffToken, as for the HTTP API.
+func authorizeStaff(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token := strings.TrimSpace(strings.TrimPrefix(value, bearerPrefix))
+		if config.StaffToken != "" && strings.HasPrefix(value, bearerPrefix) &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(config.StaffToken)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "staff credentials are required")
+}
+
+func getBook(id int64) (domain.Book, error) {
+	books, err := repository.GetBook(strconv.FormatInt(id, 10))
+	if err != nil {
+		logger.Error("Error while fetching book: " + strconv.FormatInt(id, 10) + " with error: " + err.Error())
+		return domain.Book{}, status.Error(codes.Internal, "could not fetch book")
+	}
+	if len(books) == 0 {
+		return domain.Book{}, status.Error(codes.NotFound, "book "+strconv.FormatInt(id, 10)+" not found")
+	}
+	return books[0], nil
+}
+
+// validate applies the validation rules of the REST API, reporting the violations as
+// BadRequest details of an INVALID_ARGUMENT status.
+func validate(book domain.Book) error {
+	fieldErrors := validation.Validate(book)
+	if fieldErrors == nil {
+		return nil
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range fieldErrors.Violations() {
+		badRequest.FieldViolations = append(badRequest.FieldViolations,
+			&errdetails.BadRequest_FieldViolation{Field: violation.Field, Description: violation.Message})
+	}
+	invalid, err := status.New(codes.InvalidArgument, fieldErrors.Error()).WithDetails(badRequest)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, fieldErrors.Error())
+	}
+	return invalid.Err()
+}
+
+func toMessage(book domain.Book) *librarypb.Book {
+	return &librarypb.Book{Id: book.Id, Name: book.Name, Author: book.Author, Isbn: book.Isbn}
+}
+
+func fromMessage(book *librarypb.Book) domain.Book {
+	return domain.Book{Id: book.Id, Name: book.Name, Author: book.Author, Isbn: book.Isbn}
+}
@@ -0,0 +1,189 @@
+package grpcserver
+
+import (
+	"context"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/librarypb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type scenario struct {
+	name    string
+	request *librarypb.CreateBookRequest
+	code    codes.Code
+	field   string
+}
+
+func TestLibraryService(t *testing.T) {
+	client, conn := newClient(t)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	watch, err := client.WatchBooks(ctx, &librarypb.WatchBooksRequest{})
+	if err != nil {
+		t.Fatalf("Expected to watch books, got %v", err)
+	}
+	if _, err := watch.Header(); err != nil {
+		t.Fatalf("Expected watch headers, got %v", err)
+	}
+
+	created, err := client.CreateBook(ctx, &librarypb.CreateBookRequest{Name: "gRPC Book", Author: "gRPC Author"})
+	if err != nil || created.Id == 0 {
+		t.Fatalf("Expected book to be created, got %v, %v", created, err)
+	}
+
+	got, err := client.GetBook(ctx, &librarypb.GetBookRequest{Id: created.Id})
+	if err != nil || got.Name != created.Name || got.Author != created.Author {
+		t.Errorf("Expected %v, got %v, %v", created, got, err)
+	}
+
+	updated, err := client.UpdateBook(ctx, &librarypb.UpdateBookRequest{
+		Book: &librarypb.Book{Id: created.Id, Name: "gRPC Book 2", Author: "gRPC Author"},
+	})
+	if err != nil || updated.Name != "gRPC Book 2" {
+		t.Errorf("Expected book to be updated, got %v, %v", updated, err)
+	}
+
+	list, err := client.ListBooks(ctx, &librarypb.ListBooksRequest{Name: "gRPC Book 2"})
+	if err != nil {
+		t.Fatalf("Expected to list books, got %v", err)
+	}
+	found := false
+	for {
+		book, err := list.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected to receive books, got %v", err)
+		}
+		found = found || book.Id == created.Id
+	}
+	if !found {
+		t.Errorf("Expected book %v in the list", created.Id)
+	}
+
+	if _, err := client.DeleteBook(ctx, &librarypb.DeleteBookRequest{Id: created.Id}); err != nil {
+		t.Errorf("Expected book to be deleted, got %v", err)
+	}
+	if _, err := client.GetBook(ctx, &librarypb.GetBookRequest{Id: created.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected %v, got %v", codes.NotFound, err)
+	}
+
+	expected := []librarypb.BookEvent_Type{librarypb.BookEvent_CREATED, librarypb.BookEvent_UPDATED, librarypb.BookEvent_DELETED}
+	for _, eventType := range expected {
+		event, err := watch.Recv()
+		if err != nil || event.Type != eventType || event.Book.Id != created.Id {
+			t.Errorf("Expected %v event of book %v, got %v, %v", eventType, created.Id, event, err)
+		}
+	}
+}
+
+func TestCreateBookValidation(t *testing.T) {
+	client, conn := newClient(t)
+	defer conn.Close()
+
+	scenarios := []scenario{
+		{
+			name:    "should reject a book without name",
+			request: &librarypb.CreateBookRequest{Author: "Author"},
+			code:    codes.InvalidArgument,
+			field:   "Name",
+		},
+		{
+			name:    "should reject a book without author",
+			request: &librarypb.CreateBookRequest{Name: "Book"},
+			code:    codes.InvalidArgument,
+			field:   "Author",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			_, err := client.CreateBook(context.Background(), scenario.request)
+			if status.Code(err) != scenario.code {
+				t.Fatalf("Expected %v, got %v", scenario.code, err)
+			}
+
+			details := status.Convert(err).Details()
+			badRequest, ok := details[0].(*errdetails.BadRequest)
+			if !ok || badRequest.FieldViolations[0].Field != scenario.field {
+				t.Errorf("Expected violation of %v, got %v", scenario.field, details)
+			}
+		})
+	}
+}
+
+func TestBookChangesNeedStaff(t *testing.T) {
+	for _, authorization := range []string{"", "Bearer wrong", staffToken} {
+		client, conn := newClientAs(t, authorization)
+		ctx := context.Background()
+		if _, err := client.CreateBook(ctx, &librarypb.CreateBookRequest{Name: "Book", Author: "Author"}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Expected create with %q to be %v, got %v", authorization, codes.Unauthenticated, err)
+		}
+		if _, err := client.UpdateBook(ctx, &librarypb.UpdateBookRequest{Book: &librarypb.Book{Id: 1, Name: "Book", Author: "Author"}}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Expected update with %q to be %v, got %v", authorization, codes.Unauthenticated, err)
+		}
+		if _, err := client.DeleteBook(ctx, &librarypb.DeleteBookRequest{Id: 1}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Expected delete with %q to be %v, got %v", authorization, codes.Unauthenticated, err)
+		}
+		conn.Close()
+	}
+}
+
+func TestHealth(t *testing.T) {
+	_, conn := newClient(t)
+	defer conn.Close()
+
+	response, err := healthpb.NewHealthClient(conn).Check(context.Background(),
+		&healthpb.HealthCheckRequest{Service: librarypb.LibraryService_ServiceDesc.ServiceName})
+	if err != nil || response.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected %v, got %v, %v", healthpb.HealthCheckResponse_SERVING, response, err)
+	}
+}
+
+const staffToken = "grpc-staff"
+
+func newClient(t *testing.T) (librarypb.LibraryServiceClient, *grpc.ClientConn) {
+	return newClientAs(t, "Bearer "+staffToken)
+}
+
+// newClientAs returns a client which sends authorization with every call, when it is set.
+func newClientAs(t *testing.T, authorization string) (librarypb.LibraryServiceClient, *grpc.ClientConn) {
+	previous := config.StaffToken
+	config.StaffToken = staffToken
+	t.Cleanup(func() { config.StaffToken = previous })
+	listener := bufconn.Listen(1 << 20)
+	server := New()
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithUnaryInterceptor(func(ctx context.Context, method string, request, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if authorization != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+			}
+			return invoker(ctx, method, request, reply, conn, opts...)
+		}),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Expected to dial the server, got %v", err)
+	}
+	return librarypb.NewLibraryServiceClient(conn), conn
+}
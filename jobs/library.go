@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/notifications"
+	"go-rest-webservices-book-library/repository"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	backupPrefix = "library-"
+	backupSuffix = ".db"
+)
+
+// Library runs the jobs of the library on the schedules of the jobs section of config.yml.
+var Library = newLibrary()
+
+func newLibrary() *Scheduler {
+	host, _ := os.Hostname()
+	scheduler := NewScheduler(host+":"+strconv.Itoa(os.Getpid()), config.JobLockTtl)
+	for _, job := range []Job{
+		{Name: "overdue", Description: "Queues loan.overdue webhook deliveries for the loans which went overdue since it last ran", Run: queueOverdueLoans},
+		{Name: "holds", Description: "Cancels the holds placed longer ago than circulation.holdExpiry", Run: expireHolds},
+		{Name: "purge", Description: "Deletes expired idempotency keys and member tokens, stale ISBN lookups and job runs older than jobs.history", Run: purge},
+		{Name: "backup", Description: "Backs the database up to jobs.backup.directory, keeping the latest jobs.backup.keep backups", Run: backUp},
+		{Name: "notify", Description: "Emails members about loans due soon or overdue and holds ready to collect, once each", Run: notify},
+	} {
+		if err := scheduler.Add(job, config.JobSchedules[job.Name]); err != nil {
+			log.Fatal("Error while scheduling job " + err.Error())
+		}
+	}
+	return scheduler
+}
+
+// queueOverdueLoans picks up where the last successful run left off, so that no loan is
+// missed while the server is down.
+func queueOverdueLoans(ctx context.Context, now time.Time) (string, error) {
+	last, err := repository.GetLastJobRun("overdue", domain.JobSucceeded)
+	if err != nil {
+		return "", err
+	}
+	var since time.Time
+	if last != nil {
+		since = last.StartedAt
+	}
+	count, err := repository.EnqueueOverdueLoans(since, now)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(count) + " loans went overdue", nil
+}
+
+func expireHolds(ctx context.Context, now time.Time) (string, error) {
+	count, err := repository.ExpireHolds(now.Add(-config.HoldExpiry))
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(count, 10) + " holds expired", nil
+}
+
+func purge(ctx context.Context, now time.Time) (string, error) {
+	keys, err := repository.DeleteExpiredIdempotencyKeys(now)
+	if err != nil {
+		return "", err
+	}
+	lookups, err := repository.DeleteIsbnLookups(now.Add(-config.LookupCacheTtl))
+	if err != nil {
+		return "", err
+	}
+	runs, err := repository.DeleteJobRuns(now.Add(-config.JobHistory))
+	if err != nil {
+		return "", err
+	}
+	tokens, err := repository.DeleteExpiredMemberTokens(now)
+	if err != nil {
+		return "", err
+	}
+	return "deleted " + strconv.FormatInt(keys, 10) + " idempotency keys, " + strconv.FormatInt(lookups, 10) +
+		" ISBN lookups, " + strconv.FormatInt(runs, 10) + " job runs and " + strconv.FormatInt(tokens, 10) + " member tokens", nil
+}
+
+// backUp names backups after the time they were taken, so that they sort oldest first.
+func backUp(ctx context.Context, now time.Time) (string, error) {
+	if err := os.MkdirAll(config.BackupDirectory, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(config.BackupDirectory, backupPrefix+now.UTC().Format("20060102T150405Z")+backupSuffix)
+	if err := repository.Backup(path); err != nil {
+		return "", err
+	}
+
+	backups, err := filepath.Glob(filepath.Join(config.BackupDirectory, backupPrefix+"*"+backupSuffix))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(backups)
+	removed := 0
+	for config.BackupKeep > 0 && len(backups)-removed > config.BackupKeep && ctx.Err() == nil {
+		if err = os.Remove(backups[removed]); err != nil {
+			return "", err
+		}
+		removed++
+	}
+	return "backed up to " + path + ", removed " + strconv.Itoa(removed) + " old backups", nil
+}
+
+// notify loads the templates and the sender every run, so that changes to the templates
+// on disk are picked up without a restart.
+func notify(ctx context.Context, now time.Time) (string, error) {
+	templates, err := notifications.LoadTemplates(config.NotificationTemplates)
+	if err != nil {
+		return "", err
+	}
+	sender, err := notifications.NewSender()
+	if err != nil {
+		return "", err
+	}
+	sent, err := notifications.Notify(ctx, now, sender, templates)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(sent) + " notifications sent", nil
+}
@@ -0,0 +1,191 @@
+// Package jobs runs the periodic work of the library inside the server: background jobs on
+// cron schedules, each run locked and recorded in the database so that instances sharing
+// it run every scheduled run once.
+package jobs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs next.
+type Schedule interface {
+	// Next returns the first time after the given one the job runs at.
+	Next(after time.Time) time.Time
+}
+
+// macros are the shorthands of cron expressions which ParseSchedule accepts.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field is one of the five fields of a cron expression with the values it allows.
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cron matches the times whose fields are in its sets. As in cron, a time matches either
+// the day of month or the day of week when both are restricted.
+type cron struct {
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+}
+
+// every runs a job at every multiple of an interval since the zero time, so that every
+// instance agrees on when the runs are.
+type every struct {
+	interval time.Duration
+}
+
+// ParseSchedule parses a cron expression of five fields, minute, hour, day of month, month
+// and day of week, each a *, a value, a range a-b or a list of them, optionally stepped by
+// /n. Months and days of the week may be named by their first three letters. The macros
+// @hourly, @daily, @weekly, @monthly and @yearly, and @every followed by a duration such
+// as 90s, are accepted too. Schedules are in the time zone of the times they are given.
+func ParseSchedule(expression string) (Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expression, "@every ")))
+		if err != nil || interval < time.Second {
+			return nil, errors.New("@every needs a duration of at least a second: " + expression)
+		}
+		return every{interval: interval.Truncate(time.Second)}, nil
+	}
+	if macro, found := macros[expression]; found {
+		expression = macro
+	}
+
+	parts := strings.Fields(expression)
+	if len(parts) != len(fields) {
+		return nil, errors.New("schedule must have 5 fields, minute hour day month weekday: " + expression)
+	}
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return cron{
+		minutes: sets[0], hours: sets[1], days: sets[2], months: sets[3], weekdays: sets[4],
+		anyDay: parts[2] == "*", anyWeekday: parts[4] == "*",
+	}, nil
+}
+
+func parseField(text string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(text, ",") {
+		rangeText, step := item, 1
+		if slash := strings.Index(item, "/"); slash >= 0 {
+			var err error
+			rangeText = item[:slash]
+			if step, err = strconv.Atoi(item[slash+1:]); err != nil || step < 1 {
+				return 0, errors.New("invalid step in " + f.name + ": " + item)
+			}
+		}
+
+		low, high := f.min, f.max
+		if rangeText != "*" {
+			bounds := strings.SplitN(rangeText, "-", 2)
+			var err error
+			if low, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = parseValue(bounds[1], f); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				high = f.max
+			}
+			if high < low {
+				return 0, errors.New("invalid range in " + f.name + ": " + item)
+			}
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+func parseValue(text string, f field) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return i + f.min, nil
+		}
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < f.min || value > f.max {
+		return 0, errors.New(f.name + " must be from " + strconv.Itoa(f.min) + " to " + strconv.Itoa(f.max) + ": " + text)
+	}
+	return value, nil
+}
+
+// Next returns the first minute after the given time which matches. A schedule which can
+// never match, such as one for the 31st of February, gives the zero time.
+func (c cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Every match recurs within 5 years, through leap days falling on a given weekday.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(c.months, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !has(c.hours, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !has(c.minutes, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c cron) matchesDay(t time.Time) bool {
+	day, weekday := has(c.days, t.Day()), has(c.weekdays, int(t.Weekday()))
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Truncate(e.interval).Add(e.interval)
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<uint(value)) != 0
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday.
+	after := time.Date(2026, time.October, 14, 10, 7, 30, 0, time.UTC)
+	scenarios := []struct {
+		name       string
+		expression string
+		next       time.Time
+	}{
+		{name: "Every minute", expression: "* * * * *", next: time.Date(2026, 10, 14, 10, 8, 0, 0, time.UTC)},
+		{name: "Every five minutes", expression: "*/5 * * * *", next: time.Date(2026, 10, 14, 10, 10, 0, 0, time.UTC)},
+		{name: "Stepped from a minute", expression: "3/20 * * * *", next: time.Date(2026, 10, 14, 10, 23, 0, 0, time.UTC)},
+		{name: "Nightly", expression: "30 3 * * *", next: time.Date(2026, 10, 15, 3, 30, 0, 0, time.UTC)},
+		{name: "Listed hours", expression: "0 9,12,18 * * *", next: time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)},
+		{name: "Weekdays", expression: "0 8 * * mon-fri", next: time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)},
+		{name: "Sunday as 7", expression: "0 0 * * 7", next: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{name: "Day of month or of week", expression: "0 0 1 * fri", next: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{name: "Next year", expression: "0 0 1 jan *", next: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Leap day", expression: "0 0 29 2 *", next: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "Hourly", expression: "@hourly", next: time.Date(2026, 10, 14, 11, 0, 0, 0, time.UTC)},
+		{name: "Monthly", expression: "@monthly", next: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Every interval", expression: "@every 90s", next: time.Date(2026, 10, 14, 10, 9, 0, 0, time.UTC)},
+		{name: "Never", expression: "0 0 31 2 *"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(s.expression)
+			if err != nil {
+				t.Fatalf("Could not parse %q: %v", s.expression, err)
+			}
+			if next := schedule.Next(after); !next.Equal(s.next) {
+				t.Errorf("Expected %v, got %v", s.next, next)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "a * * * *", "* * * foo *", "@every", "@every 10ms", "@fortnightly"} {
+		if _, err := ParseSchedule(expression); err == nil {
+			t.Errorf("Expected %q to be refused", expression)
+		}
+	}
+}
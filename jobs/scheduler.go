@@ -0,0 +1,248 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/repository"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// runsListed is how many of its latest runs a job is listed with.
+const runsListed = 10
+
+var (
+	ErrUnknownJob = errors.New("no such job")
+	ErrLocked     = errors.New("job is already running")
+	ErrStopped    = errors.New("jobs are stopping")
+)
+
+// Job is a piece of periodic work. Run is given the time the run started and returns what
+// it did, to be recorded with the run. It should stop early once ctx is done.
+type Job struct {
+	Name        string
+	Description string
+	Run         func(ctx context.Context, now time.Time) (string, error)
+}
+
+type entry struct {
+	job        Job
+	expression string
+	schedule   Schedule
+	next       time.Time
+}
+
+// Scheduler runs jobs on their schedules and when asked to. Every run takes a lock on its
+// job in the database for LockTtl at most, so that a job never runs twice at once, and is
+// recorded there under Owner, which names the server instance.
+type Scheduler struct {
+	Owner   string
+	LockTtl time.Duration
+
+	mu       sync.Mutex
+	entries  []*entry
+	ctx      context.Context
+	stopping bool
+	running  sync.WaitGroup
+}
+
+var logger *zap.Logger
+
+func init() {
+	logger = config.AppLogger
+}
+
+func NewScheduler(owner string, lockTtl time.Duration) *Scheduler {
+	return &Scheduler{Owner: owner, LockTtl: lockTtl}
+}
+
+// Add adds a job on a schedule which ParseSchedule accepts, or on none when it is empty,
+// for a job which only runs when asked to.
+func (s *Scheduler) Add(job Job, expression string) error {
+	e := &entry{job: job, expression: expression}
+	if expression != "" {
+		schedule, err := ParseSchedule(expression)
+		if err != nil {
+			return errors.New(job.Name + ": " + err.Error())
+		}
+		if schedule.Next(time.Now()).IsZero() {
+			return errors.New(job.Name + ": schedule never comes: " + expression)
+		}
+		e.schedule = schedule
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+// Run runs the jobs on their schedules until ctx is done, then waits for the runs in
+// progress, which see ctx done as well, to finish. A run which is missed, as the server
+// was stopped or busy with the previous run, is not made up for.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	now := time.Now()
+	for _, e := range s.entries {
+		if e.schedule != nil {
+			e.next = e.schedule.Next(now)
+		}
+	}
+	s.mu.Unlock()
+
+	for {
+		timer := time.NewTimer(s.untilNext(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.mu.Lock()
+			s.stopping = true
+			s.mu.Unlock()
+			s.running.Wait()
+			return
+		case <-timer.C:
+		}
+		s.runDue(ctx, time.Now())
+	}
+}
+
+// RunJob runs a job now, whatever its schedule, and returns the run once it is over.
+func (s *Scheduler) RunJob(name string) (*domain.JobRun, error) {
+	s.mu.Lock()
+	var job *Job
+	for _, e := range s.entries {
+		if e.job.Name == name {
+			job = &e.job
+		}
+	}
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	if job == nil {
+		return nil, ErrUnknownJob
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return s.run(ctx, *job, domain.TriggerManual, nil)
+}
+
+// Jobs lists the jobs in the order they were added, each with its latest runs.
+func (s *Scheduler) Jobs() ([]domain.Job, error) {
+	s.mu.Lock()
+	entries := make([]entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, *e)
+	}
+	s.mu.Unlock()
+
+	jobs := make([]domain.Job, 0, len(entries))
+	for _, e := range entries {
+		runs, err := repository.GetJobRuns(e.job.Name, runsListed)
+		if err != nil {
+			return nil, err
+		}
+		job := domain.Job{Name: e.job.Name, Description: e.job.Description, Schedule: e.expression, Runs: runs}
+		if !e.next.IsZero() {
+			next := e.next
+			job.NextRunAt = &next
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// untilNext returns how long it is until the next scheduled run, an hour at most so that a
+// clock which was changed is caught up with.
+func (s *Scheduler) untilNext(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := time.Hour
+	for _, e := range s.entries {
+		if e.schedule != nil && e.next.Sub(now) < wait {
+			wait = e.next.Sub(now)
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// runDue starts the scheduled runs due at now, each in its own goroutine.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if e.schedule == nil || e.next.After(now) {
+			continue
+		}
+		scheduledAt := e.next
+		e.next = e.schedule.Next(now)
+
+		job := e.job
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			// Another instance took the run, or is still busy with the previous one.
+			if _, err := s.run(ctx, job, domain.TriggerSchedule, &scheduledAt); err != nil && err != ErrLocked && err != ErrStopped {
+				logger.Error("Error while running job: " + job.Name + " with error: " + err.Error())
+			}
+		}()
+	}
+}
+
+// run locks job and records the run, unless it is locked or, for a scheduled run, it has
+// already been run by another instance, then runs it and records how it ended.
+func (s *Scheduler) run(ctx context.Context, job Job, trigger string, scheduledAt *time.Time) (*domain.JobRun, error) {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return nil, ErrStopped
+	}
+	s.running.Add(1)
+	s.mu.Unlock()
+	defer s.running.Done()
+
+	startedAt := time.Now()
+	run, err := repository.StartJobRun(domain.JobRun{
+		Job: job.Name, Trigger: trigger, Owner: s.Owner, ScheduledAt: scheduledAt, StartedAt: startedAt,
+	}, startedAt.Add(s.LockTtl))
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, ErrLocked
+	}
+
+	message, runErr := runSafely(ctx, job, startedAt)
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status, run.Message = domain.JobSucceeded, message
+	if runErr != nil {
+		run.Status, run.Message = domain.JobFailed, runErr.Error()
+		logger.Error("Job: " + job.Name + " failed with error: " + runErr.Error())
+	}
+	if err = repository.FinishJobRun(*run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// runSafely runs job, turning a panic into an error so that it can not take the server
+// down with it.
+func runSafely(ctx context.Context, job Job, now time.Time) (message string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return job.Run(ctx, now)
+}
@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/repository"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// uniqueName names a job after the test and the time, as runs stay in the test database.
+func uniqueName(t *testing.T) string {
+	return t.Name() + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+func TestRunJob(t *testing.T) {
+	name := uniqueName(t)
+	var failure error
+	scheduler := NewScheduler("test", time.Minute)
+	if err := scheduler.Add(Job{Name: name, Run: func(ctx context.Context, now time.Time) (string, error) {
+		if failure != nil {
+			return "", failure
+		}
+		return "done", nil
+	}}, ""); err != nil {
+		t.Fatalf("Could not add job: %v", err)
+	}
+	if err := scheduler.Add(Job{Name: name + "-panics", Run: func(ctx context.Context, now time.Time) (string, error) {
+		panic("out of ink")
+	}}, ""); err != nil {
+		t.Fatalf("Could not add job: %v", err)
+	}
+
+	run, err := scheduler.RunJob(name)
+	if err != nil || run.Status != domain.JobSucceeded || run.Message != "done" || run.Trigger != domain.TriggerManual || run.FinishedAt == nil {
+		t.Fatalf("Expected a successful run, got %+v, %v", run, err)
+	}
+	failure = errors.New("disk full")
+	if run, err = scheduler.RunJob(name); err != nil || run.Status != domain.JobFailed || run.Message != "disk full" {
+		t.Fatalf("Expected a failed run, got %+v, %v", run, err)
+	}
+	if run, err = scheduler.RunJob(name + "-panics"); err != nil || run.Status != domain.JobFailed || run.Message != "panic: out of ink" {
+		t.Fatalf("Expected a panic to fail the run, got %+v, %v", run, err)
+	}
+	if _, err = scheduler.RunJob("missing"); err != ErrUnknownJob {
+		t.Errorf("Expected %v, got %v", ErrUnknownJob, err)
+	}
+
+	// Another instance running the job holds its lock.
+	locked, err := repository.StartJobRun(domain.JobRun{Job: name, Trigger: domain.TriggerManual, Owner: "other", StartedAt: time.Now()}, time.Now().Add(time.Hour))
+	if err != nil || locked == nil {
+		t.Fatalf("Could not lock job: %v", err)
+	}
+	if _, err = scheduler.RunJob(name); err != ErrLocked {
+		t.Errorf("Expected %v, got %v", ErrLocked, err)
+	}
+
+	jobs, err := scheduler.Jobs()
+	if err != nil || len(jobs) != 2 || jobs[0].Name != name || len(jobs[0].Runs) != 3 || jobs[0].NextRunAt != nil {
+		t.Fatalf("Expected two unscheduled jobs with their runs, got %+v, %v", jobs, err)
+	}
+	if jobs[0].Runs[0].Status != domain.JobRunning || jobs[0].Runs[2].Message != "done" {
+		t.Errorf("Expected the runs newest first, got %+v", jobs[0].Runs)
+	}
+}
+
+func TestSchedulerRunsDueJobsOnceAndWaitsOnShutdown(t *testing.T) {
+	name := uniqueName(t)
+	started, stopped := make(chan time.Time, 10), make(chan struct{})
+	job := Job{Name: name, Run: func(ctx context.Context, now time.Time) (string, error) {
+		started <- now
+		<-ctx.Done()
+		close(stopped)
+		return "", ctx.Err()
+	}}
+	// Two instances sharing the database.
+	first, second := NewScheduler("first", time.Minute), NewScheduler("second", time.Minute)
+	for _, scheduler := range []*Scheduler{first, second} {
+		if err := scheduler.Add(job, "* * * * *"); err != nil {
+			t.Fatalf("Could not add job: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{}, 2)
+	for _, scheduler := range []*Scheduler{first, second} {
+		go func(scheduler *Scheduler) {
+			scheduler.Run(ctx)
+			done <- struct{}{}
+		}(scheduler)
+	}
+	// Both instances find the same run due, whichever minute they started in.
+	time.Sleep(50 * time.Millisecond)
+	slot := time.Now().Truncate(time.Minute).Add(time.Minute)
+	for _, scheduler := range []*Scheduler{first, second} {
+		scheduler.mu.Lock()
+		scheduler.entries[0].next = slot
+		scheduler.mu.Unlock()
+		scheduler.runDue(ctx, slot)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the job to start")
+	}
+	jobs, _ := first.Jobs()
+	if next := jobs[0].NextRunAt; next == nil || !next.Equal(slot.Add(time.Minute)) {
+		t.Errorf("Expected the next run at %v, got %v", slot.Add(time.Minute), next)
+	}
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the schedulers to stop")
+		}
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("Expected the scheduler to wait for the run to stop")
+	}
+	if len(started) != 0 {
+		t.Errorf("Expected the job to run once, it ran %v more times", len(started))
+	}
+	if _, err := first.RunJob(name); err != ErrStopped {
+		t.Errorf("Expected %v, got %v", ErrStopped, err)
+	}
+
+	runs, err := repository.GetJobRuns(name, 10)
+	if err != nil || len(runs) != 1 || runs[0].ScheduledAt == nil || !runs[0].ScheduledAt.Equal(slot) || runs[0].Status != domain.JobFailed {
+		t.Errorf("Expected one failed scheduled run, got %+v, %v", runs, err)
+	}
+}
+
+func TestBackUpKeepsTheLatestBackups(t *testing.T) {
+	directory, keep := config.BackupDirectory, config.BackupKeep
+	defer func() { config.BackupDirectory, config.BackupKeep = directory, keep }()
+	config.BackupDirectory, config.BackupKeep = t.TempDir(), 2
+
+	now := time.Date(2026, time.October, 14, 2, 0, 0, 0, time.UTC)
+	for day := 0; day < 3; day++ {
+		if _, err := backUp(context.Background(), now.AddDate(0, 0, day)); err != nil {
+			t.Fatalf("Could not back up: %v", err)
+		}
+	}
+	backups, _ := filepath.Glob(filepath.Join(config.BackupDirectory, "*"))
+	if len(backups) != 2 || filepath.Base(backups[0]) != "library-20261015T020000Z.db" {
+		t.Errorf("Expected the latest two backups, got %v", backups)
+	}
+}
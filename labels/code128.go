@@ -0,0 +1,83 @@
+package labels
+
+import (
+	"errors"
+)
+
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+	code128Modulo = 103
+	// code128Quiet is the number of light modules a reader needs on either side.
+	code128Quiet = 10
+)
+
+// ErrUnencodable is returned by Code128 for data which is empty or holds characters other
+// than printable ASCII.
+var ErrUnencodable = errors.New("barcode must be printable ASCII")
+
+// code128Patterns are the widths of the bars and spaces of every Code 128 symbol in
+// modules, starting with a bar, indexed by value. The last one is the stop symbol.
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Code128 encodes data as a Code 128 barcode and returns its modules from left to right,
+// true for bars, without the quiet zones. Data made of an even number of digits is
+// encoded with code set C, two digits a symbol, and anything else with code set B.
+func Code128(data string) ([]bool, error) {
+	if data == "" {
+		return nil, ErrUnencodable
+	}
+
+	values := []int{code128StartB}
+	if isDigits(data) && len(data)%2 == 0 {
+		values[0] = code128StartC
+		for i := 0; i < len(data); i += 2 {
+			values = append(values, int(data[i]-'0')*10+int(data[i+1]-'0'))
+		}
+	} else {
+		for i := 0; i < len(data); i++ {
+			if data[i] < ' ' || data[i] > '~' {
+				return nil, ErrUnencodable
+			}
+			values = append(values, int(data[i]-' '))
+		}
+	}
+
+	checksum := values[0]
+	for i, value := range values[1:] {
+		checksum += (i + 1) * value
+	}
+	values = append(values, checksum%code128Modulo, code128Stop)
+
+	var modules []bool
+	for _, value := range values {
+		for i, width := range code128Patterns[value] {
+			for j := 0; j < int(width-'0'); j++ {
+				modules = append(modules, i%2 == 0)
+			}
+		}
+	}
+	return modules, nil
+}
+
+func isDigits(data string) bool {
+	for i := 0; i < len(data); i++ {
+		if data[i] < '0' || data[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package labels
+
+import (
+	"bytes"
+	"encoding/xml"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+)
+
+const (
+	// pngDpi is the resolution of PNG labels, that of common label printers.
+	pngDpi       = 300
+	mmPerInch    = 25.4
+	svgFontStack = "Helvetica, Arial, sans-serif"
+)
+
+// renderSvg writes a drawing as an SVG document measured in millimetres.
+func renderSvg(d drawing) []byte {
+	var svg bytes.Buffer
+	width, height := svgNumber(d.width), svgNumber(d.height)
+	svg.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="` + width + `mm" height="` + height + `mm" viewBox="0 0 ` +
+		width + " " + height + `">` + "\n")
+	svg.WriteString(`<rect width="` + width + `" height="` + height + `" fill="#fff"/>` + "\n")
+	for _, r := range d.rects {
+		svg.WriteString(`<rect x="` + svgNumber(r.x) + `" y="` + svgNumber(r.y) + `" width="` + svgNumber(r.width) +
+			`" height="` + svgNumber(r.height) + `"/>` + "\n")
+	}
+	for _, t := range d.texts {
+		svg.WriteString(`<text x="` + svgNumber(t.x) + `" y="` + svgNumber(t.y) + `" font-size="` + svgNumber(t.size) +
+			`" font-family="` + svgFontStack + `">`)
+		_ = xml.EscapeText(&svg, []byte(t.value))
+		svg.WriteString("</text>\n")
+	}
+	svg.WriteString("</svg>\n")
+	return svg.Bytes()
+}
+
+func svgNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+}
+
+// renderPng rasterises a drawing at pngDpi in shades of grey. Text is set in a bitmap font
+// scaled to size, which printers handle well enough for a call number and a title.
+func renderPng(d drawing) ([]byte, error) {
+	scale := pngDpi / mmPerInch
+	canvas := image.NewGray(image.Rect(0, 0, pixels(d.width, scale), pixels(d.height, scale)))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	for _, r := range d.rects {
+		bounds := image.Rect(pixels(r.x, scale), pixels(r.y, scale), pixels(r.x+r.width, scale), pixels(r.y+r.height, scale))
+		draw.Draw(canvas, bounds, image.Black, image.Point{}, draw.Src)
+	}
+	for _, t := range d.texts {
+		drawText(canvas, t, scale)
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, canvas); err != nil {
+		return nil, err
+	}
+	return encoded.Bytes(), nil
+}
+
+func drawText(canvas draw.Image, t text, scale float64) {
+	face := basicfont.Face7x13
+	metrics := face.Metrics()
+	ascent, descent := metrics.Ascent.Ceil(), metrics.Descent.Ceil()
+	glyphs := image.NewAlpha(image.Rect(0, 0, font.MeasureString(face, t.value).Ceil(), ascent+descent))
+	drawer := font.Drawer{Dst: glyphs, Src: image.Opaque, Face: face, Dot: fixed.P(0, ascent)}
+	drawer.DrawString(t.value)
+
+	// The font is scaled so that its line, ascent and descent, is size high.
+	factor := t.size * scale / float64(ascent+descent)
+	x, baseline := t.x*scale, t.y*scale
+	bounds := image.Rect(int(math.Round(x)), int(math.Round(baseline-float64(ascent)*factor)),
+		int(math.Round(x+float64(glyphs.Bounds().Dx())*factor)), int(math.Round(baseline+float64(descent)*factor)))
+	mask := image.NewAlpha(bounds)
+	draw.BiLinear.Scale(mask, bounds, glyphs, glyphs.Bounds(), draw.Src, nil)
+	draw.DrawMask(canvas, bounds, image.NewUniform(color.Black), image.Point{}, mask, bounds.Min, draw.Over)
+}
+
+func pixels(millimetres float64, scale float64) int {
+	return int(math.Round(millimetres * scale))
+}
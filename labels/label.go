@@ -0,0 +1,260 @@
+// Package labels renders the spine and barcode labels of copies, a Code 128 barcode or a
+// QR code along with the call number and title, as PNG or SVG images or as PDF sheets laid
+// out for label stock. Barcodes, images and documents are all made here, in Go.
+package labels
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	SymbologyCode128 = "code128"
+	SymbologyQr      = "qr"
+
+	FormatPng = "png"
+	FormatSvg = "svg"
+	FormatPdf = "pdf"
+
+	margin = 2.0
+	// maxTextSize is the height of the text of a label, in millimetres, unless the label is
+	// too small for it.
+	maxTextSize = 3.0
+	lineSpacing = 1.3
+	// maxModule is the widest bar or module drawn, in millimetres, so short barcodes keep
+	// to the size scanners expect.
+	maxModule = 0.5
+	// charWidth is the average width of a character of the label font, in heights of the
+	// text, by which text is fit to its label.
+	charWidth = 0.55
+	ellipsis  = "..."
+)
+
+// ErrTooMany is returned by Sheet for more labels than fit the one page of an image.
+var ErrTooMany = errors.New("labels do not fit one sheet")
+
+// Label is what the label of a copy shows.
+type Label struct {
+	Barcode    string
+	CallNumber string
+	Title      string
+}
+
+// Symbologies and Formats list what Render and Sheet accept.
+var (
+	Symbologies = []string{SymbologyCode128, SymbologyQr}
+	Formats     = []string{FormatPng, FormatSvg, FormatPdf}
+)
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatPng:
+		return "image/png"
+	case FormatSvg:
+		return "image/svg+xml"
+	}
+	return "application/pdf"
+}
+
+// drawing is a page or a label made of black rectangles and lines of text, measured in
+// millimetres from its top left corner.
+type drawing struct {
+	width  float64
+	height float64
+	rects  []rect
+	texts  []text
+}
+
+type rect struct {
+	x, y, width, height float64
+}
+
+// text is a line of text whose baseline starts at x, y, size high.
+type text struct {
+	x, y, size float64
+	value      string
+}
+
+// place copies d into the drawing with its top left corner at x, y.
+func (d *drawing) place(label drawing, x float64, y float64) {
+	for _, r := range label.rects {
+		d.rects = append(d.rects, rect{r.x + x, r.y + y, r.width, r.height})
+	}
+	for _, t := range label.texts {
+		d.texts = append(d.texts, text{t.x + x, t.y + y, t.size, t.value})
+	}
+}
+
+// Render draws one label the size of those of stock.
+func Render(label Label, symbology string, format string, stock Stock) ([]byte, error) {
+	d, err := layout(label, symbology, stock.Width, stock.Height)
+	if err != nil {
+		return nil, err
+	}
+	return render([]drawing{d}, format)
+}
+
+// Sheet draws labels on sheets of stock, starting at label start of the first sheet, the
+// first one being 1, so partly used sheets can be printed on. PDFs take as many pages as
+// the labels need, while images are a single sheet.
+func Sheet(labels []Label, symbology string, format string, stock Stock, start int) ([]byte, error) {
+	offset := start - 1
+	if format != FormatPdf && offset+len(labels) > stock.PerSheet() {
+		return nil, ErrTooMany
+	}
+
+	var pages []drawing
+	for i, label := range labels {
+		n := offset + i
+		if n%stock.PerSheet() == 0 || len(pages) == 0 {
+			pages = append(pages, drawing{width: stock.PageWidth, height: stock.PageHeight})
+		}
+		d, err := layout(label, symbology, stock.Width, stock.Height)
+		if err != nil {
+			return nil, err
+		}
+		x, y := stock.position(n % stock.PerSheet())
+		pages[len(pages)-1].place(d, x, y)
+	}
+	if len(pages) == 0 {
+		pages = append(pages, drawing{width: stock.PageWidth, height: stock.PageHeight})
+	}
+	return render(pages, format)
+}
+
+func render(pages []drawing, format string) ([]byte, error) {
+	switch format {
+	case FormatPng:
+		return renderPng(pages[0])
+	case FormatSvg:
+		return renderSvg(pages[0]), nil
+	case FormatPdf:
+		return renderPdf(pages)
+	}
+	return nil, errors.New("unknown label format: " + format)
+}
+
+// layout draws a label width by height millimetres. A Code 128 label stacks the call
+// number, the barcode with its digits and the title, while a QR label sets the code, which
+// holds all three, beside them.
+func layout(label Label, symbology string, width float64, height float64) (drawing, error) {
+	d := drawing{width: width, height: height}
+	size := height / 9
+	if size > maxTextSize {
+		size = maxTextSize
+	}
+	line := size * lineSpacing
+
+	switch symbology {
+	case SymbologyCode128:
+		modules, err := Code128(label.Barcode)
+		if err != nil {
+			return drawing{}, err
+		}
+		textWidth := width - 2*margin
+		module := textWidth / float64(len(modules)+2*code128Quiet)
+		if module > maxModule {
+			module = maxModule
+		}
+		top := margin + line
+		barHeight := height - 2*margin - 3*line
+		d.texts = append(d.texts, text{margin, margin + size, size, fit(label.CallNumber, textWidth, size)})
+		d.rects = append(d.rects, runs(modules, margin+code128Quiet*module, top, module, barHeight)...)
+		d.texts = append(d.texts,
+			text{margin + code128Quiet*module, top + barHeight + size, size, label.Barcode},
+			text{margin, height - margin, size, fit(label.Title, textWidth, size)})
+	case SymbologyQr:
+		modules, err := QR(qrContent(label))
+		if err != nil {
+			return drawing{}, err
+		}
+		// Half the quiet zone is drawn, the margin of the label makes up the rest.
+		side := height - 2*margin
+		module := side / float64(len(modules)+qrQuiet)
+		for y, row := range modules {
+			d.rects = append(d.rects, runs(row, margin+qrQuiet/2*module, margin+float64(qrQuiet/2+y)*module, module, module)...)
+		}
+		x := margin + side + margin
+		textWidth := width - x - margin
+		d.texts = append(d.texts, text{x, margin + size, size, fit(label.CallNumber, textWidth, size)})
+		titleLines := int((height-2*margin)/line) - 2
+		for i, value := range wrap(label.Title, textWidth, size, titleLines) {
+			d.texts = append(d.texts, text{x, margin + size + float64(i+1)*line, size, value})
+		}
+		d.texts = append(d.texts, text{x, height - margin, size, fit(label.Barcode, textWidth, size)})
+	default:
+		return drawing{}, errors.New("unknown symbology: " + symbology)
+	}
+	return d, nil
+}
+
+// runs draws the dark modules of a row as one rectangle for each run of them.
+func runs(modules []bool, x float64, y float64, module float64, height float64) []rect {
+	var rects []rect
+	for i := 0; i < len(modules); i++ {
+		if !modules[i] {
+			continue
+		}
+		start := i
+		for i+1 < len(modules) && modules[i+1] {
+			i++
+		}
+		rects = append(rects, rect{x + float64(start)*module, y, float64(i-start+1) * module, height})
+	}
+	return rects
+}
+
+// qrContent is the barcode, call number and title of a label on a line each, the title
+// shortened until they fit a QR code.
+func qrContent(label Label) []byte {
+	content := label.Barcode + "\n" + label.CallNumber + "\n"
+	title := label.Title
+	for {
+		if _, err := QR([]byte(content + title)); err == nil || title == "" {
+			return []byte(content + title)
+		}
+		_, last := utf8.DecodeLastRuneInString(title)
+		title = title[:len(title)-last]
+	}
+}
+
+// fit shortens value, with an ellipsis, to about the characters which fit width.
+func fit(value string, width float64, size float64) string {
+	chars := int(width / (size * charWidth))
+	if utf8.RuneCountInString(value) <= chars {
+		return value
+	}
+	if chars <= len(ellipsis) {
+		return ""
+	}
+	return strings.TrimSpace(string([]rune(value)[:chars-len(ellipsis)])) + ellipsis
+}
+
+// wrap breaks value into at most lines lines which fit width, shortening the last one.
+func wrap(value string, width float64, size float64, lines int) []string {
+	if lines <= 0 {
+		return nil
+	}
+	chars := int(width / (size * charWidth))
+	var wrapped []string
+	current := ""
+	words := strings.Fields(value)
+	for i, word := range words {
+		next := strings.TrimSpace(current + " " + word)
+		if utf8.RuneCountInString(next) <= chars || current == "" {
+			current = next
+			continue
+		}
+		if len(wrapped) == lines-1 {
+			return append(wrapped, fit(current+" "+strings.Join(words[i:], " "), width, size))
+		}
+		wrapped = append(wrapped, current)
+		current = word
+	}
+	if current != "" && len(wrapped) < lines {
+		wrapped = append(wrapped, fit(current, width, size))
+	}
+	return wrapped
+}
@@ -0,0 +1,194 @@
+package labels
+
+import (
+	"bytes"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCode128Patterns(t *testing.T) {
+	t.Parallel()
+	seen := map[string]bool{}
+	for value, pattern := range code128Patterns {
+		modules, bars := 0, 0
+		for i, width := range pattern {
+			modules += int(width - '0')
+			if i%2 == 0 {
+				bars += int(width - '0')
+			}
+		}
+		if value == code128Stop {
+			if modules != 13 {
+				t.Errorf("Expected the stop pattern to be 13 modules, got %v", modules)
+			}
+		} else if modules != 11 || bars%2 != 0 || seen[pattern] {
+			t.Errorf("Expected pattern %v to be 11 unique modules with an even number of bars, got %v", value, pattern)
+		}
+		seen[pattern] = true
+	}
+}
+
+func TestCode128(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		data    string
+		modules int
+		err     error
+	}{
+		// Start, 7 symbols of set C, checksum and stop.
+		{"31234000123456", 11*9 + 13, nil},
+		// Start, 7 symbols of set B, checksum and stop.
+		{"1234567", 11*9 + 13, nil},
+		{"ABC-123", 11*9 + 13, nil},
+		{"", 0, ErrUnencodable},
+		{"Café", 0, ErrUnencodable},
+		{"A\tB", 0, ErrUnencodable},
+	}
+
+	for _, scenario := range scenarios {
+		modules, err := Code128(scenario.data)
+		if err != scenario.err || len(modules) != scenario.modules {
+			t.Errorf("Expected %v modules and error %v for %q, got %v and %v", scenario.modules, scenario.err, scenario.data, len(modules), err)
+		}
+	}
+
+	// 31234000123456 with the start pattern of set C, 211232.
+	modules, _ := Code128("31234000123456")
+	if got := modulesString(modules[:11]); got != "11010011100" {
+		t.Errorf("Expected digits to be encoded with code set C, got %v", got)
+	}
+}
+
+func TestRsRemainder(t *testing.T) {
+	t.Parallel()
+	// HELLO WORLD as a version 1-M QR code.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, 10); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected error correction codewords %v, got %v", expected, got)
+	}
+}
+
+func TestQrBits(t *testing.T) {
+	t.Parallel()
+	if got := qrFormatBits(0); got != 0b101010000010010 {
+		t.Errorf("Expected the format bits of level M with mask 0, got %b", got)
+	}
+	if got := qrVersionBits(7); got != 0x07C94 {
+		t.Errorf("Expected the version bits of version 7, got %x", got)
+	}
+}
+
+func TestQR(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		data string
+		size int
+		err  error
+	}{
+		{"HELLO", 21, nil},
+		{strings.Repeat("x", 14), 21, nil},
+		{strings.Repeat("x", 15), 25, nil},
+		{strings.Repeat("x", 213), 57, nil},
+		{strings.Repeat("x", 214), 0, ErrTooLong},
+	}
+
+	for _, scenario := range scenarios {
+		modules, err := QR([]byte(scenario.data))
+		if err != scenario.err || len(modules) != scenario.size {
+			t.Errorf("Expected size %v and error %v for %v bytes, got %v and %v", scenario.size, scenario.err, len(scenario.data), len(modules), err)
+			continue
+		}
+		if err == nil && (!modules[0][0] || !modules[6][6] || modules[7][7] || !modules[len(modules)-8][8]) {
+			t.Errorf("Expected the finder patterns and dark module for %v bytes", len(scenario.data))
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	label := Label{Barcode: "31234000123456", CallNumber: "005.133 DON", Title: "The Go Programming Language"}
+	stock := Stocks["avery-l7160"]
+
+	for _, symbology := range Symbologies {
+		image, err := Render(label, symbology, FormatPng, stock)
+		if err != nil {
+			t.Fatalf("Expected a %v PNG, got %v", symbology, err)
+		}
+		decoded, err := png.Decode(bytes.NewReader(image))
+		if err != nil || decoded.Bounds().Dx() != 750 || decoded.Bounds().Dy() != 450 {
+			t.Errorf("Expected a %v PNG of 750 by 450 pixels, got %v", symbology, err)
+		}
+
+		svg, err := Render(label, symbology, FormatSvg, stock)
+		if err != nil || !bytes.HasPrefix(svg, []byte("<svg")) || !bytes.Contains(svg, []byte("005.133 DON")) {
+			t.Errorf("Expected a %v SVG with the call number, got %v", symbology, err)
+		}
+	}
+
+	if _, err := Render(Label{Barcode: "Café"}, SymbologyCode128, FormatSvg, stock); err != ErrUnencodable {
+		t.Errorf("Expected an unencodable barcode to be refused, got %v", err)
+	}
+	svg, _ := Render(Label{Barcode: "1", Title: "D&D <3"}, SymbologyQr, FormatSvg, stock)
+	if !bytes.Contains(svg, []byte("D&amp;D &lt;3")) {
+		t.Errorf("Expected the title to be escaped, got %s", svg)
+	}
+}
+
+func TestSheet(t *testing.T) {
+	t.Parallel()
+	stock := Stocks["avery-l7160"]
+	labels := make([]Label, 40)
+	for i := range labels {
+		labels[i] = Label{Barcode: "3123400012345" + string(rune('0'+i%10)), CallNumber: "823 TOL", Title: "The Hobbit (Illustrated)"}
+	}
+
+	pdf, err := Sheet(labels, SymbologyCode128, FormatPdf, stock, 10)
+	if err != nil || !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("Expected a PDF, got %v", err)
+	}
+	// 40 labels from the 10th of 21 take 3 pages.
+	if !bytes.Contains(pdf, []byte("/Count 3 ")) {
+		t.Errorf("Expected the labels to take 3 pages")
+	}
+
+	if _, err = Sheet(labels, SymbologyQr, FormatSvg, stock, 1); err != ErrTooMany {
+		t.Errorf("Expected more labels than fit a sheet to be refused as SVG, got %v", err)
+	}
+	if _, err = Sheet(labels[:12], SymbologyQr, FormatPng, stock, 11); err != ErrTooMany {
+		t.Errorf("Expected labels past the end of the sheet to be refused as PNG, got %v", err)
+	}
+	svg, err := Sheet(labels[:12], SymbologyQr, FormatSvg, stock, 10)
+	if err != nil || !bytes.Contains(svg, []byte(`viewBox="0 0 210 297"`)) {
+		t.Errorf("Expected an A4 sheet, got %v", err)
+	}
+}
+
+func TestFitAndWrap(t *testing.T) {
+	t.Parallel()
+	// 10 mm fits 6 characters 3 mm high.
+	if got := fit("Dune", 10, 3); got != "Dune" {
+		t.Errorf("Expected a short value to fit, got %v", got)
+	}
+	if got := fit("Dune Messiah", 10, 3); got != "Dun..." {
+		t.Errorf("Expected a long value to be shortened, got %v", got)
+	}
+	expected := []string{"The", "Left", "Han..."}
+	if got := wrap("The Left Hand of Darkness", 10, 3, 3); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func modulesString(modules []bool) string {
+	var s strings.Builder
+	for _, module := range modules {
+		if module {
+			s.WriteByte('1')
+		} else {
+			s.WriteByte('0')
+		}
+	}
+	return s.String()
+}
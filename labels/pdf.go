@@ -0,0 +1,94 @@
+package labels
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"strconv"
+	"strings"
+)
+
+// pointsPerMm converts the millimetres of a drawing to PDF points.
+const pointsPerMm = 72 / mmPerInch
+
+// pdfEscaper escapes the delimiters of PDF literal strings.
+var pdfEscaper = strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+
+// renderPdf writes the drawings as the pages of a PDF document. Text is set in Helvetica,
+// one of the fonts every PDF reader has, so nothing needs embedding.
+func renderPdf(pages []drawing) ([]byte, error) {
+	// Objects 1 and 2 are the catalog and the page tree, 3 the font, and each page then
+	// takes two, itself and its content.
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+	var kids []string
+	for _, page := range pages {
+		content, err := pdfContent(page)
+		if err != nil {
+			return nil, err
+		}
+		pageObject := len(objects) + 1
+		kids = append(kids, strconv.Itoa(pageObject)+" 0 R")
+		objects = append(objects,
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 "+pdfNumber(page.width*pointsPerMm)+" "+pdfNumber(page.height*pointsPerMm)+
+				"] /Resources << /Font << /F1 3 0 R >> >> /Contents "+strconv.Itoa(pageObject+1)+" 0 R >>",
+			"<< /Length "+strconv.Itoa(len(content))+" /Filter /FlateDecode >>\nstream\n"+string(content)+"\nendstream")
+	}
+	objects[1] = "<< /Type /Pages /Kids [" + strings.Join(kids, " ") + "] /Count " + strconv.Itoa(len(pages)) + " >>"
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		pdf.WriteString(strconv.Itoa(i+1) + " 0 obj\n" + object + "\nendobj\n")
+	}
+	xref := pdf.Len()
+	pdf.WriteString("xref\n0 " + strconv.Itoa(len(objects)+1) + "\n0000000000 65535 f \n")
+	for _, offset := range offsets {
+		pdf.WriteString(fmt.Sprintf("%010d 00000 n \n", offset))
+	}
+	pdf.WriteString("trailer\n<< /Size " + strconv.Itoa(len(objects)+1) + " /Root 1 0 R >>\nstartxref\n" +
+		strconv.Itoa(xref) + "\n%%EOF\n")
+	return pdf.Bytes(), nil
+}
+
+// pdfContent draws a page as a compressed content stream. PDF measures from the bottom left
+// corner, so y is flipped.
+func pdfContent(page drawing) ([]byte, error) {
+	var content bytes.Buffer
+	height := page.height * pointsPerMm
+	content.WriteString("0 g\n")
+	for _, r := range page.rects {
+		content.WriteString(pdfNumber(r.x*pointsPerMm) + " " + pdfNumber(height-(r.y+r.height)*pointsPerMm) + " " +
+			pdfNumber(r.width*pointsPerMm) + " " + pdfNumber(r.height*pointsPerMm) + " re f\n")
+	}
+	encoder := encoding.ReplaceUnsupported(charmap.Windows1252.NewEncoder())
+	for _, t := range page.texts {
+		value, err := encoder.String(t.value)
+		if err != nil {
+			return nil, err
+		}
+		content.WriteString("BT /F1 " + pdfNumber(t.size*pointsPerMm) + " Tf " + pdfNumber(t.x*pointsPerMm) + " " +
+			pdfNumber(height-t.y*pointsPerMm) + " Td (" + pdfEscaper.Replace(value) + ") Tj ET\n")
+	}
+
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	if _, err := writer.Write(content.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func pdfNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
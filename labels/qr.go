@@ -0,0 +1,430 @@
+package labels
+
+import (
+	"errors"
+)
+
+const (
+	qrModeByte = 4
+	// qrQuiet is the number of light modules a reader needs around a QR code.
+	qrQuiet = 4
+)
+
+// ErrTooLong is returned by QR for data which does not fit the largest version it makes.
+var ErrTooLong = errors.New("data does not fit a QR code")
+
+// qrVersion holds the layout of a QR code version at error correction level M, which
+// recovers about 15% of the code, enough for labels scuffed on the shelf.
+type qrVersion struct {
+	ecPerBlock int
+	// blocks holds the number of data codewords of each error correction block.
+	blocks []int
+	// alignment holds the centres of the alignment patterns along either axis.
+	alignment []int
+}
+
+// qrVersions are versions 1 to 10, up to 57 by 57 modules, which hold 213 bytes: more
+// than a label needs and as dense as a label printer prints legibly.
+var qrVersions = []qrVersion{
+	{10, []int{16}, nil},
+	{16, []int{28}, []int{6, 18}},
+	{26, []int{44}, []int{6, 22}},
+	{18, []int{32, 32}, []int{6, 26}},
+	{24, []int{43, 43}, []int{6, 30}},
+	{16, []int{27, 27, 27, 27}, []int{6, 34}},
+	{18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	{22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	{22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	{26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	// The Galois field GF(256) of the Reed-Solomon codes, with x^8+x^4+x^3+x^2+1.
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+// QR encodes data in byte mode as the smallest QR code at level M which holds it, and
+// returns its modules by row, true for dark ones, without the quiet zone.
+func QR(data []byte) ([][]bool, error) {
+	for i, version := range qrVersions {
+		capacity := 0
+		for _, block := range version.blocks {
+			capacity += block
+		}
+		countBits := 8
+		if i+1 >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) > 8*capacity {
+			continue
+		}
+		return qrMatrix(i+1, version, qrCodewords(data, version, countBits, capacity)), nil
+	}
+	return nil, ErrTooLong
+}
+
+// qrCodewords returns the data codewords, padded to capacity, interleaved with their
+// error correction codewords.
+func qrCodewords(data []byte, version qrVersion, countBits int, capacity int) []byte {
+	var bits bitBuffer
+	bits.append(qrModeByte, 4)
+	bits.append(len(data), countBits)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	terminator := 8*capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < 8*capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := bits.bytes()
+	var blocks, ecBlocks [][]byte
+	for _, size := range version.blocks {
+		blocks = append(blocks, codewords[:size])
+		ecBlocks = append(ecBlocks, rsRemainder(codewords[:size], version.ecPerBlock))
+		codewords = codewords[size:]
+	}
+
+	var interleaved []byte
+	for i := 0; i < version.blocks[len(version.blocks)-1]; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				interleaved = append(interleaved, block[i])
+			}
+		}
+	}
+	for i := 0; i < version.ecPerBlock; i++ {
+		for _, ec := range ecBlocks {
+			interleaved = append(interleaved, ec[i])
+		}
+	}
+	return interleaved
+}
+
+// qrMatrix lays out the function patterns and codewords of a QR code, masked with
+// whichever of the eight masks leaves the fewest patterns which confuse readers.
+func qrMatrix(versionNumber int, version qrVersion, codewords []byte) [][]bool {
+	var best [][]bool
+	bestPenalty := -1
+	for mask := 0; mask < 8; mask++ {
+		q := newQrCode(versionNumber, version)
+		q.placeCodewords(codewords, mask)
+		q.placeFormat(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = q.modules, penalty
+		}
+	}
+	return best
+}
+
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	reserved [][]bool
+}
+
+func newQrCode(versionNumber int, version qrVersion) *qrCode {
+	size := 17 + 4*versionNumber
+	q := &qrCode{size: size, modules: make([][]bool, size), reserved: make([][]bool, size)}
+	for y := range q.modules {
+		q.modules[y] = make([]bool, size)
+		q.reserved[y] = make([]bool, size)
+	}
+
+	for _, corner := range [][2]int{{0, 0}, {size - 7, 0}, {0, size - 7}} {
+		// The separator around each finder pattern is reserved along with it.
+		for dy := -1; dy <= 7; dy++ {
+			for dx := -1; dx <= 7; dx++ {
+				distance := max(abs(dx-3), abs(dy-3))
+				q.set(corner[0]+dx, corner[1]+dy, distance != 2 && distance <= 3)
+			}
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		q.set(i, 6, i%2 == 0)
+		q.set(6, i, i%2 == 0)
+	}
+	last := len(version.alignment) - 1
+	for i, y := range version.alignment {
+		for j, x := range version.alignment {
+			// Alignment patterns would overlap the finder patterns in three corners.
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format information, which is placed once the mask is chosen.
+	q.placeFormat(0)
+	if versionNumber >= 7 {
+		bits := qrVersionBits(versionNumber)
+		for i := 0; i < 18; i++ {
+			dark := bits>>uint(i)&1 == 1
+			q.set(size-11+i%3, i/3, dark)
+			q.set(i/3, size-11+i%3, dark)
+		}
+	}
+	return q
+}
+
+// set places a module of a function pattern, ignoring those outside the code.
+func (q *qrCode) set(x int, y int, dark bool) {
+	if x < 0 || y < 0 || x >= q.size || y >= q.size {
+		return
+	}
+	q.modules[y][x] = dark
+	q.reserved[y][x] = true
+}
+
+// placeFormat places both copies of the error correction level, M, and the mask along with
+// the dark module.
+func (q *qrCode) placeFormat(mask int) {
+	bits := qrFormatBits(mask)
+	bit := func(i int) bool {
+		return bits>>uint(i)&1 == 1
+	}
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// qrFormatBits returns the level, M, and the mask protected by a BCH code and masked so
+// that they are never all light.
+func qrFormatBits(mask int) int {
+	data := mask // Level M is 00.
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = remainder<<1 ^ (remainder>>9)*0x537
+	}
+	return (data<<10 | remainder) ^ 0x5412
+}
+
+// qrVersionBits returns the version protected by a BCH code, which versions 7 and up
+// carry as well.
+func qrVersionBits(versionNumber int) int {
+	remainder := versionNumber
+	for i := 0; i < 12; i++ {
+		remainder = remainder<<1 ^ (remainder>>11)*0x1F25
+	}
+	return versionNumber<<12 | remainder
+}
+
+// placeCodewords fills the modules left by the function patterns with the codewords, two
+// columns at a time in a zigzag from the bottom right corner, masking them as it goes.
+func (q *qrCode) placeCodewords(codewords []byte, mask int) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// The vertical timing pattern is skipped whole.
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vertical := 0; vertical < q.size; vertical++ {
+			y := vertical
+			if upward {
+				y = q.size - 1 - vertical
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if q.reserved[y][x] {
+					continue
+				}
+				dark := false
+				if i < 8*len(codewords) {
+					dark = codewords[i/8]>>uint(7-i%8)&1 == 1
+					i++
+				}
+				q.modules[y][x] = dark != masked(mask, x, y)
+			}
+		}
+	}
+}
+
+func masked(mask int, x int, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	}
+	return ((x+y)%2+x*y%3)%2 == 0
+}
+
+// penalty scores the patterns of a masked code which readers could mistake: long runs,
+// blocks of one color, look-alikes of the finder patterns and an unbalanced share of dark
+// modules.
+func (q *qrCode) penalty() int {
+	penalty := 0
+	dark := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for a := 0; a < q.size; a++ {
+		rowRun, columnRun := 1, 1
+		for b := 0; b < q.size; b++ {
+			if q.modules[a][b] {
+				dark++
+			}
+			if b > 0 {
+				rowRun, penalty = qrRun(q.modules[a][b] == q.modules[a][b-1], rowRun, penalty)
+				columnRun, penalty = qrRun(q.modules[b][a] == q.modules[b-1][a], columnRun, penalty)
+			}
+			if a > 0 && b > 0 {
+				color := q.modules[a][b]
+				if q.modules[a-1][b] == color && q.modules[a][b-1] == color && q.modules[a-1][b-1] == color {
+					penalty += 3
+				}
+			}
+			for _, pattern := range finderLike {
+				if b+len(pattern) > q.size {
+					continue
+				}
+				inRow, inColumn := true, true
+				for k, module := range pattern {
+					inRow = inRow && q.modules[a][b+k] == module
+					inColumn = inColumn && q.modules[b+k][a] == module
+				}
+				if inRow {
+					penalty += 40
+				}
+				if inColumn {
+					penalty += 40
+				}
+			}
+		}
+		penalty = qrRunEnd(rowRun, penalty)
+		penalty = qrRunEnd(columnRun, penalty)
+	}
+	total := q.size * q.size
+	penalty += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return penalty
+}
+
+// qrRun extends or ends a run of modules of one color, scoring runs of five and more.
+func qrRun(same bool, run int, penalty int) (int, int) {
+	if same {
+		return run + 1, penalty
+	}
+	return 1, qrRunEnd(run, penalty)
+}
+
+func qrRunEnd(run int, penalty int) int {
+	if run >= 5 {
+		penalty += 3 + run - 5
+	}
+	return penalty
+}
+
+// rsRemainder returns the n Reed-Solomon error correction codewords of data.
+func rsRemainder(data []byte, n int) []byte {
+	generator := []byte{1}
+	for i := 0; i < n; i++ {
+		next := make([]byte, len(generator)+1)
+		for j, coefficient := range generator {
+			next[j] ^= coefficient
+			next[j+1] ^= gfMul(coefficient, gfExp[i])
+		}
+		generator = next
+	}
+
+	remainder := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ remainder[0]
+		copy(remainder, remainder[1:])
+		remainder[n-1] = 0
+		for i := range remainder {
+			remainder[i] ^= gfMul(generator[i+1], factor)
+		}
+	}
+	return remainder
+}
+
+func gfMul(a byte, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value int, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, value>>uint(i)&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	data := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			data[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return data
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
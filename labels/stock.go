@@ -0,0 +1,37 @@
+package labels
+
+// Stock is a sheet of label stock, measured in millimetres from the top left corner of
+// the page. Labels are numbered from 1 along the rows.
+type Stock struct {
+	Name            string
+	PageWidth       float64
+	PageHeight      float64
+	Width           float64
+	Height          float64
+	Columns         int
+	Rows            int
+	Left            float64
+	Top             float64
+	HorizontalPitch float64
+	VerticalPitch   float64
+}
+
+// Stocks are the label stocks labels are laid out for, by name.
+var Stocks = map[string]Stock{
+	// 21 labels of 63.5 by 38.1 mm on A4.
+	"avery-l7160": {Name: "avery-l7160", PageWidth: 210, PageHeight: 297, Width: 63.5, Height: 38.1, Columns: 3, Rows: 7,
+		Left: 7.2, Top: 15.15, HorizontalPitch: 66.04, VerticalPitch: 38.1},
+	// 30 labels of 2 5/8 by 1 inch on US Letter.
+	"avery-5160": {Name: "avery-5160", PageWidth: 215.9, PageHeight: 279.4, Width: 66.675, Height: 25.4, Columns: 3, Rows: 10,
+		Left: 4.7625, Top: 12.7, HorizontalPitch: 69.85, VerticalPitch: 25.4},
+}
+
+// PerSheet returns the number of labels of a sheet.
+func (s Stock) PerSheet() int {
+	return s.Columns * s.Rows
+}
+
+// position returns the top left corner of label n of a sheet, counting from 0.
+func (s Stock) position(n int) (float64, float64) {
+	return s.Left + float64(n%s.Columns)*s.HorizontalPitch, s.Top + float64(n/s.Columns)*s.VerticalPitch
+}
@@ -0,0 +1,5 @@
+// Package librarypb holds the protobuf messages and gRPC stubs of the library service,
+// generated from library.proto.
+package librarypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative library.proto
@@ -0,0 +1,52 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/validation"
+	"io/ioutil"
+)
+
+// File looks books up in a JSON file holding a list of them, written as the BookDetails
+// of version 1 of the API, such as an export of a union catalogue:
+//
+//	[{"Isbn":"978-0-547-77374-2","Title":"A Wizard of Earthsea","Author":"Ursula K. Le Guin",
+//	  "Publisher":"Houghton Mifflin","Year":2012,"Pages":264}]
+//
+// The file is read once, when the provider is made.
+type File struct {
+	books map[string]domain.BookDetails
+}
+
+func NewFile(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var books []domain.BookDetails
+	if err = json.Unmarshal(data, &books); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+
+	file := &File{books: map[string]domain.BookDetails{}}
+	for _, book := range books {
+		isbn := validation.NormalizeIsbn(book.Isbn)
+		if isbn == "" {
+			return nil, errors.New(path + ": " + book.Isbn + " is not a valid ISBN")
+		}
+		book.Isbn = isbn
+		book.Source = ProviderFile
+		file.books[isbn] = book
+	}
+	return file, nil
+}
+
+func (f *File) Lookup(ctx context.Context, isbn string) (domain.BookDetails, error) {
+	book, found := f.books[isbn]
+	if !found {
+		return domain.BookDetails{}, ErrNotFound
+	}
+	return book, nil
+}
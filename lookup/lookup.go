@@ -0,0 +1,60 @@
+// Package lookup finds the publication details of books by ISBN through a metadata
+// provider: an Open Library compatible web service, or a file kept by the library.
+package lookup
+
+import (
+	"context"
+	"errors"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ProviderOpenLibrary = "openlibrary"
+	ProviderFile        = "file"
+
+	// authorSeparator joins the authors a provider lists, as credits.Format does.
+	authorSeparator = " & "
+)
+
+// ErrNotFound is returned by Lookup for ISBNs the provider knows no book of.
+var ErrNotFound = errors.New("no book found with this ISBN")
+
+var yearPattern = regexp.MustCompile(`\b\d{4}\b`)
+
+// Provider finds the details of the book with an ISBN, which is given as the 13 digits
+// validation.NormalizeIsbn returns. The details name the provider as their Source.
+type Provider interface {
+	Lookup(ctx context.Context, isbn string) (domain.BookDetails, error)
+}
+
+// New returns the provider chosen by lookups.provider in config.yml.
+func New() (Provider, error) {
+	switch config.LookupProvider {
+	case ProviderOpenLibrary:
+		return NewOpenLibrary(config.LookupUrl, config.LookupTimeout), nil
+	case ProviderFile:
+		return NewFile(config.LookupFile)
+	}
+	return nil, errors.New("unknown lookup provider: " + config.LookupProvider + ", expected " + ProviderOpenLibrary + " or " + ProviderFile)
+}
+
+// Year returns the first year written in a publication date such as "March 3, 1968", 0
+// when it has none.
+func Year(date string) int {
+	year, _ := strconv.Atoi(yearPattern.FindString(date))
+	return year
+}
+
+func joinAuthors(names []string) string {
+	var authors []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	return strings.Join(authors, authorSeparator)
+}
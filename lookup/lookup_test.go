@@ -0,0 +1,80 @@
+package lookup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenLibrary(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/api/books" || query.Get("format") != "json" || query.Get("jscmd") != "data" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch query.Get("bibkeys") {
+		case "ISBN:9780547773742":
+			_, _ = w.Write([]byte(`{"ISBN:9780547773742":{"title":"A Wizard of Earthsea","authors":[{"name":"Ursula K. Le Guin"}],
+				"publishers":[{"name":"Houghton Mifflin Harcourt"}],"publish_date":"September 11, 2012","number_of_pages":264}}`))
+		case "ISBN:9780000000002":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+	provider := NewOpenLibrary(server.URL+"/", time.Second)
+
+	details, err := provider.Lookup(context.Background(), "9780547773742")
+	if err != nil {
+		t.Fatalf("Expected the book to be found, got %v", err)
+	}
+	if details.Title != "A Wizard of Earthsea" || details.Author != "Ursula K. Le Guin" || details.Publisher != "Houghton Mifflin Harcourt" ||
+		details.Year != 2012 || details.Pages != 264 || details.Source != ProviderOpenLibrary {
+		t.Errorf("Expected the details of the book, got %+v", details)
+	}
+	if _, err = provider.Lookup(context.Background(), "9780306406157"); err != ErrNotFound {
+		t.Errorf("Expected an unknown ISBN not to be found, got %v", err)
+	}
+	if _, err = provider.Lookup(context.Background(), "9780000000002"); err == nil || err == ErrNotFound {
+		t.Errorf("Expected a failing provider to be reported, got %v", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "isbn.json")
+	_ = os.WriteFile(path, []byte(`[{"Isbn":"0-306-40615-2","Title":"Book","Publisher":"Plenum","Year":1980}]`), 0644)
+	provider, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("Expected the file to be read, got %v", err)
+	}
+
+	details, err := provider.Lookup(context.Background(), "9780306406157")
+	if err != nil || details.Isbn != "9780306406157" || details.Publisher != "Plenum" || details.Source != ProviderFile {
+		t.Errorf("Expected the book to be found by its ISBN-13, got %+v, %v", details, err)
+	}
+	if _, err = provider.Lookup(context.Background(), "9780547773742"); err != ErrNotFound {
+		t.Errorf("Expected an unknown ISBN not to be found, got %v", err)
+	}
+
+	_ = os.WriteFile(path, []byte(`[{"Isbn":"0-306-40615-3"}]`), 0644)
+	if _, err = NewFile(path); err == nil {
+		t.Errorf("Expected an invalid ISBN to be refused")
+	}
+}
+
+func TestYear(t *testing.T) {
+	t.Parallel()
+	for date, year := range map[string]int{"1968": 1968, "March 3, 1968": 1968, "1968-03-03": 1968, "c. 1850s": 0, "": 0} {
+		if got := Year(date); got != year {
+			t.Errorf("Expected year %v of %q, got %v", year, date, got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-rest-webservices-book-library/domain"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResponseBytes bounds the answers read from a provider, which describe one book.
+const maxResponseBytes = 1 << 20
+
+// OpenLibrary looks books up with the Books API of Open Library, or of any service
+// answering it the same way, below baseUrl.
+type OpenLibrary struct {
+	baseUrl string
+	client  *http.Client
+}
+
+type openLibraryBook struct {
+	Title         string            `json:"title"`
+	Subtitle      string            `json:"subtitle"`
+	Authors       []openLibraryName `json:"authors"`
+	Publishers    []openLibraryName `json:"publishers"`
+	PublishDate   string            `json:"publish_date"`
+	NumberOfPages int               `json:"number_of_pages"`
+}
+
+type openLibraryName struct {
+	Name string `json:"name"`
+}
+
+func NewOpenLibrary(baseUrl string, timeout time.Duration) *OpenLibrary {
+	return &OpenLibrary{baseUrl: strings.TrimSuffix(baseUrl, "/"), client: &http.Client{Timeout: timeout}}
+}
+
+func (o *OpenLibrary) Lookup(ctx context.Context, isbn string) (domain.BookDetails, error) {
+	key := "ISBN:" + isbn
+	query := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"data"}}
+	r, err := http.NewRequestWithContext(ctx, "GET", o.baseUrl+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return domain.BookDetails{}, err
+	}
+	r.Header.Set("Accept", "application/json")
+	response, err := o.client.Do(r)
+	if err != nil {
+		return domain.BookDetails{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return domain.BookDetails{}, errors.New("open library answered with status " + strconv.Itoa(response.StatusCode))
+	}
+
+	// The answer maps each of the bibkeys asked for to its book, and leaves out the ones
+	// it knows no book of.
+	var books map[string]openLibraryBook
+	if err = json.NewDecoder(io.LimitReader(response.Body, maxResponseBytes)).Decode(&books); err != nil {
+		return domain.BookDetails{}, errors.New("malformed open library answer: " + err.Error())
+	}
+	book, found := books[key]
+	if !found {
+		return domain.BookDetails{}, ErrNotFound
+	}
+
+	details := domain.BookDetails{
+		Isbn:   isbn,
+		Title:  strings.TrimSpace(book.Title),
+		Year:   Year(book.PublishDate),
+		Pages:  book.NumberOfPages,
+		Source: ProviderOpenLibrary,
+	}
+	if subtitle := strings.TrimSpace(book.Subtitle); subtitle != "" {
+		details.Title += ": " + subtitle
+	}
+	var authors []string
+	for _, author := range book.Authors {
+		authors = append(authors, author.Name)
+	}
+	details.Author = joinAuthors(authors)
+	if len(book.Publishers) > 0 {
+		details.Publisher = strings.TrimSpace(book.Publishers[0].Name)
+	}
+	return details, nil
+}
@@ -1,31 +1,75 @@
 package main
 
 import (
-	"github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
+	"context"
 	"go-rest-webservices-book-library/config"
-	"go-rest-webservices-book-library/services"
+	"go-rest-webservices-book-library/grpcserver"
+	"go-rest-webservices-book-library/jobs"
+	"go-rest-webservices-book-library/router"
+	"go-rest-webservices-book-library/webhooks"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	logFile := config.LogFile
-	router := mux.NewRouter()
+	// Background work stops on the first interrupt, requests get until the shutdown timeout.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	router.Handle(
-		"/books",
-		handlers.LoggingHandler(logFile, http.HandlerFunc(services.GetAllBooksHandler))).
-		Methods("GET")
+	grpcServer := grpcserver.New()
+	if config.GrpcPort != "" {
+		listener, err := net.Listen("tcp", config.GrpcPort)
+		if err != nil {
+			log.Fatal("Error while listening for gRPC " + err.Error())
+		}
+		go func() {
+			_ = grpcServer.Serve(listener)
+		}()
+	}
 
-	router.Handle(
-		"/book",
-		handlers.LoggingHandler(logFile, http.HandlerFunc(services.AddBookHandler))).
-		Methods("POST")
+	go webhooks.NewDispatcher().Run(ctx)
 
-	router.Handle(
-		"/book/{id}",
-		handlers.LoggingHandler(logFile, http.HandlerFunc(services.BookHandler))).
-		Methods("GET", "DELETE", "PUT")
+	jobsDone := make(chan struct{})
+	go func() {
+		if config.JobsEnabled {
+			jobs.Library.Run(ctx)
+		}
+		close(jobsDone)
+	}()
 
-	_ = http.ListenAndServe(config.ServerPort, router)
+	server := &http.Server{Addr: config.ServerPort, Handler: router.New()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Error while serving " + err.Error())
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error while shutting down " + err.Error())
+	}
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	for _, done := range []chan struct{}{grpcStopped, jobsDone} {
+		select {
+		case <-done:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+			log.Println("Stopped before the running calls and jobs finished")
+			return
+		}
+	}
 }
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"github.com/gorilla/handlers"
+	"go-rest-webservices-book-library/config"
+	"net/http"
+)
+
+// Cors builds the CORS middleware from the cors section of config.yml. Preflight
+// requests are answered here, before they reach the router, so routes only need
+// to declare the methods they actually serve. Browsers only let scripts read the
+// response headers which are exposed, such as Link and Idempotent-Replayed, and only
+// send cookies when credentials are allowed.
+func Cors() func(http.Handler) http.Handler {
+	if len(config.CorsAllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	options := []handlers.CORSOption{
+		handlers.AllowedOrigins(config.CorsAllowedOrigins),
+		handlers.AllowedMethods(config.CorsAllowedMethods),
+		handlers.AllowedHeaders(config.CorsAllowedHeaders),
+		handlers.ExposedHeaders(config.CorsExposedHeaders),
+		handlers.MaxAge(config.CorsMaxAge),
+	}
+	if config.CorsAllowCredentials {
+		options = append(options, handlers.AllowCredentials())
+	}
+	return handlers.CORS(options...)
+}
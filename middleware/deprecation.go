@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"go-rest-webservices-book-library/config"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	deprecationHeader = "Deprecation"
+	sunsetHeader      = "Sunset"
+	versionDateLayout = "2006-01-02"
+)
+
+// Deprecation announces the deprecation and sunset dates configured for version under
+// api.versions in config.yml with the Deprecation (RFC 9745) and Sunset (RFC 8594)
+// headers. Versions without dates are passed through untouched.
+func Deprecation(version string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lifecycle := config.ApiVersions[version]
+
+		if deprecation, err := time.Parse(versionDateLayout, lifecycle.Deprecation); err == nil {
+			w.Header().Set(deprecationHeader, "@"+strconv.FormatInt(deprecation.Unix(), 10))
+		}
+		if sunset, err := time.Parse(versionDateLayout, lifecycle.Sunset); err == nil {
+			w.Header().Set(sunsetHeader, sunset.UTC().Format(http.TimeFormat))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
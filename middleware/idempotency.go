@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	ReplayedHeader       = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	inFlightRetryAfter      = "1"
+)
+
+var logger *zap.Logger
+
+func init() {
+	logger = config.AppLogger
+}
+
+// recordingWriter passes a response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// Idempotency lets clients retry a non-idempotent request safely by sending the same
+// Idempotency-Key header with every attempt. The first response is stored for the
+// idempotency ttl of config.yml, with its Link headers, and replayed to the retries which
+// carry the same method, path, query and body, while a key reused for another request is
+// answered with 422. Keys are kept apart by the credentials of the request, so callers
+// never see the responses of others. Requests without the header, responses with a 401,
+// 403 or 5xx status, and those marked Cache-Control: no-store, such as the ones holding
+// secrets, are not stored.
+func Idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeApiError(w, r, http.StatusBadRequest, "must be at most 255 characters long")
+			return
+		}
+
+		// Read one byte past the limit so the handler still sees, and rejects, bodies which
+		// are too large.
+		body, readErr := ioutil.ReadAll(io.LimitReader(r.Body, config.MaxBodyBytes+1))
+		if readErr != nil {
+			writeApiError(w, r, http.StatusBadRequest, "request body could not be read")
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		fingerprint := fingerprint(r, body)
+		scopedKey := scope(r) + ":" + key
+		stored, reserveErr := repository.ReserveIdempotencyKey(scopedKey, fingerprint, now, now.Add(config.IdempotencyTtl))
+		switch {
+		case reserveErr != nil:
+			logger.Error("Error while reserving idempotency key: " + key + " with error: " + reserveErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+		case stored == nil:
+			serve(w, r, scopedKey, next)
+		case stored.Fingerprint != fingerprint:
+			writeApiError(w, r, http.StatusUnprocessableEntity, "was already used for a different request")
+		case stored.Status == 0:
+			w.Header().Set("Retry-After", inFlightRetryAfter)
+			writeApiError(w, r, http.StatusConflict, "is used by a request which is still being served")
+		default:
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			for _, link := range stored.Links {
+				w.Header().Add("Link", link)
+			}
+			w.Header().Set(ReplayedHeader, "true")
+			w.WriteHeader(stored.Status)
+			_, _ = w.Write(stored.Body)
+		}
+	})
+}
+
+// serve runs the request which reserved key and stores its response, or frees the key
+// again when the request failed.
+func serve(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	recorder := &recordingWriter{ResponseWriter: w}
+	saved := false
+	defer func() {
+		if saved {
+			return
+		}
+		if releaseErr := repository.ReleaseIdempotencyKey(key); releaseErr != nil {
+			logger.Error("Error while releasing idempotency key: " + key + " with error: " + releaseErr.Error())
+		}
+	}()
+
+	next.ServeHTTP(recorder, r)
+
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	if recorder.status >= http.StatusInternalServerError || recorder.status == http.StatusUnauthorized ||
+		recorder.status == http.StatusForbidden || strings.Contains(w.Header().Get("Cache-Control"), "no-store") {
+		return
+	}
+	saveErr := repository.SaveIdempotentResponse(key, recorder.status, w.Header().Get("Content-Type"),
+		w.Header().Values("Link"), recorder.body.Bytes())
+	if saveErr != nil {
+		logger.Error("Error while saving response of idempotency key: " + key + " with error: " + saveErr.Error())
+		return
+	}
+	saved = true
+}
+
+// scope hashes the credentials of a request, the Authorization header and the session
+// cookie, which its idempotency key is stored under.
+func scope(r *http.Request) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Header.Get("Authorization") + "\n"))
+	if cookie, err := r.Cookie(config.SessionCookie); err == nil {
+		hash.Write([]byte(cookie.Value))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func writeApiError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	apiError := domain.ApiError{
+		Status:     status,
+		Message:    http.StatusText(status),
+		Violations: []domain.Violation{{Field: IdempotencyKeyHeader, Message: message}},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(dto.FromRequest(r).ApiError(apiError))
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingHandler answers every request with a new id, or with status when it is set.
+func countingHandler(calls *int, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+		_, _ = fmt.Fprintf(w, `{"Id":%d}`, *calls)
+	})
+}
+
+func post(handler http.Handler, key string, body string) *httptest.ResponseRecorder {
+	return postTo(handler, "/book", key, body)
+}
+
+func postTo(handler http.Handler, target string, key string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotency(t *testing.T) {
+	calls := 0
+	handler := Idempotency(countingHandler(&calls, http.StatusCreated))
+	key := "key-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	first := post(handler, key, `{"Name":"Book","Author":"Author"}`)
+	if first.Code != http.StatusCreated || first.Body.String() != `{"Id":1}` {
+		t.Fatalf("Expected the first request to be served, got %v %v", first.Code, first.Body.String())
+	}
+
+	scenarios := []struct {
+		name     string
+		key      string
+		body     string
+		status   int
+		response string
+		replayed string
+	}{
+		{name: "Retry is replayed", key: key, body: `{"Name":"Book","Author":"Author"}`, status: http.StatusCreated, response: `{"Id":1}`, replayed: "true"},
+		{name: "Retry with another payload is rejected", key: key, body: `{"Name":"Other","Author":"Author"}`, status: http.StatusUnprocessableEntity},
+		{name: "Request without key is served", body: `{"Name":"Book","Author":"Author"}`, status: http.StatusCreated, response: `{"Id":2}`},
+		{name: "Key which is too long is rejected", key: strings.Repeat("k", 256), body: `{}`, status: http.StatusBadRequest},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			w := post(handler, s.key, s.body)
+			if w.Code != s.status {
+				t.Errorf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			if s.response != "" && w.Body.String() != s.response {
+				t.Errorf("Expected %v, got %v", s.response, w.Body.String())
+			}
+			if replayed := w.Header().Get(ReplayedHeader); replayed != s.replayed {
+				t.Errorf("Expected %v header %q, got %q", ReplayedHeader, s.replayed, replayed)
+			}
+		})
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected the handler to be called twice, got %v", calls)
+	}
+}
+
+func TestIdempotencyDoesNotStoreServerErrors(t *testing.T) {
+	calls := 0
+	handler := Idempotency(countingHandler(&calls, http.StatusInternalServerError))
+	key := "failing-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	for i := 0; i < 2; i++ {
+		if w := post(handler, key, `{}`); w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status %v, got %v", http.StatusInternalServerError, w.Code)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected the failed request to be retried, got %v calls", calls)
+	}
+}
+
+func TestIdempotencyKeepsBodyForHandler(t *testing.T) {
+	var received bytes.Buffer
+	handler := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = received.ReadFrom(r.Body)
+	}))
+
+	post(handler, "body-"+strconv.FormatInt(time.Now().UnixNano(), 10), `{"Name":"Book"}`)
+	if received.String() != `{"Name":"Book"}` {
+		t.Errorf("Expected the handler to read the body, got %v", received.String())
+	}
+}
+
+func TestIdempotencyReplaysLinks(t *testing.T) {
+	links := []string{`</book/3>; rel="duplicate"`, `</book/5>; rel="duplicate"`}
+	handler := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, link := range links {
+			w.Header().Add("Link", link)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"Id":7}`)
+	}))
+	key := "links-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	post(handler, key, `{"Name":"Book"}`)
+	w := post(handler, key, `{"Name":"Book"}`)
+	if w.Header().Get(ReplayedHeader) != "true" {
+		t.Fatalf("Expected the retry to be replayed")
+	}
+	if replayed := w.Header().Values("Link"); strings.Join(replayed, ", ") != strings.Join(links, ", ") {
+		t.Errorf("Expected the links %v, got %v", links, replayed)
+	}
+}
+
+func TestIdempotencyTellsQueriesApart(t *testing.T) {
+	calls := 0
+	handler := Idempotency(countingHandler(&calls, http.StatusCreated))
+	key := "query-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	post(handler, key, `{"Name":"Book","Author":"Author"}`)
+	if w := postTo(handler, "/book?enrich=true", key, `{"Name":"Book","Author":"Author"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a key reused with another query to be rejected, got %v: %v", w.Code, w.Body.String())
+	}
+}
+
+func TestIdempotencyKeepsCallersApart(t *testing.T) {
+	calls := 0
+	handler := Idempotency(countingHandler(&calls, http.StatusCreated))
+	key := "callers-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	for _, authorization := range []string{"Bearer staff", "Bearer member", "Bearer staff"} {
+		r := httptest.NewRequest("POST", "/book", strings.NewReader(`{"Name":"Book"}`))
+		r.Header.Set(IdempotencyKeyHeader, key)
+		r.Header.Set("Authorization", authorization)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if calls != 2 {
+		t.Errorf("Expected each caller to be served once, got %v calls", calls)
+	}
+}
+
+func TestIdempotencyDoesNotStoreAuthorizationFailures(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		calls := 0
+		handler := Idempotency(countingHandler(&calls, status))
+		key := "refused-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+		post(handler, key, `{}`)
+		if w := post(handler, key, `{}`); w.Header().Get(ReplayedHeader) != "" || calls != 2 {
+			t.Errorf("Expected a %v not to be replayed, got %v calls", status, calls)
+		}
+	}
+}
+
+func TestIdempotencyDoesNotStoreNoStoreResponses(t *testing.T) {
+	calls := 0
+	handler := Idempotency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		countingHandler(&calls, http.StatusCreated).ServeHTTP(w, r)
+	}))
+	key := "secret-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	post(handler, key, `{}`)
+	if w := post(handler, key, `{}`); w.Header().Get(ReplayedHeader) != "" || calls != 2 {
+		t.Errorf("Expected a no-store response not to be replayed, got %v calls", calls)
+	}
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"go-rest-webservices-book-library/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type scenario struct {
+	name           string
+	method         string
+	headers        map[string]string
+	contentType    string
+	status         int
+	expectedHeader string
+	expectedValue  string
+}
+
+func TestSetup(t *testing.T) {
+	config.CorsAllowedOrigins = []string{"http://catalogue.example.com"}
+	config.CorsAllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	config.CorsAllowedHeaders = []string{"Content-Type"}
+	config.CorsExposedHeaders = []string{"Link", "Idempotent-Replayed"}
+	config.CorsMaxAge = 600
+	config.StrictTransportSecurity = "max-age=63072000"
+	config.ContentTypeOptions = "nosniff"
+	config.ContentSecurityPolicy = "default-src 'self'"
+	config.ApiVersions = map[string]config.ApiVersion{
+		"v1": {Deprecation: "2026-01-01", Sunset: "2027-01-01"},
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	scenarios := []scenario{
+		{
+			name:   "should allow preflight for PUT from allowed origin",
+			method: "PUT",
+			headers: map[string]string{
+				"Origin":                         "http://catalogue.example.com",
+				"Access-Control-Request-Headers": "Content-Type",
+			},
+			status:         http.StatusOK,
+			expectedHeader: "Access-Control-Allow-Origin",
+			expectedValue:  "http://catalogue.example.com",
+		},
+		{
+			name:           "should allow preflight for DELETE from allowed origin",
+			method:         "DELETE",
+			headers:        map[string]string{"Origin": "http://catalogue.example.com"},
+			status:         http.StatusOK,
+			expectedHeader: "Access-Control-Allow-Methods",
+			expectedValue:  "DELETE",
+		},
+		{
+			name:           "should reject preflight for method which is not allowed",
+			method:         "PATCH",
+			headers:        map[string]string{"Origin": "http://catalogue.example.com"},
+			status:         http.StatusMethodNotAllowed,
+			expectedHeader: "Access-Control-Allow-Origin",
+			expectedValue:  "",
+		},
+		{
+			name:           "should not answer preflight from unknown origin",
+			method:         "PUT",
+			headers:        map[string]string{"Origin": "http://evil.example.com"},
+			status:         http.StatusOK,
+			expectedHeader: "Access-Control-Allow-Origin",
+			expectedValue:  "",
+		},
+	}
+
+	handler := Cors()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("OPTIONS", "/book/1", nil)
+			r.Header.Set("Access-Control-Request-Method", scenario.method)
+			for key, value := range scenario.headers {
+				r.Header.Set(key, value)
+			}
+			handler.ServeHTTP(w, r)
+
+			if w.Code != scenario.status {
+				t.Errorf("Expected status code: %v, got %v", scenario.status, w.Code)
+			}
+			if got := w.Header().Get(scenario.expectedHeader); got != scenario.expectedValue {
+				t.Errorf("Expected %v: %v, got %v", scenario.expectedHeader, scenario.expectedValue, got)
+			}
+		})
+	}
+}
+
+func TestCorsExposesHeadersAndAllowsCredentials(t *testing.T) {
+	defer func() { config.CorsAllowCredentials = false }()
+	for _, allowCredentials := range []bool{false, true} {
+		config.CorsAllowCredentials = allowCredentials
+		handler := Cors()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/book/1", nil)
+		r.Header.Set("Origin", "http://catalogue.example.com")
+		handler.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Access-Control-Expose-Headers"); got != "Link,Idempotent-Replayed" {
+			t.Errorf("Expected Link and Idempotent-Replayed to be exposed, got %v", got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != allowCredentials {
+			t.Errorf("Expected credentials to be allowed: %v, got %v", allowCredentials, got)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	scenarios := []scenario{
+		{
+			name:           "should add HSTS to json responses",
+			contentType:    "application/json",
+			expectedHeader: "Strict-Transport-Security",
+			expectedValue:  "max-age=63072000",
+		},
+		{
+			name:           "should add nosniff to json responses",
+			contentType:    "application/json",
+			expectedHeader: "X-Content-Type-Options",
+			expectedValue:  "nosniff",
+		},
+		{
+			name:           "should not add CSP to json responses",
+			contentType:    "application/json",
+			expectedHeader: "Content-Security-Policy",
+			expectedValue:  "",
+		},
+		{
+			name:           "should add CSP to html responses",
+			contentType:    "text/html; charset=utf-8",
+			expectedHeader: "Content-Security-Policy",
+			expectedValue:  "default-src 'self'",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			handler := SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", scenario.contentType)
+				_, _ = w.Write([]byte("body"))
+			}))
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/books", nil)
+			handler.ServeHTTP(w, r)
+
+			if got := w.Header().Get(scenario.expectedHeader); got != scenario.expectedValue {
+				t.Errorf("Expected %v: %v, got %v", scenario.expectedHeader, scenario.expectedValue, got)
+			}
+		})
+	}
+}
+
+func TestDeprecation(t *testing.T) {
+	scenarios := []scenario{
+		{
+			name:           "should announce deprecation of v1",
+			method:         "v1",
+			expectedHeader: "Deprecation",
+			expectedValue:  "@1767225600",
+		},
+		{
+			name:           "should announce sunset of v1",
+			method:         "v1",
+			expectedHeader: "Sunset",
+			expectedValue:  "Fri, 01 Jan 2027 00:00:00 GMT",
+		},
+		{
+			name:           "should not deprecate v2",
+			method:         "v2",
+			expectedHeader: "Deprecation",
+			expectedValue:  "",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			handler := Deprecation(scenario.method, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/"+scenario.method+"/books", nil)
+			handler.ServeHTTP(w, r)
+
+			if got := w.Header().Get(scenario.expectedHeader); got != scenario.expectedValue {
+				t.Errorf("Expected %v: %v, got %v", scenario.expectedHeader, scenario.expectedValue, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"go-rest-webservices-book-library/config"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	strictTransportSecurityHeader = "Strict-Transport-Security"
+	contentTypeOptionsHeader      = "X-Content-Type-Options"
+	contentSecurityPolicyHeader   = "Content-Security-Policy"
+	contentTypeHeader             = "Content-Type"
+	htmlContentType               = "text/html"
+)
+
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// SecurityHeaders adds the security section of config.yml to every response. The
+// Content-Security-Policy is only sent along with HTML responses.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.StrictTransportSecurity != "" {
+			w.Header().Set(strictTransportSecurityHeader, config.StrictTransportSecurity)
+		}
+		if config.ContentTypeOptions != "" {
+			w.Header().Set(contentTypeOptionsHeader, config.ContentTypeOptions)
+		}
+
+		next.ServeHTTP(&securityHeadersWriter{ResponseWriter: w}, r)
+	})
+}
+
+func (s *securityHeadersWriter) WriteHeader(statusCode int) {
+	if !s.wroteHeader {
+		s.wroteHeader = true
+		contentType := s.Header().Get(contentTypeHeader)
+		if config.ContentSecurityPolicy != "" && strings.HasPrefix(contentType, htmlContentType) {
+			s.Header().Set(contentSecurityPolicyHeader, config.ContentSecurityPolicy)
+		}
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *securityHeadersWriter) Write(data []byte) (int, error) {
+	if !s.wroteHeader {
+		if s.Header().Get(contentTypeHeader) == "" {
+			s.Header().Set(contentTypeHeader, http.DetectContentType(data))
+		}
+		s.WriteHeader(http.StatusOK)
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+// Flush lets streaming responses, such as the Server-Sent Events of the change feed,
+// through the security headers.
+func (s *securityHeadersWriter) Flush() {
+	if !s.wroteHeader {
+		s.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection over for WebSocket upgrades.
+func (s *securityHeadersWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
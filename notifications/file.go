@@ -0,0 +1,38 @@
+package notifications
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// File appends every message to a file instead of sending it, for development, as the
+// MIME message which would have been sent.
+type File struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func NewFile(path string, from string) *File {
+	return &File{path: path, from: from}
+}
+
+func (f *File) Send(message Message) error {
+	data, err := compose(f.from, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, "\r\n\r\n"...)); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
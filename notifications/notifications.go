@@ -0,0 +1,153 @@
+// Package notifications tells members by email about their loans which are due soon or
+// overdue and the holds they can collect. Messages are rendered from templates and sent
+// through an SMTP server, or written to a file while developing.
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/repository"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"time"
+)
+
+const (
+	SenderSmtp = "smtp"
+	SenderFile = "file"
+)
+
+// Message is an email to a member, with a plain text and an HTML body. To is an address
+// as written in headers, such as "Ged <ged@roke.example>".
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	Html    string
+}
+
+// Sender delivers messages, or returns why it could not.
+type Sender interface {
+	Send(message Message) error
+}
+
+// NewSender returns the sender chosen by notifications.sender in config.yml.
+func NewSender() (Sender, error) {
+	switch config.NotificationSender {
+	case SenderSmtp:
+		return NewSmtp(config.SmtpServer, config.NotificationFrom), nil
+	case SenderFile:
+		return NewFile(config.NotificationFile, config.NotificationFrom), nil
+	}
+	return nil, errors.New("unknown notification sender: " + config.NotificationSender + ", expected " + SenderSmtp + " or " + SenderFile)
+}
+
+// Notify sends the notices due at now through sender and returns how many it sent. Each
+// notice is recorded as sent before it is sent, so that it is sent once however many
+// instances notify, and forgotten again when sending it fails, to be retried next time.
+func Notify(ctx context.Context, now time.Time, sender Sender, templates *Templates) (int, error) {
+	dueSoon, err := repository.GetLoanNotices(domain.NotificationDueSoon, now, now.Add(config.NotificationDueSoon))
+	if err != nil {
+		return 0, err
+	}
+	overdue, err := repository.GetLoanNotices(domain.NotificationOverdue, time.Time{}, now)
+	if err != nil {
+		return 0, err
+	}
+	ready, err := repository.GetHoldNotices()
+	if err != nil {
+		return 0, err
+	}
+
+	sent, failed := 0, 0
+	var firstErr error
+	for _, notice := range append(append(dueSoon, overdue...), ready...) {
+		if ctx.Err() != nil {
+			break
+		}
+		notified, err := notify(notice, now, sender, templates)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		} else if notified {
+			sent++
+		}
+	}
+	if firstErr != nil {
+		return sent, fmt.Errorf("%d of %d notifications could not be sent, the first with: %v", failed, sent+failed, firstErr)
+	}
+	return sent, nil
+}
+
+// notify sends the message of a notice and reports whether it did, which it does not
+// when another instance has just sent it.
+func notify(notice domain.Notice, now time.Time, sender Sender, templates *Templates) (bool, error) {
+	message, err := templates.Render(notice)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := repository.ClaimNotification(domain.Notification{MemberId: notice.Member.Id, Event: notice.Event,
+		Reference: notice.Reference, Email: notice.Member.Email, Subject: message.Subject, SentAt: now})
+	if err != nil || claimed == nil {
+		return false, err
+	}
+	if err = sender.Send(message); err != nil {
+		if releaseErr := repository.ReleaseNotification(claimed.Id); releaseErr != nil {
+			return false, errors.New(err.Error() + ", and it could not be retried: " + releaseErr.Error())
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// compose writes a message from an address as a MIME message, its bodies as alternative
+// parts encoded as quoted-printable so that any line length and character goes through.
+func compose(from string, message Message, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{{"text/plain; charset=utf-8", message.Text}, {"text/html; charset=utf-8", message.Html}} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err = encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var composed bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", from},
+		{"To", message.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", message.Subject)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	} {
+		composed.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	composed.WriteString("\r\n")
+	composed.Write(body.Bytes())
+	return composed.Bytes(), nil
+}
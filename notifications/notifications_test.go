@@ -0,0 +1,192 @@
+package notifications
+
+import (
+	"bufio"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var notice = domain.Notice{
+	Event:     domain.NotificationDueSoon,
+	Reference: "loan:41:0",
+	Member:    domain.Member{Id: 3, Name: "Ged", Email: "ged@roke.example"},
+	Book:      domain.Book{Id: 7, Name: "The Farthest Shore", Author: "Ursula K. Le Guin <ed.>"},
+	DueAt:     time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC),
+}
+
+// fakeSmtpServer accepts SMTP sessions on localhost and sends the data of each message to
+// the channel it returns, refusing recipients at refused.example.
+func fakeSmtpServer(t *testing.T) (config.MailServer, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	messages := make(chan string, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				session := textproto.NewConn(conn)
+				_ = session.PrintfLine("220 localhost fake ESMTP")
+				for {
+					line, err := session.ReadLine()
+					if err != nil {
+						return
+					}
+					command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+					switch {
+					case command == "EHLO" || command == "HELO":
+						_ = session.PrintfLine("250 localhost")
+					case command == "RCPT" && strings.Contains(line, "refused.example"):
+						_ = session.PrintfLine("550 no such mailbox")
+					case command == "DATA":
+						_ = session.PrintfLine("354 go ahead")
+						data, _ := ioutil.ReadAll(session.DotReader())
+						messages <- string(data)
+						_ = session.PrintfLine("250 queued")
+					case command == "QUIT":
+						_ = session.PrintfLine("221 bye")
+						return
+					default:
+						_ = session.PrintfLine("250 ok")
+					}
+				}
+			}()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return config.MailServer{Host: host, Port: portNumber, Timeout: 5 * time.Second}, messages
+}
+
+// parts reads the bodies of a message by their media type.
+func parts(t *testing.T, message *mail.Message) map[string]string {
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Expected an alternative message, got %v, %v", mediaType, err)
+	}
+	bodies := map[string]string{}
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(part)
+		bodies[mediaType] = string(body)
+	}
+	return bodies
+}
+
+func TestRender(t *testing.T) {
+	builtIn, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("Could not load the built-in templates: %v", err)
+	}
+	for _, event := range Events {
+		if _, err = builtIn.Render(domain.Notice{Event: event, Member: notice.Member, Book: notice.Book, DueAt: notice.DueAt}); err != nil {
+			t.Errorf("Could not render %v: %v", event, err)
+		}
+	}
+	message, _ := builtIn.Render(notice)
+	if message.To != `"Ged" <ged@roke.example>` || message.Subject != "The Farthest Shore is due back on Friday 16 October" {
+		t.Errorf("Expected the message to Ged about the book, got %+v", message)
+	}
+	if !strings.Contains(message.Text, "Ursula K. Le Guin <ed.>") || !strings.Contains(message.Html, "Ursula K. Le Guin &lt;ed.&gt;") {
+		t.Errorf("Expected the HTML body alone to be escaped, got %q and %q", message.Text, message.Html)
+	}
+	for _, purpose := range AccountEmails {
+		email := AccountEmail{Purpose: purpose, Member: notice.Member, Link: "http://localhost:3000/?token=a&b", ExpiresAt: notice.DueAt}
+		if message, err = builtIn.RenderAccountEmail(email); err != nil || !strings.Contains(message.Text, "?token=a&b") ||
+			!strings.Contains(message.Html, `href="http://localhost:3000/?token=a&amp;b"`) {
+			t.Errorf("Expected %v to link to the token, got %+v: %v", purpose, message, err)
+		}
+	}
+
+	directory := t.TempDir()
+	_ = ioutil.WriteFile(filepath.Join(directory, "due_soon.txt"), []byte(`{{define "subject"}}Reminder:
+{{.Book.Name}}{{end}}Bring it back, {{.Member.Name}}.`), 0644)
+	overridden, err := LoadTemplates(directory)
+	if err != nil {
+		t.Fatalf("Could not load the templates: %v", err)
+	}
+	if message, _ = overridden.Render(notice); message.Subject != "Reminder: The Farthest Shore" || message.Text != "Bring it back, Ged." ||
+		!strings.Contains(message.Html, "Renew your loan") {
+		t.Errorf("Expected the text template to be overridden alone, got %+v", message)
+	}
+
+	for name, source := range map[string]string{
+		"due_soon.txt":   "Bring it back.",
+		"overdue.txt":    `{{define "subject"}}{{.Book.Name}{{end}}`,
+		"hold_ready.txt": `{{define "subject"}}{{.Book.Title}}{{end}}`,
+	} {
+		directory = t.TempDir()
+		_ = ioutil.WriteFile(filepath.Join(directory, name), []byte(source), 0644)
+		broken, err := LoadTemplates(directory)
+		if err == nil {
+			_, err = broken.Render(domain.Notice{Event: strings.TrimSuffix(name, ".txt")})
+		}
+		if err == nil {
+			t.Errorf("Expected %v to be refused", name)
+		}
+	}
+}
+
+func TestSmtpSendsToTheServer(t *testing.T) {
+	server, messages := fakeSmtpServer(t)
+	templates, _ := LoadTemplates("")
+	message, _ := templates.Render(notice)
+	sender := NewSmtp(server, "Library <library@example.com>")
+
+	if err := sender.Send(message); err != nil {
+		t.Fatalf("Could not send: %v", err)
+	}
+	received, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(<-messages)))
+	if err != nil {
+		t.Fatalf("Could not read the message: %v", err)
+	}
+	if received.Header.Get("To") != `"Ged" <ged@roke.example>` || received.Header.Get("Subject") != message.Subject {
+		t.Errorf("Expected the message to Ged, got %v", received.Header)
+	}
+	if bodies := parts(t, received); bodies["text/plain"] != message.Text || bodies["text/html"] != message.Html {
+		t.Errorf("Expected the text and HTML bodies, got %v", bodies)
+	}
+
+	message.To = "someone@refused.example"
+	if err = sender.Send(message); err == nil || !strings.Contains(err.Error(), "no such mailbox") {
+		t.Errorf("Expected the refusal of the server, got %v", err)
+	}
+}
+
+func TestFileAppendsMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	sender := NewFile(path, "Library <library@example.com>")
+	for _, subject := range []string{"First", "Ünicode"} {
+		if err := sender.Send(Message{To: "ged@roke.example", Subject: subject, Text: "Text", Html: "<p>Html</p>"}); err != nil {
+			t.Fatalf("Could not write: %v", err)
+		}
+	}
+	data, _ := ioutil.ReadFile(path)
+	if strings.Count(string(data), "From: Library <library@example.com>") != 2 || !strings.Contains(string(data), "Subject: =?utf-8?q?=C3=9Cnicode?=") {
+		t.Errorf("Expected both messages, got %s", data)
+	}
+}
@@ -0,0 +1,82 @@
+package notifications
+
+import (
+	"crypto/tls"
+	"go-rest-webservices-book-library/config"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// Smtp sends messages through an SMTP server, over STARTTLS when the server offers it.
+type Smtp struct {
+	server config.MailServer
+	from   string
+}
+
+func NewSmtp(server config.MailServer, from string) *Smtp {
+	return &Smtp{server: server, from: from}
+}
+
+// Send delivers a message in one SMTP session, which has the timeout of the server to
+// complete in.
+func (s *Smtp) Send(message Message) error {
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+	data, err := compose(from.String(), message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.server.Host, strconv.Itoa(s.server.Port)), s.server.Timeout)
+	if err != nil {
+		return err
+	}
+	if err = conn.SetDeadline(time.Now().Add(s.server.Timeout)); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, s.server.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.server.Host}); err != nil {
+			return err
+		}
+	}
+	// PlainAuth refuses to send the password in the clear, unless to localhost.
+	if s.server.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.server.Username, s.server.Password, s.server.Host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(data); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
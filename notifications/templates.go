@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"embed"
+	"errors"
+	"go-rest-webservices-book-library/domain"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var builtInTemplates embed.FS
+
+// Events lists the events members are notified of, each has a template of its own.
+var Events = []string{domain.NotificationDueSoon, domain.NotificationOverdue, domain.NotificationHoldReady}
+
+// AccountEmails lists the emails members are sent about their account, each has a
+// template of its own.
+var AccountEmails = []string{domain.TokenVerifyEmail, domain.TokenResetPassword, domain.EmailAlreadyRegistered}
+
+// AccountEmail is an email with a link for a member to verify their email or reset their
+// password with, before it expires.
+type AccountEmail struct {
+	Purpose   string
+	Member    domain.Member
+	Link      string
+	ExpiresAt time.Time
+}
+
+// Templates renders the message of each event from two templates, executed with the
+// domain.Notice: the plain text one, <event>.txt, which also defines the subject as a
+// template named subject, and the HTML one, <event>.html. Account emails are rendered the
+// same way from the templates named after their purpose, executed with the AccountEmail.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// LoadTemplates parses the templates of every event and account email, from the directory
+// when it holds a file of the same name and from the built-in templates otherwise.
+func LoadTemplates(directory string) (*Templates, error) {
+	templates := &Templates{text: map[string]*texttemplate.Template{}, html: map[string]*htmltemplate.Template{}}
+	for _, event := range append(append([]string{}, Events...), AccountEmails...) {
+		source, err := readTemplate(directory, event+".txt")
+		if err != nil {
+			return nil, err
+		}
+		text, err := texttemplate.New(event + ".txt").Option("missingkey=error").Parse(source)
+		if err != nil {
+			return nil, err
+		}
+		if text.Lookup("subject") == nil {
+			return nil, errors.New(event + ".txt defines no subject template")
+		}
+
+		if source, err = readTemplate(directory, event+".html"); err != nil {
+			return nil, err
+		}
+		html, err := htmltemplate.New(event + ".html").Option("missingkey=error").Parse(source)
+		if err != nil {
+			return nil, err
+		}
+		templates.text[event], templates.html[event] = text, html
+	}
+	return templates, nil
+}
+
+// Render writes the message telling the member of a notice about it.
+func (t *Templates) Render(notice domain.Notice) (Message, error) {
+	return t.render(notice.Event, notice.Member, notice)
+}
+
+// RenderAccountEmail writes the message sending a member the link of an account email.
+func (t *Templates) RenderAccountEmail(email AccountEmail) (Message, error) {
+	return t.render(email.Purpose, email.Member, email)
+}
+
+func (t *Templates) render(name string, member domain.Member, data interface{}) (Message, error) {
+	text, found := t.text[name]
+	if !found {
+		return Message{}, errors.New("no template for event: " + name)
+	}
+	var subject, body, html strings.Builder
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.html[name].Execute(&html, data); err != nil {
+		return Message{}, err
+	}
+
+	to := mail.Address{Name: member.Name, Address: member.Email}
+	// Subjects are headers, so they are kept to a line.
+	return Message{To: to.String(), Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text: body.String(), Html: html.String()}, nil
+}
+
+func readTemplate(directory string, name string) (string, error) {
+	if directory != "" {
+		data, err := ioutil.ReadFile(filepath.Join(directory, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	data, err := builtInTemplates.ReadFile("templates/" + name)
+	return string(data), err
+}
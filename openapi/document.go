@@ -0,0 +1,113 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var specification []byte
+
+var document map[string]interface{}
+
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+type operation struct {
+	path       string
+	pathItem   map[string]interface{}
+	operation  map[string]interface{}
+	pathParams map[string]string
+}
+
+func init() {
+	if err := json.Unmarshal(specification, &document); err != nil {
+		panic("openapi.json is not valid JSON: " + err.Error())
+	}
+}
+
+// Operations lists every documented operation as "METHOD /path/{template}".
+func Operations() []string {
+	var operations []string
+	for path, item := range object(document["paths"]) {
+		for _, method := range operationMethods {
+			if _, ok := resolve(item)[method]; ok {
+				operations = append(operations, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+// findOperation matches a request path against the documented path templates, literal
+// paths taking precedence over templated ones.
+func findOperation(method string, urlPath string) (operation, bool) {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	var best operation
+	bestScore := -1
+
+	for path, item := range object(document["paths"]) {
+		templateSegments := strings.Split(strings.Trim(path, "/"), "/")
+		if len(templateSegments) != len(segments) {
+			continue
+		}
+
+		params := map[string]string{}
+		score := 0
+		matched := true
+		for i, templateSegment := range templateSegments {
+			if strings.HasPrefix(templateSegment, "{") && strings.HasSuffix(templateSegment, "}") {
+				if segments[i] == "" {
+					matched = false
+					break
+				}
+				params[strings.Trim(templateSegment, "{}")] = segments[i]
+			} else if templateSegment == segments[i] {
+				score++
+			} else {
+				matched = false
+				break
+			}
+		}
+
+		pathItem := resolve(item)
+		op, hasMethod := pathItem[strings.ToLower(method)]
+		if matched && hasMethod && score > bestScore {
+			best = operation{path: path, pathItem: pathItem, operation: object(op), pathParams: params}
+			bestScore = score
+		}
+	}
+
+	return best, bestScore >= 0
+}
+
+// resolve follows $ref pointers into this document until it reaches a definition.
+func resolve(node interface{}) map[string]interface{} {
+	resolved := object(node)
+	for resolved != nil {
+		ref, ok := resolved["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return resolved
+		}
+
+		var target interface{} = document
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			target = object(target)[part]
+		}
+		resolved = object(target)
+	}
+	return resolved
+}
+
+func object(node interface{}) map[string]interface{} {
+	value, _ := node.(map[string]interface{})
+	return value
+}
+
+func array(node interface{}) []interface{} {
+	value, _ := node.([]interface{})
+	return value
+}
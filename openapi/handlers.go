@@ -0,0 +1,104 @@
+package openapi
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+)
+
+// The documentation page loads Redoc from redoc/, vendored by go generate from a pinned
+// release rather than the latest bundle of the CDN.
+//go:generate curl -fsSL -o redoc/redoc.standalone.js https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js
+
+//go:embed redoc
+var redoc embed.FS
+
+const redocScript = "redoc/redoc.standalone.js"
+
+// redocCdnScript is the same release, which the documentation page loads when the bundle
+// is not vendored and openapi.redocIntegrity gives its Subresource Integrity hash.
+const redocCdnScript = "https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"
+
+var documentationPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Book library API</title>
+</head>
+<body>
+{{- if .Script}}
+	<redoc spec-url="/openapi.json"></redoc>
+	<script src="{{.Script}}"{{with .Integrity}} integrity="{{.}}" crossorigin="anonymous"{{end}}></script>
+{{- else}}
+	<p>Redoc is not vendored: run <code>go generate ./openapi</code>, or set <code>openapi.redocIntegrity</code> to load it from the CDN. The API is described in <a href="/openapi.json">openapi.json</a>.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+func SpecificationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(specification)
+}
+
+// DocumentationHandler renders openapi.json with the vendored Redoc bundle, or with the
+// pinned release of the CDN when only its integrity hash is configured. No script is
+// loaded without either, and the page says how to get one.
+func DocumentationHandler(w http.ResponseWriter, r *http.Request) {
+	page := struct{ Script, Integrity string }{}
+	if _, err := fs.Stat(redoc, redocScript); err == nil {
+		page.Script = "/docs/redoc.standalone.js"
+	} else if config.RedocIntegrity != "" {
+		page.Script, page.Integrity = redocCdnScript, config.RedocIntegrity
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = documentationPage.Execute(w, page)
+}
+
+// DocumentationScriptHandler serves the vendored Redoc bundle, which never changes
+// within a build.
+func DocumentationScriptHandler(w http.ResponseWriter, r *http.Request) {
+	script, err := redoc.ReadFile(redocScript)
+	if err != nil {
+		http.Error(w, "Redoc is not vendored, run go generate ./openapi", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	_, _ = w.Write(script)
+}
+
+// ValidateRequests rejects requests to documented operations whose parameters or body do
+// not match openapi.json with a 400 listing every violation.
+func ValidateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			body, _ = ioutil.ReadAll(io.LimitReader(r.Body, config.MaxBodyBytes+1))
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		if int64(len(body)) <= config.MaxBodyBytes {
+			if violations := ValidateRequest(r, body); len(violations) > 0 {
+				apiError, _ := json.Marshal(domain.ApiError{
+					Status:     http.StatusBadRequest,
+					Message:    http.StatusText(http.StatusBadRequest),
+					Violations: violations,
+				})
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(apiError)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
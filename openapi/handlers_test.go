@@ -0,0 +1,36 @@
+package openapi
+
+import (
+	"go-rest-webservices-book-library/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDocumentationHandler(t *testing.T) {
+	_, vendorErr := redoc.ReadFile(redocScript)
+	defer func(integrity string) { config.RedocIntegrity = integrity }(config.RedocIntegrity)
+
+	scenarios := []struct {
+		name      string
+		integrity string
+		contains  string
+	}{
+		{name: "should say how to get Redoc without the bundle or its hash", contains: "go generate ./openapi"},
+		{name: "should load the pinned release with its hash", integrity: "sha384-abc", contains: `<script src="` + redocCdnScript + `" integrity="sha384-abc" crossorigin="anonymous">`},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			if vendorErr == nil {
+				t.Skip("Redoc is vendored")
+			}
+			config.RedocIntegrity = scenario.integrity
+			w := httptest.NewRecorder()
+			DocumentationHandler(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), scenario.contains) {
+				t.Errorf("Expected the page to contain %q, got %v: %v", scenario.contains, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-rest-webservices-book-library/domain"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+const jsonMediaType = "application/json"
+
+// ValidateRequest checks the parameters and body of r against the documented operation.
+// Requests for undocumented operations are not checked, they are left to the router.
+func ValidateRequest(r *http.Request, body []byte) []domain.Violation {
+	op, found := findOperation(r.Method, r.URL.Path)
+	if !found {
+		return nil
+	}
+
+	var violations []domain.Violation
+	var parameters []interface{}
+	parameters = append(parameters, array(op.pathItem["parameters"])...)
+	parameters = append(parameters, array(op.operation["parameters"])...)
+	for _, node := range parameters {
+		parameter := resolve(node)
+		name, _ := parameter["name"].(string)
+
+		var value string
+		var present bool
+		switch parameter["in"] {
+		case "path":
+			value, present = op.pathParams[name]
+		case "query":
+			values, ok := r.URL.Query()[name]
+			present = ok
+			if ok {
+				value = values[0]
+			}
+		case "header":
+			value = r.Header.Get(name)
+			present = value != ""
+		default:
+			continue
+		}
+
+		if !present {
+			if required, _ := parameter["required"].(bool); required {
+				violations = append(violations, domain.Violation{Field: name, Message: "is required"})
+			}
+			continue
+		}
+		schema := resolve(parameter["schema"])
+		validateValue(schema, parameterValue(schema, value), name, &violations)
+	}
+
+	requestBody := resolve(op.operation["requestBody"])
+	if requestBody == nil {
+		return violations
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required, _ := requestBody["required"].(bool); required {
+			violations = append(violations, domain.Violation{Message: "request body is required"})
+		}
+		return violations
+	}
+	return append(violations, validateContent(requestBody, r.Header.Get("Content-Type"), body, "body")...)
+}
+
+// ValidateResponse checks a response to method and urlPath against the documented
+// responses of the operation. It is meant for tests, keeping the handlers honest.
+func ValidateResponse(method string, urlPath string, status int, header http.Header, body []byte) []domain.Violation {
+	op, found := findOperation(method, urlPath)
+	if !found {
+		return []domain.Violation{{Message: method + " " + urlPath + " is not documented"}}
+	}
+
+	response := resolve(object(op.operation["responses"])[strconv.Itoa(status)])
+	if response == nil {
+		response = resolve(object(op.operation["responses"])["default"])
+	}
+	if response == nil {
+		return []domain.Violation{{Message: "status " + strconv.Itoa(status) + " is not documented for " + method + " " + op.path}}
+	}
+
+	if object(response["content"]) == nil {
+		if len(body) > 0 {
+			return []domain.Violation{{Message: "status " + strconv.Itoa(status) + " must not have a body"}}
+		}
+		return nil
+	}
+	return validateContent(response, header.Get("Content-Type"), body, "response")
+}
+
+func validateContent(node map[string]interface{}, contentType string, body []byte, field string) []domain.Violation {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = jsonMediaType
+	}
+
+	media, documented := object(node["content"])[mediaType]
+	if !documented {
+		return []domain.Violation{{Field: field, Message: "content type " + mediaType + " is not documented"}}
+	}
+
+	schema := resolve(object(media)["schema"])
+	if schema == nil || mediaType != jsonMediaType {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []domain.Violation{{Field: field, Message: "is not valid JSON"}}
+	}
+
+	var violations []domain.Violation
+	validateValue(schema, value, field, &violations)
+	return violations
+}
+
+// validateValue checks value against the subset of JSON schema used by openapi.json:
+// type, enum, properties, required, additionalProperties, items, minLength, maxLength
+// and minimum.
+func validateValue(schema map[string]interface{}, value interface{}, field string, violations *[]domain.Violation) {
+	if schema == nil {
+		return
+	}
+	add := func(message string) {
+		*violations = append(*violations, domain.Violation{Field: field, Message: message})
+	}
+
+	if !matchesType(schema["type"], value) {
+		add("must be of type " + typeName(schema["type"]))
+		return
+	}
+
+	if enum := array(schema["enum"]); enum != nil {
+		found := false
+		for _, option := range enum {
+			found = found || option == value
+		}
+		if !found {
+			add("is not one of the allowed values")
+		}
+	}
+
+	switch typed := value.(type) {
+	case string:
+		length := float64(utf8.RuneCountInString(typed))
+		if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+			add("must be at least " + strconv.FormatFloat(minLength, 'f', -1, 64) + " characters long")
+		}
+		if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+			add("must be at most " + strconv.FormatFloat(maxLength, 'f', -1, 64) + " characters long")
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && typed < minimum {
+			add("must be at least " + strconv.FormatFloat(minimum, 'f', -1, 64))
+		}
+	case []interface{}:
+		items := resolve(schema["items"])
+		for i, item := range typed {
+			validateValue(items, item, field+"["+strconv.Itoa(i)+"]", violations)
+		}
+	case map[string]interface{}:
+		properties := object(schema["properties"])
+		for _, name := range array(schema["required"]) {
+			if _, ok := typed[name.(string)]; !ok {
+				*violations = append(*violations, domain.Violation{Field: field + "." + name.(string), Message: "is required"})
+			}
+		}
+
+		names := make([]string, 0, len(typed))
+		for name := range typed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if propertySchema, ok := properties[name]; ok {
+				validateValue(resolve(propertySchema), typed[name], field+"."+name, violations)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				*violations = append(*violations, domain.Violation{Field: field + "." + name, Message: "is not a known field"})
+			}
+		}
+	}
+}
+
+func matchesType(schemaType interface{}, value interface{}) bool {
+	switch typed := schemaType.(type) {
+	case nil:
+		return true
+	case string:
+		return isType(typed, value)
+	case []interface{}:
+		for _, option := range typed {
+			if name, ok := option.(string); ok && isType(name, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(name string, value interface{}) bool {
+	switch name {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return false
+}
+
+func typeName(schemaType interface{}) string {
+	if name, ok := schemaType.(string); ok {
+		return name
+	}
+	var names []string
+	for _, option := range array(schemaType) {
+		names = append(names, option.(string))
+	}
+	name, _ := json.Marshal(names)
+	return string(name)
+}
+
+// parameterValue turns a path or query parameter into the JSON value its schema asks
+// for, so it can be checked like any body value. Values which do not convert are kept as
+// strings and fail the type check.
+func parameterValue(schema map[string]interface{}, value string) interface{} {
+	switch typeName(schema["type"]) {
+	case "integer", "number":
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number
+		}
+	case "boolean":
+		if boolean, err := strconv.ParseBool(value); err == nil {
+			return boolean
+		}
+	}
+	return value
+}
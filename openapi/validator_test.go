@@ -0,0 +1,109 @@
+package openapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type scenario struct {
+	name       string
+	method     string
+	path       string
+	data       []byte
+	status     int
+	violations int
+}
+
+func TestValidateRequests(t *testing.T) {
+	scenarios := []scenario{
+		{
+			name:   "should pass valid book",
+			method: "POST",
+			path:   "/book",
+			data:   []byte(`{"Name":"Book","Author":"Author"}`),
+			status: http.StatusOK,
+		},
+		{
+			name:       "should reject every schema violation of a book",
+			method:     "POST",
+			path:       "/book",
+			data:       []byte(`{"Name":"","Id":1}`),
+			status:     http.StatusBadRequest,
+			violations: 3,
+		},
+		{
+			name:       "should reject missing body",
+			method:     "PUT",
+			path:       "/book/1",
+			status:     http.StatusBadRequest,
+			violations: 1,
+		},
+		{
+			name:       "should reject non integer path parameter",
+			method:     "GET",
+			path:       "/book/abc",
+			status:     http.StatusBadRequest,
+			violations: 1,
+		},
+		{
+			name:       "should reject negative query parameter",
+			method:     "GET",
+			path:       "/books?limit=-1&offset=x",
+			status:     http.StatusBadRequest,
+			violations: 2,
+		},
+		{
+			name:   "should pass undocumented routes to the router",
+			method: "GET",
+			path:   "/unknown",
+			status: http.StatusOK,
+		},
+	}
+
+	handler := ValidateRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(scenario.method, scenario.path, bytes.NewBuffer(scenario.data))
+			r.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(w, r)
+
+			if w.Code != scenario.status {
+				t.Errorf("Expected status code: %v, got %v", scenario.status, w.Code)
+			}
+
+			body, _ := readBody(r)
+			if violations := ValidateRequest(r, body); len(violations) != scenario.violations {
+				t.Errorf("Expected %v violations, got %v", scenario.violations, violations)
+			}
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	scenarios := []scenario{
+		{name: "valid book", method: "GET", path: "/book/1", status: 200, data: []byte(`{"Id":1,"Name":"Book","Author":"Author"}`)},
+		{name: "book missing field", method: "GET", path: "/book/1", status: 200, data: []byte(`{"Id":1,"Name":"Book"}`), violations: 1},
+		{name: "undocumented status", method: "DELETE", path: "/book/1", status: 404, violations: 1},
+		{name: "body on empty response", method: "DELETE", path: "/book/1", status: 204, data: []byte(`{}`), violations: 1},
+		{name: "undocumented operation", method: "PATCH", path: "/book/1", status: 200, violations: 1},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			violations := ValidateResponse(scenario.method, scenario.path, scenario.status, header, scenario.data)
+			if len(violations) != scenario.violations {
+				t.Errorf("Expected %v violations, got %v", scenario.violations, violations)
+			}
+		})
+	}
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	var buffer bytes.Buffer
+	_, err := buffer.ReadFrom(r.Body)
+	return buffer.Bytes(), err
+}
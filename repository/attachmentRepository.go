@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"database/sql"
+	"go-rest-webservices-book-library/domain"
+	"time"
+)
+
+const (
+	attachmentColumns  = "id, book_id, format, content_type, digest, bytes, title, author, isbn, language, uploaded_at"
+	digitalLoanColumns = "id, book_id, member_id, loaned_at, due_at, returned_at"
+
+	insertAttachmentQuery = `INSERT INTO attachments (book_id, format, content_type, digest, bytes, title, author, isbn, language, uploaded_at)
+								VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	getAttachmentQuery     = "SELECT " + attachmentColumns + " FROM attachments WHERE id=?"
+	getAttachmentsQuery    = "SELECT " + attachmentColumns + " FROM attachments WHERE book_id=? ORDER BY id"
+	deleteAttachmentQuery  = "DELETE FROM attachments WHERE id=?"
+	moveAttachmentsQuery   = "UPDATE attachments SET book_id=? WHERE book_id IN (%s)"
+	insertDigitalLoanQuery = "INSERT INTO digital_loans (book_id, member_id, loaned_at, due_at) VALUES (?, ?, ?, ?)"
+	getDigitalLoanQuery    = "SELECT " + digitalLoanColumns + " FROM digital_loans WHERE id=?"
+	getActiveLoanQuery     = "SELECT " + digitalLoanColumns + ` FROM digital_loans
+								WHERE book_id=? AND member_id=? AND returned_at IS NULL AND due_at > ? ORDER BY due_at DESC LIMIT 1`
+	returnDigitalLoanQuery = "UPDATE digital_loans SET returned_at=? WHERE id=? AND returned_at IS NULL"
+	moveDigitalLoansQuery  = "UPDATE digital_loans SET book_id=? WHERE book_id IN (%s)"
+
+	createAttachmentsQuery = `CREATE TABLE IF NOT EXISTS attachments (
+								id INTEGER PRIMARY KEY,
+								book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+								format TEXT NOT NULL,
+								content_type TEXT NOT NULL,
+								digest TEXT NOT NULL,
+								bytes INTEGER NOT NULL,
+								title TEXT NOT NULL DEFAULT '',
+								author TEXT NOT NULL DEFAULT '',
+								isbn TEXT NOT NULL DEFAULT '',
+								language TEXT NOT NULL DEFAULT '',
+								uploaded_at DATETIME NOT NULL);
+							CREATE INDEX IF NOT EXISTS attachments_book_id ON attachments (book_id);
+							CREATE TABLE IF NOT EXISTS digital_loans (
+								id INTEGER PRIMARY KEY,
+								book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+								member_id INTEGER NOT NULL REFERENCES members (id),
+								loaned_at DATETIME NOT NULL,
+								due_at DATETIME NOT NULL,
+								returned_at DATETIME);
+							CREATE INDEX IF NOT EXISTS digital_loans_book_id_member_id ON digital_loans (book_id, member_id);`
+)
+
+// AddAttachment records a digital edition of a book and returns its id.
+func AddAttachment(attachment domain.Attachment) (int64, error) {
+	metadata := attachment.Metadata
+	result, err := database.Exec(insertAttachmentQuery, attachment.BookId, attachment.Format, attachment.ContentType,
+		attachment.Digest, attachment.Bytes, metadata.Title, metadata.Author, metadata.Isbn, metadata.Language,
+		attachment.UploadedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetAttachment returns an attachment, nil when there is no such attachment.
+func GetAttachment(id int64) (*domain.Attachment, error) {
+	attachments, err := queryAttachments(getAttachmentQuery, id)
+	if err != nil || len(attachments) == 0 {
+		return nil, err
+	}
+	return &attachments[0], nil
+}
+
+// GetAttachments returns the attachments of a book in the order they were uploaded.
+func GetAttachments(bookId int64) ([]domain.Attachment, error) {
+	return queryAttachments(getAttachmentsQuery, bookId)
+}
+
+func DeleteAttachment(id int64) error {
+	_, err := database.Exec(deleteAttachmentQuery, id)
+	return err
+}
+
+// AddDigitalLoan lends the digital editions of a book to a member and returns the id of
+// the loan.
+func AddDigitalLoan(loan domain.DigitalLoan) (int64, error) {
+	result, err := database.Exec(insertDigitalLoanQuery, loan.BookId, loan.MemberId, loan.LoanedAt.UTC(), loan.DueAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetDigitalLoan returns a digital loan, nil when there is no such loan.
+func GetDigitalLoan(id int64) (*domain.DigitalLoan, error) {
+	return queryDigitalLoan(getDigitalLoanQuery, id)
+}
+
+// GetActiveDigitalLoan returns the loan of a book a member holds at now, the one due last
+// when there are several, and nil when there is none.
+func GetActiveDigitalLoan(bookId int64, memberId int64, now time.Time) (*domain.DigitalLoan, error) {
+	return queryDigitalLoan(getActiveLoanQuery, bookId, memberId, now.UTC())
+}
+
+// ReturnDigitalLoan ends a loan before it is due and reports whether it was still out.
+func ReturnDigitalLoan(id int64, returnedAt time.Time) (bool, error) {
+	result, err := database.Exec(returnDigitalLoanQuery, returnedAt.UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	return changed(result), nil
+}
+
+func queryAttachments(query string, args ...interface{}) ([]domain.Attachment, error) {
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []domain.Attachment{}
+	for rows.Next() {
+		var attachment domain.Attachment
+		metadata := &attachment.Metadata
+		err = rows.Scan(&attachment.Id, &attachment.BookId, &attachment.Format, &attachment.ContentType,
+			&attachment.Digest, &attachment.Bytes, &metadata.Title, &metadata.Author, &metadata.Isbn, &metadata.Language,
+			&attachment.UploadedAt)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+func queryDigitalLoan(query string, args ...interface{}) (*domain.DigitalLoan, error) {
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var loan domain.DigitalLoan
+	var returnedAt sql.NullTime
+	if err = rows.Scan(&loan.Id, &loan.BookId, &loan.MemberId, &loan.LoanedAt, &loan.DueAt, &returnedAt); err != nil {
+		return nil, err
+	}
+	if returnedAt.Valid {
+		loan.ReturnedAt = &returnedAt.Time
+	}
+	return &loan, nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func addMember(t *testing.T, name string) int64 {
+	email := name + strconv.FormatInt(time.Now().UnixNano(), 36) + "@library.example"
+	result, err := database.Exec("INSERT INTO members (name, email) VALUES (?, ?)", name, email)
+	if err != nil {
+		t.Fatalf("Could not add member: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+func TestGetActiveDigitalLoan(t *testing.T) {
+	books := addBooks(t, 2)
+	member := addMember(t, "Ged")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	expired := domain.DigitalLoan{BookId: books[0], MemberId: member, LoanedAt: now.Add(-72 * time.Hour), DueAt: now.Add(-time.Hour)}
+	if _, err := AddDigitalLoan(expired); err != nil {
+		t.Fatalf("Could not add loan: %v", err)
+	}
+	if loan, err := GetActiveDigitalLoan(books[0], member, now); err != nil || loan != nil {
+		t.Errorf("Expected a loan past due to be inactive, got %v, %v", loan, err)
+	}
+
+	id, _ := AddDigitalLoan(domain.DigitalLoan{BookId: books[0], MemberId: member, LoanedAt: now, DueAt: now.Add(time.Hour)})
+	if loan, err := GetActiveDigitalLoan(books[0], member, now); err != nil || loan == nil || loan.Id != id {
+		t.Errorf("Expected the loan to be active, got %v, %v", loan, err)
+	}
+	if loan, _ := GetActiveDigitalLoan(books[1], member, now); loan != nil {
+		t.Errorf("Expected no loan of another book, got %v", loan)
+	}
+
+	if returned, err := ReturnDigitalLoan(id, now); err != nil || !returned {
+		t.Errorf("Expected loan to be returned, got %v, %v", returned, err)
+	}
+	if returned, _ := ReturnDigitalLoan(id, now); returned {
+		t.Errorf("Expected a returned loan not to be returned again")
+	}
+	if loan, _ := GetDigitalLoan(id); loan == nil || loan.ReturnedAt == nil {
+		t.Errorf("Expected the loan to be returned, got %v", loan)
+	}
+}
+
+func TestMergeBooksMovesAttachmentsAndDigitalLoans(t *testing.T) {
+	books := addBooks(t, 2)
+	member := addMember(t, "Tenar")
+	now := time.Now().UTC().Truncate(time.Second)
+	attachment := domain.Attachment{BookId: books[1], Format: "epub", ContentType: "application/epub+zip", Digest: "digest",
+		Bytes: 10, Metadata: domain.EditionMetadata{Title: "Tehanu", Language: "en"}, UploadedAt: now}
+	attachmentId, err := AddAttachment(attachment)
+	if err != nil {
+		t.Fatalf("Could not add attachment: %v", err)
+	}
+	_, _ = AddDigitalLoan(domain.DigitalLoan{BookId: books[1], MemberId: member, LoanedAt: now, DueAt: now.Add(time.Hour)})
+
+	if _, err = MergeBooks(books[0], books[1:]); err != nil {
+		t.Fatalf("Expected books to be merged, got %v", err)
+	}
+	attachments, err := GetAttachments(books[0])
+	if err != nil || len(attachments) != 1 || attachments[0].Id != attachmentId || attachments[0].Metadata != attachment.Metadata {
+		t.Errorf("Expected the attachment to move to the target, got %v, %v", attachments, err)
+	}
+	if loan, _ := GetActiveDigitalLoan(books[0], member, now); loan == nil {
+		t.Errorf("Expected the digital loan to move to the target")
+	}
+}
@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"database/sql"
+	"go-rest-webservices-book-library/credits"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/events"
+)
+
+const (
+	authorColumns         = "id, name"
+	getAuthorQuery        = "SELECT " + authorColumns + " FROM authors WHERE id=?"
+	getAuthorsByIdsQuery  = "SELECT " + authorColumns + " FROM authors WHERE id IN (%s)"
+	findAuthorsQuery      = "SELECT " + authorColumns + " FROM authors WHERE name LIKE ? ORDER BY name, id LIMIT ? OFFSET ?"
+	getAuthorByKeyQuery   = "SELECT id FROM authors WHERE key=? ORDER BY id LIMIT 1"
+	insertAuthorQuery     = "INSERT INTO authors (name, key) VALUES (?, ?)"
+	updateAuthorQuery     = "UPDATE authors SET name=?, key=? WHERE id=?"
+	deleteAuthorQuery     = "DELETE FROM authors WHERE id=?"
+	countCreditsQuery     = "SELECT COUNT(*) FROM book_authors WHERE author_id=?"
+	getCreditedBooksQuery = "SELECT DISTINCT book_id FROM book_authors WHERE author_id=? ORDER BY book_id"
+	getAuthorBooksQuery   = "SELECT " + bookColumns + " FROM books WHERE id IN (SELECT book_id FROM book_authors WHERE author_id=?) ORDER BY id LIMIT ? OFFSET ?"
+	getCreditsQuery       = `SELECT book_authors.author_id, authors.name, book_authors.role, book_authors.position
+								FROM book_authors JOIN authors ON authors.id = book_authors.author_id
+								WHERE book_authors.book_id=? ORDER BY book_authors.position`
+	deleteCreditsQuery    = "DELETE FROM book_authors WHERE book_id=?"
+	insertCreditQuery     = "INSERT INTO book_authors (book_id, author_id, role, position) VALUES (?, ?, ?, ?)"
+	updateBookAuthorQuery = "UPDATE books SET author=? WHERE id=?"
+	getBookAuthorsQuery   = "SELECT id, author FROM books ORDER BY id"
+
+	// key is the name as normalised by credits.Key, which the author strings of books are
+	// matched to authors by.
+	createAuthorsQuery = `CREATE TABLE IF NOT EXISTS authors (
+									id INTEGER PRIMARY KEY,
+									name TEXT NOT NULL,
+									key TEXT NOT NULL);
+								CREATE INDEX IF NOT EXISTS authors_key ON authors (key);
+								CREATE TABLE IF NOT EXISTS book_authors (
+									book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+									author_id INTEGER NOT NULL REFERENCES authors(id),
+									role TEXT NOT NULL,
+									position INTEGER NOT NULL,
+									PRIMARY KEY (book_id, author_id, role));
+								CREATE INDEX IF NOT EXISTS book_authors_author_id ON book_authors (author_id);`
+)
+
+func GetAuthor(id int64) (*domain.Author, error) {
+	authors, err := queryAuthors(database, getAuthorQuery, id)
+	if err != nil || len(authors) == 0 {
+		return nil, err
+	}
+	return &authors[0], nil
+}
+
+// FindAuthors pages through the authors whose name contains name, by name.
+func FindAuthors(name string, limit int64, offset int64) ([]domain.Author, error) {
+	return queryAuthors(database, findAuthorsQuery, "%"+name+"%", limit, offset)
+}
+
+func AddAuthor(author domain.Author) (int64, error) {
+	result, err := database.Exec(insertAuthorQuery, author.Name, credits.Key(author.Name))
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateAuthor renames an author, and with them the author of every book they are
+// credited on.
+func UpdateAuthor(author domain.Author) error {
+	return InTransaction(func(uow *UnitOfWork) error {
+		result, err := uow.Exec(updateAuthorQuery, author.Name, credits.Key(author.Name), author.Id)
+		if err != nil || !changed(result) {
+			return err
+		}
+
+		bookIds, err := queryIds(uow, getCreditedBooksQuery, author.Id)
+		if err != nil {
+			return err
+		}
+		for _, bookId := range bookIds {
+			credited, err := queryCredits(uow, bookId)
+			if err != nil {
+				return err
+			}
+			if err = updateBookAuthor(uow, bookId, credits.Format(credited)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteAuthor deletes an author who is not credited on any book, and reports whether it
+// did.
+func DeleteAuthor(id int64) (bool, error) {
+	var deleted bool
+	err := InTransaction(func(uow *UnitOfWork) error {
+		count, err := queryIds(uow, countCreditsQuery, id)
+		if err != nil || count[0] > 0 {
+			return err
+		}
+		result, err := uow.Exec(deleteAuthorQuery, id)
+		if err == nil {
+			deleted = changed(result)
+		}
+		return err
+	})
+	return deleted, err
+}
+
+// GetAuthorBooks pages through the books an author is credited on, in any role.
+func GetAuthorBooks(id int64, limit int64, offset int64) ([]domain.Book, error) {
+	rows, err := database.Query(getAuthorBooksQuery, id, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanBooks(rows)
+}
+
+// GetCredits returns the credits of a book, in order.
+func GetCredits(bookId int64) ([]domain.Credit, error) {
+	return queryCredits(database, bookId)
+}
+
+// SetCredits replaces the credits of a book, numbering them in the order given, and sets
+// its author to their credits.Format. It returns nil, and changes nothing, unless the book
+// and every credited author exist.
+func SetCredits(bookId int64, credited []domain.Credit) ([]domain.Credit, error) {
+	var set []domain.Credit
+	err := InTransaction(func(uow *UnitOfWork) error {
+		ids := make([]int64, len(credited))
+		for i, credit := range credited {
+			ids[i] = credit.AuthorId
+		}
+		authors, err := queryAuthors(uow, inQuery(getAuthorsByIdsQuery, len(ids)), int64Args(ids)...)
+		if err != nil {
+			return err
+		}
+		names := map[int64]string{}
+		for _, author := range authors {
+			names[author.Id] = author.Name
+		}
+
+		list := make([]domain.Credit, len(credited))
+		for i, credit := range credited {
+			name, found := names[credit.AuthorId]
+			if !found {
+				return nil
+			}
+			list[i] = domain.Credit{AuthorId: credit.AuthorId, Name: name, Role: credit.Role, Position: i + 1}
+		}
+
+		result, err := uow.Exec(updateBookAuthorQuery, credits.Format(list), bookId)
+		if err != nil || !changed(result) {
+			return err
+		}
+		if err = insertCredits(uow, bookId, list); err != nil {
+			return err
+		}
+		if err = recordBookUpdated(uow, bookId); err != nil {
+			return err
+		}
+		set = list
+		return nil
+	})
+	return set, err
+}
+
+// linkAuthors credits a book with the authors its free text author names, adding the
+// authors who are not known yet.
+func linkAuthors(q querier, bookId int64, author string) error {
+	parsed := credits.Parse(author)
+	for i, credit := range parsed {
+		ids, err := queryIds(q, getAuthorByKeyQuery, credits.Key(credit.Name))
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			parsed[i].AuthorId = ids[0]
+			continue
+		}
+
+		result, err := q.Exec(insertAuthorQuery, credit.Name, credits.Key(credit.Name))
+		if err != nil {
+			return err
+		}
+		if parsed[i].AuthorId, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+	return insertCredits(q, bookId, parsed)
+}
+
+// creditExistingBooks is the data migration splitting the author of every book into
+// author records.
+func creditExistingBooks(q querier) error {
+	rows, err := q.Query(getBookAuthorsQuery)
+	if err != nil {
+		return err
+	}
+	authors := map[int64]string{}
+	var bookIds []int64
+	for rows.Next() {
+		var bookId int64
+		var author sql.NullString
+		if err = rows.Scan(&bookId, &author); err != nil {
+			rows.Close()
+			return err
+		}
+		authors[bookId] = author.String
+		bookIds = append(bookIds, bookId)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, bookId := range bookIds {
+		if err = linkAuthors(q, bookId, authors[bookId]); err != nil {
+			return err
+		}
+	}
+	logger.Info("Credited authors of existing books")
+	return nil
+}
+
+func insertCredits(q querier, bookId int64, credited []domain.Credit) error {
+	if _, err := q.Exec(deleteCreditsQuery, bookId); err != nil {
+		return err
+	}
+	for _, credit := range credited {
+		if _, err := q.Exec(insertCreditQuery, bookId, credit.AuthorId, credit.Role, credit.Position); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func updateBookAuthor(uow *UnitOfWork, bookId int64, author string) error {
+	if _, err := uow.Exec(updateBookAuthorQuery, author, bookId); err != nil {
+		return err
+	}
+	return recordBookUpdated(uow, bookId)
+}
+
+func recordBookUpdated(uow *UnitOfWork, bookId int64) error {
+	rows, err := uow.Query(getQuery, bookId)
+	if err != nil {
+		return err
+	}
+	books, err := scanBooks(rows)
+	if err != nil || len(books) == 0 {
+		return err
+	}
+	return uow.Record(events.BookUpdated, books[0])
+}
+
+func queryAuthors(q querier, query string, args ...interface{}) ([]domain.Author, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []domain.Author{}
+	for rows.Next() {
+		var author domain.Author
+		if err = rows.Scan(&author.Id, &author.Name); err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+	return authors, rows.Err()
+}
+
+func queryCredits(q querier, bookId int64) ([]domain.Credit, error) {
+	rows, err := q.Query(getCreditsQuery, bookId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credited := []domain.Credit{}
+	for rows.Next() {
+		var credit domain.Credit
+		if err = rows.Scan(&credit.AuthorId, &credit.Name, &credit.Role, &credit.Position); err != nil {
+			return nil, err
+		}
+		credited = append(credited, credit)
+	}
+	return credited, rows.Err()
+}
+
+func queryIds(q querier, query string, args ...interface{}) ([]int64, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
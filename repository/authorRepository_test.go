@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAddBookCreditsItsAuthors(t *testing.T) {
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	first, _ := AddBook(domain.Book{Name: "Good Omens", Author: "Neil Gaiman" + suffix + " and Terry Pratchett" + suffix})
+	second, _ := AddBook(domain.Book{Name: "Mort", Author: "Pratchett" + suffix + ", Terry"})
+
+	credited, err := GetCredits(first)
+	if err != nil || len(credited) != 2 {
+		t.Fatalf("Expected two credits, got %v, %v", credited, err)
+	}
+	if credited[1].Name != "Terry Pratchett"+suffix || credited[1].Position != 2 || credited[1].Role != domain.RoleAuthor {
+		t.Errorf("Expected Terry Pratchett as second author, got %v", credited[1])
+	}
+
+	books, err := GetAuthorBooks(credited[1].AuthorId, 10, 0)
+	if err != nil || len(books) != 2 || books[0].Id != first || books[1].Id != second {
+		t.Errorf("Expected both books of the author, got %v, %v", books, err)
+	}
+}
+
+func TestUpdateBookKeepsCreditsOfSameAuthor(t *testing.T) {
+	id, _ := AddBook(domain.Book{Name: "Book", Author: "Author"})
+	editor, _ := AddAuthor(domain.Author{Name: "Editor"})
+	credited, _ := GetCredits(id)
+	set, err := SetCredits(id, []domain.Credit{credited[0], {AuthorId: editor, Role: domain.RoleEditor}})
+	if err != nil || len(set) != 2 {
+		t.Fatalf("Expected credits to be set, got %v, %v", set, err)
+	}
+
+	books, _ := GetBook(strconv.FormatInt(id, 10))
+	if books[0].Author != "Author & Editor (editor)" {
+		t.Errorf("Expected author to name the credits, got %v", books[0].Author)
+	}
+	if err = UpdateBook(domain.Book{Name: "Renamed", Author: books[0].Author}, strconv.FormatInt(id, 10)); err != nil {
+		t.Fatalf("Expected book to be updated, got %v", err)
+	}
+	if kept, _ := GetCredits(id); len(kept) != 2 || kept[1].AuthorId != editor {
+		t.Errorf("Expected credits to be kept, got %v", kept)
+	}
+}
+
+func TestUpdateAuthorRenamesTheirBooks(t *testing.T) {
+	author, _ := AddAuthor(domain.Author{Name: "Mary Westmacott"})
+	id, _ := AddBook(domain.Book{Name: "Absent in the Spring", Author: "Someone"})
+	if _, err := SetCredits(id, []domain.Credit{{AuthorId: author, Role: domain.RoleAuthor}}); err != nil {
+		t.Fatalf("Expected credits to be set, got %v", err)
+	}
+
+	if err := UpdateAuthor(domain.Author{Id: author, Name: "Agatha Christie"}); err != nil {
+		t.Fatalf("Expected author to be renamed, got %v", err)
+	}
+	if books, _ := GetBook(strconv.FormatInt(id, 10)); books[0].Author != "Agatha Christie" {
+		t.Errorf("Expected book to be renamed, got %v", books[0].Author)
+	}
+	if deleted, err := DeleteAuthor(author); deleted || err != nil {
+		t.Errorf("Expected credited author to be kept, got %v, %v", deleted, err)
+	}
+}
+
+func TestSetCreditsRequiresExistingAuthors(t *testing.T) {
+	id, _ := AddBook(domain.Book{Name: "Book", Author: "Author"})
+
+	set, err := SetCredits(id, []domain.Credit{{AuthorId: -1, Role: domain.RoleAuthor}})
+	if err != nil || set != nil {
+		t.Errorf("Expected nothing to be set, got %v, %v", set, err)
+	}
+	if credited, _ := GetCredits(id); len(credited) != 1 || credited[0].Name != "Author" {
+		t.Errorf("Expected credits to be kept, got %v", credited)
+	}
+}
+
+func TestCreditExistingBooks(t *testing.T) {
+	result, err := database.Exec(insertQuery, "Migrated", "Tolkien, J. R. R.; Christopher Tolkien (ed.)", "", "", "", 0, 0)
+	if err != nil {
+		t.Fatalf("Expected book to be inserted, got %v", err)
+	}
+	id, _ := result.LastInsertId()
+
+	if err = creditExistingBooks(database); err != nil {
+		t.Fatalf("Expected books to be credited, got %v", err)
+	}
+	credited, _ := GetCredits(id)
+	if len(credited) != 2 || credited[0].Name != "J. R. R. Tolkien" || credited[1].Role != domain.RoleEditor {
+		t.Errorf("Expected Tolkien and his editor, got %v", credited)
+	}
+}
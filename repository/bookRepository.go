@@ -2,10 +2,16 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"go-rest-webservices-book-library/config"
 	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/events"
+	"go-rest-webservices-book-library/validation"
 	"go.uber.org/zap"
+	"strconv"
+	"strings"
 )
 
 var (
@@ -13,78 +19,267 @@ var (
 	logger   *zap.Logger
 )
 
+// ErrBookLent refuses to delete a book whose copies were ever lent, as the loans and the
+// fines on them are kept.
+var ErrBookLent = errors.New("book has loans on record and cannot be deleted")
+
 const (
-	getQuery                = "SELECT * FROM books WHERE id=?"
-	updateQuery             = "UPDATE books SET name=?, author=? where id=?"
+	bookColumns             = "id, name, author, isbn, publisher, year, pages"
+	getQuery                = "SELECT " + bookColumns + " FROM books WHERE id=?"
+	updateQuery             = "UPDATE books SET name=?, author=?, isbn=?, isbn13=?, publisher=?, year=?, pages=? where id=?"
 	deleteQuery             = "DELETE FROM books WHERE id=?"
-	getAllQuery             = "SELECT * FROM books"
-	insertQuery             = "INSERT INTO books (name, author) VALUES (?, ?)"
+	countBookLoansQuery     = "SELECT COUNT(*) FROM loans l JOIN copies c ON c.id = l.copy_id WHERE c.book_id=?"
+	getAllQuery             = "SELECT " + bookColumns + " FROM books"
+	getPageQuery            = "SELECT " + bookColumns + " FROM books ORDER BY id LIMIT ? OFFSET ?"
+	insertQuery             = "INSERT INTO books (name, author, isbn, isbn13, publisher, year, pages) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	findQuery               = "SELECT " + bookColumns + " FROM books WHERE name LIKE ? AND author LIKE ?%s ORDER BY id LIMIT ? OFFSET ?"
+	getByIdsQuery           = "SELECT " + bookColumns + " FROM books WHERE id IN (%s)"
+	getByAuthorsQuery       = "SELECT " + bookColumns + " FROM books WHERE author IN (%s) ORDER BY id"
+	getCandidatesQuery      = "SELECT " + bookColumns + " FROM books WHERE id <> ? AND ((isbn13 <> '' AND isbn13 = ?)%s) ORDER BY id LIMIT ?"
+	getAuthorsQuery         = "SELECT DISTINCT author FROM books WHERE author LIKE ? ORDER BY author LIMIT ? OFFSET ?"
 	initializeDatabaseQuery = `CREATE TABLE IF NOT EXISTS books (
 									id INTEGER PRIMARY KEY, 
 									name TEXT, 
 									author TEXT);`
+	// isbn13 holds the ISBN as normalised by validation.NormalizeIsbn, for comparisons.
+	addIsbnQuery = `ALTER TABLE books ADD COLUMN isbn TEXT NOT NULL DEFAULT '';
+								ALTER TABLE books ADD COLUMN isbn13 TEXT NOT NULL DEFAULT '';
+								CREATE INDEX IF NOT EXISTS books_isbn13 ON books (isbn13);`
+	addPublicationQuery = `ALTER TABLE books ADD COLUMN publisher TEXT NOT NULL DEFAULT '';
+								ALTER TABLE books ADD COLUMN year INTEGER NOT NULL DEFAULT 0;
+								ALTER TABLE books ADD COLUMN pages INTEGER NOT NULL DEFAULT 0;`
+
+	maxCandidates = 500
 )
 
 func init() {
-	initBooksDb()
 	logger = config.AppLogger
+	initBooksDb()
 }
 
 func initBooksDb() {
-	database, _ = sql.Open("sqlite3", "books.sql")
-	_, err := database.Exec(initializeDatabaseQuery)
+	database, _ = sql.Open("sqlite3", "books.sql?_foreign_keys=on")
+	_, err := Migrate()
 	if err != nil {
 		logger.Panic("Failure while initializing database, {}" + err.Error())
 	}
 }
 
 func UpdateBook(book domain.Book, id string) error {
-	statement, _ := database.Prepare(updateQuery)
-	_, err := statement.Exec(book.Name, book.Author, id)
+	return InTransaction(func(uow *UnitOfWork) error {
+		rows, err := uow.Query(getQuery, id)
+		if err != nil {
+			return err
+		}
+		current, err := scanBooks(rows)
+		if err != nil || len(current) == 0 {
+			return err
+		}
 
-	return err
+		if _, err = uow.Exec(updateQuery, book.Name, book.Author, book.Isbn, validation.NormalizeIsbn(book.Isbn),
+			book.Publisher, book.Year, book.Pages, id); err != nil {
+			return err
+		}
+		book.Id = current[0].Id
+		// The credits stay as they are unless the author is changed.
+		if book.Author != current[0].Author {
+			if err = linkAuthors(uow, book.Id, book.Author); err != nil {
+				return err
+			}
+		}
+		return uow.Record(events.BookUpdated, book)
+	})
 }
 
 func GetBook(id string) ([]domain.Book, error) {
 	rows, err := database.Query(getQuery, id)
 	var books []domain.Book
 
+	if err == nil {
+		defer rows.Close()
+	}
+
 	if err == nil && rows.Next() {
 		var book domain.Book
-		_ = rows.Scan(&book.Id, &book.Name, &book.Author)
+		_ = rows.Scan(bookFields(&book)...)
 		books = append(books, book)
 	}
 
 	return books, err
 }
 
+// DeleteBook deletes a book along with its copies, or returns ErrBookLent when any of them
+// was ever lent.
 func DeleteBook(id string) error {
-	statement, _ := database.Prepare(deleteQuery)
-	_, err := statement.Exec(id)
-
-	return err
+	return InTransaction(func(uow *UnitOfWork) error {
+		count, err := queryIds(uow, countBookLoansQuery, id)
+		if err != nil {
+			return err
+		}
+		if count[0] > 0 {
+			return ErrBookLent
+		}
+		result, err := uow.Exec(deleteQuery, id)
+		if err != nil || !changed(result) {
+			return err
+		}
+		bookId, _ := strconv.ParseInt(id, 10, 64)
+		return uow.Record(events.BookDeleted, domain.Book{Id: bookId})
+	})
 }
 
 func GetAllBooks() ([]domain.Book, error) {
 	rows, err := database.Query(getAllQuery)
+	if err == nil {
+		defer rows.Close()
+	}
 
-	var books []domain.Book
+	books := []domain.Book{}
+
+	for err == nil && rows.Next() {
+		var book domain.Book
+		err = rows.Scan(bookFields(&book)...)
+		books = append(books, book)
+	}
+
+	return books, err
+}
+
+func GetBooksPage(limit int64, offset int64) ([]domain.Book, error) {
+	rows, err := database.Query(getPageQuery, limit, offset)
+	if err == nil {
+		defer rows.Close()
+	}
+
+	books := []domain.Book{}
 
 	for err == nil && rows.Next() {
 		var book domain.Book
-		err = rows.Scan(&book.Id, &book.Name, &book.Author)
+		err = rows.Scan(bookFields(&book)...)
 		books = append(books, book)
 	}
 
 	return books, err
 }
 
+// FindBooks pages through the books whose name and author contain those of filter and,
+// when filter has a Subject, which are tagged with it or a subject below it.
+func FindBooks(filter domain.BookFilter, limit int64, offset int64) ([]domain.Book, error) {
+	query := fmt.Sprintf(findQuery, "")
+	args := []interface{}{"%" + filter.Name + "%", "%" + filter.Author + "%"}
+	if filter.Subject != 0 {
+		query = fmt.Sprintf(findQuery, subjectFilter)
+		args = append(args, filter.Subject)
+	}
+	rows, err := database.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBooks(rows)
+}
+
+func GetBooksByIds(ids []int64) ([]domain.Book, error) {
+	rows, err := database.Query(inQuery(getByIdsQuery, len(ids)), int64Args(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBooks(rows)
+}
+
+func GetBooksByAuthors(authors []string) ([]domain.Book, error) {
+	args := make([]interface{}, len(authors))
+	for i, author := range authors {
+		args[i] = author
+	}
+
+	rows, err := database.Query(inQuery(getByAuthorsQuery, len(authors)), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBooks(rows)
+}
+
+// FindDuplicateCandidates returns the books, other than book, which share its ISBN or
+// contain one of terms in their name or author, for the duplicate detector to compare.
+func FindDuplicateCandidates(book domain.Book, terms []string) ([]domain.Book, error) {
+	conditions := strings.Repeat(" OR name LIKE ? OR author LIKE ?", len(terms))
+	args := []interface{}{book.Id, validation.NormalizeIsbn(book.Isbn)}
+	for _, term := range terms {
+		args = append(args, "%"+term+"%", "%"+term+"%")
+	}
+	args = append(args, maxCandidates)
+
+	rows, err := database.Query(strings.Replace(getCandidatesQuery, "%s", conditions, 1), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBooks(rows)
+}
+
+// GetAuthors pages through the distinct author names containing name.
+func GetAuthors(name string, limit int64, offset int64) ([]string, error) {
+	rows, err := database.Query(getAuthorsQuery, "%"+name+"%", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []string{}
+	for rows.Next() {
+		var author string
+		if err = rows.Scan(&author); err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+	return authors, rows.Err()
+}
+
 func AddBook(book domain.Book) (int64, error) {
-	statement, _ := database.Prepare(insertQuery)
-	result, insertRecordErr := statement.Exec(book.Name, book.Author)
-	if insertRecordErr != nil {
-		logger.Error("Error occurred while inserting data in books table: %s" + insertRecordErr.Error())
-		return -1, insertRecordErr
+	err := InTransaction(func(uow *UnitOfWork) error {
+		result, insertRecordErr := uow.Exec(insertQuery, book.Name, book.Author, book.Isbn, validation.NormalizeIsbn(book.Isbn),
+			book.Publisher, book.Year, book.Pages)
+		if insertRecordErr != nil {
+			logger.Error("Error occurred while inserting data in books table: %s" + insertRecordErr.Error())
+			return insertRecordErr
+		}
+
+		rowId, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		book.Id = rowId
+		if err = linkAuthors(uow, book.Id, book.Author); err != nil {
+			return err
+		}
+		return uow.Record(events.BookCreated, book)
+	})
+	if err != nil {
+		return -1, err
+	}
+	return book.Id, nil
+}
+
+func changed(result sql.Result) bool {
+	rowsAffected, err := result.RowsAffected()
+	return err == nil && rowsAffected > 0
+}
+
+func scanBooks(rows *sql.Rows) ([]domain.Book, error) {
+	defer rows.Close()
+
+	books := []domain.Book{}
+	for rows.Next() {
+		var book domain.Book
+		if err := rows.Scan(bookFields(&book)...); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
 	}
-	return result.LastInsertId()
+	return books, rows.Err()
+}
+
+// bookFields points at the fields of book in the order of bookColumns, for scanning.
+func bookFields(book *domain.Book) []interface{} {
+	return []interface{}{&book.Id, &book.Name, &book.Author, &book.Isbn, &book.Publisher, &book.Year, &book.Pages}
 }
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"testing"
+)
+
+func TestAddBookStoresPublication(t *testing.T) {
+	id, err := AddBook(domain.Book{Name: "A Wizard of Earthsea", Author: "Ursula K. Le Guin", Publisher: "Parnassus", Year: 1968, Pages: 205})
+	if err != nil {
+		t.Fatalf("Could not add book: %v", err)
+	}
+	books, err := GetBook(strconv.FormatInt(id, 10))
+	if err != nil || len(books) != 1 || books[0].Publisher != "Parnassus" || books[0].Year != 1968 || books[0].Pages != 205 {
+		t.Errorf("Expected the publisher, year and pages to be stored, got %v, %v", books, err)
+	}
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"database/sql"
+	"go-rest-webservices-book-library/domain"
+	"strings"
+	"time"
+)
+
+const (
+	copyColumns   = "id, book_id, barcode, status, item_type"
+	memberColumns = "id, name, email"
+	loanColumns   = "id, copy_id, member_id, loaned_at, due_at, returned_at, renewals"
+	holdColumns   = "id, book_id, member_id, placed_at"
+
+	getCopiesByBookIdsQuery       = "SELECT " + copyColumns + " FROM copies WHERE book_id IN (%s) ORDER BY id"
+	getCopiesByIdsQuery           = "SELECT " + copyColumns + " FROM copies WHERE id IN (%s)"
+	insertCopyQuery               = "INSERT OR IGNORE INTO copies (book_id, barcode, item_type) VALUES (?, ?, ?)"
+	updateCopyQuery               = "UPDATE OR IGNORE copies SET barcode=?, item_type=? WHERE id=?"
+	getMembersByIdsQuery          = "SELECT " + memberColumns + " FROM members WHERE id IN (%s)"
+	getMembersQuery               = "SELECT " + memberColumns + " FROM members WHERE name LIKE ? ORDER BY id LIMIT ? OFFSET ?"
+	getCurrentLoansByCopyIdsQuery = "SELECT " + loanColumns + " FROM loans WHERE returned_at IS NULL AND copy_id IN (%s)"
+	getLoansByMemberIdsQuery      = "SELECT " + loanColumns + " FROM loans WHERE member_id IN (%s) ORDER BY id"
+	getLoansQuery                 = "SELECT " + loanColumns + " FROM loans WHERE (? = 0 OR member_id = ?) AND (? = 0 OR returned_at IS NULL) ORDER BY id LIMIT ? OFFSET ?"
+	getHoldsByBookIdsQuery        = "SELECT " + holdColumns + " FROM holds WHERE book_id IN (%s) ORDER BY placed_at"
+	expireHoldsQuery              = "DELETE FROM holds WHERE placed_at < ?"
+
+	// Holds used to outlive the loans of the members who collected them.
+	deleteCollectedHoldsQuery = `DELETE FROM holds WHERE EXISTS (SELECT 1 FROM loans l JOIN copies c ON c.id = l.copy_id
+									WHERE l.returned_at IS NULL AND l.member_id = holds.member_id AND c.book_id = holds.book_id)`
+
+	createCirculationTablesQuery = `CREATE TABLE IF NOT EXISTS copies (
+									id INTEGER PRIMARY KEY,
+									book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+									barcode TEXT NOT NULL UNIQUE,
+									status TEXT NOT NULL DEFAULT 'available');
+								CREATE INDEX IF NOT EXISTS copies_book_id ON copies (book_id);
+								CREATE TABLE IF NOT EXISTS members (
+									id INTEGER PRIMARY KEY,
+									name TEXT NOT NULL,
+									email TEXT NOT NULL UNIQUE);
+								CREATE TABLE IF NOT EXISTS loans (
+									id INTEGER PRIMARY KEY,
+									copy_id INTEGER NOT NULL REFERENCES copies(id),
+									member_id INTEGER NOT NULL REFERENCES members(id),
+									loaned_at DATETIME NOT NULL,
+									due_at DATETIME NOT NULL,
+									returned_at DATETIME);
+								CREATE INDEX IF NOT EXISTS loans_copy_id ON loans (copy_id);
+								CREATE INDEX IF NOT EXISTS loans_member_id ON loans (member_id);
+								CREATE TABLE IF NOT EXISTS holds (
+									id INTEGER PRIMARY KEY,
+									book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+									member_id INTEGER NOT NULL REFERENCES members(id),
+									placed_at DATETIME NOT NULL);
+								CREATE INDEX IF NOT EXISTS holds_book_id ON holds (book_id);`
+)
+
+func GetCopiesByBookIds(bookIds []int64) ([]domain.Copy, error) {
+	return queryCopies(getCopiesByBookIdsQuery, bookIds)
+}
+
+func GetCopiesByIds(ids []int64) ([]domain.Copy, error) {
+	return queryCopies(getCopiesByIdsQuery, ids)
+}
+
+// AddCopy adds an available copy of a book and returns it, nil when another copy has its
+// barcode.
+func AddCopy(copy domain.Copy) (*domain.Copy, error) {
+	result, err := database.Exec(insertCopyQuery, copy.BookId, copy.Barcode, copy.ItemType)
+	if err != nil || !changed(result) {
+		return nil, err
+	}
+	if copy.Id, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	copy.Status = domain.CopyAvailable
+	return &copy, nil
+}
+
+// UpdateCopy sets the barcode and the item type of a copy, and returns false when another
+// copy has the barcode.
+func UpdateCopy(copy domain.Copy) (bool, error) {
+	result, err := database.Exec(updateCopyQuery, copy.Barcode, copy.ItemType, copy.Id)
+	if err != nil {
+		return false, err
+	}
+	return changed(result), nil
+}
+
+func GetMembersByIds(ids []int64) ([]domain.Member, error) {
+	rows, err := database.Query(inQuery(getMembersByIdsQuery, len(ids)), int64Args(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanMembers(rows)
+}
+
+// GetMembers pages through members whose name contains name.
+func GetMembers(name string, limit int64, offset int64) ([]domain.Member, error) {
+	rows, err := database.Query(getMembersQuery, "%"+name+"%", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanMembers(rows)
+}
+
+func GetCurrentLoansByCopyIds(copyIds []int64) ([]domain.Loan, error) {
+	return queryLoans(database, inQuery(getCurrentLoansByCopyIdsQuery, len(copyIds)), int64Args(copyIds)...)
+}
+
+func GetLoansByMemberIds(memberIds []int64) ([]domain.Loan, error) {
+	return queryLoans(database, inQuery(getLoansByMemberIdsQuery, len(memberIds)), int64Args(memberIds)...)
+}
+
+// GetLoans pages through loans, only those of memberId unless it is zero and only loans
+// which are still out when currentOnly is set.
+func GetLoans(memberId int64, currentOnly bool, limit int64, offset int64) ([]domain.Loan, error) {
+	current := 0
+	if currentOnly {
+		current = 1
+	}
+	return queryLoans(database, getLoansQuery, memberId, memberId, current, limit, offset)
+}
+
+func GetHoldsByBookIds(bookIds []int64) ([]domain.Hold, error) {
+	rows, err := database.Query(inQuery(getHoldsByBookIdsQuery, len(bookIds)), int64Args(bookIds)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := []domain.Hold{}
+	for rows.Next() {
+		var hold domain.Hold
+		if err = rows.Scan(&hold.Id, &hold.BookId, &hold.MemberId, &hold.PlacedAt); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// ExpireHolds cancels the holds placed before the given time and returns how many there
+// were.
+func ExpireHolds(placedBefore time.Time) (int64, error) {
+	return deleteRows(expireHoldsQuery, placedBefore.UTC())
+}
+
+func queryCopies(query string, ids []int64) ([]domain.Copy, error) {
+	rows, err := database.Query(inQuery(query, len(ids)), int64Args(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	copies := []domain.Copy{}
+	for rows.Next() {
+		var copy domain.Copy
+		if err = rows.Scan(&copy.Id, &copy.BookId, &copy.Barcode, &copy.Status, &copy.ItemType); err != nil {
+			return nil, err
+		}
+		copies = append(copies, copy)
+	}
+	return copies, rows.Err()
+}
+
+func queryLoans(q querier, query string, args ...interface{}) ([]domain.Loan, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loans := []domain.Loan{}
+	for rows.Next() {
+		var loan domain.Loan
+		var returnedAt sql.NullTime
+		if err = rows.Scan(&loan.Id, &loan.CopyId, &loan.MemberId, &loan.LoanedAt, &loan.DueAt, &returnedAt, &loan.Renewals); err != nil {
+			return nil, err
+		}
+		if returnedAt.Valid {
+			loan.ReturnedAt = &returnedAt.Time
+		}
+		loans = append(loans, loan)
+	}
+	return loans, rows.Err()
+}
+
+func scanMembers(rows *sql.Rows) ([]domain.Member, error) {
+	defer rows.Close()
+
+	members := []domain.Member{}
+	for rows.Next() {
+		var member domain.Member
+		if err := rows.Scan(&member.Id, &member.Name, &member.Email); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// inQuery fills the %s of query with count placeholders for an IN clause.
+func inQuery(query string, count int) string {
+	if count == 0 {
+		return strings.Replace(query, "%s", "NULL", 1)
+	}
+	return strings.Replace(query, "%s", strings.TrimSuffix(strings.Repeat("?,", count), ","), 1)
+}
+
+func int64Args(values []int64) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
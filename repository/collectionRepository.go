@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+)
+
+const (
+	collectionColumns     = "id, name, kind, description"
+	getCollectionQuery    = "SELECT " + collectionColumns + " FROM collections WHERE id=?"
+	findCollectionsQuery  = "SELECT " + collectionColumns + " FROM collections WHERE name LIKE ? AND (? = '' OR kind = ?) ORDER BY name, id LIMIT ? OFFSET ?"
+	insertCollectionQuery = "INSERT INTO collections (name, kind, description) VALUES (?, ?, ?)"
+	updateCollectionQuery = "UPDATE collections SET name=?, kind=?, description=? WHERE id=?"
+	deleteCollectionQuery = "DELETE FROM collections WHERE id=?"
+)
+
+func GetCollection(id int64) (*domain.Collection, error) {
+	collections, err := queryCollections(getCollectionQuery, id)
+	if err != nil || len(collections) == 0 {
+		return nil, err
+	}
+	return &collections[0], nil
+}
+
+// FindCollections pages through the collections of kind, every kind when it is empty,
+// whose name contains name, by name.
+func FindCollections(name string, kind string, limit int64, offset int64) ([]domain.Collection, error) {
+	return queryCollections(findCollectionsQuery, "%"+name+"%", kind, kind, limit, offset)
+}
+
+func AddCollection(collection domain.Collection) (int64, error) {
+	result, err := database.Exec(insertCollectionQuery, collection.Name, collection.Kind, collection.Description)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func UpdateCollection(collection domain.Collection) error {
+	_, err := database.Exec(updateCollectionQuery, collection.Name, collection.Kind, collection.Description, collection.Id)
+	return err
+}
+
+// DeleteCollection deletes a collection, the books in it are kept.
+func DeleteCollection(id int64) error {
+	_, err := database.Exec(deleteCollectionQuery, id)
+	return err
+}
+
+func queryCollections(query string, args ...interface{}) ([]domain.Collection, error) {
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []domain.Collection{}
+	for rows.Next() {
+		var collection domain.Collection
+		if err = rows.Scan(&collection.Id, &collection.Name, &collection.Kind, &collection.Description); err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+)
+
+const (
+	coverColumns = "book_id, content_type, digest, width, height, bytes, updated_at"
+
+	getCoverQuery = "SELECT " + coverColumns + " FROM book_covers WHERE book_id=?"
+	setCoverQuery = `INSERT INTO book_covers (` + coverColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)
+						ON CONFLICT (book_id) DO UPDATE SET content_type=excluded.content_type, digest=excluded.digest,
+							width=excluded.width, height=excluded.height, bytes=excluded.bytes, updated_at=excluded.updated_at`
+	deleteCoverQuery = "DELETE FROM book_covers WHERE book_id=?"
+
+	createCoversQuery = `CREATE TABLE IF NOT EXISTS book_covers (
+							book_id INTEGER PRIMARY KEY REFERENCES books (id) ON DELETE CASCADE,
+							content_type TEXT NOT NULL,
+							digest TEXT NOT NULL,
+							width INTEGER NOT NULL,
+							height INTEGER NOT NULL,
+							bytes INTEGER NOT NULL,
+							updated_at DATETIME NOT NULL);`
+)
+
+// GetCover returns the cover of a book, nil when it has none.
+func GetCover(bookId int64) (*domain.Cover, error) {
+	return getCover(database, bookId)
+}
+
+// SetCover records the cover of a book and returns the one it replaced, nil when the book
+// had none.
+func SetCover(cover domain.Cover) (*domain.Cover, error) {
+	var previous *domain.Cover
+	err := InTransaction(func(uow *UnitOfWork) error {
+		var err error
+		if previous, err = getCover(uow, cover.BookId); err != nil {
+			return err
+		}
+		_, err = uow.Exec(setCoverQuery, cover.BookId, cover.ContentType, cover.Digest, cover.Width, cover.Height,
+			cover.Bytes, cover.UpdatedAt.UTC())
+		return err
+	})
+	return previous, err
+}
+
+// DeleteCover forgets the cover of a book and returns it, nil when the book had none.
+func DeleteCover(bookId int64) (*domain.Cover, error) {
+	var deleted *domain.Cover
+	err := InTransaction(func(uow *UnitOfWork) error {
+		var err error
+		if deleted, err = getCover(uow, bookId); err != nil || deleted == nil {
+			return err
+		}
+		_, err = uow.Exec(deleteCoverQuery, bookId)
+		return err
+	})
+	return deleted, err
+}
+
+func getCover(q querier, bookId int64) (*domain.Cover, error) {
+	rows, err := q.Query(getCoverQuery, bookId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var cover domain.Cover
+	err = rows.Scan(&cover.BookId, &cover.ContentType, &cover.Digest, &cover.Width, &cover.Height, &cover.Bytes,
+		&cover.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &cover, nil
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"testing"
+	"time"
+)
+
+func TestSetCoverReturnsReplacedCover(t *testing.T) {
+	book := addBooks(t, 1)[0]
+	first := domain.Cover{BookId: book, ContentType: "image/png", Digest: "first", Width: 40, Height: 60, Bytes: 120,
+		UpdatedAt: time.Now().UTC().Truncate(time.Second)}
+	if previous, err := SetCover(first); err != nil || previous != nil {
+		t.Fatalf("Expected no cover to be replaced, got %v, %v", previous, err)
+	}
+
+	second := first
+	second.Digest = "second"
+	previous, err := SetCover(second)
+	if err != nil || previous == nil || previous.Digest != "first" || !previous.UpdatedAt.Equal(first.UpdatedAt) {
+		t.Fatalf("Expected the first cover to be replaced, got %v, %v", previous, err)
+	}
+	if cover, _ := GetCover(book); cover == nil || cover.Digest != "second" {
+		t.Errorf("Expected the second cover, got %v", cover)
+	}
+
+	if deleted, err := DeleteCover(book); err != nil || deleted == nil || deleted.Digest != "second" {
+		t.Errorf("Expected the second cover to be deleted, got %v, %v", deleted, err)
+	}
+	if deleted, err := DeleteCover(book); err != nil || deleted != nil {
+		t.Errorf("Expected no cover left to delete, got %v, %v", deleted, err)
+	}
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"encoding/json"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/events"
+	"strconv"
+	"time"
+)
+
+const (
+	eventColumns = "sequence, type, book_id, name, author, occurred_at, book"
+
+	insertEventQuery    = "INSERT INTO book_events (type, book_id, name, author, occurred_at, book) VALUES (?, ?, ?, ?, ?, ?)"
+	getEventsAfterQuery = "SELECT " + eventColumns + " FROM book_events WHERE sequence > ? ORDER BY sequence LIMIT ?"
+
+	createEventLogQuery = `CREATE TABLE IF NOT EXISTS book_events (
+									sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+									type TEXT NOT NULL,
+									book_id INTEGER NOT NULL,
+									name TEXT NOT NULL DEFAULT '',
+									author TEXT NOT NULL DEFAULT '',
+									occurred_at DATETIME NOT NULL);`
+
+	// book keeps the whole book as JSON, events logged before it only have the columns.
+	addEventBookQuery = "ALTER TABLE book_events ADD COLUMN book TEXT NOT NULL DEFAULT '';"
+)
+
+// GetEventsAfter reads up to limit events of the event log which follow sequence.
+func GetEventsAfter(sequence int64, limit int64) ([]events.Event, error) {
+	rows, err := database.Query(getEventsAfterQuery, sequence, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookEvents := []events.Event{}
+	for rows.Next() {
+		var event events.Event
+		var eventType, book string
+		if err := rows.Scan(&event.Sequence, &eventType, &event.Book.Id, &event.Book.Name,
+			&event.Book.Author, &event.OccurredAt, &book); err != nil {
+			return nil, err
+		}
+		if book != "" {
+			if err := json.Unmarshal([]byte(book), &event.Book); err != nil {
+				return nil, err
+			}
+		}
+		event.Type = events.Type(eventType)
+		bookEvents = append(bookEvents, event)
+	}
+	return bookEvents, rows.Err()
+}
+
+// Record appends a change to the event log and queues its webhook deliveries, both in
+// the unit of work, and dispatches it once the unit of work has committed.
+func (u *UnitOfWork) Record(eventType events.Type, book domain.Book) error {
+	event := events.Event{Type: eventType, Book: book, OccurredAt: time.Now().UTC()}
+	data, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+	result, err := u.Exec(insertEventQuery, event.Type, book.Id, book.Name, book.Author, event.OccurredAt, string(data))
+	if err == nil {
+		event.Sequence, err = result.LastInsertId()
+	}
+	if err != nil {
+		return err
+	}
+
+	payload := webhookPayload{
+		Id:         "book_events:" + strconv.FormatInt(event.Sequence, 10),
+		Type:       "book." + string(eventType),
+		OccurredAt: event.OccurredAt,
+		Data: map[string]interface{}{"book": map[string]interface{}{
+			"id": book.Id, "name": book.Name, "author": book.Author, "isbn": book.Isbn,
+			"publisher": book.Publisher, "year": book.Year, "pages": book.Pages,
+		}},
+	}
+	if err = enqueueWebhookDeliveries(u, payload); err != nil {
+		return err
+	}
+
+	u.events = append(u.events, event)
+	return nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strings"
+	"time"
+)
+
+const (
+	idempotencyColumns = "key, fingerprint, status, content_type, links, body, created_at, expires_at"
+
+	deleteExpiredIdempotencyKeysQuery = "DELETE FROM idempotency_keys WHERE expires_at <= ?"
+	reserveIdempotencyKeyQuery        = `INSERT OR IGNORE INTO idempotency_keys
+											(key, fingerprint, status, content_type, body, created_at, expires_at)
+											VALUES (?, ?, 0, '', x'', ?, ?)`
+	getIdempotencyKeyQuery      = "SELECT " + idempotencyColumns + " FROM idempotency_keys WHERE key=?"
+	saveIdempotentResponseQuery = "UPDATE idempotency_keys SET status=?, content_type=?, links=?, body=? WHERE key=? AND status=0"
+	releaseIdempotencyKeyQuery  = "DELETE FROM idempotency_keys WHERE key=? AND status=0"
+
+	createIdempotencyKeysQuery = `CREATE TABLE IF NOT EXISTS idempotency_keys (
+									key TEXT PRIMARY KEY,
+									fingerprint TEXT NOT NULL,
+									status INTEGER NOT NULL DEFAULT 0,
+									content_type TEXT NOT NULL DEFAULT '',
+									body BLOB NOT NULL,
+									created_at DATETIME NOT NULL,
+									expires_at DATETIME NOT NULL);
+								CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at ON idempotency_keys (expires_at);`
+
+	// links keeps the Link headers of a response one per line, as headers hold no newlines.
+	addIdempotentLinksQuery = "ALTER TABLE idempotency_keys ADD COLUMN links TEXT NOT NULL DEFAULT '';"
+)
+
+// ReserveIdempotencyKey claims key for the request with fingerprint until expiresAt, after
+// dropping the keys which have expired. When the key is already taken the response stored
+// for it is returned instead, with a zero Status while its request is still being served.
+func ReserveIdempotencyKey(key string, fingerprint string, now time.Time, expiresAt time.Time) (*domain.IdempotentResponse, error) {
+	if _, err := database.Exec(deleteExpiredIdempotencyKeysQuery, now.UTC()); err != nil {
+		return nil, err
+	}
+
+	result, err := database.Exec(reserveIdempotencyKeyQuery, key, fingerprint, now.UTC(), expiresAt.UTC())
+	if err != nil || changed(result) {
+		return nil, err
+	}
+
+	var response domain.IdempotentResponse
+	var links string
+	err = database.QueryRow(getIdempotencyKeyQuery, key).Scan(&response.Key, &response.Fingerprint, &response.Status,
+		&response.ContentType, &links, &response.Body, &response.CreatedAt, &response.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if links != "" {
+		response.Links = strings.Split(links, "\n")
+	}
+	return &response, nil
+}
+
+// SaveIdempotentResponse stores the response to the request which reserved key.
+func SaveIdempotentResponse(key string, status int, contentType string, links []string, body []byte) error {
+	_, err := database.Exec(saveIdempotentResponseQuery, status, contentType, strings.Join(links, "\n"), body, key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys drops the keys which expired by now, which requests
+// otherwise only do when they reserve a key, and returns how many there were.
+func DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	return deleteRows(deleteExpiredIdempotencyKeysQuery, now.UTC())
+}
+
+// ReleaseIdempotencyKey frees a key whose request failed, so that it can be retried.
+func ReleaseIdempotencyKey(key string) error {
+	_, err := database.Exec(releaseIdempotencyKeyQuery, key)
+	return err
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"go-rest-webservices-book-library/domain"
+	"time"
+)
+
+const (
+	jobRunColumns = "id, job, trigger, owner, scheduled_at, started_at, finished_at, status, message"
+
+	acquireJobLockQuery = `INSERT INTO job_locks (job, owner, locked_until) VALUES (?, ?, ?)
+							ON CONFLICT (job) DO UPDATE SET owner=excluded.owner, locked_until=excluded.locked_until
+								WHERE job_locks.locked_until <= ?`
+	releaseJobLockQuery = "DELETE FROM job_locks WHERE job=? AND owner=?"
+	insertJobRunQuery   = "INSERT OR IGNORE INTO job_runs (job, trigger, owner, scheduled_at, started_at, status, message) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	finishJobRunQuery   = "UPDATE job_runs SET finished_at=?, status=?, message=? WHERE id=?"
+	getJobRunsQuery     = "SELECT " + jobRunColumns + " FROM job_runs WHERE job=? ORDER BY started_at DESC, id DESC LIMIT ?"
+	getLastJobRunQuery  = "SELECT " + jobRunColumns + " FROM job_runs WHERE job=? AND status=? ORDER BY started_at DESC, id DESC LIMIT 1"
+	deleteJobRunsQuery  = "DELETE FROM job_runs WHERE finished_at IS NOT NULL AND started_at < ?"
+
+	// job_locks holds a row per job while an instance runs it, until locked_until in case
+	// the instance dies before it is done. Scheduled runs are unique by the time they were
+	// scheduled for, so every instance sharing the database can try each of them.
+	createJobsQuery = `CREATE TABLE IF NOT EXISTS job_locks (
+								job TEXT PRIMARY KEY,
+								owner TEXT NOT NULL,
+								locked_until DATETIME NOT NULL);
+							CREATE TABLE IF NOT EXISTS job_runs (
+								id INTEGER PRIMARY KEY,
+								job TEXT NOT NULL,
+								trigger TEXT NOT NULL,
+								owner TEXT NOT NULL,
+								scheduled_at DATETIME,
+								started_at DATETIME NOT NULL,
+								finished_at DATETIME,
+								status TEXT NOT NULL,
+								message TEXT NOT NULL DEFAULT '');
+							CREATE UNIQUE INDEX IF NOT EXISTS job_runs_job_scheduled_at ON job_runs (job, scheduled_at);
+							CREATE INDEX IF NOT EXISTS job_runs_job_started_at ON job_runs (job, started_at);`
+)
+
+// StartJobRun locks the job of run for its owner until lockedUntil and records the run as
+// started. It returns nil, and records nothing, when another run of the job holds the
+// lock or the scheduled run has already been run.
+func StartJobRun(run domain.JobRun, lockedUntil time.Time) (*domain.JobRun, error) {
+	var started *domain.JobRun
+	err := InTransaction(func(uow *UnitOfWork) error {
+		result, err := uow.Exec(acquireJobLockQuery, run.Job, run.Owner, lockedUntil.UTC(), run.StartedAt.UTC())
+		if err != nil || !changed(result) {
+			return err
+		}
+
+		var scheduledAt interface{}
+		if run.ScheduledAt != nil {
+			scheduledAt = run.ScheduledAt.UTC()
+		}
+		result, err = uow.Exec(insertJobRunQuery, run.Job, run.Trigger, run.Owner, scheduledAt, run.StartedAt.UTC(), domain.JobRunning, "")
+		if err != nil {
+			return err
+		}
+		if !changed(result) {
+			_, err = uow.Exec(releaseJobLockQuery, run.Job, run.Owner)
+			return err
+		}
+		if run.Id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		run.Status = domain.JobRunning
+		started = &run
+		return nil
+	})
+	return started, err
+}
+
+// FinishJobRun records how a started run ended and releases the lock on its job.
+func FinishJobRun(run domain.JobRun) error {
+	return InTransaction(func(uow *UnitOfWork) error {
+		if _, err := uow.Exec(finishJobRunQuery, run.FinishedAt.UTC(), run.Status, run.Message, run.Id); err != nil {
+			return err
+		}
+		_, err := uow.Exec(releaseJobLockQuery, run.Job, run.Owner)
+		return err
+	})
+}
+
+// GetJobRuns returns the latest runs of a job, newest first.
+func GetJobRuns(job string, limit int64) ([]domain.JobRun, error) {
+	return queryJobRuns(getJobRunsQuery, job, limit)
+}
+
+// GetLastJobRun returns the latest run of a job which ended with status, nil when there
+// is none.
+func GetLastJobRun(job string, status string) (*domain.JobRun, error) {
+	runs, err := queryJobRuns(getLastJobRunQuery, job, status)
+	if err != nil || len(runs) == 0 {
+		return nil, err
+	}
+	return &runs[0], nil
+}
+
+// DeleteJobRuns forgets the finished runs which started before the given time and
+// returns how many there were.
+func DeleteJobRuns(startedBefore time.Time) (int64, error) {
+	return deleteRows(deleteJobRunsQuery, startedBefore.UTC())
+}
+
+func deleteRows(query string, args ...interface{}) (int64, error) {
+	result, err := database.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func queryJobRuns(query string, args ...interface{}) ([]domain.JobRun, error) {
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []domain.JobRun{}
+	for rows.Next() {
+		var run domain.JobRun
+		var scheduledAt, finishedAt sql.NullTime
+		if err = rows.Scan(&run.Id, &run.Job, &run.Trigger, &run.Owner, &scheduledAt, &run.StartedAt, &finishedAt, &run.Status, &run.Message); err != nil {
+			return nil, err
+		}
+		if scheduledAt.Valid {
+			run.ScheduledAt = &scheduledAt.Time
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
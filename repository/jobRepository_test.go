@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestJobRunsAreLockedAndScheduledOnce(t *testing.T) {
+	job := "job-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	now := time.Now().UTC().Truncate(time.Second)
+	slot := now.Truncate(time.Minute)
+	scheduled := func(owner string, startedAt time.Time) domain.JobRun {
+		return domain.JobRun{Job: job, Trigger: domain.TriggerSchedule, Owner: owner, ScheduledAt: &slot, StartedAt: startedAt}
+	}
+
+	first, err := StartJobRun(scheduled("a", now), now.Add(time.Hour))
+	if err != nil || first == nil || first.Id == 0 || first.Status != domain.JobRunning {
+		t.Fatalf("Expected the run to start, got %v, %v", first, err)
+	}
+	manual := domain.JobRun{Job: job, Trigger: domain.TriggerManual, Owner: "b", StartedAt: now}
+	if run, err := StartJobRun(manual, now.Add(time.Hour)); err != nil || run != nil {
+		t.Fatalf("Expected the lock to be held, got %v, %v", run, err)
+	}
+
+	finishedAt := now.Add(time.Second)
+	first.FinishedAt, first.Status, first.Message = &finishedAt, domain.JobSucceeded, "done"
+	if err = FinishJobRun(*first); err != nil {
+		t.Fatalf("Could not finish run: %v", err)
+	}
+	if run, err := StartJobRun(scheduled("b", finishedAt), finishedAt.Add(time.Hour)); err != nil || run != nil {
+		t.Fatalf("Expected the scheduled run to run once, got %v, %v", run, err)
+	}
+
+	second, err := StartJobRun(manual, finishedAt.Add(time.Hour))
+	if err != nil || second == nil {
+		t.Fatalf("Expected the lock to be released after the run, got %v, %v", second, err)
+	}
+	// The run of an instance which died is given up on once its lock expires.
+	third, err := StartJobRun(domain.JobRun{Job: job, Trigger: domain.TriggerManual, Owner: "c", StartedAt: finishedAt.Add(2 * time.Hour)}, finishedAt.Add(3*time.Hour))
+	if err != nil || third == nil {
+		t.Fatalf("Expected an expired lock to be taken over, got %v, %v", third, err)
+	}
+
+	runs, err := GetJobRuns(job, 10)
+	if err != nil || len(runs) != 3 || runs[0].Id != third.Id || runs[2].Id != first.Id {
+		t.Fatalf("Expected three runs newest first, got %v, %v", runs, err)
+	}
+	if runs[2].ScheduledAt == nil || !runs[2].ScheduledAt.Equal(slot) || runs[2].FinishedAt == nil || runs[2].Message != "done" || runs[1].ScheduledAt != nil {
+		t.Errorf("Expected the runs as recorded, got %+v", runs)
+	}
+	if last, err := GetLastJobRun(job, domain.JobSucceeded); err != nil || last == nil || last.Id != first.Id {
+		t.Errorf("Expected the first run to be the last to succeed, got %v, %v", last, err)
+	}
+
+	if _, err = DeleteJobRuns(finishedAt.Add(time.Minute)); err != nil {
+		t.Fatalf("Could not delete runs: %v", err)
+	}
+	if runs, err = GetJobRuns(job, 10); err != nil || len(runs) != 2 {
+		t.Errorf("Expected only the finished run to be deleted, got %v, %v", runs, err)
+	}
+}
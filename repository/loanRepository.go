@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"time"
+)
+
+const (
+	fineColumns    = "id, loan_id, member_id, amount, overdue_days, assessed_at"
+	paymentColumns = "id, member_id, kind, amount, note, paid_at"
+
+	// A copy is lent unless it is kept for members who placed holds on the book before the
+	// borrower, or at all when the borrower placed none: there must be fewer of them than
+	// copies available, as for the holds ready to collect.
+	lendCopyQuery = `UPDATE copies SET status='` + domain.CopyOnLoan + `' WHERE id=? AND status='` + domain.CopyAvailable + `'
+						AND (SELECT COUNT(*) FROM holds h WHERE h.book_id = copies.book_id AND h.member_id <> ?
+							AND NOT EXISTS (SELECT 1 FROM holds o WHERE o.book_id = h.book_id AND o.member_id = ?
+								AND (o.placed_at < h.placed_at OR (o.placed_at = h.placed_at AND o.id < h.id))))
+							< (SELECT COUNT(*) FROM copies c WHERE c.book_id = copies.book_id AND c.status = '` + domain.CopyAvailable + `')`
+	collectHoldQuery = "DELETE FROM holds WHERE member_id=? AND book_id=(SELECT book_id FROM copies WHERE id=?)"
+	releaseCopyQuery = "UPDATE copies SET status='" + domain.CopyAvailable + "' WHERE id=? AND status='" + domain.CopyOnLoan + "'"
+	insertLoanQuery  = "INSERT INTO loans (copy_id, member_id, loaned_at, due_at) VALUES (?, ?, ?, ?)"
+	getLoanQuery     = "SELECT " + loanColumns + " FROM loans WHERE id=?"
+	renewLoanQuery   = "UPDATE loans SET due_at=?, renewals=renewals+1 WHERE id=? AND returned_at IS NULL AND renewals=?"
+	returnLoanQuery  = "UPDATE loans SET returned_at=? WHERE id=? AND returned_at IS NULL AND due_at=?"
+	insertFineQuery  = "INSERT INTO fines (loan_id, member_id, amount, overdue_days, assessed_at) VALUES (?, ?, ?, ?, ?)"
+	getFinesQuery    = "SELECT " + fineColumns + " FROM fines WHERE member_id=? ORDER BY id"
+	getPaymentsQuery = "SELECT " + paymentColumns + " FROM payments WHERE member_id=? ORDER BY id"
+	getBalanceQuery  = `SELECT (SELECT COALESCE(SUM(amount), 0) FROM fines WHERE member_id=?)
+							- (SELECT COALESCE(SUM(amount), 0) FROM payments WHERE member_id=?)`
+	insertPaymentQuery = "INSERT INTO payments (member_id, kind, amount, note, paid_at) VALUES (?, ?, ?, ?, ?)"
+
+	createFinesQuery = `ALTER TABLE copies ADD COLUMN item_type TEXT NOT NULL DEFAULT 'book';
+							ALTER TABLE loans ADD COLUMN renewals INTEGER NOT NULL DEFAULT 0;
+							CREATE TABLE IF NOT EXISTS fines (
+								id INTEGER PRIMARY KEY,
+								loan_id INTEGER NOT NULL UNIQUE REFERENCES loans(id),
+								member_id INTEGER NOT NULL REFERENCES members(id),
+								amount INTEGER NOT NULL,
+								overdue_days INTEGER NOT NULL,
+								assessed_at DATETIME NOT NULL);
+							CREATE INDEX IF NOT EXISTS fines_member_id ON fines (member_id);
+							CREATE TABLE IF NOT EXISTS payments (
+								id INTEGER PRIMARY KEY,
+								member_id INTEGER NOT NULL REFERENCES members(id),
+								kind TEXT NOT NULL,
+								amount INTEGER NOT NULL,
+								note TEXT NOT NULL DEFAULT '',
+								paid_at DATETIME NOT NULL);
+							CREATE INDEX IF NOT EXISTS payments_member_id ON payments (member_id);`
+)
+
+// CheckOut lends a copy to a member, who collects their hold on the book if they placed
+// one, and returns the loan. It returns nil when the copy is not available, or is kept
+// for members ahead in line.
+func CheckOut(loan domain.Loan) (*domain.Loan, error) {
+	var lent *domain.Loan
+	err := InTransaction(func(uow *UnitOfWork) error {
+		result, err := uow.Exec(lendCopyQuery, loan.CopyId, loan.MemberId, loan.MemberId)
+		if err != nil || !changed(result) {
+			return err
+		}
+		if _, err = uow.Exec(collectHoldQuery, loan.MemberId, loan.CopyId); err != nil {
+			return err
+		}
+		result, err = uow.Exec(insertLoanQuery, loan.CopyId, loan.MemberId, loan.LoanedAt.UTC(), loan.DueAt.UTC())
+		if err != nil {
+			return err
+		}
+		if loan.Id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		loan.Renewals = 0
+		loan.ReturnedAt = nil
+		lent = &loan
+		return nil
+	})
+	return lent, err
+}
+
+// GetLoan returns a loan, nil when there is no such loan.
+func GetLoan(id int64) (*domain.Loan, error) {
+	loans, err := queryLoans(database, getLoanQuery, id)
+	if err != nil || len(loans) == 0 {
+		return nil, err
+	}
+	return &loans[0], nil
+}
+
+// RenewLoan makes a loan due at dueAt and counts the renewal. It reports whether the loan
+// was renewed, which it is not once it has been returned or renewed by someone else since
+// it was read with renewals renewals.
+func RenewLoan(id int64, renewals int, dueAt time.Time) (bool, error) {
+	result, err := database.Exec(renewLoanQuery, dueAt.UTC(), id, renewals)
+	if err != nil {
+		return false, err
+	}
+	return changed(result), nil
+}
+
+// ReturnLoan ends a loan at returnedAt, makes its copy available again and charges the
+// fine, unless it is nil. It reports whether the loan was returned, which it is not once
+// it has been returned, or renewed since it was read, as the fine would be wrong.
+func ReturnLoan(loan domain.Loan, returnedAt time.Time, fine *domain.Fine) (bool, error) {
+	returned := false
+	err := InTransaction(func(uow *UnitOfWork) error {
+		result, err := uow.Exec(returnLoanQuery, returnedAt.UTC(), loan.Id, loan.DueAt.UTC())
+		if err != nil || !changed(result) {
+			return err
+		}
+		if _, err = uow.Exec(releaseCopyQuery, loan.CopyId); err != nil {
+			return err
+		}
+		if fine != nil {
+			result, err = uow.Exec(insertFineQuery, fine.LoanId, fine.MemberId, fine.Amount, fine.OverdueDays, fine.AssessedAt.UTC())
+			if err != nil {
+				return err
+			}
+			if fine.Id, err = result.LastInsertId(); err != nil {
+				return err
+			}
+		}
+		returned = true
+		return nil
+	})
+	return returned, err
+}
+
+// GetAccount returns the fines and payments of a member and the balance they leave.
+func GetAccount(memberId int64) (domain.Account, error) {
+	account := domain.Account{MemberId: memberId, Fines: []domain.Fine{}, Payments: []domain.Payment{}}
+
+	rows, err := database.Query(getFinesQuery, memberId)
+	if err != nil {
+		return account, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fine domain.Fine
+		if err = rows.Scan(&fine.Id, &fine.LoanId, &fine.MemberId, &fine.Amount, &fine.OverdueDays, &fine.AssessedAt); err != nil {
+			return account, err
+		}
+		account.Fines = append(account.Fines, fine)
+		account.Balance += fine.Amount
+	}
+	if err = rows.Err(); err != nil {
+		return account, err
+	}
+
+	paymentRows, err := database.Query(getPaymentsQuery, memberId)
+	if err != nil {
+		return account, err
+	}
+	defer paymentRows.Close()
+	for paymentRows.Next() {
+		var payment domain.Payment
+		if err = paymentRows.Scan(&payment.Id, &payment.MemberId, &payment.Kind, &payment.Amount, &payment.Note, &payment.PaidAt); err != nil {
+			return account, err
+		}
+		account.Payments = append(account.Payments, payment)
+		account.Balance -= payment.Amount
+	}
+	return account, paymentRows.Err()
+}
+
+// AddPayment records a payment or a waiver and returns it, or nil when it is more than
+// the member owes.
+func AddPayment(payment domain.Payment) (*domain.Payment, error) {
+	var added *domain.Payment
+	err := InTransaction(func(uow *UnitOfWork) error {
+		rows, err := uow.Query(getBalanceQuery, payment.MemberId, payment.MemberId)
+		if err != nil {
+			return err
+		}
+		var balance int64
+		if rows.Next() {
+			err = rows.Scan(&balance)
+		}
+		_ = rows.Close()
+		if err != nil || payment.Amount > balance {
+			return err
+		}
+
+		result, err := uow.Exec(insertPaymentQuery, payment.MemberId, payment.Kind, payment.Amount, payment.Note, payment.PaidAt.UTC())
+		if err != nil {
+			return err
+		}
+		if payment.Id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		added = &payment
+		return nil
+	})
+	return added, err
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func addCopy(t *testing.T, bookId int64, itemType string) int64 {
+	barcode := "LOAN-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	result, err := database.Exec("INSERT INTO copies (book_id, barcode, item_type) VALUES (?, ?, ?)", bookId, barcode, itemType)
+	if err != nil {
+		t.Fatalf("Could not add copy: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+func TestLoanLifecycle(t *testing.T) {
+	books := addBooks(t, 1)
+	copyId := addCopy(t, books[0], "dvd")
+	member := addMember(t, "Arha")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	loan, err := CheckOut(domain.Loan{CopyId: copyId, MemberId: member, LoanedAt: now, DueAt: now.AddDate(0, 0, 7)})
+	if err != nil || loan == nil || loan.Id == 0 {
+		t.Fatalf("Expected the copy to be lent, got %v, %v", loan, err)
+	}
+	if again, _ := CheckOut(domain.Loan{CopyId: copyId, MemberId: member, LoanedAt: now, DueAt: now}); again != nil {
+		t.Errorf("Expected a copy on loan not to be lent again, got %v", again)
+	}
+	if copies, _ := GetCopiesByIds([]int64{copyId}); len(copies) != 1 || copies[0].Status != domain.CopyOnLoan || copies[0].ItemType != "dvd" {
+		t.Errorf("Expected the dvd to be on loan, got %v", copies)
+	}
+
+	dueAt := now.AddDate(0, 0, 14)
+	if renewed, err := RenewLoan(loan.Id, 0, dueAt); err != nil || !renewed {
+		t.Errorf("Expected the loan to be renewed, got %v, %v", renewed, err)
+	}
+	if renewed, _ := RenewLoan(loan.Id, 0, dueAt); renewed {
+		t.Errorf("Expected a renewal of a stale loan to be refused")
+	}
+	if _, err = ReturnLoan(*loan, now, nil); err != nil {
+		t.Fatalf("Could not return loan: %v", err)
+	}
+	if current, _ := GetLoan(loan.Id); current == nil || current.ReturnedAt != nil || current.Renewals != 1 || !current.DueAt.Equal(dueAt) {
+		t.Fatalf("Expected the loan to be renewed and still out, got %v", current)
+	}
+
+	current, _ := GetLoan(loan.Id)
+	fine := &domain.Fine{LoanId: loan.Id, MemberId: member, Amount: 300, OverdueDays: 3, AssessedAt: now}
+	if returned, err := ReturnLoan(*current, now, fine); err != nil || !returned || fine.Id == 0 {
+		t.Errorf("Expected the loan to be returned with a fine, got %v, %v", returned, err)
+	}
+	if returned, _ := ReturnLoan(*current, now, fine); returned {
+		t.Errorf("Expected a returned loan not to be returned again")
+	}
+	if copies, _ := GetCopiesByIds([]int64{copyId}); len(copies) != 1 || copies[0].Status != domain.CopyAvailable {
+		t.Errorf("Expected the dvd to be available again, got %v", copies)
+	}
+}
+
+func TestCheckOutCollectsHold(t *testing.T) {
+	books := addBooks(t, 1)
+	copyId := addCopy(t, books[0], "book")
+	first, second := addMember(t, "Ged"), addMember(t, "Vetch")
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, member := range []int64{first, second} {
+		if _, err := PlaceHold(domain.Hold{BookId: books[0], MemberId: member, PlacedAt: now.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatalf("Could not place hold: %v", err)
+		}
+	}
+
+	if loan, err := CheckOut(domain.Loan{CopyId: copyId, MemberId: second, LoanedAt: now, DueAt: now}); err != nil || loan != nil {
+		t.Fatalf("Expected the only copy to be kept for the first in line, got %v, %v", loan, err)
+	}
+	loan, err := CheckOut(domain.Loan{CopyId: copyId, MemberId: first, LoanedAt: now, DueAt: now.AddDate(0, 0, 7)})
+	if err != nil || loan == nil {
+		t.Fatalf("Expected the copy to be lent to the first in line, got %v, %v", loan, err)
+	}
+
+	// The borrower collected their hold, so only the hold of others keeps them from renewing.
+	holds, err := GetHoldsByBookIds(books[0:1])
+	if err != nil || len(holds) != 1 || holds[0].MemberId != second {
+		t.Errorf("Expected only the hold of the second in line to be left, got %v, %v", holds, err)
+	}
+	if _, err = ReturnLoan(*loan, now, nil); err != nil {
+		t.Fatalf("Could not return loan: %v", err)
+	}
+	if again, err := CheckOut(domain.Loan{CopyId: copyId, MemberId: second, LoanedAt: now, DueAt: now}); err != nil || again == nil {
+		t.Errorf("Expected the copy to be lent to the next in line, got %v, %v", again, err)
+	}
+}
+
+func TestAccount(t *testing.T) {
+	books := addBooks(t, 1)
+	member := addMember(t, "Tenar")
+	now := time.Now().UTC().Truncate(time.Second)
+	loan, _ := CheckOut(domain.Loan{CopyId: addCopy(t, books[0], "book"), MemberId: member, LoanedAt: now, DueAt: now})
+	_, _ = ReturnLoan(*loan, now, &domain.Fine{LoanId: loan.Id, MemberId: member, Amount: 500, OverdueDays: 20, AssessedAt: now})
+
+	if payment, err := AddPayment(domain.Payment{MemberId: member, Kind: domain.PaymentPaid, Amount: 501, PaidAt: now}); err != nil || payment != nil {
+		t.Errorf("Expected a payment of more than is owed to be refused, got %v, %v", payment, err)
+	}
+	if payment, err := AddPayment(domain.Payment{MemberId: member, Kind: domain.PaymentPaid, Amount: 300, PaidAt: now}); err != nil || payment == nil || payment.Id == 0 {
+		t.Errorf("Expected the payment to be added, got %v, %v", payment, err)
+	}
+	if payment, _ := AddPayment(domain.Payment{MemberId: member, Kind: domain.PaymentWaived, Amount: 150, Note: "First offence", PaidAt: now}); payment == nil {
+		t.Errorf("Expected the waiver to be added")
+	}
+
+	account, err := GetAccount(member)
+	if err != nil || account.Balance != 50 || len(account.Fines) != 1 || len(account.Payments) != 2 || account.Payments[1].Note != "First offence" {
+		t.Errorf("Expected a balance of 50 after a payment and a waiver, got %+v, %v", account, err)
+	}
+	if empty, _ := GetAccount(addMember(t, "Ogion")); empty.Balance != 0 || len(empty.Fines) != 0 || empty.Payments == nil {
+		t.Errorf("Expected an empty account, got %+v", empty)
+	}
+}
+
+func TestDeleteBookKeepsLoans(t *testing.T) {
+	books := addBooks(t, 2)
+	addCopy(t, books[0], "book")
+	lentCopy := addCopy(t, books[1], "book")
+	now := time.Now().UTC().Truncate(time.Second)
+	loan, err := CheckOut(domain.Loan{CopyId: lentCopy, MemberId: addMember(t, "Ogion"), LoanedAt: now, DueAt: now})
+	if err != nil || loan == nil {
+		t.Fatalf("Could not lend copy: %v, %v", loan, err)
+	}
+	if _, err = ReturnLoan(*loan, now, nil); err != nil {
+		t.Fatalf("Could not return loan: %v", err)
+	}
+
+	if err = DeleteBook(strconv.FormatInt(books[1], 10)); err != ErrBookLent {
+		t.Errorf("Expected a book which was lent to be kept, got %v", err)
+	}
+	if current, _ := GetLoan(loan.Id); current == nil {
+		t.Errorf("Expected the loan to be kept")
+	}
+	if err = DeleteBook(strconv.FormatInt(books[0], 10)); err != nil {
+		t.Errorf("Expected a book which was never lent to be deleted with its copies, got %v", err)
+	}
+}
+
+func TestAddAndUpdateCopies(t *testing.T) {
+	books := addBooks(t, 1)
+	barcode := "COPY-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	copy, err := AddCopy(domain.Copy{BookId: books[0], Barcode: barcode, ItemType: "dvd"})
+	if err != nil || copy == nil || copy.Id == 0 || copy.Status != domain.CopyAvailable {
+		t.Fatalf("Expected an available copy to be added, got %v, %v", copy, err)
+	}
+	if again, err := AddCopy(domain.Copy{BookId: books[0], Barcode: barcode, ItemType: "book"}); err != nil || again != nil {
+		t.Errorf("Expected a copy with a barcode taken to be refused, got %v, %v", again, err)
+	}
+
+	other := addCopy(t, books[0], "book")
+	if updated, err := UpdateCopy(domain.Copy{Id: other, Barcode: barcode, ItemType: "book"}); err != nil || updated {
+		t.Errorf("Expected a copy not to take the barcode of another, got %v, %v", updated, err)
+	}
+	if updated, err := UpdateCopy(domain.Copy{Id: copy.Id, Barcode: barcode + "-R", ItemType: "reference"}); err != nil || !updated {
+		t.Errorf("Expected the copy to be updated, got %v, %v", updated, err)
+	}
+	if copies, _ := GetCopiesByIds([]int64{copy.Id}); len(copies) != 1 || copies[0].Barcode != barcode+"-R" || copies[0].ItemType != "reference" {
+		t.Errorf("Expected the barcode and the item type to be set, got %v", copies)
+	}
+}
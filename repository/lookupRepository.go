@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"time"
+)
+
+const (
+	isbnLookupColumns = "isbn13, found, title, author, publisher, year, pages, source, fetched_at"
+
+	deleteIsbnLookupsQuery = "DELETE FROM isbn_lookups WHERE fetched_at < ?"
+
+	getIsbnLookupQuery = "SELECT " + isbnLookupColumns + " FROM isbn_lookups WHERE isbn13=?"
+	setIsbnLookupQuery = `INSERT INTO isbn_lookups (` + isbnLookupColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+							ON CONFLICT (isbn13) DO UPDATE SET found=excluded.found, title=excluded.title,
+								author=excluded.author, publisher=excluded.publisher, year=excluded.year,
+								pages=excluded.pages, source=excluded.source, fetched_at=excluded.fetched_at`
+
+	// isbn_lookups caches the answers of the metadata provider, including the ISBNs it
+	// knew nothing of, by ISBN as normalised by validation.NormalizeIsbn.
+	createIsbnLookupsQuery = `CREATE TABLE IF NOT EXISTS isbn_lookups (
+								isbn13 TEXT PRIMARY KEY,
+								found INTEGER NOT NULL,
+								title TEXT NOT NULL DEFAULT '',
+								author TEXT NOT NULL DEFAULT '',
+								publisher TEXT NOT NULL DEFAULT '',
+								year INTEGER NOT NULL DEFAULT 0,
+								pages INTEGER NOT NULL DEFAULT 0,
+								source TEXT NOT NULL DEFAULT '',
+								fetched_at DATETIME NOT NULL);`
+)
+
+// GetIsbnLookup returns the cached lookup of an ISBN-13, nil when it was never looked up.
+func GetIsbnLookup(isbn string) (*domain.IsbnLookup, error) {
+	rows, err := database.Query(getIsbnLookupQuery, isbn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var lookup domain.IsbnLookup
+	var found bool
+	var details domain.BookDetails
+	if err = rows.Scan(&lookup.Isbn, &found, &details.Title, &details.Author, &details.Publisher, &details.Year,
+		&details.Pages, &details.Source, &lookup.FetchedAt); err != nil {
+		return nil, err
+	}
+	if found {
+		details.Isbn = lookup.Isbn
+		details.FetchedAt = lookup.FetchedAt
+		lookup.Details = &details
+	}
+	return &lookup, nil
+}
+
+// SetIsbnLookup caches a lookup, replacing the one of the same ISBN.
+func SetIsbnLookup(lookup domain.IsbnLookup) error {
+	details := domain.BookDetails{}
+	if lookup.Details != nil {
+		details = *lookup.Details
+	}
+	_, err := database.Exec(setIsbnLookupQuery, lookup.Isbn, lookup.Details != nil, details.Title, details.Author,
+		details.Publisher, details.Year, details.Pages, details.Source, lookup.FetchedAt.UTC())
+	return err
+}
+
+// DeleteIsbnLookups drops the lookups fetched before the given time, which are stale and
+// would be fetched again anyway, and returns how many there were.
+func DeleteIsbnLookups(fetchedBefore time.Time) (int64, error) {
+	return deleteRows(deleteIsbnLookupsQuery, fetchedBefore.UTC())
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSetIsbnLookupReplacesCachedLookup(t *testing.T) {
+	isbn := "979" + strconv.FormatInt(time.Now().UnixNano()%1e10, 10)
+	if lookup, err := GetIsbnLookup(isbn); err != nil || lookup != nil {
+		t.Fatalf("Expected no cached lookup, got %v, %v", lookup, err)
+	}
+
+	missed := domain.IsbnLookup{Isbn: isbn, FetchedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := SetIsbnLookup(missed); err != nil {
+		t.Fatalf("Could not cache lookup: %v", err)
+	}
+	if lookup, err := GetIsbnLookup(isbn); err != nil || lookup == nil || lookup.Details != nil || !lookup.FetchedAt.Equal(missed.FetchedAt) {
+		t.Fatalf("Expected a cached miss, got %v, %v", lookup, err)
+	}
+
+	found := domain.IsbnLookup{Isbn: isbn, FetchedAt: missed.FetchedAt.Add(time.Hour),
+		Details: &domain.BookDetails{Title: "A Wizard of Earthsea", Publisher: "Parnassus", Year: 1968, Pages: 205, Source: "file"}}
+	if err := SetIsbnLookup(found); err != nil {
+		t.Fatalf("Could not cache lookup: %v", err)
+	}
+	lookup, err := GetIsbnLookup(isbn)
+	if err != nil || lookup == nil || lookup.Details == nil {
+		t.Fatalf("Expected cached details, got %v, %v", lookup, err)
+	}
+	if details := *lookup.Details; details.Isbn != isbn || details.Year != 1968 || details.Pages != 205 || details.Source != "file" ||
+		!details.FetchedAt.Equal(found.FetchedAt) {
+		t.Errorf("Expected the details which were cached, got %+v", details)
+	}
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"database/sql"
+	"go-rest-webservices-book-library/domain"
+	"time"
+)
+
+const (
+	// Emails are compared regardless of case, so that members sign in however they type
+	// theirs.
+	registerMemberQuery = `INSERT INTO members (name, email, password_hash) SELECT ?, ?, ?
+							WHERE NOT EXISTS (SELECT 1 FROM members WHERE email = ? COLLATE NOCASE)`
+	getCredentialsQuery = "SELECT " + memberColumns + ", password_hash, verified_at FROM members WHERE email = ? COLLATE NOCASE"
+	getProfileQuery     = "SELECT " + memberColumns + ", verified_at FROM members WHERE id=?"
+	verifyEmailQuery    = "UPDATE members SET verified_at=COALESCE(verified_at, ?) WHERE id=?"
+	setPasswordQuery    = "UPDATE members SET password_hash=?, verified_at=COALESCE(verified_at, ?) WHERE id=?"
+
+	insertMemberTokenQuery   = "INSERT INTO member_tokens (hash, member_id, purpose, created_at, expires_at) VALUES (?, ?, ?, ?, ?)"
+	getTokenMemberQuery      = "SELECT member_id FROM member_tokens WHERE hash=? AND purpose=? AND expires_at > ?"
+	deleteMemberTokenQuery   = "DELETE FROM member_tokens WHERE hash=?"
+	deleteMemberTokensQuery  = "DELETE FROM member_tokens WHERE member_id=? AND purpose IN (?, ?)"
+	deleteExpiredTokensQuery = "DELETE FROM member_tokens WHERE expires_at <= ?"
+
+	placeHoldQuery = `INSERT INTO holds (book_id, member_id, placed_at) SELECT ?, ?, ?
+							WHERE NOT EXISTS (SELECT 1 FROM holds WHERE book_id=? AND member_id=?)`
+
+	createMemberTokensQuery = `ALTER TABLE members ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+								ALTER TABLE members ADD COLUMN verified_at DATETIME;
+								CREATE TABLE IF NOT EXISTS member_tokens (
+									hash TEXT PRIMARY KEY,
+									member_id INTEGER NOT NULL REFERENCES members(id),
+									purpose TEXT NOT NULL,
+									created_at DATETIME NOT NULL,
+									expires_at DATETIME NOT NULL);
+								CREATE INDEX IF NOT EXISTS member_tokens_member_id ON member_tokens (member_id);`
+)
+
+// RegisterMember adds a member who signs in with the password of passwordHash and returns
+// them, or nil when a member already has their email.
+func RegisterMember(member domain.Member, passwordHash string) (*domain.Member, error) {
+	result, err := database.Exec(registerMemberQuery, member.Name, member.Email, passwordHash, member.Email)
+	if err != nil || !changed(result) {
+		return nil, err
+	}
+	if member.Id, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetCredentials returns the credentials of the member with an email, nil when there is
+// no such member.
+func GetCredentials(email string) (*domain.Credentials, error) {
+	rows, err := database.Query(getCredentialsQuery, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var credentials domain.Credentials
+	var verifiedAt sql.NullTime
+	if err = rows.Scan(&credentials.Member.Id, &credentials.Member.Name, &credentials.Member.Email,
+		&credentials.PasswordHash, &verifiedAt); err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		credentials.VerifiedAt = &verifiedAt.Time
+	}
+	return &credentials, nil
+}
+
+// GetProfile returns a member as they see themselves, nil when there is no such member.
+func GetProfile(memberId int64) (*domain.Profile, error) {
+	rows, err := database.Query(getProfileQuery, memberId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var profile domain.Profile
+	var verifiedAt sql.NullTime
+	if err = rows.Scan(&profile.Id, &profile.Name, &profile.Email, &verifiedAt); err != nil {
+		return nil, err
+	}
+	profile.Verified = verifiedAt.Valid
+	return &profile, nil
+}
+
+func AddMemberToken(token domain.MemberToken) error {
+	_, err := database.Exec(insertMemberTokenQuery, token.Hash, token.MemberId, token.Purpose, token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	return err
+}
+
+// GetTokenMember returns the member a token of purpose was issued to, 0 when there is no
+// such token or it expired before now.
+func GetTokenMember(hash string, purpose string, now time.Time) (int64, error) {
+	return tokenMember(database, hash, purpose, now)
+}
+
+func DeleteMemberToken(hash string) error {
+	_, err := database.Exec(deleteMemberTokenQuery, hash)
+	return err
+}
+
+// VerifyEmail uses up a verification token and records the email of its member as
+// verified at now. It returns the member, 0 when the token is unknown or expired.
+func VerifyEmail(hash string, now time.Time) (int64, error) {
+	var memberId int64
+	err := InTransaction(func(uow *UnitOfWork) error {
+		var err error
+		if memberId, err = useToken(uow, hash, domain.TokenVerifyEmail, now); err != nil || memberId == 0 {
+			return err
+		}
+		_, err = uow.Exec(verifyEmailQuery, now.UTC(), memberId)
+		return err
+	})
+	return memberId, err
+}
+
+// ResetPassword uses up a password reset token to set the password of its member. The
+// email which received the token is verified, and every session of the member and other
+// reset token ended. It returns the member, 0 when the token is unknown or expired.
+func ResetPassword(hash string, passwordHash string, now time.Time) (int64, error) {
+	var memberId int64
+	err := InTransaction(func(uow *UnitOfWork) error {
+		var err error
+		if memberId, err = useToken(uow, hash, domain.TokenResetPassword, now); err != nil || memberId == 0 {
+			return err
+		}
+		if _, err = uow.Exec(setPasswordQuery, passwordHash, now.UTC(), memberId); err != nil {
+			return err
+		}
+		_, err = uow.Exec(deleteMemberTokensQuery, memberId, domain.TokenSession, domain.TokenResetPassword)
+		return err
+	})
+	return memberId, err
+}
+
+// DeleteExpiredMemberTokens forgets the tokens which expired by now and returns how many
+// there were.
+func DeleteExpiredMemberTokens(now time.Time) (int64, error) {
+	return deleteRows(deleteExpiredTokensQuery, now.UTC())
+}
+
+// PlaceHold places a hold and returns it, or nil when the member already holds the book.
+func PlaceHold(hold domain.Hold) (*domain.Hold, error) {
+	result, err := database.Exec(placeHoldQuery, hold.BookId, hold.MemberId, hold.PlacedAt.UTC(), hold.BookId, hold.MemberId)
+	if err != nil || !changed(result) {
+		return nil, err
+	}
+	if hold.Id, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func tokenMember(q querier, hash string, purpose string, now time.Time) (int64, error) {
+	rows, err := q.Query(getTokenMemberQuery, hash, purpose, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var memberId int64
+	if rows.Next() {
+		err = rows.Scan(&memberId)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return memberId, rows.Err()
+}
+
+// useToken returns the member of a token and deletes it, so that it is used once.
+func useToken(uow *UnitOfWork, hash string, purpose string, now time.Time) (int64, error) {
+	memberId, err := tokenMember(uow, hash, purpose, now)
+	if err != nil || memberId == 0 {
+		return 0, err
+	}
+	_, err = uow.Exec(deleteMemberTokenQuery, hash)
+	return memberId, err
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemberAccountLifecycle(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	email := "Tenar" + strconv.FormatInt(now.UnixNano(), 36) + "@atuan.example"
+
+	member, err := RegisterMember(domain.Member{Name: "Tenar", Email: email}, "first-hash")
+	if err != nil || member == nil || member.Id == 0 {
+		t.Fatalf("Expected the member to register, got %v: %v", member, err)
+	}
+	if again, err := RegisterMember(domain.Member{Name: "Arha", Email: strings.ToUpper(email)}, "other-hash"); err != nil || again != nil {
+		t.Fatalf("Expected an email to register once whatever its case, got %v: %v", again, err)
+	}
+
+	credentials, err := GetCredentials(strings.ToLower(email))
+	if err != nil || credentials == nil || credentials.Member.Id != member.Id || credentials.PasswordHash != "first-hash" || credentials.VerifiedAt != nil {
+		t.Fatalf("Expected the unverified credentials of the member, got %+v: %v", credentials, err)
+	}
+	if missing, err := GetCredentials("nobody@atuan.example"); err != nil || missing != nil {
+		t.Fatalf("Expected no credentials for an unknown email, got %+v: %v", missing, err)
+	}
+
+	tokens := []domain.MemberToken{
+		{Hash: "verify-" + email, MemberId: member.Id, Purpose: domain.TokenVerifyEmail, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Hash: "session-" + email, MemberId: member.Id, Purpose: domain.TokenSession, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Hash: "reset-" + email, MemberId: member.Id, Purpose: domain.TokenResetPassword, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Hash: "expired-" + email, MemberId: member.Id, Purpose: domain.TokenVerifyEmail, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+	}
+	for _, token := range tokens {
+		if err := AddMemberToken(token); err != nil {
+			t.Fatalf("Could not add token: %v", err)
+		}
+	}
+
+	scenarios := []struct {
+		name    string
+		hash    string
+		purpose string
+		member  int64
+	}{
+		{name: "should find a session", hash: "session-" + email, purpose: domain.TokenSession, member: member.Id},
+		{name: "should not find a token of another purpose", hash: "verify-" + email, purpose: domain.TokenSession},
+		{name: "should not find an expired token", hash: "expired-" + email, purpose: domain.TokenVerifyEmail},
+		{name: "should not find an unknown token", hash: "unknown-" + email, purpose: domain.TokenSession},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			memberId, err := GetTokenMember(s.hash, s.purpose, now)
+			if err != nil || memberId != s.member {
+				t.Errorf("Expected member %v, got %v: %v", s.member, memberId, err)
+			}
+		})
+	}
+
+	if verified, err := VerifyEmail("verify-"+email, now); err != nil || verified != member.Id {
+		t.Fatalf("Expected the email of the member to be verified, got %v: %v", verified, err)
+	}
+	if verified, err := VerifyEmail("verify-"+email, now); err != nil || verified != 0 {
+		t.Fatalf("Expected a verification token to be used once, got %v: %v", verified, err)
+	}
+	if profile, err := GetProfile(member.Id); err != nil || profile == nil || !profile.Verified || profile.Email != email {
+		t.Fatalf("Expected a verified profile, got %+v: %v", profile, err)
+	}
+
+	if reset, err := ResetPassword("reset-"+email, "second-hash", now); err != nil || reset != member.Id {
+		t.Fatalf("Expected the password to be reset, got %v: %v", reset, err)
+	}
+	if credentials, _ = GetCredentials(email); credentials.PasswordHash != "second-hash" {
+		t.Errorf("Expected the new password hash, got %v", credentials.PasswordHash)
+	}
+	if memberId, _ := GetTokenMember("session-"+email, domain.TokenSession, now); memberId != 0 {
+		t.Errorf("Expected resetting the password to end every session, got member %v", memberId)
+	}
+
+	if deleted, err := DeleteExpiredMemberTokens(now); err != nil || deleted < 1 {
+		t.Errorf("Expected the expired token to be deleted, got %v: %v", deleted, err)
+	}
+}
+
+func TestPlaceHoldOncePerMember(t *testing.T) {
+	books := addBooks(t, 1)
+	member := addMember(t, "Lebannen")
+	hold := domain.Hold{BookId: books[0], MemberId: member, PlacedAt: time.Now().UTC().Truncate(time.Second)}
+
+	placed, err := PlaceHold(hold)
+	if err != nil || placed == nil || placed.Id == 0 {
+		t.Fatalf("Expected the hold to be placed, got %+v: %v", placed, err)
+	}
+	if again, err := PlaceHold(hold); err != nil || again != nil {
+		t.Fatalf("Expected a member to hold a book once, got %+v: %v", again, err)
+	}
+}
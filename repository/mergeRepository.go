@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"fmt"
+	"go-rest-webservices-book-library/credits"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/events"
+	"go-rest-webservices-book-library/validation"
+	"time"
+)
+
+const (
+	moveCopiesQuery      = "UPDATE copies SET book_id=? WHERE book_id IN (%s)"
+	moveHoldsQuery       = "UPDATE holds SET book_id=? WHERE book_id IN (%s)"
+	retargetMergesQuery  = "UPDATE book_merges SET target_id=? WHERE target_id IN (%s)"
+	deleteBooksQuery     = "DELETE FROM books WHERE id IN (%s)"
+	updateIsbnQuery      = "UPDATE books SET isbn=?, isbn13=? WHERE id=?"
+	insertBookMergeQuery = "INSERT INTO book_merges (source_id, target_id, merged_at) VALUES (?, ?, ?)"
+	getMergedIntoQuery   = "SELECT target_id FROM book_merges WHERE source_id=?"
+
+	// A member holding several of the merged books keeps the earliest of the holds.
+	deleteDuplicateHoldsQuery = `DELETE FROM holds WHERE book_id=? AND EXISTS (
+									SELECT 1 FROM holds earlier WHERE earlier.book_id = holds.book_id
+										AND earlier.member_id = holds.member_id
+										AND (earlier.placed_at < holds.placed_at
+											OR (earlier.placed_at = holds.placed_at AND earlier.id < holds.id)))`
+
+	createBookMergesQuery = `CREATE TABLE IF NOT EXISTS book_merges (
+									source_id INTEGER PRIMARY KEY,
+									target_id INTEGER NOT NULL,
+									merged_at DATETIME NOT NULL);
+								CREATE INDEX IF NOT EXISTS book_merges_target_id ON book_merges (target_id);`
+)
+
+// MergeBooks folds the sources into target: their copies, and with them their loans,
+// their holds, their attachments and their digital loans move to target, which is tagged
+// with their subjects too, credits their authors after its own, takes their places in
+// series and collections it is not part of yet, and takes the ISBN of the first source
+// having one when it has none. The sources are then deleted and remembered as merged into target, so their ids
+// keep leading to it, and the event log records them as deleted and target as updated.
+// It returns nil, and merges nothing, unless target and every source exist.
+func MergeBooks(targetId int64, sourceIds []int64) (*domain.Book, error) {
+	var merged *domain.Book
+	err := InTransaction(func(uow *UnitOfWork) error {
+		ids := append([]int64{targetId}, sourceIds...)
+		rows, err := uow.Query(inQuery(getByIdsQuery, len(ids)), int64Args(ids)...)
+		if err != nil {
+			return err
+		}
+		books, err := scanBooks(rows)
+		if err != nil || len(books) != len(ids) {
+			return err
+		}
+
+		byId := map[int64]domain.Book{}
+		for _, book := range books {
+			byId[book.Id] = book
+		}
+		target := byId[targetId]
+		for _, sourceId := range sourceIds {
+			if target.Isbn == "" && byId[sourceId].Isbn != "" {
+				target.Isbn = byId[sourceId].Isbn
+				if _, err = uow.Exec(updateIsbnQuery, target.Isbn, validation.NormalizeIsbn(target.Isbn), targetId); err != nil {
+					return err
+				}
+			}
+		}
+
+		sources := int64Args(sourceIds)
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{inQuery(moveCopiesQuery, len(sourceIds)), append([]interface{}{targetId}, sources...)},
+			{inQuery(moveHoldsQuery, len(sourceIds)), append([]interface{}{targetId}, sources...)},
+			{deleteDuplicateHoldsQuery, []interface{}{targetId}},
+			{inQuery(mergeSubjectsQuery, len(sourceIds)), append([]interface{}{targetId}, sources...)},
+			{inQuery(moveAttachmentsQuery, len(sourceIds)), append([]interface{}{targetId}, sources...)},
+			{inQuery(moveDigitalLoansQuery, len(sourceIds)), append([]interface{}{targetId}, sources...)},
+			{inQuery(retargetMergesQuery, len(sourceIds)), append([]interface{}{targetId}, sources...)},
+			{inQuery(deleteBooksQuery, len(sourceIds)), sources},
+		}
+		if err = mergeCredits(uow, &target, sourceIds); err != nil {
+			return err
+		}
+		if err = mergeEntries(uow, targetId, sourceIds); err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			if _, err = uow.Exec(statement.query, statement.args...); err != nil {
+				return err
+			}
+		}
+
+		mergedAt := time.Now().UTC()
+		for _, sourceId := range sourceIds {
+			if _, err = uow.Exec(insertBookMergeQuery, sourceId, targetId, mergedAt); err != nil {
+				return err
+			}
+			if err = uow.Record(events.BookDeleted, domain.Book{Id: sourceId}); err != nil {
+				return err
+			}
+		}
+		if err = uow.Record(events.BookUpdated, target); err != nil {
+			return err
+		}
+		merged = &target
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// mergeCredits adds the credits of the sources which target lacks after its own, in the
+// order of the sources, and sets the author of target to the credits when it gains any.
+func mergeCredits(uow *UnitOfWork, target *domain.Book, sourceIds []int64) error {
+	list, err := queryCredits(uow, target.Id)
+	if err != nil {
+		return err
+	}
+	type credited struct {
+		authorId int64
+		role     string
+	}
+	seen := map[credited]bool{}
+	for _, credit := range list {
+		seen[credited{credit.AuthorId, credit.Role}] = true
+	}
+	count := len(list)
+	for _, sourceId := range sourceIds {
+		sourceCredits, err := queryCredits(uow, sourceId)
+		if err != nil {
+			return err
+		}
+		for _, credit := range sourceCredits {
+			if seen[credited{credit.AuthorId, credit.Role}] {
+				continue
+			}
+			seen[credited{credit.AuthorId, credit.Role}] = true
+			credit.Position = len(list) + 1
+			list = append(list, credit)
+		}
+	}
+	if len(list) == count {
+		return nil
+	}
+
+	if err = insertCredits(uow, target.Id, list); err != nil {
+		return err
+	}
+	target.Author = credits.Format(list)
+	_, err = uow.Exec(updateBookAuthorQuery, target.Author, target.Id)
+	return err
+}
+
+// mergeEntries puts target in the places of the sources in series and collections. Where
+// target already is part of the group, or of another series, the places of the sources
+// are given up and the gaps they leave closed.
+func mergeEntries(uow *UnitOfWork, targetId int64, sourceIds []int64) error {
+	sources := int64Args(sourceIds)
+	for _, t := range entryTables {
+		groupIds, err := queryIds(uow, inQuery(fmt.Sprintf(getGroupsOfAnyQuery, t.table, t.column, "%s"), len(sourceIds)), sources...)
+		if err != nil {
+			return err
+		}
+		if _, err = uow.Exec(inQuery(fmt.Sprintf(moveEntriesQuery, t.table, "%s"), len(sourceIds)), append([]interface{}{targetId}, sources...)...); err != nil {
+			return err
+		}
+		if _, err = uow.Exec(inQuery(fmt.Sprintf(deleteBookEntriesQuery, t.table, "%s"), len(sourceIds)), sources...); err != nil {
+			return err
+		}
+		for _, groupId := range groupIds {
+			if err = renumber(uow, t, groupId); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetMergedInto returns the id of the book which the book with id was merged into, or 0
+// when it was not merged.
+func GetMergedInto(id string) (int64, error) {
+	rows, err := database.Query(getMergedIntoQuery, id)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var targetId int64
+	if rows.Next() {
+		err = rows.Scan(&targetId)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	return targetId, err
+}
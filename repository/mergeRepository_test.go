@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/credits"
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMergeBooksMovesCopiesAndHolds(t *testing.T) {
+	targetId, _ := AddBook(domain.Book{Name: "The Hobbit", Author: "J. R. R. Tolkien"})
+	sourceId, _ := AddBook(domain.Book{Name: "Hobbit, The", Author: "Tolkien, J. R. R.; Christopher Tolkien (ed.)", Isbn: "0-261-10221-4"})
+	suffix := strconv.FormatInt(sourceId, 10)
+
+	member, err := database.Exec("INSERT INTO members (name, email) VALUES (?, ?)", "Bilbo", "bilbo"+suffix+"@shire.example")
+	if err != nil {
+		t.Fatalf("Expected member to be added, got %v", err)
+	}
+	memberId, _ := member.LastInsertId()
+	placedAt := time.Now().UTC()
+	for _, statement := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT INTO copies (book_id, barcode) VALUES (?, ?)", []interface{}{sourceId, "MERGE-" + suffix}},
+		{"INSERT INTO holds (book_id, member_id, placed_at) VALUES (?, ?, ?)", []interface{}{targetId, memberId, placedAt}},
+		{"INSERT INTO holds (book_id, member_id, placed_at) VALUES (?, ?, ?)", []interface{}{sourceId, memberId, placedAt.Add(time.Hour)}},
+	} {
+		if _, err = database.Exec(statement.query, statement.args...); err != nil {
+			t.Fatalf("Expected %v to succeed, got %v", statement.query, err)
+		}
+	}
+
+	merged, err := MergeBooks(targetId, []int64{sourceId})
+	if err != nil || merged == nil {
+		t.Fatalf("Expected books to be merged, got %v, %v", merged, err)
+	}
+	if merged.Isbn != "0-261-10221-4" {
+		t.Errorf("Expected target to take the ISBN of the source, got %v", merged.Isbn)
+	}
+	credited, _ := GetCredits(targetId)
+	if len(credited) != 2 || credited[1].Role != domain.RoleEditor || credited[1].Position != 2 {
+		t.Errorf("Expected the target to gain the editor of the source once, got %v", credited)
+	}
+	if merged.Author != credits.Format(credited) {
+		t.Errorf("Expected the author of the target to follow its credits, got %v", merged.Author)
+	}
+	if books, _ := GetBook(suffix); len(books) != 0 {
+		t.Errorf("Expected source to be deleted, got %v", books)
+	}
+	if copies, _ := GetCopiesByBookIds([]int64{targetId}); len(copies) != 1 || copies[0].Barcode != "MERGE-"+suffix {
+		t.Errorf("Expected the copy to move to the target, got %v", copies)
+	}
+	if holds, _ := GetHoldsByBookIds([]int64{targetId}); len(holds) != 1 || !holds[0].PlacedAt.Equal(placedAt) {
+		t.Errorf("Expected the member to keep only the earliest hold, got %v", holds)
+	}
+	if mergedInto, _ := GetMergedInto(suffix); mergedInto != targetId {
+		t.Errorf("Expected source to lead to %v, got %v", targetId, mergedInto)
+	}
+}
+
+func TestMergeBooksRequiresExistingBooks(t *testing.T) {
+	targetId, _ := AddBook(domain.Book{Name: "Target", Author: "Author"})
+
+	merged, err := MergeBooks(targetId, []int64{-1})
+	if err != nil || merged != nil {
+		t.Errorf("Expected nothing to be merged, got %v, %v", merged, err)
+	}
+	if books, _ := GetBook(strconv.FormatInt(targetId, 10)); len(books) != 1 {
+		t.Errorf("Expected target to be kept, got %v", books)
+	}
+}
+
+func TestMergeBooksKeepsSeriesAndCollections(t *testing.T) {
+	books := addBooks(t, 4)
+	targetId, sourceIds := books[0], books[1:3]
+	series, _ := AddSeries(domain.Series{Name: "Earthsea"})
+	display, _ := AddCollection(domain.Collection{Name: "Display", Kind: domain.KindCollection})
+	shelf, _ := AddCollection(domain.Collection{Name: "B2", Kind: domain.KindShelf})
+	_, _ = SetEntries(domain.GroupSeries, series, []int64{sourceIds[0], books[3]})
+	_, _ = SetEntries(domain.GroupCollections, display, []int64{targetId, sourceIds[1], books[3]})
+	_, _ = SetEntries(domain.GroupCollections, shelf, []int64{books[3], sourceIds[1]})
+
+	if merged, err := MergeBooks(targetId, sourceIds); err != nil || merged == nil {
+		t.Fatalf("Expected books to be merged, got %v, %v", merged, err)
+	}
+	if ids := entryIds(t, domain.GroupSeries, series); !sameIds(ids, []int64{targetId, books[3]}) {
+		t.Errorf("Expected target to take the place of the source in the series, got %v", ids)
+	}
+	if ids := entryIds(t, domain.GroupCollections, display); !sameIds(ids, []int64{targetId, books[3]}) {
+		t.Errorf("Expected target to be in the collection once, got %v", ids)
+	}
+	if ids := entryIds(t, domain.GroupCollections, shelf); !sameIds(ids, []int64{books[3], targetId}) {
+		t.Errorf("Expected target to take the place of the source on the shelf, got %v", ids)
+	}
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"time"
+)
+
+type migration struct {
+	version     int
+	description string
+	statements  string
+	// apply, when set, runs after the statements in the same transaction, for data
+	// migrations which need more than SQL.
+	apply func(q querier) error
+}
+
+const (
+	createMigrationsTableQuery = `CREATE TABLE IF NOT EXISTS schema_migrations (
+									version INTEGER PRIMARY KEY,
+									description TEXT,
+									applied_at TEXT);`
+	getAppliedMigrationsQuery = "SELECT version FROM schema_migrations"
+	insertMigrationQuery      = "INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)"
+	backupQuery               = "VACUUM INTO ?"
+)
+
+// migrations are applied in order and must never be edited once released, add a new
+// version instead.
+var migrations = []migration{
+	{version: 1, description: "create books table", statements: initializeDatabaseQuery},
+	{version: 2, description: "create circulation tables", statements: createCirculationTablesQuery},
+	{version: 3, description: "create book event log", statements: createEventLogQuery},
+	{version: 4, description: "create webhook tables", statements: createWebhookTablesQuery},
+	{version: 5, description: "create idempotency keys table", statements: createIdempotencyKeysQuery},
+	{version: 6, description: "add isbn to books", statements: addIsbnQuery},
+	{version: 7, description: "create book merges table", statements: createBookMergesQuery},
+	{version: 8, description: "create authors tables and credit existing books", statements: createAuthorsQuery, apply: creditExistingBooks},
+	{version: 9, description: "create series and collections tables", statements: createGroupsQuery},
+	{version: 10, description: "create subjects tables", statements: createSubjectsQuery},
+	{version: 11, description: "create book covers table", statements: createCoversQuery},
+	{version: 12, description: "create attachments and digital loans tables", statements: createAttachmentsQuery},
+	{version: 13, description: "add publisher, year and pages to books", statements: addPublicationQuery},
+	{version: 14, description: "create isbn lookups table", statements: createIsbnLookupsQuery},
+	{version: 15, description: "add item types and renewals, create fines and payments tables", statements: createFinesQuery},
+	{version: 16, description: "create job locks and runs tables", statements: createJobsQuery},
+	{version: 17, description: "create notification preferences and notifications tables", statements: createNotificationsQuery},
+	{version: 18, description: "add passwords to members, create member tokens table", statements: createMemberTokensQuery},
+	{version: 19, description: "keep the whole book in the book event log", statements: addEventBookQuery},
+	{version: 20, description: "keep the links of idempotent responses", statements: addIdempotentLinksQuery},
+	{version: 21, description: "delete the holds members collected", statements: deleteCollectedHoldsQuery},
+}
+
+// Migrate applies every migration which is missing from the database, each one in its
+// own transaction, and returns the versions it applied.
+func Migrate() ([]int, error) {
+	if _, err := database.Exec(createMigrationsTableQuery); err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		tx, err := database.Begin()
+		if err != nil {
+			return versions, err
+		}
+		_, err = tx.Exec(m.statements)
+		if err == nil && m.apply != nil {
+			err = m.apply(tx)
+		}
+		if err == nil {
+			_, err = tx.Exec(insertMigrationQuery, m.version, m.description, time.Now().UTC().Format(time.RFC3339))
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return versions, err
+		}
+		if err = tx.Commit(); err != nil {
+			return versions, err
+		}
+
+		logger.Info("Applied database migration: " + m.description)
+		versions = append(versions, m.version)
+	}
+
+	return versions, nil
+}
+
+// Backup writes a consistent copy of the database to path, which must not exist yet.
+func Backup(path string) error {
+	_, err := database.Exec(backupQuery, path)
+	return err
+}
+
+func appliedMigrations() (map[int]bool, error) {
+	rows, err := database.Query(getAppliedMigrationsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
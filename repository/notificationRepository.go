@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"go-rest-webservices-book-library/domain"
+	"time"
+)
+
+const (
+	notificationColumns = "id, member_id, event, reference, email, subject, sent_at"
+	noticeColumns       = "m.id, m.name, m.email, b.id, b.name, b.author"
+
+	getPreferencesQuery = `SELECT COALESCE(due_soon, 1), COALESCE(overdue, 1), COALESCE(hold_ready, 1)
+							FROM members m LEFT JOIN notification_preferences p ON p.member_id = m.id WHERE m.id=?`
+	setPreferencesQuery = `INSERT INTO notification_preferences (member_id, due_soon, overdue, hold_ready) VALUES (?, ?, ?, ?)
+							ON CONFLICT (member_id) DO UPDATE SET due_soon=excluded.due_soon, overdue=excluded.overdue,
+								hold_ready=excluded.hold_ready`
+	insertNotificationQuery = "INSERT OR IGNORE INTO notifications (member_id, event, reference, email, subject, sent_at) VALUES (?, ?, ?, ?, ?, ?)"
+	deleteNotificationQuery = "DELETE FROM notifications WHERE id=?"
+	getNotificationsQuery   = "SELECT " + notificationColumns + " FROM notifications WHERE member_id=? ORDER BY sent_at DESC, id DESC LIMIT ? OFFSET ?"
+
+	// The notices of members who opted out of an event, or were already told, are left out.
+	// A renewed loan is another reference, its new due date is worth another reminder.
+	getLoanNoticesQuery = `SELECT 'loan:' || l.id || ':' || l.renewals, l.due_at, ` + noticeColumns + `
+							FROM loans l JOIN copies c ON c.id = l.copy_id JOIN books b ON b.id = c.book_id
+								JOIN members m ON m.id = l.member_id
+								LEFT JOIN notification_preferences p ON p.member_id = m.id
+							WHERE l.returned_at IS NULL AND l.due_at > ? AND l.due_at <= ? AND COALESCE(p.%s, 1) = 1
+								AND NOT EXISTS (SELECT 1 FROM notifications n WHERE n.member_id = m.id AND n.event = ?
+									AND n.reference = 'loan:' || l.id || ':' || l.renewals)
+							ORDER BY l.due_at, l.id`
+	// A hold is ready when fewer members placed a hold on the book before it than there are
+	// copies of the book available.
+	getHoldNoticesQuery = `SELECT 'hold:' || h.id, NULL, ` + noticeColumns + `
+							FROM holds h JOIN books b ON b.id = h.book_id JOIN members m ON m.id = h.member_id
+								LEFT JOIN notification_preferences p ON p.member_id = m.id
+							WHERE COALESCE(p.hold_ready, 1) = 1
+								AND (SELECT COUNT(*) FROM holds e WHERE e.book_id = h.book_id
+									AND (e.placed_at < h.placed_at OR (e.placed_at = h.placed_at AND e.id < h.id)))
+									< (SELECT COUNT(*) FROM copies c WHERE c.book_id = h.book_id AND c.status = '` + domain.CopyAvailable + `')
+								AND NOT EXISTS (SELECT 1 FROM notifications n WHERE n.member_id = m.id AND n.event = ?
+									AND n.reference = 'hold:' || h.id)
+							ORDER BY h.placed_at, h.id`
+
+	createNotificationsQuery = `CREATE TABLE IF NOT EXISTS notification_preferences (
+									member_id INTEGER PRIMARY KEY REFERENCES members(id),
+									due_soon INTEGER NOT NULL DEFAULT 1,
+									overdue INTEGER NOT NULL DEFAULT 1,
+									hold_ready INTEGER NOT NULL DEFAULT 1);
+								CREATE TABLE IF NOT EXISTS notifications (
+									id INTEGER PRIMARY KEY,
+									member_id INTEGER NOT NULL REFERENCES members(id),
+									event TEXT NOT NULL,
+									reference TEXT NOT NULL,
+									email TEXT NOT NULL,
+									subject TEXT NOT NULL,
+									sent_at DATETIME NOT NULL,
+									UNIQUE (member_id, event, reference));`
+)
+
+// preferenceColumns holds the column of notification_preferences of each loan event.
+var preferenceColumns = map[string]string{
+	domain.NotificationDueSoon: "due_soon",
+	domain.NotificationOverdue: "overdue",
+}
+
+// GetNotificationPreferences returns the preferences of a member, nil when there is no
+// such member.
+func GetNotificationPreferences(memberId int64) (*domain.NotificationPreferences, error) {
+	rows, err := database.Query(getPreferencesQuery, memberId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	preferences := domain.NotificationPreferences{MemberId: memberId}
+	if err = rows.Scan(&preferences.DueSoon, &preferences.Overdue, &preferences.HoldReady); err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+func SetNotificationPreferences(preferences domain.NotificationPreferences) error {
+	_, err := database.Exec(setPreferencesQuery, preferences.MemberId, preferences.DueSoon, preferences.Overdue, preferences.HoldReady)
+	return err
+}
+
+// GetLoanNotices returns the notices of event, due soon or overdue, for the loans still
+// out which are due after dueAfter and no later than dueBy.
+func GetLoanNotices(event string, dueAfter time.Time, dueBy time.Time) ([]domain.Notice, error) {
+	column, found := preferenceColumns[event]
+	if !found {
+		return nil, fmt.Errorf("unknown loan event: %s", event)
+	}
+	return queryNotices(event, fmt.Sprintf(getLoanNoticesQuery, column), dueAfter.UTC(), dueBy.UTC(), event)
+}
+
+// GetHoldNotices returns the notices of holds the members who placed them can collect.
+func GetHoldNotices() ([]domain.Notice, error) {
+	return queryNotices(domain.NotificationHoldReady, getHoldNoticesQuery, domain.NotificationHoldReady)
+}
+
+// ClaimNotification records a notification as sent and returns it, or nil when it was
+// already sent. Claiming it before sending it keeps server instances sharing the database
+// from sending it twice, ReleaseNotification forgets it should sending it fail.
+func ClaimNotification(notification domain.Notification) (*domain.Notification, error) {
+	result, err := database.Exec(insertNotificationQuery, notification.MemberId, notification.Event, notification.Reference,
+		notification.Email, notification.Subject, notification.SentAt.UTC())
+	if err != nil || !changed(result) {
+		return nil, err
+	}
+	if notification.Id, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+func ReleaseNotification(id int64) error {
+	_, err := database.Exec(deleteNotificationQuery, id)
+	return err
+}
+
+// GetNotifications pages through the notifications sent to a member, latest first.
+func GetNotifications(memberId int64, limit int64, offset int64) ([]domain.Notification, error) {
+	rows, err := database.Query(getNotificationsQuery, memberId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []domain.Notification{}
+	for rows.Next() {
+		var notification domain.Notification
+		if err = rows.Scan(&notification.Id, &notification.MemberId, &notification.Event, &notification.Reference,
+			&notification.Email, &notification.Subject, &notification.SentAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func queryNotices(event string, query string, args ...interface{}) ([]domain.Notice, error) {
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notices := []domain.Notice{}
+	for rows.Next() {
+		notice := domain.Notice{Event: event}
+		var dueAt sql.NullTime
+		if err = rows.Scan(&notice.Reference, &dueAt, &notice.Member.Id, &notice.Member.Name, &notice.Member.Email,
+			&notice.Book.Id, &notice.Book.Name, &notice.Book.Author); err != nil {
+			return nil, err
+		}
+		notice.DueAt = dueAt.Time
+		notices = append(notices, notice)
+	}
+	return notices, rows.Err()
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"testing"
+	"time"
+)
+
+// noticesOf keeps the notices of the given members, as notices of other tests stay in the
+// test database.
+func noticesOf(t *testing.T, notices []domain.Notice, err error, members ...int64) []domain.Notice {
+	if err != nil {
+		t.Fatalf("Could not get notices: %v", err)
+	}
+	var kept []domain.Notice
+	for _, notice := range notices {
+		for _, member := range members {
+			if notice.Member.Id == member {
+				kept = append(kept, notice)
+			}
+		}
+	}
+	return kept
+}
+
+func TestNoticesAreSentOnceUnlessMembersOptOut(t *testing.T) {
+	books := addBooks(t, 2)
+	ged, arha := addMember(t, "Ged"), addMember(t, "Arha")
+	now := time.Now().UTC().Truncate(time.Second)
+	dueSoon, _ := CheckOut(domain.Loan{CopyId: addCopy(t, books[0], "book"), MemberId: ged, LoanedAt: now, DueAt: now.Add(24 * time.Hour)})
+	_, _ = CheckOut(domain.Loan{CopyId: addCopy(t, books[0], "book"), MemberId: arha, LoanedAt: now, DueAt: now.Add(-48 * time.Hour)})
+	addCopy(t, books[1], "book")
+	for _, hold := range []struct {
+		member   int64
+		placedAt time.Time
+	}{{arha, now.Add(-time.Hour)}, {ged, now}} {
+		if _, err := database.Exec("INSERT INTO holds (book_id, member_id, placed_at) VALUES (?, ?, ?)", books[1], hold.member, hold.placedAt); err != nil {
+			t.Fatalf("Could not place hold: %v", err)
+		}
+	}
+
+	notices, err := GetLoanNotices(domain.NotificationDueSoon, now, now.Add(48*time.Hour))
+	dueSoonNotices := noticesOf(t, notices, err, ged, arha)
+	if len(dueSoonNotices) != 1 || dueSoonNotices[0].Member.Id != ged || !dueSoonNotices[0].DueAt.Equal(dueSoon.DueAt) || dueSoonNotices[0].Book.Id != books[0] {
+		t.Fatalf("Expected the loan due soon, got %+v", dueSoonNotices)
+	}
+	notices, err = GetLoanNotices(domain.NotificationOverdue, time.Time{}, now)
+	if overdue := noticesOf(t, notices, err, ged, arha); len(overdue) != 1 || overdue[0].Member.Id != arha {
+		t.Errorf("Expected the overdue loan, got %+v", overdue)
+	}
+	notices, err = GetHoldNotices()
+	if ready := noticesOf(t, notices, err, ged, arha); len(ready) != 1 || ready[0].Member.Id != arha || ready[0].Book.Id != books[1] {
+		t.Errorf("Expected the first hold to be ready, got %+v", ready)
+	}
+
+	notification := domain.Notification{MemberId: ged, Event: domain.NotificationDueSoon, Reference: dueSoonNotices[0].Reference,
+		Email: dueSoonNotices[0].Member.Email, Subject: "Due soon", SentAt: now}
+	claimed, err := ClaimNotification(notification)
+	if err != nil || claimed == nil || claimed.Id == 0 {
+		t.Fatalf("Expected the notification to be claimed, got %v, %v", claimed, err)
+	}
+	if again, _ := ClaimNotification(notification); again != nil {
+		t.Errorf("Expected a notification to be claimed once, got %v", again)
+	}
+	notices, err = GetLoanNotices(domain.NotificationDueSoon, now, now.Add(48*time.Hour))
+	if sent := noticesOf(t, notices, err, ged); len(sent) != 0 {
+		t.Errorf("Expected no notice once sent, got %+v", sent)
+	}
+	if sent, _ := GetNotifications(ged, 10, 0); len(sent) != 1 || sent[0].Subject != "Due soon" {
+		t.Errorf("Expected the notification to be listed, got %+v", sent)
+	}
+	if err = ReleaseNotification(claimed.Id); err != nil {
+		t.Fatalf("Could not release notification: %v", err)
+	}
+	if claimed, _ = ClaimNotification(notification); claimed == nil {
+		t.Errorf("Expected a released notification to be claimed again")
+	}
+
+	if err = SetNotificationPreferences(domain.NotificationPreferences{MemberId: arha, DueSoon: true}); err != nil {
+		t.Fatalf("Could not set preferences: %v", err)
+	}
+	if preferences, _ := GetNotificationPreferences(arha); preferences == nil || !preferences.DueSoon || preferences.Overdue || preferences.HoldReady {
+		t.Errorf("Expected the preferences to be set, got %+v", preferences)
+	}
+	if preferences, _ := GetNotificationPreferences(ged); preferences == nil || !preferences.DueSoon || !preferences.Overdue || !preferences.HoldReady {
+		t.Errorf("Expected every notification by default, got %+v", preferences)
+	}
+	if preferences, err := GetNotificationPreferences(-1); err != nil || preferences != nil {
+		t.Errorf("Expected no preferences for a missing member, got %+v, %v", preferences, err)
+	}
+	notices, err = GetLoanNotices(domain.NotificationOverdue, time.Time{}, now)
+	if overdue := noticesOf(t, notices, err, arha); len(overdue) != 0 {
+		t.Errorf("Expected no notice to a member who opted out, got %+v", overdue)
+	}
+}
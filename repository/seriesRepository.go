@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"fmt"
+	"go-rest-webservices-book-library/domain"
+)
+
+const (
+	seriesColumns          = "id, name"
+	getSeriesQuery         = "SELECT " + seriesColumns + " FROM series WHERE id=?"
+	findSeriesQuery        = "SELECT " + seriesColumns + " FROM series WHERE name LIKE ? ORDER BY name, id LIMIT ? OFFSET ?"
+	insertSeriesQuery      = "INSERT INTO series (name) VALUES (?)"
+	updateSeriesQuery      = "UPDATE series SET name=? WHERE id=?"
+	deleteSeriesQuery      = "DELETE FROM series WHERE id=?"
+	getBookSeriesQuery     = "SELECT series_id, position FROM series_books WHERE book_id=?"
+	getPreviousVolumeQuery = "SELECT " + bookColumns + " FROM books WHERE id = (SELECT book_id FROM series_books WHERE series_id=? AND position<? ORDER BY position DESC LIMIT 1)"
+	getNextVolumeQuery     = "SELECT " + bookColumns + " FROM books WHERE id = (SELECT book_id FROM series_books WHERE series_id=? AND position>? ORDER BY position LIMIT 1)"
+
+	// The entries of a group are kept in a table of their own, which these queries are
+	// formatted with along with the column of the group id.
+	getEntriesQuery        = "SELECT entries.position, " + entryBookColumns + " FROM %s entries JOIN books ON books.id = entries.book_id WHERE entries.%s=? ORDER BY entries.position LIMIT ? OFFSET ?"
+	getEntryIdsQuery       = "SELECT book_id FROM %s WHERE %s=? ORDER BY position"
+	countEntriesQuery      = "SELECT COUNT(*) FROM %s WHERE %s=?"
+	getGroupsOfQuery       = "SELECT %[2]s FROM %[1]s WHERE book_id=?"
+	getGroupsOfAnyQuery    = "SELECT DISTINCT %[2]s FROM %[1]s WHERE book_id IN (%[3]s)"
+	insertEntryQuery       = "INSERT INTO %s (%s, book_id, position) VALUES (?, ?, ?)"
+	updatePositionQuery    = "UPDATE %s SET position=? WHERE %s=? AND book_id=?"
+	shiftEntriesQuery      = "UPDATE %s SET position = position + 1 WHERE %s=? AND position>=?"
+	deleteEntryQuery       = "DELETE FROM %s WHERE %s=? AND book_id=?"
+	deleteEntriesQuery     = "DELETE FROM %s WHERE %s=?"
+	moveEntriesQuery       = "UPDATE OR IGNORE %s SET book_id=? WHERE book_id IN (%s)"
+	deleteBookEntriesQuery = "DELETE FROM %s WHERE book_id IN (%s)"
+	entryBookColumns       = "books.id, books.name, books.author, books.isbn, books.publisher, books.year, books.pages"
+
+	// A book is in one series at most, so series_books is keyed by book alone.
+	createGroupsQuery = `CREATE TABLE IF NOT EXISTS series (
+									id INTEGER PRIMARY KEY,
+									name TEXT NOT NULL);
+								CREATE TABLE IF NOT EXISTS series_books (
+									book_id INTEGER PRIMARY KEY REFERENCES books(id) ON DELETE CASCADE,
+									series_id INTEGER NOT NULL REFERENCES series(id) ON DELETE CASCADE,
+									position INTEGER NOT NULL);
+								CREATE INDEX IF NOT EXISTS series_books_series_id ON series_books (series_id, position);
+								CREATE TABLE IF NOT EXISTS collections (
+									id INTEGER PRIMARY KEY,
+									name TEXT NOT NULL,
+									kind TEXT NOT NULL,
+									description TEXT NOT NULL DEFAULT '');
+								CREATE TABLE IF NOT EXISTS collection_books (
+									collection_id INTEGER NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+									book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+									position INTEGER NOT NULL,
+									PRIMARY KEY (collection_id, book_id));
+								CREATE INDEX IF NOT EXISTS collection_books_book_id ON collection_books (book_id);`
+)
+
+// entryTable is where the entries of a group of books are kept.
+type entryTable struct {
+	table  string
+	column string
+	// exclusive groups hold a book in one group at most.
+	exclusive bool
+}
+
+var entryTables = map[string]entryTable{
+	domain.GroupSeries:      {table: "series_books", column: "series_id", exclusive: true},
+	domain.GroupCollections: {table: "collection_books", column: "collection_id"},
+}
+
+func GetSeries(id int64) (*domain.Series, error) {
+	series, err := querySeries(database, getSeriesQuery, id)
+	if err != nil || len(series) == 0 {
+		return nil, err
+	}
+	return &series[0], nil
+}
+
+// FindSeries pages through the series whose name contains name, by name.
+func FindSeries(name string, limit int64, offset int64) ([]domain.Series, error) {
+	return querySeries(database, findSeriesQuery, "%"+name+"%", limit, offset)
+}
+
+func AddSeries(series domain.Series) (int64, error) {
+	result, err := database.Exec(insertSeriesQuery, series.Name)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func UpdateSeries(series domain.Series) error {
+	_, err := database.Exec(updateSeriesQuery, series.Name, series.Id)
+	return err
+}
+
+// DeleteSeries deletes a series, the books in it are kept.
+func DeleteSeries(id int64) error {
+	_, err := database.Exec(deleteSeriesQuery, id)
+	return err
+}
+
+// GetSeriesPosition returns the series of a book, its position in it and the volumes
+// around it, or nil when the book is not part of a series.
+func GetSeriesPosition(bookId int64) (*domain.SeriesPosition, error) {
+	rows, err := database.Query(getBookSeriesQuery, bookId)
+	if err != nil {
+		return nil, err
+	}
+	var seriesId int64
+	position := domain.SeriesPosition{}
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&seriesId, &position.Position)
+	}
+	rows.Close()
+	if err != nil || !found {
+		return nil, err
+	}
+
+	series, err := GetSeries(seriesId)
+	if err != nil || series == nil {
+		return nil, err
+	}
+	position.Series = *series
+	if position.Previous, err = queryVolume(getPreviousVolumeQuery, seriesId, position.Position); err != nil {
+		return nil, err
+	}
+	if position.Next, err = queryVolume(getNextVolumeQuery, seriesId, position.Position); err != nil {
+		return nil, err
+	}
+	return &position, nil
+}
+
+// GetEntries pages through the books of a series or a collection, in order.
+func GetEntries(group string, groupId int64, limit int64, offset int64) ([]domain.Entry, error) {
+	t := entryTables[group]
+	rows, err := database.Query(fmt.Sprintf(getEntriesQuery, t.table, t.column), groupId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []domain.Entry{}
+	for rows.Next() {
+		var entry domain.Entry
+		if err = rows.Scan(append([]interface{}{&entry.Position}, bookFields(&entry.Book)...)...); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// SetEntries replaces the books of a series or a collection by bookIds, in that order.
+// Books taken from another series leave it. It returns false, and changes nothing, unless
+// every book exists.
+func SetEntries(group string, groupId int64, bookIds []int64) (bool, error) {
+	t := entryTables[group]
+	var set bool
+	err := InTransaction(func(uow *UnitOfWork) error {
+		if found, err := booksExist(uow, bookIds); err != nil || !found {
+			return err
+		}
+
+		if _, err := uow.Exec(fmt.Sprintf(deleteEntriesQuery, t.table, t.column), groupId); err != nil {
+			return err
+		}
+		for i, bookId := range bookIds {
+			if err := leaveGroups(uow, t, groupId, bookId); err != nil {
+				return err
+			}
+			if _, err := uow.Exec(fmt.Sprintf(insertEntryQuery, t.table, t.column), groupId, bookId, i+1); err != nil {
+				return err
+			}
+		}
+		set = true
+		return nil
+	})
+	return set, err
+}
+
+// AddEntry puts a book at position in a series or a collection, moving the books from
+// there on one down, or at the end when position is 0 or past it. A book which already is
+// part of the group moves, and one taken from another series leaves it. It returns false
+// when the book does not exist.
+func AddEntry(group string, groupId int64, bookId int64, position int) (bool, error) {
+	t := entryTables[group]
+	var added bool
+	err := InTransaction(func(uow *UnitOfWork) error {
+		if found, err := booksExist(uow, []int64{bookId}); err != nil || !found {
+			return err
+		}
+		if err := leaveGroups(uow, t, groupId, bookId); err != nil {
+			return err
+		}
+
+		count, err := queryIds(uow, fmt.Sprintf(countEntriesQuery, t.table, t.column), groupId)
+		if err != nil {
+			return err
+		}
+		if position == 0 || int64(position) > count[0] {
+			position = int(count[0]) + 1
+		}
+		if _, err = uow.Exec(fmt.Sprintf(shiftEntriesQuery, t.table, t.column), groupId, position); err != nil {
+			return err
+		}
+		if _, err = uow.Exec(fmt.Sprintf(insertEntryQuery, t.table, t.column), groupId, bookId, position); err != nil {
+			return err
+		}
+		added = true
+		return nil
+	})
+	return added, err
+}
+
+// RemoveEntry takes a book out of a series or a collection, and reports whether it was
+// part of it.
+func RemoveEntry(group string, groupId int64, bookId int64) (bool, error) {
+	t := entryTables[group]
+	var removed bool
+	err := InTransaction(func(uow *UnitOfWork) error {
+		result, err := uow.Exec(fmt.Sprintf(deleteEntryQuery, t.table, t.column), groupId, bookId)
+		if err != nil || !changed(result) {
+			return err
+		}
+		removed = true
+		return renumber(uow, t, groupId)
+	})
+	return removed, err
+}
+
+// leaveGroups takes a book out of the group of t it is about to be put in, and out of
+// every other one when the groups are exclusive, closing the gaps it leaves.
+func leaveGroups(uow *UnitOfWork, t entryTable, groupId int64, bookId int64) error {
+	groupIds, err := queryIds(uow, fmt.Sprintf(getGroupsOfQuery, t.table, t.column), bookId)
+	if err != nil {
+		return err
+	}
+	for _, otherId := range groupIds {
+		if otherId != groupId && !t.exclusive {
+			continue
+		}
+		if _, err = uow.Exec(fmt.Sprintf(deleteEntryQuery, t.table, t.column), otherId, bookId); err != nil {
+			return err
+		}
+		if err = renumber(uow, t, otherId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renumber numbers the books of a group from 1 again, keeping their order.
+func renumber(uow *UnitOfWork, t entryTable, groupId int64) error {
+	bookIds, err := queryIds(uow, fmt.Sprintf(getEntryIdsQuery, t.table, t.column), groupId)
+	if err != nil {
+		return err
+	}
+	for i, bookId := range bookIds {
+		if _, err = uow.Exec(fmt.Sprintf(updatePositionQuery, t.table, t.column), i+1, groupId, bookId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func booksExist(q querier, bookIds []int64) (bool, error) {
+	if len(bookIds) == 0 {
+		return true, nil
+	}
+	rows, err := q.Query(inQuery(getByIdsQuery, len(bookIds)), int64Args(bookIds)...)
+	if err != nil {
+		return false, err
+	}
+	books, err := scanBooks(rows)
+	return len(books) == len(bookIds), err
+}
+
+func queryVolume(query string, seriesId int64, position int) (*domain.Book, error) {
+	rows, err := database.Query(query, seriesId, position)
+	if err != nil {
+		return nil, err
+	}
+	books, err := scanBooks(rows)
+	if err != nil || len(books) == 0 {
+		return nil, err
+	}
+	return &books[0], nil
+}
+
+func querySeries(q querier, query string, args ...interface{}) ([]domain.Series, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []domain.Series{}
+	for rows.Next() {
+		var s domain.Series
+		if err = rows.Scan(&s.Id, &s.Name); err != nil {
+			return nil, err
+		}
+		series = append(series, s)
+	}
+	return series, rows.Err()
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"testing"
+)
+
+func addBooks(t *testing.T, n int) []int64 {
+	ids := make([]int64, n)
+	for i := range ids {
+		id, err := AddBook(domain.Book{Name: "Volume", Author: "Author"})
+		if err != nil {
+			t.Fatalf("Could not add book: %v", err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+func entryIds(t *testing.T, group string, groupId int64) []int64 {
+	entries, err := GetEntries(group, groupId, 100, 0)
+	if err != nil {
+		t.Fatalf("Could not get entries: %v", err)
+	}
+	ids := []int64{}
+	for i, entry := range entries {
+		if entry.Position != i+1 {
+			t.Errorf("Expected position %v, got %v", i+1, entry.Position)
+		}
+		ids = append(ids, entry.Book.Id)
+	}
+	return ids
+}
+
+func sameIds(a []int64, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAddEntryInsertsAtPosition(t *testing.T) {
+	books := addBooks(t, 3)
+	series, _ := AddSeries(domain.Series{Name: "Series"})
+	if set, err := SetEntries(domain.GroupSeries, series, books[:2]); err != nil || !set {
+		t.Fatalf("Expected books to be set, got %v, %v", set, err)
+	}
+
+	if added, err := AddEntry(domain.GroupSeries, series, books[2], 2); err != nil || !added {
+		t.Fatalf("Expected book to be added, got %v, %v", added, err)
+	}
+	if ids := entryIds(t, domain.GroupSeries, series); !sameIds(ids, []int64{books[0], books[2], books[1]}) {
+		t.Errorf("Expected book to be second, got %v", ids)
+	}
+
+	position, err := GetSeriesPosition(books[2])
+	if err != nil || position == nil {
+		t.Fatalf("Expected book to be part of the series, got %v, %v", position, err)
+	}
+	if position.Position != 2 || position.Previous.Id != books[0] || position.Next.Id != books[1] {
+		t.Errorf("Expected the volumes around the book, got %v", position)
+	}
+	if position, _ = GetSeriesPosition(books[0]); position.Previous != nil {
+		t.Errorf("Expected no volume before the first, got %v", position.Previous)
+	}
+}
+
+func TestBookIsPartOfOneSeries(t *testing.T) {
+	books := addBooks(t, 3)
+	first, _ := AddSeries(domain.Series{Name: "First"})
+	second, _ := AddSeries(domain.Series{Name: "Second"})
+	_, _ = SetEntries(domain.GroupSeries, first, books)
+
+	if added, err := AddEntry(domain.GroupSeries, second, books[0], 0); err != nil || !added {
+		t.Fatalf("Expected book to be added, got %v, %v", added, err)
+	}
+	if ids := entryIds(t, domain.GroupSeries, first); !sameIds(ids, books[1:]) {
+		t.Errorf("Expected book to leave the first series, got %v", ids)
+	}
+	if position, _ := GetSeriesPosition(books[0]); position == nil || position.Series.Id != second {
+		t.Errorf("Expected book to be part of the second series, got %v", position)
+	}
+}
+
+func TestBookIsPartOfManyCollections(t *testing.T) {
+	books := addBooks(t, 2)
+	display, _ := AddCollection(domain.Collection{Name: "Display", Kind: domain.KindCollection})
+	shelf, _ := AddCollection(domain.Collection{Name: "A1", Kind: domain.KindShelf})
+	_, _ = SetEntries(domain.GroupCollections, display, books)
+
+	_, _ = AddEntry(domain.GroupCollections, shelf, books[0], 0)
+	if ids := entryIds(t, domain.GroupCollections, display); !sameIds(ids, books) {
+		t.Errorf("Expected books to stay in the collection, got %v", ids)
+	}
+	if added, _ := AddEntry(domain.GroupCollections, display, books[0], 0); !added {
+		t.Fatalf("Expected book to be moved")
+	}
+	if ids := entryIds(t, domain.GroupCollections, display); !sameIds(ids, []int64{books[1], books[0]}) {
+		t.Errorf("Expected book to move to the end, got %v", ids)
+	}
+
+	if removed, err := RemoveEntry(domain.GroupCollections, shelf, books[1]); err != nil || removed {
+		t.Errorf("Expected book not to be on the shelf, got %v, %v", removed, err)
+	}
+	if set, err := SetEntries(domain.GroupCollections, shelf, []int64{books[0], 0}); err != nil || set {
+		t.Errorf("Expected missing book to be refused, got %v, %v", set, err)
+	}
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/classification"
+	"go-rest-webservices-book-library/domain"
+)
+
+const (
+	subjectColumns          = "id, name, code, COALESCE(parent_id, 0)"
+	getSubjectQuery         = "SELECT " + subjectColumns + " FROM subjects WHERE id=?"
+	getSubjectByCodeQuery   = "SELECT " + subjectColumns + " FROM subjects WHERE code=? AND code <> ''"
+	getSubjectsQuery        = "SELECT " + subjectColumns + " FROM subjects ORDER BY name, id"
+	getSubjectsByIdsQuery   = "SELECT " + subjectColumns + " FROM subjects WHERE id IN (%s)"
+	getSubtreeQuery         = "SELECT " + subjectColumns + " FROM subjects WHERE id IN (" + descendantsQuery + ") ORDER BY name, id"
+	getDescendantIdsQuery   = descendantsQuery + " ORDER BY id"
+	insertSubjectQuery      = "INSERT INTO subjects (name, code, parent_id) VALUES (?, ?, ?)"
+	updateSubjectQuery      = "UPDATE subjects SET name=?, code=?, parent_id=? WHERE id=?"
+	deleteSubjectQuery      = "DELETE FROM subjects WHERE id=?"
+	countChildrenQuery      = "SELECT COUNT(*) FROM subjects WHERE parent_id=?"
+	getBookSubjectsQuery    = "SELECT " + subjectColumns + " FROM subjects WHERE id IN (SELECT subject_id FROM book_subjects WHERE book_id=?) ORDER BY name, id"
+	deleteBookSubjectsQuery = "DELETE FROM book_subjects WHERE book_id=?"
+	insertBookSubjectQuery  = "INSERT INTO book_subjects (book_id, subject_id) VALUES (?, ?)"
+	mergeSubjectsQuery      = "INSERT OR IGNORE INTO book_subjects (book_id, subject_id) SELECT ?, subject_id FROM book_subjects WHERE book_id IN (%s)"
+
+	// descendantsQuery selects the id of a subject along with those of every subject below
+	// it, walking the parent_id links down.
+	descendantsQuery = `WITH RECURSIVE tree(id) AS (
+									SELECT ?
+									UNION SELECT subjects.id FROM subjects JOIN tree ON subjects.parent_id = tree.id)
+								SELECT id FROM tree`
+	// subjectFilter narrows a book search down to the books tagged with a subject or any
+	// subject below it.
+	subjectFilter = " AND id IN (SELECT book_id FROM book_subjects WHERE subject_id IN (" + descendantsQuery + "))"
+
+	// Subjects form a tree through parent_id, which is NULL for the roots. code is the
+	// class the subject was imported from, which later imports update it by.
+	createSubjectsQuery = `CREATE TABLE IF NOT EXISTS subjects (
+									id INTEGER PRIMARY KEY,
+									name TEXT NOT NULL,
+									code TEXT NOT NULL DEFAULT '',
+									parent_id INTEGER REFERENCES subjects(id));
+								CREATE INDEX IF NOT EXISTS subjects_parent_id ON subjects (parent_id);
+								CREATE UNIQUE INDEX IF NOT EXISTS subjects_code ON subjects (code) WHERE code <> '';
+								CREATE TABLE IF NOT EXISTS book_subjects (
+									book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+									subject_id INTEGER NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+									PRIMARY KEY (book_id, subject_id));
+								CREATE INDEX IF NOT EXISTS book_subjects_subject_id ON book_subjects (subject_id);`
+)
+
+func GetSubject(id int64) (*domain.Subject, error) {
+	subjects, err := querySubjects(database, getSubjectQuery, id)
+	if err != nil || len(subjects) == 0 {
+		return nil, err
+	}
+	return &subjects[0], nil
+}
+
+// GetSubjectByCode returns the subject imported from the class code, or nil when there is
+// none.
+func GetSubjectByCode(code string) (*domain.Subject, error) {
+	subjects, err := querySubjects(database, getSubjectByCodeQuery, code)
+	if err != nil || len(subjects) == 0 {
+		return nil, err
+	}
+	return &subjects[0], nil
+}
+
+// GetSubjectTree returns the subject rootId with the subjects below it as its Children,
+// or every root subject with theirs when rootId is 0. Siblings are ordered by name. It
+// returns an empty list when there is no subject rootId.
+func GetSubjectTree(rootId int64) ([]domain.Subject, error) {
+	var subjects []domain.Subject
+	var err error
+	if rootId == 0 {
+		subjects, err = querySubjects(database, getSubjectsQuery)
+	} else {
+		subjects, err = querySubjects(database, getSubtreeQuery, rootId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	children := map[int64][]domain.Subject{}
+	roots := []domain.Subject{}
+	for _, subject := range subjects {
+		if subject.Id == rootId || (rootId == 0 && subject.ParentId == 0) {
+			roots = append(roots, subject)
+		} else {
+			children[subject.ParentId] = append(children[subject.ParentId], subject)
+		}
+	}
+	return growTree(roots, children), nil
+}
+
+// GetDescendantIds returns the id of a subject along with those of every subject below
+// it.
+func GetDescendantIds(id int64) ([]int64, error) {
+	return queryIds(database, getDescendantIdsQuery, id)
+}
+
+func AddSubject(subject domain.Subject) (int64, error) {
+	result, err := database.Exec(insertSubjectQuery, subject.Name, subject.Code, parentArg(subject.ParentId))
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func UpdateSubject(subject domain.Subject) error {
+	_, err := database.Exec(updateSubjectQuery, subject.Name, subject.Code, parentArg(subject.ParentId), subject.Id)
+	return err
+}
+
+// DeleteSubject deletes a subject, untagging its books. It returns false, and deletes
+// nothing, while other subjects are filed under it.
+func DeleteSubject(id int64) (bool, error) {
+	var deleted bool
+	err := InTransaction(func(uow *UnitOfWork) error {
+		count, err := queryIds(uow, countChildrenQuery, id)
+		if err != nil || count[0] > 0 {
+			return err
+		}
+		if _, err = uow.Exec(deleteSubjectQuery, id); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	return deleted, err
+}
+
+// GetBookSubjects returns the subjects a book is tagged with, by name.
+func GetBookSubjects(bookId int64) ([]domain.Subject, error) {
+	return querySubjects(database, getBookSubjectsQuery, bookId)
+}
+
+// SetBookSubjects replaces the subjects a book is tagged with by subjectIds and returns
+// them, untagging it when subjectIds is empty. It returns nil, and changes nothing,
+// unless every subject exists.
+func SetBookSubjects(bookId int64, subjectIds []int64) ([]domain.Subject, error) {
+	var set []domain.Subject
+	err := InTransaction(func(uow *UnitOfWork) error {
+		if len(subjectIds) > 0 {
+			subjects, err := querySubjects(uow, inQuery(getSubjectsByIdsQuery, len(subjectIds)), int64Args(subjectIds)...)
+			if err != nil || len(subjects) != len(subjectIds) {
+				return err
+			}
+		}
+
+		if _, err := uow.Exec(deleteBookSubjectsQuery, bookId); err != nil {
+			return err
+		}
+		for _, subjectId := range subjectIds {
+			if _, err := uow.Exec(insertBookSubjectQuery, bookId, subjectId); err != nil {
+				return err
+			}
+		}
+		subjects, err := querySubjects(uow, getBookSubjectsQuery, bookId)
+		set = subjects
+		return err
+	})
+	return set, err
+}
+
+// ImportSubjects adds the classes of a classification file to the subject tree, each
+// filed under the subject of its parent class, or updates the subjects imported from them
+// before. Subjects are matched by code, so importing a file again only applies what
+// changed in it. The entries must come after their parents, as classification.Read
+// returns them.
+func ImportSubjects(entries []classification.Entry) (domain.SubjectImport, error) {
+	var imported domain.SubjectImport
+	err := InTransaction(func(uow *UnitOfWork) error {
+		ids := map[string]int64{}
+		for _, entry := range entries {
+			subject := domain.Subject{Name: entry.Name, Code: entry.Code, ParentId: ids[entry.Parent]}
+			existing, err := querySubjects(uow, getSubjectByCodeQuery, entry.Code)
+			if err != nil {
+				return err
+			}
+
+			if len(existing) == 0 {
+				result, err := uow.Exec(insertSubjectQuery, subject.Name, subject.Code, parentArg(subject.ParentId))
+				if err != nil {
+					return err
+				}
+				if ids[entry.Code], err = result.LastInsertId(); err != nil {
+					return err
+				}
+				imported.Added++
+				continue
+			}
+
+			ids[entry.Code] = existing[0].Id
+			if existing[0].Name == subject.Name && existing[0].ParentId == subject.ParentId {
+				continue
+			}
+			if _, err = uow.Exec(updateSubjectQuery, subject.Name, subject.Code, parentArg(subject.ParentId), existing[0].Id); err != nil {
+				return err
+			}
+			imported.Updated++
+		}
+		return nil
+	})
+	return imported, err
+}
+
+// growTree sets the Children of subjects, and of theirs, from children, which lists the
+// subjects by the id of their parent.
+func growTree(subjects []domain.Subject, children map[int64][]domain.Subject) []domain.Subject {
+	for i := range subjects {
+		if below, found := children[subjects[i].Id]; found {
+			subjects[i].Children = growTree(below, children)
+		}
+	}
+	return subjects
+}
+
+// parentArg stores the roots, which have no ParentId, with a NULL parent_id.
+func parentArg(parentId int64) interface{} {
+	if parentId == 0 {
+		return nil
+	}
+	return parentId
+}
+
+func querySubjects(q querier, query string, args ...interface{}) ([]domain.Subject, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subjects := []domain.Subject{}
+	for rows.Next() {
+		var subject domain.Subject
+		if err = rows.Scan(&subject.Id, &subject.Name, &subject.Code, &subject.ParentId); err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects, rows.Err()
+}
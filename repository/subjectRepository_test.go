@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/classification"
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// addSubjects adds a chain of subjects, each filed under the one before it, and returns
+// their ids.
+func addSubjects(t *testing.T, names ...string) []int64 {
+	var ids []int64
+	var parentId int64
+	for _, name := range names {
+		id, err := AddSubject(domain.Subject{Name: name, ParentId: parentId})
+		if err != nil {
+			t.Fatalf("Could not add subject: %v", err)
+		}
+		ids = append(ids, id)
+		parentId = id
+	}
+	return ids
+}
+
+func TestFindBooksIncludesSubjectsBelow(t *testing.T) {
+	subjects := addSubjects(t, "Fiction", "Fantasy", "High Fantasy")
+	books := addBooks(t, 3)
+	_, _ = SetBookSubjects(books[0], []int64{subjects[2]})
+	_, _ = SetBookSubjects(books[1], []int64{subjects[0]})
+
+	found, err := FindBooks(domain.BookFilter{Subject: subjects[0]}, 10, 0)
+	if err != nil || len(found) != 2 || found[0].Id != books[0] || found[1].Id != books[1] {
+		t.Errorf("Expected the books of the subject and those below it, got %v, %v", found, err)
+	}
+	found, err = FindBooks(domain.BookFilter{Subject: subjects[1]}, 10, 0)
+	if err != nil || len(found) != 1 || found[0].Id != books[0] {
+		t.Errorf("Expected the book of the subject below, got %v, %v", found, err)
+	}
+}
+
+func TestGetSubjectTree(t *testing.T) {
+	subjects := addSubjects(t, "Science", "Mathematics", "Algebra")
+	geometry, _ := AddSubject(domain.Subject{Name: "Geometry", ParentId: subjects[1]})
+
+	tree, err := GetSubjectTree(subjects[0])
+	if err != nil || len(tree) != 1 || tree[0].Id != subjects[0] {
+		t.Fatalf("Expected the subject as the root, got %v, %v", tree, err)
+	}
+	mathematics := tree[0].Children
+	if len(mathematics) != 1 || len(mathematics[0].Children) != 2 {
+		t.Fatalf("Expected the subjects below, got %v", mathematics)
+	}
+	if mathematics[0].Children[0].Id != subjects[2] || mathematics[0].Children[1].Id != geometry {
+		t.Errorf("Expected the subjects below ordered by name, got %v", mathematics[0].Children)
+	}
+
+	if deleted, err := DeleteSubject(subjects[1]); err != nil || deleted {
+		t.Errorf("Expected a subject with subjects below it to be kept, got %v, %v", deleted, err)
+	}
+	if deleted, err := DeleteSubject(geometry); err != nil || !deleted {
+		t.Errorf("Expected subject to be deleted, got %v, %v", deleted, err)
+	}
+}
+
+func TestImportSubjectsUpdatesByCode(t *testing.T) {
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	entries := []classification.Entry{
+		{Code: "800" + suffix, Name: "Literature"},
+		{Code: "820" + suffix, Name: "English literature", Parent: "800" + suffix},
+	}
+	imported, err := ImportSubjects(entries)
+	if err != nil || imported != (domain.SubjectImport{Added: 2}) {
+		t.Fatalf("Expected two subjects to be added, got %v, %v", imported, err)
+	}
+
+	entries[1].Name = "English and Old English literatures"
+	if imported, err = ImportSubjects(entries); err != nil || imported != (domain.SubjectImport{Updated: 1}) {
+		t.Fatalf("Expected one subject to be updated, got %v, %v", imported, err)
+	}
+	parent, _ := GetSubjectByCode("800" + suffix)
+	child, _ := GetSubjectByCode("820" + suffix)
+	if child.Name != entries[1].Name || child.ParentId != parent.Id {
+		t.Errorf("Expected subject to be renamed under its parent, got %v", child)
+	}
+}
+
+func TestMergeBooksKeepsSubjects(t *testing.T) {
+	subjects := addSubjects(t, "History")
+	books := addBooks(t, 2)
+	_, _ = SetBookSubjects(books[1], subjects)
+
+	if _, err := MergeBooks(books[0], books[1:]); err != nil {
+		t.Fatalf("Expected books to be merged, got %v", err)
+	}
+	if tagged, _ := GetBookSubjects(books[0]); len(tagged) != 1 || tagged[0].Id != subjects[0] {
+		t.Errorf("Expected target to be tagged with the subjects of the source, got %v", tagged)
+	}
+}
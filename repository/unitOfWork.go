@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"database/sql"
+	"go-rest-webservices-book-library/events"
+	"sync"
+)
+
+// querier runs statements either straight on the database or within a transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// UnitOfWork is a transaction together with the events recorded in it. The events are
+// written to the event log and the webhook outbox by the same transaction as the change
+// they describe, and only dispatched to events.Committed once it has committed.
+type UnitOfWork struct {
+	tx     *sql.Tx
+	events []events.Event
+}
+
+// writeMu lets one unit of work run at a time, which keeps events dispatched in the order
+// of their sequence numbers and spares SQLite's lock on concurrent writes.
+var writeMu sync.Mutex
+
+// InTransaction runs work in a new unit of work. It commits when work returns nil and
+// rolls back, dropping the recorded events, otherwise.
+func InTransaction(work func(uow *UnitOfWork) error) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	uow := &UnitOfWork{tx: tx}
+	if err = work(uow); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, event := range uow.events {
+		events.Committed.Dispatch(event)
+	}
+	return nil
+}
+
+func (u *UnitOfWork) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return u.tx.Exec(query, args...)
+}
+
+func (u *UnitOfWork) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return u.tx.Query(query, args...)
+}
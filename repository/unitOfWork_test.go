@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"errors"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/events"
+	"strconv"
+	"testing"
+)
+
+func TestInTransactionRollsBackChangesAndEvents(t *testing.T) {
+	committed, unsubscribe := events.Books.Subscribe()
+	defer unsubscribe()
+
+	var bookId int64
+	failure := errors.New("failure")
+	err := InTransaction(func(uow *UnitOfWork) error {
+		result, err := uow.Exec(insertQuery, "Rolled Back", "Author", "", "", "", 0, 0)
+		if err == nil {
+			bookId, err = result.LastInsertId()
+		}
+		if err == nil {
+			err = uow.Record(events.BookCreated, domain.Book{Id: bookId, Name: "Rolled Back", Author: "Author"})
+		}
+		if err != nil {
+			t.Fatalf("Expected the book and its event to be written, got %v", err)
+		}
+		return failure
+	})
+
+	if err != failure {
+		t.Errorf("Expected %v, got %v", failure, err)
+	}
+	if books, _ := GetBook(strconv.FormatInt(bookId, 10)); len(books) != 0 {
+		t.Errorf("Expected the book to be rolled back, got %v", books)
+	}
+	if logged, _ := GetEventsAfter(0, 1<<20); len(logged) > 0 && logged[len(logged)-1].Book.Id == bookId {
+		t.Errorf("Expected the event to be rolled back, got %v", logged[len(logged)-1])
+	}
+	select {
+	case event := <-committed:
+		t.Errorf("Expected no event to be dispatched, got %v", event)
+	default:
+	}
+}
+
+func TestInTransactionDispatchesCommittedEvents(t *testing.T) {
+	committed, unsubscribe := events.Books.Subscribe()
+	defer unsubscribe()
+
+	id, err := AddBook(domain.Book{Name: "Committed", Author: "Author"})
+	if err != nil {
+		t.Fatalf("Expected book to be added, got %v", err)
+	}
+
+	event := <-committed
+	if event.Type != events.BookCreated || event.Book.Id != id {
+		t.Errorf("Expected created event of book %v, got %v", id, event)
+	}
+	logged, err := GetEventsAfter(event.Sequence-1, 1)
+	if err != nil || len(logged) != 1 || logged[0].Book.Id != id {
+		t.Errorf("Expected event %v in the log, got %v, %v", event.Sequence, logged, err)
+	}
+}
+
+func TestEventLogKeepsWholeBook(t *testing.T) {
+	book := domain.Book{Name: "A Wizard of Earthsea", Author: "Ursula K. Le Guin", Isbn: "9780547773742",
+		Publisher: "Parnassus", Year: 1968, Pages: 205}
+	id, err := AddBook(book)
+	if err != nil {
+		t.Fatalf("Expected book to be added, got %v", err)
+	}
+	book.Id = id
+
+	logged, err := GetEventsAfter(0, 1<<20)
+	if err != nil || len(logged) == 0 {
+		t.Fatalf("Expected events in the log, got %v, %v", logged, err)
+	}
+	if replayed := logged[len(logged)-1]; replayed.Book != book {
+		t.Errorf("Expected the replayed event to carry %+v, got %+v", book, replayed.Book)
+	}
+}
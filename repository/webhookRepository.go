@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go-rest-webservices-book-library/domain"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	webhookColumns  = "id, url, secret, events, active, created_at"
+	deliveryColumns = "id, webhook_id, event_key, event_type, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at"
+	attemptColumns  = "id, delivery_id, attempted_at, status_code, error, duration_ms"
+	eventsSeparator = ","
+
+	insertWebhookQuery  = "INSERT INTO webhooks (url, secret, events, active, created_at) VALUES (?, ?, ?, ?, ?)"
+	getWebhooksQuery    = "SELECT " + webhookColumns + " FROM webhooks ORDER BY id"
+	getWebhookQuery     = "SELECT " + webhookColumns + " FROM webhooks WHERE id=?"
+	updateWebhookQuery  = "UPDATE webhooks SET url=?, events=?, active=? WHERE id=?"
+	deleteWebhookQuery  = "DELETE FROM webhooks WHERE id=?"
+	getSubscribersQuery = "SELECT id FROM webhooks WHERE active = 1 AND (',' || events || ',') LIKE ?"
+
+	insertDeliveryQuery = `INSERT OR IGNORE INTO webhook_deliveries
+									(webhook_id, event_key, event_type, payload, status, attempts, next_attempt_at, created_at)
+									VALUES (?, ?, ?, ?, ?, 0, ?, ?)`
+	getDueDeliveriesQuery = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ?
+									AND webhook_id IN (SELECT id FROM webhooks WHERE active = 1) ORDER BY next_attempt_at, id LIMIT ?`
+	getDeliveriesQuery    = "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE webhook_id = ? AND (? = '' OR status = ?) ORDER BY id DESC LIMIT ? OFFSET ?"
+	getDeliveryQuery      = "SELECT " + deliveryColumns + " FROM webhook_deliveries WHERE webhook_id = ? AND id = ?"
+	updateDeliveryQuery   = `UPDATE webhook_deliveries SET status=?, attempts=?, next_attempt_at=?, last_status_code=?,
+									last_error=?, delivered_at=? WHERE id=?`
+	redeliverQuery = "UPDATE webhook_deliveries SET status=?, attempts=0, next_attempt_at=? WHERE webhook_id=? AND id=?"
+
+	insertAttemptQuery = "INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, error, duration_ms) VALUES (?, ?, ?, ?, ?)"
+	getAttemptsQuery   = "SELECT " + attemptColumns + " FROM webhook_attempts WHERE delivery_id = ? ORDER BY id"
+
+	getNewlyOverdueLoansQuery = "SELECT " + loanColumns + " FROM loans WHERE returned_at IS NULL AND due_at >= ? AND due_at < ? ORDER BY id"
+
+	createWebhookTablesQuery = `CREATE TABLE IF NOT EXISTS webhooks (
+									id INTEGER PRIMARY KEY,
+									url TEXT NOT NULL,
+									secret TEXT NOT NULL,
+									events TEXT NOT NULL,
+									active INTEGER NOT NULL DEFAULT 1,
+									created_at DATETIME NOT NULL);
+								CREATE TABLE IF NOT EXISTS webhook_deliveries (
+									id INTEGER PRIMARY KEY,
+									webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+									event_key TEXT NOT NULL,
+									event_type TEXT NOT NULL,
+									payload TEXT NOT NULL,
+									status TEXT NOT NULL,
+									attempts INTEGER NOT NULL DEFAULT 0,
+									next_attempt_at DATETIME NOT NULL,
+									last_status_code INTEGER NOT NULL DEFAULT 0,
+									last_error TEXT NOT NULL DEFAULT '',
+									created_at DATETIME NOT NULL,
+									delivered_at DATETIME,
+									UNIQUE (webhook_id, event_key));
+								CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+								CREATE TABLE IF NOT EXISTS webhook_attempts (
+									id INTEGER PRIMARY KEY,
+									delivery_id INTEGER NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+									attempted_at DATETIME NOT NULL,
+									status_code INTEGER NOT NULL,
+									error TEXT NOT NULL,
+									duration_ms INTEGER NOT NULL);
+								CREATE INDEX IF NOT EXISTS webhook_attempts_delivery_id ON webhook_attempts (delivery_id);`
+)
+
+// webhookPayload is the body posted to webhooks. Id identifies the event, receivers use it
+// to drop the duplicates at-least-once delivery can cause.
+type webhookPayload struct {
+	Id         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurredAt"`
+	Data       interface{} `json:"data"`
+}
+
+func AddWebhook(webhook domain.Webhook) (int64, error) {
+	result, err := database.Exec(insertWebhookQuery, webhook.Url, webhook.Secret,
+		strings.Join(webhook.Events, eventsSeparator), webhook.Active, webhook.CreatedAt)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func GetWebhooks() ([]domain.Webhook, error) {
+	rows, err := database.Query(getWebhooksQuery)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhooks(rows)
+}
+
+// GetWebhook returns nil when there is no webhook with id.
+func GetWebhook(id int64) (*domain.Webhook, error) {
+	rows, err := database.Query(getWebhookQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := scanWebhooks(rows)
+	if err != nil || len(webhooks) == 0 {
+		return nil, err
+	}
+	return &webhooks[0], nil
+}
+
+// UpdateWebhook changes the url, events and active flag of a webhook, its secret is kept.
+func UpdateWebhook(webhook domain.Webhook) error {
+	_, err := database.Exec(updateWebhookQuery, webhook.Url,
+		strings.Join(webhook.Events, eventsSeparator), webhook.Active, webhook.Id)
+	return err
+}
+
+func DeleteWebhook(id int64) error {
+	_, err := database.Exec(deleteWebhookQuery, id)
+	return err
+}
+
+// GetDueDeliveries returns up to limit pending deliveries of active webhooks whose next
+// attempt is due at now. Those of inactive webhooks wait until they are active again.
+func GetDueDeliveries(now time.Time, limit int64) ([]domain.WebhookDelivery, error) {
+	return queryDeliveries(getDueDeliveriesQuery, domain.DeliveryPending, now.UTC(), limit)
+}
+
+// GetDeliveries pages through the deliveries of a webhook, newest first, only those with
+// status unless it is empty.
+func GetDeliveries(webhookId int64, status string, limit int64, offset int64) ([]domain.WebhookDelivery, error) {
+	return queryDeliveries(getDeliveriesQuery, webhookId, status, status, limit, offset)
+}
+
+// GetDelivery returns nil when webhookId has no delivery with id.
+func GetDelivery(webhookId int64, id int64) (*domain.WebhookDelivery, error) {
+	deliveries, err := queryDeliveries(getDeliveryQuery, webhookId, id)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	return &deliveries[0], nil
+}
+
+func GetDeliveryAttempts(deliveryId int64) ([]domain.WebhookAttempt, error) {
+	rows, err := database.Query(getAttemptsQuery, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []domain.WebhookAttempt{}
+	for rows.Next() {
+		var attempt domain.WebhookAttempt
+		if err = rows.Scan(&attempt.Id, &attempt.DeliveryId, &attempt.AttemptedAt, &attempt.StatusCode,
+			&attempt.Error, &attempt.DurationMs); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+// RecordDeliveryAttempt stores an attempt together with the resulting state of its
+// delivery, in one transaction.
+func RecordDeliveryAttempt(delivery domain.WebhookDelivery, attempt domain.WebhookAttempt) error {
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(insertAttemptQuery, delivery.Id, attempt.AttemptedAt.UTC(), attempt.StatusCode,
+		attempt.Error, attempt.DurationMs)
+	if err == nil {
+		_, err = tx.Exec(updateDeliveryQuery, delivery.Status, delivery.Attempts, delivery.NextAttemptAt.UTC(),
+			delivery.LastStatusCode, delivery.LastError, delivery.DeliveredAt, delivery.Id)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts, typically to take it
+// off the dead letter list. It reports whether the delivery exists.
+func Redeliver(webhookId int64, id int64) (bool, error) {
+	result, err := database.Exec(redeliverQuery, domain.DeliveryPending, time.Now().UTC(), webhookId, id)
+	if err != nil {
+		return false, err
+	}
+	return changed(result), nil
+}
+
+// EnqueueOverdueLoans queues a loan.overdue delivery for every loan still out whose due
+// date passed between since and now, and returns how many loans there were. The event key
+// makes sure a loan is announced once per webhook, however often it is seen.
+func EnqueueOverdueLoans(since time.Time, now time.Time) (int, error) {
+	loans, err := queryLoans(database, getNewlyOverdueLoansQuery, since.UTC(), now.UTC())
+	if err != nil || len(loans) == 0 {
+		return 0, err
+	}
+
+	return len(loans), InTransaction(func(uow *UnitOfWork) error {
+		for _, loan := range loans {
+			payload := webhookPayload{
+				Id:         domain.EventLoanOverdue + ":" + strconv.FormatInt(loan.Id, 10),
+				Type:       domain.EventLoanOverdue,
+				OccurredAt: loan.DueAt.UTC(),
+				Data: map[string]interface{}{"loan": map[string]interface{}{
+					"id": loan.Id, "copyId": loan.CopyId, "memberId": loan.MemberId,
+					"loanedAt": loan.LoanedAt.UTC(), "dueAt": loan.DueAt.UTC(),
+				}},
+			}
+			if err := enqueueWebhookDeliveries(uow, payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// enqueueWebhookDeliveries adds a pending delivery of payload to the outbox for every
+// active webhook subscribed to its type.
+func enqueueWebhookDeliveries(q querier, payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.Query(getSubscribersQuery, "%"+eventsSeparator+payload.Type+eventsSeparator+"%")
+	if err != nil {
+		return err
+	}
+	var webhookIds []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			break
+		}
+		webhookIds = append(webhookIds, id)
+	}
+	_ = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, webhookId := range webhookIds {
+		if _, err = q.Exec(insertDeliveryQuery, webhookId, payload.Id, payload.Type, string(body),
+			domain.DeliveryPending, now, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queryDeliveries(query string, args ...interface{}) ([]domain.WebhookDelivery, error) {
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []domain.WebhookDelivery{}
+	for rows.Next() {
+		var delivery domain.WebhookDelivery
+		var deliveredAt sql.NullTime
+		if err = rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.EventKey, &delivery.EventType,
+			&delivery.Payload, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+			&delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &deliveredAt); err != nil {
+			return nil, err
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhooks(rows *sql.Rows) ([]domain.Webhook, error) {
+	defer rows.Close()
+
+	webhooks := []domain.Webhook{}
+	for rows.Next() {
+		var webhook domain.Webhook
+		var events string
+		if err := rows.Scan(&webhook.Id, &webhook.Url, &webhook.Secret, &events, &webhook.Active,
+			&webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhook.Events = strings.Split(events, eventsSeparator)
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"testing"
+	"time"
+)
+
+func TestGetDueDeliveriesSkipsInactiveWebhooks(t *testing.T) {
+	now := time.Now().UTC()
+	webhookIds := map[bool]int64{}
+	for _, active := range []bool{true, false} {
+		id, err := AddWebhook(domain.Webhook{Url: "https://example.com/hook", Secret: "secret", Events: []string{domain.EventLoanOverdue}, Active: active, CreatedAt: now})
+		if err != nil {
+			t.Fatalf("Expected webhook to be added, got %v", err)
+		}
+		if _, err = database.Exec(insertDeliveryQuery, id, "due", domain.EventLoanOverdue, "{}", domain.DeliveryPending, now.Add(-time.Minute), now); err != nil {
+			t.Fatalf("Expected delivery to be added, got %v", err)
+		}
+		webhookIds[active] = id
+	}
+
+	deliveries, err := GetDueDeliveries(now, 1000)
+	if err != nil {
+		t.Fatalf("Expected due deliveries, got %v", err)
+	}
+	due := map[int64]bool{}
+	for _, delivery := range deliveries {
+		due[delivery.WebhookId] = true
+	}
+	if !due[webhookIds[true]] || due[webhookIds[false]] {
+		t.Errorf("Expected the delivery of the active webhook only, got %v", deliveries)
+	}
+}
@@ -0,0 +1,295 @@
+package router
+
+import (
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/middleware"
+	"go-rest-webservices-book-library/openapi"
+	"go-rest-webservices-book-library/services"
+	"net/http"
+	"os"
+)
+
+// New wires every route of the library API together with its middleware. It is used by
+// main and by tests which need to run the real API, such as the client package tests.
+func New() http.Handler {
+	var handler http.Handler = newMuxRouter()
+	if config.ValidateRequests {
+		handler = openapi.ValidateRequests(handler)
+	}
+
+	return middleware.SecurityHeaders(middleware.Cors()(handler))
+}
+
+func newMuxRouter() *mux.Router {
+	logFile := config.LogFile
+	router := mux.NewRouter()
+
+	// The unversioned paths predate versioning and stay aliases of v1.
+	handleBooks(router, logFile, dto.V1)
+	handleBooks(router.PathPrefix("/v1").Subrouter(), logFile, dto.V1)
+	handleBooks(router.PathPrefix("/v2").Subrouter(), logFile, dto.V2)
+
+	handleWebhooks(router, logFile)
+	handleAdmin(router, logFile)
+
+	router.Handle(
+		"/graphql",
+		handlers.LoggingHandler(logFile, idempotent(services.GraphqlHandler))).
+		Methods("POST")
+
+	// Download links are signed for this path, so it is left out of the API versions.
+	router.Handle(
+		"/downloads/{id}",
+		handlers.LoggingHandler(logFile, http.HandlerFunc(services.DownloadHandler))).
+		Methods("GET")
+
+	router.Handle(
+		"/openapi.json",
+		handlers.LoggingHandler(logFile, http.HandlerFunc(openapi.SpecificationHandler))).
+		Methods("GET")
+
+	router.Handle(
+		"/docs",
+		handlers.LoggingHandler(logFile, http.HandlerFunc(openapi.DocumentationHandler))).
+		Methods("GET")
+
+	router.Handle(
+		"/docs/redoc.standalone.js",
+		handlers.LoggingHandler(logFile, http.HandlerFunc(openapi.DocumentationScriptHandler))).
+		Methods("GET")
+
+	return router
+}
+
+// idempotent lets clients retry a non-idempotent handler with an Idempotency-Key header.
+func idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	return middleware.Idempotency(handler).ServeHTTP
+}
+
+func handleBooks(router *mux.Router, logFile *os.File, mapper dto.Mapper) {
+	version := func(handler http.HandlerFunc) http.Handler {
+		return handlers.LoggingHandler(logFile,
+			middleware.Deprecation(mapper.Version(), dto.Use(mapper, handler)))
+	}
+
+	router.Handle("/books", version(services.GetAllBooksHandler)).
+		Methods("GET")
+
+	router.Handle("/books/events", version(services.BookEventsHandler)).
+		Methods("GET")
+
+	router.Handle("/books/events/ws", version(services.BookEventsSocketHandler)).
+		Methods("GET")
+
+	router.Handle("/books/duplicates", version(services.GetDuplicatesHandler)).
+		Methods("GET")
+
+	router.Handle("/books/merge", version(idempotent(services.MergeBooksHandler))).
+		Methods("POST")
+
+	router.Handle("/books/lookup", version(services.BookLookupHandler)).
+		Methods("POST")
+
+	router.Handle("/book", version(idempotent(services.AddBookHandler))).
+		Methods("POST")
+
+	router.Handle("/book/{id}", version(services.BookHandler)).
+		Methods("GET", "DELETE", "PUT")
+
+	router.Handle("/book/{id}/authors", version(services.BookCreditsHandler)).
+		Methods("GET", "PUT")
+
+	router.Handle("/book/{id}/subjects", version(services.BookSubjectsHandler)).
+		Methods("GET", "PUT")
+
+	router.Handle("/book/{id}/cover", version(services.CoverHandler)).
+		Methods("GET", "PUT", "DELETE")
+
+	router.Handle("/book/{id}/attachments", version(services.AttachmentsHandler)).
+		Methods("GET", "POST")
+
+	router.Handle("/book/{id}/attachments/{attachmentId}", version(services.AttachmentHandler)).
+		Methods("GET", "DELETE")
+
+	router.Handle("/book/{id}/attachments/{attachmentId}/link", version(services.AttachmentLinkHandler)).
+		Methods("POST")
+
+	router.Handle("/book/{id}/digital-loans", version(idempotent(services.DigitalLoansHandler))).
+		Methods("POST")
+
+	router.Handle("/book/{id}/label", version(services.BookLabelHandler)).
+		Methods("GET")
+
+	router.Handle("/book/{id}/copies", version(services.BookCopiesHandler)).
+		Methods("GET")
+
+	router.Handle("/book/{id}/copies", version(idempotent(services.BookCopiesHandler))).
+		Methods("POST")
+
+	router.Handle("/copies/{id}", version(services.CopyHandler)).
+		Methods("GET", "PUT")
+
+	router.Handle("/digital-loans/{id}", version(services.DigitalLoanHandler)).
+		Methods("GET", "DELETE")
+
+	router.Handle("/labels", version(services.LabelsHandler)).
+		Methods("POST")
+
+	router.Handle("/loans", version(idempotent(services.AddLoanHandler))).
+		Methods("POST")
+
+	router.Handle("/loans/{id}", version(services.LoanHandler)).
+		Methods("GET")
+
+	router.Handle("/loans/{id}/renew", version(idempotent(services.RenewLoanHandler))).
+		Methods("POST")
+
+	router.Handle("/loans/{id}/return", version(services.ReturnLoanHandler)).
+		Methods("POST")
+
+	router.Handle("/members", version(services.GetMembersHandler)).
+		Methods("GET")
+
+	router.Handle("/members/{id}", version(services.MemberHandler)).
+		Methods("GET")
+
+	router.Handle("/members/{id}/account", version(services.MemberAccountHandler)).
+		Methods("GET")
+
+	router.Handle("/members/{id}/payments", version(idempotent(services.AddPaymentHandler))).
+		Methods("POST")
+
+	router.Handle("/members/{id}/preferences", version(services.NotificationPreferencesHandler)).
+		Methods("GET", "PUT")
+
+	router.Handle("/members/{id}/notifications", version(services.GetNotificationsHandler)).
+		Methods("GET")
+
+	// Account routes answer retries with 409 or the same result by themselves, and are
+	// left out of the idempotency cache, which does not tell members apart.
+	router.Handle("/register", version(services.RegisterHandler)).
+		Methods("POST")
+
+	router.Handle("/verify-email", version(services.VerifyEmailHandler)).
+		Methods("POST")
+
+	router.Handle("/login", version(services.LoginHandler)).
+		Methods("POST")
+
+	router.Handle("/logout", version(services.LogoutHandler)).
+		Methods("POST")
+
+	router.Handle("/password-reset", version(services.PasswordResetHandler)).
+		Methods("POST")
+
+	router.Handle("/password-reset/confirm", version(services.ConfirmPasswordResetHandler)).
+		Methods("POST")
+
+	router.Handle("/me", version(services.MeHandler)).
+		Methods("GET")
+
+	router.Handle("/me/loans", version(services.MyLoansHandler)).
+		Methods("GET")
+
+	router.Handle("/me/holds", version(services.AddMyHoldHandler)).
+		Methods("POST")
+
+	router.Handle("/me/preferences", version(services.MyPreferencesHandler)).
+		Methods("GET", "PUT")
+
+	router.Handle("/attachments/metadata", version(services.EditionMetadataHandler)).
+		Methods("POST")
+
+	router.Handle("/authors", version(services.GetAuthorsHandler)).
+		Methods("GET")
+
+	router.Handle("/authors", version(idempotent(services.AddAuthorHandler))).
+		Methods("POST")
+
+	router.Handle("/authors/{id}", version(services.AuthorHandler)).
+		Methods("GET", "PUT", "DELETE")
+
+	router.Handle("/authors/{id}/books", version(services.GetAuthorBooksHandler)).
+		Methods("GET")
+
+	router.Handle("/series", version(services.GetSeriesListHandler)).
+		Methods("GET")
+
+	router.Handle("/series", version(idempotent(services.AddSeriesHandler))).
+		Methods("POST")
+
+	router.Handle("/series/{id}", version(services.SeriesHandler)).
+		Methods("GET", "PUT", "DELETE")
+
+	router.Handle("/series/{id}/books", version(services.SeriesBooksHandler)).
+		Methods("GET", "PUT", "POST")
+
+	router.Handle("/series/{id}/books/{bookId}", version(services.SeriesBookHandler)).
+		Methods("DELETE")
+
+	router.Handle("/collections", version(services.GetCollectionsHandler)).
+		Methods("GET")
+
+	router.Handle("/collections", version(idempotent(services.AddCollectionHandler))).
+		Methods("POST")
+
+	router.Handle("/collections/{id}", version(services.CollectionHandler)).
+		Methods("GET", "PUT", "DELETE")
+
+	router.Handle("/collections/{id}/books", version(services.CollectionBooksHandler)).
+		Methods("GET", "PUT", "POST")
+
+	router.Handle("/collections/{id}/books/{bookId}", version(services.CollectionBookHandler)).
+		Methods("DELETE")
+
+	router.Handle("/subjects", version(services.GetSubjectsHandler)).
+		Methods("GET")
+
+	router.Handle("/subjects", version(idempotent(services.AddSubjectHandler))).
+		Methods("POST")
+
+	router.Handle("/subjects/import", version(services.ImportSubjectsHandler)).
+		Methods("POST")
+
+	router.Handle("/subjects/{id}", version(services.SubjectHandler)).
+		Methods("GET", "PUT", "DELETE")
+}
+
+func handleWebhooks(router *mux.Router, logFile *os.File) {
+	logged := func(handler http.HandlerFunc) http.Handler {
+		return handlers.LoggingHandler(logFile, handler)
+	}
+
+	router.Handle("/webhooks", logged(services.GetWebhooksHandler)).
+		Methods("GET")
+
+	router.Handle("/webhooks", logged(idempotent(services.AddWebhookHandler))).
+		Methods("POST")
+
+	router.Handle("/webhooks/{id}", logged(services.WebhookHandler)).
+		Methods("GET", "PUT", "DELETE")
+
+	router.Handle("/webhooks/{id}/deliveries", logged(services.GetWebhookDeliveriesHandler)).
+		Methods("GET")
+
+	router.Handle("/webhooks/{id}/deliveries/{deliveryId}/attempts", logged(services.GetDeliveryAttemptsHandler)).
+		Methods("GET")
+
+	router.Handle("/webhooks/{id}/deliveries/{deliveryId}/redeliver", logged(idempotent(services.RedeliverHandler))).
+		Methods("POST")
+}
+
+func handleAdmin(router *mux.Router, logFile *os.File) {
+	logged := func(handler http.HandlerFunc) http.Handler {
+		return handlers.LoggingHandler(logFile, handler)
+	}
+
+	router.Handle("/admin/jobs", logged(services.GetJobsHandler)).
+		Methods("GET")
+
+	router.Handle("/admin/jobs/{name}/run", logged(services.RunJobHandler)).
+		Methods("POST")
+}
@@ -0,0 +1,331 @@
+package router
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/openapi"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// routerStaffToken is the staff token the router tests configure and send.
+const routerStaffToken = "router-staff"
+
+type scenario struct {
+	name    string
+	method  string
+	path    string
+	data    []byte
+	headers map[string]string
+	status  int
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	documented := map[string]bool{}
+	for _, operation := range openapi.Operations() {
+		documented[operation] = true
+	}
+
+	_ = newMuxRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			if !documented[method+" "+path] {
+				t.Errorf("Route %v %v is missing from openapi.json", method, path)
+			}
+		}
+		return nil
+	})
+}
+
+func TestResponsesMatchSpecification(t *testing.T) {
+	server := httptest.NewServer(New())
+	defer server.Close()
+	staffToken := config.StaffToken
+	defer func() { config.StaffToken = staffToken }()
+	config.StaffToken = routerStaffToken
+	staff := map[string]string{"Authorization": "Bearer " + routerStaffToken}
+
+	created := addBook(t, server.URL)
+	id := strconv.FormatInt(created.Id, 10)
+	staffIdempotencyKey := map[string]string{"Authorization": "Bearer " + routerStaffToken,
+		"Idempotency-Key": "router-" + strconv.FormatInt(time.Now().UnixNano(), 10)}
+	target, source := strconv.FormatInt(addBook(t, server.URL).Id, 10), strconv.FormatInt(addBook(t, server.URL).Id, 10)
+	author, spare := strconv.FormatInt(addAuthor(t, server.URL).Id, 10), strconv.FormatInt(addAuthor(t, server.URL).Id, 10)
+	credits := `{"Credits":[{"AuthorId":` + author + `,"Role":"author"},{"AuthorId":` + author + `,"Role":"translator"}]}`
+	first, second := strconv.FormatInt(addBook(t, server.URL).Id, 10), strconv.FormatInt(addBook(t, server.URL).Id, 10)
+	series, shelf := addAt(t, server.URL, "/series", `{"Name":"Earthsea"}`), addAt(t, server.URL, "/collections", `{"Name":"A1","Kind":"shelf"}`)
+	fiction := addAt(t, server.URL, "/subjects", `{"Name":"Fiction"}`)
+	fantasy := addAt(t, server.URL, "/subjects", `{"Name":"Fantasy","ParentId":`+fiction+`}`)
+	plainText := map[string]string{"Content-Type": "text/plain"}
+	code := "R" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	barcode := "C" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	var cover bytes.Buffer
+	_ = png.Encode(&cover, image.NewGray(image.Rect(0, 0, 60, 90)))
+	pngImage := map[string]string{"Content-Type": "image/png"}
+	var edition bytes.Buffer
+	archive := zip.NewWriter(&edition)
+	for _, file := range [][2]string{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<container><rootfiles><rootfile full-path="content.opf"/></rootfiles></container>`},
+		{"content.opf", `<package><metadata><title>Book</title><creator>Author</creator><language>en</language></metadata></package>`},
+	} {
+		writer, _ := archive.Create(file[0])
+		_, _ = writer.Write([]byte(file[1]))
+	}
+	_ = archive.Close()
+	epub := map[string]string{"Content-Type": "application/epub+zip"}
+
+	scenarios := []scenario{
+		{name: "list books", method: "GET", path: "/books", status: http.StatusOK},
+		{name: "list page of books", method: "GET", path: "/books?limit=1&offset=0", status: http.StatusOK},
+		{name: "list books with bad limit", method: "GET", path: "/books?limit=-1", status: http.StatusBadRequest},
+		{name: "get book", method: "GET", path: "/book/" + id, status: http.StatusOK},
+		{name: "get missing book", method: "GET", path: "/book/0", status: http.StatusNotFound},
+		{name: "add invalid book", method: "POST", path: "/book", data: []byte(`{"Name":"Book"}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "add malformed book", method: "POST", path: "/book", data: []byte(`{"Name":`), headers: staff, status: http.StatusBadRequest},
+		{name: "add too large book", method: "POST", path: "/book", data: bytes.Repeat([]byte(" "), 2<<20), headers: staff, status: http.StatusRequestEntityTooLarge},
+		{name: "update book", method: "PUT", path: "/book/" + id, data: []byte(`{"Name":"Book2","Author":"Author2"}`), headers: staff, status: http.StatusOK},
+		{name: "update book with unknown field", method: "PUT", path: "/book/" + id, data: []byte(`{"Name":"Book2","Author":"Author2","Edition":2}`), headers: staff, status: http.StatusBadRequest},
+		{name: "update v2 book with publication", method: "PUT", path: "/v2/book/" + id, data: []byte(`{"title":"Book2","author":"Author2","publisher":"Parnassus","year":1968,"pages":205}`), headers: staff, status: http.StatusOK},
+		{name: "update book with year to come", method: "PUT", path: "/book/" + id, data: []byte(`{"Name":"Book2","Author":"Author2","Year":3000}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "add book with bad enrich flag", method: "POST", path: "/v2/book?enrich=maybe", data: []byte(`{"title":"Book","author":"Author"}`), headers: staff, status: http.StatusBadRequest},
+		{name: "look up book by invalid isbn", method: "POST", path: "/books/lookup?isbn=123", status: http.StatusBadRequest},
+		{name: "get label of book without copies", method: "GET", path: "/book/" + id + "/label", status: http.StatusConflict},
+		{name: "get label of missing book", method: "GET", path: "/v2/book/0/label?format=svg", status: http.StatusNotFound},
+		{name: "get label in unknown format", method: "GET", path: "/book/" + id + "/label?format=gif", status: http.StatusBadRequest},
+		{name: "print labels of missing copies", method: "POST", path: "/labels", data: []byte(`{"Copies":[0]}`), status: http.StatusUnprocessableEntity},
+		{name: "print no v2 labels", method: "POST", path: "/v2/labels?format=svg", data: []byte(`{"copies":[]}`), status: http.StatusUnprocessableEntity},
+		{name: "get v1 book", method: "GET", path: "/v1/book/" + id, status: http.StatusOK},
+		{name: "list v2 books", method: "GET", path: "/v2/books?limit=2", status: http.StatusOK},
+		{name: "get v2 book", method: "GET", path: "/v2/book/" + id, status: http.StatusOK},
+		{name: "add invalid v2 book", method: "POST", path: "/v2/book", data: []byte(`{"title":"Book"}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "add v1 book on v2", method: "POST", path: "/v2/book", data: []byte(`{"Name":"Book","Author":"Author"}`), headers: staff, status: http.StatusBadRequest},
+		{name: "update v2 book", method: "PUT", path: "/v2/book/" + id, data: []byte(`{"title":"Book3","author":"Author3"}`), headers: staff, status: http.StatusOK},
+		{name: "add book without staff token", method: "POST", path: "/book", data: []byte(`{"Name":"Book","Author":"Author"}`), status: http.StatusUnauthorized},
+		{name: "update v2 book without staff token", method: "PUT", path: "/v2/book/" + id, data: []byte(`{"title":"Book3","author":"Author3"}`), status: http.StatusUnauthorized},
+		{name: "delete book without staff token", method: "DELETE", path: "/book/" + id, status: http.StatusUnauthorized},
+		{name: "delete book", method: "DELETE", path: "/book/" + id, headers: staff, status: http.StatusNoContent},
+		{name: "add book idempotently", method: "POST", path: "/book", data: []byte(`{"Name":"Book","Author":"Author"}`), headers: staffIdempotencyKey, status: http.StatusOK},
+		{name: "replay add book", method: "POST", path: "/book", data: []byte(`{"Name":"Book","Author":"Author"}`), headers: staffIdempotencyKey, status: http.StatusOK},
+		{name: "reuse idempotency key", method: "POST", path: "/book", data: []byte(`{"Name":"Other","Author":"Author"}`), headers: staffIdempotencyKey, status: http.StatusUnprocessableEntity},
+		{name: "list duplicates", method: "GET", path: "/books/duplicates", status: http.StatusOK},
+		{name: "list v2 duplicates", method: "GET", path: "/v2/books/duplicates", status: http.StatusOK},
+		{name: "merge book into itself", method: "POST", path: "/books/merge", data: []byte(`{"Target":` + target + `,"Sources":[` + target + `]}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "merge missing v2 books", method: "POST", path: "/v2/books/merge", data: []byte(`{"target":` + target + `,"sources":[0]}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "merge books without staff token", method: "POST", path: "/v2/books/merge", data: []byte(`{"target":` + target + `,"sources":[0]}`), status: http.StatusUnauthorized},
+		{name: "merge books", method: "POST", path: "/books/merge", data: []byte(`{"Target":` + target + `,"Sources":[` + source + `]}`), headers: staff, status: http.StatusOK},
+		{name: "get merged book", method: "GET", path: "/book/" + source, status: http.StatusOK},
+		{name: "add author", method: "POST", path: "/authors", data: []byte(`{"Name":"Ursula K. Le Guin"}`), status: http.StatusCreated},
+		{name: "add invalid author", method: "POST", path: "/authors", data: []byte(`{}`), status: http.StatusUnprocessableEntity},
+		{name: "list authors", method: "GET", path: "/authors?name=Le%20Guin", status: http.StatusOK},
+		{name: "list v2 authors", method: "GET", path: "/v2/authors?limit=1", status: http.StatusOK},
+		{name: "get author", method: "GET", path: "/authors/" + author, status: http.StatusOK},
+		{name: "get missing author", method: "GET", path: "/authors/0", status: http.StatusNotFound},
+		{name: "rename v2 author", method: "PUT", path: "/v2/authors/" + author, data: []byte(`{"name":"Ursula Le Guin"}`), status: http.StatusOK},
+		{name: "credit authors", method: "PUT", path: "/book/" + target + "/authors", data: []byte(credits), status: http.StatusOK},
+		{name: "credit author twice", method: "PUT", path: "/book/" + target + "/authors", data: []byte(`{"Credits":[{"AuthorId":` + author + `,"Role":"author"},{"AuthorId":` + author + `,"Role":"author"}]}`), status: http.StatusUnprocessableEntity},
+		{name: "credit missing v2 author", method: "PUT", path: "/v2/book/" + target + "/authors", data: []byte(`{"credits":[{"authorId":0,"role":"editor"}]}`), status: http.StatusUnprocessableEntity},
+		{name: "credit authors of missing book", method: "PUT", path: "/book/0/authors", data: []byte(credits), status: http.StatusNotFound},
+		{name: "list v2 credits", method: "GET", path: "/v2/book/" + target + "/authors", status: http.StatusOK},
+		{name: "list books of author", method: "GET", path: "/authors/" + author + "/books", status: http.StatusOK},
+		{name: "delete credited author", method: "DELETE", path: "/authors/" + author, status: http.StatusConflict},
+		{name: "delete author", method: "DELETE", path: "/v2/authors/" + spare, status: http.StatusNoContent},
+		{name: "add series", method: "POST", path: "/series", data: []byte(`{"Name":"Discworld"}`), status: http.StatusCreated},
+		{name: "add invalid v2 series", method: "POST", path: "/v2/series", data: []byte(`{"name":""}`), status: http.StatusUnprocessableEntity},
+		{name: "list series", method: "GET", path: "/series?name=Earth", status: http.StatusOK},
+		{name: "rename v2 series", method: "PUT", path: "/v2/series/" + series, data: []byte(`{"name":"The Earthsea Cycle"}`), status: http.StatusOK},
+		{name: "get missing series", method: "GET", path: "/series/0", status: http.StatusNotFound},
+		{name: "set books of series", method: "PUT", path: "/series/" + series + "/books", data: []byte(`{"Books":[` + first + `,` + second + `]}`), status: http.StatusOK},
+		{name: "set missing books of series", method: "PUT", path: "/series/" + series + "/books", data: []byte(`{"Books":[0]}`), status: http.StatusUnprocessableEntity},
+		{name: "add v2 book to series", method: "POST", path: "/v2/series/" + series + "/books", data: []byte(`{"bookId":` + target + `,"position":1}`), status: http.StatusOK},
+		{name: "list books of series", method: "GET", path: "/series/" + series + "/books", status: http.StatusOK},
+		{name: "get book with series", method: "GET", path: "/book/" + first + "?expand=series", status: http.StatusOK},
+		{name: "get v2 book with series", method: "GET", path: "/v2/book/" + second + "?expand=series", status: http.StatusOK},
+		{name: "get book with unknown expansion", method: "GET", path: "/book/" + first + "?expand=shelves", status: http.StatusBadRequest},
+		{name: "remove book from series", method: "DELETE", path: "/series/" + series + "/books/" + target, status: http.StatusNoContent},
+		{name: "remove book not in series", method: "DELETE", path: "/series/" + series + "/books/" + target, status: http.StatusNotFound},
+		{name: "add collection", method: "POST", path: "/collections", data: []byte(`{"Name":"Staff picks","Description":"Read by the staff this year"}`), status: http.StatusCreated},
+		{name: "add collection with a long description", method: "POST", path: "/v2/collections", data: []byte(`{"name":"Reading list","description":"` + strings.Repeat("Earthsea ", 200) + `"}`), status: http.StatusCreated},
+		{name: "add collection with too long a description", method: "POST", path: "/collections", data: []byte(`{"Name":"Reading list","Description":"` + strings.Repeat("Earthsea ", 250) + `"}`), status: http.StatusUnprocessableEntity},
+		{name: "add collection of unknown kind", method: "POST", path: "/v2/collections", data: []byte(`{"name":"B2","kind":"room"}`), status: http.StatusUnprocessableEntity},
+		{name: "list shelves", method: "GET", path: "/v2/collections?kind=shelf", status: http.StatusOK},
+		{name: "list collections of unknown kind", method: "GET", path: "/collections?kind=room", status: http.StatusBadRequest},
+		{name: "add book to shelf", method: "POST", path: "/collections/" + shelf + "/books", data: []byte(`{"BookId":` + first + `}`), status: http.StatusOK},
+		{name: "list v2 books of shelf", method: "GET", path: "/v2/collections/" + shelf + "/books", status: http.StatusOK},
+		{name: "remove book from shelf", method: "DELETE", path: "/collections/" + shelf + "/books/" + first, status: http.StatusNoContent},
+		{name: "delete shelf", method: "DELETE", path: "/collections/" + shelf, status: http.StatusNoContent},
+		{name: "delete series", method: "DELETE", path: "/series/" + series, status: http.StatusNoContent},
+		{name: "add subject", method: "POST", path: "/subjects", data: []byte(`{"Name":"High Fantasy","ParentId":` + fantasy + `}`), status: http.StatusCreated},
+		{name: "add v2 subject with code", method: "POST", path: "/v2/subjects", data: []byte(`{"name":"Poetry","code":"` + code + `"}`), status: http.StatusCreated},
+		{name: "add subject with repeated code", method: "POST", path: "/subjects", data: []byte(`{"Name":"American poetry","Code":"` + code + `"}`), status: http.StatusUnprocessableEntity},
+		{name: "add subject under missing parent", method: "POST", path: "/subjects", data: []byte(`{"Name":"Poetry","ParentId":-1}`), status: http.StatusUnprocessableEntity},
+		{name: "get subject tree", method: "GET", path: "/subjects", status: http.StatusOK},
+		{name: "get v2 subject tree", method: "GET", path: "/v2/subjects", status: http.StatusOK},
+		{name: "get subject", method: "GET", path: "/subjects/" + fiction, status: http.StatusOK},
+		{name: "get missing subject", method: "GET", path: "/v2/subjects/0", status: http.StatusNotFound},
+		{name: "move subject below itself", method: "PUT", path: "/subjects/" + fiction, data: []byte(`{"Name":"Fiction","ParentId":` + fantasy + `}`), status: http.StatusUnprocessableEntity},
+		{name: "rename v2 subject", method: "PUT", path: "/v2/subjects/" + fantasy, data: []byte(`{"name":"Fantasy fiction","parentId":` + fiction + `}`), status: http.StatusOK},
+		{name: "tag book", method: "PUT", path: "/book/" + first + "/subjects", data: []byte(`{"Subjects":[` + fantasy + `]}`), status: http.StatusOK},
+		{name: "tag book with missing subject", method: "PUT", path: "/v2/book/" + first + "/subjects", data: []byte(`{"subjects":[0]}`), status: http.StatusUnprocessableEntity},
+		{name: "list v2 subjects of book", method: "GET", path: "/v2/book/" + first + "/subjects", status: http.StatusOK},
+		{name: "list books by subject", method: "GET", path: "/books?subject=" + fiction, status: http.StatusOK},
+		{name: "list v2 books by subject", method: "GET", path: "/v2/books?subject=" + fantasy + "&limit=10", status: http.StatusOK},
+		{name: "list books by bad subject", method: "GET", path: "/books?subject=fiction", status: http.StatusBadRequest},
+		{name: "delete subject with subjects below it", method: "DELETE", path: "/subjects/" + fiction, status: http.StatusConflict},
+		{name: "import subjects", method: "POST", path: "/subjects/import?format=dewey", data: []byte("800 Literature\n820 English literature\n823 English fiction\n"), headers: plainText, status: http.StatusOK},
+		{name: "import v2 subjects", method: "POST", path: "/v2/subjects/import?format=bisac", data: []byte("FIC000000 FICTION / General\nFIC009000 FICTION / Fantasy / General\n"), headers: plainText, status: http.StatusOK},
+		{name: "import subjects of unknown format", method: "POST", path: "/subjects/import?format=udc", data: []byte("8 Literature"), headers: plainText, status: http.StatusBadRequest},
+		{name: "import malformed subjects", method: "POST", path: "/subjects/import?format=dewey", data: []byte("Literature\n"), headers: plainText, status: http.StatusUnprocessableEntity},
+		{name: "upload cover", method: "PUT", path: "/book/" + first + "/cover", data: cover.Bytes(), headers: pngImage, status: http.StatusOK},
+		{name: "upload v2 cover which is not an image", method: "PUT", path: "/v2/book/" + first + "/cover", data: []byte("cover"), headers: pngImage, status: http.StatusUnsupportedMediaType},
+		{name: "get cover", method: "GET", path: "/book/" + first + "/cover", status: http.StatusOK},
+		{name: "get v2 cover thumbnail", method: "GET", path: "/v2/book/" + first + "/cover?size=medium", status: http.StatusOK},
+		{name: "get cover of unknown size", method: "GET", path: "/v2/book/" + first + "/cover?size=poster", status: http.StatusBadRequest},
+		{name: "get missing cover", method: "GET", path: "/book/" + second + "/cover", status: http.StatusNotFound},
+		{name: "delete v2 cover", method: "DELETE", path: "/v2/book/" + first + "/cover", status: http.StatusNoContent},
+		{name: "read metadata of edition", method: "POST", path: "/attachments/metadata", data: edition.Bytes(), headers: epub, status: http.StatusOK},
+		{name: "upload edition", method: "POST", path: "/book/" + first + "/attachments", data: edition.Bytes(), headers: epub, status: http.StatusCreated},
+		{name: "upload v2 edition which is not an EPUB", method: "POST", path: "/v2/book/" + first + "/attachments", data: []byte("%PDF-1.7"), headers: epub, status: http.StatusUnsupportedMediaType},
+		{name: "list v2 attachments", method: "GET", path: "/v2/book/" + first + "/attachments", status: http.StatusOK},
+		{name: "get missing attachment", method: "GET", path: "/book/" + second + "/attachments/0", status: http.StatusNotFound},
+		{name: "lend edition to missing member", method: "POST", path: "/v2/book/" + first + "/digital-loans", data: []byte(`{"memberId":0}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "lend edition signed out", method: "POST", path: "/book/" + first + "/digital-loans", data: []byte(`{"MemberId":1}`), status: http.StatusUnauthorized},
+		{name: "get missing digital loan", method: "GET", path: "/digital-loans/0", headers: staff, status: http.StatusNotFound},
+		{name: "get digital loan signed out", method: "GET", path: "/v2/digital-loans/0", status: http.StatusUnauthorized},
+		{name: "add copy", method: "POST", path: "/book/" + first + "/copies", data: []byte(`{"Barcode":"` + barcode + `","ItemType":"dvd"}`), headers: staff, status: http.StatusCreated},
+		{name: "add v2 copy with a barcode taken", method: "POST", path: "/v2/book/" + second + "/copies", data: []byte(`{"barcode":"` + barcode + `"}`), headers: staff, status: http.StatusConflict},
+		{name: "add copy without staff token", method: "POST", path: "/book/" + first + "/copies", data: []byte(`{"Barcode":"B1"}`), status: http.StatusUnauthorized},
+		{name: "add copy of missing book", method: "POST", path: "/v2/book/0/copies", data: []byte(`{"barcode":"B1"}`), headers: staff, status: http.StatusNotFound},
+		{name: "list v2 copies of book", method: "GET", path: "/v2/book/" + first + "/copies", status: http.StatusOK},
+		{name: "get missing copy", method: "GET", path: "/copies/0", status: http.StatusNotFound},
+		{name: "update missing copy", method: "PUT", path: "/v2/copies/0", data: []byte(`{"barcode":"B1"}`), headers: staff, status: http.StatusNotFound},
+		{name: "update copy without staff token", method: "PUT", path: "/copies/0", data: []byte(`{"Barcode":"B1"}`), status: http.StatusUnauthorized},
+		{name: "check out missing copy", method: "POST", path: "/loans", data: []byte(`{"CopyId":0,"MemberId":0}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "get missing loan", method: "GET", path: "/v2/loans/0", headers: staff, status: http.StatusNotFound},
+		{name: "check out without staff token", method: "POST", path: "/v2/loans", data: []byte(`{"copyId":0,"memberId":0}`), status: http.StatusUnauthorized},
+		{name: "get loan signed out", method: "GET", path: "/loans/0", status: http.StatusUnauthorized},
+		{name: "renew loan signed out", method: "POST", path: "/v2/loans/0/renew", status: http.StatusUnauthorized},
+		{name: "return loan without staff token", method: "POST", path: "/loans/0/return", status: http.StatusUnauthorized},
+		{name: "renew missing loan", method: "POST", path: "/loans/0/renew", headers: staff, status: http.StatusNotFound},
+		{name: "return missing loan", method: "POST", path: "/v2/loans/0/return", headers: staff, status: http.StatusNotFound},
+		{name: "list members", method: "GET", path: "/v2/members?name=Tenar&limit=10", headers: staff, status: http.StatusOK},
+		{name: "get missing member", method: "GET", path: "/members/0", headers: staff, status: http.StatusNotFound},
+		{name: "get account of missing member", method: "GET", path: "/members/0/account", headers: staff, status: http.StatusNotFound},
+		{name: "pay by missing member", method: "POST", path: "/v2/members/0/payments", data: []byte(`{"amount":100}`), headers: staff, status: http.StatusNotFound},
+		{name: "get preferences of missing member", method: "GET", path: "/members/0/preferences", headers: staff, status: http.StatusNotFound},
+		{name: "set preferences of missing member", method: "PUT", path: "/v2/members/0/preferences", data: []byte(`{"dueSoon":true}`), headers: staff, status: http.StatusNotFound},
+		{name: "list notifications of missing member", method: "GET", path: "/v2/members/0/notifications", headers: staff, status: http.StatusNotFound},
+		{name: "list members without staff token", method: "GET", path: "/members", status: http.StatusUnauthorized},
+		{name: "get member signed out", method: "GET", path: "/v2/members/0", status: http.StatusUnauthorized},
+		{name: "get account signed out", method: "GET", path: "/members/0/account", status: http.StatusUnauthorized},
+		{name: "pay without staff token", method: "POST", path: "/members/0/payments", data: []byte(`{"Amount":100}`), status: http.StatusUnauthorized},
+		{name: "get preferences signed out", method: "GET", path: "/v2/members/0/preferences", status: http.StatusUnauthorized},
+		{name: "set preferences signed out", method: "PUT", path: "/members/0/preferences", data: []byte(`{"DueSoon":true}`), status: http.StatusUnauthorized},
+		{name: "list notifications signed out", method: "GET", path: "/members/0/notifications", status: http.StatusUnauthorized},
+		{name: "register with short password", method: "POST", path: "/register", data: []byte(`{"Name":"Ged","Email":"ged@roke.example","Password":"short"}`), status: http.StatusUnprocessableEntity},
+		{name: "register with bad email", method: "POST", path: "/v2/register", data: []byte(`{"name":"Ged","email":"Ged <ged@roke.example>","password":"truename"}`), status: http.StatusUnprocessableEntity},
+		{name: "verify email with unknown token", method: "POST", path: "/verify-email", data: []byte(`{"Token":"unknown"}`), status: http.StatusUnprocessableEntity},
+		{name: "log in with bad credentials", method: "POST", path: "/login", data: []byte(`{"Email":"nobody@roke.example","Password":"truename"}`), status: http.StatusUnauthorized},
+		{name: "log in malformed", method: "POST", path: "/v2/login", data: []byte(`{"email":`), status: http.StatusBadRequest},
+		{name: "log out without session", method: "POST", path: "/logout", status: http.StatusNoContent},
+		{name: "reset password of unknown email", method: "POST", path: "/v2/password-reset", data: []byte(`{"email":"nobody@roke.example"}`), status: http.StatusAccepted},
+		{name: "confirm password reset with unknown token", method: "POST", path: "/password-reset/confirm", data: []byte(`{"Token":"unknown","Password":"truename"}`), status: http.StatusUnprocessableEntity},
+		{name: "get me signed out", method: "GET", path: "/me", status: http.StatusUnauthorized},
+		{name: "list my loans with bad session", method: "GET", path: "/v2/me/loans", headers: map[string]string{"Authorization": "Bearer unknown"}, status: http.StatusUnauthorized},
+		{name: "list my loans with bad flag", method: "GET", path: "/me/loans?current=maybe", status: http.StatusBadRequest},
+		{name: "place hold signed out", method: "POST", path: "/me/holds", data: []byte(`{"BookId":1}`), status: http.StatusUnauthorized},
+		{name: "set my preferences signed out", method: "PUT", path: "/v2/me/preferences", data: []byte(`{"dueSoon":true}`), status: http.StatusUnauthorized},
+		{name: "download without signature", method: "GET", path: "/downloads/1?member=1&expires=4102444800", status: http.StatusForbidden},
+		{name: "add webhook", method: "POST", path: "/webhooks", data: []byte(`{"Url":"https://hooks.example/hook","Events":["book.created"]}`), headers: staff, status: http.StatusCreated},
+		{name: "add webhook for unknown event", method: "POST", path: "/webhooks", data: []byte(`{"Url":"https://hooks.example/hook","Events":["book.read"]}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "add webhook for localhost", method: "POST", path: "/webhooks", data: []byte(`{"Url":"http://localhost:1/hook","Events":["book.created"]}`), headers: staff, status: http.StatusUnprocessableEntity},
+		{name: "add webhook without staff token", method: "POST", path: "/webhooks", data: []byte(`{"Url":"https://hooks.example/hook","Events":["book.created"]}`), status: http.StatusUnauthorized},
+		{name: "list webhooks", method: "GET", path: "/webhooks", headers: staff, status: http.StatusOK},
+		{name: "list webhooks without staff token", method: "GET", path: "/webhooks", status: http.StatusUnauthorized},
+		{name: "get missing webhook", method: "GET", path: "/webhooks/0", headers: staff, status: http.StatusNotFound},
+		{name: "list deliveries of missing webhook", method: "GET", path: "/webhooks/0/deliveries", headers: staff, status: http.StatusNotFound},
+		{name: "redeliver without staff token", method: "POST", path: "/webhooks/0/deliveries/0/redeliver", status: http.StatusUnauthorized},
+		{name: "list jobs", method: "GET", path: "/admin/jobs", headers: staff, status: http.StatusOK},
+		{name: "run job", method: "POST", path: "/admin/jobs/purge/run", headers: staff, status: http.StatusOK},
+		{name: "list jobs without staff token", method: "GET", path: "/admin/jobs", status: http.StatusUnauthorized},
+		{name: "run job without staff token", method: "POST", path: "/admin/jobs/purge/run", status: http.StatusUnauthorized},
+		{name: "run missing job", method: "POST", path: "/admin/jobs/reindex/run", headers: staff, status: http.StatusNotFound},
+		{name: "specification", method: "GET", path: "/openapi.json", status: http.StatusOK},
+		{name: "documentation", method: "GET", path: "/docs", status: http.StatusOK},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			r, _ := http.NewRequest(scenario.method, server.URL+scenario.path, bytes.NewBuffer(scenario.data))
+			for name, value := range scenario.headers {
+				r.Header.Set(name, value)
+			}
+			response, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer response.Body.Close()
+			body, _ := ioutil.ReadAll(response.Body)
+
+			if response.StatusCode != scenario.status {
+				t.Errorf("Expected status code: %v, got %v", scenario.status, response.StatusCode)
+			}
+			path := strings.Split(scenario.path, "?")[0]
+			for _, violation := range openapi.ValidateResponse(scenario.method, path, response.StatusCode, response.Header, body) {
+				t.Errorf("Response does not match specification: %v %v", violation.Field, violation.Message)
+			}
+		})
+	}
+}
+
+func addBook(t *testing.T, url string) domain.Book {
+	r, _ := http.NewRequest("POST", url+"/book", bytes.NewBufferString(`{"Name":"Book","Author":"Author"}`))
+	r.Header.Set("Authorization", "Bearer "+routerStaffToken)
+	response, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("Could not add book: %v", err)
+	}
+	defer response.Body.Close()
+
+	var book domain.Book
+	_ = json.NewDecoder(response.Body).Decode(&book)
+	return book
+}
+
+func addAuthor(t *testing.T, url string) domain.Author {
+	response, err := http.Post(url+"/authors", "application/json", bytes.NewBufferString(`{"Name":"Author"}`))
+	if err != nil {
+		t.Fatalf("Could not add author: %v", err)
+	}
+	defer response.Body.Close()
+
+	var author domain.Author
+	_ = json.NewDecoder(response.Body).Decode(&author)
+	return author
+}
+
+// addAt posts data to path, adding a series, a collection or a subject, and returns the
+// id of what was added.
+func addAt(t *testing.T, url string, path string, data string) string {
+	response, err := http.Post(url+path, "application/json", bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatalf("Could not add %v: %v", path, err)
+	}
+	defer response.Body.Close()
+
+	var added struct{ Id int64 }
+	_ = json.NewDecoder(response.Body).Decode(&added)
+	return strconv.FormatInt(added.Id, 10)
+}
@@ -0,0 +1,518 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/blobs"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/editions"
+	"go-rest-webservices-book-library/repository"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AttachmentsRepository struct{}
+
+// AttachmentsRepositoryInterface keeps the digital editions of books and the digital
+// loans which let members download them.
+type AttachmentsRepositoryInterface interface {
+	addAttachment(attachment domain.Attachment) (int64, error)
+	getAttachment(id int64) (*domain.Attachment, error)
+	getAttachments(bookId int64) ([]domain.Attachment, error)
+	deleteAttachment(id int64) error
+	addDigitalLoan(loan domain.DigitalLoan) (int64, error)
+	getDigitalLoan(id int64) (*domain.DigitalLoan, error)
+	getActiveDigitalLoan(bookId int64, memberId int64, now time.Time) (*domain.DigitalLoan, error)
+	returnDigitalLoan(id int64, returnedAt time.Time) (bool, error)
+}
+
+var attachmentsRepository AttachmentsRepositoryInterface = AttachmentsRepository{}
+
+// downloadSigningKey signs download links. Without attachments.signingKey in config.yml
+// a key is made up at start, and links then stop working when the server restarts.
+var downloadSigningKey = newDownloadSigningKey()
+
+func (a AttachmentsRepository) addAttachment(attachment domain.Attachment) (int64, error) {
+	return repository.AddAttachment(attachment)
+}
+
+func (a AttachmentsRepository) getAttachment(id int64) (*domain.Attachment, error) {
+	return repository.GetAttachment(id)
+}
+
+func (a AttachmentsRepository) getAttachments(bookId int64) ([]domain.Attachment, error) {
+	return repository.GetAttachments(bookId)
+}
+
+func (a AttachmentsRepository) deleteAttachment(id int64) error {
+	return repository.DeleteAttachment(id)
+}
+
+func (a AttachmentsRepository) addDigitalLoan(loan domain.DigitalLoan) (int64, error) {
+	return repository.AddDigitalLoan(loan)
+}
+
+func (a AttachmentsRepository) getDigitalLoan(id int64) (*domain.DigitalLoan, error) {
+	return repository.GetDigitalLoan(id)
+}
+
+func (a AttachmentsRepository) getActiveDigitalLoan(bookId int64, memberId int64, now time.Time) (*domain.DigitalLoan, error) {
+	return repository.GetActiveDigitalLoan(bookId, memberId, now)
+}
+
+func (a AttachmentsRepository) returnDigitalLoan(id int64, returnedAt time.Time) (bool, error) {
+	return repository.ReturnDigitalLoan(id, returnedAt)
+}
+
+// AttachmentsHandler lists the digital editions of a book on GET and adds one on POST,
+// from the EPUB or PDF file in the body. The metadata of an EPUB is compared with the
+// record of the book, and the fields on which they disagree are returned with it.
+func AttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	book, found := findBook(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		attachments, getErr := attachmentsRepository.getAttachments(book.Id)
+		if getErr != nil {
+			logger.Error("Error while getting attachments of book: " + strconv.FormatInt(book.Id, 10) + " with error: " + getErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Attachments(attachments)))
+	case "POST":
+		addAttachmentHandler(w, r, mapper, book)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func addAttachmentHandler(w http.ResponseWriter, r *http.Request, mapper dto.Mapper, book domain.Book) {
+	data, contentType, metadata, ok := readEdition(w, r, mapper)
+	if !ok {
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := domain.Attachment{
+		BookId:      book.Id,
+		Format:      editions.Format(contentType),
+		ContentType: contentType,
+		Digest:      hex.EncodeToString(sum[:]),
+		Bytes:       int64(len(data)),
+		Metadata:    metadata,
+		UploadedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	id, addErr := attachmentsRepository.addAttachment(attachment)
+	if addErr != nil {
+		logger.Error("Error while adding attachment to book: " + strconv.FormatInt(book.Id, 10) + " with error: " + addErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	attachment.Id = id
+
+	putErr := blobStore.Put(r.Context(), attachmentKey(attachment), blobs.Blob{Data: data, ContentType: contentType})
+	if putErr != nil {
+		logger.Error("Error while storing attachment: " + strconv.FormatInt(id, 10) + " with error: " + putErr.Error())
+		_ = attachmentsRepository.deleteAttachment(id)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully added attachment: " + strconv.FormatInt(id, 10) + " to book: " + strconv.FormatInt(book.Id, 10))
+	w.WriteHeader(http.StatusCreated)
+	upload := domain.AttachmentUpload{Attachment: attachment, Mismatches: editions.Compare(book, metadata)}
+	_, _ = fmt.Fprint(w, getString(mapper.AttachmentUpload(upload)))
+}
+
+// AttachmentHandler writes the description of a digital edition on GET and deletes it on
+// DELETE. The file itself is only served through download links.
+func AttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	attachment, found := findAttachment(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Attachment(attachment)))
+	case "DELETE":
+		if deleteErr := attachmentsRepository.deleteAttachment(attachment.Id); deleteErr != nil {
+			logger.Error("Error while deleting attachment: " + strconv.FormatInt(attachment.Id, 10) + " with error: " + deleteErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if deleteErr := blobStore.Delete(r.Context(), attachmentKey(attachment)); deleteErr != nil {
+			logger.Error("Error while deleting blob of attachment: " + strconv.FormatInt(attachment.Id, 10) + " with error: " + deleteErr.Error())
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// EditionMetadataHandler reads the metadata of the EPUB in the body without storing it,
+// so that a new book can be prefilled from its digital edition.
+func EditionMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	_, _, metadata, ok := readEdition(w, r, mapper)
+	if !ok {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.EditionMetadata(metadata)))
+}
+
+// AttachmentLinkHandler returns a link the member in the body can download a digital
+// edition from for the next attachments.linkTtl, provided they have a digital loan of its
+// book. Members only get links for themselves, staff for anyone.
+func AttachmentLinkHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	requestCaller, signedIn := signedInCaller(w, r)
+	if !signedIn {
+		return
+	}
+	attachment, found := findAttachment(w, r)
+	if !found {
+		return
+	}
+
+	input := mapper.NewBorrowerInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for download link: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	memberId := input.Borrower()
+	if !authorizeFor(w, r, requestCaller, memberId) {
+		return
+	}
+
+	now := time.Now()
+	loan, getErr := attachmentsRepository.getActiveDigitalLoan(attachment.BookId, memberId, now)
+	if getErr != nil {
+		logger.Error("Error while getting digital loan of book: " + strconv.FormatInt(attachment.BookId, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if loan == nil {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusForbidden, Message: "member has no digital loan of the book"})
+		return
+	}
+
+	expiresAt := now.Add(config.DownloadLinkTtl).UTC().Truncate(time.Second)
+	if loan.DueAt.Before(expiresAt) {
+		expiresAt = loan.DueAt.UTC().Truncate(time.Second)
+	}
+	link := domain.DownloadLink{Url: downloadUrl(attachment.Id, memberId, expiresAt), ExpiresAt: expiresAt}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.DownloadLink(link)))
+}
+
+// DownloadHandler serves a digital edition to the holder of a signed download link, with
+// range requests so that readers can resume and page through large files. The loan is
+// checked again, so returning a book ends its links too.
+func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	attachmentId, idErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	memberId, memberErr := strconv.ParseInt(query.Get("member"), 10, 64)
+	expires, expiresErr := strconv.ParseInt(query.Get("expires"), 10, 64)
+	now := time.Now()
+	if idErr != nil || memberErr != nil || expiresErr != nil ||
+		!hmac.Equal([]byte(query.Get("signature")), []byte(downloadSignature(attachmentId, memberId, expires))) {
+		writeDownloadError(w, r, "download link is invalid")
+		return
+	}
+	if now.Unix() >= expires {
+		writeDownloadError(w, r, "download link has expired")
+		return
+	}
+
+	attachment, getErr := attachmentsRepository.getAttachment(attachmentId)
+	if getErr != nil {
+		logger.Error("Error while getting attachment: " + strconv.FormatInt(attachmentId, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if attachment == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	loan, getErr := attachmentsRepository.getActiveDigitalLoan(attachment.BookId, memberId, now)
+	if getErr != nil {
+		logger.Error("Error while getting digital loan of book: " + strconv.FormatInt(attachment.BookId, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if loan == nil {
+		writeDownloadError(w, r, "member has no digital loan of the book")
+		return
+	}
+
+	// Readers page through large editions with range requests, only the range is read.
+	content, openErr := blobStore.Open(r.Context(), attachmentKey(*attachment))
+	if openErr != nil {
+		logger.Error("Error while reading attachment: " + strconv.FormatInt(attachmentId, 10) + " with error: " + openErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	fileName := "book-" + strconv.FormatInt(attachment.BookId, 10) + "." + attachment.Format
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("ETag", `"`+attachment.Digest+`"`)
+	http.ServeContent(w, r, "", attachment.UploadedAt, content)
+}
+
+// DigitalLoansHandler lends the digital editions of a book to the member in the body for
+// attachments.loanPeriod. A member keeps a single loan of a book at a time, and members
+// only borrow for themselves.
+func DigitalLoansHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	requestCaller, signedIn := signedInCaller(w, r)
+	if !signedIn {
+		return
+	}
+	book, found := findBook(w, r)
+	if !found {
+		return
+	}
+
+	input := mapper.NewBorrowerInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for digital loan: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	memberId := input.Borrower()
+	if !authorizeFor(w, r, requestCaller, memberId) {
+		return
+	}
+
+	members, getErr := circulationRepository.getMembersByIds([]int64{memberId})
+	var attachments []domain.Attachment
+	var active *domain.DigitalLoan
+	now := time.Now().UTC().Truncate(time.Second)
+	if getErr == nil {
+		attachments, getErr = attachmentsRepository.getAttachments(book.Id)
+	}
+	if getErr == nil {
+		active, getErr = attachmentsRepository.getActiveDigitalLoan(book.Id, memberId, now)
+	}
+	if getErr != nil {
+		logger.Error("Error while lending book: " + strconv.FormatInt(book.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case len(members) == 0:
+		decodeErr := &decoder.Error{Status: http.StatusUnprocessableEntity}
+		writeApiError(w, mapper, decodeErr.Add("MemberId", "must be an existing member").ApiError())
+		return
+	case len(attachments) == 0:
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: "book has no digital edition"})
+		return
+	case active != nil:
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: "member already has a digital loan of the book"})
+		return
+	}
+
+	loan := domain.DigitalLoan{BookId: book.Id, MemberId: memberId, LoanedAt: now, DueAt: now.Add(config.DigitalLoanPeriod)}
+	id, addErr := attachmentsRepository.addDigitalLoan(loan)
+	if addErr != nil {
+		logger.Error("Error while lending book: " + strconv.FormatInt(book.Id, 10) + " with error: " + addErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	loan.Id = id
+	logger.Info("Successfully lent book: " + strconv.FormatInt(book.Id, 10) + " to member: " + strconv.FormatInt(memberId, 10))
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(mapper.DigitalLoan(loan)))
+}
+
+// DigitalLoanHandler writes a digital loan on GET, and returns it early on DELETE, for
+// staff or the member it was lent to.
+func DigitalLoanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	requestCaller, signedIn := signedInCaller(w, r)
+	if !signedIn {
+		return
+	}
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var loan *domain.DigitalLoan
+	var getErr error
+	if parseErr == nil {
+		loan, getErr = attachmentsRepository.getDigitalLoan(id)
+	}
+	if getErr != nil {
+		logger.Error("Error while getting digital loan: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if loan == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !authorizeFor(w, r, requestCaller, loan.MemberId) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.DigitalLoan(*loan)))
+	case "DELETE":
+		returned, returnErr := attachmentsRepository.returnDigitalLoan(loan.Id, time.Now())
+		if returnErr != nil {
+			logger.Error("Error while returning digital loan: " + mux.Vars(r)["id"] + " with error: " + returnErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !returned {
+			writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: "digital loan was already returned"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// readEdition reads and checks the EPUB or PDF file in the body of r, writing the error
+// response when it is refused.
+func readEdition(w http.ResponseWriter, r *http.Request, mapper dto.Mapper) ([]byte, string, domain.EditionMetadata, bool) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if editions.Format(contentType) == "" {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusUnsupportedMediaType, Message: editions.ErrUnsupported.Error()})
+		return nil, "", domain.EditionMetadata{}, false
+	}
+
+	data, readErr := ioutil.ReadAll(io.LimitReader(r.Body, config.AttachmentMaxBytes+1))
+	if readErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, "", domain.EditionMetadata{}, false
+	}
+	if int64(len(data)) > config.AttachmentMaxBytes {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: "edition exceeds " + strconv.FormatInt(config.AttachmentMaxBytes, 10) + " bytes",
+		})
+		return nil, "", domain.EditionMetadata{}, false
+	}
+
+	metadata, readErr := editions.Read(data, contentType)
+	if readErr == editions.ErrMismatch {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusUnsupportedMediaType, Message: readErr.Error()})
+		return nil, "", domain.EditionMetadata{}, false
+	}
+	if readErr != nil {
+		logger.Error("Improper edition passed: " + readErr.Error())
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "body", Message: "must be a readable edition: " + readErr.Error()}},
+		})
+		return nil, "", domain.EditionMetadata{}, false
+	}
+	return data, contentType, metadata, true
+}
+
+func findBook(w http.ResponseWriter, r *http.Request) (domain.Book, bool) {
+	id := mux.Vars(r)["id"]
+	books, getErr := booksRepository.getBook(id)
+	if getErr != nil {
+		logger.Error("Error while getting book: " + id + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Book{}, false
+	}
+	if len(books) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Book{}, false
+	}
+	return books[0], true
+}
+
+// findAttachment returns the attachment named by the path, which must belong to the
+// book the path names.
+func findAttachment(w http.ResponseWriter, r *http.Request) (domain.Attachment, bool) {
+	book, found := findBook(w, r)
+	if !found {
+		return domain.Attachment{}, false
+	}
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["attachmentId"], 10, 64)
+	var attachment *domain.Attachment
+	var getErr error
+	if parseErr == nil {
+		attachment, getErr = attachmentsRepository.getAttachment(id)
+	}
+	if getErr != nil {
+		logger.Error("Error while getting attachment: " + mux.Vars(r)["attachmentId"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Attachment{}, false
+	}
+	if attachment == nil || attachment.BookId != book.Id {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Attachment{}, false
+	}
+	return *attachment, true
+}
+
+func writeDownloadError(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	writeApiError(w, dto.FromRequest(r), domain.ApiError{Status: http.StatusForbidden, Message: message})
+}
+
+// attachmentKey names the blob of an attachment, below its id which stays the same when
+// its book is merged into another.
+func attachmentKey(attachment domain.Attachment) string {
+	return "attachments/" + strconv.FormatInt(attachment.Id, 10) + "/" + attachment.Digest + "." + attachment.Format
+}
+
+func downloadUrl(attachmentId int64, memberId int64, expiresAt time.Time) string {
+	expires := expiresAt.Unix()
+	return "/downloads/" + strconv.FormatInt(attachmentId, 10) +
+		"?member=" + strconv.FormatInt(memberId, 10) +
+		"&expires=" + strconv.FormatInt(expires, 10) +
+		"&signature=" + downloadSignature(attachmentId, memberId, expires)
+}
+
+func downloadSignature(attachmentId int64, memberId int64, expires int64) string {
+	mac := hmac.New(sha256.New, downloadSigningKey)
+	_, _ = fmt.Fprintf(mac, "%d:%d:%d", attachmentId, memberId, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDownloadSigningKey() []byte {
+	if config.DownloadSigningKey != "" {
+		return []byte(config.DownloadSigningKey)
+	}
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/blobs"
+	"go-rest-webservices-book-library/domain"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// attachmentsRepositoryMock keeps the attachments and digital loans it is given in memory.
+type attachmentsRepositoryMock struct {
+	attachments map[int64]domain.Attachment
+	loans       map[int64]domain.DigitalLoan
+}
+
+func newAttachmentsRepositoryMock() attachmentsRepositoryMock {
+	return attachmentsRepositoryMock{attachments: map[int64]domain.Attachment{}, loans: map[int64]domain.DigitalLoan{}}
+}
+
+func (a attachmentsRepositoryMock) addAttachment(attachment domain.Attachment) (int64, error) {
+	attachment.Id = int64(len(a.attachments) + 1)
+	a.attachments[attachment.Id] = attachment
+	return attachment.Id, nil
+}
+
+func (a attachmentsRepositoryMock) getAttachment(id int64) (*domain.Attachment, error) {
+	if attachment, found := a.attachments[id]; found {
+		return &attachment, nil
+	}
+	return nil, nil
+}
+
+func (a attachmentsRepositoryMock) getAttachments(bookId int64) ([]domain.Attachment, error) {
+	attachments := []domain.Attachment{}
+	for _, attachment := range a.attachments {
+		if attachment.BookId == bookId {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return attachments, nil
+}
+
+func (a attachmentsRepositoryMock) deleteAttachment(id int64) error {
+	delete(a.attachments, id)
+	return nil
+}
+
+func (a attachmentsRepositoryMock) addDigitalLoan(loan domain.DigitalLoan) (int64, error) {
+	loan.Id = int64(len(a.loans) + 1)
+	a.loans[loan.Id] = loan
+	return loan.Id, nil
+}
+
+func (a attachmentsRepositoryMock) getDigitalLoan(id int64) (*domain.DigitalLoan, error) {
+	if loan, found := a.loans[id]; found {
+		return &loan, nil
+	}
+	return nil, nil
+}
+
+func (a attachmentsRepositoryMock) getActiveDigitalLoan(bookId int64, memberId int64, now time.Time) (*domain.DigitalLoan, error) {
+	for _, loan := range a.loans {
+		if loan.BookId == bookId && loan.MemberId == memberId && loan.ReturnedAt == nil && loan.DueAt.After(now) {
+			return &loan, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a attachmentsRepositoryMock) returnDigitalLoan(id int64, returnedAt time.Time) (bool, error) {
+	loan, found := a.loans[id]
+	if !found || loan.ReturnedAt != nil {
+		return false, nil
+	}
+	loan.ReturnedAt = &returnedAt
+	a.loans[id] = loan
+	return true, nil
+}
+
+func zipEpub(t *testing.T, title string) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, file := range [][2]string{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<container><rootfiles><rootfile full-path="content.opf"/></rootfiles></container>`},
+		{"content.opf", `<package><metadata><title>` + title + `</title><creator>Author</creator><language>en</language></metadata></package>`},
+	} {
+		writer, _ := archive.Create(file[0])
+		_, _ = writer.Write([]byte(file[1]))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Could not zip EPUB: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestAttachmentHandlers(t *testing.T) {
+	TestSetup(t)
+	attachmentsRepository = newAttachmentsRepositoryMock()
+	blobStore = blobs.NewLocal(t.TempDir())
+	booksRepositoryGetMock = func(id string) ([]domain.Book, error) {
+		if id != "1" {
+			return nil, nil
+		}
+		return []domain.Book{{Id: 1, Name: "Book", Author: "Author"}}, nil
+	}
+	circulationMembersByIdsMock = func(ids []int64) ([]domain.Member, error) {
+		if ids[0] != 1 && ids[0] != 2 {
+			return []domain.Member{}, nil
+		}
+		return []domain.Member{{Id: ids[0], Name: "Member"}}, nil
+	}
+	members := newMembersRepositoryMock()
+	members.credentials[2] = &domain.Credentials{Member: domain.Member{Id: 2, Name: "Tenar", Email: "tenar@atuan.example"}}
+	membersRepository = members
+	staff, member, other := "Bearer "+staffToken, "Bearer "+signIn(t, 1), "Bearer "+signIn(t, 2)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/attachments/metadata", EditionMetadataHandler).Methods("POST")
+	router.HandleFunc("/book/{id}/attachments", AttachmentsHandler).Methods("GET", "POST")
+	router.HandleFunc("/book/{id}/attachments/{attachmentId}", AttachmentHandler).Methods("GET", "DELETE")
+	router.HandleFunc("/book/{id}/attachments/{attachmentId}/link", AttachmentLinkHandler).Methods("POST")
+	router.HandleFunc("/book/{id}/digital-loans", DigitalLoansHandler).Methods("POST")
+	router.HandleFunc("/digital-loans/{id}", DigitalLoanHandler).Methods("GET", "DELETE")
+	router.HandleFunc("/downloads/{id}", DownloadHandler).Methods("GET")
+	serve := func(method string, path string, contentType string, data []byte, headers ...string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(method, path, bytes.NewReader(data))
+		r.Header.Set("Content-Type", contentType)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	epub := zipEpub(t, "Another Book")
+
+	// The scenarios run in order, each one seeing the attachments and loans the ones
+	// before it left, and authorization is the bearer token they are sent with.
+	scenarios := []struct {
+		name          string
+		method        string
+		path          string
+		contentType   string
+		data          []byte
+		authorization string
+		status        int
+	}{
+		{name: "Read metadata of EPUB", method: "POST", path: "/attachments/metadata", contentType: "application/epub+zip", data: epub, status: http.StatusOK},
+		{name: "Upload text", method: "POST", path: "/book/1/attachments", contentType: "text/plain", data: []byte("text"), status: http.StatusUnsupportedMediaType},
+		{name: "Upload PDF declared as EPUB", method: "POST", path: "/book/1/attachments", contentType: "application/epub+zip", data: []byte("%PDF-1.7"), status: http.StatusUnsupportedMediaType},
+		{name: "Upload EPUB to missing book", method: "POST", path: "/book/2/attachments", contentType: "application/epub+zip", data: epub, status: http.StatusNotFound},
+		{name: "Lend book without digital edition", method: "POST", path: "/book/1/digital-loans", contentType: "application/json", data: []byte(`{"MemberId":1}`), authorization: staff, status: http.StatusConflict},
+		{name: "Upload EPUB", method: "POST", path: "/book/1/attachments", contentType: "application/epub+zip", data: epub, status: http.StatusCreated},
+		{name: "List attachments", method: "GET", path: "/book/1/attachments", status: http.StatusOK},
+		{name: "Get attachment of another book", method: "GET", path: "/book/2/attachments/1", status: http.StatusNotFound},
+		{name: "Lend book to missing member", method: "POST", path: "/book/1/digital-loans", contentType: "application/json", data: []byte(`{"MemberId":3}`), authorization: staff, status: http.StatusUnprocessableEntity},
+		{name: "Lend book signed out", method: "POST", path: "/book/1/digital-loans", contentType: "application/json", data: []byte(`{"MemberId":1}`), status: http.StatusUnauthorized},
+		{name: "Lend book in the name of another member", method: "POST", path: "/book/1/digital-loans", contentType: "application/json", data: []byte(`{"MemberId":1}`), authorization: other, status: http.StatusForbidden},
+		{name: "Lend book", method: "POST", path: "/book/1/digital-loans", contentType: "application/json", data: []byte(`{"MemberId":1}`), authorization: staff, status: http.StatusCreated},
+		{name: "Lend book twice", method: "POST", path: "/book/1/digital-loans", contentType: "application/json", data: []byte(`{"MemberId":1}`), authorization: staff, status: http.StatusConflict},
+		{name: "Link attachment for member without loan", method: "POST", path: "/book/1/attachments/1/link", contentType: "application/json", data: []byte(`{"MemberId":2}`), authorization: staff, status: http.StatusForbidden},
+		{name: "Link attachment in the name of another member", method: "POST", path: "/book/1/attachments/1/link", contentType: "application/json", data: []byte(`{"MemberId":1}`), authorization: other, status: http.StatusForbidden},
+		{name: "Get loan", method: "GET", path: "/digital-loans/1", authorization: staff, status: http.StatusOK},
+		{name: "Get own loan", method: "GET", path: "/digital-loans/1", authorization: member, status: http.StatusOK},
+		{name: "Get loan of another member", method: "GET", path: "/digital-loans/1", authorization: other, status: http.StatusForbidden},
+		{name: "Download without signature", method: "GET", path: "/downloads/1?member=1&expires=4102444800", status: http.StatusForbidden},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if w := serve(s.method, s.path, s.contentType, s.data, "Authorization", s.authorization); w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := serve("POST", "/book/1/attachments", "application/epub+zip", epub)
+	var upload domain.AttachmentUpload
+	_ = json.Unmarshal(w.Body.Bytes(), &upload)
+	if len(upload.Mismatches) != 1 || upload.Mismatches[0].Field != "Name" || upload.Attachment.Metadata.Language != "en" {
+		t.Errorf("Expected the title to differ from the name of the book, got %v", w.Body.String())
+	}
+
+	w = serve("POST", "/book/1/attachments/1/link", "application/json", []byte(`{"MemberId":1}`), "Authorization", member)
+	var link domain.DownloadLink
+	if err := json.Unmarshal(w.Body.Bytes(), &link); err != nil || w.Code != http.StatusOK || !strings.HasPrefix(link.Url, "/downloads/1?") {
+		t.Fatalf("Expected a download link, got %v: %v", w.Code, w.Body.String())
+	}
+	if w = serve("GET", link.Url, "", nil); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), epub) {
+		t.Errorf("Expected the EPUB to be downloaded, got %v", w.Code)
+	}
+	if w = serve("GET", link.Url, "", nil, "Range", "bytes=0-9"); w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), epub[:10]) {
+		t.Errorf("Expected the first ten bytes of the EPUB, got %v: %q", w.Code, w.Body.Bytes())
+	}
+	if w = serve("GET", strings.Replace(link.Url, "member=1", "member=2", 1), "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a link signed for another member to be refused, got %v", w.Code)
+	}
+
+	if w = serve("DELETE", "/digital-loans/1", "", nil, "Authorization", other); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a loan not to be returned by another member, got %v", w.Code)
+	}
+	if w = serve("DELETE", "/digital-loans/1", "", nil, "Authorization", member); w.Code != http.StatusNoContent {
+		t.Errorf("Expected loan to be returned, got %v", w.Code)
+	}
+	if w = serve("DELETE", "/digital-loans/1", "", nil, "Authorization", staff); w.Code != http.StatusConflict {
+		t.Errorf("Expected a returned loan not to be returned again, got %v", w.Code)
+	}
+	if w = serve("GET", link.Url, "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected the link to stop working once the loan is returned, got %v", w.Code)
+	}
+	if w = serve("DELETE", "/book/1/attachments/1", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected attachment to be deleted, got %v", w.Code)
+	}
+}
+
+func TestDownloadLinkExpires(t *testing.T) {
+	t.Parallel()
+	expired := downloadUrl(1, 1, time.Now().Add(-time.Minute))
+	r, _ := http.NewRequest("GET", expired, nil)
+	w := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/downloads/{id}", DownloadHandler).Methods("GET")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "expired") {
+		t.Errorf("Expected an expired link to be refused, got %v: %v", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
+	"go-rest-webservices-book-library/validation"
+	"net/http"
+	"strconv"
+)
+
+const defaultAuthorsLimit = 50
+
+type AuthorsRepository struct{}
+
+type AuthorsRepositoryInterface interface {
+	getAuthor(id int64) (*domain.Author, error)
+	findAuthors(name string, limit int64, offset int64) ([]domain.Author, error)
+	addAuthor(author domain.Author) (int64, error)
+	updateAuthor(author domain.Author) error
+	deleteAuthor(id int64) (bool, error)
+	getAuthorBooks(id int64, limit int64, offset int64) ([]domain.Book, error)
+	getCredits(bookId int64) ([]domain.Credit, error)
+	setCredits(bookId int64, credits []domain.Credit) ([]domain.Credit, error)
+}
+
+var authorsRepository AuthorsRepositoryInterface = AuthorsRepository{}
+
+func (a AuthorsRepository) getAuthor(id int64) (*domain.Author, error) {
+	return repository.GetAuthor(id)
+}
+
+func (a AuthorsRepository) findAuthors(name string, limit int64, offset int64) ([]domain.Author, error) {
+	return repository.FindAuthors(name, limit, offset)
+}
+
+func (a AuthorsRepository) addAuthor(author domain.Author) (int64, error) {
+	return repository.AddAuthor(author)
+}
+
+func (a AuthorsRepository) updateAuthor(author domain.Author) error {
+	return repository.UpdateAuthor(author)
+}
+
+func (a AuthorsRepository) deleteAuthor(id int64) (bool, error) {
+	return repository.DeleteAuthor(id)
+}
+
+func (a AuthorsRepository) getAuthorBooks(id int64, limit int64, offset int64) ([]domain.Book, error) {
+	return repository.GetAuthorBooks(id, limit, offset)
+}
+
+func (a AuthorsRepository) getCredits(bookId int64) ([]domain.Credit, error) {
+	return repository.GetCredits(bookId)
+}
+
+func (a AuthorsRepository) setCredits(bookId int64, credits []domain.Credit) ([]domain.Credit, error) {
+	return repository.SetCredits(bookId, credits)
+}
+
+// GetAuthorsHandler pages through the authors by name, ?name= narrows them down to the
+// names containing it.
+func GetAuthorsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	limit, offset, pageErr := getPage(r)
+	if pageErr != nil {
+		logger.Error("Improper paging parameters: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	if limit == 0 {
+		limit = defaultAuthorsLimit
+	}
+
+	authors, getErr := authorsRepository.findAuthors(r.URL.Query().Get("name"), limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting authors with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Authors(authors)))
+}
+
+func AddAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	author, decodeErr := decodeAuthor(r)
+	if decodeErr != nil {
+		logger.Error("Improper data passed for author create: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+
+	rowId, insertRecordErr := authorsRepository.addAuthor(author)
+	if insertRecordErr != nil {
+		logger.Error("Error while creating author with error: " + insertRecordErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	author.Id = rowId
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(mapper.Author(author)))
+}
+
+// AuthorHandler reads, renames and deletes an author. Renaming an author renames them on
+// their books, and authors can only be deleted once they are not credited on any book.
+func AuthorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	author, found := findAuthor(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Author(author)))
+	case "PUT":
+		update, decodeErr := decodeAuthor(r)
+		if decodeErr != nil {
+			logger.Error("Improper data passed for author update: " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		update.Id = author.Id
+		if updateErr := authorsRepository.updateAuthor(update); updateErr != nil {
+			logger.Error("Error while updating author: " + strconv.FormatInt(author.Id, 10) + " with error: " + updateErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Author(update)))
+	case "DELETE":
+		deleted, deleteErr := authorsRepository.deleteAuthor(author.Id)
+		if deleteErr != nil {
+			logger.Error("Error while deleting author: " + strconv.FormatInt(author.Id, 10) + " with error: " + deleteErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			writeApiError(w, mapper, domain.ApiError{
+				Status:  http.StatusConflict,
+				Message: "author is credited on books, credit others on them first",
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// GetAuthorBooksHandler pages through the books an author is credited on, in any role.
+func GetAuthorBooksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	author, found := findAuthor(w, r)
+	if !found {
+		return
+	}
+
+	limit, offset, pageErr := getPage(r)
+	if pageErr != nil {
+		logger.Error("Improper paging parameters: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	if limit == 0 {
+		limit = defaultAuthorsLimit
+	}
+
+	books, getErr := authorsRepository.getAuthorBooks(author.Id, limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting books of author: " + strconv.FormatInt(author.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Books(books)))
+}
+
+// BookCreditsHandler reads and replaces the authors of a book, along with their roles and
+// order. Replacing them also sets the author of the book to their names.
+func BookCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	id := mux.Vars(r)["id"]
+
+	books, getErr := booksRepository.getBook(id)
+	if getErr != nil {
+		logger.Error("Error while getting book: " + id + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(books) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	bookId := books[0].Id
+
+	var credits []domain.Credit
+	switch r.Method {
+	case "GET":
+		credits, getErr = authorsRepository.getCredits(bookId)
+	case "PUT":
+		input, decodeErr := decodeCredits(r)
+		if decodeErr != nil {
+			logger.Error("Improper data passed for credits of book: " + id + ": " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		credits, getErr = authorsRepository.setCredits(bookId, input)
+		if getErr == nil && credits == nil {
+			writeApiError(w, mapper, domain.ApiError{
+				Status:     http.StatusUnprocessableEntity,
+				Message:    http.StatusText(http.StatusUnprocessableEntity),
+				Violations: []domain.Violation{{Field: "Credits", Message: "must credit existing authors"}},
+			})
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if getErr != nil {
+		logger.Error("Error while " + r.Method + " of credits of book: " + id + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Credits(credits)))
+}
+
+func decodeAuthor(r *http.Request) (domain.Author, *decoder.Error) {
+	input := dto.FromRequest(r).NewAuthorInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		return domain.Author{}, decodeErr
+	}
+	return input.Author(), nil
+}
+
+// decodeCredits decodes and validates the credits of a book, which must name every
+// author once per role.
+func decodeCredits(r *http.Request) ([]domain.Credit, *decoder.Error) {
+	input := dto.FromRequest(r).NewCreditsInput()
+	decodeErr := decodeValid(r, input)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	credits := input.BookCredits()
+	seen := map[domain.Credit]bool{}
+	for _, credit := range credits {
+		if seen[credit] {
+			decodeErr = &decoder.Error{Status: http.StatusUnprocessableEntity}
+			return nil, decodeErr.Add("Credits", "must not credit an author twice in the same role")
+		}
+		seen[credit] = true
+	}
+	return credits, nil
+}
+
+// decodeValid decodes the body of r into input and validates it, reporting the unknown
+// fields and the violations together.
+func decodeValid(r *http.Request, input interface{}) *decoder.Error {
+	decodeErr := decoder.Decode(r, input)
+	if decodeErr != nil && decodeErr.Malformed {
+		return decodeErr
+	}
+	if fieldErrors := validation.Validate(input); fieldErrors != nil {
+		if decodeErr == nil {
+			decodeErr = &decoder.Error{Status: http.StatusUnprocessableEntity}
+		}
+		decodeErr.Violations = append(decodeErr.Violations, fieldErrors.Violations()...)
+	}
+	return decodeErr
+}
+
+func findAuthor(w http.ResponseWriter, r *http.Request) (domain.Author, bool) {
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var author *domain.Author
+	var getErr error
+	if parseErr == nil {
+		author, getErr = authorsRepository.getAuthor(id)
+	}
+
+	if getErr != nil {
+		logger.Error("Error while getting author: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Author{}, false
+	}
+	if author == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Author{}, false
+	}
+	return *author, true
+}
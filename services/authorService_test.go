@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// authorsRepositoryMock knows author 1, who is credited on books, and author 2, who is not.
+type authorsRepositoryMock struct{}
+
+func (a authorsRepositoryMock) getAuthor(id int64) (*domain.Author, error) {
+	if id != 1 && id != 2 {
+		return nil, nil
+	}
+	return &domain.Author{Id: id, Name: "Author"}, nil
+}
+
+func (a authorsRepositoryMock) findAuthors(name string, limit int64, offset int64) ([]domain.Author, error) {
+	return []domain.Author{{Id: 1, Name: "Author"}}, nil
+}
+
+func (a authorsRepositoryMock) addAuthor(author domain.Author) (int64, error) {
+	return 3, nil
+}
+
+func (a authorsRepositoryMock) updateAuthor(author domain.Author) error {
+	return nil
+}
+
+func (a authorsRepositoryMock) deleteAuthor(id int64) (bool, error) {
+	return id == 2, nil
+}
+
+func (a authorsRepositoryMock) getAuthorBooks(id int64, limit int64, offset int64) ([]domain.Book, error) {
+	return []domain.Book{{Id: 1, Name: "Book", Author: "Author"}}, nil
+}
+
+func (a authorsRepositoryMock) getCredits(bookId int64) ([]domain.Credit, error) {
+	return []domain.Credit{}, nil
+}
+
+func (a authorsRepositoryMock) setCredits(bookId int64, credits []domain.Credit) ([]domain.Credit, error) {
+	return credits, nil
+}
+
+func serveAuthors(method string, path string, data []byte) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/authors", GetAuthorsHandler).Methods("GET")
+	router.HandleFunc("/authors", AddAuthorHandler).Methods("POST")
+	router.HandleFunc("/authors/{id}", AuthorHandler).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/authors/{id}/books", GetAuthorBooksHandler).Methods("GET")
+
+	r, _ := http.NewRequest(method, path, bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthorHandlers(t *testing.T) {
+	TestSetup(t)
+	scenarios := []struct {
+		name   string
+		method string
+		path   string
+		data   []byte
+		status int
+	}{
+		{name: "List authors", method: "GET", path: "/authors?name=Au", status: http.StatusOK},
+		{name: "List authors with bad offset", method: "GET", path: "/authors?offset=-1", status: http.StatusBadRequest},
+		{name: "Create author", method: "POST", path: "/authors", data: []byte(`{"Name":"Author"}`), status: http.StatusCreated},
+		{name: "Create author without name", method: "POST", path: "/authors", data: []byte(`{"Name":" "}`), status: http.StatusUnprocessableEntity},
+		{name: "Create author with id", method: "POST", path: "/authors", data: []byte(`{"Id":1,"Name":"Author"}`), status: http.StatusBadRequest},
+		{name: "Get author", method: "GET", path: "/authors/1", status: http.StatusOK},
+		{name: "Get missing author", method: "GET", path: "/authors/3", status: http.StatusNotFound},
+		{name: "Rename author", method: "PUT", path: "/authors/1", data: []byte(`{"Name":"Other"}`), status: http.StatusOK},
+		{name: "Delete credited author", method: "DELETE", path: "/authors/1", status: http.StatusConflict},
+		{name: "Delete author", method: "DELETE", path: "/authors/2", status: http.StatusNoContent},
+		{name: "List books of author", method: "GET", path: "/authors/1/books", status: http.StatusOK},
+		{name: "List books of missing author", method: "GET", path: "/authors/3/books", status: http.StatusNotFound},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if w := serveAuthors(s.method, s.path, s.data); w.Code != s.status {
+				t.Errorf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDecodeCredits(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name       string
+		mapper     dto.Mapper
+		data       string
+		violations []domain.Violation
+	}{
+		{
+			name:   "should decode credits in order",
+			mapper: dto.V1,
+			data:   `{"Credits":[{"AuthorId":2,"Role":"author"},{"AuthorId":1,"Role":"illustrator"}]}`,
+		},
+		{
+			name:       "should check every credit",
+			mapper:     dto.V2,
+			data:       `{"credits":[{"authorId":2,"role":"author"},{"role":"reader"}]}`,
+			violations: []domain.Violation{{Field: "credits[1].authorId", Message: "is required"}, {Field: "credits[1].role", Message: "must be one of author, editor, translator, illustrator"}},
+		},
+		{
+			name:       "should require credits",
+			mapper:     dto.V1,
+			data:       `{"Credits":[]}`,
+			violations: []domain.Violation{{Field: "Credits", Message: "is required"}},
+		},
+		{
+			name:       "should credit an author once per role",
+			mapper:     dto.V1,
+			data:       `{"Credits":[{"AuthorId":2,"Role":"editor"},{"AuthorId":2,"Role":"editor"}]}`,
+			violations: []domain.Violation{{Field: "Credits", Message: "must not credit an author twice in the same role"}},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			r, _ := http.NewRequest("PUT", "/book/1/authors", bytes.NewBufferString(scenario.data))
+			r = requestWithMapper(r, scenario.mapper)
+
+			credits, decodeErr := decodeCredits(r)
+			if scenario.violations == nil {
+				if decodeErr != nil || len(credits) != 2 || credits[1].AuthorId != 1 {
+					t.Errorf("Expected two credits, got %v, %v", credits, decodeErr)
+				}
+				return
+			}
+			if decodeErr == nil || len(decodeErr.Violations) != len(scenario.violations) {
+				t.Fatalf("Expected %v, got %v", scenario.violations, decodeErr)
+			}
+			for i, violation := range scenario.violations {
+				if decodeErr.Violations[i] != violation {
+					t.Errorf("Expected %v, got %v", violation, decodeErr.Violations[i])
+				}
+			}
+		})
+	}
+}
+
+// requestWithMapper returns r as served by the API version of mapper.
+func requestWithMapper(r *http.Request, mapper dto.Mapper) *http.Request {
+	var served *http.Request
+	dto.Use(mapper, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	return served
+}
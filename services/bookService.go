@@ -2,12 +2,16 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-sqlite3"
 	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/decoder"
 	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
 	"go-rest-webservices-book-library/repository"
+	"go-rest-webservices-book-library/validation"
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
@@ -18,9 +22,17 @@ type BooksRepository struct{}
 type BooksRepositoryInterface interface {
 	getBook(id string) ([]domain.Book, error)
 	getAllBooks() ([]domain.Book, error)
+	getBooksPage(limit int64, offset int64) ([]domain.Book, error)
+	findBooks(filter domain.BookFilter, limit int64, offset int64) ([]domain.Book, error)
+	getBooksByIds(ids []int64) ([]domain.Book, error)
+	getBooksByAuthors(authors []string) ([]domain.Book, error)
+	getAuthors(name string, limit int64, offset int64) ([]string, error)
 	addBook(book domain.Book) (int64, error)
 	updateBook(book domain.Book, id string) error
 	deleteBook(id string) error
+	findDuplicateCandidates(book domain.Book, terms []string) ([]domain.Book, error)
+	mergeBooks(targetId int64, sourceIds []int64) (*domain.Book, error)
+	getMergedInto(id string) (int64, error)
 }
 
 var (
@@ -41,6 +53,26 @@ func (b BooksRepository) getAllBooks() ([]domain.Book, error) {
 	return repository.GetAllBooks()
 }
 
+func (b BooksRepository) getBooksPage(limit int64, offset int64) ([]domain.Book, error) {
+	return repository.GetBooksPage(limit, offset)
+}
+
+func (b BooksRepository) findBooks(filter domain.BookFilter, limit int64, offset int64) ([]domain.Book, error) {
+	return repository.FindBooks(filter, limit, offset)
+}
+
+func (b BooksRepository) getBooksByIds(ids []int64) ([]domain.Book, error) {
+	return repository.GetBooksByIds(ids)
+}
+
+func (b BooksRepository) getBooksByAuthors(authors []string) ([]domain.Book, error) {
+	return repository.GetBooksByAuthors(authors)
+}
+
+func (b BooksRepository) getAuthors(name string, limit int64, offset int64) ([]string, error) {
+	return repository.GetAuthors(name, limit, offset)
+}
+
 func (b BooksRepository) addBook(book domain.Book) (int64, error) {
 	return repository.AddBook(book)
 }
@@ -53,6 +85,19 @@ func (b BooksRepository) deleteBook(id string) error {
 	return repository.DeleteBook(id)
 }
 
+func (b BooksRepository) findDuplicateCandidates(book domain.Book, terms []string) ([]domain.Book, error) {
+	return repository.FindDuplicateCandidates(book, terms)
+}
+
+func (b BooksRepository) mergeBooks(targetId int64, sourceIds []int64) (*domain.Book, error) {
+	return repository.MergeBooks(targetId, sourceIds)
+}
+
+func (b BooksRepository) getMergedInto(id string) (int64, error) {
+	return repository.GetMergedInto(id)
+}
+
+// BookHandler writes a book to anyone, and updates or deletes it for staff.
 func BookHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -60,9 +105,13 @@ func BookHandler(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		getBookHandler(w, r)
 	case "DELETE":
-		deleteBookHandler(w, r)
+		if authorizeStaff(w, r) {
+			deleteBookHandler(w, r)
+		}
 	case "PUT":
-		updateBookHandler(w, r)
+		if authorizeStaff(w, r) {
+			updateBookHandler(w, r)
+		}
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -71,37 +120,46 @@ func BookHandler(w http.ResponseWriter, r *http.Request) {
 func updateBookHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	book, valid := isValidBook(r)
+	mapper := dto.FromRequest(r)
+	book, decodeErr := decodeBook(r)
 
-	if valid {
+	if decodeErr == nil {
 		updateErr := booksRepository.updateBook(book, id)
 		if updateErr == nil {
 			book.Id, _ = strconv.ParseInt(id, 10, 64)
 			logger.Info("Successfully updated book: " + getString(book))
 			w.WriteHeader(http.StatusOK)
-			_, _ = fmt.Fprintf(w, getString(book))
+			_, _ = fmt.Fprintf(w, getString(mapper.Book(book)))
 		} else {
 			logger.Error("Error while updating book: " + id + " with error: " + updateErr.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	} else {
-		logger.Error("Improper data passed for update: " + getString(book))
-		w.WriteHeader(http.StatusBadRequest)
+		logger.Error("Improper data passed for update: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
 	}
 }
 
+// getBookHandler writes a book, with its position in its series when asked for with
+// ?expand=series.
 func getBookHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	expand, expandErr := getExpand(r)
+	if expandErr != nil {
+		logger.Error("Improper expand parameter: " + expandErr.Error())
+		writeApiError(w, dto.FromRequest(r), expandErr.ApiError())
+		return
+	}
+
 	books, getBookErr := booksRepository.getBook(id)
 
 	if getBookErr == nil {
 		if len(books) == 0 {
-			w.WriteHeader(http.StatusNotFound)
+			redirectMergedBook(w, r, id)
 		} else {
-			w.WriteHeader(http.StatusOK)
-			_, _ = fmt.Fprintf(w, getString(books[0]))
+			writeBook(w, r, books[0], expand)
 		}
 	} else {
 		logger.Error("Error while getting book: " + id + " with error: " + getBookErr.Error())
@@ -109,58 +167,163 @@ func getBookHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// deleteBookHandler deletes a book along with the images of its cover and the files of
+// its digital editions.
 func deleteBookHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
+	bookId, _ := strconv.ParseInt(id, 10, 64)
+	cover, getErr := coversRepository.getCover(bookId)
+	var attachments []domain.Attachment
+	if getErr == nil {
+		attachments, getErr = attachmentsRepository.getAttachments(bookId)
+	}
+	if getErr != nil {
+		logger.Error("Error while getting files of book: " + id + " with error: " + getErr.Error())
+	}
+
 	deleteError := booksRepository.deleteBook(id)
 
 	if deleteError == nil {
+		if cover != nil {
+			deleteCoverBlobs(r.Context(), *cover)
+		}
+		for _, attachment := range attachments {
+			if blobErr := blobStore.Delete(r.Context(), attachmentKey(attachment)); blobErr != nil {
+				logger.Error("Error while deleting blob of attachment: " + strconv.FormatInt(attachment.Id, 10) + " with error: " + blobErr.Error())
+			}
+		}
 		w.WriteHeader(http.StatusNoContent)
+	} else if errors.Is(deleteError, repository.ErrBookLent) {
+		writeApiError(w, dto.FromRequest(r), domain.ApiError{Status: http.StatusConflict, Message: deleteError.Error()})
 	} else {
 		logger.Error("Error while deleting book: " + id + " with error: " + deleteError.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// GetAllBooksHandler lists the books, every one of them unless a limit is given. ?subject=
+// narrows them down to the books tagged with a subject or a subject below it.
 func GetAllBooksHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	limit, offset, pageErr := getPage(r)
+	if pageErr != nil {
+		logger.Error("Improper paging parameters: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	subjectId, subjectErr := getSubjectFilter(r)
+	if subjectErr != nil {
+		logger.Error("Improper subject parameter: " + subjectErr.Error())
+		writeApiError(w, mapper, subjectErr.ApiError())
+		return
+	}
 
-	books, getAllError := booksRepository.getAllBooks()
+	var books []domain.Book
+	var getAllError error
+	if subjectId != 0 {
+		if limit == 0 {
+			limit = -1
+		}
+		books, getAllError = booksRepository.findBooks(domain.BookFilter{Subject: subjectId}, limit, offset)
+	} else if limit > 0 {
+		books, getAllError = booksRepository.getBooksPage(limit, offset)
+	} else {
+		books, getAllError = booksRepository.getAllBooks()
+	}
 
 	if getAllError == nil {
 		w.WriteHeader(http.StatusOK)
-		_, _ = fmt.Fprintf(w, getString(books))
+		_, _ = fmt.Fprintf(w, getString(mapper.Books(books)))
 	} else {
 		logger.Error("Error while getting all books with error: " + getAllError.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// AddBookHandler adds a book for staff, with the publisher, year and pages it leaves out
+// looked up by its ISBN when asked for with ?enrich=true.
 func AddBookHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	book, valid := isValidBook(r)
+	mapper := dto.FromRequest(r)
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	enrich, enrichErr := getEnrich(r)
+	if enrichErr != nil {
+		logger.Error("Improper enrich parameter: " + enrichErr.Error())
+		writeApiError(w, mapper, enrichErr.ApiError())
+		return
+	}
+	book, decodeErr := decodeBook(r)
 
-	if valid {
+	if decodeErr == nil {
+		if enrich {
+			enrichBook(r.Context(), &book)
+		}
 		rowId, insertRecordErr := booksRepository.addBook(book)
 		if insertRecordErr == nil {
 			book.Id = rowId
-			_, _ = fmt.Fprintf(w, getString(book))
+			linkDuplicates(w, r, book)
+			_, _ = fmt.Fprintf(w, getString(mapper.Book(book)))
 		} else {
 			logger.Error("Error while creating book with error: " + insertRecordErr.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	} else {
-		logger.Error("Improper data passed for create: " + getString(book))
-		w.WriteHeader(http.StatusBadRequest)
+		logger.Error("Improper data passed for create: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+	}
+}
+
+// decodeBook decodes and validates the book in the request body using the representation
+// of the API version serving the request.
+func decodeBook(r *http.Request) (domain.Book, *decoder.Error) {
+	input := dto.FromRequest(r).NewBookInput()
+	decodeErr := decoder.Decode(r, input)
+
+	if decodeErr != nil && decodeErr.Malformed {
+		return domain.Book{}, decodeErr
 	}
+	if fieldErrors := validation.Validate(input); fieldErrors != nil {
+		if decodeErr == nil {
+			decodeErr = &decoder.Error{Status: http.StatusUnprocessableEntity}
+		}
+		decodeErr.Violations = append(decodeErr.Violations, fieldErrors.Violations()...)
+	}
+
+	return input.Book(), decodeErr
 }
 
-func isValidBook(r *http.Request) (domain.Book, bool) {
-	var book domain.Book
-	decodeErr := json.NewDecoder(r.Body).Decode(&book)
+// getPage reads the optional limit and offset query parameters. A limit of zero means
+// that every book is returned, which keeps GET /books compatible with older clients.
+func getPage(r *http.Request) (int64, int64, *decoder.Error) {
+	var pageErr *decoder.Error
+	values := map[string]int64{}
+
+	for _, name := range []string{"limit", "offset"} {
+		text := r.URL.Query().Get(name)
+		if text == "" {
+			continue
+		}
+		value, parseErr := strconv.ParseInt(text, 10, 64)
+		if parseErr != nil || value < 0 {
+			pageErr = pageErr.Add(name, "must be a non-negative integer")
+			continue
+		}
+		values[name] = value
+	}
+
+	return values["limit"], values["offset"], pageErr
+}
 
-	return book, decodeErr == nil && book.Name != "" && book.Author != ""
+func writeApiError(w http.ResponseWriter, mapper dto.Mapper, apiError domain.ApiError) {
+	w.WriteHeader(apiError.Status)
+	_, _ = fmt.Fprintf(w, getString(mapper.ApiError(apiError)))
 }
 
 func getString(input interface{}) string {
@@ -13,26 +13,29 @@ import (
 
 func BenchmarkSetup(b *testing.B) {
 	booksRepository = booksRepositoryMock{}
+	coversRepository = coversRepositoryMock{covers: map[int64]domain.Cover{}}
+	attachmentsRepository = newAttachmentsRepositoryMock()
+	lookupsRepository = lookupsRepositoryMock{lookups: map[string]domain.IsbnLookup{}}
 	logger, _ = zap.NewDevelopment()
 }
 
-func BenchmarkIsValidBookForValidData(b *testing.B) {
+func BenchmarkDecodeBookForValidData(b *testing.B) {
 	data := []byte(`{"Name":"Book", "Author": "Author"}`)
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		r, _ := http.NewRequest("", "", bytes.NewBuffer(data))
-		isValidBook(r)
+		decodeBook(r)
 	}
 }
 
-func BenchmarkIsValidBookForInvalidData(b *testing.B) {
+func BenchmarkDecodeBookForInvalidData(b *testing.B) {
 	data := []byte(`{or"}`)
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		r, _ := http.NewRequest("", "", bytes.NewBuffer(data))
-		isValidBook(r)
+		decodeBook(r)
 	}
 }
 
@@ -93,6 +96,7 @@ func BenchmarkBookHandlerUpdateBookSuccess(b *testing.B) {
 	}
 	data := []byte(`{"Name":"Book", "Author":"Author"}`)
 	r, _ := http.NewRequest("PUT", "/book/1", bytes.NewBuffer(data))
+	asStaff(r)
 	r.Header.Set("Content-Type", "application/json")
 	r = mux.SetURLVars(r, map[string]string{"id": "1"})
 
@@ -100,6 +104,7 @@ func BenchmarkBookHandlerUpdateBookSuccess(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		w := httptest.NewRecorder()
 		r, _ = http.NewRequest("PUT", "/book/1", bytes.NewBuffer(data))
+		asStaff(r)
 		BookHandler(w, r)
 	}
 }
@@ -110,6 +115,7 @@ func BenchmarkBookHandlerUpdateBookWithDatabaseError(b *testing.B) {
 	}
 	data := []byte(`{"Name":"Book", "Author":"Author"}`)
 	r, _ := http.NewRequest("PUT", "/book/1", bytes.NewBuffer(data))
+	asStaff(r)
 	r.Header.Set("Content-Type", "application/json")
 	r = mux.SetURLVars(r, map[string]string{"id": "1"})
 
@@ -117,6 +123,7 @@ func BenchmarkBookHandlerUpdateBookWithDatabaseError(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		w := httptest.NewRecorder()
 		r, _ = http.NewRequest("PUT", "/book/1", bytes.NewBuffer(data))
+		asStaff(r)
 		BookHandler(w, r)
 	}
 }
@@ -128,6 +135,7 @@ func BenchmarkBookHandlerUpdateBookWithBadData(b *testing.B) {
 	}
 	data := []byte(`{"Author":"Author"}`)
 	r, _ := http.NewRequest("PUT", "/book/1", bytes.NewBuffer(data))
+	asStaff(r)
 	r.Header.Set("Content-Type", "application/json")
 	r = mux.SetURLVars(r, map[string]string{"id": "1"})
 
@@ -135,6 +143,7 @@ func BenchmarkBookHandlerUpdateBookWithBadData(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		w := httptest.NewRecorder()
 		r, _ = http.NewRequest("PUT", "/book/1", bytes.NewBuffer(data))
+		asStaff(r)
 		BookHandler(w, r)
 	}
 }
@@ -144,6 +153,7 @@ func BenchmarkBookHandlerDeleteBookSuccess(b *testing.B) {
 		return nil
 	}
 	r, _ := http.NewRequest("DELETE", "/book/4", nil)
+	asStaff(r)
 	r = mux.SetURLVars(r, map[string]string{"id": "4"})
 
 	b.StartTimer()
@@ -158,6 +168,7 @@ func BenchmarkBookHandlerDeleteBookWithDatabaseError(b *testing.B) {
 		return errors.New("something bad happened")
 	}
 	r, _ := http.NewRequest("DELETE", "/book/4", nil)
+	asStaff(r)
 	r = mux.SetURLVars(r, map[string]string{"id": "4"})
 
 	b.StartTimer()
@@ -213,12 +224,14 @@ func BenchmarkAddBookHandlerSuccess(b *testing.B) {
 	}
 	data := []byte(`{"Name":"Book", "Author":"Author"}`)
 	r, _ := http.NewRequest("POST", "/book", bytes.NewBuffer(data))
+	asStaff(r)
 	r.Header.Set("Content-Type", "application/json")
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		w := httptest.NewRecorder()
 		r, _ = http.NewRequest("POST", "/book", bytes.NewBuffer(data))
+		asStaff(r)
 		AddBookHandler(w, r)
 	}
 }
@@ -229,12 +242,14 @@ func BenchmarkAddBookHandlerWithDatabaseError(b *testing.B) {
 	}
 	data := []byte(`{"Name":"Book", "Author":"Author"}`)
 	r, _ := http.NewRequest("POST", "/book", bytes.NewBuffer(data))
+	asStaff(r)
 	r.Header.Set("Content-Type", "application/json")
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		w := httptest.NewRecorder()
 		r, _ = http.NewRequest("POST", "/book", bytes.NewBuffer(data))
+		asStaff(r)
 		AddBookHandler(w, r)
 	}
 }
@@ -246,12 +261,14 @@ func BenchmarkAddBookHandlerWithBadData(b *testing.B) {
 	}
 	data := []byte(`{"Author":"Author"}`)
 	r, _ := http.NewRequest("POST", "/book", bytes.NewBuffer(data))
+	asStaff(r)
 	r.Header.Set("Content-Type", "application/json")
 
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		w := httptest.NewRecorder()
 		r, _ = http.NewRequest("POST", "/book", bytes.NewBuffer(data))
+		asStaff(r)
 		AddBookHandler(w, r)
 	}
 }
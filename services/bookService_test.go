@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/config"
 	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
 	"go.uber.org/zap"
 	"net/http"
 	"net/http/httptest"
@@ -27,11 +30,19 @@ type scenario struct {
 }
 
 var (
-	booksRepositoryGetMock    func(id string) ([]domain.Book, error)
-	booksRepositoryGetAllMock func() ([]domain.Book, error)
-	booksRepositoryAddMock    func(book domain.Book) (int64, error)
-	booksRepositoryUpdateMock func(book domain.Book, id string) error
-	booksRepositoryDeleteMock func(id string) error
+	booksRepositoryGetMock        func(id string) ([]domain.Book, error)
+	booksRepositoryGetAllMock     func() ([]domain.Book, error)
+	booksRepositoryGetPageMock    func(limit int64, offset int64) ([]domain.Book, error)
+	booksRepositoryFindMock       func(filter domain.BookFilter, limit int64, offset int64) ([]domain.Book, error)
+	booksRepositoryByIdsMock      func(ids []int64) ([]domain.Book, error)
+	booksRepositoryByAuthorsMock  func(authors []string) ([]domain.Book, error)
+	booksRepositoryAuthorsMock    func(name string, limit int64, offset int64) ([]string, error)
+	booksRepositoryAddMock        func(book domain.Book) (int64, error)
+	booksRepositoryUpdateMock     func(book domain.Book, id string) error
+	booksRepositoryDeleteMock     func(id string) error
+	booksRepositoryCandidatesMock func(book domain.Book, terms []string) ([]domain.Book, error)
+	booksRepositoryMergeMock      func(targetId int64, sourceIds []int64) (*domain.Book, error)
+	booksRepositoryMergedIntoMock func(id string) (int64, error)
 )
 
 func (b booksRepositoryMock) getBook(id string) ([]domain.Book, error) {
@@ -42,6 +53,26 @@ func (b booksRepositoryMock) getAllBooks() ([]domain.Book, error) {
 	return booksRepositoryGetAllMock()
 }
 
+func (b booksRepositoryMock) getBooksPage(limit int64, offset int64) ([]domain.Book, error) {
+	return booksRepositoryGetPageMock(limit, offset)
+}
+
+func (b booksRepositoryMock) findBooks(filter domain.BookFilter, limit int64, offset int64) ([]domain.Book, error) {
+	return booksRepositoryFindMock(filter, limit, offset)
+}
+
+func (b booksRepositoryMock) getBooksByIds(ids []int64) ([]domain.Book, error) {
+	return booksRepositoryByIdsMock(ids)
+}
+
+func (b booksRepositoryMock) getBooksByAuthors(authors []string) ([]domain.Book, error) {
+	return booksRepositoryByAuthorsMock(authors)
+}
+
+func (b booksRepositoryMock) getAuthors(name string, limit int64, offset int64) ([]string, error) {
+	return booksRepositoryAuthorsMock(name, limit, offset)
+}
+
 func (b booksRepositoryMock) addBook(book domain.Book) (int64, error) {
 	return booksRepositoryAddMock(book)
 }
@@ -54,12 +85,44 @@ func (b booksRepositoryMock) deleteBook(id string) error {
 	return booksRepositoryDeleteMock(id)
 }
 
+func (b booksRepositoryMock) findDuplicateCandidates(book domain.Book, terms []string) ([]domain.Book, error) {
+	return booksRepositoryCandidatesMock(book, terms)
+}
+
+func (b booksRepositoryMock) mergeBooks(targetId int64, sourceIds []int64) (*domain.Book, error) {
+	return booksRepositoryMergeMock(targetId, sourceIds)
+}
+
+func (b booksRepositoryMock) getMergedInto(id string) (int64, error) {
+	return booksRepositoryMergedIntoMock(id)
+}
+
 func TestSetup(t *testing.T) {
 	booksRepository = booksRepositoryMock{}
+	circulationRepository = circulationRepositoryMock{}
+	booksRepositoryCandidatesMock = func(book domain.Book, terms []string) ([]domain.Book, error) {
+		return nil, nil
+	}
+	booksRepositoryMergedIntoMock = func(id string) (int64, error) {
+		return 0, nil
+	}
+	webhooksRepository = webhooksRepositoryMock{}
+	authorsRepository = authorsRepositoryMock{}
+	groupsRepository = groupsRepositoryMock{}
+	subjectsRepository = subjectsRepositoryMock{}
+	coversRepository = coversRepositoryMock{covers: map[int64]domain.Cover{}}
+	attachmentsRepository = newAttachmentsRepositoryMock()
+	lookupsRepository = lookupsRepositoryMock{lookups: map[string]domain.IsbnLookup{}}
+	loansRepository = newLoansRepositoryMock()
+	jobScheduler = jobSchedulerMock{}
+	notificationsRepository = newNotificationsRepositoryMock()
+	membersRepository = newMembersRepositoryMock()
+	accountMailer = accountMailerMock{tokens: map[string]string{}}
+	config.StaffToken = staffToken
 	logger, _ = zap.NewDevelopment()
 }
 
-func TestIsValidData(t *testing.T) {
+func TestDecodeBook(t *testing.T) {
 	t.Parallel()
 	scenarios := []scenario{
 		{
@@ -82,6 +145,21 @@ func TestIsValidData(t *testing.T) {
 			data:  []byte(`{}`),
 			valid: false,
 		},
+		{
+			name:  "Invalid if unknown fields are passed",
+			data:  []byte(`{"Name":"Book", "Author": "Author", "Edition": 2}`),
+			valid: false,
+		},
+		{
+			name:  "Invalid if server owned id is passed",
+			data:  []byte(`{"Id": 4, "Name":"Book", "Author": "Author"}`),
+			valid: false,
+		},
+		{
+			name:  "Invalid if data trails the json object",
+			data:  []byte(`{"Name":"Book", "Author": "Author"} {}`),
+			valid: false,
+		},
 		{
 			name:  "Valid when book name and author name and non-empty strings",
 			data:  []byte(`{"Name":"Book", "Author": "Author"}`),
@@ -92,9 +170,9 @@ func TestIsValidData(t *testing.T) {
 	for _, scenario := range scenarios {
 		t.Run(scenario.name, func(t *testing.T) {
 			r, _ := http.NewRequest("", "", bytes.NewBuffer(scenario.data))
-			_, valid := isValidBook(r)
-			if scenario.valid != valid {
-				t.Errorf("Expected %v, found %v\n", scenario.valid, valid)
+			_, decodeErr := decodeBook(r)
+			if scenario.valid != (decodeErr == nil) {
+				t.Errorf("Expected %v, found %v\n", scenario.valid, decodeErr)
 			}
 		})
 	}
@@ -130,9 +208,42 @@ func TestGetString(t *testing.T) {
 	}
 }
 
+func TestBookWritesNeedStaff(t *testing.T) {
+	TestSetup(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/book", AddBookHandler).Methods("POST")
+	router.HandleFunc("/book/{id}", BookHandler).Methods("PUT", "DELETE")
+	router.HandleFunc("/books/merge", MergeBooksHandler).Methods("POST")
+	router.HandleFunc("/admin/jobs/{name}/run", RunJobHandler).Methods("POST")
+	member := signIn(t, 1)
+
+	for _, s := range []struct {
+		method string
+		path   string
+		data   string
+	}{
+		{method: "POST", path: "/book", data: `{"Name":"Book","Author":"Author"}`},
+		{method: "PUT", path: "/book/1", data: `{"Name":"Book","Author":"Author"}`},
+		{method: "DELETE", path: "/book/1"},
+		{method: "POST", path: "/books/merge", data: `{"Target":1,"Sources":[2]}`},
+		{method: "POST", path: "/admin/jobs/purge/run"},
+	} {
+		for _, authorization := range []string{"", "Bearer " + member, "Bearer wrong"} {
+			r, _ := http.NewRequest(s.method, s.path, bytes.NewBufferString(s.data))
+			r.Header.Set("Authorization", authorization)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected %v %v with %q to need the staff token, got %v", s.method, s.path, authorization, w.Code)
+			}
+		}
+	}
+}
+
 func TestDeleteBooks(t *testing.T) {
 	t.Parallel()
 	r, _ := http.NewRequest("DELETE", "/book/4", nil)
+	asStaff(r)
 	r = mux.SetURLVars(r, map[string]string{"id": "4"})
 
 	scenarios := []scenario{
@@ -140,6 +251,11 @@ func TestDeleteBooks(t *testing.T) {
 			name:   "should delete with status code 204",
 			status: http.StatusNoContent,
 		},
+		{
+			name:   "should give 409 for a book which was lent",
+			err:    repository.ErrBookLent,
+			status: http.StatusConflict,
+		},
 		{
 			name:   "should give 500 on delete error",
 			err:    errors.New("something bad happened"),
@@ -176,15 +292,25 @@ func TestAddBookHandler(t *testing.T) {
 			status: http.StatusBadRequest,
 		},
 		{
-			name:   "failure for book create for bad data",
+			name:   "failure for book create for invalid data",
 			data:   []byte(`{"Author":"Author"}`),
-			status: http.StatusBadRequest,
+			status: http.StatusUnprocessableEntity,
 		},
 		{
-			name:   "failure for book create for bad data",
+			name:   "failure for book create for invalid data",
 			data:   []byte(`{}`),
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "failure for book create when client sets id",
+			data:   []byte(`{"Id":7,"Name":"Book","Author":"Author"}`),
 			status: http.StatusBadRequest,
 		},
+		{
+			name:   "failure for book create for too large body",
+			data:   append([]byte(`{"Name":"`), bytes.Repeat([]byte("a"), 2<<20)...),
+			status: http.StatusRequestEntityTooLarge,
+		},
 		{
 			name:   "failure for book create for db errors",
 			err:    errors.New("error occurred while inserting record into database"),
@@ -200,6 +326,7 @@ func TestAddBookHandler(t *testing.T) {
 			}
 			w := httptest.NewRecorder()
 			r, _ := http.NewRequest("POST", "/book", bytes.NewBuffer(scenario.data))
+			asStaff(r)
 			r.Header.Set("Content-Type", "application/json")
 			AddBookHandler(w, r)
 
@@ -208,6 +335,33 @@ func TestAddBookHandler(t *testing.T) {
 	}
 }
 
+func TestDecodeBookReportsEveryViolation(t *testing.T) {
+	t.Parallel()
+	data := []byte(`{"Id": 1, "Name": "", "Edition": 2, "Author": "\u0007Author"}`)
+	r, _ := http.NewRequest("POST", "/book", bytes.NewBuffer(data))
+	asStaff(r)
+
+	_, decodeErr := decodeBook(r)
+	if decodeErr == nil {
+		t.Fatalf("Expected violations, got none")
+	}
+
+	expected := []domain.Violation{
+		{Field: "Author", Message: "must not contain control characters"},
+		{Field: "Edition", Message: "is not a known field"},
+		{Field: "Id", Message: "is set by the server"},
+		{Field: "Name", Message: "is required"},
+	}
+	if len(decodeErr.Violations) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, decodeErr.Violations)
+	}
+	for i, violation := range expected {
+		if decodeErr.Violations[i] != violation {
+			t.Errorf("Expected %v, got %v", violation, decodeErr.Violations[i])
+		}
+	}
+}
+
 func TestGetBookByIdHandler(t *testing.T) {
 	t.Parallel()
 	r, _ := http.NewRequest("GET", "/book/8", nil)
@@ -288,6 +442,49 @@ func TestGetAllBooksHandler(t *testing.T) {
 	}
 }
 
+func TestGetBooksPageHandler(t *testing.T) {
+	t.Parallel()
+	scenarios := []scenario{
+		{
+			name: "should get requested page of books",
+			data: []byte("/books?limit=2&offset=2"),
+			books: []domain.Book{
+				{Id: 3, Name: "Book3", Author: "Author3"},
+				{Id: 4, Name: "Book4", Author: "Author4"},
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:   "should give 400 for negative limit",
+			data:   []byte("/books?limit=-2"),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "should give 400 for non numeric offset",
+			data:   []byte("/books?limit=2&offset=two"),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "should give 500 for page of books for database error",
+			data:   []byte("/books?limit=2"),
+			status: http.StatusInternalServerError,
+			err:    errors.New("error while getting data from database"),
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", string(scenario.data), nil)
+			booksRepositoryGetPageMock = func(limit int64, offset int64) ([]domain.Book, error) {
+				return scenario.books, scenario.err
+			}
+			GetAllBooksHandler(w, r)
+			compareResponses(t, w, scenario)
+		})
+	}
+}
+
 func TestUpdateBookHandler(t *testing.T) {
 	t.Parallel()
 	scenarios := []scenario{
@@ -304,19 +501,19 @@ func TestUpdateBookHandler(t *testing.T) {
 			status: http.StatusInternalServerError,
 		},
 		{
-			name:   "should fail update record for bad data",
+			name:   "should fail update record for invalid data",
 			data:   []byte(`{"Name":"Book"}`),
-			status: http.StatusBadRequest,
+			status: http.StatusUnprocessableEntity,
 		},
 		{
-			name:   "should fail update record for bad data",
+			name:   "should fail update record for invalid data",
 			data:   []byte(`{"Author":"Author"}`),
-			status: http.StatusBadRequest,
+			status: http.StatusUnprocessableEntity,
 		},
 		{
-			name:   "should fail update record for bad data",
+			name:   "should fail update record for invalid data",
 			data:   []byte(`{}`),
-			status: http.StatusBadRequest,
+			status: http.StatusUnprocessableEntity,
 		},
 	}
 
@@ -328,6 +525,7 @@ func TestUpdateBookHandler(t *testing.T) {
 
 			w := httptest.NewRecorder()
 			r, _ := http.NewRequest("PUT", "/book/1", bytes.NewBuffer(scenario.data))
+			asStaff(r)
 			r.Header.Set("Content-Type", "application/json")
 			r = mux.SetURLVars(r, map[string]string{"id": "1"})
 
@@ -337,6 +535,46 @@ func TestUpdateBookHandler(t *testing.T) {
 	}
 }
 
+func TestV2Representation(t *testing.T) {
+	t.Parallel()
+	scenarios := []scenario{
+		{
+			name:           "should add book with v2 representation",
+			data:           []byte(`{"title":"Book","author":"Author"}`),
+			status:         http.StatusOK,
+			expectedString: `{"id":0,"title":"Book","author":"Author"}`,
+		},
+		{
+			name:           "should give v2 errors keyed by v2 field names",
+			data:           []byte(`{"title":"Book"}`),
+			status:         http.StatusUnprocessableEntity,
+			expectedString: `{"status":422,"message":"Unprocessable Entity","violations":[{"field":"author","message":"is required"}]}`,
+		},
+		{
+			name:           "should reject v1 representation",
+			data:           []byte(`{"Name":"Book","Author":"Author"}`),
+			status:         http.StatusBadRequest,
+			expectedString: `{"status":400,"message":"Bad Request","violations":[{"field":"Name","message":"is not a known field"},{"field":"title","message":"is required"}]}`,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			booksRepositoryAddMock = func(book domain.Book) (int64, error) {
+				return 0, nil
+			}
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/v2/book", bytes.NewBuffer(scenario.data))
+			asStaff(r)
+			dto.Use(dto.V2, http.HandlerFunc(AddBookHandler)).ServeHTTP(w, r)
+
+			if w.Code != scenario.status || w.Body.String() != scenario.expectedString {
+				t.Errorf("Expected %v %v, got %v %v", scenario.status, scenario.expectedString, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
 func TestUnsupportedMethods(t *testing.T) {
 	t.Parallel()
 	scenarios := []scenario{
@@ -356,6 +594,7 @@ func TestUnsupportedMethods(t *testing.T) {
 		t.Run(scenario.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			r, _ := http.NewRequest(scenario.method, "/book/1", nil)
+			asStaff(r)
 			BookHandler(w, r)
 
 			if scenario.status != w.Code {
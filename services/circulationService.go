@@ -0,0 +1,63 @@
+package services
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/repository"
+)
+
+type CirculationRepository struct{}
+
+type CirculationRepositoryInterface interface {
+	getCopiesByBookIds(bookIds []int64) ([]domain.Copy, error)
+	getCopiesByIds(ids []int64) ([]domain.Copy, error)
+	addCopy(copy domain.Copy) (*domain.Copy, error)
+	updateCopy(copy domain.Copy) (bool, error)
+	getMembersByIds(ids []int64) ([]domain.Member, error)
+	getMembers(name string, limit int64, offset int64) ([]domain.Member, error)
+	getCurrentLoansByCopyIds(copyIds []int64) ([]domain.Loan, error)
+	getLoansByMemberIds(memberIds []int64) ([]domain.Loan, error)
+	getLoans(memberId int64, currentOnly bool, limit int64, offset int64) ([]domain.Loan, error)
+	getHoldsByBookIds(bookIds []int64) ([]domain.Hold, error)
+}
+
+var circulationRepository CirculationRepositoryInterface = CirculationRepository{}
+
+func (c CirculationRepository) getCopiesByBookIds(bookIds []int64) ([]domain.Copy, error) {
+	return repository.GetCopiesByBookIds(bookIds)
+}
+
+func (c CirculationRepository) getCopiesByIds(ids []int64) ([]domain.Copy, error) {
+	return repository.GetCopiesByIds(ids)
+}
+
+func (c CirculationRepository) addCopy(copy domain.Copy) (*domain.Copy, error) {
+	return repository.AddCopy(copy)
+}
+
+func (c CirculationRepository) updateCopy(copy domain.Copy) (bool, error) {
+	return repository.UpdateCopy(copy)
+}
+
+func (c CirculationRepository) getMembersByIds(ids []int64) ([]domain.Member, error) {
+	return repository.GetMembersByIds(ids)
+}
+
+func (c CirculationRepository) getMembers(name string, limit int64, offset int64) ([]domain.Member, error) {
+	return repository.GetMembers(name, limit, offset)
+}
+
+func (c CirculationRepository) getCurrentLoansByCopyIds(copyIds []int64) ([]domain.Loan, error) {
+	return repository.GetCurrentLoansByCopyIds(copyIds)
+}
+
+func (c CirculationRepository) getLoansByMemberIds(memberIds []int64) ([]domain.Loan, error) {
+	return repository.GetLoansByMemberIds(memberIds)
+}
+
+func (c CirculationRepository) getLoans(memberId int64, currentOnly bool, limit int64, offset int64) ([]domain.Loan, error) {
+	return repository.GetLoans(memberId, currentOnly, limit, offset)
+}
+
+func (c CirculationRepository) getHoldsByBookIds(bookIds []int64) ([]domain.Hold, error) {
+	return repository.GetHoldsByBookIds(bookIds)
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"net/http"
+	"strconv"
+)
+
+// GetCollectionsHandler pages through the collections by name, ?name= narrows them down to
+// the names containing it and ?kind= to collections or shelves.
+func GetCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	limit, offset, pageErr := getPage(r)
+	kind := r.URL.Query().Get("kind")
+	switch kind {
+	case "", domain.KindCollection, domain.KindShelf:
+	default:
+		pageErr = pageErr.Add("kind", "must be one of "+domain.KindCollection+", "+domain.KindShelf)
+	}
+	if pageErr != nil {
+		logger.Error("Improper parameters for collections: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	if limit == 0 {
+		limit = defaultGroupsLimit
+	}
+
+	collections, getErr := groupsRepository.findCollections(r.URL.Query().Get("name"), kind, limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting collections with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Collections(collections)))
+}
+
+func AddCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	input := mapper.NewCollectionInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for collection create: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+
+	collection := input.Collection()
+	rowId, insertRecordErr := groupsRepository.addCollection(collection)
+	if insertRecordErr != nil {
+		logger.Error("Error while creating collection with error: " + insertRecordErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	collection.Id = rowId
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(mapper.Collection(collection)))
+}
+
+// CollectionHandler reads, changes and deletes a collection. Deleting a collection keeps
+// its books.
+func CollectionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	collection, found := findCollection(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Collection(collection)))
+	case "PUT":
+		input := mapper.NewCollectionInput()
+		if decodeErr := decodeValid(r, input); decodeErr != nil {
+			logger.Error("Improper data passed for collection update: " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		update := input.Collection()
+		update.Id = collection.Id
+		if updateErr := groupsRepository.updateCollection(update); updateErr != nil {
+			logger.Error("Error while updating collection: " + strconv.FormatInt(collection.Id, 10) + " with error: " + updateErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Collection(update)))
+	case "DELETE":
+		if deleteErr := groupsRepository.deleteCollection(collection.Id); deleteErr != nil {
+			logger.Error("Error while deleting collection: " + strconv.FormatInt(collection.Id, 10) + " with error: " + deleteErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// CollectionBooksHandler lists the books of a collection in order, replaces them or adds
+// one.
+func CollectionBooksHandler(w http.ResponseWriter, r *http.Request) {
+	if _, found := findCollection(w, r); found {
+		entriesHandler(w, r, domain.GroupCollections)
+	}
+}
+
+// CollectionBookHandler takes a book out of a collection.
+func CollectionBookHandler(w http.ResponseWriter, r *http.Request) {
+	if _, found := findCollection(w, r); found {
+		removeEntryHandler(w, r, domain.GroupCollections)
+	}
+}
+
+func findCollection(w http.ResponseWriter, r *http.Request) (domain.Collection, bool) {
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var collection *domain.Collection
+	var getErr error
+	if parseErr == nil {
+		collection, getErr = groupsRepository.getCollection(id)
+	}
+
+	if getErr != nil {
+		logger.Error("Error while getting collection: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Collection{}, false
+	}
+	if collection == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Collection{}, false
+	}
+	return *collection, true
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"net/http"
+	"strconv"
+)
+
+const barcodeTaken = "barcode is on another copy"
+
+// BookCopiesHandler lists the copies of a book to anyone, and adds a copy to it for
+// staff. Copies are added available, of the default item type unless the body names one.
+func BookCopiesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	if r.Method == "POST" && !authorizeStaff(w, r) {
+		return
+	}
+
+	book, found := findBook(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		copies, getErr := circulationRepository.getCopiesByBookIds([]int64{book.Id})
+		if getErr != nil {
+			logger.Error("Error while getting copies of book: " + strconv.FormatInt(book.Id, 10) + " with error: " + getErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Copies(copies)))
+	case "POST":
+		copy, decoded := decodeCopy(w, r, mapper)
+		if !decoded {
+			return
+		}
+		copy.BookId = book.Id
+		added, addErr := circulationRepository.addCopy(copy)
+		if addErr != nil {
+			logger.Error("Error while adding copy of book: " + strconv.FormatInt(book.Id, 10) + " with error: " + addErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if added == nil {
+			writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: barcodeTaken})
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, getString(mapper.Copy(*added)))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// CopyHandler writes a copy to anyone, and sets its barcode and item type for staff. The
+// status of a copy follows its loans and is not set here.
+func CopyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	if r.Method == "PUT" && !authorizeStaff(w, r) {
+		return
+	}
+
+	copy, found := findCopy(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Copy(copy)))
+	case "PUT":
+		update, decoded := decodeCopy(w, r, mapper)
+		if !decoded {
+			return
+		}
+		copy.Barcode, copy.ItemType = update.Barcode, update.ItemType
+		updated, updateErr := circulationRepository.updateCopy(copy)
+		if updateErr != nil {
+			logger.Error("Error while updating copy: " + strconv.FormatInt(copy.Id, 10) + " with error: " + updateErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !updated {
+			writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: barcodeTaken})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Copy(copy)))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeCopy reads the barcode and the item type of a copy, config.DefaultItemType when
+// the body leaves it out.
+func decodeCopy(w http.ResponseWriter, r *http.Request, mapper dto.Mapper) (domain.Copy, bool) {
+	input := mapper.NewCopyInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for copy: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return domain.Copy{}, false
+	}
+	copy := input.Copy()
+	if copy.ItemType == "" {
+		copy.ItemType = config.DefaultItemType
+	}
+	return copy, true
+}
+
+func findCopy(w http.ResponseWriter, r *http.Request) (domain.Copy, bool) {
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var copies []domain.Copy
+	var getErr error
+	if parseErr == nil {
+		copies, getErr = circulationRepository.getCopiesByIds([]int64{id})
+	}
+	if getErr != nil {
+		logger.Error("Error while getting copy: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Copy{}, false
+	}
+	if len(copies) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Copy{}, false
+	}
+	return copies[0], true
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCopyHandlers(t *testing.T) {
+	TestSetup(t)
+	booksRepositoryGetMock = func(id string) ([]domain.Book, error) {
+		if id == "1" {
+			return []domain.Book{{Id: 1, Name: "Tehanu", Author: "Ursula K. Le Guin"}}, nil
+		}
+		return nil, nil
+	}
+	copies := map[int64]domain.Copy{10: {Id: 10, BookId: 1, Barcode: "31234000123456", Status: domain.CopyOnLoan, ItemType: "book"}}
+	hasBarcode := func(copy domain.Copy) bool {
+		for _, other := range copies {
+			if other.Barcode == copy.Barcode && other.Id != copy.Id {
+				return true
+			}
+		}
+		return false
+	}
+	circulationCopiesByBookIdsMock = func(bookIds []int64) ([]domain.Copy, error) {
+		var found []domain.Copy
+		for id := int64(10); id < int64(10+len(copies)); id++ {
+			if copies[id].BookId == bookIds[0] {
+				found = append(found, copies[id])
+			}
+		}
+		return found, nil
+	}
+	circulationCopiesByIdsMock = func(ids []int64) ([]domain.Copy, error) {
+		if copy, found := copies[ids[0]]; found {
+			return []domain.Copy{copy}, nil
+		}
+		return nil, nil
+	}
+	circulationAddCopyMock = func(copy domain.Copy) (*domain.Copy, error) {
+		if hasBarcode(copy) {
+			return nil, nil
+		}
+		copy.Id, copy.Status = int64(10+len(copies)), domain.CopyAvailable
+		copies[copy.Id] = copy
+		return &copy, nil
+	}
+	circulationUpdateCopyMock = func(copy domain.Copy) (bool, error) {
+		if hasBarcode(copy) {
+			return false, nil
+		}
+		copies[copy.Id] = copy
+		return true, nil
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/book/{id}/copies", BookCopiesHandler).Methods("GET", "POST")
+	router.HandleFunc("/copies/{id}", CopyHandler).Methods("GET", "PUT")
+
+	// Scenarios are sent by staff unless they are signed out.
+	scenarios := []struct {
+		name      string
+		method    string
+		path      string
+		data      string
+		signedOut bool
+		status    int
+		contains  string
+	}{
+		{name: "Add copy signed out", method: "POST", path: "/book/1/copies", data: `{"Barcode":"31234000123457"}`, signedOut: true, status: http.StatusUnauthorized},
+		{name: "Add copy", method: "POST", path: "/book/1/copies", data: `{"Barcode":"31234000123457"}`, status: http.StatusCreated, contains: `"Id":11,"BookId":1,"Barcode":"31234000123457","Status":"available","ItemType":"book"`},
+		{name: "Add v2 copy of an item type", method: "POST", path: "/v2/book/1/copies", data: `{"barcode":"31234000123458","itemType":"dvd"}`, status: http.StatusCreated, contains: `"itemType":"dvd"`},
+		{name: "Add copy with a barcode taken", method: "POST", path: "/book/1/copies", data: `{"Barcode":"31234000123456"}`, status: http.StatusConflict},
+		{name: "Add copy without a barcode", method: "POST", path: "/book/1/copies", data: `{"ItemType":"dvd"}`, status: http.StatusUnprocessableEntity},
+		{name: "Add copy of missing book", method: "POST", path: "/book/2/copies", data: `{"Barcode":"31234000123459"}`, status: http.StatusNotFound},
+		{name: "List copies signed out", method: "GET", path: "/v2/book/1/copies", signedOut: true, status: http.StatusOK, contains: `{"items":[{"id":10,`},
+		{name: "Get copy", method: "GET", path: "/copies/12", signedOut: true, status: http.StatusOK, contains: `"ItemType":"dvd"`},
+		{name: "Get missing copy", method: "GET", path: "/copies/13", status: http.StatusNotFound},
+		{name: "Update copy signed out", method: "PUT", path: "/copies/10", data: `{"Barcode":"31234000123456","ItemType":"reference"}`, signedOut: true, status: http.StatusUnauthorized},
+		{name: "Update copy", method: "PUT", path: "/v2/copies/10", data: `{"barcode":"31234000123456","itemType":"reference"}`, status: http.StatusOK, contains: `"status":"on_loan","itemType":"reference"`},
+		{name: "Update copy to a barcode taken", method: "PUT", path: "/copies/10", data: `{"Barcode":"31234000123457"}`, status: http.StatusConflict},
+		{name: "Update missing copy", method: "PUT", path: "/copies/13", data: `{"Barcode":"31234000123459"}`, status: http.StatusNotFound},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			r, _ := http.NewRequest(s.method, s.path, bytes.NewReader([]byte(s.data)))
+			if !s.signedOut {
+				asStaff(r)
+			}
+			w := httptest.NewRecorder()
+			if strings.HasPrefix(s.path, "/v2/") {
+				r.URL.Path = strings.TrimPrefix(s.path, "/v2")
+				dto.Use(dto.V2, router).ServeHTTP(w, r)
+			} else {
+				router.ServeHTTP(w, r)
+			}
+			if w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), s.contains) {
+				t.Errorf("Expected the body to contain %q, got %v", s.contains, w.Body.String())
+			}
+		})
+	}
+}
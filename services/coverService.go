@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-rest-webservices-book-library/blobs"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/covers"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	coverMaxAge       = "public, max-age=86400"
+	coverImmutableAge = "public, max-age=31536000, immutable"
+)
+
+type CoversRepository struct{}
+
+// CoversRepositoryInterface records which cover each book has, the images themselves are
+// kept in the blobStore.
+type CoversRepositoryInterface interface {
+	getCover(bookId int64) (*domain.Cover, error)
+	setCover(cover domain.Cover) (*domain.Cover, error)
+	deleteCover(bookId int64) (*domain.Cover, error)
+}
+
+var coversRepository CoversRepositoryInterface = CoversRepository{}
+
+// blobStore keeps the cover images and their thumbnails and the digital editions of
+// books, as blobs.store in config.yml tells.
+var blobStore blobs.Store
+
+func init() {
+	store, err := blobs.New()
+	if err != nil {
+		log.Fatal("Error while opening blob store " + err.Error())
+	}
+	blobStore = store
+}
+
+func (c CoversRepository) getCover(bookId int64) (*domain.Cover, error) {
+	return repository.GetCover(bookId)
+}
+
+func (c CoversRepository) setCover(cover domain.Cover) (*domain.Cover, error) {
+	return repository.SetCover(cover)
+}
+
+func (c CoversRepository) deleteCover(bookId int64) (*domain.Cover, error) {
+	return repository.DeleteCover(bookId)
+}
+
+// CoverHandler serves the cover of a book: GET writes the image, or one of its thumbnails
+// with ?size=, PUT replaces it with the JPEG, PNG or WebP image in the body and DELETE
+// removes it.
+func CoverHandler(w http.ResponseWriter, r *http.Request) {
+	mapper := dto.FromRequest(r)
+	book, found := findBook(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		getCoverHandler(w, r, mapper, book.Id)
+	case "PUT":
+		putCoverHandler(w, r, mapper, book.Id)
+	case "DELETE":
+		deleteCoverHandler(w, r, book.Id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// getCoverHandler writes a cover image. Its ETag changes with every upload, and a request
+// naming the Digest of the current upload with ?v= may be cached for good.
+func getCoverHandler(w http.ResponseWriter, r *http.Request, mapper dto.Mapper, bookId int64) {
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = covers.Original
+	}
+	if _, known := covers.Sizes[size]; !known && size != covers.Original {
+		var sizeErr *decoder.Error
+		sizeErr = sizeErr.Add("size", "must be one of "+strings.Join(coverSizes(), ", "))
+		logger.Error("Improper cover size: " + sizeErr.Error())
+		w.Header().Set("Content-Type", "application/json")
+		writeApiError(w, mapper, sizeErr.ApiError())
+		return
+	}
+
+	cover, getErr := coversRepository.getCover(bookId)
+	if getErr != nil {
+		logger.Error("Error while getting cover of book: " + strconv.FormatInt(bookId, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if cover == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	blob, blobErr := blobStore.Get(r.Context(), coverKey(*cover, size))
+	if blobErr != nil {
+		logger.Error("Error while reading cover of book: " + strconv.FormatInt(bookId, 10) + " with error: " + blobErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", coverContentType(*cover, size))
+	w.Header().Set("ETag", `"`+cover.Digest+"-"+size+`"`)
+	if r.URL.Query().Get("v") == cover.Digest {
+		w.Header().Set("Cache-Control", coverImmutableAge)
+	} else {
+		w.Header().Set("Cache-Control", coverMaxAge)
+	}
+	http.ServeContent(w, r, "", cover.UpdatedAt, bytes.NewReader(blob.Data))
+}
+
+func putCoverHandler(w http.ResponseWriter, r *http.Request, mapper dto.Mapper, bookId int64) {
+	w.Header().Set("Content-Type", "application/json")
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !covers.Supported(contentType) {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: covers.ErrUnsupported.Error(),
+		})
+		return
+	}
+
+	data, readErr := ioutil.ReadAll(io.LimitReader(r.Body, config.CoverMaxBytes+1))
+	if readErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > config.CoverMaxBytes {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: "cover exceeds " + strconv.FormatInt(config.CoverMaxBytes, 10) + " bytes",
+		})
+		return
+	}
+
+	image, decodeErr := covers.Decode(data, contentType)
+	if decodeErr != nil {
+		logger.Error("Improper cover passed for book: " + strconv.FormatInt(bookId, 10) + ": " + decodeErr.Error())
+		if errors.Is(decodeErr, covers.ErrMismatch) {
+			writeApiError(w, mapper, domain.ApiError{Status: http.StatusUnsupportedMediaType, Message: decodeErr.Error()})
+			return
+		}
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "body", Message: "must be a readable image: " + decodeErr.Error()}},
+		})
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	cover := domain.Cover{
+		BookId:      bookId,
+		ContentType: contentType,
+		Digest:      hex.EncodeToString(sum[:]),
+		Width:       image.Bounds().Dx(),
+		Height:      image.Bounds().Dy(),
+		Bytes:       int64(len(data)),
+		UpdatedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+	if storeErr := storeCover(r, cover, image, data); storeErr != nil {
+		logger.Error("Error while storing cover of book: " + strconv.FormatInt(bookId, 10) + " with error: " + storeErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	previous, setErr := coversRepository.setCover(cover)
+	if setErr != nil {
+		logger.Error("Error while saving cover of book: " + strconv.FormatInt(bookId, 10) + " with error: " + setErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if previous != nil && previous.Digest != cover.Digest {
+		deleteCoverBlobs(r.Context(), *previous)
+	}
+
+	logger.Info("Successfully uploaded cover of book: " + strconv.FormatInt(bookId, 10))
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Cover(cover)))
+}
+
+func deleteCoverHandler(w http.ResponseWriter, r *http.Request, bookId int64) {
+	deleted, deleteErr := coversRepository.deleteCover(bookId)
+	if deleteErr != nil {
+		logger.Error("Error while deleting cover of book: " + strconv.FormatInt(bookId, 10) + " with error: " + deleteErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if deleted == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	deleteCoverBlobs(r.Context(), *deleted)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeCover puts the uploaded image and a thumbnail of every size into the blobStore.
+func storeCover(r *http.Request, cover domain.Cover, image covers.Image, data []byte) error {
+	if err := blobStore.Put(r.Context(), coverKey(cover, covers.Original), blobs.Blob{Data: data, ContentType: cover.ContentType}); err != nil {
+		return err
+	}
+	for _, size := range coverSizes() {
+		if size == covers.Original {
+			continue
+		}
+		thumbnail, err := covers.Thumbnail(image, covers.Sizes[size])
+		if err != nil {
+			return err
+		}
+		blob := blobs.Blob{Data: thumbnail, ContentType: coverContentType(cover, size)}
+		if err = blobStore.Put(r.Context(), coverKey(cover, size), blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteCoverBlobs removes the images of a cover which was replaced or deleted. Failing
+// to do so only leaves unused blobs behind, so it is logged rather than reported.
+func deleteCoverBlobs(ctx context.Context, cover domain.Cover) {
+	for _, size := range coverSizes() {
+		if err := blobStore.Delete(ctx, coverKey(cover, size)); err != nil {
+			logger.Error("Error while deleting cover blob of book: " + strconv.FormatInt(cover.BookId, 10) + " with error: " + err.Error())
+		}
+	}
+}
+
+// coverKey names the blob of a cover image, below the digest of the upload so that a new
+// upload never overwrites an image which caches still hold.
+func coverKey(cover domain.Cover, size string) string {
+	return "covers/" + strconv.FormatInt(cover.BookId, 10) + "/" + cover.Digest + "/" + size +
+		covers.Extension(coverContentType(cover, size))
+}
+
+func coverContentType(cover domain.Cover, size string) string {
+	if size == covers.Original {
+		return cover.ContentType
+	}
+	return covers.ThumbnailType(cover.ContentType)
+}
+
+// coverSizes returns the thumbnail sizes in order along with the original.
+func coverSizes() []string {
+	sizes := []string{covers.Original}
+	for size := range covers.Sizes {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes[1:], func(i, j int) bool {
+		return covers.Sizes[sizes[i+1]] < covers.Sizes[sizes[j+1]]
+	})
+	return sizes
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/blobs"
+	"go-rest-webservices-book-library/domain"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// coversRepositoryMock keeps the covers it is given in memory.
+type coversRepositoryMock struct {
+	covers map[int64]domain.Cover
+}
+
+func (c coversRepositoryMock) getCover(bookId int64) (*domain.Cover, error) {
+	if cover, found := c.covers[bookId]; found {
+		return &cover, nil
+	}
+	return nil, nil
+}
+
+func (c coversRepositoryMock) setCover(cover domain.Cover) (*domain.Cover, error) {
+	previous, _ := c.getCover(cover.BookId)
+	c.covers[cover.BookId] = cover
+	return previous, nil
+}
+
+func (c coversRepositoryMock) deleteCover(bookId int64) (*domain.Cover, error) {
+	deleted, _ := c.getCover(bookId)
+	delete(c.covers, bookId)
+	return deleted, nil
+}
+
+func encodeCover(t *testing.T, contentType string) []byte {
+	var buffer bytes.Buffer
+	canvas := image.NewRGBA(image.Rect(0, 0, 400, 600))
+	if contentType == "image/png" {
+		_ = png.Encode(&buffer, canvas)
+	} else {
+		_ = jpeg.Encode(&buffer, canvas, nil)
+	}
+	return buffer.Bytes()
+}
+
+func TestCoverHandlers(t *testing.T) {
+	TestSetup(t)
+	coversRepository = coversRepositoryMock{covers: map[int64]domain.Cover{}}
+	blobStore = blobs.NewLocal(t.TempDir())
+	booksRepositoryGetMock = func(id string) ([]domain.Book, error) {
+		if id != "1" {
+			return nil, nil
+		}
+		return []domain.Book{{Id: 1, Name: "Book", Author: "Author"}}, nil
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/book/{id}/cover", CoverHandler).Methods("GET", "PUT", "DELETE")
+
+	cover := encodeCover(t, "image/png")
+	sum := sha256.Sum256(cover)
+	digest := hex.EncodeToString(sum[:])
+
+	// The scenarios run in order, each one seeing the cover the ones before it left.
+	scenarios := []struct {
+		name         string
+		method       string
+		path         string
+		headers      map[string]string
+		data         []byte
+		status       int
+		contentType  string
+		cacheControl string
+	}{
+		{name: "Get missing cover", method: "GET", path: "/book/1/cover", status: http.StatusNotFound},
+		{name: "Upload cover of missing book", method: "PUT", path: "/book/2/cover", headers: map[string]string{"Content-Type": "image/png"}, data: cover, status: http.StatusNotFound},
+		{name: "Upload GIF", method: "PUT", path: "/book/1/cover", headers: map[string]string{"Content-Type": "image/gif"}, data: []byte("GIF89a"), status: http.StatusUnsupportedMediaType},
+		{name: "Upload JPEG declared as PNG", method: "PUT", path: "/book/1/cover", headers: map[string]string{"Content-Type": "image/png"}, data: encodeCover(t, "image/jpeg"), status: http.StatusUnsupportedMediaType},
+		{name: "Upload truncated PNG", method: "PUT", path: "/book/1/cover", headers: map[string]string{"Content-Type": "image/png"}, data: cover[:40], status: http.StatusUnprocessableEntity},
+		{name: "Upload oversized cover", method: "PUT", path: "/book/1/cover", headers: map[string]string{"Content-Type": "image/png"}, data: append(cover, make([]byte, 5<<20)...), status: http.StatusRequestEntityTooLarge},
+		{name: "Upload cover", method: "PUT", path: "/book/1/cover", headers: map[string]string{"Content-Type": "image/png"}, data: cover, status: http.StatusOK, contentType: "application/json"},
+		{name: "Get cover", method: "GET", path: "/book/1/cover", status: http.StatusOK, contentType: "image/png", cacheControl: coverMaxAge},
+		{name: "Get thumbnail", method: "GET", path: "/book/1/cover?size=small", status: http.StatusOK, contentType: "image/png", cacheControl: coverMaxAge},
+		{name: "Get versioned thumbnail", method: "GET", path: "/book/1/cover?size=large&v=" + digest, status: http.StatusOK, contentType: "image/png", cacheControl: coverImmutableAge},
+		{name: "Get unknown size", method: "GET", path: "/book/1/cover?size=huge", status: http.StatusBadRequest},
+		{name: "Revalidate thumbnail", method: "GET", path: "/book/1/cover?size=small", headers: map[string]string{"If-None-Match": `"` + digest + `-small"`}, status: http.StatusNotModified},
+		{name: "Revalidate replaced thumbnail", method: "GET", path: "/book/1/cover?size=small", headers: map[string]string{"If-None-Match": `"` + digest + `-medium"`}, status: http.StatusOK},
+		{name: "Delete cover", method: "DELETE", path: "/book/1/cover", status: http.StatusNoContent},
+		{name: "Delete missing cover", method: "DELETE", path: "/book/1/cover", status: http.StatusNotFound},
+		{name: "Get deleted cover", method: "GET", path: "/book/1/cover?size=small", status: http.StatusNotFound},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			r, _ := http.NewRequest(s.method, s.path, bytes.NewReader(s.data))
+			for name, value := range s.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			if s.contentType != "" && w.Header().Get("Content-Type") != s.contentType {
+				t.Errorf("Expected content type %v, got %v", s.contentType, w.Header().Get("Content-Type"))
+			}
+			if s.cacheControl != "" && w.Header().Get("Cache-Control") != s.cacheControl {
+				t.Errorf("Expected Cache-Control %v, got %v", s.cacheControl, w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+
+	if _, err := blobStore.Get(context.Background(), "covers/1/"+digest+"/small.png"); err != blobs.ErrNotFound {
+		t.Errorf("Expected the images of a deleted cover to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"go-rest-webservices-book-library/domain"
+	"sync"
+)
+
+type loadersContextKey struct{}
+
+// batchFunc loads the values of every key at once. Keys without a value must be given
+// their empty value in the returned map.
+type batchFunc func(keys []interface{}) (map[interface{}]interface{}, error)
+
+// loader collects the keys requested by the resolvers of one level of a GraphQL query and
+// loads them with a single call to batch when the first of their thunks is resolved, so
+// a list of n books costs one query for their copies instead of n.
+type loader struct {
+	mu      sync.Mutex
+	batch   batchFunc
+	pending []interface{}
+	queued  map[interface{}]bool
+	results map[interface{}]interface{}
+	err     error
+}
+
+// loaders live for a single GraphQL request, so results are never served stale.
+type loaders struct {
+	books             *loader
+	booksByAuthor     *loader
+	copies            *loader
+	copiesByBook      *loader
+	holdsByBook       *loader
+	currentLoanByCopy *loader
+	loansByMember     *loader
+	members           *loader
+}
+
+func newLoader(batch batchFunc) *loader {
+	return &loader{batch: batch, queued: map[interface{}]bool{}, results: map[interface{}]interface{}{}}
+}
+
+func (l *loader) load(key interface{}) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, loaded := l.results[key]; !loaded && !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			results, err := l.batch(l.pending)
+			for key, value := range results {
+				l.results[key] = value
+			}
+			l.pending = nil
+			l.queued = map[interface{}]bool{}
+			if err != nil {
+				l.err = err
+			}
+		}
+		return l.results[key], l.err
+	}
+}
+
+func newLoaders() *loaders {
+	return &loaders{
+		books:             newLoader(batchBooks),
+		booksByAuthor:     newLoader(batchBooksByAuthor),
+		copies:            newLoader(batchCopies),
+		copiesByBook:      newLoader(batchCopiesByBook),
+		holdsByBook:       newLoader(batchHoldsByBook),
+		currentLoanByCopy: newLoader(batchCurrentLoanByCopy),
+		loansByMember:     newLoader(batchLoansByMember),
+		members:           newLoader(batchMembers),
+	}
+}
+
+func withLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersContextKey{}, newLoaders())
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	if l, ok := ctx.Value(loadersContextKey{}).(*loaders); ok {
+		return l
+	}
+	return newLoaders()
+}
+
+func batchBooks(keys []interface{}) (map[interface{}]interface{}, error) {
+	books, err := booksRepository.getBooksByIds(int64Keys(keys))
+	results := map[interface{}]interface{}{}
+	for _, book := range books {
+		results[book.Id] = book
+	}
+	return results, err
+}
+
+func batchBooksByAuthor(keys []interface{}) (map[interface{}]interface{}, error) {
+	authors := make([]string, len(keys))
+	results := map[interface{}]interface{}{}
+	for i, key := range keys {
+		authors[i] = key.(string)
+		results[key] = []domain.Book{}
+	}
+
+	books, err := booksRepository.getBooksByAuthors(authors)
+	for _, book := range books {
+		results[book.Author] = append(results[book.Author].([]domain.Book), book)
+	}
+	return results, err
+}
+
+func batchCopies(keys []interface{}) (map[interface{}]interface{}, error) {
+	copies, err := circulationRepository.getCopiesByIds(int64Keys(keys))
+	results := map[interface{}]interface{}{}
+	for _, copy := range copies {
+		results[copy.Id] = copy
+	}
+	return results, err
+}
+
+func batchCopiesByBook(keys []interface{}) (map[interface{}]interface{}, error) {
+	results := emptyLists(keys, []domain.Copy{})
+	copies, err := circulationRepository.getCopiesByBookIds(int64Keys(keys))
+	for _, copy := range copies {
+		results[copy.BookId] = append(results[copy.BookId].([]domain.Copy), copy)
+	}
+	return results, err
+}
+
+func batchHoldsByBook(keys []interface{}) (map[interface{}]interface{}, error) {
+	results := emptyLists(keys, []domain.Hold{})
+	holds, err := circulationRepository.getHoldsByBookIds(int64Keys(keys))
+	for _, hold := range holds {
+		results[hold.BookId] = append(results[hold.BookId].([]domain.Hold), hold)
+	}
+	return results, err
+}
+
+func batchCurrentLoanByCopy(keys []interface{}) (map[interface{}]interface{}, error) {
+	loans, err := circulationRepository.getCurrentLoansByCopyIds(int64Keys(keys))
+	results := map[interface{}]interface{}{}
+	for _, loan := range loans {
+		results[loan.CopyId] = loan
+	}
+	return results, err
+}
+
+func batchLoansByMember(keys []interface{}) (map[interface{}]interface{}, error) {
+	results := emptyLists(keys, []domain.Loan{})
+	loans, err := circulationRepository.getLoansByMemberIds(int64Keys(keys))
+	for _, loan := range loans {
+		results[loan.MemberId] = append(results[loan.MemberId].([]domain.Loan), loan)
+	}
+	return results, err
+}
+
+func batchMembers(keys []interface{}) (map[interface{}]interface{}, error) {
+	members, err := circulationRepository.getMembersByIds(int64Keys(keys))
+	results := map[interface{}]interface{}{}
+	for _, member := range members {
+		results[member.Id] = member
+	}
+	return results, err
+}
+
+func emptyLists(keys []interface{}, empty interface{}) map[interface{}]interface{} {
+	results := make(map[interface{}]interface{}, len(keys))
+	for _, key := range keys {
+		results[key] = empty
+	}
+	return results
+}
+
+func int64Keys(keys []interface{}) []int64 {
+	ids := make([]int64, len(keys))
+	for i, key := range keys {
+		ids[i] = key.(int64)
+	}
+	return ids
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/duplicates"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const duplicateRelation = "duplicate"
+
+// GetDuplicatesHandler lists the clusters of books which are probably the same title.
+func GetDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	books, getAllErr := booksRepository.getAllBooks()
+	if getAllErr != nil {
+		logger.Error("Error while getting all books for duplicates with error: " + getAllErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(dto.FromRequest(r).DuplicateClusters(duplicates.Clusters(books))))
+}
+
+// MergeBooksHandler merges the source books into the target book for staff and returns
+// the target. The target takes the cover of the first source having one when it has none,
+// and the images of the other covers of the sources are deleted.
+func MergeBooksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	merge, decodeErr := decodeMerge(r)
+	if decodeErr != nil {
+		logger.Error("Improper data passed for merge: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+
+	targetCover, sourceCovers, getErr := mergedCovers(merge)
+	if getErr != nil {
+		logger.Error("Error while getting covers of books merged into: " + strconv.FormatInt(merge.Target, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	target, mergeErr := booksRepository.mergeBooks(merge.Target, merge.Sources)
+	if mergeErr != nil {
+		logger.Error("Error while merging books into: " + strconv.FormatInt(merge.Target, 10) + " with error: " + mergeErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if target == nil {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "Sources", Message: "target and sources must all be existing books"}},
+		})
+		return
+	}
+
+	keepMergedCovers(r.Context(), target.Id, targetCover, sourceCovers)
+
+	logger.Info("Successfully merged books into: " + getString(target))
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Book(*target)))
+}
+
+// mergedCovers returns the cover of the target of a merge, nil when it has none, and those
+// of its sources, in order.
+func mergedCovers(merge domain.BookMerge) (*domain.Cover, []domain.Cover, error) {
+	targetCover, err := coversRepository.getCover(merge.Target)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sourceCovers []domain.Cover
+	for _, sourceId := range merge.Sources {
+		cover, err := coversRepository.getCover(sourceId)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cover != nil {
+			sourceCovers = append(sourceCovers, *cover)
+		}
+	}
+	return targetCover, sourceCovers, nil
+}
+
+// keepMergedCovers gives a merged target without a cover the first cover of its sources
+// which can be copied, and deletes the images of the covers of the sources, whose records
+// went with them. The books are merged by then, so failures are logged rather than
+// reported, at worst leaving the target without a cover or unused blobs behind.
+func keepMergedCovers(ctx context.Context, targetId int64, targetCover *domain.Cover, sourceCovers []domain.Cover) {
+	for _, cover := range sourceCovers {
+		if targetCover == nil {
+			kept := cover
+			kept.BookId = targetId
+			if err := copyCoverBlobs(ctx, cover, kept); err != nil {
+				logger.Error("Error while copying cover of book: " + strconv.FormatInt(cover.BookId, 10) + " with error: " + err.Error())
+			} else if _, err = coversRepository.setCover(kept); err != nil {
+				logger.Error("Error while saving cover of book: " + strconv.FormatInt(targetId, 10) + " with error: " + err.Error())
+				deleteCoverBlobs(ctx, kept)
+			} else {
+				targetCover = &kept
+			}
+		}
+		deleteCoverBlobs(ctx, cover)
+	}
+}
+
+func copyCoverBlobs(ctx context.Context, from domain.Cover, to domain.Cover) error {
+	for _, size := range coverSizes() {
+		blob, err := blobStore.Get(ctx, coverKey(from, size))
+		if err != nil {
+			return err
+		}
+		if err = blobStore.Put(ctx, coverKey(to, size), blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeMerge decodes and validates a merge in the representation of the API version
+// serving the request.
+func decodeMerge(r *http.Request) (domain.BookMerge, *decoder.Error) {
+	input := dto.FromRequest(r).NewMergeInput()
+	decodeErr := decodeValid(r, input)
+	if decodeErr != nil && decodeErr.Malformed {
+		return domain.BookMerge{}, decodeErr
+	}
+
+	merge := input.BookMerge()
+	if decodeErr == nil {
+		decodeErr = &decoder.Error{Status: http.StatusUnprocessableEntity}
+	}
+	seen := map[int64]bool{merge.Target: true}
+	for _, source := range merge.Sources {
+		if seen[source] {
+			decodeErr = decodeErr.Add("Sources", "must not repeat a book or contain the target")
+			break
+		}
+		seen[source] = true
+	}
+	if len(decodeErr.Violations) == 0 {
+		return merge, nil
+	}
+	return merge, decodeErr
+}
+
+// linkDuplicates warns about the books which a new book probably duplicates with a Link
+// header of relation "duplicate" for each. Failing to look for them does not fail the
+// request, the book is created either way.
+func linkDuplicates(w http.ResponseWriter, r *http.Request, book domain.Book) {
+	candidates, findErr := booksRepository.findDuplicateCandidates(book, duplicates.SearchTerms(book))
+	if findErr != nil {
+		logger.Error("Error while looking for duplicates of book: " + strconv.FormatInt(book.Id, 10) + " with error: " + findErr.Error())
+		return
+	}
+
+	for _, match := range duplicates.Find(book, candidates) {
+		logger.Info("Book: " + strconv.FormatInt(book.Id, 10) + " probably duplicates book: " + strconv.FormatInt(match.Book.Id, 10))
+		w.Header().Add("Link", "<"+r.URL.Path+"/"+strconv.FormatInt(match.Book.Id, 10)+">; rel=\""+duplicateRelation+"\"")
+	}
+}
+
+// redirectMergedBook answers requests for a book which was merged into another with a
+// redirect to that book, and with 404 otherwise.
+func redirectMergedBook(w http.ResponseWriter, r *http.Request, id string) {
+	targetId, getErr := booksRepository.getMergedInto(id)
+	if getErr != nil {
+		logger.Error("Error while getting merge of book: " + id + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if targetId == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	location := strings.TrimSuffix(r.URL.Path, id) + strconv.FormatInt(targetId, 10)
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-rest-webservices-book-library/blobs"
+	"go-rest-webservices-book-library/covers"
+	"go-rest-webservices-book-library/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMergeBooksHandler(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name   string
+		data   string
+		target *domain.Book
+		err    error
+		status int
+	}{
+		{
+			name:   "should merge books",
+			data:   `{"Target":1,"Sources":[2,3]}`,
+			target: &domain.Book{Id: 1, Name: "Book", Author: "Author"},
+			status: http.StatusOK,
+		},
+		{
+			name:   "should give 422 without sources",
+			data:   `{"Target":1,"Sources":[]}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "should give 422 for merging the target into itself",
+			data:   `{"Target":1,"Sources":[2,1]}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "should give 422 for a repeated source",
+			data:   `{"Target":1,"Sources":[2,2]}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "should give 422 for missing books",
+			data:   `{"Target":1,"Sources":[2]}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "should give 400 for bad data",
+			data:   `{"Target":1`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "should give 500 for database errors",
+			data:   `{"Target":1,"Sources":[2]}`,
+			err:    errors.New("error while merging"),
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			booksRepositoryMergeMock = func(targetId int64, sourceIds []int64) (*domain.Book, error) {
+				return scenario.target, scenario.err
+			}
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/books/merge", bytes.NewBufferString(scenario.data))
+			asStaff(r)
+			r.Header.Set("Content-Type", "application/json")
+			MergeBooksHandler(w, r)
+
+			if w.Code != scenario.status {
+				t.Errorf("Expected status code: %v, Got: %v, %v", scenario.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMergeBooksHandlerKeepsCovers(t *testing.T) {
+	TestSetup(t)
+	blobStore = blobs.NewLocal(t.TempDir())
+	ctx := context.Background()
+	putCover := func(repository coversRepositoryMock, cover domain.Cover) {
+		repository.covers[cover.BookId] = cover
+		for _, size := range coverSizes() {
+			_ = blobStore.Put(ctx, coverKey(cover, size), blobs.Blob{Data: []byte(cover.Digest), ContentType: cover.ContentType})
+		}
+	}
+	hasBlobs := func(cover domain.Cover) bool {
+		blob, err := blobStore.Get(ctx, coverKey(cover, covers.Original))
+		return err == nil && string(blob.Data) == cover.Digest
+	}
+	first := domain.Cover{BookId: 2, ContentType: "image/png", Digest: "first"}
+	second := domain.Cover{BookId: 3, ContentType: "image/jpeg", Digest: "second"}
+	own := domain.Cover{BookId: 1, ContentType: "image/png", Digest: "own"}
+
+	scenarios := []struct {
+		name   string
+		covers []domain.Cover
+		kept   domain.Cover
+	}{
+		{name: "should give the target the first cover of its sources", covers: []domain.Cover{first, second}, kept: domain.Cover{BookId: 1, ContentType: "image/png", Digest: "first"}},
+		{name: "should keep the cover of the target", covers: []domain.Cover{own, first, second}, kept: own},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			repository := coversRepositoryMock{covers: map[int64]domain.Cover{}}
+			coversRepository = repository
+			for _, cover := range scenario.covers {
+				putCover(repository, cover)
+			}
+			booksRepositoryMergeMock = func(targetId int64, sourceIds []int64) (*domain.Book, error) {
+				for _, sourceId := range sourceIds {
+					delete(repository.covers, sourceId)
+				}
+				return &domain.Book{Id: targetId, Name: "Book", Author: "Author"}, nil
+			}
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/books/merge", bytes.NewBufferString(`{"Target":1,"Sources":[2,3]}`))
+			asStaff(r)
+			MergeBooksHandler(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code: %v, Got: %v, %v", http.StatusOK, w.Code, w.Body.String())
+			}
+			if cover := repository.covers[1]; cover != scenario.kept || !hasBlobs(cover) {
+				t.Errorf("Expected the target to have cover %v, got %v", scenario.kept, cover)
+			}
+			if hasBlobs(first) || hasBlobs(second) {
+				t.Errorf("Expected the images of the sources to be deleted")
+			}
+		})
+	}
+}
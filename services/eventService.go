@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/events"
+	"go-rest-webservices-book-library/repository"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lastEventIdHeader = "Last-Event-ID"
+	lastEventIdQuery  = "lastEventId"
+	eventBatchSize    = 100
+)
+
+type EventsRepository struct{}
+
+type EventsRepositoryInterface interface {
+	getEventsAfter(sequence int64, limit int64) ([]events.Event, error)
+}
+
+// bookEvent is the representation of an event on the change feed, the book in the
+// representation of the API version.
+type bookEvent struct {
+	Sequence   int64       `json:"sequence"`
+	Type       events.Type `json:"type"`
+	OccurredAt time.Time   `json:"occurredAt"`
+	Book       interface{} `json:"book"`
+}
+
+var (
+	eventsRepository  EventsRepositoryInterface = EventsRepository{}
+	eventsBroker                                = events.Books
+	keepAliveInterval                           = 15 * time.Second
+
+	upgrader = websocket.Upgrader{CheckOrigin: checkOrigin}
+)
+
+func (e EventsRepository) getEventsAfter(sequence int64, limit int64) ([]events.Event, error) {
+	return repository.GetEventsAfter(sequence, limit)
+}
+
+// checkOrigin lets browsers open the change feed socket from the site of the API and from
+// the origins of cors.allowedOrigins only, as browsers do not apply CORS to WebSocket
+// handshakes. Clients other than browsers send no Origin and are let through.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if parsed, err := url.Parse(origin); err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range config.CorsAllowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// BookEventsHandler streams the change feed as Server-Sent Events. Reconnecting clients
+// send the Last-Event-ID header and are first sent every event they missed.
+func BookEventsHandler(w http.ResponseWriter, r *http.Request) {
+	mapper := dto.FromRequest(r)
+	lastSequence, parseErr := getLastEventId(r)
+	flusher, canFlush := w.(http.Flusher)
+	if parseErr != nil || !canFlush {
+		w.Header().Set("Content-Type", "application/json")
+		logger.Error("Improper change feed request")
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusBadRequest,
+			Message:    http.StatusText(http.StatusBadRequest),
+			Violations: []domain.Violation{{Field: lastEventIdHeader, Message: "must be a non-negative integer"}},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	streamErr := streamEvents(r.Context(), lastSequence,
+		func(event events.Event) error {
+			_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n",
+				event.Sequence, event.Type, getString(toBookEvent(mapper, event)))
+			flusher.Flush()
+			return err
+		},
+		func() error {
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+			return err
+		})
+	if streamErr != nil {
+		logger.Info("Change feed closed: " + streamErr.Error())
+	}
+}
+
+// BookEventsSocketHandler streams the change feed over a WebSocket, one JSON message per
+// event. Reconnecting clients pass the last sequence they saw as lastEventId.
+func BookEventsSocketHandler(w http.ResponseWriter, r *http.Request) {
+	mapper := dto.FromRequest(r)
+	lastSequence, parseErr := getLastEventId(r)
+	if parseErr != nil {
+		w.Header().Set("Content-Type", "application/json")
+		logger.Error("Improper change feed request")
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusBadRequest,
+			Message:    http.StatusText(http.StatusBadRequest),
+			Violations: []domain.Violation{{Field: lastEventIdQuery, Message: "must be a non-negative integer"}},
+		})
+		return
+	}
+
+	conn, upgradeErr := upgrader.Upgrade(w, r, nil)
+	if upgradeErr != nil {
+		logger.Error("Error while upgrading change feed to WebSocket: " + upgradeErr.Error())
+		return
+	}
+	defer conn.Close()
+
+	// Clients send nothing, reading is only needed to notice them closing the socket.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	streamErr := streamEvents(ctx, lastSequence,
+		func(event events.Event) error {
+			return conn.WriteJSON(toBookEvent(mapper, event))
+		},
+		func() error {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepAliveInterval))
+		})
+	if streamErr != nil {
+		logger.Info("Change feed closed: " + streamErr.Error())
+	}
+}
+
+// streamEvents sends the events of the log following lastSequence, then the events
+// published from then on, until ctx is done or send fails. Subscribers which fall behind
+// are disconnected by the broker, the missed events are then caught up from the log.
+func streamEvents(ctx context.Context, lastSequence int64, send func(events.Event) error, keepAlive func() error) error {
+	keepAliveTicker := time.NewTicker(keepAliveInterval)
+	defer keepAliveTicker.Stop()
+
+	for {
+		subscription, unsubscribe := eventsBroker.Subscribe()
+		sequence, err := sendEventLog(lastSequence, send)
+		if err != nil {
+			unsubscribe()
+			return err
+		}
+		lastSequence = sequence
+
+		err = sendPublished(ctx, subscription, &lastSequence, send, keepAlive, keepAliveTicker.C)
+		unsubscribe()
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+func sendEventLog(lastSequence int64, send func(events.Event) error) (int64, error) {
+	for {
+		bookEvents, err := eventsRepository.getEventsAfter(lastSequence, eventBatchSize)
+		if err != nil {
+			return lastSequence, err
+		}
+		for _, event := range bookEvents {
+			if err := send(event); err != nil {
+				return lastSequence, err
+			}
+			lastSequence = event.Sequence
+		}
+		if len(bookEvents) < eventBatchSize {
+			return lastSequence, nil
+		}
+	}
+}
+
+// sendPublished returns nil once ctx is done or the subscription is closed by the broker.
+func sendPublished(ctx context.Context, subscription <-chan events.Event, lastSequence *int64,
+	send func(events.Event) error, keepAlive func() error, ticks <-chan time.Time) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticks:
+			if err := keepAlive(); err != nil {
+				return err
+			}
+		case event, open := <-subscription:
+			if !open {
+				return nil
+			}
+			// Events recorded while the log was being sent arrive here as well.
+			if event.Sequence <= *lastSequence {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+			*lastSequence = event.Sequence
+		}
+	}
+}
+
+func getLastEventId(r *http.Request) (int64, error) {
+	text := r.Header.Get(lastEventIdHeader)
+	if text == "" {
+		text = r.URL.Query().Get(lastEventIdQuery)
+	}
+	if text == "" {
+		return 0, nil
+	}
+
+	sequence, err := strconv.ParseInt(text, 10, 64)
+	if err == nil && sequence < 0 {
+		err = strconv.ErrRange
+	}
+	return sequence, err
+}
+
+func toBookEvent(mapper dto.Mapper, event events.Event) bookEvent {
+	return bookEvent{Sequence: event.Sequence, Type: event.Type, OccurredAt: event.OccurredAt, Book: mapper.Book(event.Book)}
+}
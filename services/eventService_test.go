@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bufio"
+	"github.com/gorilla/websocket"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/events"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type eventsRepositoryMock struct{}
+
+var eventsRepositoryGetAfterMock func(sequence int64, limit int64) ([]events.Event, error)
+
+func (e eventsRepositoryMock) getEventsAfter(sequence int64, limit int64) ([]events.Event, error) {
+	return eventsRepositoryGetAfterMock(sequence, limit)
+}
+
+// mockEventLog serves the events following sequence 2 from the log and, once the feed
+// has subscribed, publishes one of them again along with a new one.
+func mockEventLog(t *testing.T) {
+	eventsRepository = eventsRepositoryMock{}
+	eventsBroker = events.NewBroker()
+	logged := []events.Event{
+		{Sequence: 3, Type: events.BookCreated, Book: domain.Book{Id: 1, Name: "Book", Author: "Author"}},
+		{Sequence: 4, Type: events.BookUpdated, Book: domain.Book{Id: 1, Name: "Book 2", Author: "Author"}},
+	}
+
+	eventsRepositoryGetAfterMock = func(sequence int64, limit int64) ([]events.Event, error) {
+		if sequence != 2 {
+			return []events.Event{}, nil
+		}
+		eventsBroker.Publish(logged[1])
+		eventsBroker.Publish(events.Event{Sequence: 5, Type: events.BookDeleted, Book: domain.Book{Id: 1}})
+		return logged, nil
+	}
+	t.Cleanup(func() {
+		eventsRepository = EventsRepository{}
+		eventsBroker = events.Books
+	})
+}
+
+func TestBookEventsHandlerResumes(t *testing.T) {
+	mockEventLog(t)
+	server := httptest.NewServer(http.HandlerFunc(BookEventsHandler))
+	defer server.Close()
+
+	r, _ := http.NewRequest("GET", server.URL, nil)
+	r.Header.Set("Last-Event-ID", "2")
+	response, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("Expected to connect to the feed, got %v", err)
+	}
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected content type text/event-stream, got %v", contentType)
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(response.Body)
+	for len(ids) < 3 && scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "id: ") {
+			ids = append(ids, strings.TrimPrefix(scanner.Text(), "id: "))
+		}
+	}
+	if strings.Join(ids, ",") != "3,4,5" {
+		t.Errorf("Expected events 3,4,5, got %v", ids)
+	}
+}
+
+func TestBookEventsSocketHandlerResumes(t *testing.T) {
+	mockEventLog(t)
+	server := httptest.NewServer(http.HandlerFunc(BookEventsSocketHandler))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?lastEventId=2", nil)
+	if err != nil {
+		t.Fatalf("Expected to connect to the feed, got %v", err)
+	}
+	defer conn.Close()
+
+	expected := []bookEvent{
+		{Sequence: 3, Type: events.BookCreated},
+		{Sequence: 4, Type: events.BookUpdated},
+		{Sequence: 5, Type: events.BookDeleted},
+	}
+	for _, event := range expected {
+		var received bookEvent
+		if err := conn.ReadJSON(&received); err != nil {
+			t.Fatalf("Expected event %v, got %v", event.Sequence, err)
+		}
+		if received.Sequence != event.Sequence || received.Type != event.Type {
+			t.Errorf("Expected %v %v, got %v %v", event.Sequence, event.Type, received.Sequence, received.Type)
+		}
+	}
+}
+
+func TestBookEventsSocketHandlerChecksOrigin(t *testing.T) {
+	mockEventLog(t)
+	server := httptest.NewServer(http.HandlerFunc(BookEventsSocketHandler))
+	defer server.Close()
+	origins := config.CorsAllowedOrigins
+	defer func() { config.CorsAllowedOrigins = origins }()
+	config.CorsAllowedOrigins = []string{"http://localhost:3000"}
+
+	scenarios := []struct {
+		name      string
+		origin    string
+		connected bool
+	}{
+		{name: "should let clients without an origin connect", connected: true},
+		{name: "should let the site of the API connect", origin: server.URL, connected: true},
+		{name: "should let an allowed origin connect", origin: "http://localhost:3000", connected: true},
+		{name: "should refuse other origins", origin: "https://evil.example"},
+		{name: "should refuse other ports of an allowed host", origin: "http://localhost:3001"},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			header := http.Header{}
+			if scenario.origin != "" {
+				header.Set("Origin", scenario.origin)
+			}
+			conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+			if conn != nil {
+				conn.Close()
+			}
+			if connected := err == nil; connected != scenario.connected {
+				t.Errorf("Expected connected to be %v, got %v", scenario.connected, err)
+			}
+			if !scenario.connected && (response == nil || response.StatusCode != http.StatusForbidden) {
+				t.Errorf("Expected the handshake to be refused with 403, got %v", response)
+			}
+		})
+	}
+}
+
+func TestBookEventsHandlerRejectsBadLastEventId(t *testing.T) {
+	scenarios := []scenario{
+		{name: "should reject a text Last-Event-ID", expectedString: "abc", status: http.StatusBadRequest},
+		{name: "should reject a negative Last-Event-ID", expectedString: "-1", status: http.StatusBadRequest},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/books/events", nil)
+			r.Header.Set("Last-Event-ID", scenario.expectedString)
+			BookEventsHandler(w, r)
+
+			if w.Code != scenario.status {
+				t.Errorf("Expected status code: %v, got %v", scenario.status, w.Code)
+			}
+		})
+	}
+}
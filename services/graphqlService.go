@@ -0,0 +1,496 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/validation"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultGraphqlLimit = 20
+	maxGraphqlLimit     = 100
+	keptWhenLeftOut     = "kept as it is when left out"
+)
+
+type graphqlRequest struct {
+	Query         string
+	Variables     map[string]interface{}
+	OperationName string
+}
+
+// author is the GraphQL view of the author string of books.
+type author struct {
+	Name string
+}
+
+// graphqlValidationError reports failed validation rules under the extensions of the
+// GraphQL error, in the same shape as the violations of the REST API.
+type graphqlValidationError struct {
+	fieldErrors validation.FieldErrors
+}
+
+// graphqlForbiddenError reports a member, or their loans, asked for by someone other than
+// staff or the member signed in, and changes to books asked for by anyone but staff.
+type graphqlForbiddenError struct{}
+
+type callerContextKey struct{}
+
+var graphqlSchema graphql.Schema
+
+func init() {
+	var err error
+	graphqlSchema, err = newGraphqlSchema()
+	if err != nil {
+		panic("invalid GraphQL schema: " + err.Error())
+	}
+}
+
+func GraphqlHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request graphqlRequest
+	decodeErr := json.NewDecoder(io.LimitReader(r.Body, config.MaxBodyBytes)).Decode(&request)
+	if decodeErr != nil || request.Query == "" {
+		logger.Error("Improper GraphQL request")
+		writeApiError(w, dto.FromRequest(r), domain.ApiError{
+			Status:     http.StatusBadRequest,
+			Message:    http.StatusText(http.StatusBadRequest),
+			Violations: []domain.Violation{{Field: "query", Message: "is required"}},
+		})
+		return
+	}
+	requestCaller, callerErr := callerOf(r)
+	if callerErr != nil {
+		logger.Error("Error while getting signed in member with error: " + callerErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        withLoaders(context.WithValue(r.Context(), callerContextKey{}, requestCaller)),
+	})
+	if result.HasErrors() {
+		logger.Info("GraphQL request finished with errors: " + getString(result.Errors))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(result))
+}
+
+func (g graphqlValidationError) Error() string {
+	return g.fieldErrors.Error()
+}
+
+func (g graphqlValidationError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":       "UNPROCESSABLE_ENTITY",
+		"violations": g.fieldErrors.Violations(),
+	}
+}
+
+func (g graphqlForbiddenError) Error() string {
+	return "staff credentials are required, or the session of the member concerned"
+}
+
+func (g graphqlForbiddenError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "FORBIDDEN"}
+}
+
+// callerFrom returns who makes the GraphQL request, no one unless the handler said so.
+func callerFrom(ctx context.Context) caller {
+	requestCaller, _ := ctx.Value(callerContextKey{}).(caller)
+	return requestCaller
+}
+
+// loadMember loads a member the caller may see, and fails the field otherwise.
+func loadMember(p graphql.ResolveParams, memberId int64) (interface{}, error) {
+	if !callerFrom(p.Context).may(memberId) {
+		return nil, graphqlForbiddenError{}
+	}
+	return loadersFrom(p.Context).members.load(memberId), nil
+}
+
+func newGraphqlSchema() (graphql.Schema, error) {
+	var bookType, authorType, copyType, memberType, loanType, holdType *graphql.Object
+
+	bookType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Book",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"isbn":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"publisher": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"year":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"pages":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"author": &graphql.Field{
+					Type: graphql.NewNonNull(authorType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return author{Name: p.Source.(domain.Book).Author}, nil
+					},
+				},
+				"copies": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(copyType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).copiesByBook.load(p.Source.(domain.Book).Id), nil
+					},
+				},
+				"holds": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(holdType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).holdsByBook.load(p.Source.(domain.Book).Id), nil
+					},
+				},
+			}
+		}),
+	})
+
+	authorType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Author",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"books": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).booksByAuthor.load(p.Source.(author).Name), nil
+					},
+				},
+			}
+		}),
+	})
+
+	copyType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Copy",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"barcode":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"status":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"itemType": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"book": &graphql.Field{
+					Type: bookType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).books.load(p.Source.(domain.Copy).BookId), nil
+					},
+				},
+				"currentLoan": &graphql.Field{
+					Type: loanType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).currentLoanByCopy.load(p.Source.(domain.Copy).Id), nil
+					},
+				},
+			}
+		}),
+	})
+
+	memberType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Member",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"email": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"loans": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(loanType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).loansByMember.load(p.Source.(domain.Member).Id), nil
+					},
+				},
+			}
+		}),
+	})
+
+	loanType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Loan",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"copy": &graphql.Field{
+					Type: copyType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).copies.load(p.Source.(domain.Loan).CopyId), nil
+					},
+				},
+				"member": &graphql.Field{
+					Type: memberType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadMember(p, p.Source.(domain.Loan).MemberId)
+					},
+				},
+				"loanedAt": timeField(func(source interface{}) *time.Time {
+					value := source.(domain.Loan).LoanedAt
+					return &value
+				}),
+				"dueAt": timeField(func(source interface{}) *time.Time {
+					value := source.(domain.Loan).DueAt
+					return &value
+				}),
+				"returnedAt": timeField(func(source interface{}) *time.Time {
+					return source.(domain.Loan).ReturnedAt
+				}),
+				"renewals": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			}
+		}),
+	})
+
+	holdType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Hold",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"book": &graphql.Field{
+					Type: bookType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersFrom(p.Context).books.load(p.Source.(domain.Hold).BookId), nil
+					},
+				},
+				"member": &graphql.Field{
+					Type: memberType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadMember(p, p.Source.(domain.Hold).MemberId)
+					},
+				},
+				"placedAt": timeField(func(source interface{}) *time.Time {
+					value := source.(domain.Hold).PlacedAt
+					return &value
+				}),
+			}
+		}),
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"book": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{"id": idArgument()},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFrom(p.Context).books.load(int64(p.Args["id"].(int))), nil
+				},
+			},
+			"books": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookType))),
+				Args: pageArguments(graphql.FieldConfigArgument{
+					"name":    &graphql.ArgumentConfig{Type: graphql.String, Description: "part of the name"},
+					"author":  &graphql.ArgumentConfig{Type: graphql.String, Description: "part of the author"},
+					"subject": &graphql.ArgumentConfig{Type: graphql.Int, Description: "a subject, the books tagged with it or a subject below it"},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter := domain.BookFilter{Name: stringArgument(p, "name"), Author: stringArgument(p, "author")}
+					if subject, ok := p.Args["subject"].(int); ok {
+						filter.Subject = int64(subject)
+					}
+					limit, offset := pageOf(p)
+					return booksRepository.findBooks(filter, limit, offset)
+				},
+			},
+			"authors": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(authorType))),
+				Args: pageArguments(graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.String, Description: "part of the name"},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, offset := pageOf(p)
+					names, err := booksRepository.getAuthors(stringArgument(p, "name"), limit, offset)
+					authors := make([]author, len(names))
+					for i, name := range names {
+						authors[i] = author{Name: name}
+					}
+					return authors, err
+				},
+			},
+			"member": &graphql.Field{
+				Type: memberType,
+				Args: graphql.FieldConfigArgument{"id": idArgument()},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadMember(p, int64(p.Args["id"].(int)))
+				},
+			},
+			"members": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(memberType))),
+				Args: pageArguments(graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.String, Description: "part of the name"},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !callerFrom(p.Context).staff {
+						return nil, graphqlForbiddenError{}
+					}
+					limit, offset := pageOf(p)
+					return circulationRepository.getMembers(stringArgument(p, "name"), limit, offset)
+				},
+			},
+			"loans": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(loanType))),
+				Args: pageArguments(graphql.FieldConfigArgument{
+					"memberId": &graphql.ArgumentConfig{Type: graphql.Int, Description: "the member signed in when left out, every member for staff"},
+					"current":  &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					requestCaller := callerFrom(p.Context)
+					memberId := requestCaller.memberId
+					if id, ok := p.Args["memberId"].(int); ok {
+						memberId = int64(id)
+					}
+					if !requestCaller.may(memberId) {
+						return nil, graphqlForbiddenError{}
+					}
+					limit, offset := pageOf(p)
+					return circulationRepository.getLoans(memberId, p.Args["current"].(bool), limit, offset)
+				},
+			},
+		},
+	})
+
+	bookArguments := graphql.FieldConfigArgument{
+		"name":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		"author":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		"isbn":      &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+		"publisher": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+		"year":      &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+		"pages":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+	}
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"addBook": &graphql.Field{
+				Type: bookType,
+				Args: bookArguments,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !callerFrom(p.Context).staff {
+						return nil, graphqlForbiddenError{}
+					}
+					book := domain.Book{
+						Name:      stringArgument(p, "name"),
+						Author:    stringArgument(p, "author"),
+						Isbn:      stringArgument(p, "isbn"),
+						Publisher: stringArgument(p, "publisher"),
+						Year:      intArgument(p, "year"),
+						Pages:     intArgument(p, "pages"),
+					}
+					if fieldErrors := validation.Validate(book); fieldErrors != nil {
+						return nil, graphqlValidationError{fieldErrors}
+					}
+
+					rowId, insertRecordErr := booksRepository.addBook(book)
+					book.Id = rowId
+					return book, insertRecordErr
+				},
+			},
+			"updateBook": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{
+					"id":        idArgument(),
+					"name":      bookArguments["name"],
+					"author":    bookArguments["author"],
+					"isbn":      &graphql.ArgumentConfig{Type: graphql.String, Description: keptWhenLeftOut},
+					"publisher": &graphql.ArgumentConfig{Type: graphql.String, Description: keptWhenLeftOut},
+					"year":      &graphql.ArgumentConfig{Type: graphql.Int, Description: keptWhenLeftOut},
+					"pages":     &graphql.ArgumentConfig{Type: graphql.Int, Description: keptWhenLeftOut},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !callerFrom(p.Context).staff {
+						return nil, graphqlForbiddenError{}
+					}
+					id := strconv.Itoa(p.Args["id"].(int))
+					books, getErr := booksRepository.getBook(id)
+					if getErr != nil || len(books) == 0 {
+						return nil, getErr
+					}
+					book := books[0]
+					book.Name, book.Author = stringArgument(p, "name"), stringArgument(p, "author")
+					if isbn, given := p.Args["isbn"].(string); given {
+						book.Isbn = isbn
+					}
+					if publisher, given := p.Args["publisher"].(string); given {
+						book.Publisher = publisher
+					}
+					if year, given := p.Args["year"].(int); given {
+						book.Year = year
+					}
+					if pages, given := p.Args["pages"].(int); given {
+						book.Pages = pages
+					}
+					if fieldErrors := validation.Validate(book); fieldErrors != nil {
+						return nil, graphqlValidationError{fieldErrors}
+					}
+
+					updateErr := booksRepository.updateBook(book, id)
+					return book, updateErr
+				},
+			},
+			"deleteBook": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{"id": idArgument()},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if !callerFrom(p.Context).staff {
+						return nil, graphqlForbiddenError{}
+					}
+					deleteErr := booksRepository.deleteBook(strconv.Itoa(p.Args["id"].(int)))
+					return deleteErr == nil, deleteErr
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func timeField(get func(source interface{}) *time.Time) *graphql.Field {
+	return &graphql.Field{
+		Type:        graphql.String,
+		Description: "RFC 3339 timestamp",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if value := get(p.Source); value != nil {
+				return value.UTC().Format(time.RFC3339), nil
+			}
+			return nil, nil
+		},
+	}
+}
+
+func idArgument() *graphql.ArgumentConfig {
+	return &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)}
+}
+
+func pageArguments(arguments graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	arguments["limit"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultGraphqlLimit}
+	arguments["offset"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0}
+	return arguments
+}
+
+func pageOf(p graphql.ResolveParams) (int64, int64) {
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	if limit <= 0 || limit > maxGraphqlLimit {
+		limit = maxGraphqlLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return int64(limit), int64(offset)
+}
+
+func stringArgument(p graphql.ResolveParams, name string) string {
+	value, _ := p.Args[name].(string)
+	return value
+}
+
+func intArgument(p graphql.ResolveParams, name string) int {
+	value, _ := p.Args[name].(int)
+	return value
+}
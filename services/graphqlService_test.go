@@ -0,0 +1,274 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-rest-webservices-book-library/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type circulationRepositoryMock struct{}
+
+type graphqlResponse struct {
+	Data   map[string]interface{}
+	Errors []struct {
+		Message    string
+		Extensions map[string]interface{}
+	}
+}
+
+var (
+	circulationCopiesByBookIdsMock       func(bookIds []int64) ([]domain.Copy, error)
+	circulationCopiesByIdsMock           func(ids []int64) ([]domain.Copy, error)
+	circulationAddCopyMock               func(copy domain.Copy) (*domain.Copy, error)
+	circulationUpdateCopyMock            func(copy domain.Copy) (bool, error)
+	circulationMembersByIdsMock          func(ids []int64) ([]domain.Member, error)
+	circulationMembersMock               func(name string, limit int64, offset int64) ([]domain.Member, error)
+	circulationCurrentLoansByCopyIdsMock func(copyIds []int64) ([]domain.Loan, error)
+	circulationLoansByMemberIdsMock      func(memberIds []int64) ([]domain.Loan, error)
+	circulationLoansMock                 func(memberId int64, currentOnly bool, limit int64, offset int64) ([]domain.Loan, error)
+	circulationHoldsByBookIdsMock        func(bookIds []int64) ([]domain.Hold, error)
+)
+
+func (c circulationRepositoryMock) getCopiesByBookIds(bookIds []int64) ([]domain.Copy, error) {
+	return circulationCopiesByBookIdsMock(bookIds)
+}
+
+func (c circulationRepositoryMock) getCopiesByIds(ids []int64) ([]domain.Copy, error) {
+	return circulationCopiesByIdsMock(ids)
+}
+
+func (c circulationRepositoryMock) addCopy(copy domain.Copy) (*domain.Copy, error) {
+	return circulationAddCopyMock(copy)
+}
+
+func (c circulationRepositoryMock) updateCopy(copy domain.Copy) (bool, error) {
+	return circulationUpdateCopyMock(copy)
+}
+
+func (c circulationRepositoryMock) getMembersByIds(ids []int64) ([]domain.Member, error) {
+	return circulationMembersByIdsMock(ids)
+}
+
+func (c circulationRepositoryMock) getMembers(name string, limit int64, offset int64) ([]domain.Member, error) {
+	return circulationMembersMock(name, limit, offset)
+}
+
+func (c circulationRepositoryMock) getCurrentLoansByCopyIds(copyIds []int64) ([]domain.Loan, error) {
+	return circulationCurrentLoansByCopyIdsMock(copyIds)
+}
+
+func (c circulationRepositoryMock) getLoansByMemberIds(memberIds []int64) ([]domain.Loan, error) {
+	return circulationLoansByMemberIdsMock(memberIds)
+}
+
+func (c circulationRepositoryMock) getLoans(memberId int64, currentOnly bool, limit int64, offset int64) ([]domain.Loan, error) {
+	return circulationLoansMock(memberId, currentOnly, limit, offset)
+}
+
+func (c circulationRepositoryMock) getHoldsByBookIds(bookIds []int64) ([]domain.Hold, error) {
+	return circulationHoldsByBookIdsMock(bookIds)
+}
+
+func TestGraphqlBatchesNestedFields(t *testing.T) {
+	books := []domain.Book{
+		{Id: 1, Name: "Dune", Author: "Frank Herbert"},
+		{Id: 2, Name: "Emma", Author: "Jane Austen"},
+		{Id: 3, Name: "Persuasion", Author: "Jane Austen"},
+	}
+	booksRepositoryFindMock = func(filter domain.BookFilter, limit int64, offset int64) ([]domain.Book, error) {
+		return books, nil
+	}
+
+	copyCalls := 0
+	circulationCopiesByBookIdsMock = func(bookIds []int64) ([]domain.Copy, error) {
+		copyCalls++
+		if len(bookIds) != len(books) {
+			t.Errorf("Expected the copies of %v books in one batch, got %v", len(books), bookIds)
+		}
+		return []domain.Copy{
+			{Id: 10, BookId: 1, Barcode: "B10", Status: domain.CopyOnLoan, ItemType: "dvd"},
+			{Id: 11, BookId: 3, Barcode: "B11", Status: domain.CopyAvailable},
+		}, nil
+	}
+
+	loanCalls := 0
+	circulationCurrentLoansByCopyIdsMock = func(copyIds []int64) ([]domain.Loan, error) {
+		loanCalls++
+		loanedAt := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+		return []domain.Loan{{Id: 20, CopyId: 10, MemberId: 30, LoanedAt: loanedAt, DueAt: loanedAt.AddDate(0, 0, 21), Renewals: 1}}, nil
+	}
+
+	response := executeGraphql(t, `{ books { id copies { barcode itemType currentLoan { dueAt renewals } } } }`)
+	if len(response.Errors) > 0 {
+		t.Fatalf("Expected no errors, got %v", response.Errors)
+	}
+	if copyCalls != 1 || loanCalls != 1 {
+		t.Errorf("Expected one call per level, got %v for copies and %v for loans", copyCalls, loanCalls)
+	}
+
+	resultBooks := response.Data["books"].([]interface{})
+	copies := resultBooks[0].(map[string]interface{})["copies"].([]interface{})
+	loan := copies[0].(map[string]interface{})["currentLoan"].(map[string]interface{})
+	if loan["dueAt"] != "2020-10-22T12:00:00Z" {
+		t.Errorf("Expected due date 2020-10-22T12:00:00Z, got %v", loan["dueAt"])
+	}
+	if copies[0].(map[string]interface{})["itemType"] != "dvd" || loan["renewals"] != 1.0 {
+		t.Errorf("Expected a dvd renewed once, got %v", copies[0])
+	}
+	if len(resultBooks[1].(map[string]interface{})["copies"].([]interface{})) != 0 {
+		t.Errorf("Expected no copies for the second book, got %v", resultBooks[1])
+	}
+}
+
+func TestGraphqlMutationValidation(t *testing.T) {
+	scenarios := []scenario{
+		{
+			name:           "should reject a book without name",
+			data:           []byte(`mutation { addBook(name: "", author: "Author") { id } }`),
+			expectedString: "Name",
+		},
+		{
+			name:           "should reject a book with a too long author",
+			data:           append(append([]byte(`mutation { addBook(name: "Book", author: "`), bytes.Repeat([]byte("a"), 256)...), []byte(`") { id } }`)...),
+			expectedString: "Author",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			response := executeGraphqlAs(t, string(scenario.data), staffToken)
+			if len(response.Errors) != 1 {
+				t.Fatalf("Expected one error, got %v", response.Errors)
+			}
+
+			extensions := response.Errors[0].Extensions
+			if extensions["code"] != "UNPROCESSABLE_ENTITY" {
+				t.Errorf("Expected code UNPROCESSABLE_ENTITY, got %v", extensions["code"])
+			}
+			violation := extensions["violations"].([]interface{})[0].(map[string]interface{})
+			if violation["Field"] != scenario.expectedString {
+				t.Errorf("Expected violation of %v, got %v", scenario.expectedString, violation)
+			}
+		})
+	}
+}
+
+func TestGraphqlUpdateBookKeepsArgumentsLeftOut(t *testing.T) {
+	TestSetup(t)
+	booksRepositoryGetMock = func(id string) ([]domain.Book, error) {
+		if id != "1" {
+			return nil, nil
+		}
+		return []domain.Book{{Id: 1, Name: "Emma", Author: "Austen", Isbn: "0-261-10221-4", Publisher: "Penguin", Year: 2003, Pages: 474}}, nil
+	}
+	var updated []domain.Book
+	booksRepositoryUpdateMock = func(book domain.Book, id string) error {
+		updated = append(updated, book)
+		return nil
+	}
+
+	response := executeGraphqlAs(t, `mutation { updateBook(id: 1, name: "Emma", author: "Jane Austen", pages: 480) { id } }`, staffToken)
+	if len(response.Errors) > 0 {
+		t.Fatalf("Expected no errors, got %v", response.Errors)
+	}
+	expected := domain.Book{Id: 1, Name: "Emma", Author: "Jane Austen", Isbn: "0-261-10221-4", Publisher: "Penguin", Year: 2003, Pages: 480}
+	if len(updated) != 1 || updated[0] != expected {
+		t.Errorf("Expected the book to be updated to %v, got %v", expected, updated)
+	}
+
+	response = executeGraphqlAs(t, `mutation { updateBook(id: 2, name: "Emma", author: "Jane Austen") { id } }`, staffToken)
+	if len(response.Errors) > 0 || response.Data["updateBook"] != nil || len(updated) != 1 {
+		t.Errorf("Expected a missing book not to be updated, got %v, %v", response, updated)
+	}
+}
+
+func TestGraphqlKeepsMembersToStaffAndThemselves(t *testing.T) {
+	TestSetup(t)
+	circulationMembersByIdsMock = func(ids []int64) ([]domain.Member, error) {
+		members := make([]domain.Member, len(ids))
+		for i, id := range ids {
+			members[i] = domain.Member{Id: id, Name: "Member", Email: "member@example.com"}
+		}
+		return members, nil
+	}
+	circulationMembersMock = func(name string, limit int64, offset int64) ([]domain.Member, error) {
+		return []domain.Member{{Id: 1, Name: "Member", Email: "member@example.com"}}, nil
+	}
+	var loansOf []int64
+	circulationLoansMock = func(memberId int64, currentOnly bool, limit int64, offset int64) ([]domain.Loan, error) {
+		loansOf = append(loansOf, memberId)
+		return nil, nil
+	}
+	session := signIn(t, 1)
+
+	scenarios := []struct {
+		name      string
+		query     string
+		token     string
+		forbidden bool
+	}{
+		{name: "member signed out", query: `{ member(id: 1) { email } }`, forbidden: true},
+		{name: "own member", query: `{ member(id: 1) { email } }`, token: session},
+		{name: "another member", query: `{ member(id: 2) { email } }`, token: session, forbidden: true},
+		{name: "another member as staff", query: `{ member(id: 2) { email } }`, token: staffToken},
+		{name: "members as a member", query: `{ members { email } }`, token: session, forbidden: true},
+		{name: "members as staff", query: `{ members { email } }`, token: staffToken},
+		{name: "every loan signed out", query: `{ loans { id } }`, forbidden: true},
+		{name: "own loans", query: `{ loans { id } }`, token: session},
+		{name: "loans of another member", query: `{ loans(memberId: 2) { id } }`, token: session, forbidden: true},
+		{name: "every loan as staff", query: `{ loans { id } }`, token: staffToken},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			response := executeGraphqlAs(t, s.query, s.token)
+			if s.forbidden && (len(response.Errors) != 1 || response.Errors[0].Extensions["code"] != "FORBIDDEN") {
+				t.Errorf("Expected a forbidden error, got %v", response)
+			}
+			if !s.forbidden && len(response.Errors) > 0 {
+				t.Errorf("Expected no errors, got %v", response.Errors)
+			}
+		})
+	}
+	if len(loansOf) != 2 || loansOf[0] != 1 || loansOf[1] != 0 {
+		t.Errorf("Expected the loans of the member signed in, then of everyone, got %v", loansOf)
+	}
+}
+
+func TestGraphqlHandlerRejectsMissingQuery(t *testing.T) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/graphql", bytes.NewBufferString(`{"variables":{}}`))
+	GraphqlHandler(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code: %v, got %v", http.StatusBadRequest, w.Code)
+	}
+}
+
+func executeGraphql(t *testing.T, query string) graphqlResponse {
+	return executeGraphqlAs(t, query, "")
+}
+
+// executeGraphqlAs runs a query with token as the bearer token, when there is one.
+func executeGraphqlAs(t *testing.T, query string, token string) graphqlResponse {
+	body, _ := json.Marshal(map[string]interface{}{"query": query})
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/graphql", bytes.NewBuffer(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	GraphqlHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code: %v, got %v", http.StatusOK, w.Code)
+	}
+	var response graphqlResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Expected a GraphQL response, got %v", w.Body.String())
+	}
+	return response
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/jobs"
+	"net/http"
+)
+
+// JobSchedulerInterface lists the background jobs with their runs and runs them when
+// asked to.
+type JobSchedulerInterface interface {
+	Jobs() ([]domain.Job, error)
+	RunJob(name string) (*domain.JobRun, error)
+}
+
+var jobScheduler JobSchedulerInterface = jobs.Library
+
+// GetJobsHandler lists the background jobs for staff, when they run next and their latest
+// runs.
+func GetJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	list, getErr := jobScheduler.Jobs()
+	if getErr != nil {
+		logger.Error("Error while getting jobs with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(list))
+}
+
+// RunJobHandler runs a job now for staff and writes the run once it is over, whether the
+// job succeeded or failed.
+func RunJobHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	if !authorizeStaff(w, r) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+
+	run, runErr := jobScheduler.RunJob(name)
+	switch runErr {
+	case nil:
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(run))
+	case jobs.ErrUnknownJob:
+		w.WriteHeader(http.StatusNotFound)
+	case jobs.ErrLocked:
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: runErr.Error()})
+	case jobs.ErrStopped:
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusServiceUnavailable, Message: runErr.Error()})
+	default:
+		logger.Error("Error while running job: " + name + " with error: " + runErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
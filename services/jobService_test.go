@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/jobs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type jobSchedulerMock struct{}
+
+func (j jobSchedulerMock) Jobs() ([]domain.Job, error) {
+	next := time.Date(2026, time.October, 14, 3, 30, 0, 0, time.UTC)
+	return []domain.Job{
+		{Name: "purge", Schedule: "30 3 * * *", NextRunAt: &next, Runs: []domain.JobRun{}},
+		{Name: "backup", Runs: []domain.JobRun{}},
+	}, nil
+}
+
+func (j jobSchedulerMock) RunJob(name string) (*domain.JobRun, error) {
+	switch name {
+	case "purge":
+		finishedAt := time.Now()
+		return &domain.JobRun{Id: 1, Job: name, Trigger: domain.TriggerManual, Status: domain.JobSucceeded, FinishedAt: &finishedAt, Message: "deleted 3 idempotency keys"}, nil
+	case "backup":
+		return nil, jobs.ErrLocked
+	case "overdue":
+		return nil, jobs.ErrStopped
+	case "holds":
+		return nil, errors.New("database is locked")
+	}
+	return nil, jobs.ErrUnknownJob
+}
+
+func TestJobHandlers(t *testing.T) {
+	TestSetup(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/jobs", GetJobsHandler).Methods("GET")
+	router.HandleFunc("/admin/jobs/{name}/run", RunJobHandler).Methods("POST")
+
+	scenarios := []struct {
+		name     string
+		method   string
+		path     string
+		status   int
+		contains string
+	}{
+		{name: "List jobs", method: "GET", path: "/admin/jobs", status: http.StatusOK, contains: `"NextRunAt":"2026-10-14T03:30:00Z"`},
+		{name: "Run job", method: "POST", path: "/admin/jobs/purge/run", status: http.StatusOK, contains: `"Status":"succeeded"`},
+		{name: "Run running job", method: "POST", path: "/admin/jobs/backup/run", status: http.StatusConflict, contains: "already running"},
+		{name: "Run job while stopping", method: "POST", path: "/admin/jobs/overdue/run", status: http.StatusServiceUnavailable},
+		{name: "Run job which errs", method: "POST", path: "/admin/jobs/holds/run", status: http.StatusInternalServerError},
+		{name: "Run missing job", method: "POST", path: "/admin/jobs/reindex/run", status: http.StatusNotFound},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			r, _ := http.NewRequest(s.method, s.path, nil)
+			asStaff(r)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), s.contains) {
+				t.Errorf("Expected the body to contain %q, got %v", s.contains, w.Body.String())
+			}
+		})
+	}
+}
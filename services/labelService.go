@@ -0,0 +1,267 @@
+package services
+
+import (
+	"go-rest-webservices-book-library/classification"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/labels"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// labelOptions is how labels are drawn, as the query of a request tells.
+type labelOptions struct {
+	symbology string
+	format    string
+	stock     labels.Stock
+	start     int
+}
+
+// BookLabelHandler draws the label of a copy of a book, the one in ?copy= or else its
+// first copy, as a PNG or SVG image the size of the labels of the stock.
+func BookLabelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	options, optionsErr := getLabelOptions(r, labels.FormatPng, []string{labels.FormatPng, labels.FormatSvg})
+	var copyId int64
+	if text := r.URL.Query().Get("copy"); text != "" {
+		var parseErr error
+		if copyId, parseErr = strconv.ParseInt(text, 10, 64); parseErr != nil || copyId <= 0 {
+			optionsErr = optionsErr.Add("copy", "must be a positive integer")
+		}
+	}
+	if optionsErr != nil {
+		logger.Error("Improper label parameters: " + optionsErr.Error())
+		writeApiError(w, mapper, optionsErr.ApiError())
+		return
+	}
+
+	book, found := findBook(w, r)
+	if !found {
+		return
+	}
+	copies, getErr := circulationRepository.getCopiesByBookIds([]int64{book.Id})
+	if getErr != nil {
+		logger.Error("Error while getting copies of book: " + strconv.FormatInt(book.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(copies) == 0 {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: "book has no copies to label"})
+		return
+	}
+	bookCopy := copies[0]
+	if copyId != 0 {
+		found = false
+		for _, candidate := range copies {
+			if candidate.Id == copyId {
+				bookCopy, found = candidate, true
+			}
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+
+	label, labelErr := copyLabel(book, bookCopy)
+	if labelErr != nil {
+		logger.Error("Error while getting subjects of book: " + strconv.FormatInt(book.Id, 10) + " with error: " + labelErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	image, renderErr := labels.Render(label, options.symbology, options.format, options.stock)
+	if renderErr != nil {
+		writeLabelError(w, mapper, renderErr)
+		return
+	}
+	writeLabels(w, image, options.format, "label-"+bookCopy.Barcode)
+}
+
+// LabelsHandler draws the labels of the copies in the body on sheets of label stock, a
+// PDF of as many pages as they take or a single sheet as a PNG or SVG image. ?start= skips
+// the labels already peeled off the first sheet.
+func LabelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	options, optionsErr := getLabelOptions(r, labels.FormatPdf, labels.Formats)
+	if optionsErr != nil {
+		logger.Error("Improper label parameters: " + optionsErr.Error())
+		writeApiError(w, mapper, optionsErr.ApiError())
+		return
+	}
+	input := mapper.NewLabelsInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for labels: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	copyIds := input.CopyIds()
+
+	copies, getErr := circulationRepository.getCopiesByIds(copyIds)
+	var books []domain.Book
+	if getErr == nil {
+		books, getErr = booksRepository.getBooksByIds(copyBookIds(copies))
+	}
+	if getErr != nil {
+		logger.Error("Error while getting copies to label with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	copiesById := map[int64]domain.Copy{}
+	for _, bookCopy := range copies {
+		copiesById[bookCopy.Id] = bookCopy
+	}
+	booksById := map[int64]domain.Book{}
+	for _, book := range books {
+		booksById[book.Id] = book
+	}
+
+	var unknown []string
+	for _, id := range copyIds {
+		if _, found := booksById[copiesById[id].BookId]; !found {
+			unknown = append(unknown, strconv.FormatInt(id, 10))
+		}
+	}
+	if unknown != nil {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "Copies", Message: "must be existing copies, unknown: " + strings.Join(unknown, ", ")}},
+		})
+		return
+	}
+
+	sheetLabels := make([]labels.Label, 0, len(copyIds))
+	for _, id := range copyIds {
+		bookCopy := copiesById[id]
+		label, labelErr := copyLabel(booksById[bookCopy.BookId], bookCopy)
+		if labelErr != nil {
+			logger.Error("Error while getting subjects of book: " + strconv.FormatInt(bookCopy.BookId, 10) + " with error: " + labelErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sheetLabels = append(sheetLabels, label)
+	}
+	sheet, renderErr := labels.Sheet(sheetLabels, options.symbology, options.format, options.stock, options.start)
+	if renderErr != nil {
+		writeLabelError(w, mapper, renderErr)
+		return
+	}
+	writeLabels(w, sheet, options.format, "labels")
+}
+
+// copyLabel is the label of a copy of book, with the call number its subjects and author
+// give it.
+func copyLabel(book domain.Book, bookCopy domain.Copy) (labels.Label, error) {
+	subjects, getErr := subjectsRepository.getBookSubjects(book.Id)
+	if getErr != nil {
+		return labels.Label{}, getErr
+	}
+	codes := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		codes = append(codes, subject.Code)
+	}
+	return labels.Label{
+		Barcode:    bookCopy.Barcode,
+		CallNumber: classification.CallNumber(codes, book.Author),
+		Title:      book.Name,
+	}, nil
+}
+
+func copyBookIds(copies []domain.Copy) []int64 {
+	seen := map[int64]bool{}
+	var bookIds []int64
+	for _, bookCopy := range copies {
+		if !seen[bookCopy.BookId] {
+			seen[bookCopy.BookId] = true
+			bookIds = append(bookIds, bookCopy.BookId)
+		}
+	}
+	sort.Slice(bookIds, func(i, j int) bool { return bookIds[i] < bookIds[j] })
+	return bookIds
+}
+
+// getLabelOptions reads the symbology, format, stock and start query parameters, each of
+// which may be left out.
+func getLabelOptions(r *http.Request, format string, formats []string) (labelOptions, *decoder.Error) {
+	query := r.URL.Query()
+	options := labelOptions{symbology: labels.SymbologyCode128, format: format, start: 1}
+	var optionsErr *decoder.Error
+
+	if symbology := query.Get("symbology"); symbology != "" {
+		options.symbology = symbology
+		if !contains(labels.Symbologies, symbology) {
+			optionsErr = optionsErr.Add("symbology", "must be one of "+strings.Join(labels.Symbologies, ", "))
+		}
+	}
+	if format := query.Get("format"); format != "" {
+		options.format = format
+		if !contains(formats, format) {
+			optionsErr = optionsErr.Add("format", "must be one of "+strings.Join(formats, ", "))
+		}
+	}
+
+	stockName := query.Get("stock")
+	if stockName == "" {
+		stockName = config.LabelStock
+	}
+	stock, found := labels.Stocks[stockName]
+	if !found {
+		names := make([]string, 0, len(labels.Stocks))
+		for name := range labels.Stocks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		optionsErr = optionsErr.Add("stock", "must be one of "+strings.Join(names, ", "))
+	}
+	options.stock = stock
+
+	if text := query.Get("start"); text != "" {
+		start, parseErr := strconv.Atoi(text)
+		if parseErr != nil || start < 1 || (found && start > stock.PerSheet()) {
+			optionsErr = optionsErr.Add("start", "must be a label of the sheet, from 1")
+		}
+		options.start = start
+	}
+	return options, optionsErr
+}
+
+// writeLabelError reports labels which cannot be drawn, such as a barcode which cannot be
+// encoded or more labels than fit an image.
+func writeLabelError(w http.ResponseWriter, mapper dto.Mapper, renderErr error) {
+	switch renderErr {
+	case labels.ErrUnencodable, labels.ErrTooLong, labels.ErrTooMany:
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Message: renderErr.Error()}},
+		})
+	default:
+		logger.Error("Error while drawing labels with error: " + renderErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func writeLabels(w http.ResponseWriter, data []byte, format string, name string) {
+	w.Header().Set("Content-Type", labels.ContentType(format))
+	w.Header().Set("Content-Disposition", `inline; filename="`+name+"."+format+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
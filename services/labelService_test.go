@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLabelHandlers(t *testing.T) {
+	TestSetup(t)
+	books := map[int64]domain.Book{
+		1: {Id: 1, Name: "The Go Programming Language", Author: "Alan Donovan & Brian Kernighan"},
+		2: {Id: 2, Name: "Without Copies", Author: "Author"},
+	}
+	copies := []domain.Copy{
+		{Id: 10, BookId: 1, Barcode: "31234000123456"},
+		{Id: 11, BookId: 1, Barcode: "31234000123457"},
+		{Id: 12, BookId: 3, Barcode: "31234000123458"},
+		{Id: 13, BookId: 1, Barcode: "Café"},
+	}
+	booksRepositoryGetMock = func(id string) ([]domain.Book, error) {
+		bookId, _ := strconv.ParseInt(id, 10, 64)
+		if book, ok := books[bookId]; ok {
+			return []domain.Book{book}, nil
+		}
+		return nil, nil
+	}
+	booksRepositoryByIdsMock = func(ids []int64) ([]domain.Book, error) {
+		var found []domain.Book
+		for _, id := range ids {
+			if book, ok := books[id]; ok {
+				found = append(found, book)
+			}
+		}
+		return found, nil
+	}
+	circulationCopiesByBookIdsMock = func(bookIds []int64) ([]domain.Copy, error) {
+		var found []domain.Copy
+		for _, bookCopy := range copies {
+			if bookCopy.BookId == bookIds[0] && bookCopy.Barcode != "Café" {
+				found = append(found, bookCopy)
+			}
+		}
+		return found, nil
+	}
+	circulationCopiesByIdsMock = func(ids []int64) ([]domain.Copy, error) {
+		var found []domain.Copy
+		for _, bookCopy := range copies {
+			if containsId(ids, bookCopy.Id) {
+				found = append(found, bookCopy)
+			}
+		}
+		return found, nil
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/book/{id}/label", BookLabelHandler).Methods("GET")
+	router.HandleFunc("/labels", LabelsHandler).Methods("POST")
+
+	scenarios := []struct {
+		name        string
+		method      string
+		path        string
+		data        string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{name: "Get label", method: "GET", path: "/book/1/label", status: http.StatusOK, contentType: "image/png", contains: "\x89PNG"},
+		{name: "Get SVG label of copy", method: "GET", path: "/book/1/label?copy=11&format=svg&symbology=qr", status: http.StatusOK, contentType: "image/svg+xml", contains: "31234000123457"},
+		{name: "Get label on other stock", method: "GET", path: "/book/1/label?format=svg&stock=avery-5160", status: http.StatusOK, contentType: "image/svg+xml", contains: `viewBox="0 0 66.675 25.4"`},
+		{name: "Get label of missing book", method: "GET", path: "/book/4/label", status: http.StatusNotFound},
+		{name: "Get label of copy of other book", method: "GET", path: "/book/1/label?copy=12", status: http.StatusNotFound},
+		{name: "Get label of book without copies", method: "GET", path: "/book/2/label", status: http.StatusConflict},
+		{name: "Get label as PDF", method: "GET", path: "/book/1/label?format=pdf", status: http.StatusBadRequest},
+		{name: "Get label of unknown symbology and stock", method: "GET", path: "/book/1/label?symbology=ean&stock=a4&copy=x", status: http.StatusBadRequest, contains: "avery-5160, avery-l7160"},
+		{name: "Print sheet", method: "POST", path: "/labels?start=20", data: `{"Copies":[10,11,11]}`, status: http.StatusOK, contentType: "application/pdf", contains: "/Count 2 "},
+		{name: "Print SVG sheet", method: "POST", path: "/labels?format=svg&symbology=qr", data: `{"Copies":[11,10]}`, status: http.StatusOK, contentType: "image/svg+xml", contains: `viewBox="0 0 210 297"`},
+		{name: "Print too many labels for an image", method: "POST", path: "/labels?format=png&start=21", data: `{"Copies":[10,11]}`, status: http.StatusUnprocessableEntity},
+		{name: "Print unknown copies", method: "POST", path: "/labels", data: `{"Copies":[10,14,15]}`, status: http.StatusUnprocessableEntity, contains: "unknown: 14, 15"},
+		{name: "Print unencodable barcode", method: "POST", path: "/labels", data: `{"Copies":[13]}`, status: http.StatusUnprocessableEntity, contains: "printable ASCII"},
+		{name: "Print no copies", method: "POST", path: "/labels", data: `{"Copies":[]}`, status: http.StatusUnprocessableEntity},
+		{name: "Print from past the end of the sheet", method: "POST", path: "/labels?start=22", data: `{"Copies":[10]}`, status: http.StatusBadRequest},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			r, _ := http.NewRequest(s.method, s.path, bytes.NewReader([]byte(s.data)))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			if s.contentType != "" && w.Header().Get("Content-Type") != s.contentType {
+				t.Errorf("Expected content type %v, got %v", s.contentType, w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Body.String(), s.contains) {
+				t.Errorf("Expected the body to contain %q", s.contains)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/circulation"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultMembersLimit = 50
+
+type LoansRepository struct{}
+
+// LoansRepositoryInterface lends copies and keeps the accounts of the fines members owe
+// for returning them late.
+type LoansRepositoryInterface interface {
+	checkOut(loan domain.Loan) (*domain.Loan, error)
+	getLoan(id int64) (*domain.Loan, error)
+	renewLoan(id int64, renewals int, dueAt time.Time) (bool, error)
+	returnLoan(loan domain.Loan, returnedAt time.Time, fine *domain.Fine) (bool, error)
+	getAccount(memberId int64) (domain.Account, error)
+	addPayment(payment domain.Payment) (*domain.Payment, error)
+}
+
+var loansRepository LoansRepositoryInterface = LoansRepository{}
+
+func (l LoansRepository) checkOut(loan domain.Loan) (*domain.Loan, error) {
+	return repository.CheckOut(loan)
+}
+
+func (l LoansRepository) getLoan(id int64) (*domain.Loan, error) {
+	return repository.GetLoan(id)
+}
+
+func (l LoansRepository) renewLoan(id int64, renewals int, dueAt time.Time) (bool, error) {
+	return repository.RenewLoan(id, renewals, dueAt)
+}
+
+func (l LoansRepository) returnLoan(loan domain.Loan, returnedAt time.Time, fine *domain.Fine) (bool, error) {
+	return repository.ReturnLoan(loan, returnedAt, fine)
+}
+
+func (l LoansRepository) getAccount(memberId int64) (domain.Account, error) {
+	return repository.GetAccount(memberId)
+}
+
+func (l LoansRepository) addPayment(payment domain.Payment) (*domain.Payment, error) {
+	return repository.AddPayment(payment)
+}
+
+// AddLoanHandler lends the copy in the body to the member in the body until the loan
+// policy of its item type has it due. Loans are made by staff.
+func AddLoanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	input := mapper.NewLoanInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for loan: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	loan := input.Loan()
+
+	copies, getErr := circulationRepository.getCopiesByIds([]int64{loan.CopyId})
+	var members []domain.Member
+	if getErr == nil {
+		members, getErr = circulationRepository.getMembersByIds([]int64{loan.MemberId})
+	}
+	if getErr != nil {
+		logger.Error("Error while getting copy and member of loan with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var violations []domain.Violation
+	if len(copies) == 0 {
+		violations = append(violations, domain.Violation{Field: "CopyId", Message: "must be an existing copy"})
+	}
+	if len(members) == 0 {
+		violations = append(violations, domain.Violation{Field: "MemberId", Message: "must be an existing member"})
+	}
+	if violations != nil {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: violations,
+		})
+		return
+	}
+
+	loan.LoanedAt = time.Now().UTC().Truncate(time.Second)
+	loan.DueAt = circulation.DueAt(loan.LoanedAt, circulation.Policy(copies[0].ItemType))
+	lent, checkOutErr := loansRepository.checkOut(loan)
+	if checkOutErr != nil {
+		logger.Error("Error while lending copy: " + strconv.FormatInt(loan.CopyId, 10) + " with error: " + checkOutErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if lent == nil {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: "copy is not available, or is kept for members ahead in line"})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(mapper.Loan(*lent)))
+}
+
+// LoanHandler writes a loan, to staff or its borrower.
+func LoanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	requestCaller, signedIn := signedInCaller(w, r)
+	if !signedIn {
+		return
+	}
+	if loan, found := findLoan(w, r); found && authorizeFor(w, r, requestCaller, loan.MemberId) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(dto.FromRequest(r).Loan(loan)))
+	}
+}
+
+// RenewLoanHandler renews a loan for another loan period, unless its policy forbids it or
+// other members hold the book. A hold of the borrower themselves does not count. Staff or
+// the borrower renew loans.
+func RenewLoanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	requestCaller, signedIn := signedInCaller(w, r)
+	if !signedIn {
+		return
+	}
+	loan, found := findLoan(w, r)
+	if !found || !authorizeFor(w, r, requestCaller, loan.MemberId) {
+		return
+	}
+	id := strconv.FormatInt(loan.Id, 10)
+
+	copies, getErr := circulationRepository.getCopiesByIds([]int64{loan.CopyId})
+	var holds []domain.Hold
+	if getErr == nil && len(copies) > 0 {
+		holds, getErr = circulationRepository.getHoldsByBookIds([]int64{copies[0].BookId})
+	}
+	if getErr != nil || len(copies) == 0 {
+		if getErr != nil {
+			logger.Error("Error while getting holds of loan: " + id + " with error: " + getErr.Error())
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	others := 0
+	for _, hold := range holds {
+		if hold.MemberId != loan.MemberId {
+			others++
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	dueAt, renewErr := circulation.Renew(loan, circulation.Policy(copies[0].ItemType), others, now)
+	if renewErr != nil {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: renewErr.Error()})
+		return
+	}
+	renewed, updateErr := loansRepository.renewLoan(loan.Id, loan.Renewals, dueAt)
+	if updateErr != nil {
+		logger.Error("Error while renewing loan: " + id + " with error: " + updateErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !renewed {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: "loan changed while it was renewed"})
+		return
+	}
+
+	loan.DueAt = dueAt
+	loan.Renewals++
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Loan(loan)))
+}
+
+// ReturnLoanHandler returns a loan, making its copy available again, and charges the
+// member the fine the loan policy sets when it is late. Loans are returned by staff.
+func ReturnLoanHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	if !authorizeStaff(w, r) {
+		return
+	}
+	loan, found := findLoan(w, r)
+	if !found {
+		return
+	}
+	id := strconv.FormatInt(loan.Id, 10)
+	if loan.ReturnedAt != nil {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: circulation.ErrReturned.Error()})
+		return
+	}
+
+	copies, getErr := circulationRepository.getCopiesByIds([]int64{loan.CopyId})
+	if getErr != nil || len(copies) == 0 {
+		if getErr != nil {
+			logger.Error("Error while getting copy of loan: " + id + " with error: " + getErr.Error())
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var fine *domain.Fine
+	if days, amount := circulation.Fine(loan, circulation.Policy(copies[0].ItemType), now); amount > 0 {
+		fine = &domain.Fine{LoanId: loan.Id, MemberId: loan.MemberId, Amount: amount, OverdueDays: days, AssessedAt: now}
+	}
+	returned, returnErr := loansRepository.returnLoan(loan, now, fine)
+	if returnErr != nil {
+		logger.Error("Error while returning loan: " + id + " with error: " + returnErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !returned {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: "loan changed while it was returned"})
+		return
+	}
+
+	loan.ReturnedAt = &now
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.LoanReturn(domain.LoanReturn{Loan: loan, Fine: fine})))
+}
+
+// GetMembersHandler pages through the members for staff, ?name= narrows them down to the
+// names containing it.
+func GetMembersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeStaff(w, r) {
+		return
+	}
+	mapper := dto.FromRequest(r)
+
+	limit, offset, pageErr := getPage(r)
+	if pageErr != nil {
+		logger.Error("Improper paging parameters: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	if limit == 0 {
+		limit = defaultMembersLimit
+	}
+
+	members, getErr := circulationRepository.getMembers(r.URL.Query().Get("name"), limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting members with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if members == nil {
+		members = []domain.Member{}
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Members(members)))
+}
+
+// MemberHandler writes a member, to staff or to the member signed in.
+func MemberHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeMember(w, r) {
+		return
+	}
+	if member, found := findMember(w, r); found {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(dto.FromRequest(r).Member(member)))
+	}
+}
+
+// MemberAccountHandler writes the fines and payments of a member and what they owe, to
+// staff or to the member signed in.
+func MemberAccountHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeMember(w, r) {
+		return
+	}
+	member, found := findMember(w, r)
+	if !found {
+		return
+	}
+
+	account, getErr := loansRepository.getAccount(member.Id)
+	if getErr != nil {
+		logger.Error("Error while getting account of member: " + strconv.FormatInt(member.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(dto.FromRequest(r).Account(account)))
+}
+
+// AddPaymentHandler records for staff a payment by a member, or a waiver of what they owe,
+// of no more than their balance.
+func AddPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeStaff(w, r) {
+		return
+	}
+	mapper := dto.FromRequest(r)
+	member, found := findMember(w, r)
+	if !found {
+		return
+	}
+
+	input := mapper.NewPaymentInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for payment: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	payment := input.Payment()
+	payment.MemberId = member.Id
+	payment.PaidAt = time.Now().UTC().Truncate(time.Second)
+
+	added, addErr := loansRepository.addPayment(payment)
+	if addErr != nil {
+		logger.Error("Error while adding payment of member: " + strconv.FormatInt(member.Id, 10) + " with error: " + addErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if added == nil {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "Amount", Message: "must not exceed the balance of the member"}},
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(mapper.Payment(*added)))
+}
+
+func findLoan(w http.ResponseWriter, r *http.Request) (domain.Loan, bool) {
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var loan *domain.Loan
+	var getErr error
+	if parseErr == nil {
+		loan, getErr = loansRepository.getLoan(id)
+	}
+	if getErr != nil {
+		logger.Error("Error while getting loan: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Loan{}, false
+	}
+	if loan == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Loan{}, false
+	}
+	return *loan, true
+}
+
+func findMember(w http.ResponseWriter, r *http.Request) (domain.Member, bool) {
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var members []domain.Member
+	var getErr error
+	if parseErr == nil {
+		members, getErr = circulationRepository.getMembersByIds([]int64{id})
+	}
+	if getErr != nil {
+		logger.Error("Error while getting member: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Member{}, false
+	}
+	if len(members) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Member{}, false
+	}
+	return members[0], true
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loansRepositoryMock keeps the loans, fines and payments it is given in memory, and which
+// copies are lent.
+type loansRepositoryMock struct {
+	loans    map[int64]domain.Loan
+	lent     map[int64]bool
+	fines    map[int64]domain.Fine
+	payments map[int64]domain.Payment
+}
+
+func newLoansRepositoryMock() loansRepositoryMock {
+	return loansRepositoryMock{
+		loans:    map[int64]domain.Loan{},
+		lent:     map[int64]bool{},
+		fines:    map[int64]domain.Fine{},
+		payments: map[int64]domain.Payment{},
+	}
+}
+
+func (l loansRepositoryMock) checkOut(loan domain.Loan) (*domain.Loan, error) {
+	if l.lent[loan.CopyId] {
+		return nil, nil
+	}
+	l.lent[loan.CopyId] = true
+	loan.Id = int64(len(l.loans) + 1)
+	l.loans[loan.Id] = loan
+	return &loan, nil
+}
+
+func (l loansRepositoryMock) getLoan(id int64) (*domain.Loan, error) {
+	if loan, found := l.loans[id]; found {
+		return &loan, nil
+	}
+	return nil, nil
+}
+
+func (l loansRepositoryMock) renewLoan(id int64, renewals int, dueAt time.Time) (bool, error) {
+	loan, found := l.loans[id]
+	if !found || loan.ReturnedAt != nil || loan.Renewals != renewals {
+		return false, nil
+	}
+	loan.DueAt = dueAt
+	loan.Renewals++
+	l.loans[id] = loan
+	return true, nil
+}
+
+func (l loansRepositoryMock) returnLoan(loan domain.Loan, returnedAt time.Time, fine *domain.Fine) (bool, error) {
+	stored, found := l.loans[loan.Id]
+	if !found || stored.ReturnedAt != nil || !stored.DueAt.Equal(loan.DueAt) {
+		return false, nil
+	}
+	stored.ReturnedAt = &returnedAt
+	l.loans[loan.Id] = stored
+	l.lent[loan.CopyId] = false
+	if fine != nil {
+		fine.Id = int64(len(l.fines) + 1)
+		l.fines[fine.Id] = *fine
+	}
+	return true, nil
+}
+
+func (l loansRepositoryMock) getAccount(memberId int64) (domain.Account, error) {
+	account := domain.Account{MemberId: memberId, Fines: []domain.Fine{}, Payments: []domain.Payment{}}
+	for id := int64(1); id <= int64(len(l.fines)); id++ {
+		if fine := l.fines[id]; fine.MemberId == memberId {
+			account.Fines = append(account.Fines, fine)
+			account.Balance += fine.Amount
+		}
+	}
+	for id := int64(1); id <= int64(len(l.payments)); id++ {
+		if payment := l.payments[id]; payment.MemberId == memberId {
+			account.Payments = append(account.Payments, payment)
+			account.Balance -= payment.Amount
+		}
+	}
+	return account, nil
+}
+
+func (l loansRepositoryMock) addPayment(payment domain.Payment) (*domain.Payment, error) {
+	account, _ := l.getAccount(payment.MemberId)
+	if payment.Amount > account.Balance {
+		return nil, nil
+	}
+	payment.Id = int64(len(l.payments) + 1)
+	l.payments[payment.Id] = payment
+	return &payment, nil
+}
+
+func TestLoanHandlers(t *testing.T) {
+	TestSetup(t)
+	loans := newLoansRepositoryMock()
+	loansRepository = loans
+	policies := config.LoanPolicies
+	defer func() { config.LoanPolicies = policies }()
+	config.LoanPolicies = map[string]config.LoanPolicy{
+		"book":      {LoanDays: 21, MaxRenewals: 2, GraceDays: 2, FinePerDay: 25, FineCap: 1000},
+		"reference": {LoanDays: 2, FinePerDay: 200, FineCap: 2000},
+	}
+	copies := []domain.Copy{
+		{Id: 10, BookId: 1, Barcode: "31234000123456", ItemType: "book"},
+		{Id: 11, BookId: 2, Barcode: "31234000123457", ItemType: "reference"},
+		{Id: 12, BookId: 3, Barcode: "31234000123458", ItemType: "dvd"},
+		{Id: 13, BookId: 1, Barcode: "31234000123459", ItemType: "book"},
+	}
+	circulationCopiesByIdsMock = func(ids []int64) ([]domain.Copy, error) {
+		var found []domain.Copy
+		for _, bookCopy := range copies {
+			if containsId(ids, bookCopy.Id) {
+				found = append(found, bookCopy)
+			}
+		}
+		return found, nil
+	}
+	circulationMembersByIdsMock = func(ids []int64) ([]domain.Member, error) {
+		if ids[0] == 1 || ids[0] == 2 {
+			return []domain.Member{{Id: ids[0], Name: "Member"}}, nil
+		}
+		return nil, nil
+	}
+	// Member 1 holds the book they borrow, which does not keep them from renewing it.
+	circulationHoldsByBookIdsMock = func(bookIds []int64) ([]domain.Hold, error) {
+		switch bookIds[0] {
+		case 1:
+			return []domain.Hold{{Id: 2, BookId: 1, MemberId: 1}}, nil
+		case 3:
+			return []domain.Hold{{Id: 1, BookId: 3, MemberId: 2}}, nil
+		}
+		return nil, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	day := 24 * time.Hour
+	// A book overdue by ten days, past its two grace days, a reference book overdue for
+	// longer than its fine cap and a DVD, which has no policy of its own, held by another
+	// member.
+	loans.loans[1] = domain.Loan{Id: 1, CopyId: 10, MemberId: 2, LoanedAt: now.Add(-31 * day), DueAt: now.Add(-10 * day)}
+	loans.loans[2] = domain.Loan{Id: 2, CopyId: 11, MemberId: 2, LoanedAt: now.Add(-40 * day), DueAt: now.Add(-38 * day)}
+	loans.loans[3] = domain.Loan{Id: 3, CopyId: 12, MemberId: 1, LoanedAt: now.Add(-day), DueAt: now.Add(20 * day)}
+	loans.lent[10], loans.lent[11], loans.lent[12] = true, true, true
+
+	members := newMembersRepositoryMock()
+	members.credentials[2] = &domain.Credentials{Member: domain.Member{Id: 2, Name: "Tenar", Email: "tenar@atuan.example"}}
+	membersRepository = members
+	borrower, other := signIn(t, 1), signIn(t, 2)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/loans", AddLoanHandler).Methods("POST")
+	router.HandleFunc("/loans/{id}", LoanHandler).Methods("GET")
+	router.HandleFunc("/loans/{id}/renew", RenewLoanHandler).Methods("POST")
+	router.HandleFunc("/loans/{id}/return", ReturnLoanHandler).Methods("POST")
+	router.HandleFunc("/members/{id}/account", MemberAccountHandler).Methods("GET")
+	router.HandleFunc("/members/{id}/payments", AddPaymentHandler).Methods("POST")
+
+	// Scenarios are sent by staff unless they are signed out or sent with a session.
+	dueAt := now.Add(21 * day).Format(time.RFC3339)
+	scenarios := []struct {
+		name      string
+		method    string
+		path      string
+		data      string
+		signedOut bool
+		session   string
+		status    int
+		contains  string
+	}{
+		{name: "Check out signed out", method: "POST", path: "/loans", data: `{"CopyId":13,"MemberId":1}`, signedOut: true, status: http.StatusUnauthorized},
+		{name: "Check out as a member", method: "POST", path: "/loans", data: `{"CopyId":13,"MemberId":1}`, session: borrower, status: http.StatusUnauthorized},
+		{name: "Check out", method: "POST", path: "/loans", data: `{"CopyId":13,"MemberId":1}`, status: http.StatusCreated, contains: dueAt},
+		{name: "Check out lent copy", method: "POST", path: "/loans", data: `{"CopyId":13,"MemberId":1}`, status: http.StatusConflict},
+		{name: "Check out unknown copy to unknown member", method: "POST", path: "/loans", data: `{"CopyId":14,"MemberId":3}`, status: http.StatusUnprocessableEntity, contains: "existing member"},
+		{name: "Check out nothing", method: "POST", path: "/loans", data: `{}`, status: http.StatusUnprocessableEntity},
+		{name: "Get loan", method: "GET", path: "/loans/4", status: http.StatusOK, contains: `"Renewals":0`},
+		{name: "Get own loan", method: "GET", path: "/loans/4", session: borrower, status: http.StatusOK},
+		{name: "Get loan of another member", method: "GET", path: "/loans/4", session: other, status: http.StatusForbidden},
+		{name: "Get loan signed out", method: "GET", path: "/loans/4", signedOut: true, status: http.StatusUnauthorized},
+		{name: "Get missing loan", method: "GET", path: "/loans/9", status: http.StatusNotFound},
+		{name: "Renew", method: "POST", path: "/loans/4/renew", status: http.StatusOK, contains: `"Renewals":1`},
+		{name: "Renew loan of another member", method: "POST", path: "/loans/4/renew", session: other, status: http.StatusForbidden},
+		{name: "Renew own loan", method: "POST", path: "/loans/4/renew", session: borrower, status: http.StatusOK, contains: `"Renewals":2`},
+		{name: "Renew past the limit", method: "POST", path: "/loans/4/renew", status: http.StatusConflict, contains: "renewed"},
+		{name: "Renew held book", method: "POST", path: "/loans/3/renew", status: http.StatusConflict, contains: "hold"},
+		{name: "Renew overdue loan", method: "POST", path: "/loans/1/renew", status: http.StatusConflict, contains: "overdue"},
+		{name: "Renew missing loan", method: "POST", path: "/loans/9/renew", status: http.StatusNotFound},
+		{name: "Return as a member", method: "POST", path: "/loans/4/return", session: borrower, status: http.StatusUnauthorized},
+		{name: "Return on time", method: "POST", path: "/v2/loans/4/return", status: http.StatusOK, contains: `"returnedAt"`},
+		{name: "Return overdue loan", method: "POST", path: "/loans/1/return", status: http.StatusOK, contains: `"Amount":250`},
+		{name: "Return loan overdue past the cap", method: "POST", path: "/loans/2/return", status: http.StatusOK, contains: `"Amount":2000`},
+		{name: "Return returned loan", method: "POST", path: "/loans/1/return", status: http.StatusConflict},
+		{name: "Check out returned copy", method: "POST", path: "/loans", data: `{"CopyId":10,"MemberId":2}`, status: http.StatusCreated},
+		{name: "Get account", method: "GET", path: "/members/2/account", status: http.StatusOK, contains: `"Balance":2250`},
+		{name: "Get account of missing member", method: "GET", path: "/members/3/account", status: http.StatusNotFound},
+		{name: "Pay", method: "POST", path: "/members/2/payments", data: `{"Amount":1000}`, status: http.StatusCreated, contains: `"Kind":"payment"`},
+		{name: "Waive", method: "POST", path: "/members/2/payments", data: `{"Kind":"waiver","Amount":250,"Note":"First time"}`, status: http.StatusCreated},
+		{name: "Pay more than owed", method: "POST", path: "/members/2/payments", data: `{"Amount":1001}`, status: http.StatusUnprocessableEntity, contains: "balance"},
+		{name: "Pay nothing", method: "POST", path: "/members/2/payments", data: `{"Amount":0}`, status: http.StatusUnprocessableEntity},
+		{name: "Pay by unknown kind", method: "POST", path: "/members/2/payments", data: `{"Kind":"gift","Amount":1}`, status: http.StatusUnprocessableEntity},
+		{name: "Get settled account", method: "GET", path: "/members/2/account", status: http.StatusOK, contains: `"Balance":1000`},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			r, _ := http.NewRequest(s.method, s.path, bytes.NewReader([]byte(s.data)))
+			if s.session != "" {
+				r.Header.Set("Authorization", "Bearer "+s.session)
+			} else if !s.signedOut {
+				asStaff(r)
+			}
+			w := httptest.NewRecorder()
+			if strings.HasPrefix(s.path, "/v2/") {
+				r.URL.Path = strings.TrimPrefix(s.path, "/v2")
+				dto.Use(dto.V2, router).ServeHTTP(w, r)
+			} else {
+				router.ServeHTTP(w, r)
+			}
+			if w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), s.contains) {
+				t.Errorf("Expected the body to contain %q, got %v", s.contains, w.Body.String())
+			}
+		})
+	}
+}
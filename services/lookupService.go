@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/lookup"
+	"go-rest-webservices-book-library/repository"
+	"go-rest-webservices-book-library/validation"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type LookupsRepository struct{}
+
+// LookupsRepositoryInterface caches the answers of the lookupProvider by ISBN-13.
+type LookupsRepositoryInterface interface {
+	getIsbnLookup(isbn string) (*domain.IsbnLookup, error)
+	setIsbnLookup(lookup domain.IsbnLookup) error
+}
+
+var lookupsRepository LookupsRepositoryInterface = LookupsRepository{}
+
+// lookupProvider finds the details of the books which are not cached yet, as
+// lookups.provider in config.yml tells.
+var lookupProvider lookup.Provider
+
+func init() {
+	provider, err := lookup.New()
+	if err != nil {
+		log.Fatal("Error while opening lookup provider " + err.Error())
+	}
+	lookupProvider = provider
+}
+
+func (l LookupsRepository) getIsbnLookup(isbn string) (*domain.IsbnLookup, error) {
+	return repository.GetIsbnLookup(isbn)
+}
+
+func (l LookupsRepository) setIsbnLookup(lookup domain.IsbnLookup) error {
+	return repository.SetIsbnLookup(lookup)
+}
+
+// BookLookupHandler writes the details the metadata provider has of the book with the
+// ISBN in ?isbn=, to prefill a new book.
+func BookLookupHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	isbn := r.URL.Query().Get("isbn")
+	if !validation.IsValidIsbn(isbn) {
+		var isbnErr *decoder.Error
+		isbnErr = isbnErr.Add("isbn", "is not a valid ISBN")
+		logger.Error("Improper isbn parameter: " + isbnErr.Error())
+		writeApiError(w, mapper, isbnErr.ApiError())
+		return
+	}
+
+	details, lookupErr := lookupIsbn(r.Context(), isbn)
+	if lookupErr != nil {
+		logger.Error("Error while looking up isbn: " + isbn + " with error: " + lookupErr.Error())
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusBadGateway, Message: "the metadata provider failed to answer"})
+		return
+	}
+	if details == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.BookDetails(*details)))
+}
+
+// lookupIsbn returns the details of the book with an ISBN, nil when the provider knows no
+// such book. Answers, including that one, are cached for lookups.cacheTtl, while failures
+// of the provider are not.
+func lookupIsbn(ctx context.Context, isbn string) (*domain.BookDetails, error) {
+	isbn = validation.NormalizeIsbn(isbn)
+	cached, getErr := lookupsRepository.getIsbnLookup(isbn)
+	if getErr != nil {
+		return nil, getErr
+	}
+	if cached != nil && time.Since(cached.FetchedAt) < config.LookupCacheTtl {
+		return cached.Details, nil
+	}
+
+	answer := domain.IsbnLookup{Isbn: isbn, FetchedAt: time.Now().UTC().Truncate(time.Second)}
+	details, lookupErr := lookupProvider.Lookup(ctx, isbn)
+	if lookupErr != nil && !errors.Is(lookupErr, lookup.ErrNotFound) {
+		return nil, lookupErr
+	}
+	if lookupErr == nil {
+		details.Isbn = isbn
+		details.FetchedAt = answer.FetchedAt
+		answer.Details = &details
+	}
+	if setErr := lookupsRepository.setIsbnLookup(answer); setErr != nil {
+		logger.Error("Error while caching lookup of isbn: " + isbn + " with error: " + setErr.Error())
+	}
+	return answer.Details, nil
+}
+
+// enrichBook fills the publisher, year and pages a new book leaves out from the details
+// the metadata provider has of its ISBN. The book is added as it is when the provider
+// knows nothing of it or fails, so enriching never stands in the way of cataloguing.
+func enrichBook(ctx context.Context, book *domain.Book) {
+	if book.Isbn == "" {
+		return
+	}
+	details, lookupErr := lookupIsbn(ctx, book.Isbn)
+	if lookupErr != nil {
+		logger.Error("Error while enriching book with isbn: " + book.Isbn + " with error: " + lookupErr.Error())
+		return
+	}
+	if details == nil {
+		return
+	}
+
+	// Providers are not held to the rules of the library, so what breaks them is left out.
+	found := domain.Book{Publisher: details.Publisher, Year: details.Year, Pages: details.Pages}
+	invalid := validation.ValidateFields(found, "Publisher", "Year", "Pages")
+	if book.Publisher == "" && invalid["Publisher"] == nil {
+		book.Publisher = found.Publisher
+	}
+	if book.Year == 0 && invalid["Year"] == nil {
+		book.Year = found.Year
+	}
+	if book.Pages == 0 && invalid["Pages"] == nil {
+		book.Pages = found.Pages
+	}
+}
+
+// getEnrich reads the ?enrich= flag of a new book.
+func getEnrich(r *http.Request) (bool, *decoder.Error) {
+	text := r.URL.Query().Get("enrich")
+	if text == "" {
+		return false, nil
+	}
+	enrich, parseErr := strconv.ParseBool(text)
+	if parseErr != nil {
+		var enrichErr *decoder.Error
+		return false, enrichErr.Add("enrich", "must be true or false")
+	}
+	return enrich, nil
+}
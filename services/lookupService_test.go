@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/lookup"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// lookupsRepositoryMock keeps the lookups it is given in memory.
+type lookupsRepositoryMock struct {
+	lookups map[string]domain.IsbnLookup
+}
+
+func (l lookupsRepositoryMock) getIsbnLookup(isbn string) (*domain.IsbnLookup, error) {
+	if cached, found := l.lookups[isbn]; found {
+		return &cached, nil
+	}
+	return nil, nil
+}
+
+func (l lookupsRepositoryMock) setIsbnLookup(lookup domain.IsbnLookup) error {
+	l.lookups[lookup.Isbn] = lookup
+	return nil
+}
+
+// openLibraryStandIn answers the Books API of Open Library for one book, counting the
+// requests it is sent.
+func openLibraryStandIn(t *testing.T, requests *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		switch r.URL.Query().Get("bibkeys") {
+		case "ISBN:9780547773742":
+			_, _ = w.Write([]byte(`{"ISBN:9780547773742":{"title":"A Wizard of Earthsea","authors":[{"name":"Ursula K. Le Guin"}],
+				"publishers":[{"name":"Houghton Mifflin Harcourt"}],"publish_date":"2012","number_of_pages":264}}`))
+		case "ISBN:9780306406157":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBookLookupHandler(t *testing.T) {
+	TestSetup(t)
+	var requests int
+	lookupProvider = lookup.NewOpenLibrary(openLibraryStandIn(t, &requests).URL, time.Second)
+
+	scenarios := []struct {
+		name     string
+		isbn     string
+		status   int
+		requests int
+	}{
+		{name: "Look up invalid ISBN", isbn: "0-547-77374-3", status: http.StatusBadRequest, requests: 0},
+		{name: "Look up ISBN", isbn: "978-0-547-77374-2", status: http.StatusOK, requests: 1},
+		{name: "Look up cached ISBN", isbn: "9780547773742", status: http.StatusOK, requests: 1},
+		{name: "Look up unknown ISBN", isbn: "9780140449136", status: http.StatusNotFound, requests: 2},
+		{name: "Look up cached unknown ISBN", isbn: "0-14-044913-2", status: http.StatusNotFound, requests: 2},
+		{name: "Look up ISBN when provider fails", isbn: "0-306-40615-2", status: http.StatusBadGateway, requests: 3},
+		{name: "Look up ISBN again when provider failed", isbn: "0-306-40615-2", status: http.StatusBadGateway, requests: 4},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			r, _ := http.NewRequest("POST", "/books/lookup?isbn="+s.isbn, nil)
+			w := httptest.NewRecorder()
+			BookLookupHandler(w, r)
+			if w.Code != s.status || requests != s.requests {
+				t.Fatalf("Expected status %v after %v requests, got %v after %v: %v", s.status, s.requests, w.Code, requests, w.Body.String())
+			}
+		})
+	}
+
+	r, _ := http.NewRequest("POST", "/books/lookup?isbn=9780547773742", nil)
+	w := httptest.NewRecorder()
+	BookLookupHandler(w, r)
+	var details domain.BookDetails
+	_ = json.Unmarshal(w.Body.Bytes(), &details)
+	if details.Title != "A Wizard of Earthsea" || details.Publisher != "Houghton Mifflin Harcourt" || details.Year != 2012 ||
+		details.Pages != 264 || details.Source != lookup.ProviderOpenLibrary {
+		t.Errorf("Expected the details of the book, got %v", w.Body.String())
+	}
+}
+
+func TestAddBookHandlerEnrichesBook(t *testing.T) {
+	TestSetup(t)
+	var requests int
+	lookupProvider = lookup.NewOpenLibrary(openLibraryStandIn(t, &requests).URL, time.Second)
+	var added domain.Book
+	booksRepositoryAddMock = func(book domain.Book) (int64, error) {
+		added = book
+		return 1, nil
+	}
+
+	scenarios := []struct {
+		name     string
+		query    string
+		data     string
+		status   int
+		expected domain.Book
+	}{
+		{name: "Add book without enriching", query: "", data: `{"Name":"Earthsea","Author":"Le Guin","Isbn":"9780547773742"}`,
+			status: http.StatusOK, expected: domain.Book{Id: 1, Name: "Earthsea", Author: "Le Guin", Isbn: "9780547773742"}},
+		{name: "Enrich book", query: "?enrich=true", data: `{"Name":"Earthsea","Author":"Le Guin","Isbn":"9780547773742","Pages":300}`,
+			status: http.StatusOK, expected: domain.Book{Id: 1, Name: "Earthsea", Author: "Le Guin", Isbn: "9780547773742",
+				Publisher: "Houghton Mifflin Harcourt", Year: 2012, Pages: 300}},
+		{name: "Enrich book without ISBN", query: "?enrich=true", data: `{"Name":"Earthsea","Author":"Le Guin"}`,
+			status: http.StatusOK, expected: domain.Book{Id: 1, Name: "Earthsea", Author: "Le Guin"}},
+		{name: "Enrich book when provider fails", query: "?enrich=1", data: `{"Name":"Book","Author":"Author","Isbn":"0-306-40615-2"}`,
+			status: http.StatusOK, expected: domain.Book{Id: 1, Name: "Book", Author: "Author", Isbn: "0-306-40615-2"}},
+		{name: "Enrich book with bad flag", query: "?enrich=yes", data: `{"Name":"Book","Author":"Author"}`, status: http.StatusBadRequest},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			added = domain.Book{}
+			r, _ := http.NewRequest("POST", "/book"+s.query, bytes.NewBufferString(s.data))
+			asStaff(r)
+			w := httptest.NewRecorder()
+			AddBookHandler(w, r)
+			if w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			s.expected.Id = 0
+			if added != s.expected {
+				t.Errorf("Expected %+v to be added, got %+v", s.expected, added)
+			}
+		})
+	}
+}
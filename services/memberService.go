@@ -0,0 +1,649 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/notifications"
+	"go-rest-webservices-book-library/repository"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMyLoansLimit = 50
+	tokenBytes          = 32
+	bearerPrefix        = "Bearer "
+)
+
+// accountLinks holds, for each account email, the purpose of the token it sends and the
+// path of the page of the site it links to.
+var accountLinks = map[string]struct{ purpose, path string }{
+	domain.TokenVerifyEmail:       {domain.TokenVerifyEmail, "/verify-email"},
+	domain.TokenResetPassword:     {domain.TokenResetPassword, "/reset-password"},
+	domain.EmailAlreadyRegistered: {domain.TokenResetPassword, "/reset-password"},
+}
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+	// pendingEmails counts the account emails being sent after their response.
+	pendingEmails sync.WaitGroup
+)
+
+// caller is who a request is made by, staff or a member, or no one when memberId is 0.
+type caller struct {
+	staff    bool
+	memberId int64
+}
+
+type MembersRepository struct{}
+
+// MembersRepositoryInterface keeps the credentials members sign in with and the tokens
+// they are issued, and the holds they place themselves.
+type MembersRepositoryInterface interface {
+	registerMember(member domain.Member, passwordHash string) (*domain.Member, error)
+	getCredentials(email string) (*domain.Credentials, error)
+	getProfile(memberId int64) (*domain.Profile, error)
+	addMemberToken(token domain.MemberToken) error
+	getTokenMember(hash string, purpose string, now time.Time) (int64, error)
+	deleteMemberToken(hash string) error
+	verifyEmail(hash string, now time.Time) (int64, error)
+	resetPassword(hash string, passwordHash string, now time.Time) (int64, error)
+	placeHold(hold domain.Hold) (*domain.Hold, error)
+}
+
+var membersRepository MembersRepositoryInterface = MembersRepository{}
+
+func (m MembersRepository) registerMember(member domain.Member, passwordHash string) (*domain.Member, error) {
+	return repository.RegisterMember(member, passwordHash)
+}
+
+func (m MembersRepository) getCredentials(email string) (*domain.Credentials, error) {
+	return repository.GetCredentials(email)
+}
+
+func (m MembersRepository) getProfile(memberId int64) (*domain.Profile, error) {
+	return repository.GetProfile(memberId)
+}
+
+func (m MembersRepository) addMemberToken(token domain.MemberToken) error {
+	return repository.AddMemberToken(token)
+}
+
+func (m MembersRepository) getTokenMember(hash string, purpose string, now time.Time) (int64, error) {
+	return repository.GetTokenMember(hash, purpose, now)
+}
+
+func (m MembersRepository) deleteMemberToken(hash string) error {
+	return repository.DeleteMemberToken(hash)
+}
+
+func (m MembersRepository) verifyEmail(hash string, now time.Time) (int64, error) {
+	return repository.VerifyEmail(hash, now)
+}
+
+func (m MembersRepository) resetPassword(hash string, passwordHash string, now time.Time) (int64, error) {
+	return repository.ResetPassword(hash, passwordHash, now)
+}
+
+func (m MembersRepository) placeHold(hold domain.Hold) (*domain.Hold, error) {
+	return repository.PlaceHold(hold)
+}
+
+type AccountMailer struct{}
+
+// AccountMailerInterface sends members the emails with the links to verify their email
+// and reset their password.
+type AccountMailerInterface interface {
+	send(email notifications.AccountEmail) error
+}
+
+var accountMailer AccountMailerInterface = AccountMailer{}
+
+// send loads the templates and the sender every time, as the notify job does, so that
+// changes to the templates on disk are picked up without a restart.
+func (a AccountMailer) send(email notifications.AccountEmail) error {
+	templates, err := notifications.LoadTemplates(config.NotificationTemplates)
+	if err != nil {
+		return err
+	}
+	sender, err := notifications.NewSender()
+	if err != nil {
+		return err
+	}
+	message, err := templates.RenderAccountEmail(email)
+	if err != nil {
+		return err
+	}
+	return sender.Send(message)
+}
+
+// RegisterHandler signs a member up and emails them the link to verify their email with,
+// which they must follow before they can sign in. When a member already has the email they
+// are emailed a link to reset their password instead, and the registration is answered
+// the same, so that it does not tell who has an account.
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	input := mapper.NewRegistrationInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for registration: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	registration := input.Registration()
+
+	passwordHash, hashed := hashPassword(w, mapper, registration.Password)
+	if !hashed {
+		return
+	}
+	member, registerErr := membersRepository.registerMember(domain.Member{Name: registration.Name, Email: registration.Email}, passwordHash)
+	if registerErr != nil {
+		logger.Error("Error while registering member with error: " + registerErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if member != nil {
+		sendAccountEmailLater(*member, domain.TokenVerifyEmail, config.VerificationTtl)
+	} else {
+		pendingEmails.Add(1)
+		go func(email string) {
+			defer pendingEmails.Done()
+			credentials, getErr := membersRepository.getCredentials(email)
+			if getErr != nil {
+				logger.Error("Error while getting credentials with error: " + getErr.Error())
+				return
+			}
+			if credentials != nil {
+				sendAccountEmail(credentials.Member, domain.EmailAlreadyRegistered, config.ResetTtl)
+			}
+		}(registration.Email)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmailHandler verifies the email of the member a verification token was sent to.
+// Tokens are used once.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	input := mapper.NewTokenInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for email verification: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	memberId, verifyErr := membersRepository.verifyEmail(hashToken(input.EmailToken()), time.Now().UTC())
+	if verifyErr != nil {
+		logger.Error("Error while verifying email with error: " + verifyErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if memberId == 0 {
+		writeInvalidToken(w, mapper)
+		return
+	}
+	writeProfile(w, mapper, memberId)
+}
+
+// LoginHandler signs a member in with their email and password. The session token is
+// returned, for clients to send as a bearer token, and set in the session cookie for
+// browsers.
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	input := mapper.NewLoginInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for login: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	login := input.Login()
+
+	credentials, getErr := membersRepository.getCredentials(login.Email)
+	if getErr != nil {
+		logger.Error("Error while getting credentials with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !passwordMatches(credentials, login.Password) {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusUnauthorized, Message: "email or password is incorrect"})
+		return
+	}
+	if credentials.VerifiedAt == nil {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusForbidden, Message: "email is not verified"})
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	token, issueErr := issueToken(credentials.Member.Id, domain.TokenSession, now, config.SessionTtl)
+	if issueErr != nil {
+		logger.Error("Error while signing in member: " + strconv.FormatInt(credentials.Member.Id, 10) + " with error: " + issueErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	session := domain.Session{Token: token, MemberId: credentials.Member.Id, ExpiresAt: now.Add(config.SessionTtl)}
+	http.SetCookie(w, sessionCookie(session.Token, session.ExpiresAt))
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Session(session)))
+}
+
+// LogoutHandler ends the session of the request, if it has one, and clears the session
+// cookie.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if token := sessionToken(r); token != "" {
+		if deleteErr := membersRepository.deleteMemberToken(hashToken(token)); deleteErr != nil {
+			logger.Error("Error while signing out with error: " + deleteErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, sessionCookie("", time.Unix(0, 0)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PasswordResetHandler emails a member the link to choose a new password with. It is
+// accepted whether or not a member has the email, so that it does not tell who does, and
+// the email is sent after answering, so that the time taken does not tell either.
+func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	input := mapper.NewEmailInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for password reset: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	credentials, getErr := membersRepository.getCredentials(input.Address())
+	if getErr != nil {
+		logger.Error("Error while getting credentials with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if credentials != nil {
+		sendAccountEmailLater(credentials.Member, domain.TokenResetPassword, config.ResetTtl)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ConfirmPasswordResetHandler sets the password of the member a reset token was sent to,
+// and signs them out everywhere.
+func ConfirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	input := mapper.NewPasswordResetInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for password reset: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	reset := input.PasswordReset()
+
+	passwordHash, hashed := hashPassword(w, mapper, reset.Password)
+	if !hashed {
+		return
+	}
+	memberId, resetErr := membersRepository.resetPassword(hashToken(reset.Token), passwordHash, time.Now().UTC())
+	if resetErr != nil {
+		logger.Error("Error while resetting password with error: " + resetErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if memberId == 0 {
+		writeInvalidToken(w, mapper)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MeHandler returns the signed in member.
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if profile, found := currentMember(w, r); found {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(dto.FromRequest(r).Profile(profile)))
+	}
+}
+
+// MyLoansHandler pages through the loans of the signed in member, only those still out
+// with ?current=true.
+func MyLoansHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	limit, offset, pageErr := getPage(r)
+	var currentOnly bool
+	if text := r.URL.Query().Get("current"); text != "" {
+		var parseErr error
+		if currentOnly, parseErr = strconv.ParseBool(text); parseErr != nil {
+			pageErr = pageErr.Add("current", "must be true or false")
+		}
+	}
+	if pageErr != nil {
+		logger.Error("Improper loan parameters: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	if limit == 0 {
+		limit = defaultMyLoansLimit
+	}
+	profile, found := currentMember(w, r)
+	if !found {
+		return
+	}
+
+	loans, getErr := circulationRepository.getLoans(profile.Id, currentOnly, limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting loans of member: " + strconv.FormatInt(profile.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if loans == nil {
+		loans = []domain.Loan{}
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Loans(loans)))
+}
+
+// AddMyHoldHandler places a hold for the signed in member on the book in the body.
+func AddMyHoldHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	profile, found := currentMember(w, r)
+	if !found {
+		return
+	}
+	input := mapper.NewHoldInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for hold: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+	hold := input.Hold()
+
+	books, getErr := booksRepository.getBook(strconv.FormatInt(hold.BookId, 10))
+	if getErr != nil {
+		logger.Error("Error while getting book of hold: " + strconv.FormatInt(hold.BookId, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(books) == 0 {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "BookId", Message: "must be an existing book"}},
+		})
+		return
+	}
+
+	hold.MemberId = profile.Id
+	hold.PlacedAt = time.Now().UTC().Truncate(time.Second)
+	placed, placeErr := membersRepository.placeHold(hold)
+	if placeErr != nil {
+		logger.Error("Error while placing hold on book: " + strconv.FormatInt(hold.BookId, 10) + " with error: " + placeErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if placed == nil {
+		writeApiError(w, mapper, domain.ApiError{Status: http.StatusConflict, Message: "book is already on hold for you"})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(mapper.Hold(*placed)))
+}
+
+// MyPreferencesHandler gets or replaces the notifications the signed in member gets by
+// email.
+func MyPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if profile, found := currentMember(w, r); found {
+		memberPreferences(w, r, profile.Id)
+	}
+}
+
+// currentMember returns the member signed in with the session of the request, and
+// answers 401 when there is none.
+func currentMember(w http.ResponseWriter, r *http.Request) (domain.Profile, bool) {
+	profile, getErr := sessionProfile(r)
+	if getErr != nil {
+		logger.Error("Error while getting signed in member with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Profile{}, false
+	}
+	if profile == nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeApiError(w, dto.FromRequest(r), domain.ApiError{Status: http.StatusUnauthorized, Message: "sign in to continue"})
+		return domain.Profile{}, false
+	}
+	return *profile, true
+}
+
+// sessionProfile returns the member signed in with the session of the request, or nil.
+func sessionProfile(r *http.Request) (*domain.Profile, error) {
+	token := sessionToken(r)
+	if token == "" {
+		return nil, nil
+	}
+	memberId, getErr := membersRepository.getTokenMember(hashToken(token), domain.TokenSession, time.Now().UTC())
+	if getErr != nil || memberId == 0 {
+		return nil, getErr
+	}
+	return membersRepository.getProfile(memberId)
+}
+
+// callerOf tells who makes a request, staff or the member signed in, without answering
+// anything when it is neither, for the handlers which also serve anonymous callers.
+func callerOf(r *http.Request) (caller, error) {
+	if isStaff(r) {
+		return caller{staff: true}, nil
+	}
+	profile, getErr := sessionProfile(r)
+	if getErr != nil || profile == nil {
+		return caller{}, getErr
+	}
+	return caller{memberId: profile.Id}, nil
+}
+
+// may tells whether the caller may see or act for a member.
+func (c caller) may(memberId int64) bool {
+	return c.staff || (c.memberId != 0 && c.memberId == memberId)
+}
+
+// authorizeStaff answers 401 unless the request carries the staff token as its bearer
+// token.
+func authorizeStaff(w http.ResponseWriter, r *http.Request) bool {
+	if isStaff(r) {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeApiError(w, dto.FromRequest(r), domain.ApiError{Status: http.StatusUnauthorized, Message: "staff credentials are required"})
+	return false
+}
+
+// authorizeMember lets staff through, and members signed in as the member of the path.
+// It answers 401 when no one is signed in, and 403 to other members.
+func authorizeMember(w http.ResponseWriter, r *http.Request) bool {
+	requestCaller, signedIn := signedInCaller(w, r)
+	if !signedIn {
+		return false
+	}
+	memberId, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	return authorizeFor(w, r, requestCaller, memberId)
+}
+
+// signedInCaller returns staff or the member signed in, and answers 401 when it is neither.
+func signedInCaller(w http.ResponseWriter, r *http.Request) (caller, bool) {
+	requestCaller, getErr := callerOf(r)
+	if getErr != nil {
+		logger.Error("Error while getting signed in member with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return caller{}, false
+	}
+	if !requestCaller.staff && requestCaller.memberId == 0 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeApiError(w, dto.FromRequest(r), domain.ApiError{Status: http.StatusUnauthorized, Message: "sign in to continue"})
+		return caller{}, false
+	}
+	return requestCaller, true
+}
+
+// authorizeFor answers 403 unless the caller may act for the member.
+func authorizeFor(w http.ResponseWriter, r *http.Request, requestCaller caller, memberId int64) bool {
+	if requestCaller.may(memberId) {
+		return true
+	}
+	writeApiError(w, dto.FromRequest(r), domain.ApiError{Status: http.StatusForbidden, Message: "members may only act for themselves"})
+	return false
+}
+
+// isStaff tells whether the bearer token of the request is the staff token, which grants
+// nothing while it is not configured.
+func isStaff(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if config.StaffToken == "" || !strings.HasPrefix(header, bearerPrefix) {
+		return false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(config.StaffToken)) == 1
+}
+
+// sessionToken returns the bearer token of the request, or else its session cookie.
+func sessionToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		return strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix))
+	}
+	if cookie, err := r.Cookie(config.SessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// sessionCookie keeps a session token until it expires, out of reach of scripts, and is
+// only sent along with requests from other sites when following links.
+func sessionCookie(token string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{Name: config.SessionCookie, Value: token, Path: "/", Expires: expires,
+		Secure: config.SecureCookies, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	if token == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// issueToken adds a random token for a member which expires after ttl, and returns it.
+// Only its hash is kept.
+func issueToken(memberId int64, purpose string, now time.Time, ttl time.Duration) (string, error) {
+	random := make([]byte, tokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	err := membersRepository.addMemberToken(domain.MemberToken{Hash: hashToken(token), MemberId: memberId, Purpose: purpose,
+		CreatedAt: now, ExpiresAt: now.Add(ttl)})
+	return token, err
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendAccountEmail emails a member the link of an account email, with a new token of the
+// purpose it sends. Failures are logged alone, as the member can ask for another email.
+func sendAccountEmail(member domain.Member, email string, ttl time.Duration) {
+	now := time.Now().UTC().Truncate(time.Second)
+	link := accountLinks[email]
+	token, issueErr := issueToken(member.Id, link.purpose, now, ttl)
+	if issueErr == nil {
+		address := strings.TrimSuffix(config.AccountUrl, "/") + link.path + "?token=" + url.QueryEscape(token)
+		issueErr = accountMailer.send(notifications.AccountEmail{Purpose: email, Member: member, Link: address, ExpiresAt: now.Add(ttl)})
+	}
+	if issueErr != nil {
+		logger.Error("Error while sending " + email + " email to member: " + strconv.FormatInt(member.Id, 10) + " with error: " + issueErr.Error())
+	}
+}
+
+// sendAccountEmailLater sends an account email after the response, so that the time taken
+// does not tell whether it was sent.
+func sendAccountEmailLater(member domain.Member, email string, ttl time.Duration) {
+	pendingEmails.Add(1)
+	go func() {
+		defer pendingEmails.Done()
+		sendAccountEmail(member, email, ttl)
+	}()
+}
+
+// hashPassword returns the bcrypt hash of a password, and answers 422 when it is longer
+// than the 72 bytes bcrypt takes.
+func hashPassword(w http.ResponseWriter, mapper dto.Mapper, password string) (string, bool) {
+	hash, hashErr := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if hashErr == bcrypt.ErrPasswordTooLong {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "Password", Message: "must be at most 72 bytes long"}},
+		})
+		return "", false
+	}
+	if hashErr != nil {
+		logger.Error("Error while hashing password with error: " + hashErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return "", false
+	}
+	return string(hash), true
+}
+
+// passwordMatches compares a password with a hash even when there are no credentials or
+// the member has no password, so that how long it takes does not tell who is a member.
+func passwordMatches(credentials *domain.Credentials, password string) bool {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not anyone's password"), bcrypt.DefaultCost)
+	})
+	if credentials == nil || credentials.PasswordHash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(credentials.PasswordHash), []byte(password)) == nil
+}
+
+func writeProfile(w http.ResponseWriter, mapper dto.Mapper, memberId int64) {
+	profile, getErr := membersRepository.getProfile(memberId)
+	if getErr != nil {
+		logger.Error("Error while getting member: " + strconv.FormatInt(memberId, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if profile == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Profile(*profile)))
+}
+
+func writeInvalidToken(w http.ResponseWriter, mapper dto.Mapper) {
+	writeApiError(w, mapper, domain.ApiError{
+		Status:     http.StatusUnprocessableEntity,
+		Message:    http.StatusText(http.StatusUnprocessableEntity),
+		Violations: []domain.Violation{{Field: "Token", Message: "must be a token which was not used and has not expired"}},
+	})
+}
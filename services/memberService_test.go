@@ -0,0 +1,264 @@
+package services
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/notifications"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// membersRepositoryMock knows member 1 of the notifications mock, who has no password,
+// until others register.
+type membersRepositoryMock struct {
+	credentials map[int64]*domain.Credentials
+	tokens      map[string]domain.MemberToken
+	holds       map[domain.Hold]bool
+}
+
+func newMembersRepositoryMock() membersRepositoryMock {
+	return membersRepositoryMock{
+		credentials: map[int64]*domain.Credentials{1: {Member: domain.Member{Id: 1, Name: "Ged", Email: "ged@roke.example"}}},
+		tokens:      map[string]domain.MemberToken{},
+		holds:       map[domain.Hold]bool{},
+	}
+}
+
+func (m membersRepositoryMock) registerMember(member domain.Member, passwordHash string) (*domain.Member, error) {
+	if found, _ := m.getCredentials(member.Email); found != nil {
+		return nil, nil
+	}
+	member.Id = int64(len(m.credentials) + 1)
+	m.credentials[member.Id] = &domain.Credentials{Member: member, PasswordHash: passwordHash}
+	return &member, nil
+}
+
+func (m membersRepositoryMock) getCredentials(email string) (*domain.Credentials, error) {
+	for _, credentials := range m.credentials {
+		if strings.EqualFold(credentials.Member.Email, email) {
+			found := *credentials
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m membersRepositoryMock) getProfile(memberId int64) (*domain.Profile, error) {
+	credentials, found := m.credentials[memberId]
+	if !found {
+		return nil, nil
+	}
+	return &domain.Profile{Id: memberId, Name: credentials.Member.Name, Email: credentials.Member.Email,
+		Verified: credentials.VerifiedAt != nil}, nil
+}
+
+func (m membersRepositoryMock) addMemberToken(token domain.MemberToken) error {
+	m.tokens[token.Hash] = token
+	return nil
+}
+
+func (m membersRepositoryMock) getTokenMember(hash string, purpose string, now time.Time) (int64, error) {
+	if token, found := m.tokens[hash]; found && token.Purpose == purpose && token.ExpiresAt.After(now) {
+		return token.MemberId, nil
+	}
+	return 0, nil
+}
+
+func (m membersRepositoryMock) deleteMemberToken(hash string) error {
+	delete(m.tokens, hash)
+	return nil
+}
+
+func (m membersRepositoryMock) verifyEmail(hash string, now time.Time) (int64, error) {
+	memberId, _ := m.getTokenMember(hash, domain.TokenVerifyEmail, now)
+	if memberId != 0 {
+		delete(m.tokens, hash)
+		m.credentials[memberId].VerifiedAt = &now
+	}
+	return memberId, nil
+}
+
+func (m membersRepositoryMock) resetPassword(hash string, passwordHash string, now time.Time) (int64, error) {
+	memberId, _ := m.getTokenMember(hash, domain.TokenResetPassword, now)
+	if memberId != 0 {
+		for other, token := range m.tokens {
+			if token.MemberId == memberId && token.Purpose != domain.TokenVerifyEmail {
+				delete(m.tokens, other)
+			}
+		}
+		m.credentials[memberId].PasswordHash = passwordHash
+		m.credentials[memberId].VerifiedAt = &now
+	}
+	return memberId, nil
+}
+
+func (m membersRepositoryMock) placeHold(hold domain.Hold) (*domain.Hold, error) {
+	key := domain.Hold{BookId: hold.BookId, MemberId: hold.MemberId}
+	if m.holds[key] {
+		return nil, nil
+	}
+	m.holds[key] = true
+	hold.Id = int64(len(m.holds))
+	return &hold, nil
+}
+
+// staffToken is the staff bearer token of the tests.
+const staffToken = "librarian"
+
+// accountMailerMock keeps the token of the latest email of each purpose.
+type accountMailerMock struct {
+	tokens map[string]string
+}
+
+func (a accountMailerMock) send(email notifications.AccountEmail) error {
+	link, err := url.Parse(email.Link)
+	if err != nil {
+		return err
+	}
+	a.tokens[email.Purpose] = link.Query().Get("token")
+	return nil
+}
+
+// asStaff sends a request with the staff token of the tests.
+func asStaff(r *http.Request) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+staffToken)
+	return r
+}
+
+// signIn starts a session of a member of the members mock and returns its token.
+func signIn(t *testing.T, memberId int64) string {
+	token, err := issueToken(memberId, domain.TokenSession, time.Now().UTC(), time.Hour)
+	if err != nil {
+		t.Fatalf("Expected a session, got %v", err)
+	}
+	return token
+}
+
+func TestMemberAccountHandlers(t *testing.T) {
+	TestSetup(t)
+	mailer := accountMailerMock{tokens: map[string]string{}}
+	accountMailer = mailer
+	booksRepositoryGetMock = func(id string) ([]domain.Book, error) {
+		if id == "7" {
+			return []domain.Book{{Id: 7, Name: "Tehanu", Author: "Ursula K. Le Guin"}}, nil
+		}
+		return nil, nil
+	}
+	circulationLoansMock = func(memberId int64, currentOnly bool, limit int64, offset int64) ([]domain.Loan, error) {
+		if memberId != 2 || currentOnly {
+			return nil, nil
+		}
+		return []domain.Loan{{Id: 4, CopyId: 9, MemberId: 2, Renewals: 1}}, nil
+	}
+	circulationMembersByIdsMock = func(ids []int64) ([]domain.Member, error) {
+		return []domain.Member{{Id: ids[0], Name: "Member"}}, nil
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/register", RegisterHandler).Methods("POST")
+	router.HandleFunc("/verify-email", VerifyEmailHandler).Methods("POST")
+	router.HandleFunc("/login", LoginHandler).Methods("POST")
+	router.HandleFunc("/logout", LogoutHandler).Methods("POST")
+	router.HandleFunc("/password-reset", PasswordResetHandler).Methods("POST")
+	router.HandleFunc("/password-reset/confirm", ConfirmPasswordResetHandler).Methods("POST")
+	router.HandleFunc("/me", MeHandler).Methods("GET")
+	router.HandleFunc("/me/loans", MyLoansHandler).Methods("GET")
+	router.HandleFunc("/me/holds", AddMyHoldHandler).Methods("POST")
+	router.HandleFunc("/me/preferences", MyPreferencesHandler).Methods("GET", "PUT")
+	router.HandleFunc("/members/{id}/account", MemberAccountHandler).Methods("GET")
+	router.HandleFunc("/members/{id}/payments", AddPaymentHandler).Methods("POST")
+
+	// Scenarios run in order, {verify}, {reset} and {session} stand for the latest tokens
+	// emailed and issued, and cookie sends the session as a cookie rather than a header.
+	var session string
+	scenarios := []struct {
+		name     string
+		method   string
+		path     string
+		data     string
+		session  string
+		cookie   bool
+		status   int
+		contains string
+	}{
+		{name: "Register", method: "POST", path: "/register", data: `{"Name":"Tenar","Email":"tenar@atuan.example","Password":"eaten one"}`, status: http.StatusAccepted},
+		{name: "Register a registered email", method: "POST", path: "/v2/register", data: `{"name":"Arha","email":"Tenar@Atuan.example","password":"eaten one"}`, status: http.StatusAccepted},
+		{name: "Register with too long a password", method: "POST", path: "/register", data: `{"Name":"Ogion","Email":"ogion@gont.example","Password":"` + strings.Repeat("é", 40) + `"}`, status: http.StatusUnprocessableEntity, contains: "72 bytes"},
+		{name: "Log in unverified", method: "POST", path: "/login", data: `{"Email":"tenar@atuan.example","Password":"eaten one"}`, status: http.StatusForbidden},
+		{name: "Verify email", method: "POST", path: "/v2/verify-email", data: `{"token":"{verify}"}`, status: http.StatusOK, contains: `"verified":true`},
+		{name: "Verify email again", method: "POST", path: "/verify-email", data: `{"Token":"{verify}"}`, status: http.StatusUnprocessableEntity},
+		{name: "Log in with a wrong password", method: "POST", path: "/login", data: `{"Email":"tenar@atuan.example","Password":"named one"}`, status: http.StatusUnauthorized},
+		{name: "Log in without a password", method: "POST", path: "/login", data: `{"Email":"ged@roke.example","Password":"sparrowhawk"}`, status: http.StatusUnauthorized},
+		{name: "Log in", method: "POST", path: "/v2/login", data: `{"email":"TENAR@atuan.example","password":"eaten one"}`, status: http.StatusOK, contains: `"memberId":2`},
+		{name: "Get me", method: "GET", path: "/me", session: "{session}", status: http.StatusOK, contains: `"Email":"tenar@atuan.example"`},
+		{name: "Get me with the cookie", method: "GET", path: "/v2/me", session: "{session}", cookie: true, status: http.StatusOK, contains: `"verified":true`},
+		{name: "Get me signed out", method: "GET", path: "/me", status: http.StatusUnauthorized},
+		{name: "List my loans", method: "GET", path: "/v2/me/loans", session: "{session}", status: http.StatusOK, contains: `{"items":[{"id":4,"copyId":9,"memberId":2,`},
+		{name: "List my current loans", method: "GET", path: "/me/loans?current=true", session: "{session}", status: http.StatusOK, contains: `[]`},
+		{name: "Place a hold", method: "POST", path: "/me/holds", data: `{"BookId":7}`, session: "{session}", status: http.StatusCreated, contains: `"BookId":7,"MemberId":2`},
+		{name: "Place the hold again", method: "POST", path: "/v2/me/holds", data: `{"bookId":7}`, session: "{session}", status: http.StatusConflict},
+		{name: "Place a hold on a missing book", method: "POST", path: "/me/holds", data: `{"BookId":8}`, session: "{session}", status: http.StatusUnprocessableEntity, contains: "existing book"},
+		{name: "Set my preferences", method: "PUT", path: "/me/preferences", data: `{"HoldReady":true}`, session: "{session}", cookie: true, status: http.StatusOK, contains: `"DueSoon":false,"Overdue":false,"HoldReady":true`},
+		{name: "Get my account", method: "GET", path: "/members/2/account", session: "{session}", status: http.StatusOK, contains: `"MemberId":2`},
+		{name: "Get the account of another member", method: "GET", path: "/members/1/account", session: "{session}", cookie: true, status: http.StatusForbidden},
+		{name: "Get an account signed out", method: "GET", path: "/members/2/account", status: http.StatusUnauthorized},
+		{name: "Get an account as staff", method: "GET", path: "/v2/members/1/account", session: staffToken, status: http.StatusOK, contains: `"memberId":1`},
+		{name: "Waive my own fines", method: "POST", path: "/members/2/payments", data: `{"Kind":"waiver","Amount":1}`, session: "{session}", status: http.StatusUnauthorized},
+		{name: "Log out", method: "POST", path: "/logout", session: "{session}", status: http.StatusNoContent},
+		{name: "Get me after logging out", method: "GET", path: "/me", session: "{session}", status: http.StatusUnauthorized},
+		{name: "Reset password of an unknown email", method: "POST", path: "/password-reset", data: `{"Email":"ogion@gont.example"}`, status: http.StatusAccepted},
+		{name: "Reset password", method: "POST", path: "/password-reset", data: `{"Email":"ged@roke.example"}`, status: http.StatusAccepted},
+		{name: "Confirm with a short password", method: "POST", path: "/password-reset/confirm", data: `{"Token":"{reset}","Password":"ged"}`, status: http.StatusUnprocessableEntity},
+		{name: "Confirm password reset", method: "POST", path: "/v2/password-reset/confirm", data: `{"token":"{reset}","password":"sparrowhawk"}`, status: http.StatusNoContent},
+		{name: "Confirm password reset again", method: "POST", path: "/password-reset/confirm", data: `{"Token":"{reset}","Password":"sparrowhawk"}`, status: http.StatusUnprocessableEntity},
+		{name: "Log in with the new password", method: "POST", path: "/login", data: `{"Email":"ged@roke.example","Password":"sparrowhawk"}`, status: http.StatusOK, contains: `"MemberId":1`},
+		{name: "Reset password from the registration email", method: "POST", path: "/password-reset/confirm", data: `{"Token":"{registered}","Password":"white lady"}`, status: http.StatusNoContent},
+		{name: "Log in with the password reset from the registration email", method: "POST", path: "/login", data: `{"Email":"tenar@atuan.example","Password":"white lady"}`, status: http.StatusOK, contains: `"MemberId":2`},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			pendingEmails.Wait()
+			tokens := strings.NewReplacer("{verify}", mailer.tokens[domain.TokenVerifyEmail],
+				"{reset}", mailer.tokens[domain.TokenResetPassword], "{registered}", mailer.tokens[domain.EmailAlreadyRegistered],
+				"{session}", session)
+			r, _ := http.NewRequest(s.method, s.path, bytes.NewReader([]byte(tokens.Replace(s.data))))
+			if s.cookie {
+				r.AddCookie(&http.Cookie{Name: config.SessionCookie, Value: tokens.Replace(s.session)})
+			} else if s.session != "" {
+				r.Header.Set("Authorization", "Bearer "+tokens.Replace(s.session))
+			}
+			w := httptest.NewRecorder()
+			if strings.HasPrefix(s.path, "/v2/") {
+				r.URL.Path = strings.TrimPrefix(r.URL.Path, "/v2")
+				dto.Use(dto.V2, router).ServeHTTP(w, r)
+			} else {
+				router.ServeHTTP(w, r)
+			}
+			if w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), s.contains) {
+				t.Errorf("Expected the body to contain %q, got %v", s.contains, w.Body.String())
+			}
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name != config.SessionCookie {
+					continue
+				}
+				if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+					t.Errorf("Expected an HTTP only, same site cookie, got %v", cookie)
+				}
+				// Logging out clears the cookie, the session is kept to check it ended.
+				if cookie.Value != "" {
+					session = cookie.Value
+				}
+			}
+		})
+	}
+}
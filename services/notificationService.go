@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
+	"net/http"
+	"strconv"
+)
+
+const defaultNotificationsLimit = 50
+
+type NotificationsRepository struct{}
+
+// NotificationsRepositoryInterface keeps the notifications members want and those they
+// were sent.
+type NotificationsRepositoryInterface interface {
+	getNotificationPreferences(memberId int64) (*domain.NotificationPreferences, error)
+	setNotificationPreferences(preferences domain.NotificationPreferences) error
+	getNotifications(memberId int64, limit int64, offset int64) ([]domain.Notification, error)
+}
+
+var notificationsRepository NotificationsRepositoryInterface = NotificationsRepository{}
+
+func (n NotificationsRepository) getNotificationPreferences(memberId int64) (*domain.NotificationPreferences, error) {
+	return repository.GetNotificationPreferences(memberId)
+}
+
+func (n NotificationsRepository) setNotificationPreferences(preferences domain.NotificationPreferences) error {
+	return repository.SetNotificationPreferences(preferences)
+}
+
+func (n NotificationsRepository) getNotifications(memberId int64, limit int64, offset int64) ([]domain.Notification, error) {
+	return repository.GetNotifications(memberId, limit, offset)
+}
+
+// NotificationPreferencesHandler gets or replaces the notifications a member gets by
+// email, for staff or the member signed in.
+func NotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeMember(w, r) {
+		return
+	}
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if parseErr != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	memberPreferences(w, r, id)
+}
+
+// memberPreferences gets the preferences of a member, or replaces them on PUT once the
+// member is found.
+func memberPreferences(w http.ResponseWriter, r *http.Request, memberId int64) {
+	mapper := dto.FromRequest(r)
+	preferences, getErr := notificationsRepository.getNotificationPreferences(memberId)
+	if getErr != nil {
+		logger.Error("Error while getting preferences of member: " + strconv.FormatInt(memberId, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if preferences == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "PUT" {
+		input := mapper.NewPreferencesInput()
+		if decodeErr := decodeValid(r, input); decodeErr != nil {
+			logger.Error("Improper data passed for preferences: " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		update := input.NotificationPreferences()
+		update.MemberId = memberId
+		if setErr := notificationsRepository.setNotificationPreferences(update); setErr != nil {
+			logger.Error("Error while setting preferences of member: " + strconv.FormatInt(memberId, 10) + " with error: " + setErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		preferences = &update
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.NotificationPreferences(*preferences)))
+}
+
+// GetNotificationsHandler pages through the notifications sent to a member, latest first,
+// for staff or the member signed in.
+func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeMember(w, r) {
+		return
+	}
+	mapper := dto.FromRequest(r)
+
+	limit, offset, pageErr := getPage(r)
+	if pageErr != nil {
+		logger.Error("Improper paging parameters: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	if limit == 0 {
+		limit = defaultNotificationsLimit
+	}
+	member, found := findMember(w, r)
+	if !found {
+		return
+	}
+
+	notifications, getErr := notificationsRepository.getNotifications(member.Id, limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting notifications of member: " + strconv.FormatInt(member.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Notifications(notifications)))
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// notificationsRepositoryMock knows members 1 and 2, who get every notification until
+// their preferences are set.
+type notificationsRepositoryMock struct {
+	preferences map[int64]domain.NotificationPreferences
+}
+
+func newNotificationsRepositoryMock() notificationsRepositoryMock {
+	return notificationsRepositoryMock{preferences: map[int64]domain.NotificationPreferences{}}
+}
+
+func (n notificationsRepositoryMock) getNotificationPreferences(memberId int64) (*domain.NotificationPreferences, error) {
+	if memberId != 1 && memberId != 2 {
+		return nil, nil
+	}
+	if preferences, found := n.preferences[memberId]; found {
+		return &preferences, nil
+	}
+	return &domain.NotificationPreferences{MemberId: memberId, DueSoon: true, Overdue: true, HoldReady: true}, nil
+}
+
+func (n notificationsRepositoryMock) setNotificationPreferences(preferences domain.NotificationPreferences) error {
+	n.preferences[preferences.MemberId] = preferences
+	return nil
+}
+
+func (n notificationsRepositoryMock) getNotifications(memberId int64, limit int64, offset int64) ([]domain.Notification, error) {
+	sentAt := time.Date(2026, time.October, 14, 9, 0, 0, 0, time.UTC)
+	notifications := []domain.Notification{
+		{Id: 2, MemberId: 1, Event: domain.NotificationOverdue, Reference: "loan:4:0", Email: "ged@roke.example", Subject: "The Farthest Shore is overdue", SentAt: sentAt},
+		{Id: 1, MemberId: 1, Event: domain.NotificationDueSoon, Reference: "loan:4:0", Email: "ged@roke.example", Subject: "The Farthest Shore is due back", SentAt: sentAt.Add(-48 * time.Hour)},
+	}
+	if memberId != 1 || offset >= int64(len(notifications)) {
+		return []domain.Notification{}, nil
+	}
+	notifications = notifications[offset:]
+	if limit < int64(len(notifications)) {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func TestNotificationHandlers(t *testing.T) {
+	TestSetup(t)
+	circulationMembersByIdsMock = func(ids []int64) ([]domain.Member, error) {
+		if ids[0] == 1 || ids[0] == 2 {
+			return []domain.Member{{Id: ids[0], Name: "Member"}}, nil
+		}
+		return nil, nil
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/members/{id}/preferences", NotificationPreferencesHandler).Methods("GET", "PUT")
+	router.HandleFunc("/members/{id}/notifications", GetNotificationsHandler).Methods("GET")
+
+	scenarios := []struct {
+		name     string
+		method   string
+		path     string
+		data     string
+		status   int
+		contains string
+	}{
+		{name: "Get default preferences", method: "GET", path: "/members/2/preferences", status: http.StatusOK, contains: `"DueSoon":true,"Overdue":true,"HoldReady":true`},
+		{name: "Set preferences", method: "PUT", path: "/members/2/preferences", data: `{"DueSoon":true,"HoldReady":true}`, status: http.StatusOK, contains: `"Overdue":false`},
+		{name: "Get preferences", method: "GET", path: "/v2/members/2/preferences", status: http.StatusOK, contains: `{"memberId":2,"dueSoon":true,"overdue":false,"holdReady":true}`},
+		{name: "Set preferences of missing member", method: "PUT", path: "/members/3/preferences", data: `{}`, status: http.StatusNotFound},
+		{name: "Set malformed preferences", method: "PUT", path: "/members/2/preferences", data: `{"DueSoon":"yes"}`, status: http.StatusBadRequest},
+		{name: "Get preferences of missing member", method: "GET", path: "/members/x/preferences", status: http.StatusNotFound},
+		{name: "List notifications", method: "GET", path: "/members/1/notifications", status: http.StatusOK, contains: `"Event":"overdue"`},
+		{name: "Page notifications", method: "GET", path: "/v2/members/1/notifications?limit=1&offset=1", status: http.StatusOK, contains: `{"items":[{"id":1,`},
+		{name: "List no notifications", method: "GET", path: "/members/2/notifications", status: http.StatusOK, contains: `[]`},
+		{name: "List notifications of missing member", method: "GET", path: "/members/3/notifications", status: http.StatusNotFound},
+		{name: "List notifications with a bad page", method: "GET", path: "/members/1/notifications?limit=-1", status: http.StatusBadRequest},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			r, _ := http.NewRequest(s.method, s.path, bytes.NewReader([]byte(s.data)))
+			r.Header.Set("Authorization", "Bearer "+staffToken)
+			w := httptest.NewRecorder()
+			if strings.HasPrefix(s.path, "/v2/") {
+				r.URL.Path = strings.TrimPrefix(r.URL.Path, "/v2")
+				dto.Use(dto.V2, router).ServeHTTP(w, r)
+			} else {
+				router.ServeHTTP(w, r)
+			}
+			if w.Code != s.status {
+				t.Fatalf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), s.contains) {
+				t.Errorf("Expected the body to contain %q, got %v", s.contains, w.Body.String())
+			}
+		})
+	}
+}
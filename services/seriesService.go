@@ -0,0 +1,373 @@
+package services
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultGroupsLimit  = 50
+	defaultEntriesLimit = 1000
+	expandSeries        = "series"
+)
+
+type GroupsRepository struct{}
+
+// GroupsRepositoryInterface keeps series and collections, the groups of books kept in
+// order.
+type GroupsRepositoryInterface interface {
+	getSeries(id int64) (*domain.Series, error)
+	findSeries(name string, limit int64, offset int64) ([]domain.Series, error)
+	addSeries(series domain.Series) (int64, error)
+	updateSeries(series domain.Series) error
+	deleteSeries(id int64) error
+	getSeriesPosition(bookId int64) (*domain.SeriesPosition, error)
+	getCollection(id int64) (*domain.Collection, error)
+	findCollections(name string, kind string, limit int64, offset int64) ([]domain.Collection, error)
+	addCollection(collection domain.Collection) (int64, error)
+	updateCollection(collection domain.Collection) error
+	deleteCollection(id int64) error
+	getEntries(group string, groupId int64, limit int64, offset int64) ([]domain.Entry, error)
+	setEntries(group string, groupId int64, bookIds []int64) (bool, error)
+	addEntry(group string, groupId int64, bookId int64, position int) (bool, error)
+	removeEntry(group string, groupId int64, bookId int64) (bool, error)
+}
+
+var groupsRepository GroupsRepositoryInterface = GroupsRepository{}
+
+func (g GroupsRepository) getSeries(id int64) (*domain.Series, error) {
+	return repository.GetSeries(id)
+}
+
+func (g GroupsRepository) findSeries(name string, limit int64, offset int64) ([]domain.Series, error) {
+	return repository.FindSeries(name, limit, offset)
+}
+
+func (g GroupsRepository) addSeries(series domain.Series) (int64, error) {
+	return repository.AddSeries(series)
+}
+
+func (g GroupsRepository) updateSeries(series domain.Series) error {
+	return repository.UpdateSeries(series)
+}
+
+func (g GroupsRepository) deleteSeries(id int64) error {
+	return repository.DeleteSeries(id)
+}
+
+func (g GroupsRepository) getSeriesPosition(bookId int64) (*domain.SeriesPosition, error) {
+	return repository.GetSeriesPosition(bookId)
+}
+
+func (g GroupsRepository) getCollection(id int64) (*domain.Collection, error) {
+	return repository.GetCollection(id)
+}
+
+func (g GroupsRepository) findCollections(name string, kind string, limit int64, offset int64) ([]domain.Collection, error) {
+	return repository.FindCollections(name, kind, limit, offset)
+}
+
+func (g GroupsRepository) addCollection(collection domain.Collection) (int64, error) {
+	return repository.AddCollection(collection)
+}
+
+func (g GroupsRepository) updateCollection(collection domain.Collection) error {
+	return repository.UpdateCollection(collection)
+}
+
+func (g GroupsRepository) deleteCollection(id int64) error {
+	return repository.DeleteCollection(id)
+}
+
+func (g GroupsRepository) getEntries(group string, groupId int64, limit int64, offset int64) ([]domain.Entry, error) {
+	return repository.GetEntries(group, groupId, limit, offset)
+}
+
+func (g GroupsRepository) setEntries(group string, groupId int64, bookIds []int64) (bool, error) {
+	return repository.SetEntries(group, groupId, bookIds)
+}
+
+func (g GroupsRepository) addEntry(group string, groupId int64, bookId int64, position int) (bool, error) {
+	return repository.AddEntry(group, groupId, bookId, position)
+}
+
+func (g GroupsRepository) removeEntry(group string, groupId int64, bookId int64) (bool, error) {
+	return repository.RemoveEntry(group, groupId, bookId)
+}
+
+// GetSeriesListHandler pages through the series by name, ?name= narrows them down to the
+// names containing it.
+func GetSeriesListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	limit, offset, pageErr := getPage(r)
+	if pageErr != nil {
+		logger.Error("Improper paging parameters: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	if limit == 0 {
+		limit = defaultGroupsLimit
+	}
+
+	series, getErr := groupsRepository.findSeries(r.URL.Query().Get("name"), limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting series with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.SeriesList(series)))
+}
+
+func AddSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	input := mapper.NewSeriesInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		logger.Error("Improper data passed for series create: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+
+	series := input.Series()
+	rowId, insertRecordErr := groupsRepository.addSeries(series)
+	if insertRecordErr != nil {
+		logger.Error("Error while creating series with error: " + insertRecordErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	series.Id = rowId
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(mapper.Series(series)))
+}
+
+// SeriesHandler reads, renames and deletes a series. Deleting a series keeps its books.
+func SeriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	series, found := findSeries(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Series(series)))
+	case "PUT":
+		input := mapper.NewSeriesInput()
+		if decodeErr := decodeValid(r, input); decodeErr != nil {
+			logger.Error("Improper data passed for series update: " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		update := input.Series()
+		update.Id = series.Id
+		if updateErr := groupsRepository.updateSeries(update); updateErr != nil {
+			logger.Error("Error while updating series: " + strconv.FormatInt(series.Id, 10) + " with error: " + updateErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Series(update)))
+	case "DELETE":
+		if deleteErr := groupsRepository.deleteSeries(series.Id); deleteErr != nil {
+			logger.Error("Error while deleting series: " + strconv.FormatInt(series.Id, 10) + " with error: " + deleteErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// SeriesBooksHandler lists the volumes of a series in order, replaces them or adds one.
+// A book is in one series at most, so books added to a series leave the one they were in.
+func SeriesBooksHandler(w http.ResponseWriter, r *http.Request) {
+	if _, found := findSeries(w, r); found {
+		entriesHandler(w, r, domain.GroupSeries)
+	}
+}
+
+// SeriesBookHandler takes a book out of a series.
+func SeriesBookHandler(w http.ResponseWriter, r *http.Request) {
+	if _, found := findSeries(w, r); found {
+		removeEntryHandler(w, r, domain.GroupSeries)
+	}
+}
+
+// entriesHandler serves the books of the series or collection of the id of r, which
+// exists. GET pages through them, PUT replaces them and POST adds one, both answering
+// with the books in their new order.
+func entriesHandler(w http.ResponseWriter, r *http.Request, group string) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	groupId, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	limit, offset := int64(defaultEntriesLimit), int64(0)
+	var changeErr error
+	found := true
+	switch r.Method {
+	case "GET":
+		var pageErr *decoder.Error
+		if limit, offset, pageErr = getPage(r); pageErr != nil {
+			logger.Error("Improper paging parameters: " + pageErr.Error())
+			writeApiError(w, mapper, pageErr.ApiError())
+			return
+		}
+		if limit == 0 {
+			limit = defaultEntriesLimit
+		}
+	case "PUT":
+		bookIds, decodeErr := decodeEntries(r)
+		if decodeErr != nil {
+			logger.Error("Improper data passed for books of " + group + ": " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		found, changeErr = groupsRepository.setEntries(group, groupId, bookIds)
+	case "POST":
+		input := mapper.NewEntryInput()
+		if decodeErr := decodeValid(r, input); decodeErr != nil {
+			logger.Error("Improper data passed for book of " + group + ": " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		entry := input.Entry()
+		found, changeErr = groupsRepository.addEntry(group, groupId, entry.Book.Id, entry.Position)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if changeErr != nil {
+		logger.Error("Error while changing books of " + group + ": " + strconv.FormatInt(groupId, 10) + " with error: " + changeErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "Books", Message: "must be existing books"}},
+		})
+		return
+	}
+
+	entries, getErr := groupsRepository.getEntries(group, groupId, limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting books of " + group + ": " + strconv.FormatInt(groupId, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Entries(entries)))
+}
+
+func removeEntryHandler(w http.ResponseWriter, r *http.Request, group string) {
+	groupId, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	bookId, parseErr := strconv.ParseInt(mux.Vars(r)["bookId"], 10, 64)
+	if parseErr != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	removed, removeErr := groupsRepository.removeEntry(group, groupId, bookId)
+	if removeErr != nil {
+		logger.Error("Error while removing book: " + mux.Vars(r)["bookId"] + " from " + group + ": " + mux.Vars(r)["id"] + " with error: " + removeErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeEntries decodes and validates the books of a series or a collection, which must
+// not repeat a book.
+func decodeEntries(r *http.Request) ([]int64, *decoder.Error) {
+	input := dto.FromRequest(r).NewEntriesInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	bookIds := input.BookIds()
+	seen := map[int64]bool{}
+	for _, bookId := range bookIds {
+		if seen[bookId] {
+			decodeErr := &decoder.Error{Status: http.StatusUnprocessableEntity}
+			return nil, decodeErr.Add("Books", "must not repeat a book")
+		}
+		seen[bookId] = true
+	}
+	return bookIds, nil
+}
+
+// getExpand returns the expansions asked for with ?expand=, a comma separated list.
+func getExpand(r *http.Request) (map[string]bool, *decoder.Error) {
+	expand := map[string]bool{}
+	var expandErr *decoder.Error
+	for _, name := range strings.Split(r.URL.Query().Get("expand"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case expandSeries:
+			expand[name] = true
+		default:
+			expandErr = expandErr.Add("expand", "must be one of "+expandSeries)
+		}
+	}
+	return expand, expandErr
+}
+
+// writeBook writes book along with the expansions asked for.
+func writeBook(w http.ResponseWriter, r *http.Request, book domain.Book, expand map[string]bool) {
+	mapper := dto.FromRequest(r)
+	if !expand[expandSeries] {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Book(book)))
+		return
+	}
+
+	position, getErr := groupsRepository.getSeriesPosition(book.Id)
+	if getErr != nil {
+		logger.Error("Error while getting series of book: " + strconv.FormatInt(book.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.ExpandedBook(book, position)))
+}
+
+func findSeries(w http.ResponseWriter, r *http.Request) (domain.Series, bool) {
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var series *domain.Series
+	var getErr error
+	if parseErr == nil {
+		series, getErr = groupsRepository.getSeries(id)
+	}
+
+	if getErr != nil {
+		logger.Error("Error while getting series: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Series{}, false
+	}
+	if series == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Series{}, false
+	}
+	return *series, true
+}
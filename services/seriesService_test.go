@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// groupsRepositoryMock knows series 1 and collection 1, which hold book 1. Book 2 exists
+// but is part of neither, and other books do not exist.
+type groupsRepositoryMock struct{}
+
+func (g groupsRepositoryMock) getSeries(id int64) (*domain.Series, error) {
+	if id != 1 {
+		return nil, nil
+	}
+	return &domain.Series{Id: id, Name: "Series"}, nil
+}
+
+func (g groupsRepositoryMock) findSeries(name string, limit int64, offset int64) ([]domain.Series, error) {
+	return []domain.Series{{Id: 1, Name: "Series"}}, nil
+}
+
+func (g groupsRepositoryMock) addSeries(series domain.Series) (int64, error) {
+	return 2, nil
+}
+
+func (g groupsRepositoryMock) updateSeries(series domain.Series) error {
+	return nil
+}
+
+func (g groupsRepositoryMock) deleteSeries(id int64) error {
+	return nil
+}
+
+func (g groupsRepositoryMock) getSeriesPosition(bookId int64) (*domain.SeriesPosition, error) {
+	if bookId != 1 {
+		return nil, nil
+	}
+	return &domain.SeriesPosition{Series: domain.Series{Id: 1, Name: "Series"}, Position: 1}, nil
+}
+
+func (g groupsRepositoryMock) getCollection(id int64) (*domain.Collection, error) {
+	if id != 1 {
+		return nil, nil
+	}
+	return &domain.Collection{Id: id, Name: "Collection", Kind: domain.KindShelf}, nil
+}
+
+func (g groupsRepositoryMock) findCollections(name string, kind string, limit int64, offset int64) ([]domain.Collection, error) {
+	return []domain.Collection{{Id: 1, Name: "Collection", Kind: domain.KindShelf}}, nil
+}
+
+func (g groupsRepositoryMock) addCollection(collection domain.Collection) (int64, error) {
+	return 2, nil
+}
+
+func (g groupsRepositoryMock) updateCollection(collection domain.Collection) error {
+	return nil
+}
+
+func (g groupsRepositoryMock) deleteCollection(id int64) error {
+	return nil
+}
+
+func (g groupsRepositoryMock) getEntries(group string, groupId int64, limit int64, offset int64) ([]domain.Entry, error) {
+	return []domain.Entry{{Position: 1, Book: domain.Book{Id: 1, Name: "Book", Author: "Author"}}}, nil
+}
+
+func (g groupsRepositoryMock) setEntries(group string, groupId int64, bookIds []int64) (bool, error) {
+	for _, bookId := range bookIds {
+		if bookId != 1 && bookId != 2 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (g groupsRepositoryMock) addEntry(group string, groupId int64, bookId int64, position int) (bool, error) {
+	return bookId == 1 || bookId == 2, nil
+}
+
+func (g groupsRepositoryMock) removeEntry(group string, groupId int64, bookId int64) (bool, error) {
+	return bookId == 1, nil
+}
+
+func serveGroups(method string, path string, data []byte) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/series", GetSeriesListHandler).Methods("GET")
+	router.HandleFunc("/series", AddSeriesHandler).Methods("POST")
+	router.HandleFunc("/series/{id}", SeriesHandler).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/series/{id}/books", SeriesBooksHandler).Methods("GET", "PUT", "POST")
+	router.HandleFunc("/series/{id}/books/{bookId}", SeriesBookHandler).Methods("DELETE")
+	router.HandleFunc("/collections", GetCollectionsHandler).Methods("GET")
+	router.HandleFunc("/collections", AddCollectionHandler).Methods("POST")
+	router.HandleFunc("/collections/{id}", CollectionHandler).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/collections/{id}/books", CollectionBooksHandler).Methods("GET", "PUT", "POST")
+	router.HandleFunc("/collections/{id}/books/{bookId}", CollectionBookHandler).Methods("DELETE")
+
+	r, _ := http.NewRequest(method, path, bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestGroupHandlers(t *testing.T) {
+	TestSetup(t)
+	scenarios := []struct {
+		name   string
+		method string
+		path   string
+		data   []byte
+		status int
+	}{
+		{name: "List series", method: "GET", path: "/series?name=Se", status: http.StatusOK},
+		{name: "Create series", method: "POST", path: "/series", data: []byte(`{"Name":"Series"}`), status: http.StatusCreated},
+		{name: "Create series without name", method: "POST", path: "/series", data: []byte(`{"Name":""}`), status: http.StatusUnprocessableEntity},
+		{name: "Get missing series", method: "GET", path: "/series/2", status: http.StatusNotFound},
+		{name: "Rename series", method: "PUT", path: "/series/1", data: []byte(`{"Name":"Other"}`), status: http.StatusOK},
+		{name: "Delete series", method: "DELETE", path: "/series/1", status: http.StatusNoContent},
+		{name: "List books of series", method: "GET", path: "/series/1/books?limit=10", status: http.StatusOK},
+		{name: "List books of missing series", method: "GET", path: "/series/2/books", status: http.StatusNotFound},
+		{name: "Set books of series", method: "PUT", path: "/series/1/books", data: []byte(`{"Books":[2,1]}`), status: http.StatusOK},
+		{name: "Set repeated books of series", method: "PUT", path: "/series/1/books", data: []byte(`{"Books":[1,1]}`), status: http.StatusUnprocessableEntity},
+		{name: "Set missing books of series", method: "PUT", path: "/series/1/books", data: []byte(`{"Books":[3]}`), status: http.StatusUnprocessableEntity},
+		{name: "Add book to series", method: "POST", path: "/series/1/books", data: []byte(`{"BookId":2,"Position":1}`), status: http.StatusOK},
+		{name: "Add book at no position", method: "POST", path: "/series/1/books", data: []byte(`{"BookId":2,"Position":-1}`), status: http.StatusUnprocessableEntity},
+		{name: "Add missing book to series", method: "POST", path: "/series/1/books", data: []byte(`{"BookId":3}`), status: http.StatusUnprocessableEntity},
+		{name: "Remove book from series", method: "DELETE", path: "/series/1/books/1", status: http.StatusNoContent},
+		{name: "Remove book not in series", method: "DELETE", path: "/series/1/books/2", status: http.StatusNotFound},
+		{name: "List shelves", method: "GET", path: "/collections?kind=shelf", status: http.StatusOK},
+		{name: "List collections of unknown kind", method: "GET", path: "/collections?kind=room", status: http.StatusBadRequest},
+		{name: "Create collection", method: "POST", path: "/collections", data: []byte(`{"Name":"Display"}`), status: http.StatusCreated},
+		{name: "Create collection of unknown kind", method: "POST", path: "/collections", data: []byte(`{"Name":"Room","Kind":"room"}`), status: http.StatusUnprocessableEntity},
+		{name: "Get collection", method: "GET", path: "/collections/1", status: http.StatusOK},
+		{name: "Add book to collection", method: "POST", path: "/collections/1/books", data: []byte(`{"BookId":2}`), status: http.StatusOK},
+		{name: "Add book to missing collection", method: "POST", path: "/collections/2/books", data: []byte(`{"BookId":2}`), status: http.StatusNotFound},
+		{name: "Remove book from collection", method: "DELETE", path: "/collections/1/books/1", status: http.StatusNoContent},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if w := serveGroups(s.method, s.path, s.data); w.Code != s.status {
+				t.Errorf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetExpand(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name   string
+		query  string
+		expand []string
+		valid  bool
+	}{
+		{name: "should expand nothing by default", query: "", valid: true},
+		{name: "should expand series", query: "?expand=series", expand: []string{expandSeries}, valid: true},
+		{name: "should refuse unknown expansions", query: "?expand=series,shelves"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/book/1"+scenario.query, nil)
+			expand, expandErr := getExpand(r)
+			if (expandErr == nil) != scenario.valid {
+				t.Fatalf("Expected valid %v, got %v", scenario.valid, expandErr)
+			}
+			if scenario.valid && len(expand) != len(scenario.expand) {
+				t.Errorf("Expected %v, got %v", scenario.expand, expand)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/classification"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type SubjectsRepository struct{}
+
+// SubjectsRepositoryInterface keeps the subject tree and the subjects books are tagged
+// with.
+type SubjectsRepositoryInterface interface {
+	getSubject(id int64) (*domain.Subject, error)
+	getSubjectByCode(code string) (*domain.Subject, error)
+	getSubjectTree(rootId int64) ([]domain.Subject, error)
+	getDescendantIds(id int64) ([]int64, error)
+	addSubject(subject domain.Subject) (int64, error)
+	updateSubject(subject domain.Subject) error
+	deleteSubject(id int64) (bool, error)
+	getBookSubjects(bookId int64) ([]domain.Subject, error)
+	setBookSubjects(bookId int64, subjectIds []int64) ([]domain.Subject, error)
+	importSubjects(entries []classification.Entry) (domain.SubjectImport, error)
+}
+
+var subjectsRepository SubjectsRepositoryInterface = SubjectsRepository{}
+
+func (s SubjectsRepository) getSubject(id int64) (*domain.Subject, error) {
+	return repository.GetSubject(id)
+}
+
+func (s SubjectsRepository) getSubjectByCode(code string) (*domain.Subject, error) {
+	return repository.GetSubjectByCode(code)
+}
+
+func (s SubjectsRepository) getSubjectTree(rootId int64) ([]domain.Subject, error) {
+	return repository.GetSubjectTree(rootId)
+}
+
+func (s SubjectsRepository) getDescendantIds(id int64) ([]int64, error) {
+	return repository.GetDescendantIds(id)
+}
+
+func (s SubjectsRepository) addSubject(subject domain.Subject) (int64, error) {
+	return repository.AddSubject(subject)
+}
+
+func (s SubjectsRepository) updateSubject(subject domain.Subject) error {
+	return repository.UpdateSubject(subject)
+}
+
+func (s SubjectsRepository) deleteSubject(id int64) (bool, error) {
+	return repository.DeleteSubject(id)
+}
+
+func (s SubjectsRepository) getBookSubjects(bookId int64) ([]domain.Subject, error) {
+	return repository.GetBookSubjects(bookId)
+}
+
+func (s SubjectsRepository) setBookSubjects(bookId int64, subjectIds []int64) ([]domain.Subject, error) {
+	return repository.SetBookSubjects(bookId, subjectIds)
+}
+
+func (s SubjectsRepository) importSubjects(entries []classification.Entry) (domain.SubjectImport, error) {
+	return repository.ImportSubjects(entries)
+}
+
+// GetSubjectsHandler writes the whole subject tree: the root subjects, each with the
+// subjects below it as its children.
+func GetSubjectsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	tree, getErr := subjectsRepository.getSubjectTree(0)
+	if getErr != nil {
+		logger.Error("Error while getting subjects with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Subjects(tree)))
+}
+
+// AddSubjectHandler adds a subject under the parent it names, or as a root.
+func AddSubjectHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	subject, decodeErr := decodeSubject(r, 0)
+	if decodeErr != nil {
+		logger.Error("Improper data passed for subject create: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+
+	rowId, insertRecordErr := subjectsRepository.addSubject(subject)
+	if insertRecordErr != nil {
+		logger.Error("Error while creating subject with error: " + insertRecordErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	subject.Id = rowId
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(mapper.Subject(subject)))
+}
+
+// SubjectHandler reads a subject along with the subjects below it, changes or moves it,
+// and deletes it. Subjects can only be deleted once no other subject is filed under them,
+// deleting one untags its books.
+func SubjectHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	subject, found := findSubject(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		tree, getErr := subjectsRepository.getSubjectTree(subject.Id)
+		if getErr != nil {
+			logger.Error("Error while getting subjects below: " + strconv.FormatInt(subject.Id, 10) + " with error: " + getErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(tree) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Subject(tree[0])))
+	case "PUT":
+		update, decodeErr := decodeSubject(r, subject.Id)
+		if decodeErr != nil {
+			logger.Error("Improper data passed for subject update: " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		update.Id = subject.Id
+		if updateErr := subjectsRepository.updateSubject(update); updateErr != nil {
+			logger.Error("Error while updating subject: " + strconv.FormatInt(subject.Id, 10) + " with error: " + updateErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(mapper.Subject(update)))
+	case "DELETE":
+		deleted, deleteErr := subjectsRepository.deleteSubject(subject.Id)
+		if deleteErr != nil {
+			logger.Error("Error while deleting subject: " + strconv.FormatInt(subject.Id, 10) + " with error: " + deleteErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			writeApiError(w, mapper, domain.ApiError{
+				Status:  http.StatusConflict,
+				Message: "subjects are filed under this subject, move or delete them first",
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// ImportSubjectsHandler seeds the subject tree from the classification file in the body,
+// of the ?format= given, and writes how many subjects it added and updated.
+func ImportSubjectsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+
+	format := r.URL.Query().Get("format")
+	if format != classification.FormatDewey && format != classification.FormatBisac {
+		var formatErr *decoder.Error
+		formatErr = formatErr.Add("format", "must be one of "+classification.FormatDewey+", "+classification.FormatBisac)
+		logger.Error("Improper parameters for subject import: " + formatErr.Error())
+		writeApiError(w, mapper, formatErr.ApiError())
+		return
+	}
+
+	body, readErr := ioutil.ReadAll(io.LimitReader(r.Body, config.MaxBodyBytes+1))
+	if readErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > config.MaxBodyBytes {
+		writeApiError(w, mapper, domain.ApiError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: "request body exceeds " + strconv.FormatInt(config.MaxBodyBytes, 10) + " bytes",
+		})
+		return
+	}
+
+	entries, parseErr := classification.Read(bytes.NewReader(body), format)
+	if parseErr != nil {
+		logger.Error("Improper classification file passed for subject import: " + parseErr.Error())
+		writeApiError(w, mapper, domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "body", Message: parseErr.Error()}},
+		})
+		return
+	}
+
+	imported, importErr := subjectsRepository.importSubjects(entries)
+	if importErr != nil {
+		logger.Error("Error while importing subjects with error: " + importErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.SubjectImport(imported)))
+}
+
+// BookSubjectsHandler reads and replaces the subjects a book is tagged with.
+func BookSubjectsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	id := mux.Vars(r)["id"]
+
+	books, getErr := booksRepository.getBook(id)
+	if getErr != nil {
+		logger.Error("Error while getting book: " + id + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(books) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	bookId := books[0].Id
+
+	var subjects []domain.Subject
+	switch r.Method {
+	case "GET":
+		subjects, getErr = subjectsRepository.getBookSubjects(bookId)
+	case "PUT":
+		subjectIds, decodeErr := decodeBookSubjects(r)
+		if decodeErr != nil {
+			logger.Error("Improper data passed for subjects of book: " + id + ": " + decodeErr.Error())
+			writeApiError(w, mapper, decodeErr.ApiError())
+			return
+		}
+		subjects, getErr = subjectsRepository.setBookSubjects(bookId, subjectIds)
+		if getErr == nil && subjects == nil {
+			writeApiError(w, mapper, domain.ApiError{
+				Status:     http.StatusUnprocessableEntity,
+				Message:    http.StatusText(http.StatusUnprocessableEntity),
+				Violations: []domain.Violation{{Field: "Subjects", Message: "must be existing subjects"}},
+			})
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if getErr != nil {
+		logger.Error("Error while " + r.Method + " of subjects of book: " + id + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(mapper.Subjects(subjects)))
+}
+
+// decodeSubject decodes and validates the subject in the request body, which is to be
+// subject id, or a new one when id is 0. Its parent must exist and not be the subject or
+// one below it, and its code must not be another subject's.
+func decodeSubject(r *http.Request, id int64) (domain.Subject, *decoder.Error) {
+	input := dto.FromRequest(r).NewSubjectInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		return domain.Subject{}, decodeErr
+	}
+	subject := input.Subject()
+
+	var subjectErr *decoder.Error
+	if subject.ParentId != 0 {
+		parent, getErr := subjectsRepository.getSubject(subject.ParentId)
+		var below []int64
+		if getErr == nil && parent != nil && id != 0 {
+			below, getErr = subjectsRepository.getDescendantIds(id)
+		}
+		switch {
+		case getErr != nil:
+			logger.Error("Error while checking parent of subject: " + getErr.Error())
+			return subject, &decoder.Error{Status: http.StatusInternalServerError}
+		case parent == nil:
+			subjectErr = subjectErr.Add("ParentId", "must be an existing subject")
+		case containsId(below, subject.ParentId):
+			subjectErr = subjectErr.Add("ParentId", "must not be the subject or a subject below it")
+		}
+	}
+	if subject.Code != "" {
+		other, getErr := subjectsRepository.getSubjectByCode(subject.Code)
+		if getErr != nil {
+			logger.Error("Error while checking code of subject: " + getErr.Error())
+			return subject, &decoder.Error{Status: http.StatusInternalServerError}
+		}
+		if other != nil && other.Id != id {
+			subjectErr = subjectErr.Add("Code", "must not be the code of another subject")
+		}
+	}
+	if subjectErr != nil {
+		subjectErr.Status = http.StatusUnprocessableEntity
+	}
+	return subject, subjectErr
+}
+
+// decodeBookSubjects decodes and validates the subjects of a book, which must not repeat
+// a subject.
+func decodeBookSubjects(r *http.Request) ([]int64, *decoder.Error) {
+	input := dto.FromRequest(r).NewSubjectsInput()
+	if decodeErr := decodeValid(r, input); decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	subjectIds := input.SubjectIds()
+	seen := map[int64]bool{}
+	for _, subjectId := range subjectIds {
+		if seen[subjectId] {
+			decodeErr := &decoder.Error{Status: http.StatusUnprocessableEntity}
+			return nil, decodeErr.Add("Subjects", "must not repeat a subject")
+		}
+		seen[subjectId] = true
+	}
+	return subjectIds, nil
+}
+
+// getSubjectFilter reads the optional ?subject= of a book search, a subject id.
+func getSubjectFilter(r *http.Request) (int64, *decoder.Error) {
+	text := r.URL.Query().Get("subject")
+	if text == "" {
+		return 0, nil
+	}
+	subjectId, parseErr := strconv.ParseInt(text, 10, 64)
+	if parseErr != nil || subjectId <= 0 {
+		var subjectErr *decoder.Error
+		return 0, subjectErr.Add("subject", "must be a positive integer")
+	}
+	return subjectId, nil
+}
+
+func containsId(ids []int64, id int64) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func findSubject(w http.ResponseWriter, r *http.Request) (domain.Subject, bool) {
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var subject *domain.Subject
+	var getErr error
+	if parseErr == nil {
+		subject, getErr = subjectsRepository.getSubject(id)
+	}
+
+	if getErr != nil {
+		logger.Error("Error while getting subject: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Subject{}, false
+	}
+	if subject == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Subject{}, false
+	}
+	return *subject, true
+}
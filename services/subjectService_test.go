@@ -0,0 +1,144 @@
+package services
+
+import (
+	"bytes"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/classification"
+	"go-rest-webservices-book-library/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// subjectsRepositoryMock knows subject 1, coded 800, and subject 2 filed under it.
+type subjectsRepositoryMock struct{}
+
+func (s subjectsRepositoryMock) getSubject(id int64) (*domain.Subject, error) {
+	switch id {
+	case 1:
+		return &domain.Subject{Id: 1, Name: "Literature", Code: "800"}, nil
+	case 2:
+		return &domain.Subject{Id: 2, Name: "English literature", ParentId: 1}, nil
+	}
+	return nil, nil
+}
+
+func (s subjectsRepositoryMock) getSubjectByCode(code string) (*domain.Subject, error) {
+	if code != "800" {
+		return nil, nil
+	}
+	return s.getSubject(1)
+}
+
+func (s subjectsRepositoryMock) getSubjectTree(rootId int64) ([]domain.Subject, error) {
+	child, _ := s.getSubject(2)
+	root, _ := s.getSubject(1)
+	root.Children = []domain.Subject{*child}
+	if rootId == 2 {
+		return []domain.Subject{*child}, nil
+	}
+	return []domain.Subject{*root}, nil
+}
+
+func (s subjectsRepositoryMock) getDescendantIds(id int64) ([]int64, error) {
+	if id == 1 {
+		return []int64{1, 2}, nil
+	}
+	return []int64{id}, nil
+}
+
+func (s subjectsRepositoryMock) addSubject(subject domain.Subject) (int64, error) {
+	return 3, nil
+}
+
+func (s subjectsRepositoryMock) updateSubject(subject domain.Subject) error {
+	return nil
+}
+
+func (s subjectsRepositoryMock) deleteSubject(id int64) (bool, error) {
+	return id == 2, nil
+}
+
+func (s subjectsRepositoryMock) getBookSubjects(bookId int64) ([]domain.Subject, error) {
+	return []domain.Subject{}, nil
+}
+
+func (s subjectsRepositoryMock) setBookSubjects(bookId int64, subjectIds []int64) ([]domain.Subject, error) {
+	return []domain.Subject{}, nil
+}
+
+func (s subjectsRepositoryMock) importSubjects(entries []classification.Entry) (domain.SubjectImport, error) {
+	return domain.SubjectImport{Added: len(entries)}, nil
+}
+
+func serveSubjects(method string, path string, data []byte) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/subjects", GetSubjectsHandler).Methods("GET")
+	router.HandleFunc("/subjects", AddSubjectHandler).Methods("POST")
+	router.HandleFunc("/subjects/import", ImportSubjectsHandler).Methods("POST")
+	router.HandleFunc("/subjects/{id}", SubjectHandler).Methods("GET", "PUT", "DELETE")
+
+	r, _ := http.NewRequest(method, path, bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestSubjectHandlers(t *testing.T) {
+	TestSetup(t)
+	scenarios := []struct {
+		name   string
+		method string
+		path   string
+		data   []byte
+		status int
+	}{
+		{name: "Get subject tree", method: "GET", path: "/subjects", status: http.StatusOK},
+		{name: "Create root subject", method: "POST", path: "/subjects", data: []byte(`{"Name":"Science"}`), status: http.StatusCreated},
+		{name: "Create subject under another", method: "POST", path: "/subjects", data: []byte(`{"Name":"English fiction","Code":"823","ParentId":2}`), status: http.StatusCreated},
+		{name: "Create subject under missing subject", method: "POST", path: "/subjects", data: []byte(`{"Name":"English fiction","ParentId":3}`), status: http.StatusUnprocessableEntity},
+		{name: "Create subject with taken code", method: "POST", path: "/subjects", data: []byte(`{"Name":"Literature","Code":"800"}`), status: http.StatusUnprocessableEntity},
+		{name: "Get subject", method: "GET", path: "/subjects/1", status: http.StatusOK},
+		{name: "Get missing subject", method: "GET", path: "/subjects/3", status: http.StatusNotFound},
+		{name: "Keep code of subject", method: "PUT", path: "/subjects/1", data: []byte(`{"Name":"Literatures","Code":"800"}`), status: http.StatusOK},
+		{name: "Move subject below itself", method: "PUT", path: "/subjects/1", data: []byte(`{"Name":"Literature","ParentId":2}`), status: http.StatusUnprocessableEntity},
+		{name: "Delete subject with subjects below", method: "DELETE", path: "/subjects/1", status: http.StatusConflict},
+		{name: "Delete subject", method: "DELETE", path: "/subjects/2", status: http.StatusNoContent},
+		{name: "Import subjects", method: "POST", path: "/subjects/import?format=dewey", data: []byte("800 Literature\n820 English literature\n"), status: http.StatusOK},
+		{name: "Import subjects without format", method: "POST", path: "/subjects/import", data: []byte("800 Literature\n"), status: http.StatusBadRequest},
+		{name: "Import malformed subjects", method: "POST", path: "/subjects/import?format=bisac", data: []byte("800 Literature\n"), status: http.StatusUnprocessableEntity},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if w := serveSubjects(s.method, s.path, s.data); w.Code != s.status {
+				t.Errorf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetSubjectFilter(t *testing.T) {
+	t.Parallel()
+	scenarios := []struct {
+		name    string
+		query   string
+		subject int64
+		valid   bool
+	}{
+		{name: "should filter nothing by default", query: "", valid: true},
+		{name: "should read the subject", query: "?subject=12", subject: 12, valid: true},
+		{name: "should refuse names", query: "?subject=fiction"},
+		{name: "should refuse zero", query: "?subject=0"},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/books"+scenario.query, nil)
+			subject, subjectErr := getSubjectFilter(r)
+			if (subjectErr == nil) != scenario.valid || subject != scenario.subject {
+				t.Errorf("Expected %v, valid %v, got %v, %v", scenario.subject, scenario.valid, subject, subjectErr)
+			}
+		})
+	}
+}
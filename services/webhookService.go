@@ -0,0 +1,344 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/decoder"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/dto"
+	"go-rest-webservices-book-library/repository"
+	"go-rest-webservices-book-library/validation"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	secretBytes            = 32
+)
+
+type WebhooksRepository struct{}
+
+type WebhooksRepositoryInterface interface {
+	getWebhooks() ([]domain.Webhook, error)
+	getWebhook(id int64) (*domain.Webhook, error)
+	addWebhook(webhook domain.Webhook) (int64, error)
+	updateWebhook(webhook domain.Webhook) error
+	deleteWebhook(id int64) error
+	getDeliveries(webhookId int64, status string, limit int64, offset int64) ([]domain.WebhookDelivery, error)
+	getDelivery(webhookId int64, id int64) (*domain.WebhookDelivery, error)
+	getDeliveryAttempts(deliveryId int64) ([]domain.WebhookAttempt, error)
+	redeliver(webhookId int64, id int64) (bool, error)
+}
+
+// webhookInput is the body of POST and PUT /webhooks. Active defaults to true and the
+// secret, which can not be changed afterwards, is generated unless one is given.
+type webhookInput struct {
+	Url    string
+	Secret string
+	Events []string
+	Active *bool
+}
+
+var webhooksRepository WebhooksRepositoryInterface = WebhooksRepository{}
+
+func (w WebhooksRepository) getWebhooks() ([]domain.Webhook, error) {
+	return repository.GetWebhooks()
+}
+
+func (w WebhooksRepository) getWebhook(id int64) (*domain.Webhook, error) {
+	return repository.GetWebhook(id)
+}
+
+func (w WebhooksRepository) addWebhook(webhook domain.Webhook) (int64, error) {
+	return repository.AddWebhook(webhook)
+}
+
+func (w WebhooksRepository) updateWebhook(webhook domain.Webhook) error {
+	return repository.UpdateWebhook(webhook)
+}
+
+func (w WebhooksRepository) deleteWebhook(id int64) error {
+	return repository.DeleteWebhook(id)
+}
+
+func (w WebhooksRepository) getDeliveries(webhookId int64, status string, limit int64, offset int64) ([]domain.WebhookDelivery, error) {
+	return repository.GetDeliveries(webhookId, status, limit, offset)
+}
+
+func (w WebhooksRepository) getDelivery(webhookId int64, id int64) (*domain.WebhookDelivery, error) {
+	return repository.GetDelivery(webhookId, id)
+}
+
+func (w WebhooksRepository) getDeliveryAttempts(deliveryId int64) ([]domain.WebhookAttempt, error) {
+	return repository.GetDeliveryAttempts(deliveryId)
+}
+
+func (w WebhooksRepository) redeliver(webhookId int64, id int64) (bool, error) {
+	return repository.Redeliver(webhookId, id)
+}
+
+// GetWebhooksHandler lists the webhooks, without their secrets. The webhooks and their
+// deliveries are for staff only.
+func GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	webhooks, getErr := webhooksRepository.getWebhooks()
+	if getErr != nil {
+		logger.Error("Error while getting webhooks with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(webhooks))
+}
+
+func AddWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	webhook := domain.Webhook{Active: true, CreatedAt: time.Now().UTC()}
+	if decodeErr := decodeWebhook(r, &webhook); decodeErr != nil {
+		logger.Error("Improper data passed for webhook create: " + decodeErr.Error())
+		writeApiError(w, mapper, decodeErr.ApiError())
+		return
+	}
+
+	if webhook.Secret == "" {
+		secret := make([]byte, secretBytes)
+		if _, randErr := rand.Read(secret); randErr != nil {
+			logger.Error("Error while generating webhook secret with error: " + randErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	rowId, insertRecordErr := webhooksRepository.addWebhook(webhook)
+	if insertRecordErr != nil {
+		logger.Error("Error while creating webhook with error: " + insertRecordErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	webhook.Id = rowId
+	// The secret is only shown here, so the response must not be kept anywhere.
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprint(w, getString(webhook))
+}
+
+func WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	webhook, found := findWebhook(w, r)
+	if !found {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		webhook.Secret = ""
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, getString(webhook))
+	case "PUT":
+		updateWebhookHandler(w, r, webhook)
+	case "DELETE":
+		if deleteErr := webhooksRepository.deleteWebhook(webhook.Id); deleteErr != nil {
+			logger.Error("Error while deleting webhook: " + strconv.FormatInt(webhook.Id, 10) + " with error: " + deleteErr.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func updateWebhookHandler(w http.ResponseWriter, r *http.Request, webhook domain.Webhook) {
+	secret := webhook.Secret
+	if decodeErr := decodeWebhook(r, &webhook); decodeErr != nil {
+		logger.Error("Improper data passed for webhook update: " + decodeErr.Error())
+		writeApiError(w, dto.FromRequest(r), decodeErr.ApiError())
+		return
+	}
+	if webhook.Secret != secret {
+		writeApiError(w, dto.FromRequest(r), domain.ApiError{
+			Status:     http.StatusUnprocessableEntity,
+			Message:    http.StatusText(http.StatusUnprocessableEntity),
+			Violations: []domain.Violation{{Field: "Secret", Message: "can not be changed, create a new webhook instead"}},
+		})
+		return
+	}
+
+	if updateErr := webhooksRepository.updateWebhook(webhook); updateErr != nil {
+		logger.Error("Error while updating webhook: " + strconv.FormatInt(webhook.Id, 10) + " with error: " + updateErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	webhook.Secret = ""
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(webhook))
+}
+
+// GetWebhookDeliveriesHandler lists the deliveries of a webhook, newest first. The dead
+// letter list is ?status=dead.
+func GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	mapper := dto.FromRequest(r)
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	webhook, found := findWebhook(w, r)
+	if !found {
+		return
+	}
+
+	limit, offset, pageErr := getPage(r)
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", domain.DeliveryPending, domain.DeliveryDelivered, domain.DeliveryDead:
+	default:
+		pageErr = pageErr.Add("status", "must be one of "+domain.DeliveryPending+", "+domain.DeliveryDelivered+", "+domain.DeliveryDead)
+	}
+	if pageErr != nil {
+		logger.Error("Improper parameters for webhook deliveries: " + pageErr.Error())
+		writeApiError(w, mapper, pageErr.ApiError())
+		return
+	}
+	if limit == 0 {
+		limit = defaultDeliveriesLimit
+	}
+
+	deliveries, getErr := webhooksRepository.getDeliveries(webhook.Id, status, limit, offset)
+	if getErr != nil {
+		logger.Error("Error while getting deliveries of webhook: " + strconv.FormatInt(webhook.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(deliveries))
+}
+
+func GetDeliveryAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	delivery, found := findDelivery(w, r)
+	if !found {
+		return
+	}
+
+	attempts, getErr := webhooksRepository.getDeliveryAttempts(delivery.Id)
+	if getErr != nil {
+		logger.Error("Error while getting attempts of delivery: " + strconv.FormatInt(delivery.Id, 10) + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, getString(attempts))
+}
+
+// RedeliverHandler queues a delivery again, with a fresh set of attempts.
+func RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !authorizeStaff(w, r) {
+		return
+	}
+
+	delivery, found := findDelivery(w, r)
+	if !found {
+		return
+	}
+
+	if _, redeliverErr := webhooksRepository.redeliver(delivery.WebhookId, delivery.Id); redeliverErr != nil {
+		logger.Error("Error while redelivering: " + strconv.FormatInt(delivery.Id, 10) + " with error: " + redeliverErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// decodeWebhook applies the request body onto webhook and validates the result.
+func decodeWebhook(r *http.Request, webhook *domain.Webhook) *decoder.Error {
+	input := webhookInput{Url: webhook.Url, Secret: webhook.Secret, Events: webhook.Events}
+	decodeErr := decoder.Decode(r, &input)
+	if decodeErr != nil && decodeErr.Malformed {
+		return decodeErr
+	}
+
+	webhook.Url, webhook.Secret, webhook.Events = input.Url, input.Secret, input.Events
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+	if fieldErrors := validation.Validate(webhook); fieldErrors != nil {
+		if decodeErr == nil {
+			decodeErr = &decoder.Error{Status: http.StatusUnprocessableEntity}
+		}
+		decodeErr.Violations = append(decodeErr.Violations, fieldErrors.Violations()...)
+	}
+	return decodeErr
+}
+
+func findWebhook(w http.ResponseWriter, r *http.Request) (domain.Webhook, bool) {
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	var webhook *domain.Webhook
+	var getErr error
+	if parseErr == nil {
+		webhook, getErr = webhooksRepository.getWebhook(id)
+	}
+
+	if getErr != nil {
+		logger.Error("Error while getting webhook: " + mux.Vars(r)["id"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.Webhook{}, false
+	}
+	if webhook == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.Webhook{}, false
+	}
+	return *webhook, true
+}
+
+func findDelivery(w http.ResponseWriter, r *http.Request) (domain.WebhookDelivery, bool) {
+	webhook, found := findWebhook(w, r)
+	if !found {
+		return domain.WebhookDelivery{}, false
+	}
+
+	id, parseErr := strconv.ParseInt(mux.Vars(r)["deliveryId"], 10, 64)
+	var delivery *domain.WebhookDelivery
+	var getErr error
+	if parseErr == nil {
+		delivery, getErr = webhooksRepository.getDelivery(webhook.Id, id)
+	}
+
+	if getErr != nil {
+		logger.Error("Error while getting delivery: " + mux.Vars(r)["deliveryId"] + " with error: " + getErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return domain.WebhookDelivery{}, false
+	}
+	if delivery == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return domain.WebhookDelivery{}, false
+	}
+	return *delivery, true
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go-rest-webservices-book-library/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type webhooksRepositoryMock struct{}
+
+var (
+	webhooksRepositoryGetWebhookMock    func(id int64) (*domain.Webhook, error)
+	webhooksRepositoryAddWebhookMock    func(webhook domain.Webhook) (int64, error)
+	webhooksRepositoryUpdateWebhookMock func(webhook domain.Webhook) error
+	webhooksRepositoryGetDeliveriesMock func(webhookId int64, status string, limit int64, offset int64) ([]domain.WebhookDelivery, error)
+)
+
+func (w webhooksRepositoryMock) getWebhooks() ([]domain.Webhook, error) {
+	webhook, err := webhooksRepositoryGetWebhookMock(1)
+	return []domain.Webhook{*webhook}, err
+}
+
+func (w webhooksRepositoryMock) getWebhook(id int64) (*domain.Webhook, error) {
+	return webhooksRepositoryGetWebhookMock(id)
+}
+
+func (w webhooksRepositoryMock) addWebhook(webhook domain.Webhook) (int64, error) {
+	return webhooksRepositoryAddWebhookMock(webhook)
+}
+
+func (w webhooksRepositoryMock) updateWebhook(webhook domain.Webhook) error {
+	return webhooksRepositoryUpdateWebhookMock(webhook)
+}
+
+func (w webhooksRepositoryMock) deleteWebhook(id int64) error {
+	return nil
+}
+
+func (w webhooksRepositoryMock) getDeliveries(webhookId int64, status string, limit int64, offset int64) ([]domain.WebhookDelivery, error) {
+	return webhooksRepositoryGetDeliveriesMock(webhookId, status, limit, offset)
+}
+
+func (w webhooksRepositoryMock) getDelivery(webhookId int64, id int64) (*domain.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (w webhooksRepositoryMock) getDeliveryAttempts(deliveryId int64) ([]domain.WebhookAttempt, error) {
+	return []domain.WebhookAttempt{}, nil
+}
+
+func (w webhooksRepositoryMock) redeliver(webhookId int64, id int64) (bool, error) {
+	return false, nil
+}
+
+func mockWebhooks() {
+	webhooksRepositoryGetWebhookMock = func(id int64) (*domain.Webhook, error) {
+		if id != 1 {
+			return nil, nil
+		}
+		return &domain.Webhook{Id: 1, Url: "https://example.com/hook", Secret: "secret", Events: []string{domain.EventBookCreated}, Active: true}, nil
+	}
+	webhooksRepositoryAddWebhookMock = func(webhook domain.Webhook) (int64, error) {
+		return 2, nil
+	}
+	webhooksRepositoryUpdateWebhookMock = func(webhook domain.Webhook) error {
+		return nil
+	}
+	webhooksRepositoryGetDeliveriesMock = func(webhookId int64, status string, limit int64, offset int64) ([]domain.WebhookDelivery, error) {
+		return []domain.WebhookDelivery{}, nil
+	}
+}
+
+// serveWebhooks sends a request as staff unless it is signedOut.
+func serveWebhooks(method string, path string, data []byte, signedOut bool) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.HandleFunc("/webhooks", GetWebhooksHandler).Methods("GET")
+	router.HandleFunc("/webhooks", AddWebhookHandler).Methods("POST")
+	router.HandleFunc("/webhooks/{id}", WebhookHandler).Methods("GET", "PUT", "DELETE")
+	router.HandleFunc("/webhooks/{id}/deliveries", GetWebhookDeliveriesHandler).Methods("GET")
+
+	r, _ := http.NewRequest(method, path, bytes.NewReader(data))
+	if !signedOut {
+		asStaff(r)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	TestSetup(t)
+	mockWebhooks()
+	scenarios := []struct {
+		name      string
+		method    string
+		path      string
+		data      []byte
+		signedOut bool
+		status    int
+	}{
+		{name: "List webhooks signed out", method: "GET", path: "/webhooks", signedOut: true, status: http.StatusUnauthorized},
+		{name: "Create webhook signed out", method: "POST", path: "/webhooks", data: []byte(`{"Url":"https://example.com/hook","Events":["book.created"]}`), signedOut: true, status: http.StatusUnauthorized},
+		{name: "Create webhook", method: "POST", path: "/webhooks", data: []byte(`{"Url":"https://example.com/hook","Events":["book.created","loan.overdue"]}`), status: http.StatusCreated},
+		{name: "Create webhook without events", method: "POST", path: "/webhooks", data: []byte(`{"Url":"https://example.com/hook"}`), status: http.StatusUnprocessableEntity},
+		{name: "Create webhook for unknown event", method: "POST", path: "/webhooks", data: []byte(`{"Url":"https://example.com/hook","Events":["book.read"]}`), status: http.StatusUnprocessableEntity},
+		{name: "Create webhook with invalid url", method: "POST", path: "/webhooks", data: []byte(`{"Url":"example.com","Events":["book.created"]}`), status: http.StatusUnprocessableEntity},
+		{name: "Create webhook for a loopback address", method: "POST", path: "/webhooks", data: []byte(`{"Url":"http://127.0.0.1:8080/hook","Events":["book.created"]}`), status: http.StatusUnprocessableEntity},
+		{name: "Create webhook for localhost", method: "POST", path: "/webhooks", data: []byte(`{"Url":"http://localhost/hook","Events":["book.created"]}`), status: http.StatusUnprocessableEntity},
+		{name: "Create webhook for a private address", method: "POST", path: "/webhooks", data: []byte(`{"Url":"http://10.0.0.8/hook","Events":["book.created"]}`), status: http.StatusUnprocessableEntity},
+		{name: "Get webhook signed out", method: "GET", path: "/webhooks/1", signedOut: true, status: http.StatusUnauthorized},
+		{name: "Get webhook", method: "GET", path: "/webhooks/1", status: http.StatusOK},
+		{name: "Get missing webhook", method: "GET", path: "/webhooks/3", status: http.StatusNotFound},
+		{name: "Get webhook with invalid id", method: "GET", path: "/webhooks/abc", status: http.StatusNotFound},
+		{name: "Deactivate webhook", method: "PUT", path: "/webhooks/1", data: []byte(`{"Active":false}`), status: http.StatusOK},
+		{name: "Change webhook secret", method: "PUT", path: "/webhooks/1", data: []byte(`{"Secret":"other"}`), status: http.StatusUnprocessableEntity},
+		{name: "Point webhook at a link-local address", method: "PUT", path: "/webhooks/1", data: []byte(`{"Url":"http://169.254.169.254/latest/meta-data"}`), status: http.StatusUnprocessableEntity},
+		{name: "Delete webhook signed out", method: "DELETE", path: "/webhooks/1", signedOut: true, status: http.StatusUnauthorized},
+		{name: "Delete webhook", method: "DELETE", path: "/webhooks/1", status: http.StatusNoContent},
+		{name: "List dead deliveries", method: "GET", path: "/webhooks/1/deliveries?status=dead", status: http.StatusOK},
+		{name: "List deliveries with unknown status", method: "GET", path: "/webhooks/1/deliveries?status=lost", status: http.StatusBadRequest},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if w := serveWebhooks(s.method, s.path, s.data, s.signedOut); w.Code != s.status {
+				t.Errorf("Expected status %v, got %v: %v", s.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookSecretIsOnlyShownOnCreate(t *testing.T) {
+	TestSetup(t)
+	mockWebhooks()
+
+	var created domain.Webhook
+	w := serveWebhooks("POST", "/webhooks", []byte(`{"Url":"https://example.com/hook","Events":["book.created"]}`), false)
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if len(created.Secret) != 2*secretBytes || !created.Active {
+		t.Errorf("Expected an active webhook with a generated secret, got %v", created)
+	}
+	if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "no-store" {
+		t.Errorf("Expected the response with the secret not to be stored, got Cache-Control %q", cacheControl)
+	}
+
+	for _, path := range []string{"/webhooks", "/webhooks/1"} {
+		if w = serveWebhooks("GET", path, nil, false); bytes.Contains(w.Body.Bytes(), []byte(`"secret"`)) {
+			t.Errorf("Expected %v to hide the secret, got %v", path, w.Body.String())
+		}
+	}
+}
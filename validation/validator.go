@@ -0,0 +1,383 @@
+package validation
+
+import (
+	"go-rest-webservices-book-library/domain"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	validateTag   = "validate"
+	patternTag    = "pattern"
+	ruleSeparator = ","
+	argSeparator  = "="
+	enumSeparator = "|"
+	minimumYear   = 1000
+)
+
+// FieldErrors holds the failed rules of an entity keyed by its JSON field name.
+type FieldErrors map[string][]string
+
+type rule struct {
+	name string
+	arg  string
+}
+
+type fieldRules struct {
+	index   int
+	name    string
+	rules   []rule
+	pattern *regexp.Regexp
+}
+
+var rulesCache sync.Map
+
+// Validate checks every field of entity, a struct or a pointer to one, against the rules
+// declared in its `validate` and `pattern` struct tags. Supported rules are:
+//
+//	required      field must not be empty
+//	min=N, max=N  length of strings and slices, value of numbers
+//	oneof=a|b|c   value must be one of the listed values
+//	isbn          ISBN-10 or ISBN-13 with a valid checksum
+//	year[=N]      a year between N (default 1000) and next year
+//	email         a bare email address, such as ged@roke.example
+//	publicurl     a URL whose host is neither localhost nor a loopback, link-local or
+//	              private address
+//	dive          validate every struct of a slice, as Field[i].Name
+//
+// and `pattern:"regex"` for regular expressions. Rules other than required are skipped
+// for empty values, so optional fields only get checked when they are set.
+func Validate(entity interface{}) FieldErrors {
+	return validate(entity, nil)
+}
+
+// ValidateFields is Validate restricted to the given JSON field names, for partial
+// updates and imports where absent fields keep their current value.
+func ValidateFields(entity interface{}, fields ...string) FieldErrors {
+	only := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		only[strings.ToLower(field)] = true
+	}
+	return validate(entity, only)
+}
+
+func (f FieldErrors) Error() string {
+	var messages []string
+	for _, violation := range f.Violations() {
+		messages = append(messages, violation.Field+": "+violation.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Violations flattens the errors into a slice ordered by field name.
+func (f FieldErrors) Violations() []domain.Violation {
+	fields := make([]string, 0, len(f))
+	for field := range f {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var violations []domain.Violation
+	for _, field := range fields {
+		for _, message := range f[field] {
+			violations = append(violations, domain.Violation{Field: field, Message: message})
+		}
+	}
+	return violations
+}
+
+func (f FieldErrors) add(field string, message string) {
+	f[field] = append(f[field], message)
+}
+
+func validate(entity interface{}, only map[string]bool) FieldErrors {
+	value := reflect.Indirect(reflect.ValueOf(entity))
+	fieldErrors := FieldErrors{}
+
+	for _, field := range rulesFor(value.Type()) {
+		if only != nil && !only[strings.ToLower(field.name)] {
+			continue
+		}
+
+		fieldValue := value.Field(field.index)
+		if isEmpty(fieldValue) {
+			if hasRule(field.rules, "required") {
+				fieldErrors.add(field.name, "is required")
+			}
+			continue
+		}
+
+		for _, fieldRule := range field.rules {
+			if message, ok := check(fieldRule, fieldValue); !ok {
+				fieldErrors.add(field.name, message)
+			}
+		}
+		if field.pattern != nil && !field.pattern.MatchString(fieldValue.String()) {
+			fieldErrors.add(field.name, "must match pattern "+field.pattern.String())
+		}
+		if hasRule(field.rules, "dive") && fieldValue.Kind() == reflect.Slice {
+			for i := 0; i < fieldValue.Len(); i++ {
+				prefix := field.name + "[" + strconv.Itoa(i) + "]."
+				for name, messages := range validate(fieldValue.Index(i).Interface(), nil) {
+					fieldErrors[prefix+name] = append(fieldErrors[prefix+name], messages...)
+				}
+			}
+		}
+	}
+
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	return fieldErrors
+}
+
+func check(fieldRule rule, value reflect.Value) (string, bool) {
+	switch fieldRule.name {
+	case "min":
+		limit, _ := strconv.ParseFloat(fieldRule.arg, 64)
+		if isNumber(value) {
+			return "must be at least " + fieldRule.arg, number(value) >= limit
+		}
+		return "must be at least " + fieldRule.arg + " characters long", float64(length(value)) >= limit
+	case "max":
+		limit, _ := strconv.ParseFloat(fieldRule.arg, 64)
+		if isNumber(value) {
+			return "must be at most " + fieldRule.arg, number(value) <= limit
+		}
+		return "must be at most " + fieldRule.arg + " characters long", float64(length(value)) <= limit
+	case "oneof":
+		options := strings.Split(fieldRule.arg, enumSeparator)
+		message := "must be one of " + strings.Join(options, ", ")
+		// Lists must only hold allowed values.
+		if value.Kind() == reflect.Slice {
+			for i := 0; i < value.Len(); i++ {
+				if !isOneOf(options, value.Index(i)) {
+					return message, false
+				}
+			}
+			return "", true
+		}
+		return message, isOneOf(options, value)
+	case "isbn":
+		return "is not a valid ISBN", IsValidIsbn(value.String())
+	case "email":
+		address, err := mail.ParseAddress(value.String())
+		return "is not a valid email address", err == nil && address.Address == value.String()
+	case "publicurl":
+		return "must not point at localhost or a loopback, link-local or private address", isPublicUrl(value.String())
+	case "year":
+		from := minimumYear
+		if fieldRule.arg != "" {
+			from, _ = strconv.Atoi(fieldRule.arg)
+		}
+		to := time.Now().Year() + 1
+		year := int(number(value))
+		return "must be a year between " + strconv.Itoa(from) + " and " + strconv.Itoa(to), year >= from && year <= to
+	}
+	return "", true
+}
+
+// IsValidIsbn reports whether isbn, ignoring hyphens and spaces, is an ISBN-10 or
+// ISBN-13 with a correct check digit.
+func IsValidIsbn(isbn string) bool {
+	digits := isbnDigits(isbn)
+
+	switch len(digits) {
+	case 10:
+		sum := 0
+		for i, digit := range digits {
+			var value int
+			if digit == 'X' && i == 9 {
+				value = 10
+			} else if digit >= '0' && digit <= '9' {
+				value = int(digit - '0')
+			} else {
+				return false
+			}
+			sum += (10 - i) * value
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i, digit := range digits {
+			if digit < '0' || digit > '9' {
+				return false
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += weight * int(digit-'0')
+		}
+		return sum%10 == 0
+	}
+	return false
+}
+
+// IsPublicIp reports whether ip can be reached from outside the host and its network:
+// it is not unspecified, loopback, link-local or private.
+func IsPublicIp(ip net.IP) bool {
+	return !ip.IsUnspecified() && !ip.IsLoopback() && !ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// isPublicUrl tells the URLs which do not name localhost or an address IsPublicIp
+// refuses. Host names resolving to such addresses are only known once they are dialled.
+func isPublicUrl(rawUrl string) bool {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return IsPublicIp(ip)
+	}
+	return true
+}
+
+// NormalizeIsbn returns isbn as the 13 digits of an ISBN-13, converting ISBN-10s, so
+// that both forms of the same ISBN compare equal. Invalid ISBNs normalize to "".
+func NormalizeIsbn(isbn string) string {
+	if !IsValidIsbn(isbn) {
+		return ""
+	}
+	digits := isbnDigits(isbn)
+	if len(digits) == 13 {
+		return digits
+	}
+
+	digits = "978" + digits[:9]
+	sum := 0
+	for i, digit := range digits {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(digit-'0')
+	}
+	return digits + strconv.Itoa((10-sum%10)%10)
+}
+
+func isbnDigits(isbn string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(isbn))
+}
+
+func rulesFor(entityType reflect.Type) []fieldRules {
+	if cached, ok := rulesCache.Load(entityType); ok {
+		return cached.([]fieldRules)
+	}
+
+	var parsed []fieldRules
+	for i := 0; i < entityType.NumField(); i++ {
+		structField := entityType.Field(i)
+		validateValue, hasValidate := structField.Tag.Lookup(validateTag)
+		patternValue, hasPattern := structField.Tag.Lookup(patternTag)
+		if structField.PkgPath != "" || (!hasValidate && !hasPattern) {
+			continue
+		}
+
+		field := fieldRules{index: i, name: jsonName(structField)}
+		for _, definition := range strings.Split(validateValue, ruleSeparator) {
+			if definition == "" {
+				continue
+			}
+			parts := strings.SplitN(definition, argSeparator, 2)
+			fieldRule := rule{name: parts[0]}
+			if len(parts) == 2 {
+				fieldRule.arg = parts[1]
+			}
+			field.rules = append(field.rules, fieldRule)
+		}
+		if hasPattern {
+			field.pattern = regexp.MustCompile(patternValue)
+		}
+		parsed = append(parsed, field)
+	}
+
+	rulesCache.Store(entityType, parsed)
+	return parsed
+}
+
+func jsonName(structField reflect.StructField) string {
+	if tag := strings.Split(structField.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+		return tag
+	}
+	return structField.Name
+}
+
+func hasRule(rules []rule, name string) bool {
+	for _, fieldRule := range rules {
+		if fieldRule.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+func isOneOf(options []string, value reflect.Value) bool {
+	text := stringOf(value)
+	for _, option := range options {
+		if option == text {
+			return true
+		}
+	}
+	return false
+}
+
+func isNumber(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func number(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	return 0
+}
+
+func length(value reflect.Value) int {
+	if value.Kind() == reflect.String {
+		return utf8.RuneCountInString(value.String())
+	}
+	return value.Len()
+}
+
+func stringOf(value reflect.Value) string {
+	if isNumber(value) {
+		return strconv.FormatFloat(number(value), 'f', -1, 64)
+	}
+	return value.String()
+}
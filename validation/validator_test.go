@@ -0,0 +1,154 @@
+package validation
+
+import (
+	"testing"
+)
+
+type edition struct {
+	Title  string     `validate:"required,min=2,max=10"`
+	Isbn   string     `validate:"isbn"`
+	Year   int        `validate:"year=1450"`
+	Format string     `json:"format" validate:"oneof=hardcover|paperback"`
+	Code   string     `pattern:"^[A-Z]{3}$"`
+	Editor string     `validate:"email"`
+	Site   string     `validate:"publicurl"`
+	Copies int        `validate:"min=1,max=20"`
+	Tags   []string   `validate:"max=2,oneof=new|classic"`
+	Prints []printing `validate:"max=3,dive"`
+}
+
+type printing struct {
+	Run  int    `validate:"required,min=100"`
+	Note string `json:"note" validate:"max=5"`
+}
+
+type scenario struct {
+	name     string
+	entity   edition
+	fields   []string
+	expected map[string]int
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	scenarios := []scenario{
+		{
+			name:     "should accept valid entity",
+			entity:   edition{Title: "Book", Isbn: "978-0-261-10221-7", Year: 1937, Format: "paperback", Code: "ABC", Editor: "ged@roke.example", Copies: 2},
+			expected: map[string]int{},
+		},
+		{
+			name:     "should accept isbn 10 with X check digit",
+			entity:   edition{Title: "Book", Isbn: "0-8044-2957-X"},
+			expected: map[string]int{},
+		},
+		{
+			name:     "should require title",
+			entity:   edition{Title: "  "},
+			expected: map[string]int{"Title": 1},
+		},
+		{
+			name:     "should check length and numeric limits",
+			entity:   edition{Title: "A very long title", Copies: 21},
+			expected: map[string]int{"Title": 1, "Copies": 1},
+		},
+		{
+			name:     "should reject bad isbn checksum",
+			entity:   edition{Title: "Book", Isbn: "978-0-261-10221-8"},
+			expected: map[string]int{"Isbn": 1},
+		},
+		{
+			name:     "should reject years out of range",
+			entity:   edition{Title: "Book", Year: 1200},
+			expected: map[string]int{"Year": 1},
+		},
+		{
+			name:     "should key errors by json name and check enum and pattern",
+			entity:   edition{Title: "Book", Format: "scroll", Code: "abc"},
+			expected: map[string]int{"format": 1, "Code": 1},
+		},
+		{
+			name:     "should accept bare email addresses alone",
+			entity:   edition{Title: "Book", Editor: "Ged <ged@roke.example>"},
+			expected: map[string]int{"Editor": 1},
+		},
+		{
+			name:     "should accept urls of public hosts",
+			entity:   edition{Title: "Book", Site: "https://press.example/books"},
+			expected: map[string]int{},
+		},
+		{
+			name:     "should refuse urls of localhost",
+			entity:   edition{Title: "Book", Site: "http://api.localhost:8080/books"},
+			expected: map[string]int{"Site": 1},
+		},
+		{
+			name:     "should refuse urls of link-local addresses",
+			entity:   edition{Title: "Book", Site: "http://169.254.169.254/latest/meta-data"},
+			expected: map[string]int{"Site": 1},
+		},
+		{
+			name:     "should refuse urls of private addresses",
+			entity:   edition{Title: "Book", Site: "https://[fd00::1]/books"},
+			expected: map[string]int{"Site": 1},
+		},
+		{
+			name:     "should check every element of lists against enum",
+			entity:   edition{Title: "Book", Tags: []string{"classic", "old"}},
+			expected: map[string]int{"Tags": 1},
+		},
+		{
+			name:     "should check length of lists",
+			entity:   edition{Title: "Book", Tags: []string{"new", "classic", "new"}},
+			expected: map[string]int{"Tags": 1},
+		},
+		{
+			name:     "should check every struct of lists",
+			entity:   edition{Title: "Book", Prints: []printing{{Run: 500}, {Run: 50, Note: "signed"}, {}}},
+			expected: map[string]int{"Prints[1].Run": 1, "Prints[1].note": 1, "Prints[2].Run": 1},
+		},
+		{
+			name:     "should only check listed fields",
+			entity:   edition{Isbn: "123"},
+			fields:   []string{"isbn"},
+			expected: map[string]int{"Isbn": 1},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			var got FieldErrors
+			if scenario.fields == nil {
+				got = Validate(scenario.entity)
+			} else {
+				got = ValidateFields(&scenario.entity, scenario.fields...)
+			}
+
+			if len(got) != len(scenario.expected) {
+				t.Fatalf("Expected %v, got %v", scenario.expected, got)
+			}
+			for field, count := range scenario.expected {
+				if len(got[field]) != count {
+					t.Errorf("Expected %v errors for %v, got %v", count, field, got[field])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeIsbn(t *testing.T) {
+	t.Parallel()
+	scenarios := map[string]string{
+		"978-0-261-10221-7": "9780261102217",
+		"0-261-10221-4":     "9780261102217",
+		"0 8044 2957 x":     "9780804429573",
+		"978-0-261-10221-8": "",
+		"":                  "",
+	}
+
+	for isbn, expected := range scenarios {
+		if normalized := NormalizeIsbn(isbn); normalized != expected {
+			t.Errorf("Expected %v to normalize to %q, got %q", isbn, expected, normalized)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go-rest-webservices-book-library/config"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/repository"
+	"go-rest-webservices-book-library/validation"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Library-Signature"
+	TimestampHeader = "X-Library-Timestamp"
+	EventHeader     = "X-Library-Event"
+	DeliveryHeader  = "X-Library-Delivery"
+
+	signaturePrefix = "sha256="
+	batchSize       = 20
+	maxErrorLength  = 255
+)
+
+// Dispatcher delivers the outbox of webhook deliveries. Every delivery is retried with
+// exponential backoff until it succeeds or has failed MaxAttempts times, it is then dead
+// and only delivered again when asked to through the API.
+type Dispatcher struct {
+	Client         *http.Client
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	PollInterval   time.Duration
+}
+
+var logger *zap.Logger
+
+func init() {
+	logger = config.AppLogger
+}
+
+// NewDispatcher returns a Dispatcher configured by the webhooks section of config.yml. Its
+// client only connects to public addresses, whatever the host names of webhooks resolve
+// to by the time they are delivered, and does not go through a proxy so that it is the
+// webhook itself which is checked.
+func NewDispatcher() *Dispatcher {
+	dialer := &net.Dialer{Timeout: config.WebhookTimeout, Control: dialPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &Dispatcher{
+		Client:         &http.Client{Timeout: config.WebhookTimeout, Transport: transport},
+		MaxAttempts:    config.WebhookMaxAttempts,
+		InitialBackoff: config.WebhookInitialBackoff,
+		MaxBackoff:     config.WebhookMaxBackoff,
+		PollInterval:   config.WebhookPollInterval,
+	}
+}
+
+// dialPublic refuses to connect to addresses which validation.IsPublicIp refuses, so that
+// webhooks can not reach the services on the host or its network.
+func dialPublic(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !validation.IsPublicIp(ip) {
+		return errors.New("refusing to deliver to " + host + ", which is not a public address")
+	}
+	return nil
+}
+
+// Run delivers due webhooks every PollInterval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.DeliverDue(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts every delivery due at now. Loans going overdue are queued by the
+// overdue job of the jobs package.
+func (d *Dispatcher) DeliverDue(ctx context.Context, now time.Time) {
+	for ctx.Err() == nil {
+		deliveries, err := repository.GetDueDeliveries(now, batchSize)
+		if err != nil {
+			logger.Error("Error while fetching due webhook deliveries with error: " + err.Error())
+			return
+		}
+
+		webhooks := map[int64]*domain.Webhook{}
+		for _, delivery := range deliveries {
+			webhook, found := webhooks[delivery.WebhookId]
+			if !found {
+				if webhook, err = repository.GetWebhook(delivery.WebhookId); err != nil {
+					logger.Error("Error while fetching webhook: " + strconv.FormatInt(delivery.WebhookId, 10) + " with error: " + err.Error())
+					return
+				}
+				webhooks[delivery.WebhookId] = webhook
+			}
+			if webhook == nil {
+				continue
+			}
+			// Stop rather than fetch the same deliveries again when they can not be updated.
+			if err = d.deliver(ctx, *webhook, delivery); err != nil {
+				logger.Error("Error while recording webhook delivery: " + strconv.FormatInt(delivery.Id, 10) + " with error: " + err.Error())
+				return
+			}
+		}
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, webhook domain.Webhook, delivery domain.WebhookDelivery) error {
+	attempt := domain.WebhookAttempt{DeliveryId: delivery.Id, AttemptedAt: time.Now()}
+	attempt.StatusCode, attempt.Error = d.post(ctx, webhook, delivery)
+	attempt.DurationMs = time.Since(attempt.AttemptedAt).Milliseconds()
+
+	delivery.Attempts++
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastError = attempt.Error
+	switch {
+	case attempt.Error == "":
+		delivery.Status = domain.DeliveryDelivered
+		delivery.DeliveredAt = &attempt.AttemptedAt
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = domain.DeliveryDead
+		logger.Error("Webhook delivery: " + strconv.FormatInt(delivery.Id, 10) + " is dead after " +
+			strconv.Itoa(delivery.Attempts) + " attempts, last error: " + attempt.Error)
+	default:
+		delivery.NextAttemptAt = attempt.AttemptedAt.Add(d.backoff(delivery.Attempts))
+	}
+
+	return repository.RecordDeliveryAttempt(delivery, attempt)
+}
+
+// post sends the payload of delivery and returns the status code and, unless the webhook
+// answered with 2xx, the reason the attempt failed.
+func (d *Dispatcher) post(ctx context.Context, webhook domain.Webhook, delivery domain.WebhookDelivery) (int, string) {
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequestWithContext(ctx, "POST", webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, truncate(err.Error())
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.EventType)
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	response, err := d.Client.Do(request)
+	if err != nil {
+		return 0, truncate(err.Error())
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, 1<<16))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, "webhook answered " + response.Status
+	}
+	return response.StatusCode, ""
+}
+
+// backoff doubles the wait after every failed attempt, from InitialBackoff up to
+// MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.InitialBackoff
+	for i := 1; i < attempts && wait < d.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.MaxBackoff {
+		wait = d.MaxBackoff
+	}
+	return wait
+}
+
+// Sign returns the X-Library-Signature of a payload: the hex HMAC-SHA256, keyed with the
+// webhook secret, of the X-Library-Timestamp, a dot and the body. Receivers compute the
+// same to check a payload comes from the library and reject old timestamps to stop
+// replays.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func truncate(message string) string {
+	if len(message) > maxErrorLength {
+		return message[:maxErrorLength]
+	}
+	return message
+}
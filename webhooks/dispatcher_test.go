@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"context"
+	"go-rest-webservices-book-library/domain"
+	"go-rest-webservices-book-library/repository"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type scenario struct {
+	name     string
+	attempts int
+	backoff  time.Duration
+}
+
+func newDispatcher(maxAttempts int) *Dispatcher {
+	return &Dispatcher{
+		Client:         &http.Client{Timeout: 5 * time.Second},
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     10 * time.Minute,
+		PollInterval:   time.Second,
+	}
+}
+
+// subscribe adds a webhook for book.created pointing at url and creates a book, which
+// queues one delivery for it.
+func subscribe(t *testing.T, url string) (domain.Webhook, domain.WebhookDelivery) {
+	webhook := domain.Webhook{Url: url, Secret: "secret", Events: []string{domain.EventBookCreated}, Active: true, CreatedAt: time.Now()}
+	id, err := repository.AddWebhook(webhook)
+	if err != nil {
+		t.Fatalf("Expected webhook to be added, got %v", err)
+	}
+	webhook.Id = id
+
+	if _, err = repository.AddBook(domain.Book{Name: "Webhook Book", Author: "Webhook Author"}); err != nil {
+		t.Fatalf("Expected book to be added, got %v", err)
+	}
+	deliveries, err := repository.GetDeliveries(id, "", 10, 0)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected one delivery to be queued, got %v, %v", deliveries, err)
+	}
+	return webhook, deliveries[0]
+}
+
+func TestDispatcherSignsDeliveries(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+
+	webhook, delivery := subscribe(t, server.URL)
+	newDispatcher(3).DeliverDue(context.Background(), time.Now())
+
+	select {
+	case r := <-received:
+		if r.Header.Get(EventHeader) != domain.EventBookCreated {
+			t.Errorf("Expected event %v, got %v", domain.EventBookCreated, r.Header.Get(EventHeader))
+		}
+		expected := Sign(webhook.Secret, r.Header.Get(TimestampHeader), body)
+		if r.Header.Get(SignatureHeader) != expected {
+			t.Errorf("Expected signature %v, got %v", expected, r.Header.Get(SignatureHeader))
+		}
+		if string(body) != delivery.Payload {
+			t.Errorf("Expected payload %v, got %v", delivery.Payload, string(body))
+		}
+	default:
+		t.Fatal("Expected the webhook to be called")
+	}
+
+	delivered, err := repository.GetDelivery(webhook.Id, delivery.Id)
+	if err != nil || delivered.Status != domain.DeliveryDelivered || delivered.DeliveredAt == nil {
+		t.Errorf("Expected delivery to be delivered, got %v, %v", delivered, err)
+	}
+}
+
+func TestDispatcherRetriesUntilDead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	webhook, delivery := subscribe(t, server.URL)
+	dispatcher := newDispatcher(2)
+	now := time.Now()
+
+	dispatcher.DeliverDue(context.Background(), now)
+	retried, _ := repository.GetDelivery(webhook.Id, delivery.Id)
+	if retried.Status != domain.DeliveryPending || retried.Attempts != 1 || retried.LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected delivery to be retried, got %v", retried)
+	}
+	if retried.NextAttemptAt.Before(now.Add(time.Minute)) {
+		t.Errorf("Expected next attempt after %v, got %v", now.Add(time.Minute), retried.NextAttemptAt)
+	}
+
+	dispatcher.DeliverDue(context.Background(), now)
+	if unchanged, _ := repository.GetDelivery(webhook.Id, delivery.Id); unchanged.Attempts != 1 {
+		t.Errorf("Expected no attempt before the backoff passed, got %v", unchanged.Attempts)
+	}
+
+	dispatcher.DeliverDue(context.Background(), now.Add(2*time.Minute))
+	dead, _ := repository.GetDelivery(webhook.Id, delivery.Id)
+	if dead.Status != domain.DeliveryDead || dead.Attempts != 2 {
+		t.Errorf("Expected delivery to be dead, got %v", dead)
+	}
+	if attempts, err := repository.GetDeliveryAttempts(delivery.Id); err != nil || len(attempts) != 2 {
+		t.Errorf("Expected two attempts, got %v, %v", attempts, err)
+	}
+
+	if found, err := repository.Redeliver(webhook.Id, delivery.Id); !found || err != nil {
+		t.Fatalf("Expected delivery to be redelivered, got %v, %v", found, err)
+	}
+	redelivered, _ := repository.GetDelivery(webhook.Id, delivery.Id)
+	if redelivered.Status != domain.DeliveryPending || redelivered.Attempts != 0 {
+		t.Errorf("Expected delivery to be pending again, got %v", redelivered)
+	}
+}
+
+func TestNewDispatcherOnlyReachesPublicAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the loopback address to be refused, got a request for %v", r.URL)
+	}))
+	defer server.Close()
+
+	response, err := NewDispatcher().Client.Get(server.URL)
+	if err == nil {
+		_ = response.Body.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("Expected the loopback address to be refused, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	scenarios := []scenario{
+		{name: "First retry waits the initial backoff", attempts: 1, backoff: time.Minute},
+		{name: "Every retry doubles the wait", attempts: 3, backoff: 4 * time.Minute},
+		{name: "Wait is capped", attempts: 5, backoff: 10 * time.Minute},
+		{name: "Wait stays capped", attempts: 60, backoff: 10 * time.Minute},
+	}
+
+	dispatcher := newDispatcher(3)
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if backoff := dispatcher.backoff(s.attempts); backoff != s.backoff {
+				t.Errorf("Expected %v, got %v", s.backoff, backoff)
+			}
+		})
+	}
+}